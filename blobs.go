@@ -248,6 +248,38 @@ type BlobWriter interface {
 	Cancel(ctx context.Context) error
 }
 
+// BlobWriteProgress describes how much of the content written to a
+// BlobWriter has been persisted by the backing store.
+type BlobWriteProgress struct {
+	// PartsCompleted is the number of parts stored by the backend, if the
+	// backend writes in parts.
+	PartsCompleted int
+
+	// BytesPersisted is the number of bytes stored by the backend.
+	BytesPersisted int64
+
+	// BytesBuffered is the number of bytes accepted but not yet stored by
+	// the backend.
+	BytesBuffered int64
+}
+
+// BlobWriteProgressReporter may be implemented by a BlobWriter which is able
+// to report detailed progress of the write.
+type BlobWriteProgressReporter interface {
+	// Progress returns the current progress of the blob write.
+	Progress() BlobWriteProgress
+}
+
+// BlobWriteDigestReporter may be implemented by a BlobWriter which is able
+// to report the digest of the content written so far, so that clients can
+// detect a corrupted upload before completing it.
+type BlobWriteDigestReporter interface {
+	// HashedDigest returns the digest of the first size bytes written. ok
+	// is false if the digest of the content written so far is not
+	// available.
+	HashedDigest() (dgst digest.Digest, size int64, ok bool)
+}
+
 // BlobService combines the operations to access, read and write blobs. This
 // can be used to describe remote blob services.
 type BlobService interface {
@@ -72,6 +72,14 @@ type Configuration struct {
 		// Net specifies the net portion of the bind address. A default empty value means tcp.
 		Net string `yaml:"net,omitempty"`
 
+		// Listeners specifies additional bind addresses, for example to
+		// listen on IPv4 and IPv6 addresses separately.
+		Listeners []Listener `yaml:"listeners,omitempty"`
+
+		// ProxyProtocol configures the HAProxy PROXY protocol on all
+		// listeners, so that client addresses survive L4 load balancers.
+		ProxyProtocol ProxyProtocol `yaml:"proxyprotocol,omitempty"`
+
 		// Host specifies an externally-reachable address for the registry, as a fully
 		// qualified URL.
 		Host string `yaml:"host,omitempty"`
@@ -89,6 +97,11 @@ type Configuration struct {
 		// receives a stop signal
 		DrainTimeout time.Duration `yaml:"draintimeout,omitempty"`
 
+		// BlobBufferSize is the size, in bytes, of the buffers blob content
+		// is copied through when served directly or uploaded. Zero uses the
+		// buffers of the Go standard library.
+		BlobBufferSize int `yaml:"blobbuffersize,omitempty"`
+
 		// TLS instructs the http server to listen with a TLS configuration.
 		// This only support simple tls configuration with a cert and key.
 		// Mostly, this is useful for testing situations or simple deployments
@@ -111,6 +124,11 @@ type Configuration struct {
 			// Specifies the lowest TLS version allowed
 			MinimumTLS string `yaml:"minimumtls,omitempty"`
 
+			// ReloadInterval specifies how often the certificate and key
+			// files are checked for changes, so that renewed certificates
+			// are served without a restart. Defaults to one minute.
+			ReloadInterval time.Duration `yaml:"reloadinterval,omitempty"`
+
 			// LetsEncrypt is used to configuration setting up TLS through
 			// Let's Encrypt instead of manually specifying certificate and
 			// key. If a TLS certificate is specified, the Let's Encrypt
@@ -126,6 +144,21 @@ type Configuration struct {
 				// Hosts specifies the hosts which are allowed to obtain Let's
 				// Encrypt certificates.
 				Hosts []string `yaml:"hosts,omitempty"`
+
+				// DirectoryURL specifies the ACME directory of the
+				// certificate authority. Defaults to the Let's Encrypt
+				// production directory.
+				DirectoryURL string `yaml:"directoryurl,omitempty"`
+
+				// RenewBefore specifies how long before expiry certificates
+				// are renewed. Defaults to 30 days.
+				RenewBefore time.Duration `yaml:"renewbefore,omitempty"`
+
+				// HTTPAddr specifies an address to answer HTTP-01 challenges
+				// on, usually ":80". Other requests to it are redirected to
+				// HTTPS. TLS-ALPN-01 challenges are always answered on the
+				// TLS listeners.
+				HTTPAddr string `yaml:"httpaddr,omitempty"`
 			} `yaml:"letsencrypt,omitempty"`
 		} `yaml:"tls,omitempty"`
 
@@ -139,8 +172,16 @@ type Configuration struct {
 		// include services such as pprof, expvar and other data that should
 		// not be exposed externally. Left disabled by default.
 		Debug struct {
-			// Addr specifies the bind address for the debug server.
+			// Net is the type of the debug listener, "tcp" or "unix".
+			// Defaults to tcp.
+			Net string `yaml:"net,omitempty"`
+			// Addr specifies the bind address for the debug server, or
+			// the path of its socket.
 			Addr string `yaml:"addr,omitempty"`
+			// AdminRoutes serves the /v2/_admin/ endpoints on the debug
+			// server instead of the public listeners, so that they can
+			// be firewalled with the other internal endpoints.
+			AdminRoutes bool `yaml:"adminroutes,omitempty"`
 			// Prometheus configures the Prometheus telemetry endpoint.
 			Prometheus struct {
 				Enabled bool   `yaml:"enabled,omitempty"`
@@ -154,6 +195,35 @@ type Configuration struct {
 			// to connect via http2. If set to true, only http/1.1 is supported.
 			Disabled bool `yaml:"disabled,omitempty"`
 		} `yaml:"http2,omitempty"`
+
+		// Concurrency limits the number of blob transfers processed
+		// simultaneously by this registry instance.
+		Concurrency Concurrency `yaml:"concurrency,omitempty"`
+
+		// HeadCache configures the caching of the results of recent blob
+		// and manifest existence checks.
+		HeadCache HeadCache `yaml:"headcache,omitempty"`
+
+		// AuthCache configures the caching of recent authorization
+		// decisions.
+		AuthCache AuthCache `yaml:"authcache,omitempty"`
+
+		// Bans configures the denial of requests from banned clients.
+		Bans Bans `yaml:"bans,omitempty"`
+
+		// Timeouts protects the registry from slow or stalled clients.
+		Timeouts Timeouts `yaml:"timeouts,omitempty"`
+
+		// UploadAffinity configures the hints with which load balancers
+		// route all requests of a blob upload to the same instance.
+		UploadAffinity UploadAffinity `yaml:"uploadaffinity,omitempty"`
+
+		// Memory configures the accounting of the memory held by
+		// in-flight requests, and its limit.
+		Memory Memory `yaml:"memory,omitempty"`
+
+		// CORS configures the cross-origin requests allowed from browsers.
+		CORS CORS `yaml:"cors,omitempty"`
 	} `yaml:"http,omitempty"`
 
 	// Notifications specifies configuration about various endpoint to which
@@ -203,6 +273,10 @@ type Configuration struct {
 			TrustKey string `yaml:"signingkeyfile,omitempty"`
 			// Enabled determines if schema1 manifests should be pullable
 			Enabled bool `yaml:"enabled,omitempty"`
+			// Disabled rejects the push and pull of schema1 manifests,
+			// including the conversion of schema2 manifests for clients
+			// not accepting them. It cannot be set with Enabled.
+			Disabled bool `yaml:"disabled,omitempty"`
 		} `yaml:"schema1,omitempty"`
 	} `yaml:"compatibility,omitempty"`
 
@@ -224,9 +298,105 @@ type Configuration struct {
 				// that URLs in pushed manifests must not match.
 				Deny []string `yaml:"deny,omitempty"`
 			} `yaml:"urls,omitempty"`
+			// Concurrency is the number of blobs and manifests referenced
+			// by a pushed manifest that are looked up at once.
+			Concurrency int `yaml:"concurrency,omitempty"`
+			// Configs enables checking that the config blobs of pushed
+			// manifests parse as their declared media type.
+			Configs bool `yaml:"configs,omitempty"`
+			// MaxSize is the largest manifest payload accepted, in bytes.
+			// It applies even when validation is disabled.
+			MaxSize int64 `yaml:"maxsize,omitempty"`
+			// MaxDepth is the deepest nesting of JSON objects and arrays
+			// accepted in a manifest payload. It applies even when
+			// validation is disabled.
+			MaxDepth int `yaml:"maxdepth,omitempty"`
 		} `yaml:"manifests,omitempty"`
+		// Repositories configures the constraints on repository names.
+		Repositories struct {
+			// MaxLength is the maximum number of characters in a
+			// repository name.
+			MaxLength int `yaml:"maxlength,omitempty"`
+			// MaxComponents is the maximum number of slash separated
+			// components in a repository name.
+			MaxComponents int `yaml:"maxcomponents,omitempty"`
+			// Component is a regular expression
+			// (https://godoc.org/regexp/syntax) that each component of a
+			// repository name must match.
+			Component string `yaml:"component,omitempty"`
+		} `yaml:"repositories,omitempty"`
 	} `yaml:"validation,omitempty"`
 
+	// Placement configures the storage classes blobs are stored in.
+	Placement Placement `yaml:"placement,omitempty"`
+
+	// PullStatistics configures the tracking of repository, tag and blob
+	// pulls.
+	PullStatistics PullStatistics `yaml:"pullstatistics,omitempty"`
+
+	// Bandwidth configures the accounting of the bytes pushed and pulled by
+	// each authenticated subject.
+	Bandwidth Bandwidth `yaml:"bandwidth,omitempty"`
+
+	// Timeline configures the recording of the events of each repository.
+	Timeline Timeline `yaml:"timeline,omitempty"`
+
+	// ReferenceIndex configures the index of the manifests referencing
+	// each blob.
+	ReferenceIndex ReferenceIndex `yaml:"referenceindex,omitempty"`
+
+	// TagIndex configures the index of the tags of each repository.
+	TagIndex TagIndex `yaml:"tagindex,omitempty"`
+
+	// IntentLog configures the recording of the mutations of several paths
+	// before they start.
+	IntentLog IntentLog `yaml:"intentlog,omitempty"`
+
+	// Namespaces configures quotas and access lists for groups of
+	// repositories sharing a name prefix.
+	Namespaces Namespaces `yaml:"namespaces,omitempty"`
+
+	// Helm serves the charts stored in namespaces as Helm chart
+	// repositories.
+	Helm Helm `yaml:"helm,omitempty"`
+
+	// UI serves a static web interface browsing the registry.
+	UI UI `yaml:"ui,omitempty"`
+
+	// Scanning configures the vulnerability scanning of pushed manifests.
+	Scanning Scanning `yaml:"scanning,omitempty"`
+
+	// Transcoding serves stored layers re-compressed in the format
+	// requested by clients.
+	Transcoding Transcoding `yaml:"transcoding,omitempty"`
+
+	// LayerIndexing configures the generation of seekable indexes of the
+	// layers of pushed images.
+	LayerIndexing LayerIndexing `yaml:"layerindexing,omitempty"`
+
+	// UploadQuota limits the bytes each authenticated subject can upload
+	// per day.
+	UploadQuota UploadQuota `yaml:"uploadquota,omitempty"`
+
+	// Retention configures how long content no longer referenced by a tag
+	// is kept by garbage collection.
+	Retention Retention `yaml:"retention,omitempty"`
+
+	// Tenants overlays parts of the configuration for the repositories of
+	// a namespace, so that isolated teams can share one deployment.
+	Tenants []Tenant `yaml:"tenants,omitempty"`
+
+	// Coordination elects a single instance to run background jobs among
+	// registry instances sharing a storage backend.
+	Coordination Coordination `yaml:"coordination,omitempty"`
+
+	// Admin configures the gRPC listener of the administrative API.
+	Admin Admin `yaml:"admin,omitempty"`
+
+	// Backup configures the periodic snapshots of the metadata of the
+	// registry.
+	Backup Backup `yaml:"backup,omitempty"`
+
 	// Policy configures registry policy options.
 	Policy struct {
 		// Repository configures policies for repositories
@@ -238,6 +408,10 @@ type Configuration struct {
 			// the class in authorized resources.
 			Classes []string `yaml:"classes"`
 		} `yaml:"repository,omitempty"`
+
+		// Admission configures an external service approving manifest
+		// pushes.
+		Admission Admission `yaml:"admission,omitempty"`
 	} `yaml:"policy,omitempty"`
 }
 
@@ -626,6 +800,636 @@ type Middleware struct {
 	Options Parameters `yaml:"options"`
 }
 
+// Listener is an additional bind address of the registry.
+type Listener struct {
+	// Net is tcp, tcp4, tcp6 or unix. An empty value means tcp.
+	Net string `yaml:"net,omitempty"`
+
+	// Addr is the bind address.
+	Addr string `yaml:"addr"`
+}
+
+// ProxyProtocol configures the HAProxy PROXY protocol, versions 1 and 2.
+type ProxyProtocol struct {
+	// Enabled requires connections from trusted networks to start with a
+	// PROXY protocol header.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// TrustedNetworks lists the networks of the load balancers, in CIDR
+	// notation. Connections from other networks are served without a
+	// header. It is required if Enabled is set and the registry listens on
+	// TCP.
+	TrustedNetworks []string `yaml:"trustednetworks,omitempty"`
+
+	// HeaderTimeout bounds the time to receive the header.
+	HeaderTimeout time.Duration `yaml:"headertimeout,omitempty"`
+}
+
+// Concurrency configures separate limits for blob uploads and downloads.
+type Concurrency struct {
+	// Uploads limits blob upload requests (POST, PATCH and PUT).
+	Uploads ConcurrencyLimit `yaml:"uploads,omitempty"`
+
+	// Downloads limits blob GET requests.
+	Downloads ConcurrencyLimit `yaml:"downloads,omitempty"`
+}
+
+// ConcurrencyLimit caps the number of requests of a kind processed at once.
+// Requests beyond the cap wait in a bounded queue and are rejected with a 503
+// once the queue is full or their wait exceeds the queue timeout.
+type ConcurrencyLimit struct {
+	// MaxConcurrent is the maximum number of requests processed at once. A
+	// value of zero disables the limit.
+	MaxConcurrent int `yaml:"maxconcurrent,omitempty"`
+
+	// MaxQueued is the maximum number of requests waiting for a free slot.
+	MaxQueued int `yaml:"maxqueued,omitempty"`
+
+	// QueueTimeout is the longest time a request waits in the queue. A
+	// value of zero waits until the client goes away.
+	QueueTimeout time.Duration `yaml:"queuetimeout,omitempty"`
+
+	// RetryAfter is advertised to rejected clients in the Retry-After
+	// header.
+	RetryAfter time.Duration `yaml:"retryafter,omitempty"`
+}
+
+// Timeouts bounds the time spent on HTTP requests. A value of zero disables
+// the corresponding timeout.
+type Timeouts struct {
+	// ReadHeader is the time allowed to read the headers of a request.
+	ReadHeader time.Duration `yaml:"readheader,omitempty"`
+
+	// Read is the time allowed to read a whole request, including its body.
+	Read time.Duration `yaml:"read,omitempty"`
+
+	// Write is the time allowed to write a response, counted from the end
+	// of the headers of the request.
+	Write time.Duration `yaml:"write,omitempty"`
+
+	// Idle is the time a keep-alive connection may wait for the next
+	// request.
+	Idle time.Duration `yaml:"idle,omitempty"`
+
+	// Upload aborts blob uploads from clients which stall or send data too
+	// slowly.
+	Upload UploadTimeouts `yaml:"upload,omitempty"`
+
+	// Routes bounds the whole processing of requests, by route name, such
+	// as blob, blob-upload-chunk or manifest. Requests past their deadline
+	// are aborted.
+	Routes map[string]time.Duration `yaml:"routes,omitempty"`
+}
+
+// UploadTimeouts configures the abort of slow blob uploads. Aborted uploads
+// are cancelled, releasing their storage.
+type UploadTimeouts struct {
+	// Stall is the longest time an upload request may go without receiving
+	// data.
+	Stall time.Duration `yaml:"stall,omitempty"`
+
+	// MinRate is the minimum average rate, in bytes per second, of the body
+	// of an upload request.
+	MinRate int64 `yaml:"minrate,omitempty"`
+
+	// GracePeriod delays the enforcement of MinRate at the start of a
+	// request. Defaults to 30 seconds.
+	GracePeriod time.Duration `yaml:"graceperiod,omitempty"`
+}
+
+// HeadCache configures a short-lived cache of HEAD request results for blobs
+// and manifests addressed by digest, so that the checks repeated by clients
+// during a push do not reach the storage backend each time.
+type HeadCache struct {
+	// Enabled turns on the cache.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// TTL is how long a blob or manifest found to exist is remembered.
+	TTL time.Duration `yaml:"ttl,omitempty"`
+
+	// NegativeTTL is how long a blob or manifest found not to exist is
+	// remembered.
+	NegativeTTL time.Duration `yaml:"negativettl,omitempty"`
+
+	// Size is the maximum number of results remembered.
+	Size int `yaml:"size,omitempty"`
+}
+
+// AuthCache configures a short-lived cache of the requests granted by the
+// access controller, keyed by their credentials and the access they need, so
+// that bursts of requests with the same token or password are not verified
+// each time.
+type AuthCache struct {
+	// Enabled turns on the cache.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// TTL is how long a granted request is remembered.
+	TTL time.Duration `yaml:"ttl,omitempty"`
+
+	// Size is the maximum number of decisions remembered.
+	Size int `yaml:"size,omitempty"`
+}
+
+// Bans configures a denylist of client addresses, users and token subjects,
+// managed through the admin API, whose requests are denied before
+// authentication.
+type Bans struct {
+	// Enabled turns on the bans and their admin API.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// DefaultTTL is how long a ban lasts when added without a TTL.
+	DefaultTTL time.Duration `yaml:"defaultttl,omitempty"`
+
+	// TrustedProxies lists the addresses of the proxies, in CIDR notation,
+	// whose X-Forwarded-For headers are matched against the bans of
+	// addresses. Only the address of the connection is matched otherwise.
+	TrustedProxies []string `yaml:"trustedproxies,omitempty"`
+}
+
+// Memory configures the accounting of the memory held by in-flight blob
+// uploads and manifest pushes. Requests which would take the memory held past
+// the limit are rejected with a 503, so that bursts of pushes cannot get the
+// instance killed for running out of memory.
+type Memory struct {
+	// Limit is the approximate memory, in bytes, that in-flight requests
+	// may hold together. A value of zero only accounts for the memory.
+	Limit int64 `yaml:"limit,omitempty"`
+
+	// UploadBuffer is the memory, in bytes, assumed to be held by each
+	// blob upload request, which is buffered by the storage driver.
+	UploadBuffer int64 `yaml:"uploadbuffer,omitempty"`
+
+	// RetryAfter is advertised to rejected clients in the Retry-After
+	// header.
+	RetryAfter time.Duration `yaml:"retryafter,omitempty"`
+}
+
+// UploadAffinity configures the session affinity hints returned with the
+// locations of blob uploads.
+type UploadAffinity struct {
+	// Enabled turns on the hints.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Instance identifies this instance. The hint is derived from it and
+	// from the http secret. Defaults to the host name.
+	Instance string `yaml:"instance,omitempty"`
+}
+
+// CORS configures the answers to cross-origin requests, so that registry
+// user interfaces served from other origins can call the API from browsers.
+// CORS is disabled unless origins are allowed.
+type CORS struct {
+	// AllowedOrigins lists the origins allowed to call the API, such as
+	// "https://ui.example.com". "*" allows any origin.
+	AllowedOrigins []string `yaml:"allowedorigins,omitempty"`
+
+	// AllowedMethods lists the methods cross-origin requests may use.
+	// Defaults to the methods of the API.
+	AllowedMethods []string `yaml:"allowedmethods,omitempty"`
+
+	// AllowedHeaders lists the request headers cross-origin requests may
+	// send. Defaults to the headers used by API clients.
+	AllowedHeaders []string `yaml:"allowedheaders,omitempty"`
+
+	// ExposedHeaders lists the response headers made available to
+	// cross-origin callers. Defaults to the headers of the API.
+	ExposedHeaders []string `yaml:"exposedheaders,omitempty"`
+
+	// MaxAge is how long browsers may cache the answer to a preflight
+	// request. Zero leaves it to the browser.
+	MaxAge time.Duration `yaml:"maxage,omitempty"`
+}
+
+// Placement configures how blobs are distributed across the storage classes
+// offered by the storage driver.
+type Placement struct {
+	// Rules select the storage class of the blobs of matching repositories.
+	// The first rule matching a repository linking a blob applies. Rules
+	// are applied by the tiering job, every tiering interval.
+	Rules []PlacementRule `yaml:"rules,omitempty"`
+
+	// Tiering configures the periodic promotion and demotion of blobs
+	// between a hot and a cold storage class.
+	Tiering Tiering `yaml:"tiering,omitempty"`
+}
+
+// PlacementRule assigns the blobs of matching repositories to a storage class.
+type PlacementRule struct {
+	// Repository is a regular expression matched against repository names.
+	Repository string `yaml:"repository"`
+
+	// StorageClass is the storage class matching blobs are placed in.
+	StorageClass string `yaml:"storageclass"`
+}
+
+// Tiering configures the background job moving blobs between storage classes
+// based on their pulls.
+type Tiering struct {
+	// Enabled turns on the tiering job.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Interval is the time between tiering runs.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// HotClass is the storage class of frequently pulled blobs.
+	HotClass string `yaml:"hotclass,omitempty"`
+
+	// ColdClass is the storage class of rarely pulled blobs.
+	ColdClass string `yaml:"coldclass,omitempty"`
+
+	// DemoteAfter is the period without pulls after which a blob is moved
+	// to the cold class.
+	DemoteAfter time.Duration `yaml:"demoteafter,omitempty"`
+
+	// PromotePulls is the number of pulls after which a recently pulled
+	// cold blob is moved back to the hot class.
+	PromotePulls int64 `yaml:"promotepulls,omitempty"`
+
+	// DryRun logs the blobs which would be moved without moving them.
+	DryRun bool `yaml:"dryrun,omitempty"`
+}
+
+// PullStatistics configures the aggregation of pull counts and last pull
+// times, which are exposed through the API and used by blob tiering.
+type PullStatistics struct {
+	// Enabled turns on pull statistics.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// FlushInterval is the time between writes of the statistics to the
+	// storage driver.
+	FlushInterval time.Duration `yaml:"flushinterval,omitempty"`
+
+	// Instance names the file the statistics of this instance are written
+	// to. It must be unique among the instances sharing the storage.
+	// Defaults to the host name.
+	Instance string `yaml:"instance,omitempty"`
+}
+
+// Bandwidth configures the accounting of the bytes transferred by each
+// authenticated user or token subject.
+type Bandwidth struct {
+	// Enabled turns on bandwidth accounting.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// FlushInterval is the time between writes of the usage to the storage
+	// driver.
+	FlushInterval time.Duration `yaml:"flushinterval,omitempty"`
+
+	// Instance names the file the usage of this instance is written to. It
+	// must be unique among the instances sharing the storage. Defaults to
+	// the host name.
+	Instance string `yaml:"instance,omitempty"`
+}
+
+// UI configures the static web interface served under /ui/.
+type UI struct {
+	// Enabled turns on the interface.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Directory holds the files of an interface provided by the operator,
+	// served instead of the bundled one.
+	Directory string `yaml:"directory,omitempty"`
+}
+
+// Helm configures the Helm chart repositories serving the charts stored as
+// OCI artifacts, for Helm clients that cannot pull charts from registries.
+type Helm struct {
+	// Enabled turns on the Helm chart repository endpoints.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// IndexCache is how long the index of a namespace is served again before
+	// it is built again. Changes pushed to this instance rebuild it sooner.
+	IndexCache time.Duration `yaml:"indexcache,omitempty"`
+}
+
+// Timeline configures the timelines of repositories, the events recorded in
+// storage for each of them.
+type Timeline struct {
+	// Enabled turns on the recording of events.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Size is the number of events kept for each repository, the oldest
+	// being dropped first.
+	Size int `yaml:"size,omitempty"`
+}
+
+// ReferenceIndex configures the index mapping blobs to the manifests
+// referencing them, maintained as manifests are pushed and deleted.
+type ReferenceIndex struct {
+	// Enabled turns on the maintenance of the index.
+	Enabled bool `yaml:"enabled,omitempty"`
+}
+
+// TagIndex configures an index of the tags of each repository, resolving
+// tags with a single read.
+type TagIndex struct {
+	// Enabled turns on the maintenance of the index.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// TTL is how long an index read from storage is used before being read
+	// again. Indexes are read for every lookup if it is zero.
+	TTL time.Duration `yaml:"ttl,omitempty"`
+}
+
+// IntentLog configures a log of the intents of pushing, tagging, untagging
+// and deleting manifests, from which the mutations interrupted by a crash
+// are completed or rolled back.
+type IntentLog struct {
+	// Enabled turns on the recording of intents.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Grace is how old intents must be to be recovered, leaving the
+	// mutations in progress alone. Defaults to 10 minutes.
+	Grace time.Duration `yaml:"grace,omitempty"`
+}
+
+// Scanning configures an external vulnerability scanner, which is sent every
+// pushed manifest and returns a report summary.
+type Scanning struct {
+	// Enabled turns on scanning.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Endpoint is the URL of the scanner API manifests are posted to.
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Headers are added to scanner requests, for example to authenticate.
+	Headers http.Header `yaml:"headers,omitempty"`
+
+	// Timeout bounds each scanner request.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// Concurrency is the number of concurrent scanner requests.
+	Concurrency int `yaml:"concurrency,omitempty"`
+
+	// BlockSeverity refuses pulls of manifests whose report has a
+	// vulnerability of this severity or a more severe one: low, medium,
+	// high or critical. Pulls are not blocked if it is empty.
+	BlockSeverity string `yaml:"blockseverity,omitempty"`
+}
+
+// Transcoding configures the variants of images with their layers
+// re-compressed in the format requested by clients: clients listing the zstd
+// layer media type in the Accept header of a manifest pull ask for gzip
+// layers re-compressed as zstd, and clients listing only gzip media types
+// for zstd layers as gzip. Variants are OCI image manifests referring to the
+// image as their subject, built in the background and served to the pulls by
+// tag once published.
+type Transcoding struct {
+	// Enabled turns on transcoding.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// MaxSize is the size in bytes of the largest layer transcoded. Larger
+	// layers are kept as stored in variants. There is no limit if it is
+	// zero.
+	MaxSize int64 `yaml:"maxsize,omitempty"`
+
+	// Concurrency is the number of images transcoded at the same time.
+	Concurrency int `yaml:"concurrency,omitempty"`
+}
+
+// LayerIndexing configures the indexing of the gzip layers of pushed image
+// manifests. The index of a layer lists its files with their offsets, and the
+// checkpoints decompression can resume from, so that lazily pulling runtimes
+// can fetch files with range requests. The indexes of an image are stored as
+// an artifact referring to its manifest.
+type LayerIndexing struct {
+	// Enabled turns on layer indexing.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// MinLayerSize is the size in bytes of the smallest layer indexed.
+	MinLayerSize int64 `yaml:"minlayersize,omitempty"`
+
+	// Concurrency is the number of manifests indexed at the same time.
+	Concurrency int `yaml:"concurrency,omitempty"`
+
+	// SpanSize is the amount of uncompressed data in bytes between the
+	// checkpoints of a layer.
+	SpanSize int64 `yaml:"spansize,omitempty"`
+}
+
+// UploadQuota configures daily upload quotas. The bytes of blob uploads are
+// counted per authenticated user or token subject and UTC day, and uploads
+// are rejected with 429 Too Many Requests once the quota of the day is used.
+// Anonymous uploads are not limited.
+type UploadQuota struct {
+	// Enabled turns on upload quotas.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Daily is the number of bytes a subject can upload per day. There is
+	// no limit if it is zero.
+	Daily int64 `yaml:"daily,omitempty"`
+
+	// Subjects overrides Daily for some subjects. A quota of zero lifts
+	// the limit.
+	Subjects map[string]int64 `yaml:"subjects,omitempty"`
+
+	// Backend is "storage" to keep the counters in the storage, or "redis"
+	// to keep them in the redis instance configured for the registry, which
+	// counts exactly across instances. Defaults to storage.
+	Backend string `yaml:"backend,omitempty"`
+}
+
+// Admission configures a webhook called synchronously before a manifest is
+// stored. The webhook receives the manifest and the authenticated subject
+// and either admits or rejects the push.
+type Admission struct {
+	// URL is the endpoint of the webhook. Admission is disabled if it is
+	// empty.
+	URL string `yaml:"url,omitempty"`
+
+	// Headers are added to webhook requests, for example to authenticate.
+	Headers http.Header `yaml:"headers,omitempty"`
+
+	// Timeout bounds each webhook request.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// FailOpen admits pushes when the webhook cannot be reached or does
+	// not answer properly. By default such pushes are rejected.
+	FailOpen bool `yaml:"failopen,omitempty"`
+}
+
+// Coordination configures the lease electing the instance which runs
+// background jobs, such as upload purging and blob tiering, and guarding
+// garbage collection runs.
+type Coordination struct {
+	// Backend is "storage" to keep leases in the storage, or "redis" to
+	// keep them in the redis instance configured for the registry. If
+	// empty, every instance runs its background jobs.
+	Backend string `yaml:"backend,omitempty"`
+
+	// LeaseDuration is how long a lease lasts after it was last renewed.
+	// Defaults to 30 seconds.
+	LeaseDuration time.Duration `yaml:"leaseduration,omitempty"`
+}
+
+// Backup configures the background job snapshotting the tags, manifest links
+// and layer links of every repository, without the blobs, so that metadata
+// deleted by mistake can be restored.
+type Backup struct {
+	// Enabled turns on the backup job.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Interval is the time between snapshots. Defaults to a day.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Bucket is the bucket receiving the snapshots, accessed with the
+	// parameters of the storage driver of the registry. Snapshots are kept
+	// in the storage of the registry if empty.
+	Bucket string `yaml:"bucket,omitempty"`
+
+	// Prefix is the path under which each snapshot gets a directory named
+	// after its time. Defaults to /backups.
+	Prefix string `yaml:"prefix,omitempty"`
+
+	// Keep is the number of most recent snapshots kept, older ones being
+	// removed. All snapshots are kept if zero.
+	Keep int `yaml:"keep,omitempty"`
+}
+
+// Admin configures the administrative API, served over gRPC on its own
+// listener to clients presenting a certificate signed by one of ClientCAs.
+type Admin struct {
+	// Net is the type of the listener, "tcp" or "unix". Defaults to tcp.
+	Net string `yaml:"net,omitempty"`
+
+	// Addr is the address of the listener, or the path of its socket. The
+	// administrative API is disabled if empty.
+	Addr string `yaml:"addr,omitempty"`
+
+	// TLS configures the certificate of the listener and the authorities
+	// of client certificates, which are required.
+	TLS AdminTLS `yaml:"tls,omitempty"`
+
+	// Token configures the minting of tokens.
+	Token AdminToken `yaml:"token,omitempty"`
+
+	// Clients restricts the clients whose certificate has one of the
+	// listed common names to the listed methods, such as IntrospectToken.
+	// Other clients may call every method.
+	Clients map[string][]string `yaml:"clients,omitempty"`
+}
+
+// AdminTLS configures mutual TLS on the listener of the administrative API.
+type AdminTLS struct {
+	// Certificate is the path to the certificate of the listener.
+	Certificate string `yaml:"certificate,omitempty"`
+
+	// Key is the path to the private key of Certificate.
+	Key string `yaml:"key,omitempty"`
+
+	// ClientCAs are the paths to the authorities signing the certificates
+	// of clients.
+	ClientCAs []string `yaml:"clientcas,omitempty"`
+}
+
+// AdminToken configures the tokens minted by the administrative API, which
+// are issued for the issuer and service of the token authentication of the
+// registry.
+type AdminToken struct {
+	// SigningKey is the path to the private key signing the tokens. Its
+	// public key must be in the root certificate bundle of the token
+	// authentication. Tokens cannot be minted if empty.
+	SigningKey string `yaml:"signingkey,omitempty"`
+
+	// Expiration is the default lifetime of the tokens. Defaults to five
+	// minutes.
+	Expiration time.Duration `yaml:"expiration,omitempty"`
+
+	// MaxExpiration is the longest lifetime clients may request for a
+	// token. Defaults to one hour.
+	MaxExpiration time.Duration `yaml:"maxexpiration,omitempty"`
+}
+
+// Tenant overrides the configuration of the repositories named Name or
+// nested below it. Sections left empty are inherited from the registry
+// configuration.
+type Tenant struct {
+	// Name is the namespace of the tenant, without a trailing slash.
+	Name string `yaml:"name"`
+
+	// Auth replaces the access controller of the registry, for example to
+	// authenticate against the token realm of the tenant. Type "none"
+	// disables authentication for the tenant.
+	Auth Auth `yaml:"auth,omitempty"`
+
+	// Storage replaces the storage driver of the registry. Its maintenance
+	// section configures the purging of abandoned uploads in the tenant
+	// storage.
+	Storage Storage `yaml:"storage,omitempty"`
+
+	// Concurrency replaces the limits on concurrent blob transfers. Limits
+	// are counted separately from those of the registry.
+	Concurrency Concurrency `yaml:"concurrency,omitempty"`
+
+	// Retention replaces the retention of the registry for the
+	// repositories of the tenant.
+	Retention Retention `yaml:"retention,omitempty"`
+}
+
+// Retention configures how long garbage collection keeps manifests which are
+// not referenced by a tag.
+type Retention struct {
+	// UntaggedOlderThan is the age from which manifests not referenced by
+	// a tag are removed by garbage collection, whether or not the collection
+	// is asked to remove untagged manifests. Zero keeps them.
+	UntaggedOlderThan time.Duration `yaml:"untaggedolderthan,omitempty"`
+}
+
+// Namespaces configures the namespaces of the registry. A namespace is the
+// name prefix shared by a group of repositories, such as an organization;
+// repository "acme/team/app" belongs to namespaces "acme" and "acme/team".
+type Namespaces struct {
+	// UsageCache is how long the computed storage usage of a namespace is
+	// reused before it is computed again. Quotas are enforced against the
+	// cached usage.
+	UsageCache time.Duration `yaml:"usagecache,omitempty"`
+
+	// Definitions lists the namespaces with a quota or an access list. When
+	// several definitions match a repository, the longest one applies.
+	Definitions []Namespace `yaml:"definitions,omitempty"`
+}
+
+// Namespace defines the quota and access list of a namespace.
+type Namespace struct {
+	// Name is the namespace, without a trailing slash.
+	Name string `yaml:"name"`
+
+	// Quota limits the content pushed to the namespace.
+	Quota NamespaceQuota `yaml:"quota,omitempty"`
+
+	// Access restricts the users allowed to use the namespace.
+	Access NamespaceAccess `yaml:"access,omitempty"`
+
+	// RequireSignatures only allows tagging manifests which have a cosign
+	// signature, pushed under the sha256-<hex>.sig tag of their digest, or a
+	// signature referring to them through its subject.
+	RequireSignatures bool `yaml:"requiresignatures,omitempty"`
+}
+
+// NamespaceQuota limits the storage used by a namespace. Zero values are
+// unlimited.
+type NamespaceQuota struct {
+	// Size is the maximum total size in bytes of the blobs of the namespace.
+	Size int64 `yaml:"size,omitempty"`
+
+	// Repositories is the maximum number of repositories in the namespace.
+	Repositories int `yaml:"repositories,omitempty"`
+}
+
+// NamespaceAccess lists the users allowed each action on the repositories of
+// a namespace, in addition to the checks of the access controller. An empty
+// list leaves the action unrestricted and "*" allows any authenticated user.
+type NamespaceAccess struct {
+	// Pull lists the users allowed to pull.
+	Pull []string `yaml:"pull,omitempty"`
+
+	// Push lists the users allowed to push.
+	Push []string `yaml:"push,omitempty"`
+
+	// Delete lists the users allowed to delete.
+	Delete []string `yaml:"delete,omitempty"`
+}
+
 // Proxy configures the registry as a pull through cache
 type Proxy struct {
 	// RemoteURL is the URL of the remote registry
@@ -636,6 +1440,87 @@ type Proxy struct {
 
 	// Password of the hub user
 	Password string `yaml:"password"`
+
+	// CredentialsFile is the path to a JSON file holding the username and
+	// password for the remote registry. It is re-read when credentials
+	// expire, so that rotated credentials are picked up.
+	CredentialsFile string `yaml:"credentialsfile,omitempty"`
+
+	// CredentialHelper is the name of a docker credential helper, such as
+	// "ecr-login", run to obtain credentials for the remote registry. The
+	// executable docker-credential-<name> must be in the PATH.
+	CredentialHelper string `yaml:"credentialhelper,omitempty"`
+
+	// CredentialTTL is how long credentials read from CredentialsFile or
+	// obtained from CredentialHelper are used before fetching them again.
+	CredentialTTL time.Duration `yaml:"credentialttl,omitempty"`
+
+	// Retry configures how failed requests to the remote registry are
+	// retried.
+	Retry ProxyRetry `yaml:"retry,omitempty"`
+
+	// Namespaces maps local repository names to repository names of the
+	// remote registry. The first matching mapping applies; repositories
+	// matching no mapping keep their name.
+	Namespaces []ProxyNamespace `yaml:"namespaces,omitempty"`
+
+	// Scheduler configures where the expiry state of cached content is
+	// kept.
+	Scheduler ProxyScheduler `yaml:"scheduler,omitempty"`
+
+	// Prefetch configures content cached in the background.
+	Prefetch ProxyPrefetch `yaml:"prefetch,omitempty"`
+}
+
+// ProxyPrefetch configures which content the proxy caches before it is
+// requested.
+type ProxyPrefetch struct {
+	// Platforms, such as "linux/amd64" or "linux/arm/v7", whose manifests
+	// and blobs are cached when a manifest list is fetched from the remote
+	// registry.
+	Platforms []string `yaml:"platforms,omitempty"`
+}
+
+// ProxyScheduler configures the state backend of the proxy's TTL scheduler.
+type ProxyScheduler struct {
+	// Backend is "file" to keep all entries in a single file in the
+	// storage (the default), "storage" to keep each entry in its own
+	// file, or "redis" to keep them in the redis instance configured for
+	// the registry. The latter two may be shared by several registry
+	// instances.
+	Backend string `yaml:"backend,omitempty"`
+
+	// LeaseDuration is how long an instance sharing the state keeps
+	// expiring cached content after last renewing its lease. Defaults to
+	// 30 seconds.
+	LeaseDuration time.Duration `yaml:"leaseduration,omitempty"`
+}
+
+// ProxyNamespace maps the repositories under a local namespace to the
+// repositories under a namespace of the remote registry.
+type ProxyNamespace struct {
+	// Local is the namespace clients pull from, such as "mirror".
+	Local string `yaml:"local"`
+
+	// Remote is the namespace the content is fetched from, such as
+	// "library".
+	Remote string `yaml:"remote"`
+}
+
+// ProxyRetry configures retries of requests to the remote registry which
+// fail because of rate limiting, unavailability or reset connections.
+type ProxyRetry struct {
+	// MaxAttempts is the number of attempts made for a request, including
+	// the first one. Defaults to 5; set to 1 to disable retries.
+	MaxAttempts int `yaml:"maxattempts,omitempty"`
+
+	// InitialBackoff is the wait before the first retry. It doubles with
+	// each further retry.
+	InitialBackoff time.Duration `yaml:"initialbackoff,omitempty"`
+
+	// MaxBackoff bounds the wait between retries. Requests whose
+	// Retry-After header exceeds it are not retried.
+	MaxBackoff time.Duration `yaml:"maxbackoff,omitempty"`
 }
 
 // Parse parses an input configuration yaml document into a Configuration struct
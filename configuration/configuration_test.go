@@ -72,28 +72,37 @@ var configStruct = Configuration{
 		},
 	},
 	HTTP: struct {
-		Addr         string        `yaml:"addr,omitempty"`
-		Net          string        `yaml:"net,omitempty"`
-		Host         string        `yaml:"host,omitempty"`
-		Prefix       string        `yaml:"prefix,omitempty"`
-		Secret       string        `yaml:"secret,omitempty"`
-		RelativeURLs bool          `yaml:"relativeurls,omitempty"`
-		DrainTimeout time.Duration `yaml:"draintimeout,omitempty"`
-		TLS          struct {
-			Certificate string   `yaml:"certificate,omitempty"`
-			Key         string   `yaml:"key,omitempty"`
-			ClientCAs   []string `yaml:"clientcas,omitempty"`
-			MinimumTLS  string   `yaml:"minimumtls,omitempty"`
-			LetsEncrypt struct {
-				CacheFile string   `yaml:"cachefile,omitempty"`
-				Email     string   `yaml:"email,omitempty"`
-				Hosts     []string `yaml:"hosts,omitempty"`
+		Addr           string        `yaml:"addr,omitempty"`
+		Net            string        `yaml:"net,omitempty"`
+		Listeners      []Listener    `yaml:"listeners,omitempty"`
+		ProxyProtocol  ProxyProtocol `yaml:"proxyprotocol,omitempty"`
+		Host           string        `yaml:"host,omitempty"`
+		Prefix         string        `yaml:"prefix,omitempty"`
+		Secret         string        `yaml:"secret,omitempty"`
+		RelativeURLs   bool          `yaml:"relativeurls,omitempty"`
+		DrainTimeout   time.Duration `yaml:"draintimeout,omitempty"`
+		BlobBufferSize int           `yaml:"blobbuffersize,omitempty"`
+		TLS            struct {
+			Certificate    string        `yaml:"certificate,omitempty"`
+			Key            string        `yaml:"key,omitempty"`
+			ClientCAs      []string      `yaml:"clientcas,omitempty"`
+			MinimumTLS     string        `yaml:"minimumtls,omitempty"`
+			ReloadInterval time.Duration `yaml:"reloadinterval,omitempty"`
+			LetsEncrypt    struct {
+				CacheFile    string        `yaml:"cachefile,omitempty"`
+				Email        string        `yaml:"email,omitempty"`
+				Hosts        []string      `yaml:"hosts,omitempty"`
+				DirectoryURL string        `yaml:"directoryurl,omitempty"`
+				RenewBefore  time.Duration `yaml:"renewbefore,omitempty"`
+				HTTPAddr     string        `yaml:"httpaddr,omitempty"`
 			} `yaml:"letsencrypt,omitempty"`
 		} `yaml:"tls,omitempty"`
 		Headers http.Header `yaml:"headers,omitempty"`
 		Debug   struct {
-			Addr       string `yaml:"addr,omitempty"`
-			Prometheus struct {
+			Net         string `yaml:"net,omitempty"`
+			Addr        string `yaml:"addr,omitempty"`
+			AdminRoutes bool   `yaml:"adminroutes,omitempty"`
+			Prometheus  struct {
 				Enabled bool   `yaml:"enabled,omitempty"`
 				Path    string `yaml:"path,omitempty"`
 			} `yaml:"prometheus,omitempty"`
@@ -101,16 +110,28 @@ var configStruct = Configuration{
 		HTTP2 struct {
 			Disabled bool `yaml:"disabled,omitempty"`
 		} `yaml:"http2,omitempty"`
+		Concurrency    Concurrency    `yaml:"concurrency,omitempty"`
+		HeadCache      HeadCache      `yaml:"headcache,omitempty"`
+		AuthCache      AuthCache      `yaml:"authcache,omitempty"`
+		Bans           Bans           `yaml:"bans,omitempty"`
+		Timeouts       Timeouts       `yaml:"timeouts,omitempty"`
+		UploadAffinity UploadAffinity `yaml:"uploadaffinity,omitempty"`
+		Memory         Memory         `yaml:"memory,omitempty"`
+		CORS           CORS           `yaml:"cors,omitempty"`
 	}{
 		TLS: struct {
-			Certificate string   `yaml:"certificate,omitempty"`
-			Key         string   `yaml:"key,omitempty"`
-			ClientCAs   []string `yaml:"clientcas,omitempty"`
-			MinimumTLS  string   `yaml:"minimumtls,omitempty"`
-			LetsEncrypt struct {
-				CacheFile string   `yaml:"cachefile,omitempty"`
-				Email     string   `yaml:"email,omitempty"`
-				Hosts     []string `yaml:"hosts,omitempty"`
+			Certificate    string        `yaml:"certificate,omitempty"`
+			Key            string        `yaml:"key,omitempty"`
+			ClientCAs      []string      `yaml:"clientcas,omitempty"`
+			MinimumTLS     string        `yaml:"minimumtls,omitempty"`
+			ReloadInterval time.Duration `yaml:"reloadinterval,omitempty"`
+			LetsEncrypt    struct {
+				CacheFile    string        `yaml:"cachefile,omitempty"`
+				Email        string        `yaml:"email,omitempty"`
+				Hosts        []string      `yaml:"hosts,omitempty"`
+				DirectoryURL string        `yaml:"directoryurl,omitempty"`
+				RenewBefore  time.Duration `yaml:"renewbefore,omitempty"`
+				HTTPAddr     string        `yaml:"httpaddr,omitempty"`
 			} `yaml:"letsencrypt,omitempty"`
 		}{
 			ClientCAs: []string{"/path/to/ca.pem"},
@@ -3,6 +3,7 @@ package context
 import (
 	"context"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -286,6 +287,28 @@ func (irw *instrumentedResponseWriter) Write(p []byte) (n int, err error) {
 	return
 }
 
+// ReadFrom implements io.ReaderFrom, keeping the one of the parent
+// ResponseWriter, with which the HTTP server sends files with sendfile.
+func (irw *instrumentedResponseWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	if rf, ok := irw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(irw.ResponseWriter, r)
+	}
+
+	irw.mu.Lock()
+	irw.written += n
+
+	// Guess the likely status if not set.
+	if irw.status == 0 {
+		irw.status = http.StatusOK
+	}
+
+	irw.mu.Unlock()
+
+	return
+}
+
 func (irw *instrumentedResponseWriter) WriteHeader(status int) {
 	irw.ResponseWriter.WriteHeader(status)
 
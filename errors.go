@@ -20,6 +20,10 @@ var ErrManifestNotModified = errors.New("manifest not modified")
 // performed
 var ErrUnsupported = errors.New("operation unsupported")
 
+// ErrReferenceIndexIncomplete is returned by a BlobReferenceIndex whose index
+// does not cover all the manifests, until it is rebuilt.
+var ErrReferenceIndexIncomplete = errors.New("reference index incomplete")
+
 // ErrSchemaV1Unsupported is returned when a client tries to upload a schema v1
 // manifest but the registry is configured to reject it
 var ErrSchemaV1Unsupported = errors.New("manifest schema v1 unsupported")
@@ -107,6 +111,18 @@ func (err ErrManifestBlobUnknown) Error() string {
 	return fmt.Sprintf("unknown blob %v on manifest", err.Digest)
 }
 
+// ErrManifestConfigInvalid returned when the config blob of a manifest does
+// not parse as its declared media type.
+type ErrManifestConfigInvalid struct {
+	Digest    digest.Digest
+	MediaType string
+	Reason    error
+}
+
+func (err ErrManifestConfigInvalid) Error() string {
+	return fmt.Sprintf("invalid config %v of type %s on manifest: %v", err.Digest, err.MediaType, err.Reason)
+}
+
 // ErrManifestNameInvalid should be used to denote an invalid manifest
 // name. Reason may set, indicating the cause of invalidity.
 type ErrManifestNameInvalid struct {
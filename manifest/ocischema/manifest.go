@@ -50,6 +50,15 @@ type Manifest struct {
 
 	// Annotations contains arbitrary metadata for the image manifest.
 	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ArtifactType is the type of the artifact the manifest holds, if it is
+	// not an image.
+	ArtifactType string `json:"artifactType,omitempty"`
+
+	// Subject references the manifest this manifest refers to, such as the
+	// image a signature signs. It is not a reference of the manifest: the
+	// subject may be deleted before its referrers.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
 }
 
 // References returns the descriptors of this manifests references.
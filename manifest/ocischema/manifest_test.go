@@ -182,3 +182,33 @@ func TestMediaTypes(t *testing.T) {
 	mediaTypeTest(t, v1.MediaTypeImageManifest, false)
 	mediaTypeTest(t, v1.MediaTypeImageManifest+"XXX", true)
 }
+
+func TestSubject(t *testing.T) {
+	m := makeTestManifest(v1.MediaTypeImageManifest)
+	m.ArtifactType = "application/vnd.example"
+	m.Subject = &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Size:      527,
+		Digest:    "sha256:8b3a2b9e3b5bb0ee0fb65bb2c4d4e8e2fb4b8d4dd4b9c1e6c1ad08d3e3c6e3d1",
+	}
+	deserialized, err := FromStruct(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, canonical, _ := deserialized.Payload()
+
+	var unmarshalled DeserializedManifest
+	if err := unmarshalled.UnmarshalJSON(canonical); err != nil {
+		t.Fatal(err)
+	}
+	if unmarshalled.ArtifactType != m.ArtifactType || !reflect.DeepEqual(unmarshalled.Subject, m.Subject) {
+		t.Fatalf("unexpected manifest %+v", unmarshalled.Manifest)
+	}
+
+	// the subject is not a reference of the manifest
+	for _, reference := range unmarshalled.References() {
+		if reference.Digest == m.Subject.Digest {
+			t.Fatal("unexpected subject among the references")
+		}
+	}
+}
@@ -69,6 +69,24 @@ type ManifestEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(digest.Digest) error) error
 }
 
+// Referrer describes a manifest referring to another manifest, its subject,
+// such as the signature of an image.
+type Referrer struct {
+	Descriptor
+
+	// ArtifactType is the artifact type of the manifest, or the media type
+	// of its config if it has none.
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// ManifestReferrers lists the manifests referring to a manifest through
+// their subject.
+type ManifestReferrers interface {
+	// Referrers returns the manifests of the repository whose subject is
+	// the manifest with the given digest, sorted by digest.
+	Referrers(ctx context.Context, subject digest.Digest) ([]Referrer, error)
+}
+
 // Describable is an interface for descriptors
 type Describable interface {
 	Descriptor() Descriptor
@@ -239,6 +239,25 @@ func (bwl *blobWriterListener) Commit(ctx context.Context, desc distribution.Des
 	return committed, err
 }
 
+// Progress forwards to the wrapped writer, if it reports its progress.
+func (bwl *blobWriterListener) Progress() distribution.BlobWriteProgress {
+	reporter, ok := bwl.BlobWriter.(distribution.BlobWriteProgressReporter)
+	if !ok {
+		return distribution.BlobWriteProgress{BytesPersisted: bwl.BlobWriter.Size()}
+	}
+	return reporter.Progress()
+}
+
+// HashedDigest forwards to the wrapped writer, if it reports the digest of
+// the content written.
+func (bwl *blobWriterListener) HashedDigest() (digest.Digest, int64, bool) {
+	reporter, ok := bwl.BlobWriter.(distribution.BlobWriteDigestReporter)
+	if !ok {
+		return "", 0, false
+	}
+	return reporter.HashedDigest()
+}
+
 type tagServiceListener struct {
 	distribution.TagService
 	parent *repositoryListener
@@ -251,6 +270,15 @@ func (rl *repositoryListener) Tags(ctx context.Context) distribution.TagService
 	}
 }
 
+// Page forwards to the wrapped tag service, if it can page tags.
+func (tagSL *tagServiceListener) Page(ctx context.Context, tags []string, last string, order distribution.TagOrder) (int, error) {
+	pager, ok := tagSL.TagService.(distribution.TagPager)
+	if !ok {
+		return 0, distribution.ErrUnsupported
+	}
+	return pager.Page(ctx, tags, last, order)
+}
+
 func (tagSL *tagServiceListener) Untag(ctx context.Context, tag string) error {
 	if err := tagSL.TagService.Untag(ctx, tag); err != nil {
 		return err
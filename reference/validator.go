@@ -0,0 +1,108 @@
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrNameTooManyComponents is returned when a repository name has more path
+// components than allowed by a NameValidator.
+var ErrNameTooManyComponents = errors.New("repository name has too many components")
+
+// NameValidator checks repository names against constraints that may differ
+// from the ones applied by WithName, such as a longer maximum length or a
+// different set of characters in path components. A nil NameValidator
+// applies the same constraints as WithName.
+type NameValidator struct {
+	maxLength     int
+	maxComponents int
+
+	// nameRegexp and anchoredNameRegexp are nil when the default name
+	// components are allowed.
+	nameRegexp         *regexp.Regexp
+	anchoredNameRegexp *regexp.Regexp
+}
+
+// NewNameValidator returns a NameValidator accepting names of up to
+// maxLength characters, or NameTotalLengthMax if maxLength is 0, and up to
+// maxComponents path components, or any number if maxComponents is 0. Path
+// components must match the regular expression component, which must not
+// match a slash. If component is empty, the components allowed by WithName
+// are accepted.
+func NewNameValidator(maxLength, maxComponents int, component string) (*NameValidator, error) {
+	if maxLength < 0 || maxComponents < 0 {
+		return nil, errors.New("repository name limits must not be negative")
+	}
+	if maxLength == 0 {
+		maxLength = NameTotalLengthMax
+	}
+
+	v := &NameValidator{
+		maxLength:     maxLength,
+		maxComponents: maxComponents,
+	}
+	if component == "" {
+		return v, nil
+	}
+
+	componentRegexp, err := regexp.Compile(component)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository name component expression: %v", err)
+	}
+	componentRegexp = group(componentRegexp)
+	if anchored(componentRegexp).MatchString("/") {
+		return nil, errors.New("repository name component expression must not match a slash")
+	}
+
+	v.nameRegexp = expression(
+		optional(DomainRegexp, literal(`/`)),
+		componentRegexp,
+		optional(repeated(literal(`/`), componentRegexp)))
+	v.anchoredNameRegexp = anchored(
+		optional(capture(DomainRegexp), literal(`/`)),
+		capture(componentRegexp,
+			optional(repeated(literal(`/`), componentRegexp))))
+	return v, nil
+}
+
+// NameRegexp returns the unanchored regular expression matching the names
+// built from allowed components, regardless of their length.
+func (v *NameValidator) NameRegexp() *regexp.Regexp {
+	if v == nil || v.nameRegexp == nil {
+		return NameRegexp
+	}
+	return v.nameRegexp
+}
+
+// WithName returns a named object representing the given string, if it
+// satisfies the constraints of the validator.
+func (v *NameValidator) WithName(name string) (Named, error) {
+	if v == nil {
+		return WithName(name)
+	}
+
+	if len(name) > v.maxLength {
+		if v.maxLength == NameTotalLengthMax {
+			return nil, ErrNameTooLong
+		}
+		return nil, fmt.Errorf("repository name must not be more than %v characters", v.maxLength)
+	}
+	if v.maxComponents > 0 && strings.Count(name, "/")+1 > v.maxComponents {
+		return nil, ErrNameTooManyComponents
+	}
+
+	re := anchoredNameRegexp
+	if v.anchoredNameRegexp != nil {
+		re = v.anchoredNameRegexp
+	}
+	match := re.FindStringSubmatch(name)
+	if match == nil || len(match) != 3 {
+		return nil, ErrReferenceInvalidFormat
+	}
+	return repository{
+		domain: match[1],
+		path:   match[2],
+	}, nil
+}
@@ -0,0 +1,80 @@
+package reference
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameValidator(t *testing.T) {
+	var defaultValidator *NameValidator
+	longName := strings.Repeat("a", NameTotalLengthMax+1)
+
+	for _, tc := range []struct {
+		maxLength     int
+		maxComponents int
+		component     string
+		valid         []string
+		invalid       []string
+	}{
+		{
+			valid:   []string{"foo", "foo/bar", "localhost:5000/foo/bar", "a/b/c/d/e"},
+			invalid: []string{"Foo", "foo_/bar", longName},
+		},
+		{
+			maxLength:     300,
+			maxComponents: 3,
+			valid:         []string{longName, "a/b/c"},
+			invalid:       []string{"a/b/c/d", strings.Repeat("a", 301)},
+		},
+		{
+			component: `[A-Za-z0-9]+(?:[._-][A-Za-z0-9]+)*`,
+			valid:     []string{"Foo", "Team/Project_X", "foo/bar"},
+			invalid:   []string{"foo//bar", "foo/bar_", "foo/b@r"},
+		},
+	} {
+		v, err := NewNameValidator(tc.maxLength, tc.maxComponents, tc.component)
+		if err != nil {
+			t.Fatalf("unexpected error creating validator: %v", err)
+		}
+		re := anchored(v.NameRegexp())
+		for _, name := range tc.valid {
+			named, err := v.WithName(name)
+			if err != nil {
+				t.Errorf("expected %q to be valid, got %v", name, err)
+				continue
+			}
+			if named.Name() != name {
+				t.Errorf("expected name %q, got %q", name, named.Name())
+			}
+			if !re.MatchString(name) {
+				t.Errorf("expected %q to match %v", name, re)
+			}
+		}
+		for _, name := range tc.invalid {
+			if _, err := v.WithName(name); err == nil {
+				t.Errorf("expected %q to be invalid", name)
+			}
+		}
+
+		if tc.maxLength == 0 && tc.maxComponents == 0 && tc.component == "" {
+			// The default validator matches WithName and a nil validator
+			for _, name := range append(tc.valid, tc.invalid...) {
+				_, err1 := v.WithName(name)
+				_, err2 := defaultValidator.WithName(name)
+				_, err3 := WithName(name)
+				if err1 != err3 || err2 != err3 {
+					t.Errorf("unexpected results for %q: %v, %v, %v", name, err1, err2, err3)
+				}
+			}
+		}
+	}
+
+	for _, component := range []string{"(", "[a-z/]+"} {
+		if _, err := NewNameValidator(0, 0, component); err == nil {
+			t.Errorf("expected error for component expression %q", component)
+		}
+	}
+	if _, err := NewNameValidator(-1, 0, ""); err == nil {
+		t.Errorf("expected error for negative length")
+	}
+}
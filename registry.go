@@ -2,8 +2,11 @@ package distribution
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
 )
 
 // Scope defines the set of items that match a namespace.
@@ -54,6 +57,149 @@ type RepositoryEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(string) error) error
 }
 
+// NamespaceEnumerator lists and measures the repositories under a
+// namespace, the name prefix shared by a group of repositories such as an
+// organization.
+type NamespaceEnumerator interface {
+	// NamespaceRepositories fills 'repos' with a lexicographically sorted
+	// list of the repositories under namespace, in the same manner as
+	// Namespace.Repositories.
+	NamespaceRepositories(ctx context.Context, namespace string, repos []string, last string) (n int, err error)
+
+	// NamespaceUsage returns the storage used by the repositories under
+	// namespace.
+	NamespaceUsage(ctx context.Context, namespace string) (NamespaceUsage, error)
+}
+
+// GlobalBlobServer serves any blob of a registry by its digest, regardless of
+// the repositories it is linked into.
+type GlobalBlobServer interface {
+	// ServeGlobalBlob serves the blob with the given digest in the manner of
+	// BlobServer.ServeBlob, returning ErrBlobUnknown if it is not stored.
+	ServeGlobalBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error
+}
+
+// BlobReference is a manifest referencing a blob, as a layer, a config or a
+// child manifest.
+type BlobReference struct {
+	// Repository is the name of the repository holding the manifest.
+	Repository string `json:"repository"`
+
+	// Manifest is the digest of the referencing manifest.
+	Manifest digest.Digest `json:"manifest"`
+
+	// Tags are the tags of the repository referencing the manifest.
+	Tags []string `json:"tags"`
+}
+
+// BlobReferenceIndex maps blobs to the manifests referencing them across the
+// repositories of a registry.
+type BlobReferenceIndex interface {
+	// BlobReferences returns the manifests referencing the blob with the
+	// given digest, sorted by repository. It returns ErrUnsupported if the
+	// index is not maintained, and ErrReferenceIndexIncomplete if it may
+	// miss manifests.
+	BlobReferences(ctx context.Context, dgst digest.Digest) ([]BlobReference, error)
+}
+
+// ForeignBlobIndex resolves the layers stored outside of the registry, such
+// as foreign and non-distributable layers, which manifests reference along
+// with the URLs they are downloaded from.
+type ForeignBlobIndex interface {
+	// ForeignBlob returns the descriptor, with its URLs, of a layer of the
+	// named repository stored outside of the registry. It returns
+	// ErrBlobUnknown if no manifest of the repository references such a
+	// layer.
+	ForeignBlob(ctx context.Context, name reference.Named, dgst digest.Digest) (Descriptor, error)
+}
+
+// NamespaceUsage describes the storage used by a namespace. Blobs shared by
+// several of its repositories are counted once.
+type NamespaceUsage struct {
+	// Repositories is the number of repositories in the namespace.
+	Repositories int `json:"repositories"`
+
+	// Blobs is the number of distinct blobs linked into the namespace,
+	// including manifests.
+	Blobs int `json:"blobs"`
+
+	// Size is the total size of those blobs in bytes.
+	Size int64 `json:"size"`
+}
+
+// RepositoryMetadata holds descriptive information about a repository, such
+// as what user interfaces display.
+type RepositoryMetadata struct {
+	// Description is a free form description of the repository.
+	Description string `json:"description,omitempty"`
+
+	// Owner identifies the person or team responsible for the repository.
+	Owner string `json:"owner,omitempty"`
+
+	// Labels are arbitrary key value pairs.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// RepositoryMetadataStore stores the metadata of repositories.
+type RepositoryMetadataStore interface {
+	// RepositoryMetadata returns the metadata of the named repository. A
+	// repository without metadata has empty metadata.
+	RepositoryMetadata(ctx context.Context, name reference.Named) (RepositoryMetadata, error)
+
+	// PutRepositoryMetadata replaces the metadata of the named repository.
+	PutRepositoryMetadata(ctx context.Context, name reference.Named, metadata RepositoryMetadata) error
+}
+
+// The actions of repository events.
+const (
+	// RepositoryEventPush records that a manifest was pushed.
+	RepositoryEventPush = "push"
+	// RepositoryEventDelete records that a manifest was deleted.
+	RepositoryEventDelete = "delete"
+	// RepositoryEventTag records that a tag was created or moved to
+	// another manifest.
+	RepositoryEventTag = "tag"
+	// RepositoryEventUntag records that a tag was deleted.
+	RepositoryEventUntag = "untag"
+	// RepositoryEventGC records that a manifest was removed by the garbage
+	// collector.
+	RepositoryEventGC = "gc"
+)
+
+// RepositoryEvent is an entry of the timeline of a repository.
+type RepositoryEvent struct {
+	// ID orders the events of a repository, increasing with time.
+	ID int64 `json:"id"`
+
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+
+	// Digest is the manifest the event applies to.
+	Digest digest.Digest `json:"digest,omitempty"`
+
+	// Tag is set for tag events. Previous is the manifest a moved tag
+	// pointed to, or the one a deleted tag pointed to.
+	Tag      string        `json:"tag,omitempty"`
+	Previous digest.Digest `json:"previous,omitempty"`
+
+	// Actor is the user who caused the event, if known.
+	Actor string `json:"actor,omitempty"`
+}
+
+// RepositoryEventLog keeps a bounded timeline of the events of repositories.
+type RepositoryEventLog interface {
+	// RepositoryEvents fills 'events' with the events of the named
+	// repository that are older than the event with ID 'before', newest
+	// first, or with the newest events if 'before' is zero. It returns
+	// io.EOF once the oldest event kept is returned, and ErrUnsupported if
+	// events are not recorded.
+	RepositoryEvents(ctx context.Context, name reference.Named, events []RepositoryEvent, before int64) (n int, err error)
+
+	// RecordRepositoryEvent appends an event to the timeline of the named
+	// repository, setting its ID and, if zero, its time.
+	RecordRepositoryEvent(ctx context.Context, name reference.Named, event RepositoryEvent) error
+}
+
 // RepositoryRemover removes given repository
 type RepositoryRemover interface {
 	Remove(ctx context.Context, name reference.Named) error
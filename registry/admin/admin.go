@@ -0,0 +1,358 @@
+// Package admin defines the administrative API of the registry, served over
+// gRPC alongside the HTTP API. Its messages and service are described by
+// admin.proto, which clients in other languages can generate code from; the
+// types of this package are maintained by hand to match it.
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GarbageCollectRequest requests a garbage collection.
+type GarbageCollectRequest struct {
+	DryRun         bool `protobuf:"varint,1,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+	RemoveUntagged bool `protobuf:"varint,2,opt,name=remove_untagged,json=removeUntagged" json:"remove_untagged,omitempty"`
+}
+
+func (m *GarbageCollectRequest) Reset()         { *m = GarbageCollectRequest{} }
+func (m *GarbageCollectRequest) String() string { return proto.CompactTextString(m) }
+func (*GarbageCollectRequest) ProtoMessage()    {}
+
+// GarbageCollectResponse is the response to a GarbageCollectRequest.
+type GarbageCollectResponse struct{}
+
+func (m *GarbageCollectResponse) Reset()         { *m = GarbageCollectResponse{} }
+func (m *GarbageCollectResponse) String() string { return proto.CompactTextString(m) }
+func (*GarbageCollectResponse) ProtoMessage()    {}
+
+// DeleteRepositoryRequest requests the removal of a repository.
+type DeleteRepositoryRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *DeleteRepositoryRequest) Reset()         { *m = DeleteRepositoryRequest{} }
+func (m *DeleteRepositoryRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteRepositoryRequest) ProtoMessage()    {}
+
+// DeleteRepositoryResponse is the response to a DeleteRepositoryRequest.
+type DeleteRepositoryResponse struct{}
+
+func (m *DeleteRepositoryResponse) Reset()         { *m = DeleteRepositoryResponse{} }
+func (m *DeleteRepositoryResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteRepositoryResponse) ProtoMessage()    {}
+
+// MintTokenRequest requests a bearer token for a subject.
+type MintTokenRequest struct {
+	Subject   string   `protobuf:"bytes,1,opt,name=subject" json:"subject,omitempty"`
+	Scopes    []string `protobuf:"bytes,2,rep,name=scopes" json:"scopes,omitempty"`
+	ExpiresIn int64    `protobuf:"varint,3,opt,name=expires_in,json=expiresIn" json:"expires_in,omitempty"`
+}
+
+func (m *MintTokenRequest) Reset()         { *m = MintTokenRequest{} }
+func (m *MintTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*MintTokenRequest) ProtoMessage()    {}
+
+// MintTokenResponse carries a minted token.
+type MintTokenResponse struct {
+	Token     string `protobuf:"bytes,1,opt,name=token" json:"token,omitempty"`
+	ExpiresAt int64  `protobuf:"varint,2,opt,name=expires_at,json=expiresAt" json:"expires_at,omitempty"`
+}
+
+func (m *MintTokenResponse) Reset()         { *m = MintTokenResponse{} }
+func (m *MintTokenResponse) String() string { return proto.CompactTextString(m) }
+func (*MintTokenResponse) ProtoMessage()    {}
+
+// HealthRequest requests the health of the registry.
+type HealthRequest struct{}
+
+func (m *HealthRequest) Reset()         { *m = HealthRequest{} }
+func (m *HealthRequest) String() string { return proto.CompactTextString(m) }
+func (*HealthRequest) ProtoMessage()    {}
+
+// HealthResponse reports the failing health checks.
+type HealthResponse struct {
+	Healthy  bool              `protobuf:"varint,1,opt,name=healthy" json:"healthy,omitempty"`
+	Failures map[string]string `protobuf:"bytes,2,rep,name=failures" json:"failures,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *HealthResponse) Reset()         { *m = HealthResponse{} }
+func (m *HealthResponse) String() string { return proto.CompactTextString(m) }
+func (*HealthResponse) ProtoMessage()    {}
+
+// UsageRequest requests the usage of a namespace and of subjects.
+type UsageRequest struct {
+	Namespace string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+}
+
+func (m *UsageRequest) Reset()         { *m = UsageRequest{} }
+func (m *UsageRequest) String() string { return proto.CompactTextString(m) }
+func (*UsageRequest) ProtoMessage()    {}
+
+// SubjectUsage is the bandwidth used by an authenticated subject.
+type SubjectUsage struct {
+	Subject  string `protobuf:"bytes,1,opt,name=subject" json:"subject,omitempty"`
+	Pushed   int64  `protobuf:"varint,2,opt,name=pushed" json:"pushed,omitempty"`
+	Pulled   int64  `protobuf:"varint,3,opt,name=pulled" json:"pulled,omitempty"`
+	LastSeen int64  `protobuf:"varint,4,opt,name=last_seen,json=lastSeen" json:"last_seen,omitempty"`
+}
+
+func (m *SubjectUsage) Reset()         { *m = SubjectUsage{} }
+func (m *SubjectUsage) String() string { return proto.CompactTextString(m) }
+func (*SubjectUsage) ProtoMessage()    {}
+
+// UsageResponse reports the usage of a namespace and of subjects.
+type UsageResponse struct {
+	Repositories int64           `protobuf:"varint,1,opt,name=repositories" json:"repositories,omitempty"`
+	Size         int64           `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	Subjects     []*SubjectUsage `protobuf:"bytes,3,rep,name=subjects" json:"subjects,omitempty"`
+}
+
+func (m *UsageResponse) Reset()         { *m = UsageResponse{} }
+func (m *UsageResponse) String() string { return proto.CompactTextString(m) }
+func (*UsageResponse) ProtoMessage()    {}
+
+// ExportRepositoryRequest requests the copy of a repository to another bucket.
+type ExportRepositoryRequest struct {
+	Name   string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Bucket string `protobuf:"bytes,2,opt,name=bucket" json:"bucket,omitempty"`
+	Prefix string `protobuf:"bytes,3,opt,name=prefix" json:"prefix,omitempty"`
+}
+
+func (m *ExportRepositoryRequest) Reset()         { *m = ExportRepositoryRequest{} }
+func (m *ExportRepositoryRequest) String() string { return proto.CompactTextString(m) }
+func (*ExportRepositoryRequest) ProtoMessage()    {}
+
+// ExportRepositoryResponse counts the objects copied by an export.
+type ExportRepositoryResponse struct {
+	Files int64 `protobuf:"varint,1,opt,name=files" json:"files,omitempty"`
+	Blobs int64 `protobuf:"varint,2,opt,name=blobs" json:"blobs,omitempty"`
+}
+
+func (m *ExportRepositoryResponse) Reset()         { *m = ExportRepositoryResponse{} }
+func (m *ExportRepositoryResponse) String() string { return proto.CompactTextString(m) }
+func (*ExportRepositoryResponse) ProtoMessage()    {}
+
+// IntrospectTokenRequest requests the verification of a bearer token.
+type IntrospectTokenRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=token" json:"token,omitempty"`
+	// Namespace selects the tenant whose token authentication verifies
+	// the token. The token authentication of the registry is used when
+	// empty, or when no tenant owns the namespace.
+	Namespace string `protobuf:"bytes,2,opt,name=namespace" json:"namespace,omitempty"`
+}
+
+func (m *IntrospectTokenRequest) Reset()         { *m = IntrospectTokenRequest{} }
+func (m *IntrospectTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*IntrospectTokenRequest) ProtoMessage()    {}
+
+// IntrospectTokenResponse reports whether a token is accepted, and its
+// claims if it is.
+type IntrospectTokenResponse struct {
+	Active    bool   `protobuf:"varint,1,opt,name=active" json:"active,omitempty"`
+	Scope     string `protobuf:"bytes,2,opt,name=scope" json:"scope,omitempty"`
+	Subject   string `protobuf:"bytes,3,opt,name=subject" json:"subject,omitempty"`
+	Audience  string `protobuf:"bytes,4,opt,name=audience" json:"audience,omitempty"`
+	Issuer    string `protobuf:"bytes,5,opt,name=issuer" json:"issuer,omitempty"`
+	ExpiresAt int64  `protobuf:"varint,6,opt,name=expires_at,json=expiresAt" json:"expires_at,omitempty"`
+	IssuedAt  int64  `protobuf:"varint,7,opt,name=issued_at,json=issuedAt" json:"issued_at,omitempty"`
+	NotBefore int64  `protobuf:"varint,8,opt,name=not_before,json=notBefore" json:"not_before,omitempty"`
+	JwtId     string `protobuf:"bytes,9,opt,name=jwt_id,json=jwtId" json:"jwt_id,omitempty"`
+}
+
+func (m *IntrospectTokenResponse) Reset()         { *m = IntrospectTokenResponse{} }
+func (m *IntrospectTokenResponse) String() string { return proto.CompactTextString(m) }
+func (*IntrospectTokenResponse) ProtoMessage()    {}
+
+// AdminServer is the server side of the administrative API.
+type AdminServer interface {
+	GarbageCollect(context.Context, *GarbageCollectRequest) (*GarbageCollectResponse, error)
+	DeleteRepository(context.Context, *DeleteRepositoryRequest) (*DeleteRepositoryResponse, error)
+	MintToken(context.Context, *MintTokenRequest) (*MintTokenResponse, error)
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	Usage(context.Context, *UsageRequest) (*UsageResponse, error)
+	ExportRepository(context.Context, *ExportRepositoryRequest) (*ExportRepositoryResponse, error)
+	IntrospectToken(context.Context, *IntrospectTokenRequest) (*IntrospectTokenResponse, error)
+}
+
+// RegisterAdminServer registers srv with s.
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// NewServer returns a gRPC server serving srv, with the TLS configuration
+// config.
+func NewServer(srv AdminServer, config *tls.Config) *grpc.Server {
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(config)))
+	RegisterAdminServer(s, srv)
+	return s
+}
+
+const serviceName = "registry.admin.v1.Admin"
+
+// Methods returns the names of the methods of the service.
+func Methods() []string {
+	methods := make([]string, 0, len(serviceDesc.Methods))
+	for _, method := range serviceDesc.Methods {
+		methods = append(methods, method.MethodName)
+	}
+	return methods
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GarbageCollect",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+				in := new(GarbageCollectRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AdminServer).GarbageCollect(ctx, in)
+			},
+		},
+		{
+			MethodName: "DeleteRepository",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+				in := new(DeleteRepositoryRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AdminServer).DeleteRepository(ctx, in)
+			},
+		},
+		{
+			MethodName: "MintToken",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+				in := new(MintTokenRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AdminServer).MintToken(ctx, in)
+			},
+		},
+		{
+			MethodName: "Health",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+				in := new(HealthRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AdminServer).Health(ctx, in)
+			},
+		},
+		{
+			MethodName: "Usage",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+				in := new(UsageRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AdminServer).Usage(ctx, in)
+			},
+		},
+		{
+			MethodName: "ExportRepository",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+				in := new(ExportRepositoryRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AdminServer).ExportRepository(ctx, in)
+			},
+		},
+		{
+			MethodName: "IntrospectToken",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+				in := new(IntrospectTokenRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AdminServer).IntrospectToken(ctx, in)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// AdminClient is the client side of the administrative API.
+type AdminClient interface {
+	GarbageCollect(ctx context.Context, in *GarbageCollectRequest, opts ...grpc.CallOption) (*GarbageCollectResponse, error)
+	DeleteRepository(ctx context.Context, in *DeleteRepositoryRequest, opts ...grpc.CallOption) (*DeleteRepositoryResponse, error)
+	MintToken(ctx context.Context, in *MintTokenRequest, opts ...grpc.CallOption) (*MintTokenResponse, error)
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	Usage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*UsageResponse, error)
+	ExportRepository(ctx context.Context, in *ExportRepositoryRequest, opts ...grpc.CallOption) (*ExportRepositoryResponse, error)
+	IntrospectToken(ctx context.Context, in *IntrospectTokenRequest, opts ...grpc.CallOption) (*IntrospectTokenResponse, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewAdminClient returns a client of the administrative API using cc.
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) GarbageCollect(ctx context.Context, in *GarbageCollectRequest, opts ...grpc.CallOption) (*GarbageCollectResponse, error) {
+	out := new(GarbageCollectResponse)
+	if err := grpc.Invoke(ctx, "/"+serviceName+"/GarbageCollect", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteRepository(ctx context.Context, in *DeleteRepositoryRequest, opts ...grpc.CallOption) (*DeleteRepositoryResponse, error) {
+	out := new(DeleteRepositoryResponse)
+	if err := grpc.Invoke(ctx, "/"+serviceName+"/DeleteRepository", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) MintToken(ctx context.Context, in *MintTokenRequest, opts ...grpc.CallOption) (*MintTokenResponse, error) {
+	out := new(MintTokenResponse)
+	if err := grpc.Invoke(ctx, "/"+serviceName+"/MintToken", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	if err := grpc.Invoke(ctx, "/"+serviceName+"/Health", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Usage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*UsageResponse, error) {
+	out := new(UsageResponse)
+	if err := grpc.Invoke(ctx, "/"+serviceName+"/Usage", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ExportRepository(ctx context.Context, in *ExportRepositoryRequest, opts ...grpc.CallOption) (*ExportRepositoryResponse, error) {
+	out := new(ExportRepositoryResponse)
+	if err := grpc.Invoke(ctx, "/"+serviceName+"/ExportRepository", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) IntrospectToken(ctx context.Context, in *IntrospectTokenRequest, opts ...grpc.CallOption) (*IntrospectTokenResponse, error) {
+	out := new(IntrospectTokenResponse)
+	if err := grpc.Invoke(ctx, "/"+serviceName+"/IntrospectToken", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
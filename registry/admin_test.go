@@ -0,0 +1,164 @@
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/registry/admin"
+	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+)
+
+// writeAdminCertificate writes a self-signed certificate for 127.0.0.1, which
+// can authenticate servers and clients, and its key.
+func writeAdminCertificate(t *testing.T, certFile, keyFile string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "admin"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestAdminAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCertFile, serverKeyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	clientCertFile, clientKeyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeAdminCertificate(t, serverCertFile, serverKeyFile)
+	clientCert := writeAdminCertificate(t, clientCertFile, clientKeyFile)
+
+	config := &configuration.Configuration{}
+	config.HTTP.Addr = freeAddr(t)
+	config.Storage = map[string]configuration.Parameters{"inmemory": map[string]interface{}{}}
+	config.Admin.Addr = freeAddr(t)
+	config.Admin.TLS = configuration.AdminTLS{
+		Certificate: serverCertFile,
+		Key:         serverKeyFile,
+		ClientCAs:   []string{clientCertFile},
+	}
+	config.Admin.Clients = map[string][]string{
+		"admin":        {"Health", "DeleteRepository"},
+		"introspector": {"IntrospectToken"},
+	}
+	registry, err := NewRegistry(context.Background(), config)
+	if err != nil {
+		t.Fatalf("unexpected error creating registry: %v", err)
+	}
+	go registry.ListenAndServe()
+	defer registry.server.Close()
+
+	serverCA, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverCA)
+
+	dial := func(certificates []tls.Certificate) (admin.AdminClient, func()) {
+		t.Helper()
+		creds := credentials.NewTLS(&tls.Config{RootCAs: roots, Certificates: certificates})
+		conn, err := grpc.Dial(config.Admin.Addr, grpc.WithTransportCredentials(creds), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+		if err != nil {
+			t.Fatalf("unexpected error dialing: %v", err)
+		}
+		return admin.NewAdminClient(conn), func() { conn.Close() }
+	}
+
+	client, closeClient := dial([]tls.Certificate{clientCert})
+	defer closeClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	health, err := client.Health(ctx, &admin.HealthRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error checking health: %v", err)
+	}
+	if !health.Healthy || len(health.Failures) != 0 {
+		t.Fatalf("unexpected health: %v", health)
+	}
+
+	_, err = client.DeleteRepository(ctx, &admin.DeleteRepositoryRequest{Name: "foo/bar"})
+	if grpc.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected deletes to be disabled, got %v", err)
+	}
+
+	// the client is restricted to the methods allowed to its certificate
+	_, err = client.MintToken(ctx, &admin.MintTokenRequest{Subject: "alice"})
+	if grpc.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected the client not to be allowed to mint tokens, got %v", err)
+	}
+
+	// clients without a certificate are rejected
+	creds := credentials.NewTLS(&tls.Config{RootCAs: roots})
+	conn, err := grpc.Dial(config.Admin.Addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %v", err)
+	}
+	defer conn.Close()
+	short, cancelShort := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShort()
+	if _, err := admin.NewAdminClient(conn).Health(short, &admin.HealthRequest{}); err == nil {
+		t.Fatal("expected a client without certificate to be rejected")
+	}
+}
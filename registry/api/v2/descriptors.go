@@ -9,6 +9,15 @@ import (
 	"github.com/opencontainers/go-digest"
 )
 
+const metadataBody = `{
+    "description": <description>,
+    "owner": <owner>,
+    "labels": {
+        <key>: <value>,
+        ...
+    }
+}`
+
 var (
 	nameParameterDescriptor = ParameterDescriptor{
 		Name:        "name",
@@ -18,6 +27,14 @@ var (
 		Description: `Name of the target repository.`,
 	}
 
+	namespaceParameterDescriptor = ParameterDescriptor{
+		Name:        "namespace",
+		Type:        "string",
+		Format:      reference.NameRegexp.String(),
+		Required:    true,
+		Description: `Name prefix shared by the repositories of the target namespace.`,
+	}
+
 	referenceParameterDescriptor = ParameterDescriptor{
 		Name:        "reference",
 		Type:        "string",
@@ -81,6 +98,20 @@ var (
 		Format:      "<uuid>",
 	}
 
+	dockerUploadDigestHeader = ParameterDescriptor{
+		Name:        "Docker-Upload-Digest",
+		Description: "Digest of the content of the upload received so far, up to `Docker-Upload-Digest-Offset`. Clients compare it with the digest of the content they sent to detect a corrupted upload early, and restart it. Absent if the registry cannot compute it, such as after a chunk written by another instance when digest resumption is disabled.",
+		Type:        "digest",
+		Format:      "<digest>",
+	}
+
+	dockerUploadDigestOffsetHeader = ParameterDescriptor{
+		Name:        "Docker-Upload-Digest-Offset",
+		Description: "Number of bytes of the upload hashed in `Docker-Upload-Digest`.",
+		Type:        "integer",
+		Format:      "<bytes>",
+	}
+
 	digestHeader = ParameterDescriptor{
 		Name:        "Docker-Content-Digest",
 		Description: "Digest of the targeted content for the request.",
@@ -112,6 +143,42 @@ var (
 		},
 	}
 
+	adminBansFailures = []ResponseDescriptor{
+		{
+			Name:        "Not allowed",
+			Description: "Bans are not enabled on this registry.",
+			StatusCode:  http.StatusMethodNotAllowed,
+			ErrorCodes: []errcode.ErrorCode{
+				errcode.ErrorCodeUnsupported,
+			},
+		},
+		unauthorizedResponseDescriptor,
+		deniedResponseDescriptor,
+		tooManyRequestsDescriptor,
+	}
+
+	helmFailures = []ResponseDescriptor{
+		{
+			Name:        "Not allowed",
+			Description: "The Helm chart repositories are not enabled on this registry, or it cannot list the repositories of namespaces.",
+			StatusCode:  http.StatusMethodNotAllowed,
+			ErrorCodes: []errcode.ErrorCode{
+				errcode.ErrorCodeUnsupported,
+			},
+		},
+		unauthorizedResponseDescriptor,
+		deniedResponseDescriptor,
+		tooManyRequestsDescriptor,
+	}
+
+	tagsPaginationParameters = append(paginationParameters, ParameterDescriptor{
+		Name:        "order",
+		Type:        "string",
+		Description: "Order of the tags: `lexical`, the default, or `created` to list tags oldest first by the time they were created or last moved to another manifest. The `last` value of a `created` listing must be an existing tag.",
+		Format:      "<order>",
+		Required:    false,
+	})
+
 	unauthorizedResponseDescriptor = ResponseDescriptor{
 		Name:        "Authentication Required",
 		StatusCode:  http.StatusUnauthorized,
@@ -463,7 +530,7 @@ var routeDescriptors = []RouteDescriptor{
 						Name:            "Tags Paginated",
 						Description:     "Return a portion of the tags for the specified repository.",
 						PathParameters:  []ParameterDescriptor{nameParameterDescriptor},
-						QueryParameters: paginationParameters,
+						QueryParameters: tagsPaginationParameters,
 						Successes: []ResponseDescriptor{
 							{
 								StatusCode:  http.StatusOK,
@@ -490,6 +557,18 @@ var routeDescriptors = []RouteDescriptor{
 							},
 						},
 						Failures: []ResponseDescriptor{
+							{
+								Description: "The pagination parameters were invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodePaginationNumberInvalid,
+									ErrorCodeTagOrderInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
@@ -501,14 +580,14 @@ var routeDescriptors = []RouteDescriptor{
 		},
 	},
 	{
-		Name:        RouteNameManifest,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
-		Entity:      "Manifest",
-		Description: "Create, update, delete and retrieve manifests.",
+		Name:        RouteNameStatistics,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_stats",
+		Entity:      "Statistics",
+		Description: "Retrieve pull statistics of a repository.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      "GET",
-				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Description: "Fetch the number of pulls and the time of the last pull of the repository identified by `name` and of each of its tags. Only manifest pulls are counted. This endpoint is only available if pull statistics are enabled.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -517,32 +596,43 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
 								StatusCode:  http.StatusOK,
+								Description: "The pull statistics of the named repository.",
 								Headers: []ParameterDescriptor{
-									digestHeader,
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
 								},
 								Body: BodyDescriptor{
-									ContentType: "<media type of manifest>",
-									Format:      manifestBody,
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "pulls": <pulls>,
+    "lastPulled": <RFC3339 time>,
+    "tags": {
+        <tag>: {
+            "pulls": <pulls>,
+            "lastPulled": <RFC3339 time>
+        },
+        ...
+    }
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "The name or reference was invalid.",
-								StatusCode:  http.StatusBadRequest,
+								Name:        "Not allowed",
+								Description: "Pull statistics are not enabled on the registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
+									errcode.ErrorCodeUnsupported,
 								},
 							},
 							unauthorizedResponseDescriptor,
@@ -553,9 +643,17 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameMetadata,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_metadata",
+		Entity:      "Metadata",
+		Description: "Retrieve and update the metadata document of a repository, holding its description, owner and labels.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "PUT",
-				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Method:      "GET",
+				Description: "Fetch the metadata of the repository identified by `name`. A repository without metadata has an empty document.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -564,86 +662,45 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
-						},
-						Body: BodyDescriptor{
-							ContentType: "<media type of manifest>",
-							Format:      manifestBody,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
-								StatusCode:  http.StatusCreated,
+								StatusCode:  http.StatusOK,
+								Description: "The metadata of the named repository.",
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Description: "The canonical location url of the uploaded manifest.",
-										Format:      "<url>",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									contentLengthZeroHeader,
-									digestHeader,
-								},
-							},
-						},
-						Failures: []ResponseDescriptor{
-							{
-								Name:        "Invalid Manifest",
-								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
-								StatusCode:  http.StatusBadRequest,
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
-								},
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
-									ErrorCodeManifestInvalid,
-									ErrorCodeManifestUnverified,
-									ErrorCodeBlobUnknown,
-								},
-							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
-							tooManyRequestsDescriptor,
-							{
-								Name:        "Missing Layer(s)",
-								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
-								StatusCode:  http.StatusBadRequest,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
-									Format: `{
-    "errors:" [{
-            "code": "BLOB_UNKNOWN",
-            "message": "blob unknown to registry",
-            "detail": {
-                "digest": "<digest>"
-            }
-        },
-        ...
-    ]
-}`,
+									Format:      metadataBody,
 								},
 							},
+						},
+						Failures: []ResponseDescriptor{
 							{
 								Name:        "Not allowed",
-								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								Description: "Repository metadata is not supported by the registry.",
 								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
 								},
 							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
 						},
 					},
 				},
 			},
 			{
-				Method:      "DELETE",
-				Description: "Delete the manifest identified by `name` and `reference`. Note that a manifest can _only_ be deleted by `digest`.",
+				Method:      "PUT",
+				Description: "Replace the metadata of the repository identified by `name`. The repository must exist. The document is limited to 64KiB.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -652,154 +709,142 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format:      metadataBody,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								StatusCode: http.StatusAccepted,
+								StatusCode:  http.StatusNoContent,
+								Description: "The metadata was stored.",
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:        "Invalid Name or Reference",
-								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								Name:        "Invalid Metadata",
+								Description: "The metadata document is invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
-								},
-							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
-							tooManyRequestsDescriptor,
-							{
-								Name:        "Unknown Manifest",
-								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
-								StatusCode:  http.StatusNotFound,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
-									ErrorCodeManifestUnknown,
+									ErrorCodeMetadataInvalid,
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/json",
+									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
 							},
 							{
 								Name:        "Not allowed",
-								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								Description: "Repository metadata is not supported by the registry or the registry is in read-only mode.",
 								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
 								},
 							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
 						},
 					},
 				},
 			},
 		},
 	},
-
 	{
-		Name:        RouteNameBlob,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
-		Entity:      "Blob",
-		Description: "Operations on blobs identified by `name` and `digest`. Used to fetch or delete layers by digest.",
+		Name:        RouteNameEvents,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_events",
+		Entity:      "Events",
+		Description: "Retrieve the timeline of a repository: the manifests pushed, deleted and removed by the garbage collector, and the tags created, moved and deleted. The registry keeps a bounded number of the most recent events of each repository.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      "GET",
-				Description: "Retrieve the blob from the registry identified by `digest`. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Description: "Fetch the events of the repository identified by `name`, newest first.",
 				Requests: []RequestDescriptor{
 					{
-						Name: "Fetch Blob",
+						Name:        "Events",
+						Description: "Return the events of the repository, paginated with `n` and `last`. The `last` value is the `id` of the last event received, and the next page holds the events older than it.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							digestPathParameter,
 						},
+						QueryParameters: paginationParameters,
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob identified by `digest` is available. The blob content will be present in the body of the request.",
 								StatusCode:  http.StatusOK,
+								Description: "A page of the events of the named repository. A `Link` header is set if older events remain.",
 								Headers: []ParameterDescriptor{
 									{
 										Name:        "Content-Length",
 										Type:        "integer",
-										Description: "The length of the requested blob content.",
+										Description: "Length of the JSON response body.",
 										Format:      "<length>",
 									},
-									digestHeader,
+									linkHeader,
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/octet-stream",
-									Format:      "<blob binary data>",
-								},
-							},
-							{
-								Description: "The blob identified by `digest` is available at the provided location.",
-								StatusCode:  http.StatusTemporaryRedirect,
-								Headers: []ParameterDescriptor{
-									{
-										Name:        "Location",
-										Type:        "url",
-										Description: "The location where the layer should be accessible.",
-										Format:      "<blob location>",
-									},
-									digestHeader,
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "events": [
+        {
+            "id": <id>,
+            "time": <time>,
+            "action": "push" | "delete" | "tag" | "untag" | "gc",
+            "digest": <digest>,
+            "tag": <tag>,
+            "previous": <digest the tag pointed to before>,
+            "actor": <user>
+        },
+        ...
+    ]
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
-								StatusCode:  http.StatusBadRequest,
+								Name:        "Not allowed",
+								Description: "The events of repositories are not recorded by this registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeDigestInvalid,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
+									errcode.ErrorCodeUnsupported,
 								},
 							},
 							{
-								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
-								StatusCode:  http.StatusNotFound,
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
-								},
+								Name:        "Invalid Pagination",
+								Description: "The `n` parameter is not a positive integer, or `last` is not an event id.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
-									ErrorCodeBlobUnknown,
+									ErrorCodePaginationNumberInvalid,
 								},
 							},
 							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameSignatures,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_signatures/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Signatures",
+		Description: "List the cosign signatures of a manifest. Signatures are recognized by the cosign convention of tagging them `<algorithm>-<hex digest>.sig`.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the signatures of the manifest identified by `name` and `digest`. Each signature is a layer of the signature manifest, holding the signature in its annotations. An unsigned manifest has no signature manifest and an empty list of signatures.",
+				Requests: []RequestDescriptor{
 					{
-						Name:        "Fetch Blob Part",
-						Description: "This endpoint may also support RFC7233 compliant range requests. Support can be detected by issuing a HEAD request. If the header `Accept-Range: bytes` is returned, range requests can be used to fetch partial content.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							{
-								Name:        "Range",
-								Type:        "string",
-								Description: "HTTP Range header specifying blob chunk.",
-								Format:      "bytes=<start>-<end>",
-							},
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
@@ -807,56 +852,64 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob identified by `digest` is available. The specified chunk of blob content will be present in the body of the request.",
-								StatusCode:  http.StatusPartialContent,
+								StatusCode:  http.StatusOK,
+								Description: "The signatures of the manifest.",
 								Headers: []ParameterDescriptor{
 									{
 										Name:        "Content-Length",
 										Type:        "integer",
-										Description: "The length of the requested blob chunk.",
+										Description: "Length of the JSON response body.",
 										Format:      "<length>",
 									},
-									{
-										Name:        "Content-Range",
-										Type:        "byte range",
-										Description: "Content range of blob chunk.",
-										Format:      "bytes <start>-<end>/<size>",
-									},
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/octet-stream",
-									Format:      "<blob binary data>",
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "digest": <digest>,
+    "tag": <algorithm>-<hex digest>.sig,
+    "manifest": <signature manifest descriptor>,
+    "signatures": [
+        {
+            "mediaType": <media type>,
+            "size": <size>,
+            "digest": <digest>,
+            "annotations": {
+                "dev.cosignproject.cosign/signature": <signature>,
+                ...
+            }
+        },
+        ...
+    ]
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
+								Name:        "Invalid Digest",
+								Description: "The digest is invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
 									ErrorCodeDigestInvalid,
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/json",
+									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
 							},
 							{
-								StatusCode: http.StatusNotFound,
+								Name:        "Unknown Manifest",
+								Description: "The manifest is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
-									ErrorCodeBlobUnknown,
+									ErrorCodeManifestUnknown,
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/json",
+									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
 							},
-							{
-								Description: "The range specification cannot be satisfied for the requested content. This can happen when the range is not formatted correctly or if the range is outside of the valid size of the content.",
-								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
-							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
@@ -865,9 +918,17 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameLayerSharing,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_sharing/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Layer Sharing",
+		Description: "Report which layers of an image are shared with other repositories and which are unique to its repository, to help choosing base images. Sharing is read from the reference index of the registry.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "DELETE",
-				Description: "Delete the blob identified by `name` and `digest`",
+				Method:      "GET",
+				Description: "Fetch the sharing of the layers of the image manifest identified by `name` and `digest`. A layer is shared if a manifest of another repository references it. The other repositories are counted but not named. Only manifests pushed while the reference index is enabled are accounted for.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -880,46 +941,78 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						Successes: []ResponseDescriptor{
 							{
-								StatusCode: http.StatusAccepted,
+								StatusCode:  http.StatusOK,
+								Description: "The sharing of the layers of the image, in the order of the manifest.",
 								Headers: []ParameterDescriptor{
 									{
 										Name:        "Content-Length",
 										Type:        "integer",
-										Description: "0",
-										Format:      "0",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "digest": <digest>,
+    "layers": [
+        {
+            "digest": <digest>,
+            "size": <size>,
+            "mediaType": <media type>,
+            "repositories": <number of other repositories referencing the layer>
+        },
+        ...
+    ],
+    "size": <total size of the layers>,
+    "sharedSize": <size of the shared layers>,
+    "uniqueSize": <size of the unique layers>
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
+								Name:        "Invalid Digest",
+								Description: "The digest is invalid.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeDigestInvalid,
-									ErrorCodeNameInvalid,
 								},
-							},
-							{
-								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
-								StatusCode:  http.StatusNotFound,
 								Body: BodyDescriptor{
-									ContentType: "application/json",
+									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+							},
+							{
+								Name:        "Not An Image",
+								Description: "The manifest is a manifest list or an image index, which has no layers. Query the manifest of a platform instead.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
-									ErrorCodeBlobUnknown,
+									ErrorCodeManifestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
 								},
 							},
 							{
-								Description: "Blob delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled",
-								StatusCode:  http.StatusMethodNotAllowed,
+								Name:        "Unknown Manifest",
+								Description: "The manifest is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
 								Body: BodyDescriptor{
-									ContentType: "application/json",
+									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "The reference index is not maintained by this registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
 								},
@@ -932,81 +1025,94 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
-
-			// TODO(stevvooe): We may want to add a PUT request here to
-			// kickoff an upload of a blob, integrated with the blob upload
-			// API.
 		},
 	},
-
 	{
-		Name:        RouteNameBlobUpload,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/",
-		Entity:      "Initiate Blob Upload",
-		Description: "Initiate a blob upload. This endpoint can be used to create resumable uploads or monolithic uploads.",
+		Name:        RouteNamePullSize,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_size/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Pull Size",
+		Description: "Estimate the size of pulling an image from the sizes recorded in its descriptors, to budget bandwidth before pulling. Blobs already present on the client are not accounted for.",
 		Methods: []MethodDescriptor{
 			{
-				Method:      "POST",
-				Description: "Initiate a resumable blob upload. If successful, an upload location will be provided to complete the upload. Optionally, if the `digest` parameter is present, the request body will be used to complete the upload in a single request.",
+				Method:      "GET",
+				Description: "Fetch the size of the manifests, config and compressed layers of the manifest identified by `name` and `reference`, where `reference` can be a tag or digest. Blobs referenced several times are counted once. For a manifest list or an image index, the size of each listed manifest is also reported, and the total covers all of them unless a platform is selected.",
 				Requests: []RequestDescriptor{
 					{
-						Name:        "Initiate Monolithic Blob Upload",
-						Description: "Upload a blob identified by the `digest` parameter in single request. This upload will not be resumable unless a recoverable error is returned.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							{
-								Name:   "Content-Length",
-								Type:   "integer",
-								Format: "<length of blob>",
-							},
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
+							referenceParameterDescriptor,
 						},
 						QueryParameters: []ParameterDescriptor{
 							{
-								Name:        "digest",
+								Name:        "platform",
 								Type:        "query",
-								Format:      "<digest>",
-								Regexp:      digest.DigestRegexp,
-								Description: `Digest of uploaded blob. If present, the upload will be completed, in a single request, with contents of the request body as the resulting blob.`,
+								Format:      "<os>/<architecture>[/<variant>]",
+								Description: "If the manifest is a manifest list or an image index, only count the manifest it lists for this platform, selected as for manifest fetches. Ignored for other manifests.",
 							},
 						},
-						Body: BodyDescriptor{
-							ContentType: "application/octect-stream",
-							Format:      "<binary data>",
-						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob has been created in the registry and is available at the provided location.",
-								StatusCode:  http.StatusCreated,
+								StatusCode:  http.StatusOK,
+								Description: "The size of pulling the manifest, in bytes.",
 								Headers: []ParameterDescriptor{
 									{
-										Name:   "Location",
-										Type:   "url",
-										Format: "<blob location>",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "reference": <tag or digest>,
+    "digest": <digest>,
+    "mediaType": <media type>,
+    "size": <total size>,
+    "platforms": [
+        {
+            "digest": <digest>,
+            "platform": {
+                "architecture": <architecture>,
+                "os": <os>,
+                "variant": <variant>
+            },
+            "size": <size of the manifest of the platform, its config and layers>
+        },
+        ...
+    ]
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
+								Description: "The name, reference or platform was invalid.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodePlatformInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
 								},
 							},
 							{
-								Name:        "Not allowed",
-								Description: "Blob upload is not allowed because the registry is configured as a pull-through cache or for some other reason",
-								StatusCode:  http.StatusMethodNotAllowed,
+								Description: "The manifest, or the manifest of the selected platform, is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									errcode.ErrorCodeUnsupported,
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
 								},
 							},
 							unauthorizedResponseDescriptor,
@@ -1015,45 +1121,77 @@ var routeDescriptors = []RouteDescriptor{
 							tooManyRequestsDescriptor,
 						},
 					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameScanReport,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_scan/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Scan Report",
+		Description: "Retrieve the vulnerability scan report of a manifest, as returned by the configured scanner.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the scan report of the manifest identified by `name` and `digest`. The report is absent if the manifest has not been scanned yet. This endpoint is only available if scanning is enabled.",
+				Requests: []RequestDescriptor{
 					{
-						Name:        "Initiate Resumable Blob Upload",
-						Description: "Initiate a resumable blob upload with an empty request body.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							contentLengthZeroHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The upload has been created. The `Location` header must be used to complete the upload. The response should be identical to a `GET` request on the contents of the returned `Location` header.",
-								StatusCode:  http.StatusAccepted,
+								StatusCode:  http.StatusOK,
+								Description: "The scan report of the manifest.",
 								Headers: []ParameterDescriptor{
-									contentLengthZeroHeader,
 									{
-										Name:        "Location",
-										Type:        "url",
-										Format:      "/v2/<name>/blobs/uploads/<uuid>",
-										Description: "The location of the created upload. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
-									},
-									{
-										Name:        "Range",
-										Format:      "0-0",
-										Description: "Range header indicating the progress of the upload. When starting an upload, it will return an empty range, since no content has been received.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									dockerUploadUUIDHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "digest": <digest>,
+    "report": {
+        "report": <report digest>,
+        "severities": {
+            <severity>: <count>,
+            ...
+        },
+        "scannedAt": <RFC3339 time>
+    }
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
+								Name:        "Not allowed",
+								Description: "Scanning is not enabled on the registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
-									ErrorCodeNameInvalid,
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							{
+								Name:        "Unknown Manifest",
+								Description: "The manifest is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
 								},
 							},
 							unauthorizedResponseDescriptor,
@@ -1062,63 +1200,69 @@ var routeDescriptors = []RouteDescriptor{
 							tooManyRequestsDescriptor,
 						},
 					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameManifest,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Manifest",
+		Description: "Create, update, delete and retrieve manifests.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Requests: []RequestDescriptor{
 					{
-						Name:        "Mount Blob",
-						Description: "Mount a blob identified by the `mount` parameter from another repository.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							contentLengthZeroHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
+							referenceParameterDescriptor,
 						},
 						QueryParameters: []ParameterDescriptor{
 							{
-								Name:        "mount",
-								Type:        "query",
-								Format:      "<digest>",
-								Regexp:      digest.DigestRegexp,
-								Description: `Digest of blob to mount from the source repository.`,
-							},
-							{
-								Name:        "from",
+								Name:        "platform",
 								Type:        "query",
-								Format:      "<repository name>",
-								Regexp:      reference.NameRegexp,
-								Description: `Name of the source repository.`,
+								Format:      "<os>/<architecture>[/<variant>]",
+								Description: "If the manifest is a manifest list or an image index, fetch the manifest it lists for this platform instead. Without a variant, the first manifest listed for the operating system and architecture is fetched. Ignored for other manifests.",
 							},
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob has been mounted in the repository and is available at the provided location.",
-								StatusCode:  http.StatusCreated,
+								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
+								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
+									digestHeader,
 									{
-										Name:   "Location",
-										Type:   "url",
-										Format: "<blob location>",
+										Name:        "Docker-Index-Digest",
+										Type:        "digest",
+										Format:      "<digest>",
+										Description: "Digest of the manifest list or image index the manifest was selected from. Only present if the `platform` parameter selected a manifest.",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "<media type of manifest>",
+									Format:      manifestBody,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
+								Description: "The name, reference or platform was invalid, or the manifest is a schema1 manifest and schema1 is disabled.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodePlatformInvalid,
+									ErrorCodeManifestSchema1Disabled,
 								},
-							},
-							{
-								Name:        "Not allowed",
-								Description: "Blob mount is not allowed because the registry is configured as a pull-through cache or for some other reason",
-								StatusCode:  http.StatusMethodNotAllowed,
-								ErrorCodes: []errcode.ErrorCode{
-									errcode.ErrorCodeUnsupported,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
 								},
 							},
 							unauthorizedResponseDescriptor,
@@ -1129,65 +1273,145 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
-		},
-	},
-
-	{
-		Name:        RouteNameBlobUploadChunk,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/{uuid:[a-zA-Z0-9-_.=]+}",
-		Entity:      "Blob Upload",
-		Description: "Interact with blob uploads. Clients should never assemble URLs for this endpoint and should only take it through the `Location` header on related API requests. The `Location` header and its parameters should be preserved by clients, using the latest value returned via upload related API calls.",
-		Methods: []MethodDescriptor{
 			{
-				Method:      "GET",
-				Description: "Retrieve status of upload identified by `uuid`. The primary purpose of this endpoint is to resolve the current status of a resumable upload.",
+				Method:      "PUT",
+				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
 				Requests: []RequestDescriptor{
 					{
-						Description: "Retrieve the progress of the current upload, as reported by the `Range` header.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							uuidParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "<media type of manifest>",
+							Format:      manifestBody,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Upload Progress",
-								Description: "The upload is known and in progress. The last received offset is available in the `Range` header.",
-								StatusCode:  http.StatusNoContent,
+								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
+								StatusCode:  http.StatusCreated,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Range",
-										Type:        "header",
-										Format:      "0-<offset>",
-										Description: "Range indicating the current progress of the upload.",
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the uploaded manifest.",
+										Format:      "<url>",
 									},
 									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+									digestHeader,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
+								Name:        "Invalid Manifest",
+								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
 								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeManifestInvalid,
+									ErrorCodeManifestUnverified,
+									ErrorCodeBlobUnknown,
+									ErrorCodeManifestSchema1Disabled,
 								},
+							},
+							{
+								Name:        "Manifest Too Large",
+								Description: "The manifest payload is larger than the registry accepts.",
+								StatusCode:  http.StatusRequestEntityTooLarge,
 								Body: BodyDescriptor{
 									ContentType: "application/json",
 									Format:      errorsBody,
 								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestTooLarge,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+							{
+								Name:        "Missing Layer(s)",
+								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "errors:" [{
+            "code": "BLOB_UNKNOWN",
+            "message": "blob unknown to registry",
+            "detail": {
+                "digest": "<digest>"
+            }
+        },
+        ...
+    ]
+}`,
+								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
-								StatusCode:  http.StatusNotFound,
+								Name:        "Not allowed",
+								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							{
+								Name:        "Admission Unavailable",
+								Description: "The admission webhook configured to approve manifest pushes could not be reached or did not answer properly.",
+								StatusCode:  http.StatusServiceUnavailable,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnavailable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Delete the manifest identified by `name` and `reference`. Note that a manifest can _only_ be deleted by `digest`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Name or Reference",
+								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
@@ -1198,60 +1422,93 @@ var routeDescriptors = []RouteDescriptor{
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
+							{
+								Name:        "Unknown Manifest",
+								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
 						},
 					},
 				},
 			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlob,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Blob",
+		Description: "Operations on blobs identified by `name` and `digest`. Used to fetch or delete layers by digest.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "PATCH",
-				Description: "Upload a chunk of data for the specified upload.",
+				Method:      "GET",
+				Description: "Retrieve the blob from the registry identified by `digest`. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
 				Requests: []RequestDescriptor{
 					{
-						Name:        "Stream upload",
-						Description: "Upload a stream of data to upload without completing the upload.",
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							uuidParameterDescriptor,
-						},
+						Name: "Fetch Blob",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 						},
-						Body: BodyDescriptor{
-							ContentType: "application/octet-stream",
-							Format:      "<binary data>",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Data Accepted",
-								Description: "The stream of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
-								StatusCode:  http.StatusNoContent,
+								Description: "The blob identified by `digest` is available. The blob content will be present in the body of the request.",
+								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Format:      "/v2/<name>/blobs/uploads/<uuid>",
-										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested blob content.",
+										Format:      "<length>",
 									},
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
+								},
+							},
+							{
+								Description: "The blob identified by `digest` is available at the provided location.",
+								StatusCode:  http.StatusTemporaryRedirect,
+								Headers: []ParameterDescriptor{
 									{
-										Name:        "Range",
-										Type:        "header",
-										Format:      "0-<offset>",
-										Description: "Range indicating the current progress of the upload.",
+										Name:        "Location",
+										Type:        "url",
+										Description: "The location where the layer should be accessible.",
+										Format:      "<blob location>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+									digestHeader,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
+									ErrorCodeDigestInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
@@ -1259,15 +1516,16 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
 								StatusCode:  http.StatusNotFound,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
-								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
 									Format:      errorsBody,
 								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
@@ -1276,64 +1534,1254 @@ var routeDescriptors = []RouteDescriptor{
 						},
 					},
 					{
-						Name:        "Chunked upload",
-						Description: "Upload a chunk of data to specified upload without completing the upload. The data will be uploaded to the specified Content Range.",
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							uuidParameterDescriptor,
-						},
+						Name:        "Fetch Blob Part",
+						Description: "This endpoint may also support RFC7233 compliant range requests. Support can be detected by issuing a HEAD request. If the header `Accept-Range: bytes` is returned, range requests can be used to fetch partial content.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 							{
-								Name:        "Content-Range",
-								Type:        "header",
-								Format:      "<start of range>-<end of range, inclusive>",
-								Required:    true,
-								Description: "Range of bytes identifying the desired block of content represented by the body. Start must the end offset retrieved via status check plus one. Note that this is a non-standard use of the `Content-Range` header.",
-							},
-							{
-								Name:        "Content-Length",
-								Type:        "integer",
-								Format:      "<length of chunk>",
-								Description: "Length of the chunk being uploaded, corresponding the length of the request body.",
+								Name:        "Range",
+								Type:        "string",
+								Description: "HTTP Range header specifying blob chunk.",
+								Format:      "bytes=<start>-<end>",
 							},
 						},
-						Body: BodyDescriptor{
-							ContentType: "application/octet-stream",
-							Format:      "<binary chunk>",
-						},
-						Successes: []ResponseDescriptor{
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob identified by `digest` is available. The specified chunk of blob content will be present in the body of the request.",
+								StatusCode:  http.StatusPartialContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested blob chunk.",
+										Format:      "<length>",
+									},
+									{
+										Name:        "Content-Range",
+										Type:        "byte range",
+										Description: "Content range of blob chunk.",
+										Format:      "bytes <start>-<end>/<size>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								StatusCode: http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The range specification cannot be satisfied for the requested content. This can happen when the range is not formatted correctly or if the range is outside of the valid size of the content.",
+								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Delete the blob identified by `name` and `digest`",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "0",
+										Format:      "0",
+									},
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							{
+								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+								},
+							},
+							{
+								Description: "Blob delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled",
+								StatusCode:  http.StatusMethodNotAllowed,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+
+			// TODO(stevvooe): We may want to add a PUT request here to
+			// kickoff an upload of a blob, integrated with the blob upload
+			// API.
+		},
+	},
+
+	{
+		Name:        RouteNameBlobUpload,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/",
+		Entity:      "Initiate Blob Upload",
+		Description: "Initiate a blob upload. This endpoint can be used to create resumable uploads or monolithic uploads.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Initiate a resumable blob upload. If successful, an upload location will be provided to complete the upload. Optionally, if the `digest` parameter is present, the request body will be used to complete the upload in a single request.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Initiate Monolithic Blob Upload",
+						Description: "Upload a blob identified by the `digest` parameter in single request. This upload will not be resumable unless a recoverable error is returned.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:   "Content-Length",
+								Type:   "integer",
+								Format: "<length of blob>",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "query",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Description: `Digest of uploaded blob. If present, the upload will be completed, in a single request, with contents of the request body as the resulting blob.`,
+							},
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octect-stream",
+							Format:      "<binary data>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob has been created in the registry and is available at the provided location.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:   "Location",
+										Type:   "url",
+										Format: "<blob location>",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Blob upload is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+					{
+						Name:        "Initiate Resumable Blob Upload",
+						Description: "Initiate a resumable blob upload with an empty request body.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+							{
+								Name:        "Docker-Upload-Length",
+								Type:        "integer",
+								Format:      "<length of blob>",
+								Description: "Optional total size of the blob to be uploaded, used to estimate the completion time reported in the upload status.",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The upload has been created. The `Location` header must be used to complete the upload. The response should be identical to a `GET` request on the contents of the returned `Location` header.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/blobs/uploads/<uuid>",
+										Description: "The location of the created upload. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+									},
+									{
+										Name:        "Range",
+										Format:      "0-0",
+										Description: "Range header indicating the progress of the upload. When starting an upload, it will return an empty range, since no content has been received.",
+									},
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+					{
+						Name:        "Mount Blob",
+						Description: "Mount a blob identified by the `mount` parameter from another repository.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "mount",
+								Type:        "query",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Description: `Digest of blob to mount from the source repository.`,
+							},
+							{
+								Name:        "from",
+								Type:        "query",
+								Format:      "<repository name>",
+								Regexp:      reference.NameRegexp,
+								Description: `Name of the source repository.`,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob has been mounted in the repository and is available at the provided location.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:   "Location",
+										Type:   "url",
+										Format: "<blob location>",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Blob mount is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlobUploadChunk,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/{uuid:[a-zA-Z0-9-_.=]+}",
+		Entity:      "Blob Upload",
+		Description: "Interact with blob uploads. Clients should never assemble URLs for this endpoint and should only take it through the `Location` header on related API requests. The `Location` header and its parameters should be preserved by clients, using the latest value returned via upload related API calls.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve status of upload identified by `uuid`. The primary purpose of this endpoint is to resolve the current status of a resumable upload.",
+				Requests: []RequestDescriptor{
+					{
+						Description: "Retrieve the progress of the current upload, as reported by the `Range` header.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Upload Progress",
+								Description: "The upload is known and in progress. The last received offset is available in the `Range` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+									{
+										Name:        "Docker-Upload-Parts-Completed",
+										Type:        "integer",
+										Format:      "<parts>",
+										Description: "Number of parts stored by the storage backend. Backends which do not upload in parts report zero.",
+									},
+									{
+										Name:        "Docker-Upload-Bytes-Persisted",
+										Type:        "integer",
+										Format:      "<bytes>",
+										Description: "Number of bytes of the upload stored by the storage backend.",
+									},
+									{
+										Name:        "Docker-Upload-Bytes-Buffered",
+										Type:        "integer",
+										Format:      "<bytes>",
+										Description: "Number of bytes of the upload received by the registry but not yet stored by the storage backend.",
+									},
+									{
+										Name:        "Docker-Upload-Estimated-Completion",
+										Type:        "string",
+										Format:      "<RFC3339 time>",
+										Description: "Estimated completion time of the upload, extrapolated from its throughput so far. Only present if the upload was started with a `Docker-Upload-Length` header.",
+									},
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "PATCH",
+				Description: "Upload a chunk of data for the specified upload.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Stream upload",
+						Description: "Upload a stream of data to upload without completing the upload.",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octet-stream",
+							Format:      "<binary data>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Data Accepted",
+								Description: "The stream of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/blobs/uploads/<uuid>",
+										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+									},
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+									dockerUploadDigestHeader,
+									dockerUploadDigestOffsetHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+					{
+						Name:        "Chunked upload",
+						Description: "Upload a chunk of data to specified upload without completing the upload. The data will be uploaded to the specified Content Range.",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Content-Range",
+								Type:        "header",
+								Format:      "<start of range>-<end of range, inclusive>",
+								Required:    true,
+								Description: "Range of bytes identifying the desired block of content represented by the body. Start must the end offset retrieved via status check plus one. Note that this is a non-standard use of the `Content-Range` header.",
+							},
+							{
+								Name:        "Content-Length",
+								Type:        "integer",
+								Format:      "<length of chunk>",
+								Description: "Length of the chunk being uploaded, corresponding the length of the request body.",
+							},
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octet-stream",
+							Format:      "<binary chunk>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Chunk Accepted",
+								Description: "The chunk of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/blobs/uploads/<uuid>",
+										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+									},
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+									dockerUploadDigestHeader,
+									dockerUploadDigestOffsetHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+									ErrorCodeSizeInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The `Content-Range` specification cannot be accepted, either because it does not start at the current progress or it is invalid. Retried and reordered chunks are rejected without being written. The `Range` header holds the current progress of the upload, which the client resumes from.",
+								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									dockerUploadUUIDHeader,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeRangeInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "PUT",
+				Description: "Complete the upload specified by `uuid`, optionally appending the body as the final chunk.",
+				Requests: []RequestDescriptor{
+					{
+						Description: "Complete the upload, providing all the data in the body, if necessary. A request without a body will just complete the upload with previously uploaded content.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Content-Length",
+								Type:        "integer",
+								Format:      "<length of data>",
+								Description: "Length of the data being uploaded, corresponding to the length of the request body. May be zero if no data is provided.",
+							},
+							{
+								Name:        "Content-Digest",
+								Type:        "string",
+								Format:      "sha-256=:<base64 digest>:",
+								Description: "Optional digests of the request body, as defined by RFC 9530. The `sha-256` and `sha-512` algorithms are verified, others are ignored. A `Docker-Content-Digest` header with a digest of the body is verified likewise. The upload is cancelled if the body does not match, and when the upload holds no previous data, the request is rejected before its body is read if a digest contradicts the `digest` parameter.",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "string",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Required:    true,
+								Description: `Digest of uploaded blob.`,
+							},
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octet-stream",
+							Format:      "<binary data>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Upload Complete",
+								Description: "The upload has been completed and accepted by the registry. The canonical location will be available in the `Location` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<blob location>",
+										Description: "The canonical location of the blob for retrieval",
+									},
+									{
+										Name:        "Content-Range",
+										Type:        "header",
+										Format:      "<start of range>-<end of range, inclusive>",
+										Description: "Range of bytes identifying the desired block of content represented by the body. Start must match the end of offset retrieved via status check. Note that this is a non-standard use of the `Content-Range` header.",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Cancel outstanding upload processes, releasing associated resources. If this is not called, the unfinished uploads will eventually timeout.",
+				Requests: []RequestDescriptor{
+					{
+						Description: "Cancel the upload specified by `uuid`.",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Upload Deleted",
+								Description: "The upload has been successfully deleted.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "An error was encountered processing the delete. The client may ignore this error.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry. The client may ignore this error and assume the upload has been deleted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameCatalog,
+		Path:        "/v2/_catalog",
+		Entity:      "Catalog",
+		Description: "List a set of available repositories in the local registry cluster. Does not provide any indication of what may be available upstream. Applications can only determine if a repository is available but not if it is not available.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve a sorted, json list of repositories available in the registry.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Catalog Fetch",
+						Description: "Request an unabridged list of repositories available.  The implementation may impose a maximum limit and return a partial set with pagination links.",
+						Successes: []ResponseDescriptor{
+							{
+								Description: "Returns the unabridged list of repositories as a json response.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	]
+}`,
+								},
+							},
+						},
+					},
+					{
+						Name:            "Catalog Fetch Paginated",
+						Description:     "Return the specified portion of repositories.",
+						QueryParameters: paginationParameters,
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	]
+	"next": "<url>?last=<name>&n=<last value of n>"
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameFeatures,
+		Path:        "/v2/_features",
+		Entity:      "Features",
+		Description: "Report the optional capabilities enabled on the registry, so that clients can adapt without probing for them.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the API version and the optional features of the registry. Each feature is reported as enabled or not; features unknown to the client should be ignored. Access requires the same privileges as the base route.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The features of the registry.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "apiVersion": "registry/2.0",
+    "features": {
+        "delete": <true|false>,
+        "readOnly": <true|false>,
+        "pullThroughCache": <true|false>,
+        "referrers": <true|false>,
+        ...
+    }
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameNamespaceCatalog,
+		Path:        "/v2/_namespaces/{namespace:" + reference.NameRegexp.String() + "}/_catalog",
+		Entity:      "Namespace Catalog",
+		Description: "List the repositories of a namespace, the repositories whose name starts with the namespace followed by a slash.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve a sorted, json list of the repositories in the namespace. Access requires the same privileges as the catalog.",
+				Requests: []RequestDescriptor{
+					{
+						Name:            "Namespace Catalog Fetch",
+						Description:     "Return the repositories of the namespace, optionally paginated in the same manner as the catalog.",
+						PathParameters:  []ParameterDescriptor{namespaceParameterDescriptor},
+						QueryParameters: paginationParameters,
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"namespace": <namespace>,
+	"repositories": [
+		<name>,
+		...
+	]
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameNamespaceUsage,
+		Path:        "/v2/_namespaces/{namespace:" + reference.NameRegexp.String() + "}/_usage",
+		Entity:      "Namespace Usage",
+		Description: "Retrieve the storage used by the repositories of a namespace and the quota configured for it.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the number of repositories, the number of distinct blobs and their total size in bytes for the namespace. Blobs shared by several repositories are counted once. The usage may be cached by the registry for the configured period. Access requires the same privileges as the catalog.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{namespaceParameterDescriptor},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The usage of the namespace. The quota is only present if one is configured.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "namespace": <namespace>,
+    "repositories": <repositories>,
+    "blobs": <blobs>,
+    "size": <bytes>,
+    "quota": {
+        "repositories": <repositories>,
+        "size": <bytes>
+    }
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Not allowed",
+								Description: "Namespace usage is not available on this registry, for example when it is a pull through cache.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameWatch,
+		Path:        "/v2/_watch",
+		Entity:      "Watch",
+		Description: "Wait for changes to the repositories and tags of the registry: manifests pushed, with the tag they were pushed by, and tags, manifests and repositories deleted. The registry keeps a bounded number of the most recent changes in memory, and each instance only reports the changes it served, so watching is only supported when a client always reaches the same instance.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Long-poll the changes following a cursor. The response is sent as soon as changes are available, or once `wait` has elapsed without changes. Access requires the same privileges as the catalog.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Watch",
+						Description: "Return the changes made after `cursor`, oldest first. The `cursor` of the response is passed to the next request to receive the following changes.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "cursor",
+								Type:        "integer",
+								Description: "Cursor returned by the previous response. If not present, only changes made after the request are returned.",
+								Format:      "<integer>",
+							},
+							{
+								Name:        "namespace",
+								Type:        "string",
+								Description: "Only return the changes of the named repository and of the repositories of the namespace.",
+								Format:      reference.NameRegexp.String(),
+							},
+							{
+								Name:        "n",
+								Type:        "integer",
+								Description: "Limit the number of changes in the response.",
+								Format:      "<integer>",
+							},
+							{
+								Name:        "wait",
+								Type:        "integer",
+								Description: "Number of seconds to wait for changes, 30 by default and 50 at most. Zero returns immediately.",
+								Format:      "<integer>",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The changes following the cursor, possibly none. `missed` is true if changes following the cursor are no longer kept, or the cursor was issued before the registry restarted: the state of the watched repositories should then be listed again.",
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "cursor": <cursor>,
+    "missed": <true|false>,
+    "events": [
+        {
+            "id": <id>,
+            "time": <time>,
+            "action": "push" | "delete",
+            "repository": <name>,
+            "tag": <tag>,
+            "digest": <digest>,
+            "mediaType": <media type>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Parameter",
+								Description: "The cursor, number of changes or wait duration is invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodePaginationNumberInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameHelmIndex,
+		Path:        "/v2/_helm/{namespace:" + reference.NameRegexp.String() + "}/index.yaml",
+		Entity:      "Helm Index",
+		Description: "Serve the charts stored as OCI artifacts in the repositories of a namespace as a Helm chart repository, for Helm clients that cannot pull charts from registries. A chart is stored in the repository named after it, tagged with its version.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the index of the chart repository. Every tag of the repositories of the namespace is read, so the index of a large namespace is slow to build. Access requires the same privileges as the catalog.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{namespaceParameterDescriptor},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The index of the charts, in the format of Helm chart repositories. Tags of other artifacts are left out.",
+								Body: BodyDescriptor{
+									ContentType: "application/x-yaml",
+									Format: `apiVersion: v1
+entries:
+  <chart>:
+  - <chart metadata>
+    digest: <hex digest of the chart archive>
+    urls:
+    - <chart url>
+  ...
+generated: <time>`,
+								},
+							},
+						},
+						Failures: helmFailures,
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameHelmChart,
+		Path:        "/v2/_helm/{namespace:" + reference.NameRegexp.String() + "}/charts/{file:[^/]+\\.tgz}",
+		Entity:      "Helm Chart",
+		Description: "Download a chart of the Helm chart repository of a namespace.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the archive of a chart version, named `<chart>-<version>.tgz` as linked from the index. A `HEAD` request can also be issued to this endpoint. Access requires the same privileges as the catalog.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{namespaceParameterDescriptor},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The chart archive.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the chart archive.",
+										Format:      "<length>",
+									},
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<chart archive>",
+								},
+							},
+						},
+						Failures: append([]ResponseDescriptor{
+							{
+								Name:        "Unknown Chart",
+								Description: "No chart version of the namespace is stored under this name.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+							},
+						}, helmFailures...),
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAdminBlob,
+		Path:        "/v2/_admin/blobs/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Admin Blob",
+		Description: "Fetch any blob stored by the registry by its digest, regardless of the repositories it is linked into. Intended for debugging and for tools aware of the deduplication of blobs across repositories.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the blob identified by `digest`. A `HEAD` request can also be issued to this endpoint to check whether the blob is stored, and its size. Range requests are supported as for blobs of a repository. Access requires the `registry:blobs:*` scope.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							digestPathParameter,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob identified by `digest` is stored. The blob content will be present in the body of the request.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested blob content.",
+										Format:      "<length>",
+									},
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
+								},
+							},
 							{
-								Name:        "Chunk Accepted",
-								Description: "The chunk of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
-								StatusCode:  http.StatusNoContent,
+								Description: "The blob identified by `digest` is available at the provided location.",
+								StatusCode:  http.StatusTemporaryRedirect,
 								Headers: []ParameterDescriptor{
 									{
 										Name:        "Location",
 										Type:        "url",
-										Format:      "/v2/<name>/blobs/uploads/<uuid>",
-										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
-									},
-									{
-										Name:        "Range",
-										Type:        "header",
-										Format:      "0-<offset>",
-										Description: "Range indicating the current progress of the upload.",
+										Description: "The location where the blob should be accessible.",
+										Format:      "<blob location>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+									digestHeader,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
+								Description: "The digest was invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeDigestInvalid,
-									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
@@ -1341,10 +2789,10 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								Description: "The blob identified by `digest` is not stored by the registry.",
 								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
+									ErrorCodeBlobUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
@@ -1352,83 +2800,74 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The `Content-Range` specification cannot be accepted, either because it does not overlap with the current progress or it is invalid.",
-								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
+								Name:        "Not allowed",
+								Description: "Fetching blobs regardless of repositories is not available on this registry, for example when it is a pull through cache.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
 							},
 							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameAdminBlobReferences,
+		Path:        "/v2/_admin/blobs/{digest:" + digest.DigestRegexp.String() + "}/references",
+		Entity:      "Admin Blob References",
+		Description: "List the manifests referencing a blob across the repositories of the registry, from an index maintained as manifests are pushed and deleted. Intended to assess the impact of deleting a blob.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "PUT",
-				Description: "Complete the upload specified by `uuid`, optionally appending the body as the final chunk.",
+				Method:      "GET",
+				Description: "Retrieve the manifests referencing the blob identified by `digest` as a layer, a config or a child manifest, with the tags referencing each of them. Only manifests pushed while the index is enabled are listed. Access requires the `registry:blobs:*` scope.",
 				Requests: []RequestDescriptor{
 					{
-						Description: "Complete the upload, providing all the data in the body, if necessary. A request without a body will just complete the upload with previously uploaded content.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							{
-								Name:        "Content-Length",
-								Type:        "integer",
-								Format:      "<length of data>",
-								Description: "Length of the data being uploaded, corresponding to the length of the request body. May be zero if no data is provided.",
-							},
 						},
 						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							uuidParameterDescriptor,
-						},
-						QueryParameters: []ParameterDescriptor{
-							{
-								Name:        "digest",
-								Type:        "string",
-								Format:      "<digest>",
-								Regexp:      digest.DigestRegexp,
-								Required:    true,
-								Description: `Digest of uploaded blob.`,
-							},
-						},
-						Body: BodyDescriptor{
-							ContentType: "application/octet-stream",
-							Format:      "<binary data>",
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Upload Complete",
-								Description: "The upload has been completed and accepted by the registry. The canonical location will be available in the `Location` header.",
-								StatusCode:  http.StatusNoContent,
+								StatusCode:  http.StatusOK,
+								Description: "The manifests referencing the blob, sorted by repository. The list is empty if no indexed manifest references the blob.",
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Format:      "<blob location>",
-										Description: "The canonical location of the blob for retrieval",
-									},
-									{
-										Name:        "Content-Range",
-										Type:        "header",
-										Format:      "<start of range>-<end of range, inclusive>",
-										Description: "Range of bytes identifying the desired block of content represented by the body. Start must match the end of offset retrieved via status check. Note that this is a non-standard use of the `Content-Range` header.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									contentLengthZeroHeader,
-									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "digest": <digest>,
+    "references": [
+        {
+            "repository": <name>,
+            "manifest": <digest>,
+            "tags": [<tag>, ...]
+        },
+        ...
+    ]
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
+								Description: "The digest was invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeDigestInvalid,
-									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
-									errcode.ErrorCodeUnsupported,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
@@ -1436,147 +2875,224 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
-								StatusCode:  http.StatusNotFound,
+								Name:        "Not allowed",
+								Description: "The reference index is not maintained by this registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
+									errcode.ErrorCodeUnsupported,
 								},
 							},
 							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameAdminBans,
+		Path:        "/v2/_admin/bans",
+		Entity:      "Admin Bans",
+		Description: "Manage the bans of the registry instance. Bans are held in memory by the instance serving the request, and are not shared with other instances. Requests from banned client addresses, users or token subjects are denied before authentication. Access requires the `registry:bans:*` scope.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "DELETE",
-				Description: "Cancel outstanding upload processes, releasing associated resources. If this is not called, the unfinished uploads will eventually timeout.",
+				Method:      "GET",
+				Description: "List the bans in effect.",
 				Requests: []RequestDescriptor{
 					{
-						Description: "Cancel the upload specified by `uuid`.",
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							uuidParameterDescriptor,
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The bans in effect, in no particular order.",
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "bans": [
+        {
+            "kind": "cidr" | "user" | "subject",
+            "value": <value>,
+            "reason": <reason>,
+            "expires": <time>
+        },
+        ...
+    ]
+}`,
+								},
+							},
 						},
+						Failures: adminBansFailures,
+					},
+				},
+			},
+			{
+				Method:      "POST",
+				Description: "Ban a client address range, a user authenticated with a password or the subject of bearer tokens for a while. Banning a value already banned replaces its ban.",
+				Requests: []RequestDescriptor{
+					{
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							contentLengthZeroHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+    "kind": "cidr" | "user" | "subject",
+    "value": <CIDR, IP address, user name or token subject>,
+    "reason": <reason>,
+    "ttl": <duration>
+}`,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Upload Deleted",
-								Description: "The upload has been successfully deleted.",
-								StatusCode:  http.StatusNoContent,
-								Headers: []ParameterDescriptor{
-									contentLengthZeroHeader,
+								StatusCode:  http.StatusCreated,
+								Description: "The ban is in effect until it expires. The `ttl` defaults to the one configured for the registry.",
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "kind": "cidr" | "user" | "subject",
+    "value": <value>,
+    "reason": <reason>,
+    "expires": <time>
+}`,
 								},
 							},
 						},
-						Failures: []ResponseDescriptor{
+						Failures: append([]ResponseDescriptor{
 							{
-								Description: "An error was encountered processing the delete. The client may ignore this error.",
+								Name:        "Invalid ban",
+								Description: "The kind, value or ttl of the ban is invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
+									ErrorCodeBanInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
 									Format:      errorsBody,
 								},
 							},
+						}, adminBansFailures...),
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Lift a ban before it expires.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "kind",
+								Type:        "string",
+								Description: "The kind of the ban: `cidr`, `user` or `subject`.",
+								Format:      "<kind>",
+								Required:    true,
+							},
 							{
-								Description: "The upload is unknown to the registry. The client may ignore this error and assume the upload has been deleted.",
+								Name:        "value",
+								Type:        "string",
+								Description: "The banned value, as listed.",
+								Format:      "<value>",
+								Required:    true,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusAccepted,
+								Description: "The ban was lifted.",
+							},
+						},
+						Failures: append([]ResponseDescriptor{
+							{
+								Name:        "Unknown ban",
+								Description: "No such ban is in effect.",
 								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
+									ErrorCodeBanUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
 									Format:      errorsBody,
 								},
 							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
-							tooManyRequestsDescriptor,
-						},
+						}, adminBansFailures...),
 					},
 				},
 			},
 		},
 	},
 	{
-		Name:        RouteNameCatalog,
-		Path:        "/v2/_catalog",
-		Entity:      "Catalog",
-		Description: "List a set of available repositories in the local registry cluster. Does not provide any indication of what may be available upstream. Applications can only determine if a repository is available but not if it is not available.",
+		Name:        RouteNameAdminIntrospect,
+		Path:        "/v2/_admin/introspect",
+		Entity:      "Admin Introspect",
+		Description: "Verify the bearer tokens accepted by the token authentication of the registry, in the manner of OAuth 2.0 token introspection (RFC 7662), so that other services can check them without the trusted keys of the registry. Access requires the `registry:introspect:*` scope.",
 		Methods: []MethodDescriptor{
 			{
-				Method:      "GET",
-				Description: "Retrieve a sorted, json list of repositories available in the registry.",
+				Method:      "POST",
+				Description: "Report whether a token is accepted and what it grants. The token is verified against the token authentication of the tenant owning `namespace`, or of the registry if no tenant owns it or it is not set.",
 				Requests: []RequestDescriptor{
 					{
-						Name:        "Catalog Fetch",
-						Description: "Request an unabridged list of repositories available.  The implementation may impose a maximum limit and return a partial set with pagination links.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/x-www-form-urlencoded",
+							Format:      "token=<token>&namespace=<namespace>",
+						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "Returns the unabridged list of repositories as a json response.",
 								StatusCode:  http.StatusOK,
-								Headers: []ParameterDescriptor{
-									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "Length of the JSON response body.",
-										Format:      "<length>",
-									},
-								},
+								Description: "The introspection of the token. Tokens which are not accepted are only reported inactive.",
 								Body: BodyDescriptor{
 									ContentType: "application/json",
 									Format: `{
-	"repositories": [
-		<name>,
-		...
-	]
+    "active": <true if the token is accepted>,
+    "scope": <space separated scopes>,
+    "sub": <subject>,
+    "aud": <audience>,
+    "iss": <issuer>,
+    "exp": <expiry, in seconds since the epoch>,
+    "iat": <issue time, in seconds since the epoch>,
+    "nbf": <earliest use, in seconds since the epoch>,
+    "jti": <token identifier>
 }`,
 								},
 							},
 						},
-					},
-					{
-						Name:            "Catalog Fetch Paginated",
-						Description:     "Return the specified portion of repositories.",
-						QueryParameters: paginationParameters,
-						Successes: []ResponseDescriptor{
+						Failures: []ResponseDescriptor{
 							{
-								StatusCode: http.StatusOK,
+								Name:        "Invalid request",
+								Description: "The token is missing or the namespace is invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeIntrospectionInvalid,
+								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
-									Format: `{
-	"repositories": [
-		<name>,
-		...
-	]
-	"next": "<url>?last=<name>&n=<last value of n>"
-}`,
+									Format:      errorsBody,
 								},
-								Headers: []ParameterDescriptor{
-									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "Length of the JSON response body.",
-										Format:      "<length>",
-									},
-									linkHeader,
+							},
+							{
+								Name:        "Not allowed",
+								Description: "The registry, or the tenant owning the namespace, does not use token authentication.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
 								},
 							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
 						},
 					},
 				},
@@ -125,6 +125,70 @@ var (
 		HTTPStatusCode: http.StatusNotFound,
 	})
 
+	// ErrorCodePaginationNumberInvalid is returned when the `n` parameter is
+	// not an integer, or `n` is negative.
+	ErrorCodePaginationNumberInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "PAGINATION_NUMBER_INVALID",
+		Message: "invalid number of results requested",
+		Description: `Returned when the "n" parameter (number of results
+		to return) is not an integer, or "n" is negative.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeTagOrderInvalid is returned when the `order` parameter of a
+	// tag listing is not a supported order.
+	ErrorCodeTagOrderInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TAG_ORDER_INVALID",
+		Message: "invalid tag order requested",
+		Description: `Returned when the "order" parameter of a tag listing
+		is neither "lexical" nor "created".`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeMetadataInvalid is returned when the metadata document of a
+	// repository is invalid.
+	ErrorCodeMetadataInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "METADATA_INVALID",
+		Message: "repository metadata invalid",
+		Description: `Returned when the repository metadata document is not
+		valid json, exceeds the maximum size or has an empty label key.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodePlatformInvalid is returned when the `platform` parameter of
+	// a manifest fetch is not of the form os/architecture[/variant].
+	ErrorCodePlatformInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "PLATFORM_INVALID",
+		Message: "invalid platform requested",
+		Description: `Returned when the "platform" parameter of a manifest
+		fetch is not of the form "os/architecture" or
+		"os/architecture/variant".`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeManifestTooLarge is returned when a manifest payload exceeds
+	// the size accepted by the registry.
+	ErrorCodeManifestTooLarge = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "MANIFEST_TOO_LARGE",
+		Message: "manifest too large",
+		Description: `Returned when a manifest payload is larger than the
+		registry accepts. The payload is rejected as soon as the limit is
+		reached, or before it is read if its declared length exceeds it.`,
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+	})
+
+	// ErrorCodeManifestSchema1Disabled is returned when a schema1 manifest
+	// is pushed or pulled while schema1 is disabled.
+	ErrorCodeManifestSchema1Disabled = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "MANIFEST_SCHEMA1_DISABLED",
+		Message: "schema1 manifests are disabled on this registry",
+		Description: `Returned when a schema1 manifest is pushed or pulled,
+		or a client not accepting schema2 manifests pulls a tag, while
+		schema1 is disabled. The client must push and pull schema2 or OCI
+		manifests instead.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
 	// ErrorCodeBlobUploadInvalid is returned when an upload is invalid.
 	ErrorCodeBlobUploadInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "BLOB_UPLOAD_INVALID",
@@ -133,4 +197,79 @@ var (
 		longer proceed.`,
 		HTTPStatusCode: http.StatusNotFound,
 	})
+
+	// ErrorCodeRangeInvalid is returned when the Content-Range of a chunk
+	// does not continue the upload.
+	ErrorCodeRangeInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "RANGE_INVALID",
+		Message: "invalid content range",
+		Description: `When a chunk is uploaded with a Content-Range, the
+		range must be valid and start at the current offset of the upload,
+		as reported by the Range header of the previous response. The Range
+		header of the error response holds the current progress of the
+		upload, which the client resumes from.`,
+		HTTPStatusCode: http.StatusRequestedRangeNotSatisfiable,
+	})
+
+	// ErrorCodeStorageThrottled is returned when the storage backend
+	// throttles the requests of the registry.
+	ErrorCodeStorageThrottled = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "STORAGE_THROTTLED",
+		Message: "storage backend throttled",
+		Description: `Returned when the storage backend rejects the requests
+		of the registry because of their rate. The request may be retried
+		later.`,
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	})
+
+	// ErrorCodeStorageUnavailable is returned when the storage backend
+	// fails or cannot be reached.
+	ErrorCodeStorageUnavailable = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "STORAGE_UNAVAILABLE",
+		Message: "storage backend unavailable",
+		Description: `Returned when the storage backend fails or cannot be
+		reached. The request may be retried later.`,
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	})
+
+	// ErrorCodeStorageAuthFailed is returned when the storage backend
+	// rejects the credentials of the registry.
+	ErrorCodeStorageAuthFailed = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "STORAGE_AUTH_FAILED",
+		Message: "storage backend authentication failed",
+		Description: `Returned when the storage backend rejects the
+		credentials of the registry, or does not grant them access. The
+		registry is misconfigured, and retrying does not help.`,
+		HTTPStatusCode: http.StatusInternalServerError,
+	})
+
+	// ErrorCodeBanInvalid is returned when a ban added through the admin
+	// API is invalid.
+	ErrorCodeBanInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BAN_INVALID",
+		Message: "invalid ban",
+		Description: `Returned when the kind, value or ttl of a ban added
+		through the admin API is invalid.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeBanUnknown is returned when a ban lifted through the admin
+	// API is not in effect.
+	ErrorCodeBanUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BAN_UNKNOWN",
+		Message: "ban unknown",
+		Description: `Returned when a ban lifted through the admin API is
+		not in effect, for example because it expired.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeIntrospectionInvalid is returned when a token introspection
+	// request is invalid.
+	ErrorCodeIntrospectionInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "INTROSPECTION_INVALID",
+		Message: "invalid introspection request",
+		Description: `Returned when a token introspection request has no
+		token, or an invalid namespace.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
 )
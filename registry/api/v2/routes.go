@@ -1,17 +1,40 @@
 package v2
 
-import "github.com/gorilla/mux"
+import (
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/gorilla/mux"
+)
 
 // The following are definitions of the name under which all V2 routes are
 // registered. These symbols can be used to look up a route based on the name.
 const (
-	RouteNameBase            = "base"
-	RouteNameManifest        = "manifest"
-	RouteNameTags            = "tags"
-	RouteNameBlob            = "blob"
-	RouteNameBlobUpload      = "blob-upload"
-	RouteNameBlobUploadChunk = "blob-upload-chunk"
-	RouteNameCatalog         = "catalog"
+	RouteNameBase                = "base"
+	RouteNameManifest            = "manifest"
+	RouteNameTags                = "tags"
+	RouteNameBlob                = "blob"
+	RouteNameBlobUpload          = "blob-upload"
+	RouteNameBlobUploadChunk     = "blob-upload-chunk"
+	RouteNameCatalog             = "catalog"
+	RouteNameFeatures            = "features"
+	RouteNameStatistics          = "statistics"
+	RouteNameMetadata            = "metadata"
+	RouteNameEvents              = "events"
+	RouteNameSignatures          = "signatures"
+	RouteNameLayerSharing        = "layer-sharing"
+	RouteNamePullSize            = "pull-size"
+	RouteNameScanReport          = "scan-report"
+	RouteNameNamespaceCatalog    = "namespace-catalog"
+	RouteNameNamespaceUsage      = "namespace-usage"
+	RouteNameHelmIndex           = "helm-index"
+	RouteNameHelmChart           = "helm-chart"
+	RouteNameAdminBlob           = "admin-blob"
+	RouteNameAdminBlobReferences = "admin-blob-references"
+	RouteNameAdminBans           = "admin-bans"
+	RouteNameAdminIntrospect     = "admin-introspect"
+	RouteNameWatch               = "watch"
 )
 
 // Router builds a gorilla router with named routes for the various API
@@ -24,6 +47,13 @@ func Router() *mux.Router {
 // RouterWithPrefix builds a gorilla router with a configured prefix
 // on all routes.
 func RouterWithPrefix(prefix string) *mux.Router {
+	return RouterWithNameRegexp(prefix, reference.NameRegexp)
+}
+
+// RouterWithNameRegexp builds a gorilla router with a configured prefix on
+// all routes, matching repository and namespace names with nameRegexp rather
+// than reference.NameRegexp.
+func RouterWithNameRegexp(prefix string, nameRegexp *regexp.Regexp) *mux.Router {
 	rootRouter := mux.NewRouter()
 	router := rootRouter
 	if prefix != "" {
@@ -32,8 +62,12 @@ func RouterWithPrefix(prefix string) *mux.Router {
 
 	router.StrictSlash(true)
 
+	replacer := strings.NewReplacer(
+		"{name:"+reference.NameRegexp.String()+"}", "{name:"+nameRegexp.String()+"}",
+		"{namespace:"+reference.NameRegexp.String()+"}", "{namespace:"+nameRegexp.String()+"}",
+	)
 	for _, descriptor := range routeDescriptors {
-		router.Path(descriptor.Path).Name(descriptor.Name)
+		router.Path(replacer.Replace(descriptor.Path)).Name(descriptor.Name)
 	}
 
 	return rootRouter
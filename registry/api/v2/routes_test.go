@@ -87,6 +87,122 @@ func TestRouter(t *testing.T) {
 				"name": "docker.com/foo/bar/baz",
 			},
 		},
+		{
+			RouteName:  RouteNameStatistics,
+			RequestURI: "/v2/foo/bar/_stats",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameMetadata,
+			RequestURI: "/v2/foo/bar/_metadata",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameEvents,
+			RequestURI: "/v2/foo/bar/_events",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameSignatures,
+			RequestURI: "/v2/foo/bar/_signatures/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameLayerSharing,
+			RequestURI: "/v2/foo/bar/_sharing/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNamePullSize,
+			RequestURI: "/v2/foo/bar/_size/latest",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "latest",
+			},
+		},
+		{
+			RouteName:  RouteNameScanReport,
+			RequestURI: "/v2/foo/bar/_scan/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameFeatures,
+			RequestURI: "/v2/_features",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameNamespaceCatalog,
+			RequestURI: "/v2/_namespaces/foo/bar/_catalog",
+			Vars: map[string]string{
+				"namespace": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameNamespaceUsage,
+			RequestURI: "/v2/_namespaces/foo/_usage",
+			Vars: map[string]string{
+				"namespace": "foo",
+			},
+		},
+		{
+			RouteName:  RouteNameHelmIndex,
+			RequestURI: "/v2/_helm/foo/charts/index.yaml",
+			Vars: map[string]string{
+				"namespace": "foo/charts",
+			},
+		},
+		{
+			RouteName:  RouteNameHelmChart,
+			RequestURI: "/v2/_helm/foo/charts/my-chart-1.0.0-rc.1.tgz",
+			Vars: map[string]string{
+				"namespace": "foo",
+				"file":      "my-chart-1.0.0-rc.1.tgz",
+			},
+		},
+		{
+			RouteName:  RouteNameAdminBlob,
+			RequestURI: "/v2/_admin/blobs/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameAdminBlobReferences,
+			RequestURI: "/v2/_admin/blobs/sha256:abcdef0919234/references",
+			Vars: map[string]string{
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameAdminBans,
+			RequestURI: "/v2/_admin/bans",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameAdminIntrospect,
+			RequestURI: "/v2/_admin/introspect",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameWatch,
+			RequestURI: "/v2/_watch",
+			Vars:       map[string]string{},
+		},
 		{
 			RouteName:  RouteNameBlob,
 			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234",
@@ -8,6 +8,7 @@ import (
 
 	"github.com/docker/distribution/reference"
 	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
 )
 
 // URLBuilder creates registry API urls from a single base endpoint. It can be
@@ -32,6 +33,13 @@ func NewURLBuilder(root *url.URL, relative bool) *URLBuilder {
 	}
 }
 
+// WithRouter makes the builder build URLs with the routes of router, such as
+// one returned by RouterWithNameRegexp, and returns the builder.
+func (ub *URLBuilder) WithRouter(router *mux.Router) *URLBuilder {
+	ub.router = router
+	return ub
+}
+
 // NewURLBuilderFromString workes identically to NewURLBuilder except it takes
 // a string argument for the root, returning an error if it is not a valid
 // url.
@@ -139,6 +147,236 @@ func (ub *URLBuilder) BuildTagsURL(name reference.Named) (string, error) {
 	return tagsURL.String(), nil
 }
 
+// BuildStatisticsURL constructs a url to retrieve the pull statistics of the
+// given repository.
+func (ub *URLBuilder) BuildStatisticsURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameStatistics)
+
+	statisticsURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return statisticsURL.String(), nil
+}
+
+// BuildMetadataURL constructs a url to retrieve or update the metadata of the
+// given repository.
+func (ub *URLBuilder) BuildMetadataURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameMetadata)
+
+	metadataURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return metadataURL.String(), nil
+}
+
+// BuildEventsURL constructs a url to list the events of the given repository.
+func (ub *URLBuilder) BuildEventsURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameEvents)
+
+	eventsURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(eventsURL, values...).String(), nil
+}
+
+// BuildSignaturesURL constructs a url to list the signatures of the manifest
+// identified by the canonical reference.
+func (ub *URLBuilder) BuildSignaturesURL(ref reference.Canonical) (string, error) {
+	route := ub.cloneRoute(RouteNameSignatures)
+
+	signaturesURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return signaturesURL.String(), nil
+}
+
+// BuildLayerSharingURL constructs a url to retrieve the sharing of the layers
+// of the image manifest identified by the canonical reference.
+func (ub *URLBuilder) BuildLayerSharingURL(ref reference.Canonical) (string, error) {
+	route := ub.cloneRoute(RouteNameLayerSharing)
+
+	sharingURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return sharingURL.String(), nil
+}
+
+// BuildPullSizeURL constructs a url to retrieve the size of pulling the
+// manifest identified by the tagged or digested reference, appending any
+// query values, such as the platform to select.
+func (ub *URLBuilder) BuildPullSizeURL(ref reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNamePullSize)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	sizeURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(sizeURL, values...).String(), nil
+}
+
+// BuildScanReportURL constructs a url to retrieve the vulnerability scan
+// report of the manifest identified by the canonical reference.
+func (ub *URLBuilder) BuildScanReportURL(ref reference.Canonical) (string, error) {
+	route := ub.cloneRoute(RouteNameScanReport)
+
+	reportURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return reportURL.String(), nil
+}
+
+// BuildNamespaceCatalogURL constructs a url to list the repositories of the
+// given namespace.
+func (ub *URLBuilder) BuildNamespaceCatalogURL(namespace string, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameNamespaceCatalog)
+
+	catalogURL, err := route.URL("namespace", namespace)
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(catalogURL, values...).String(), nil
+}
+
+// BuildWatchURL constructs a url to wait for the changes to the repositories
+// and tags of the registry.
+func (ub *URLBuilder) BuildWatchURL(values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameWatch)
+
+	watchURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(watchURL, values...).String(), nil
+}
+
+// BuildNamespaceUsageURL constructs a url to retrieve the usage of the given
+// namespace.
+func (ub *URLBuilder) BuildNamespaceUsageURL(namespace string) (string, error) {
+	route := ub.cloneRoute(RouteNameNamespaceUsage)
+
+	usageURL, err := route.URL("namespace", namespace)
+	if err != nil {
+		return "", err
+	}
+
+	return usageURL.String(), nil
+}
+
+// BuildHelmIndexURL constructs a url to fetch the Helm chart repository index
+// of the given namespace.
+func (ub *URLBuilder) BuildHelmIndexURL(namespace string) (string, error) {
+	route := ub.cloneRoute(RouteNameHelmIndex)
+
+	indexURL, err := route.URL("namespace", namespace)
+	if err != nil {
+		return "", err
+	}
+
+	return indexURL.String(), nil
+}
+
+// BuildHelmChartURL constructs a url to download the version of the chart
+// stored in the repository namespace/chart, tagged with version.
+func (ub *URLBuilder) BuildHelmChartURL(namespace, chart, version string) (string, error) {
+	route := ub.cloneRoute(RouteNameHelmChart)
+
+	chartURL, err := route.URL("namespace", namespace, "file", chart+"-"+version+".tgz")
+	if err != nil {
+		return "", err
+	}
+
+	return chartURL.String(), nil
+}
+
+// BuildAdminBlobURL constructs a url to fetch the blob with the given digest
+// regardless of the repositories it is linked into.
+func (ub *URLBuilder) BuildAdminBlobURL(dgst digest.Digest) (string, error) {
+	route := ub.cloneRoute(RouteNameAdminBlob)
+
+	blobURL, err := route.URL("digest", dgst.String())
+	if err != nil {
+		return "", err
+	}
+
+	return blobURL.String(), nil
+}
+
+// BuildAdminBlobReferencesURL constructs a url to list the manifests
+// referencing the blob with the given digest.
+func (ub *URLBuilder) BuildAdminBlobReferencesURL(dgst digest.Digest) (string, error) {
+	route := ub.cloneRoute(RouteNameAdminBlobReferences)
+
+	referencesURL, err := route.URL("digest", dgst.String())
+	if err != nil {
+		return "", err
+	}
+
+	return referencesURL.String(), nil
+}
+
+// BuildAdminBansURL constructs a url to manage the bans of the registry.
+func (ub *URLBuilder) BuildAdminBansURL(values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameAdminBans)
+
+	bansURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(bansURL, values...).String(), nil
+}
+
+// BuildAdminIntrospectURL constructs a url to introspect the tokens
+// accepted by the registry.
+func (ub *URLBuilder) BuildAdminIntrospectURL() (string, error) {
+	route := ub.cloneRoute(RouteNameAdminIntrospect)
+
+	introspectURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return introspectURL.String(), nil
+}
+
+// BuildFeaturesURL constructs a url to retrieve the features of the
+// registry.
+func (ub *URLBuilder) BuildFeaturesURL() (string, error) {
+	route := ub.cloneRoute(RouteNameFeatures)
+
+	featuresURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return featuresURL.String(), nil
+}
+
 // BuildManifestURL constructs a url for the manifest identified by name and
 // reference. The argument reference may be either a tag or digest.
 func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
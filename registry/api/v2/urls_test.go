@@ -34,6 +34,144 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildTagsURL(fooBarRef)
 			},
 		},
+		{
+			description:  "test statistics url",
+			expectedPath: "/v2/foo/bar/_stats",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildStatisticsURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test metadata url",
+			expectedPath: "/v2/foo/bar/_metadata",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildMetadataURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test events url",
+			expectedPath: "/v2/foo/bar/_events?last=42&n=10",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildEventsURL(fooBarRef, url.Values{"n": []string{"10"}, "last": []string{"42"}})
+			},
+		},
+		{
+			description:  "test signatures url",
+			expectedPath: "/v2/foo/bar/_signatures/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildSignaturesURL(ref)
+			},
+		},
+		{
+			description:  "test layer sharing url",
+			expectedPath: "/v2/foo/bar/_sharing/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildLayerSharingURL(ref)
+			},
+		},
+		{
+			description:  "test pull size url",
+			expectedPath: "/v2/foo/bar/_size/tag?platform=linux%2Farm64",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildPullSizeURL(ref, url.Values{"platform": []string{"linux/arm64"}})
+			},
+		},
+		{
+			description:  "test scan report url",
+			expectedPath: "/v2/foo/bar/_scan/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildScanReportURL(ref)
+			},
+		},
+		{
+			description:  "test features url",
+			expectedPath: "/v2/_features",
+			expectedErr:  nil,
+			build:        urlBuilder.BuildFeaturesURL,
+		},
+		{
+			description:  "test namespace catalog url",
+			expectedPath: "/v2/_namespaces/foo/_catalog",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildNamespaceCatalogURL("foo")
+			},
+		},
+		{
+			description:  "test namespace usage url",
+			expectedPath: "/v2/_namespaces/foo/bar/_usage",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildNamespaceUsageURL("foo/bar")
+			},
+		},
+		{
+			description:  "test watch url",
+			expectedPath: "/v2/_watch?cursor=42&namespace=foo",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildWatchURL(url.Values{"cursor": []string{"42"}, "namespace": []string{"foo"}})
+			},
+		},
+		{
+			description:  "test helm index url",
+			expectedPath: "/v2/_helm/foo/bar/index.yaml",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildHelmIndexURL("foo/bar")
+			},
+		},
+		{
+			description:  "test helm chart url",
+			expectedPath: "/v2/_helm/foo/bar/charts/baz-1.0.0.tgz",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildHelmChartURL("foo/bar", "baz", "1.0.0")
+			},
+		},
+		{
+			description:  "test admin blob url",
+			expectedPath: "/v2/_admin/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildAdminBlobURL("sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+			},
+		},
+		{
+			description:  "test admin blob references url",
+			expectedPath: "/v2/_admin/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5/references",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildAdminBlobReferencesURL("sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+			},
+		},
+		{
+			description:  "test admin bans url",
+			expectedPath: "/v2/_admin/bans",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildAdminBansURL()
+			},
+		},
+		{
+			description:  "test admin introspect url",
+			expectedPath: "/v2/_admin/introspect",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildAdminIntrospectURL()
+			},
+		},
 		{
 			description:  "test manifest url tagged ref",
 			expectedPath: "/v2/foo/bar/manifests/tag",
@@ -90,6 +90,22 @@ type Challenge interface {
 	SetHeaders(r *http.Request, w http.ResponseWriter)
 }
 
+// AccessDenied is returned by access controllers for requests whose
+// credentials are valid, but which are denied access regardless of the
+// credentials presented, so that challenging the client would not help. It is
+// answered with a 403 Forbidden, detailing the reason.
+type AccessDenied struct {
+	// Access is the access which was denied.
+	Access []Access `json:"access"`
+
+	// Reason explains why access was denied.
+	Reason string `json:"reason"`
+}
+
+func (e AccessDenied) Error() string {
+	return fmt.Sprintf("access denied: %s", e.Reason)
+}
+
 // AccessController controls access to registry resources based on a request
 // and required access levels for a request. Implementations can support both
 // complete denial and http authorization challenges.
@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
 
 	dcontext "github.com/docker/distribution/context"
@@ -54,6 +55,17 @@ func (s accessSet) contains(access auth.Access) bool {
 	return false
 }
 
+// containsExact returns whether or not the given access is in this
+// accessSet, without accepting the "*" wildcard action in its place.
+func (s accessSet) containsExact(access auth.Access) bool {
+	actionSet, ok := s[access.Resource]
+	if ok {
+		return actionSet.stringSet.contains(access.Action)
+	}
+
+	return false
+}
+
 // scopeParam returns a collection of scopes which can
 // be used for a WWW-Authenticate challenge parameter.
 // See https://tools.ietf.org/html/rfc6750#section-3
@@ -127,12 +139,14 @@ func (ac authChallenge) SetHeaders(r *http.Request, w http.ResponseWriter) {
 
 // accessController implements the auth.AccessController interface.
 type accessController struct {
-	realm        string
-	autoRedirect bool
-	issuer       string
-	service      string
-	rootCerts    *x509.CertPool
-	trustedKeys  map[string]libtrust.PublicKey
+	realm          string
+	autoRedirect   bool
+	issuer         string
+	service        string
+	rootCerts      *x509.CertPool
+	trustedKeys    map[string]libtrust.PublicKey
+	exactScopes    bool
+	pushNamespaces []*regexp.Regexp
 }
 
 // tokenAccessOptions is a convenience type for handling
@@ -143,6 +157,8 @@ type tokenAccessOptions struct {
 	issuer         string
 	service        string
 	rootCertBundle string
+	exactScopes    bool
+	pushNamespaces []*regexp.Regexp
 }
 
 // checkOptions gathers the necessary options
@@ -171,6 +187,35 @@ func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 		opts.autoRedirect = autoRedirect
 	}
 
+	exactScopesVal, ok := options["exactscopes"]
+	if ok {
+		exactScopes, ok := exactScopesVal.(bool)
+		if !ok {
+			return opts, fmt.Errorf("token auth requires a valid option bool: exactscopes")
+		}
+		opts.exactScopes = exactScopes
+	}
+
+	pushNamespacesVal, ok := options["pushnamespaces"]
+	if ok {
+		patterns, ok := pushNamespacesVal.([]interface{})
+		if !ok {
+			return opts, fmt.Errorf("token auth requires a valid option list: pushnamespaces")
+		}
+		for _, pattern := range patterns {
+			pattern, ok := pattern.(string)
+			if !ok {
+				return opts, fmt.Errorf("token auth requires a valid option list of strings: pushnamespaces")
+			}
+			// patterns match whole repository names
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return opts, fmt.Errorf("token auth pushnamespaces: %v", err)
+			}
+			opts.pushNamespaces = append(opts.pushNamespaces, re)
+		}
+	}
+
 	return opts, nil
 }
 
@@ -223,12 +268,14 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 	}
 
 	return &accessController{
-		realm:        config.realm,
-		autoRedirect: config.autoRedirect,
-		issuer:       config.issuer,
-		service:      config.service,
-		rootCerts:    rootPool,
-		trustedKeys:  trustedKeys,
+		realm:          config.realm,
+		autoRedirect:   config.autoRedirect,
+		issuer:         config.issuer,
+		service:        config.service,
+		rootCerts:      rootPool,
+		trustedKeys:    trustedKeys,
+		exactScopes:    config.exactScopes,
+		pushNamespaces: config.pushNamespaces,
 	}, nil
 }
 
@@ -262,14 +309,7 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		return nil, challenge
 	}
 
-	verifyOpts := VerifyOptions{
-		TrustedIssuers:    []string{ac.issuer},
-		AcceptedAudiences: []string{ac.service},
-		Roots:             ac.rootCerts,
-		TrustedKeys:       ac.trustedKeys,
-	}
-
-	if err = token.Verify(verifyOpts); err != nil {
+	if err = token.Verify(ac.verifyOptions()); err != nil {
 		challenge.err = err
 		return nil, challenge
 	}
@@ -280,6 +320,16 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 			challenge.err = ErrInsufficientScope
 			return nil, challenge
 		}
+		if ac.exactScopes && !accessSet.containsExact(access) {
+			return nil, auth.AccessDenied{
+				Access: []auth.Access{access},
+				Reason: "wildcard scopes are not accepted, the token must list the action",
+			}
+		}
+	}
+
+	if err := ac.checkPushNamespaces(accessItems); err != nil {
+		return nil, err
 	}
 
 	ctx = auth.WithResources(ctx, token.resources())
@@ -287,6 +337,66 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
 }
 
+// Introspector verifies tokens outside of requests, letting other services
+// check the tokens accepted by the registry without its trusted keys.
+type Introspector interface {
+	// Introspect returns the claims of rawToken, or ErrMalformedToken or
+	// ErrInvalidToken if the token is not accepted.
+	Introspect(rawToken string) (*ClaimSet, error)
+}
+
+var _ Introspector = &accessController{}
+
+// Introspect verifies rawToken as if it was presented in a request.
+func (ac *accessController) Introspect(rawToken string) (*ClaimSet, error) {
+	token, err := NewToken(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := token.Verify(ac.verifyOptions()); err != nil {
+		return nil, err
+	}
+	return token.Claims, nil
+}
+
+func (ac *accessController) verifyOptions() VerifyOptions {
+	return VerifyOptions{
+		TrustedIssuers:    []string{ac.issuer},
+		AcceptedAudiences: []string{ac.service},
+		Roots:             ac.rootCerts,
+		TrustedKeys:       ac.trustedKeys,
+	}
+}
+
+// checkPushNamespaces denies the push access to repositories outside of the
+// push namespaces, if any are configured.
+func (ac *accessController) checkPushNamespaces(accessItems []auth.Access) error {
+	if len(ac.pushNamespaces) == 0 {
+		return nil
+	}
+
+	for _, access := range accessItems {
+		if access.Type != "repository" || access.Action != "push" {
+			continue
+		}
+		allowed := false
+		for _, re := range ac.pushNamespaces {
+			if re.MatchString(access.Name) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return auth.AccessDenied{
+				Access: []auth.Access{access},
+				Reason: fmt.Sprintf("pushing to %s is not allowed, repository is outside of the push namespaces", access.Name),
+			}
+		}
+	}
+
+	return nil
+}
+
 // init handles registering the token auth backend.
 func init() {
 	auth.Register("token", auth.InitFunc(newAccessController))
@@ -0,0 +1,80 @@
+package token
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/libtrust"
+)
+
+// Issue signs claims with key, returning the compact serialization of the
+// token. The header identifies key by its ID, so the token verifies against
+// any root certificate bundle holding the public key. A random JWT ID is set
+// if claims has none.
+func Issue(key libtrust.PrivateKey, claims *ClaimSet) (string, error) {
+	// the signing algorithm depends on the key and must be part of the
+	// signed header
+	_, alg, err := key.Sign(strings.NewReader(""), crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("unable to determine signing algorithm: %s", err)
+	}
+	header := &Header{
+		Type:       "JWT",
+		SigningAlg: alg,
+		KeyID:      key.KeyID(),
+	}
+
+	if claims.JWTID == "" {
+		randomBytes := make([]byte, 15)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return "", fmt.Errorf("unable to read random bytes for jwt id: %s", err)
+		}
+		claims.JWTID = base64.URLEncoding.EncodeToString(randomBytes)
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal jose header: %s", err)
+	}
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal claim set: %s", err)
+	}
+
+	payload := joseBase64UrlEncode(headerBytes) + TokenSeparator + joseBase64UrlEncode(claimsBytes)
+	signature, _, err := key.Sign(strings.NewReader(payload), crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign jwt payload: %s", err)
+	}
+	return payload + TokenSeparator + joseBase64UrlEncode(signature), nil
+}
+
+// ParseScope parses a scope of the token authentication protocol, such as
+// "repository:library/ubuntu:pull,push", into the access it requests.
+func ParseScope(scope string) (*ResourceActions, error) {
+	first := strings.Index(scope, ":")
+	last := strings.LastIndex(scope, ":")
+	if first <= 0 || last == first || last == len(scope)-1 {
+		return nil, fmt.Errorf("invalid scope %q", scope)
+	}
+
+	resource := &ResourceActions{
+		Type: scope[:first],
+		Name: scope[first+1 : last],
+	}
+	if i := strings.Index(resource.Type, "("); i > 0 && strings.HasSuffix(resource.Type, ")") {
+		resource.Class = resource.Type[i+1 : len(resource.Type)-1]
+		resource.Type = resource.Type[:i]
+	}
+	for _, action := range strings.Split(scope[last+1:], ",") {
+		if action == "" {
+			return nil, fmt.Errorf("invalid scope %q", scope)
+		}
+		resource.Actions = append(resource.Actions, action)
+	}
+	return resource, nil
+}
@@ -0,0 +1,89 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+)
+
+func TestIssue(t *testing.T) {
+	for _, generate := range []func() (libtrust.PrivateKey, error){
+		libtrust.GenerateECP256PrivateKey,
+		libtrust.GenerateECP384PrivateKey,
+		libtrust.GenerateRSA2048PrivateKey,
+	} {
+		key, err := generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		raw, err := Issue(key, &ClaimSet{
+			Issuer:     "issuer",
+			Subject:    "alice",
+			Audience:   "registry",
+			Expiration: now.Add(time.Hour).Unix(),
+			NotBefore:  now.Unix(),
+			IssuedAt:   now.Unix(),
+			Access:     []*ResourceActions{{Type: "repository", Name: "foo/bar", Actions: []string{"pull"}}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error issuing token: %v", err)
+		}
+
+		token, err := NewToken(raw)
+		if err != nil {
+			t.Fatalf("unexpected error parsing token: %v", err)
+		}
+		err = token.Verify(VerifyOptions{
+			TrustedIssuers:    []string{"issuer"},
+			AcceptedAudiences: []string{"registry"},
+			TrustedKeys:       map[string]libtrust.PublicKey{key.KeyID(): key.PublicKey()},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error verifying %s token: %v", token.Header.SigningAlg, err)
+		}
+		if token.Claims.Subject != "alice" || token.Claims.JWTID == "" {
+			t.Fatalf("unexpected claims: %#v", token.Claims)
+		}
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	for _, tc := range []struct {
+		scope   string
+		want    ResourceActions
+		invalid bool
+	}{
+		{scope: "repository:foo/bar:pull,push", want: ResourceActions{Type: "repository", Name: "foo/bar", Actions: []string{"pull", "push"}}},
+		{scope: "registry:catalog:*", want: ResourceActions{Type: "registry", Name: "catalog", Actions: []string{"*"}}},
+		{scope: "repository(plugin):foo/bar:pull", want: ResourceActions{Type: "repository", Class: "plugin", Name: "foo/bar", Actions: []string{"pull"}}},
+		{scope: "repository:localhost:5000/foo:pull", want: ResourceActions{Type: "repository", Name: "localhost:5000/foo", Actions: []string{"pull"}}},
+		{scope: "repository:foo/bar", invalid: true},
+		{scope: "repository:foo/bar:", invalid: true},
+		{scope: ":foo/bar:pull", invalid: true},
+		{scope: "repository:foo/bar:pull,,push", invalid: true},
+	} {
+		got, err := ParseScope(tc.scope)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.scope)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.scope, err)
+			continue
+		}
+		if got.Type != tc.want.Type || got.Class != tc.want.Class || got.Name != tc.want.Name || len(got.Actions) != len(tc.want.Actions) {
+			t.Errorf("%s: unexpected access %#v", tc.scope, got)
+			continue
+		}
+		for i := range got.Actions {
+			if got.Actions[i] != tc.want.Actions[i] {
+				t.Errorf("%s: unexpected actions %v", tc.scope, got.Actions)
+			}
+		}
+	}
+}
@@ -531,3 +531,96 @@ func TestNewAccessControllerPemBlock(t *testing.T) {
 		t.Fatal("accessController has the wrong number of certificates")
 	}
 }
+
+// TestAccessControllerScopeNarrowing tests that exactscopes rejects tokens
+// granting the requested action through the "*" wildcard only, and that
+// pushnamespaces denies pushes outside of the listed namespaces.
+func TestAccessControllerScopeNarrowing(t *testing.T) {
+	rootKeys, err := makeRootKeys(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCertBundleFilename, err := writeTempRootCerts(rootKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(rootCertBundleFilename)
+
+	issuer := "test-issuer.example.com"
+	service := "test-service.example.com"
+
+	options := map[string]interface{}{
+		"realm":          "https://auth.example.com/token/",
+		"issuer":         issuer,
+		"service":        service,
+		"rootcertbundle": rootCertBundleFilename,
+		"exactscopes":    true,
+		"pushnamespaces": []interface{}{"team-a/.+", "ci/[^/]+"},
+	}
+
+	accessController, err := newAccessController(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name    string
+		actions []string
+		access  auth.Access
+		denied  bool
+	}{
+		{"team-a/app", []string{"pull", "push"}, repositoryAccess("team-a/app", "push"), false},
+		{"ci/build", []string{"push"}, repositoryAccess("ci/build", "push"), false},
+		{"ci/build/cache", []string{"push"}, repositoryAccess("ci/build/cache", "push"), true},
+		{"team-b/app", []string{"push"}, repositoryAccess("team-b/app", "push"), true},
+		{"team-b/app", []string{"pull"}, repositoryAccess("team-b/app", "pull"), false},
+		{"team-a/app", []string{"*"}, repositoryAccess("team-a/app", "pull"), true},
+	} {
+		token, err := makeTestToken(
+			issuer, service,
+			[]*ResourceActions{{
+				Type:    "repository",
+				Name:    testcase.name,
+				Actions: testcase.actions,
+			}},
+			rootKeys[0], 1, time.Now(), time.Now().Add(5*time.Minute),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("GET", "http://example.com/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.compactRaw()))
+
+		_, err = accessController.Authorized(context.WithRequest(context.Background(), req), testcase.access)
+		if !testcase.denied {
+			if err != nil {
+				t.Fatalf("%v with actions %v: unexpected error: %v", testcase.access, testcase.actions, err)
+			}
+			continue
+		}
+		denied, ok := err.(auth.AccessDenied)
+		if !ok {
+			t.Fatalf("%v with actions %v: expected access to be denied, got %v", testcase.access, testcase.actions, err)
+		}
+		if len(denied.Access) != 1 || denied.Access[0] != testcase.access || denied.Reason == "" {
+			t.Fatalf("%v with actions %v: unexpected denial: %#v", testcase.access, testcase.actions, denied)
+		}
+	}
+
+	options["pushnamespaces"] = []interface{}{"team-a/("}
+	if _, err := newAccessController(options); err == nil {
+		t.Fatal("expected an invalid push namespace to be rejected")
+	}
+}
+
+func repositoryAccess(name, action string) auth.Access {
+	return auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: name},
+		Action:   action,
+	}
+}
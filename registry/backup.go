@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/handlers"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreRepository string
+	restoreDryRun     bool
+	restoreAt         string
+)
+
+func init() {
+	RootCmd.AddCommand(RestoreCmd)
+	RestoreCmd.Flags().StringVarP(&restoreRepository, "repository", "r", "", "repository to restore, instead of every repository of the snapshot")
+	RestoreCmd.Flags().BoolVarP(&restoreDryRun, "dry-run", "d", false, "report the changes which would be made without making them")
+	RestoreCmd.Flags().StringVar(&restoreAt, "at", "", "RFC 3339 time to restore the tags of --repository to, from the latest snapshot taken by then")
+}
+
+// RestoreCmd is the cobra command that corresponds to the restore subcommand
+var RestoreCmd = &cobra.Command{
+	Use:   "restore <config> [<snapshot>]",
+	Short: "`restore` restores the metadata of a backup snapshot",
+	Long: "`restore` copies the tags and links of a snapshot taken by the backup job\n" +
+		"back to the storage configured by <config>. Without <snapshot>, the\n" +
+		"complete snapshots are listed. With --at, the tags of --repository are\n" +
+		"restored to a point in time, those created since being removed, and the\n" +
+		"changes are printed as a diff.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 || len(args) > 2 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args[:1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		source, prefix, err := handlers.BackupTarget(config, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to access backup bucket: %v", err)
+			os.Exit(1)
+		}
+
+		if restoreAt != "" {
+			if len(args) != 1 || restoreRepository == "" {
+				fmt.Fprintln(os.Stderr, "--at requires --repository and no snapshot")
+				cmd.Usage()
+				os.Exit(1)
+			}
+			at, err := time.Parse(time.RFC3339, restoreAt)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid time %q: %v\n", restoreAt, err)
+				os.Exit(1)
+			}
+			snapshot, changes, err := storage.RestoreRepositoryAt(ctx, driver, source, storage.PointInTimeOpts{
+				Prefix:     prefix,
+				Repository: restoreRepository,
+				At:         at,
+				DryRun:     restoreDryRun,
+			})
+			for _, change := range changes {
+				fmt.Println(change)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to restore %s: %v", restoreRepository, err)
+				os.Exit(1)
+			}
+			dcontext.GetLogger(ctx).Infof("restored %s to snapshot %s with %d changes", restoreRepository, snapshot.ID, len(changes))
+			return
+		}
+
+		if len(args) == 1 {
+			snapshots, err := storage.ListBackups(ctx, source, prefix)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to list snapshots: %v", err)
+				os.Exit(1)
+			}
+			for _, snapshot := range snapshots {
+				fmt.Printf("%s\t%d files\n", snapshot.ID, snapshot.Files)
+			}
+			return
+		}
+
+		restored, err := storage.RestoreBackup(ctx, driver, source, storage.RestoreOpts{
+			Prefix:     prefix,
+			ID:         args[1],
+			Repository: restoreRepository,
+			DryRun:     restoreDryRun,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restore snapshot: %v", err)
+			os.Exit(1)
+		}
+		dcontext.GetLogger(ctx).Infof("restored %d files of snapshot %s", restored, args[1])
+	},
+}
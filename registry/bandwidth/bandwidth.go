@@ -0,0 +1,296 @@
+// Package bandwidth accounts the bytes pushed to and pulled from the registry
+// by each authenticated subject, a user or the subject of a token. Usage is
+// aggregated in memory and periodically flushed to the storage driver, so
+// that it survives restarts and can be used for chargeback. Each instance of
+// the registry flushes its usage to its own file, and reports the sum of the
+// usage flushed by all instances.
+package bandwidth
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/go-metrics"
+)
+
+const defaultFlushInterval = time.Minute
+
+var (
+	namespace = metrics.NewNamespace(prometheus.NamespacePrefix, "bandwidth", nil)
+
+	// bytesCount counts the bytes transferred by direction. Subjects are not
+	// a label, their number is unbounded.
+	bytesCount = namespace.NewLabeledCounter("bytes", "The number of bytes pushed and pulled by authenticated subjects", "direction")
+
+	// invalidInstanceChars matches the characters of an instance name which
+	// are not allowed in the name of its file.
+	invalidInstanceChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+func init() {
+	metrics.Register(namespace)
+}
+
+// Usage describes the bytes transferred by a subject.
+type Usage struct {
+	// Pushed is the number of bytes received from the subject.
+	Pushed int64 `json:"pushed"`
+
+	// Pulled is the number of bytes sent to the subject.
+	Pulled int64 `json:"pulled"`
+
+	// LastSeen is the time of the most recent request of the subject.
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+func (u *Usage) add(other Usage) {
+	u.Pushed += other.Pushed
+	u.Pulled += other.Pulled
+	if other.LastSeen.After(u.LastSeen) {
+		u.LastSeen = other.LastSeen
+	}
+}
+
+// state is the serialized form of the usage.
+type state struct {
+	Subjects map[string]Usage `json:"subjects"`
+}
+
+func newState() state {
+	return state{
+		Subjects: make(map[string]Usage),
+	}
+}
+
+func (s state) merge(other state) {
+	for subject, usage := range other.Subjects {
+		merged := s.Subjects[subject]
+		merged.add(usage)
+		s.Subjects[subject] = merged
+	}
+}
+
+// Tracker aggregates the bytes transferred by subjects.
+type Tracker struct {
+	sync.Mutex
+
+	ctx             context.Context
+	driver          driver.StorageDriver
+	root            string
+	pathToStateFile string
+	flushInterval   time.Duration
+
+	// usage is the usage accounted by this instance, peers the usage last
+	// flushed by the other instances.
+	usage   state
+	peers   state
+	dirty   bool
+	started bool
+	done    chan struct{}
+}
+
+// New returns a Tracker persisting the usage of the named instance in a file
+// under root, next to those of the other instances. The usage is flushed, and
+// that of the other instances read, every flushInterval, or every minute if
+// flushInterval is zero.
+func New(ctx context.Context, driver driver.StorageDriver, root, instance string, flushInterval time.Duration) *Tracker {
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	return &Tracker{
+		ctx:             ctx,
+		driver:          driver,
+		root:            root,
+		pathToStateFile: path.Join(root, invalidInstanceChars.ReplaceAllString(instance, "-")+".json"),
+		flushInterval:   flushInterval,
+		usage:           newState(),
+		peers:           newState(),
+		done:            make(chan struct{}),
+	}
+}
+
+// Start loads the previously flushed usage and starts flushing periodically.
+func (t *Tracker) Start() error {
+	if err := t.Refresh(); err != nil {
+		return err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.started {
+		return nil
+	}
+
+	persisted, err := t.readState(t.pathToStateFile)
+	if err != nil {
+		return err
+	}
+	t.usage.merge(persisted)
+	t.started = true
+
+	go func() {
+		ticker := time.NewTicker(t.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					dcontext.GetLogger(t.ctx).Errorf("error flushing bandwidth usage: %v", err)
+				}
+				if err := t.Refresh(); err != nil {
+					dcontext.GetLogger(t.ctx).Errorf("error reading the bandwidth usage of other instances: %v", err)
+				}
+			case <-t.done:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Record adds the bytes received from and sent to subject by a request.
+// Requests of unauthenticated clients, with an empty subject, are not
+// accounted.
+func (t *Tracker) Record(subject string, pushed, pulled int64) {
+	if subject == "" {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	usage := t.usage.Subjects[subject]
+	usage.add(Usage{Pushed: pushed, Pulled: pulled, LastSeen: time.Now()})
+	t.usage.Subjects[subject] = usage
+	t.dirty = true
+
+	if pushed > 0 {
+		bytesCount.WithValues("push").Inc(float64(pushed))
+	}
+	if pulled > 0 {
+		bytesCount.WithValues("pull").Inc(float64(pulled))
+	}
+}
+
+// Close flushes the usage and stops the periodic flush.
+func (t *Tracker) Close() error {
+	t.Lock()
+	if t.started {
+		close(t.done)
+		t.started = false
+	}
+	t.Unlock()
+
+	return t.Flush()
+}
+
+// Flush writes the usage to storage, if it changed since the last flush.
+func (t *Tracker) Flush() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.dirty {
+		return nil
+	}
+
+	p, err := json.Marshal(t.usage)
+	if err != nil {
+		return err
+	}
+	if err := t.driver.PutContent(t.ctx, t.pathToStateFile, p); err != nil {
+		return err
+	}
+
+	t.dirty = false
+	return nil
+}
+
+// Refresh reads the usage last flushed by the other instances.
+func (t *Tracker) Refresh() error {
+	files, err := t.driver.List(t.ctx, t.root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	peers := newState()
+	for _, file := range files {
+		if file == t.pathToStateFile || !strings.HasSuffix(file, ".json") {
+			continue
+		}
+		persisted, err := t.readState(file)
+		if err != nil {
+			return err
+		}
+		peers.merge(persisted)
+	}
+
+	t.Lock()
+	t.peers = peers
+	t.Unlock()
+	return nil
+}
+
+// Subject returns the usage of subject by all instances. It returns false if
+// no request of the subject was accounted.
+func (t *Tracker) Subject(subject string) (Usage, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	usage, ok := t.usage.Subjects[subject]
+	if peer, peerOK := t.peers.Subjects[subject]; peerOK {
+		usage.add(peer)
+		ok = true
+	}
+	return usage, ok
+}
+
+// Subjects returns the subjects with accounted requests, in lexical order.
+func (t *Tracker) Subjects() []string {
+	t.Lock()
+	defer t.Unlock()
+
+	subjects := make([]string, 0, len(t.usage.Subjects)+len(t.peers.Subjects))
+	for subject := range t.usage.Subjects {
+		subjects = append(subjects, subject)
+	}
+	for subject := range t.peers.Subjects {
+		if _, ok := t.usage.Subjects[subject]; !ok {
+			subjects = append(subjects, subject)
+		}
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+func (t *Tracker) readState(file string) (state, error) {
+	persisted := newState()
+
+	p, err := t.driver.GetContent(t.ctx, file)
+	if err != nil {
+		switch err.(type) {
+		case driver.PathNotFoundError:
+			return persisted, nil
+		default:
+			return persisted, err
+		}
+	}
+
+	if err := json.Unmarshal(p, &persisted); err != nil {
+		return persisted, err
+	}
+	return persisted, nil
+}
@@ -0,0 +1,92 @@
+package bandwidth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestTrackerRecords(t *testing.T) {
+	tracker := New(context.Background(), inmemory.New(), "/bandwidth", "registry-0", time.Hour)
+
+	tracker.Record("alice", 100, 0)
+	tracker.Record("alice", 0, 2048)
+	tracker.Record("bob", 0, 10)
+	tracker.Record("", 1000, 1000)
+
+	usage, ok := tracker.Subject("alice")
+	if !ok || usage.Pushed != 100 || usage.Pulled != 2048 || usage.LastSeen.IsZero() {
+		t.Fatalf("unexpected usage of alice: %#v", usage)
+	}
+	if subjects := tracker.Subjects(); len(subjects) != 2 || subjects[0] != "alice" || subjects[1] != "bob" {
+		t.Fatalf("unexpected subjects: %v", subjects)
+	}
+	if _, ok := tracker.Subject("carol"); ok {
+		t.Fatalf("expected no usage for carol")
+	}
+}
+
+func TestTrackerPersistence(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	tracker := New(ctx, driver, "/bandwidth", "registry-0", time.Hour)
+	if err := tracker.Start(); err != nil {
+		t.Fatalf("unexpected error starting tracker: %v", err)
+	}
+	tracker.Record("alice", 100, 200)
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("unexpected error closing tracker: %v", err)
+	}
+
+	// Usage recorded before the persisted usage is loaded is merged with it.
+	restarted := New(ctx, driver, "/bandwidth", "registry-0", time.Hour)
+	restarted.Record("alice", 1, 2)
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("unexpected error starting tracker: %v", err)
+	}
+	defer restarted.Close()
+
+	usage, ok := restarted.Subject("alice")
+	if !ok || usage.Pushed != 101 || usage.Pulled != 202 {
+		t.Fatalf("unexpected usage after restart: %#v", usage)
+	}
+}
+
+func TestTrackerInstances(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	first := New(ctx, driver, "/bandwidth", "registry-0", time.Hour)
+	second := New(ctx, driver, "/bandwidth", "registry-1", time.Hour)
+	for _, tracker := range []*Tracker{first, second} {
+		if err := tracker.Start(); err != nil {
+			t.Fatalf("unexpected error starting tracker: %v", err)
+		}
+		defer tracker.Close()
+	}
+
+	// Each instance flushes to its own file, neither overwrites the other.
+	first.Record("alice", 100, 0)
+	second.Record("alice", 0, 200)
+	second.Record("bob", 1, 0)
+	for _, tracker := range []*Tracker{first, second} {
+		if err := tracker.Flush(); err != nil {
+			t.Fatalf("unexpected error flushing tracker: %v", err)
+		}
+	}
+	for _, tracker := range []*Tracker{first, second} {
+		if err := tracker.Refresh(); err != nil {
+			t.Fatalf("unexpected error refreshing tracker: %v", err)
+		}
+		usage, ok := tracker.Subject("alice")
+		if !ok || usage.Pushed != 100 || usage.Pulled != 200 {
+			t.Fatalf("unexpected usage of alice: %#v", usage)
+		}
+		if subjects := tracker.Subjects(); len(subjects) != 2 || subjects[0] != "alice" || subjects[1] != "bob" {
+			t.Fatalf("unexpected subjects: %v", subjects)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+)
+
+// defaultCertificateReloadInterval is how often certificate files are
+// checked for changes if the configuration does not say otherwise.
+const defaultCertificateReloadInterval = time.Minute
+
+// certificateReloader serves a certificate loaded from disk, reloading it
+// when the certificate or key file changes so that renewed certificates are
+// picked up without a restart.
+type certificateReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+	logger            dcontext.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// newCertificateReloader loads the certificate pair, failing if it cannot be
+// loaded. The files are checked for changes at most once per interval; zero
+// means once per minute.
+func newCertificateReloader(certFile, keyFile string, interval time.Duration, logger dcontext.Logger) (*certificateReloader, error) {
+	if interval <= 0 {
+		interval = defaultCertificateReloadInterval
+	}
+	r := &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		logger:   logger,
+	}
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	r.cert, r.modTime, r.checked = &cert, modTime, time.Now()
+
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for use as
+// tls.Config.GetCertificate.
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := time.Now(); now.Sub(r.checked) >= r.interval {
+		r.checked = now
+		r.reload()
+	}
+	return r.cert, nil
+}
+
+// reload loads the certificate pair if either file changed since the last
+// successful load. On failure the previous certificate is kept and loading is
+// retried at the next check, as the files may be in the middle of being
+// replaced.
+func (r *certificateReloader) reload() {
+	modTime, err := r.lastModified()
+	if err != nil {
+		r.logger.Warnf("error checking TLS certificate for changes: %v", err)
+		return
+	}
+	if !modTime.After(r.modTime) {
+		return
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		r.logger.Warnf("error reloading TLS certificate, serving the previous one: %v", err)
+		return
+	}
+	r.cert, r.modTime = &cert, modTime
+	r.logger.Infof("reloaded TLS certificate %s", r.certFile)
+}
+
+// lastModified returns the latest modification time of the two files.
+func (r *certificateReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its
+// key, dated modTime.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling key: %v", err)
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{certFile, keyFile} {
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certificate-reloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	if _, err := newCertificateReloader(certFile, keyFile, 0, dcontext.GetLogger(dcontext.Background())); err == nil {
+		t.Fatalf("expected an error loading a missing certificate")
+	}
+
+	start := time.Now().Add(-time.Hour)
+	writeCertificate(t, certFile, keyFile, "first", start)
+	reloader, err := newCertificateReloader(certFile, keyFile, time.Nanosecond, dcontext.GetLogger(dcontext.Background()))
+	if err != nil {
+		t.Fatalf("unexpected error loading certificate: %v", err)
+	}
+
+	commonName := func() string {
+		cert, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("unexpected error getting certificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("unexpected error parsing certificate: %v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	if name := commonName(); name != "first" {
+		t.Fatalf("expected the first certificate, got %q", name)
+	}
+
+	writeCertificate(t, certFile, keyFile, "second", start.Add(time.Minute))
+	if name := commonName(); name != "second" {
+		t.Fatalf("expected the renewed certificate, got %q", name)
+	}
+
+	// A half written certificate keeps the previous one in service
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, start.Add(2*time.Minute), start.Add(2*time.Minute))
+	if name := commonName(); name != "second" {
+		t.Fatalf("expected the previous certificate after a failed reload, got %q", name)
+	}
+
+	writeCertificate(t, certFile, keyFile, "third", start.Add(2*time.Minute))
+	if name := commonName(); name != "third" {
+		t.Fatalf("expected a failed reload to be retried, got %q", name)
+	}
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Watcher provides an interface for calling Watch, which waits for changes to
+// the repositories. The Registry returned by NewRegistry implements it.
+type Watcher interface {
+	Watch(ctx context.Context, options WatchOptions) (Changes, error)
+}
+
+// WatchOptions selects the changes returned by Watch.
+type WatchOptions struct {
+	// Cursor is the cursor of the previous changes. If zero, only the
+	// changes made after the call are returned.
+	Cursor int64
+
+	// Namespace restricts the changes to the named repository and the
+	// repositories of the namespace.
+	Namespace string
+
+	// Max limits the number of changes returned, if positive.
+	Max int
+
+	// Wait is the time to wait for changes, rounded down to seconds. The
+	// registry waits 30 seconds if it is zero, and returns immediately if
+	// it is negative.
+	Wait time.Duration
+}
+
+// Change is a change to the repositories and tags of a registry.
+type Change struct {
+	ID         int64         `json:"id"`
+	Time       time.Time     `json:"time"`
+	Action     string        `json:"action"`
+	Repository string        `json:"repository"`
+	Tag        string        `json:"tag,omitempty"`
+	Digest     digest.Digest `json:"digest,omitempty"`
+	MediaType  string        `json:"mediaType,omitempty"`
+}
+
+// Changes are the changes following a cursor.
+type Changes struct {
+	// Cursor is passed to the next call to Watch to receive the following
+	// changes.
+	Cursor int64 `json:"cursor"`
+
+	// Missed is true if some changes following the cursor are no longer
+	// kept by the registry, in which case the state of the watched
+	// repositories should be listed again.
+	Missed bool `json:"missed"`
+
+	Changes []Change `json:"events"`
+}
+
+// Watch waits for the changes to the repositories and tags of the registry
+// following options.Cursor. It returns as soon as changes are available, or
+// with none once the wait has elapsed.
+func (r *registry) Watch(ctx context.Context, options WatchOptions) (Changes, error) {
+	values := url.Values{}
+	if options.Cursor > 0 {
+		values.Add("cursor", strconv.FormatInt(options.Cursor, 10))
+	}
+	if options.Namespace != "" {
+		values.Add("namespace", options.Namespace)
+	}
+	if options.Max > 0 {
+		values.Add("n", strconv.Itoa(options.Max))
+	}
+	if options.Wait < 0 {
+		values.Add("wait", "0")
+	} else if options.Wait > 0 {
+		values.Add("wait", strconv.Itoa(int(options.Wait/time.Second)))
+	}
+
+	u, err := r.ub.BuildWatchURL(values)
+	if err != nil {
+		return Changes{}, err
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return Changes{}, err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Changes{}, err
+	}
+	defer resp.Body.Close()
+
+	if !SuccessStatus(resp.StatusCode) {
+		return Changes{}, HandleErrorResponse(resp)
+	}
+	var changes Changes
+	if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		return Changes{}, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,117 @@
+package coordination
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestStorageLease(t *testing.T) {
+	ctx := context.Background()
+	lease := NewStorageLease(inmemory.New(), "/coordination/leases/test")
+
+	acquire := func(owner string, ttl time.Duration, expected bool) {
+		acquired, err := lease.Acquire(ctx, owner, ttl)
+		if err != nil {
+			t.Fatalf("unexpected error acquiring lease for %s: %v", owner, err)
+		}
+		if acquired != expected {
+			t.Fatalf("expected acquired %v for %s, got %v", expected, owner, acquired)
+		}
+	}
+
+	acquire("a", time.Minute, true)
+	acquire("b", time.Minute, false)
+	acquire("a", time.Minute, true)
+
+	// Only the owner may release the lease
+	if err := lease.Release(ctx, "b"); err != nil {
+		t.Fatalf("unexpected error releasing lease: %v", err)
+	}
+	acquire("b", time.Minute, false)
+	if err := lease.Release(ctx, "a"); err != nil {
+		t.Fatalf("unexpected error releasing lease: %v", err)
+	}
+	acquire("b", 10*time.Millisecond, true)
+
+	// An expired lease may be taken over
+	acquire("a", time.Minute, false)
+	time.Sleep(20 * time.Millisecond)
+	acquire("a", time.Minute, true)
+
+	if _, err := NewLease("zookeeper", "test", inmemory.New(), nil); err == nil {
+		t.Fatalf("expected an error for an unknown backend")
+	}
+	if _, err := NewLease("redis", "test", inmemory.New(), nil); err == nil {
+		t.Fatalf("expected an error for the redis backend without redis")
+	}
+}
+
+func TestElector(t *testing.T) {
+	var elector *Elector
+	if !elector.IsLeader() {
+		t.Fatalf("expected a nil elector to be the leader")
+	}
+
+	lease := NewStorageLease(inmemory.New(), "/coordination/leases/jobs")
+	first, second := NewElector(lease, 60*time.Millisecond), NewElector(lease, 60*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		first.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, "first elector to lead", first.IsLeader)
+
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	go second.Run(secondCtx)
+	time.Sleep(100 * time.Millisecond)
+	if second.IsLeader() {
+		t.Fatalf("expected a single leader")
+	}
+
+	// The lease is released on exit, and taken over by the other elector
+	cancel()
+	<-done
+	if first.IsLeader() {
+		t.Fatalf("expected a stopped elector not to lead")
+	}
+	waitFor(t, "second elector to take over", second.IsLeader)
+}
+
+func TestHold(t *testing.T) {
+	ctx := context.Background()
+	lease := NewStorageLease(inmemory.New(), "/coordination/leases/gc")
+
+	release, err := Hold(ctx, lease, "a", 30*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error holding lease: %v", err)
+	}
+
+	// The lease is renewed while held
+	time.Sleep(100 * time.Millisecond)
+	if _, err := Hold(ctx, lease, "b", time.Minute); err != ErrLeaseHeld {
+		t.Fatalf("expected ErrLeaseHeld, got %v", err)
+	}
+
+	release()
+	release, err = Hold(ctx, lease, "b", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error holding released lease: %v", err)
+	}
+	release()
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,142 @@
+package coordination
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/uuid"
+)
+
+// DefaultLeaseDuration is the duration of leases if none is configured.
+const DefaultLeaseDuration = 30 * time.Second
+
+// ErrLeaseHeld is returned by Hold when another owner holds the lease.
+var ErrLeaseHeld = errors.New("lease held by another instance")
+
+// NewOwner returns a unique identity for the current process, starting with
+// the host name to ease telling instances apart in the lease.
+func NewOwner() string {
+	owner := uuid.Generate().String()
+	if hostname, err := os.Hostname(); err == nil {
+		owner = hostname + "-" + owner
+	}
+	return owner
+}
+
+// Elector campaigns for a lease on behalf of the current process, which is
+// the leader while it holds it. A nil Elector is always the leader, for
+// instances which do not share their storage.
+type Elector struct {
+	lease  Lease
+	owner  string
+	ttl    time.Duration
+	leader int32
+}
+
+// NewElector returns an elector for lease. The lease is acquired for ttl and
+// renewed three times per ttl; zero means DefaultLeaseDuration.
+func NewElector(lease Lease, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = DefaultLeaseDuration
+	}
+	return &Elector{
+		lease: lease,
+		owner: NewOwner(),
+		ttl:   ttl,
+	}
+}
+
+// IsLeader returns true if the process held the lease at the last attempt to
+// acquire it.
+func (e *Elector) IsLeader() bool {
+	return e == nil || atomic.LoadInt32(&e.leader) != 0
+}
+
+// Run campaigns for the lease until ctx is done, then releases it.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	log := dcontext.GetLogger(ctx)
+	for {
+		acquired, err := e.lease.Acquire(ctx, e.owner, e.ttl)
+		if err != nil {
+			// Stepping down is safer than carrying on with a lease
+			// which may have lapsed.
+			log.Errorf("error acquiring lease: %v", err)
+			acquired = false
+		}
+
+		var leader int32
+		if acquired {
+			leader = 1
+		}
+		if previous := atomic.SwapInt32(&e.leader, leader); previous != leader {
+			if acquired {
+				log.Infof("acquired lease as %s, running background jobs", e.owner)
+			} else {
+				log.Infof("lost lease, background jobs paused")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				atomic.StoreInt32(&e.leader, 0)
+				if err := e.lease.Release(context.Background(), e.owner); err != nil {
+					log.Errorf("error releasing lease: %v", err)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Hold acquires lease for owner and keeps renewing it until the returned
+// function is called, which releases it. It returns ErrLeaseHeld if another
+// owner holds the lease.
+func Hold(ctx context.Context, lease Lease, owner string, ttl time.Duration) (func(), error) {
+	if ttl <= 0 {
+		ttl = DefaultLeaseDuration
+	}
+
+	acquired, err := lease.Acquire(ctx, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrLeaseHeld
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if acquired, err := lease.Acquire(ctx, owner, ttl); err != nil || !acquired {
+					dcontext.GetLogger(ctx).Errorf("error renewing lease: acquired=%v, err=%v", acquired, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		if err := lease.Release(ctx, owner); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error releasing lease: %v", err)
+		}
+	}, nil
+}
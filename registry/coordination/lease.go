@@ -0,0 +1,164 @@
+// Package coordination lets registry instances sharing a storage backend
+// elect a single instance to run background jobs, such as upload purging and
+// blob tiering, so that they do not run concurrently and conflict.
+package coordination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/garyburd/redigo/redis"
+)
+
+// Lease is held by at most one owner at a time, until it expires or is
+// released.
+type Lease interface {
+	// Acquire acquires or renews the lease for owner, for ttl. It returns
+	// false if another owner holds the lease.
+	Acquire(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+
+	// Release gives up the lease if owner holds it.
+	Release(ctx context.Context, owner string) error
+}
+
+// NewLease returns the lease called name of the given backend, "storage" or
+// "redis". pool may be nil if the backend is not redis.
+func NewLease(backend, name string, driver driver.StorageDriver, pool *redis.Pool) (Lease, error) {
+	switch backend {
+	case "storage":
+		return NewStorageLease(driver, path.Join("/coordination/leases", name)), nil
+	case "redis":
+		if pool == nil {
+			return nil, fmt.Errorf("redis configuration required to keep leases in redis")
+		}
+		return NewRedisLease(pool, "registry:coordination:lease:"+name), nil
+	default:
+		return nil, fmt.Errorf("unknown coordination backend: %q", backend)
+	}
+}
+
+// leaseFile is the content of the file of a storage lease.
+type leaseFile struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// storageLease keeps a lease in a file written through a storage driver.
+type storageLease struct {
+	driver driver.StorageDriver
+	path   string
+}
+
+// NewStorageLease returns a lease kept in the file at path. Since storage
+// drivers offer no atomic compare-and-swap, the lease is best effort: two
+// owners acquiring it at the same moment may both believe they hold it until
+// the next renewal, so the work it guards must tolerate being run twice.
+func NewStorageLease(driver driver.StorageDriver, path string) Lease {
+	return &storageLease{
+		driver: driver,
+		path:   path,
+	}
+}
+
+func (sl *storageLease) Acquire(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	current, err := sl.current(ctx)
+	if err != nil {
+		return false, err
+	}
+	if current != nil && current.Owner != owner && time.Now().Before(current.Expires) {
+		return false, nil
+	}
+
+	jsonBytes, err := json.Marshal(leaseFile{Owner: owner, Expires: time.Now().Add(ttl)})
+	if err != nil {
+		return false, err
+	}
+	if err := sl.driver.PutContent(ctx, sl.path, jsonBytes); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (sl *storageLease) Release(ctx context.Context, owner string) error {
+	current, err := sl.current(ctx)
+	if err != nil || current == nil || current.Owner != owner {
+		return err
+	}
+
+	err = sl.driver.Delete(ctx, sl.path)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// current returns the content of the lease file, or nil if there is none.
+func (sl *storageLease) current(ctx context.Context) (*leaseFile, error) {
+	bytes, err := sl.driver.GetContent(ctx, sl.path)
+	switch err.(type) {
+	case nil:
+	case driver.PathNotFoundError:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	var current leaseFile
+	if err := json.Unmarshal(bytes, &current); err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+// acquireLeaseScript sets the lease key to the owner if it is unset or
+// already held by the owner, atomically.
+var acquireLeaseScript = redis.NewScript(1, `
+local current = redis.call("GET", KEYS[1])
+if current == false or current == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// releaseLeaseScript deletes the lease key if it is held by the owner,
+// atomically.
+var releaseLeaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// redisLease keeps a lease in a redis key expiring with it.
+type redisLease struct {
+	pool *redis.Pool
+	key  string
+}
+
+// NewRedisLease returns a lease kept in the redis key key.
+func NewRedisLease(pool *redis.Pool, key string) Lease {
+	return &redisLease{
+		pool: pool,
+		key:  key,
+	}
+}
+
+func (rl *redisLease) Acquire(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	conn := rl.pool.Get()
+	defer conn.Close()
+
+	return redis.Bool(acquireLeaseScript.Do(conn, rl.key, owner, int64(ttl/time.Millisecond)))
+}
+
+func (rl *redisLease) Release(ctx context.Context, owner string) error {
+	conn := rl.pool.Get()
+	defer conn.Close()
+
+	_, err := releaseLeaseScript.Do(conn, rl.key, owner)
+	return err
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// adminBlobDispatcher builds the handler serving blobs regardless of the
+// repositories they are linked into.
+func adminBlobDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	abh := &adminBlobHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET":  ctx.tenant.downloadLimiter.limit(ctx, http.HandlerFunc(abh.GetBlob)),
+		"HEAD": http.HandlerFunc(abh.GetBlob),
+	}
+}
+
+// adminBlobHandler serves any blob of the registry by digest.
+type adminBlobHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// GetBlob serves the blob, or its headers for HEAD requests.
+func (abh *adminBlobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
+	server, ok := abh.tenant.registry.(distribution.GlobalBlobServer)
+	if !ok {
+		abh.Errors = append(abh.Errors, errcode.ErrorCodeUnsupported.WithDetail("blobs cannot be fetched regardless of repositories on this registry"))
+		return
+	}
+
+	if err := server.ServeGlobalBlob(abh, w, r, abh.Digest); err != nil {
+		if err == distribution.ErrBlobUnknown {
+			abh.Errors = append(abh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(abh.Digest))
+			return
+		}
+		dcontext.GetLogger(abh).Errorf("error serving blob %s: %v", abh.Digest, err)
+		abh.Errors = append(abh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
+
+// adminBlobReferencesDispatcher builds the handler listing the manifests
+// referencing a blob.
+func adminBlobReferencesDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	abh := &adminBlobHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(abh.GetReferences),
+	}
+}
+
+// referenceIndexIncompleteDetail explains the refusal of queries of an
+// incomplete reference index, whose answers may omit references.
+const referenceIndexIncompleteDetail = "the reference index is incomplete, rebuild it with `registry rebuild-reference-index`"
+
+type adminBlobReferencesAPIResponse struct {
+	Digest     digest.Digest                `json:"digest"`
+	References []distribution.BlobReference `json:"references"`
+}
+
+// GetReferences returns the manifests referencing the blob as json.
+func (abh *adminBlobHandler) GetReferences(w http.ResponseWriter, r *http.Request) {
+	index, ok := abh.tenant.registry.(distribution.BlobReferenceIndex)
+	if !ok {
+		abh.Errors = append(abh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the reference index is not maintained by this registry"))
+		return
+	}
+
+	references, err := index.BlobReferences(abh, abh.Digest)
+	if err != nil {
+		if err == distribution.ErrUnsupported {
+			abh.Errors = append(abh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the reference index is not maintained by this registry"))
+			return
+		}
+		if err == distribution.ErrReferenceIndexIncomplete {
+			abh.Errors = append(abh.Errors, errcode.ErrorCodeUnavailable.WithDetail(referenceIndexIncompleteDetail))
+			return
+		}
+		abh.Errors = append(abh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	p, err := json.Marshal(adminBlobReferencesAPIResponse{
+		Digest:     abh.Digest,
+		References: references,
+	})
+	if err != nil {
+		abh.Errors = append(abh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	w.Write(p)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestAdminBlobAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	args := makeBlobArgs(t)
+	content, err := ioutil.ReadAll(args.layerFile)
+	if err != nil {
+		t.Fatalf("error reading layer: %v", err)
+	}
+	uploadURLBase, _ := startPushLayer(t, env, args.imageName)
+	pushLayer(t, env.builder, args.imageName, args.layerDigest, uploadURLBase, bytes.NewReader(content))
+
+	blobURL, err := env.builder.BuildAdminBlobURL(args.layerDigest)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+
+	resp, err := http.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching blob", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{args.layerDigest.String()},
+	})
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading blob: %v", err)
+	}
+	if !bytes.Equal(p, content) {
+		t.Fatal("unexpected blob content")
+	}
+
+	resp, err = http.Head(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "checking blob", resp, http.StatusOK)
+	if resp.ContentLength != int64(len(content)) {
+		t.Fatalf("unexpected content length: %d != %d", resp.ContentLength, len(content))
+	}
+
+	unknownURL, err := env.builder.BuildAdminBlobURL(digest.FromString("unknown"))
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err = http.Get(unknownURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching unknown blob", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching unknown blob", resp, v2.ErrorCodeBlobUnknown)
+}
+
+func TestAdminBlobScope(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": nil,
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"silly": {
+				"realm":   "realm-test",
+				"service": "service-test",
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	app := NewApp(context.Background(), &config)
+
+	server := httptest.NewServer(app)
+	defer server.Close()
+	builder, err := v2.NewURLBuilderFromString(server.URL, false)
+	if err != nil {
+		t.Fatalf("error creating urlbuilder: %v", err)
+	}
+
+	blobURL, err := builder.BuildAdminBlobURL(digest.FromString("blob"))
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching blob without credentials", resp, http.StatusUnauthorized)
+	if challenge := resp.Header.Get("WWW-Authenticate"); !strings.Contains(challenge, `scope="registry:blobs:*"`) {
+		t.Fatalf("unexpected challenge: %q", challenge)
+	}
+}
+
+func TestAdminBlobReferencesAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	config.ReferenceIndex.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	dgst := createRepository(env, t, "foo/app", "latest")
+	named, _ := reference.WithName("foo/app")
+	repository, err := env.app.registry.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifests.Get(env.ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest: %v", err)
+	}
+	layer := m.References()[0].Digest
+
+	// the references may be incomplete until the index is rebuilt
+	referencesURL, err := env.builder.BuildAdminBlobReferencesURL(layer)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(referencesURL)
+	if err != nil {
+		t.Fatalf("unexpected error listing references: %v", err)
+	}
+	checkResponse(t, "listing references of an incomplete index", resp, http.StatusServiceUnavailable)
+	checkBodyHasErrorCodes(t, "listing references of an incomplete index", resp, errcode.ErrorCodeUnavailable)
+	resp.Body.Close()
+	if err := storage.RebuildReferenceIndex(env.ctx, env.app.driver, env.app.registry, storage.RebuildReferenceIndexOpts{}); err != nil {
+		t.Fatalf("unexpected error rebuilding the reference index: %v", err)
+	}
+
+	for _, tc := range []struct {
+		dgst     digest.Digest
+		expected []distribution.BlobReference
+	}{
+		{
+			dgst:     layer,
+			expected: []distribution.BlobReference{{Repository: "foo/app", Manifest: dgst, Tags: []string{"latest"}}},
+		},
+		{
+			dgst:     digest.FromString("unknown"),
+			expected: []distribution.BlobReference{},
+		},
+	} {
+		referencesURL, err := env.builder.BuildAdminBlobReferencesURL(tc.dgst)
+		if err != nil {
+			t.Fatalf("unexpected error building url: %v", err)
+		}
+		resp, err := http.Get(referencesURL)
+		if err != nil {
+			t.Fatalf("unexpected error listing references: %v", err)
+		}
+		checkResponse(t, "listing references", resp, http.StatusOK)
+
+		var body adminBlobReferencesAPIResponse
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("unexpected error decoding references: %v", err)
+		}
+		if body.Digest != tc.dgst || !reflect.DeepEqual(body.References, tc.expected) {
+			t.Fatalf("unexpected references of %s: %+v", tc.dgst, body)
+		}
+	}
+}
+
+func TestAdminBlobReferencesDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	referencesURL, err := env.builder.BuildAdminBlobReferencesURL(digest.FromString("unknown"))
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(referencesURL)
+	if err != nil {
+		t.Fatalf("unexpected error listing references: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "listing references", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "listing references", resp, errcode.ErrorCodeUnsupported)
+}
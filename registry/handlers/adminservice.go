@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/health"
+	"github.com/docker/distribution/registry/admin"
+	"github.com/docker/distribution/registry/auth/token"
+	"github.com/docker/distribution/registry/coordination"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/libtrust"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	defaultAdminTokenExpiration    = 5 * time.Minute
+	defaultAdminTokenMaxExpiration = time.Hour
+)
+
+// adminService serves the administrative API of the app.
+type adminService struct {
+	app *App
+
+	// signingKey signs minted tokens. It is nil if tokens cannot be
+	// minted.
+	signingKey    libtrust.PrivateKey
+	issuer        string
+	service       string
+	expiration    time.Duration
+	maxExpiration time.Duration
+
+	// clients maps the common names of the client certificates restricted
+	// to some methods to these methods.
+	clients map[string]map[string]struct{}
+}
+
+// configureAdmin prepares the administrative API, if a listener is
+// configured.
+func (app *App) configureAdmin(config *configuration.Configuration) {
+	if config.Admin.Addr == "" {
+		return
+	}
+
+	s := &adminService{
+		app:           app,
+		expiration:    config.Admin.Token.Expiration,
+		maxExpiration: config.Admin.Token.MaxExpiration,
+		clients:       make(map[string]map[string]struct{}),
+	}
+	if s.expiration <= 0 {
+		s.expiration = defaultAdminTokenExpiration
+	}
+	if s.maxExpiration <= 0 {
+		s.maxExpiration = defaultAdminTokenMaxExpiration
+	}
+	if s.expiration > s.maxExpiration {
+		panic(fmt.Sprintf("admin: token expiration %v exceeds the maximum of %v", s.expiration, s.maxExpiration))
+	}
+
+	known := make(map[string]struct{})
+	for _, method := range admin.Methods() {
+		known[method] = struct{}{}
+	}
+	for client, methods := range config.Admin.Clients {
+		s.clients[client] = make(map[string]struct{}, len(methods))
+		for _, method := range methods {
+			if _, ok := known[method]; !ok {
+				panic(fmt.Sprintf("admin: unknown method %q allowed to client %q", method, client))
+			}
+			s.clients[client][method] = struct{}{}
+		}
+	}
+	if config.Admin.Token.SigningKey != "" {
+		if config.Auth.Type() != "token" {
+			panic("admin: minting tokens requires token authentication")
+		}
+		key, err := libtrust.LoadKeyFile(config.Admin.Token.SigningKey)
+		if err != nil {
+			panic(fmt.Sprintf("admin: unable to load token signing key: %v", err))
+		}
+		s.signingKey = key
+		s.issuer = fmt.Sprint(config.Auth.Parameters()["issuer"])
+		s.service = fmt.Sprint(config.Auth.Parameters()["service"])
+	}
+	app.admin = s
+}
+
+// AdminServer returns the server of the administrative API, or nil if it is
+// disabled.
+func (app *App) AdminServer() admin.AdminServer {
+	if app.admin == nil {
+		return nil
+	}
+	return app.admin
+}
+
+// authorize refuses the call of method by a client whose certificate is
+// restricted to other methods.
+func (s *adminService) authorize(ctx context.Context, method string) error {
+	if len(s.clients) == 0 {
+		return nil
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return grpc.Errorf(codes.PermissionDenied, "unknown client")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return grpc.Errorf(codes.PermissionDenied, "unknown client")
+	}
+	client := tlsInfo.State.PeerCertificates[0].Subject.CommonName
+	methods, restricted := s.clients[client]
+	if !restricted {
+		return nil
+	}
+	if _, ok := methods[method]; !ok {
+		return grpc.Errorf(codes.PermissionDenied, "client %s may not call %s", client, method)
+	}
+	return nil
+}
+
+// GarbageCollect runs a garbage collection of the storage of the app, then
+// of the storage of each tenant with its own.
+func (s *adminService) GarbageCollect(ctx context.Context, req *admin.GarbageCollectRequest) (*admin.GarbageCollectResponse, error) {
+	if err := s.authorize(ctx, "GarbageCollect"); err != nil {
+		return nil, err
+	}
+	if !req.DryRun && !s.app.readOnly {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "the registry must be in read-only mode to collect garbage")
+	}
+
+	ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(s.app))
+	if backend := s.app.Config.Coordination.Backend; backend != "" {
+		lease, err := coordination.NewLease(backend, "gc", s.app.driver, s.app.redis)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "%v", err)
+		}
+		release, err := coordination.Hold(ctx, lease, coordination.NewOwner(), s.app.Config.Coordination.LeaseDuration)
+		if err == coordination.ErrLeaseHeld {
+			return nil, grpc.Errorf(codes.Aborted, "a garbage collection is already running")
+		} else if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "%v", err)
+		}
+		defer release()
+	}
+
+	opts := storage.GCOpts{
+		DryRun:         req.DryRun,
+		RemoveUntagged: req.RemoveUntagged,
+		NameValidator:  s.app.nameValidator,
+		IntentGrace:    s.app.Config.IntentLog.Grace,
+		Retention:      RetentionRules(s.app.Config),
+	}
+	for _, t := range s.app.storageTenants() {
+		if err := storage.MarkAndSweep(ctx, t.driver, t.registry, opts); err != nil {
+			if t.ownStorage {
+				return nil, grpc.Errorf(codes.Internal, "tenant %s: %v", t.name, err)
+			}
+			return nil, grpc.Errorf(codes.Internal, "%v", err)
+		}
+	}
+	return &admin.GarbageCollectResponse{}, nil
+}
+
+// DeleteRepository removes a repository, of the tenant owning it if any.
+func (s *adminService) DeleteRepository(ctx context.Context, req *admin.DeleteRepositoryRequest) (*admin.DeleteRepositoryResponse, error) {
+	if err := s.authorize(ctx, "DeleteRepository"); err != nil {
+		return nil, err
+	}
+	if !s.app.deleteEnabled {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "deletes are disabled")
+	}
+	if s.app.readOnly {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "the registry is in read-only mode")
+	}
+	named, err := s.app.nameValidator.WithName(req.Name)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid repository name %q: %v", req.Name, err)
+	}
+
+	remover := s.app.tenantFor(named.Name()).repoRemover
+	if remover == nil {
+		return nil, grpc.Errorf(codes.Unimplemented, "repositories cannot be deleted from this registry")
+	}
+	if err := remover.Remove(ctx, named); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, grpc.Errorf(codes.NotFound, "repository %s not found", named.Name())
+		}
+		return nil, grpc.Errorf(codes.Internal, "%v", err)
+	}
+	dcontext.GetLogger(s.app).Infof("admin: deleted repository %s", named.Name())
+	return &admin.DeleteRepositoryResponse{}, nil
+}
+
+// MintToken issues a token for the token authentication of the registry.
+func (s *adminService) MintToken(ctx context.Context, req *admin.MintTokenRequest) (*admin.MintTokenResponse, error) {
+	if err := s.authorize(ctx, "MintToken"); err != nil {
+		return nil, err
+	}
+	if s.signingKey == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "no token signing key is configured")
+	}
+	if req.Subject == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "a subject is required")
+	}
+	access := make([]*token.ResourceActions, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		resource, err := token.ParseScope(scope)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		access = append(access, resource)
+	}
+	expiration := s.expiration
+	if req.ExpiresIn > 0 {
+		if req.ExpiresIn > int64(s.maxExpiration/time.Second) {
+			return nil, grpc.Errorf(codes.InvalidArgument, "tokens may expire in at most %d seconds", int64(s.maxExpiration/time.Second))
+		}
+		expiration = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(expiration)
+	raw, err := token.Issue(s.signingKey, &token.ClaimSet{
+		Issuer:     s.issuer,
+		Subject:    req.Subject,
+		Audience:   s.service,
+		Expiration: expiresAt.Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		Access:     access,
+	})
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%v", err)
+	}
+	dcontext.GetLogger(s.app).Infof("admin: minted token for %s with scopes %v", req.Subject, req.Scopes)
+	return &admin.MintTokenResponse{Token: raw, ExpiresAt: expiresAt.Unix()}, nil
+}
+
+// IntrospectToken verifies a token against the token authentication of the
+// registry. Tokens which are not accepted are reported inactive, without
+// details.
+func (s *adminService) IntrospectToken(ctx context.Context, req *admin.IntrospectTokenRequest) (*admin.IntrospectTokenResponse, error) {
+	if err := s.authorize(ctx, "IntrospectToken"); err != nil {
+		return nil, err
+	}
+	if req.Token == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "a token is required")
+	}
+	if req.Namespace != "" {
+		if _, err := s.app.nameValidator.WithName(req.Namespace); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+
+	introspection, err := s.app.introspectToken(req.Namespace, req.Token)
+	if err == errNoTokenAuth {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "the registry does not use token authentication")
+	}
+	return &admin.IntrospectTokenResponse{
+		Active:    introspection.Active,
+		Scope:     introspection.Scope,
+		Subject:   introspection.Subject,
+		Audience:  introspection.Audience,
+		Issuer:    introspection.Issuer,
+		ExpiresAt: introspection.ExpiresAt,
+		IssuedAt:  introspection.IssuedAt,
+		NotBefore: introspection.NotBefore,
+		JwtId:     introspection.JWTID,
+	}, nil
+}
+
+// Health reports the failing health checks.
+func (s *adminService) Health(ctx context.Context, req *admin.HealthRequest) (*admin.HealthResponse, error) {
+	if err := s.authorize(ctx, "Health"); err != nil {
+		return nil, err
+	}
+	failures := health.CheckStatus()
+	return &admin.HealthResponse{
+		Healthy:  len(failures) == 0,
+		Failures: failures,
+	}, nil
+}
+
+// Usage reports the storage of a namespace and the bandwidth of subjects.
+func (s *adminService) Usage(ctx context.Context, req *admin.UsageRequest) (*admin.UsageResponse, error) {
+	if err := s.authorize(ctx, "Usage"); err != nil {
+		return nil, err
+	}
+	response := &admin.UsageResponse{}
+	if req.Namespace != "" {
+		if _, err := s.app.nameValidator.WithName(req.Namespace); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid namespace %q: %v", req.Namespace, err)
+		}
+		enumerator, ok := s.app.tenantFor(req.Namespace).registry.(distribution.NamespaceEnumerator)
+		if !ok {
+			return nil, grpc.Errorf(codes.Unimplemented, "namespace usage is not supported by this registry")
+		}
+		usage, err := enumerator.NamespaceUsage(ctx, req.Namespace)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "%v", err)
+		}
+		response.Repositories = int64(usage.Repositories)
+		response.Size = usage.Size
+	}
+
+	if s.app.bandwidth != nil {
+		for _, subject := range s.app.bandwidth.Subjects() {
+			usage, _ := s.app.bandwidth.Subject(subject)
+			response.Subjects = append(response.Subjects, &admin.SubjectUsage{
+				Subject:  subject,
+				Pushed:   usage.Pushed,
+				Pulled:   usage.Pulled,
+				LastSeen: usage.LastSeen.Unix(),
+			})
+		}
+	}
+	return response, nil
+}
+
+// ExportRepository copies a repository to another bucket, from the storage
+// of the tenant owning it if it has its own.
+func (s *adminService) ExportRepository(ctx context.Context, req *admin.ExportRepositoryRequest) (*admin.ExportRepositoryResponse, error) {
+	if err := s.authorize(ctx, "ExportRepository"); err != nil {
+		return nil, err
+	}
+	named, err := s.app.nameValidator.WithName(req.Name)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid repository name %q: %v", req.Name, err)
+	}
+	if req.Bucket == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "a bucket is required")
+	}
+	result, err := storage.ExportRepository(ctx, s.app.tenantFor(named.Name()).driver, named.Name(), req.Bucket, req.Prefix)
+	if err != nil {
+		switch err.(type) {
+		case driver.ErrUnsupportedMethod:
+			return nil, grpc.Errorf(codes.Unimplemented, "the storage driver cannot export repositories")
+		case driver.PathNotFoundError:
+			return nil, grpc.Errorf(codes.NotFound, "repository %s not found", named.Name())
+		}
+		return nil, grpc.Errorf(codes.Internal, "%v", err)
+	}
+	dcontext.GetLogger(s.app).Infof("admin: exported repository %s to %s/%s: %d files, %d blobs", named.Name(), req.Bucket, req.Prefix, result.Files, result.Blobs)
+	return &admin.ExportRepositoryResponse{Files: int64(result.Files), Blobs: int64(result.Blobs)}, nil
+}
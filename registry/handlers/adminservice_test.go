@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/admin"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestAdminService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := libtrust.GenerateCACert(key, key.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signingKey := filepath.Join(dir, "key.pem")
+	if err := libtrust.SaveKey(signingKey, key); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"token": {
+				"realm":          "https://auth.example.com/token",
+				"issuer":         "issuer",
+				"service":        "registry",
+				"rootcertbundle": bundle,
+			},
+		},
+		Tenants: []configuration.Tenant{
+			{
+				Name: "open",
+				Auth: configuration.Auth{"none": {}},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Bandwidth.Enabled = true
+	config.Admin.Addr = "127.0.0.1:0"
+	config.Admin.Token.SigningKey = signingKey
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	s := env.app.AdminServer()
+	ctx := context.Background()
+
+	if _, err := s.MintToken(ctx, &admin.MintTokenRequest{Scopes: []string{"repository:foo/bar:pull"}}); grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected a token without subject to be invalid, got %v", err)
+	}
+	if _, err := s.MintToken(ctx, &admin.MintTokenRequest{Subject: "alice", Scopes: []string{"foo/bar"}}); grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an invalid scope to be rejected, got %v", err)
+	}
+	if _, err := s.MintToken(ctx, &admin.MintTokenRequest{Subject: "alice", ExpiresIn: 2 * 3600}); grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected a lifetime over the maximum to be rejected, got %v", err)
+	}
+	minted, err := s.MintToken(ctx, &admin.MintTokenRequest{
+		Subject:   "alice",
+		Scopes:    []string{"repository:foo/bar:pull,push"},
+		ExpiresIn: 60,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error minting token: %v", err)
+	}
+
+	// the minted token is accepted by the registry
+	name, _ := reference.WithName("foo/bar")
+	content := []byte("layer")
+	uploadURL, err := env.builder.BuildBlobUploadURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building upload url: %v", err)
+	}
+	do := func(msg, method, u string, body []byte, status int) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, u, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+minted.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+		return resp
+	}
+	resp := do("starting upload", "POST", uploadURL, nil, http.StatusAccepted)
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing upload location: %v", err)
+	}
+	values := u.Query()
+	values.Set("digest", digest.FromBytes(content).String())
+	u.RawQuery = values.Encode()
+	do("pushing layer", "PUT", u.String(), content, http.StatusCreated)
+
+	usage, err := s.Usage(ctx, &admin.UsageRequest{Namespace: "foo"})
+	if err != nil {
+		t.Fatalf("unexpected error getting usage: %v", err)
+	}
+	if len(usage.Subjects) != 1 || usage.Subjects[0].Subject != "alice" || usage.Subjects[0].Pushed != int64(len(content)) {
+		t.Fatalf("unexpected usage of subjects: %v", usage.Subjects)
+	}
+
+	introspection, err := s.IntrospectToken(ctx, &admin.IntrospectTokenRequest{Token: minted.Token})
+	if err != nil {
+		t.Fatalf("unexpected error introspecting token: %v", err)
+	}
+	if !introspection.Active || introspection.Subject != "alice" || introspection.Scope != "repository:foo/bar:pull,push" ||
+		introspection.Issuer != "issuer" || introspection.Audience != "registry" || introspection.ExpiresAt != minted.ExpiresAt || introspection.JwtId == "" {
+		t.Fatalf("unexpected introspection %v", introspection)
+	}
+	introspection, err = s.IntrospectToken(ctx, &admin.IntrospectTokenRequest{Token: minted.Token[:len(minted.Token)-4] + "AAAA"})
+	if err != nil || introspection.Active || introspection.Subject != "" {
+		t.Fatalf("expected a forged token to be inactive, got %v: %v", introspection, err)
+	}
+	if _, err := s.IntrospectToken(ctx, &admin.IntrospectTokenRequest{}); grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected introspecting no token to be rejected, got %v", err)
+	}
+	introspection, err = s.IntrospectToken(ctx, &admin.IntrospectTokenRequest{Token: minted.Token, Namespace: "foo/bar"})
+	if err != nil || !introspection.Active {
+		t.Fatalf("expected the token to be active for a namespace without tenant, got %v: %v", introspection, err)
+	}
+	if _, err := s.IntrospectToken(ctx, &admin.IntrospectTokenRequest{Token: minted.Token, Namespace: "open/app"}); grpc.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected introspecting for a tenant without token authentication to be rejected, got %v", err)
+	}
+
+	// tokens are introspected over HTTP with the introspect scope
+	introspectURL, err := env.builder.BuildAdminIntrospectURL()
+	if err != nil {
+		t.Fatalf("unexpected error building introspect url: %v", err)
+	}
+	introspector, err := s.MintToken(ctx, &admin.MintTokenRequest{
+		Subject:   "introspector",
+		Scopes:    []string{"registry:introspect:*"},
+		ExpiresIn: 60,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error minting token: %v", err)
+	}
+	introspect := func(msg, bearer string, form url.Values, status int) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", introspectURL, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", msg, err)
+		}
+		checkResponse(t, msg, resp, status)
+		return resp
+	}
+	resp = introspect("introspecting without scope", minted.Token, url.Values{"token": {minted.Token}}, http.StatusUnauthorized)
+	resp.Body.Close()
+	resp = introspect("introspecting without token", introspector.Token, url.Values{}, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "introspecting without token", resp, v2.ErrorCodeIntrospectionInvalid)
+	resp.Body.Close()
+	resp = introspect("introspecting for a tenant without token authentication", introspector.Token,
+		url.Values{"token": {minted.Token}, "namespace": {"open/app"}}, http.StatusMethodNotAllowed)
+	resp.Body.Close()
+	resp = introspect("introspecting token", introspector.Token, url.Values{"token": {minted.Token}}, http.StatusOK)
+	if resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected introspections not to be cached, got %q", resp.Header.Get("Cache-Control"))
+	}
+	var introspected tokenIntrospection
+	if err := json.NewDecoder(resp.Body).Decode(&introspected); err != nil {
+		t.Fatalf("unexpected error decoding introspection: %v", err)
+	}
+	resp.Body.Close()
+	if !introspected.Active || introspected.Subject != "alice" || introspected.Scope != "repository:foo/bar:pull,push" ||
+		introspected.ExpiresAt != minted.ExpiresAt {
+		t.Fatalf("unexpected introspection %+v", introspected)
+	}
+	resp = introspect("introspecting forged token", introspector.Token, url.Values{"token": {minted.Token + "A"}}, http.StatusOK)
+	introspected = tokenIntrospection{}
+	if err := json.NewDecoder(resp.Body).Decode(&introspected); err != nil {
+		t.Fatalf("unexpected error decoding introspection: %v", err)
+	}
+	resp.Body.Close()
+	if introspected != (tokenIntrospection{}) {
+		t.Fatalf("expected a forged token to be inactive, got %+v", introspected)
+	}
+
+	health, err := s.Health(ctx, &admin.HealthRequest{})
+	if err != nil || !health.Healthy {
+		t.Fatalf("unexpected health %v: %v", health, err)
+	}
+
+	if _, err := s.GarbageCollect(ctx, &admin.GarbageCollectRequest{}); grpc.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected garbage collection to require read-only mode, got %v", err)
+	}
+	if _, err := s.GarbageCollect(ctx, &admin.GarbageCollectRequest{DryRun: true}); err != nil {
+		t.Fatalf("unexpected error in dry run: %v", err)
+	}
+
+	if _, err := s.ExportRepository(ctx, &admin.ExportRepositoryRequest{Name: "foo/bar"}); grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an export without bucket to be rejected, got %v", err)
+	}
+	if _, err := s.ExportRepository(ctx, &admin.ExportRepositoryRequest{Name: "foo/bar", Bucket: "backup"}); grpc.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected the test driver not to export repositories, got %v", err)
+	}
+
+	if _, err := s.DeleteRepository(ctx, &admin.DeleteRepositoryRequest{Name: "Foo"}); grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an invalid name to be rejected, got %v", err)
+	}
+	if _, err := s.DeleteRepository(ctx, &admin.DeleteRepositoryRequest{Name: "foo/bar"}); err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	if _, err := s.DeleteRepository(ctx, &admin.DeleteRepositoryRequest{Name: "foo/bar"}); grpc.Code(err) != codes.NotFound {
+		t.Fatalf("expected a deleted repository to be unknown, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultAdmissionTimeout = 10 * time.Second
+
+	// maxAdmissionResponseSize bounds the webhook responses read.
+	maxAdmissionResponseSize = 64 << 10
+)
+
+// admissionRequest is posted to the admission webhook for every manifest
+// push. The manifest is sent base64 encoded, exactly as pushed, so that the
+// webhook can verify its digest.
+type admissionRequest struct {
+	Repository string           `json:"repository"`
+	Tag        string           `json:"tag,omitempty"`
+	Digest     digest.Digest    `json:"digest"`
+	MediaType  string           `json:"mediaType"`
+	Manifest   []byte           `json:"manifest"`
+	Subject    admissionSubject `json:"subject"`
+}
+
+// admissionSubject identifies the client pushing a manifest. Name is empty
+// for anonymous pushes.
+type admissionSubject struct {
+	Name string `json:"name,omitempty"`
+	Addr string `json:"addr"`
+}
+
+// admissionResponse is the decision of the admission webhook.
+type admissionResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// admissionWebhook submits manifest pushes to an external policy service.
+type admissionWebhook struct {
+	url      string
+	headers  http.Header
+	failOpen bool
+	client   *http.Client
+}
+
+// newAdmissionWebhook returns the webhook described by config, or nil if
+// admission is disabled.
+func newAdmissionWebhook(config configuration.Admission) *admissionWebhook {
+	if config.URL == "" {
+		return nil
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultAdmissionTimeout
+	}
+
+	return &admissionWebhook{
+		url:      config.URL,
+		headers:  config.Headers,
+		failOpen: config.FailOpen,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// review posts request to the webhook and returns its decision.
+func (aw *admissionWebhook) review(ctx context.Context, request admissionRequest) (admissionResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return admissionResponse{}, err
+	}
+
+	req, err := http.NewRequest("POST", aw.url, bytes.NewReader(body))
+	if err != nil {
+		return admissionResponse{}, err
+	}
+	for name, values := range aw.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := aw.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return admissionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return admissionResponse{}, fmt.Errorf("admission webhook responded with status %s", resp.Status)
+	}
+
+	var response admissionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAdmissionResponseSize)).Decode(&response); err != nil {
+		return admissionResponse{}, fmt.Errorf("error decoding admission response: %v", err)
+	}
+	return response, nil
+}
+
+// applyAdmissionPolicy asks the admission webhook whether a manifest may be
+// stored. When the webhook fails, the push is rejected unless the webhook
+// is configured to fail open.
+func (imh *manifestHandler) applyAdmissionPolicy(r *http.Request, mediaType string, dgst digest.Digest, payload []byte) error {
+	webhook := imh.App.admission
+	if webhook == nil {
+		return nil
+	}
+
+	response, err := webhook.review(imh, admissionRequest{
+		Repository: imh.Repository.Named().Name(),
+		Tag:        imh.Tag,
+		Digest:     dgst,
+		MediaType:  mediaType,
+		Manifest:   payload,
+		Subject: admissionSubject{
+			Name: dcontext.GetStringValue(imh, auth.UserNameKey),
+			Addr: dcontext.RemoteAddr(r),
+		},
+	})
+	if err != nil {
+		if webhook.failOpen {
+			dcontext.GetLogger(imh).Warnf("admission webhook failed, admitting %s: %v", dgst, err)
+			return nil
+		}
+		dcontext.GetLogger(imh).Errorf("admission webhook failed, rejecting %s: %v", dgst, err)
+		return errcode.ErrorCodeUnavailable.WithMessage("admission webhook unavailable")
+	}
+
+	if !response.Allowed {
+		return errcode.ErrorCodeDenied.WithMessage("manifest rejected by admission policy").WithDetail(map[string]string{
+			"digest": dgst.String(),
+			"reason": response.Reason,
+		})
+	}
+
+	return nil
+}
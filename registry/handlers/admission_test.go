@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestAdmissionWebhook(t *testing.T) {
+	var received []admissionRequest
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var request admissionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, request)
+
+		switch request.Tag {
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "forbidden":
+			json.NewEncoder(w).Encode(admissionResponse{Reason: "tag not allowed"})
+		default:
+			json.NewEncoder(w).Encode(admissionResponse{Allowed: true})
+		}
+	}))
+	defer webhook.Close()
+
+	for _, tc := range []struct {
+		failOpen bool
+		tag      string
+		status   int
+		code     errcode.ErrorCode
+	}{
+		{tag: "latest", status: http.StatusCreated},
+		{tag: "forbidden", status: http.StatusForbidden, code: errcode.ErrorCodeDenied},
+		{tag: "broken", status: http.StatusServiceUnavailable, code: errcode.ErrorCodeUnavailable},
+		{failOpen: true, tag: "broken", status: http.StatusCreated},
+		{failOpen: true, tag: "forbidden", status: http.StatusForbidden, code: errcode.ErrorCodeDenied},
+	} {
+		received = nil
+
+		config := configuration.Configuration{
+			Storage: configuration.Storage{
+				"testdriver": configuration.Parameters{},
+				"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+					"enabled": false,
+				}},
+			},
+		}
+		config.HTTP.Headers = headerConfig
+		config.Policy.Admission = configuration.Admission{
+			URL:      webhook.URL,
+			Headers:  http.Header{"Authorization": []string{"Bearer secret"}},
+			FailOpen: tc.failOpen,
+		}
+		env := newTestEnvWithConfig(t, &config)
+
+		name, _ := reference.WithName("foo/admitted")
+		repo, err := env.app.registry.Repository(env.ctx, name)
+		if err != nil {
+			t.Fatalf("unexpected error getting repository: %v", err)
+		}
+		blobs := repo.Blobs(env.ctx)
+		configDesc, err := blobs.Put(env.ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+		layerDesc, err := blobs.Put(env.ctx, schema2.MediaTypeLayer, []byte("layer"))
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    configDesc,
+			Layers:    []distribution.Descriptor{layerDesc},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+		_, payload, _ := m.Payload()
+
+		ref, _ := reference.WithTag(name, tc.tag)
+		manifestURL, err := env.builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error building url: %v", err)
+		}
+		req, _ := http.NewRequest("PUT", manifestURL, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", schema2.MediaTypeManifest)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+
+		msg := "putting " + tc.tag
+		if tc.failOpen {
+			msg += " failing open"
+		}
+		checkResponse(t, msg, resp, tc.status)
+		if tc.code != 0 {
+			checkBodyHasErrorCodes(t, msg, resp, tc.code)
+		}
+		resp.Body.Close()
+
+		if len(received) != 1 {
+			t.Fatalf("%s: expected one admission request, got %d", msg, len(received))
+		}
+		request := received[0]
+		if request.Repository != name.Name() || request.Tag != tc.tag || request.Digest != digest.FromBytes(payload) {
+			t.Fatalf("%s: unexpected admission request: %+v", msg, request)
+		}
+		if request.MediaType != schema2.MediaTypeManifest || !bytes.Equal(request.Manifest, payload) || request.Subject.Addr == "" {
+			t.Fatalf("%s: unexpected admission request: %+v", msg, request)
+		}
+
+		_, err = repo.Tags(env.ctx).Get(env.ctx, tc.tag)
+		if stored := err == nil; stored != (tc.status == http.StatusCreated) {
+			t.Fatalf("%s: unexpected tag state: %v", msg, err)
+		}
+
+		env.Shutdown()
+	}
+}
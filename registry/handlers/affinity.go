@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+
+	"github.com/docker/distribution/configuration"
+)
+
+// uploadAffinityHeader carries the affinity hint of an upload. The hint is
+// also added to the upload location, as the uploadAffinityParam query
+// parameter, for load balancers which only route on the url.
+const (
+	uploadAffinityHeader = "Docker-Upload-Affinity"
+	uploadAffinityParam  = "_affinity"
+)
+
+// newUploadAffinity returns the hint identifying this instance to load
+// balancers, or an empty string if hints are disabled. The hint is an hmac
+// of the instance name, so that it is stable across restarts without
+// revealing host names.
+func newUploadAffinity(config configuration.UploadAffinity, secret string) string {
+	if !config.Enabled {
+		return ""
+	}
+
+	instance := config.Instance
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(instance))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// requestUploadAffinity returns the affinity hint sent with a request,
+// preferring the query parameter over the header.
+func requestUploadAffinity(r *http.Request) string {
+	if hint := r.URL.Query().Get(uploadAffinityParam); hint != "" {
+		return hint
+	}
+	return r.Header.Get(uploadAffinityHeader)
+}
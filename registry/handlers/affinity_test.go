@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+func TestNewUploadAffinity(t *testing.T) {
+	if hint := newUploadAffinity(configuration.UploadAffinity{Instance: "a"}, "secret"); hint != "" {
+		t.Fatalf("expected no hint when disabled, got %q", hint)
+	}
+
+	hint := func(instance, secret string) string {
+		return newUploadAffinity(configuration.UploadAffinity{Enabled: true, Instance: instance}, secret)
+	}
+	if hint("a", "secret") != hint("a", "secret") {
+		t.Fatal("expected the hint of an instance to be stable")
+	}
+	if hint("a", "secret") == hint("b", "secret") {
+		t.Fatal("expected instances to have distinct hints")
+	}
+	if hint("a", "secret") == hint("a", "other") {
+		t.Fatal("expected the hint to depend on the secret")
+	}
+	if hint("", "secret") == "" {
+		t.Fatal("expected a hint derived from the host name")
+	}
+}
+
+func TestUploadAffinity(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.UploadAffinity = configuration.UploadAffinity{Enabled: true, Instance: "registry-0"}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	hint := env.app.uploadAffinity
+	if hint == "" {
+		t.Fatal("expected an affinity hint")
+	}
+
+	name, _ := reference.WithName("foo/affinity")
+	location, _ := startPushLayer(t, env, name)
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("error parsing location: %v", err)
+	}
+	if got := u.Query().Get(uploadAffinityParam); got != hint {
+		t.Fatalf("unexpected hint in location: %q != %q", got, hint)
+	}
+
+	// A chunk carrying the hint of another instance continues the upload
+	// from its persisted state and moves it to this instance.
+	q := u.Query()
+	q.Del(uploadAffinityParam)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("PATCH", u.String(), bytes.NewReader([]byte("chunk")))
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	req.Header.Set(uploadAffinityHeader, "0123456789abcdef")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error pushing chunk: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "pushing chunk with a foreign hint", resp, http.StatusAccepted)
+	checkHeaders(t, resp, http.Header{
+		uploadAffinityHeader: []string{hint},
+	})
+	u, err = url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("error parsing location: %v", err)
+	}
+	if got := u.Query().Get(uploadAffinityParam); got != hint {
+		t.Fatalf("unexpected hint in location: %q != %q", got, hint)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/configuration"
@@ -29,6 +30,7 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/pullstats"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	_ "github.com/docker/distribution/registry/storage/driver/testdriver"
@@ -226,6 +228,118 @@ func contains(elems []string, e string) bool {
 	return false
 }
 
+// TestTagsPagination lists tags a page at a time, in lexical and creation
+// order.
+func TestTagsPagination(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/tags")
+	created := []string{"c", "a", "b"}
+	for _, tag := range created {
+		createRepository(env, t, imageName.Name(), tag)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	tagsURL, err := env.builder.BuildTagsURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building tags url: %v", err)
+	}
+
+	for _, tc := range []struct {
+		order    string
+		expected []string
+	}{
+		{"", []string{"a", "b", "c"}},
+		{"created", created},
+	} {
+		var listed []string
+		next := tagsURL + "?n=2"
+		if tc.order != "" {
+			next += "&order=" + tc.order
+		}
+		for next != "" {
+			resp, err := http.Get(next)
+			if err != nil {
+				t.Fatalf("unexpected error listing tags: %v", err)
+			}
+			checkResponse(t, "listing tags", resp, http.StatusOK)
+
+			var body tagsAPIResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("error decoding tags: %v", err)
+			}
+			resp.Body.Close()
+			listed = append(listed, body.Tags...)
+
+			next = ""
+			if link := resp.Header.Get("Link"); link != "" {
+				u, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+				if err != nil {
+					t.Fatalf("unexpected error parsing link %q: %v", link, err)
+				}
+				if u.Query().Get("order") != tc.order {
+					t.Fatalf("link %q does not keep the order", link)
+				}
+				next = env.server.URL + u.String()
+			}
+		}
+		if !reflect.DeepEqual(listed, tc.expected) {
+			t.Errorf("order %q: expected tags %v, got %v", tc.order, tc.expected, listed)
+		}
+	}
+
+	for _, query := range []string{"?n=-1", "?n=x", "?order=newest"} {
+		resp, err := http.Get(tagsURL + query)
+		if err != nil {
+			t.Fatalf("unexpected error listing tags: %v", err)
+		}
+		checkResponse(t, "listing tags with "+query, resp, http.StatusBadRequest)
+	}
+}
+
+// TestRepositoryNameConstraints checks that configured repository name
+// constraints replace the default ones.
+func TestRepositoryNameConstraints(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Validation.Repositories.MaxLength = 300
+	config.Validation.Repositories.MaxComponents = 3
+	config.Validation.Repositories.Component = `[A-Za-z0-9]+(?:[._-][A-Za-z0-9]+)*`
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	for _, tc := range []struct {
+		name   string
+		status int
+	}{
+		{"Team/Project", http.StatusAccepted},
+		{"team/" + strings.Repeat("a", 280), http.StatusAccepted},
+		{"team/" + strings.Repeat("a", 300), http.StatusBadRequest},
+		{"a/b/c/d", http.StatusBadRequest},
+	} {
+		resp, err := http.Post(env.server.URL+"/v2/"+tc.name+"/blobs/uploads/", "", nil)
+		if err != nil {
+			t.Fatalf("unexpected error starting upload: %v", err)
+		}
+		checkResponse(t, "starting upload to "+tc.name, resp, tc.status)
+		if tc.status == http.StatusAccepted {
+			if location := resp.Header.Get("Location"); !strings.Contains(location, "/v2/"+tc.name+"/blobs/uploads/") {
+				t.Errorf("unexpected location %q for %s", location, tc.name)
+			}
+		} else {
+			checkBodyHasErrorCodes(t, "starting upload to "+tc.name, resp, v2.ErrorCodeNameInvalid)
+		}
+	}
+}
+
 func TestURLPrefix(t *testing.T) {
 	config := configuration.Configuration{
 		Storage: configuration.Storage{
@@ -778,6 +892,85 @@ func TestStartPushReadOnly(t *testing.T) {
 	checkResponse(t, "starting push in read-only mode", resp, http.StatusMethodNotAllowed)
 }
 
+func TestStatisticsAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bar")
+	statsURL, err := env.builder.BuildStatisticsURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building statistics url: %v", err)
+	}
+
+	resp, err := http.Get(statsURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting statistics: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting statistics while disabled", resp, http.StatusMethodNotAllowed)
+
+	config := env.config
+	config.PullStatistics.Enabled = true
+	env = newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+	statsURL, _ = env.builder.BuildStatisticsURL(imageName)
+
+	resp, err = http.Get(statsURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting statistics: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting statistics of unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting statistics of unknown repository", resp, v2.ErrorCodeNameUnknown)
+
+	createRepository(env, t, imageName.Name(), "latest")
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, _ := env.builder.BuildManifestURL(tagRef)
+
+	resp, err = http.Get(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{pullstats.CountHeader: []string{"0"}})
+
+	// Events reach the statistics asynchronously.
+	var stats statisticsAPIResponse
+	for i := 0; i < 100; i++ {
+		resp, err = http.Get(statsURL)
+		if err != nil {
+			t.Fatalf("unexpected error getting statistics: %v", err)
+		}
+		checkResponse(t, "getting statistics", resp, http.StatusOK)
+		err = json.NewDecoder(resp.Body).Decode(&stats)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("unexpected error decoding statistics: %v", err)
+		}
+		if stats.Pulls > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats.Name != imageName.Name() || stats.Pulls != 1 || stats.LastPulled == nil {
+		t.Fatalf("unexpected statistics: %#v", stats)
+	}
+	if tag, ok := stats.Tags["latest"]; !ok || tag.Pulls != 1 {
+		t.Fatalf("unexpected tag statistics: %#v", stats.Tags)
+	}
+
+	// the pulls of the manifest are reported to caches
+	resp, err = http.Head(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking manifest: %v", err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "checking manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{pullstats.CountHeader: []string{"1"}})
+}
+
 func httpDelete(url string) (*http.Response, error) {
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
@@ -869,6 +1062,10 @@ type mockErrorDriver struct {
 	returnErrs []mockErrorMapping
 }
 
+func (dr *mockErrorDriver) Name() string {
+	return "storagemanifesterror"
+}
+
 func (dr *mockErrorDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
 	for _, returns := range dr.returnErrs {
 		if strings.Contains(path, returns.pathMatch) {
@@ -878,6 +1075,10 @@ func (dr *mockErrorDriver) GetContent(ctx context.Context, path string) ([]byte,
 	return nil, errors.New("Unknown storage error")
 }
 
+func (dr *mockErrorDriver) Delete(ctx context.Context, path string) error {
+	return storagedriver.PathNotFoundError{Path: path}
+}
+
 func TestGetManifestWithStorageError(t *testing.T) {
 	factory.Register("storagemanifesterror", &storageManifestErrDriverFactory{})
 	config := configuration.Configuration{
@@ -1806,6 +2007,42 @@ func testManifestAPIManifestList(t *testing.T, env *testEnv, args manifestArgs)
 
 	checkResponse(t, "fetching manifest by dgst with etag", resp, http.StatusNotModified)
 
+	// ------------------
+	// Fetch the manifest of a platform
+	req, err = http.NewRequest("GET", manifestDigestURL+"?platform=linux/amd64", nil)
+	if err != nil {
+		t.Fatalf("Error constructing request: %s", err)
+	}
+	req.Header.Set("Accept", schema2.MediaTypeManifest)
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest of platform")
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching manifest of platform", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{schema2.MediaTypeManifest},
+		"Docker-Content-Digest": []string{args.dgst.String()},
+		"Docker-Index-Digest":   []string{dgst.String()},
+	})
+
+	req, err = http.NewRequest("GET", manifestDigestURL+"?platform=linux/arm64", nil)
+	if err != nil {
+		t.Fatalf("Error constructing request: %s", err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest of unknown platform")
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching manifest of unknown platform", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching manifest of unknown platform", resp, v2.ErrorCodeManifestUnknown)
+
+	resp, err = http.Get(manifestDigestURL + "?platform=linux")
+	checkErr(t, err, "fetching manifest of invalid platform")
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching manifest of invalid platform", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "fetching manifest of invalid platform", resp, v2.ErrorCodePlatformInvalid)
+
 	// ------------------
 	// Fetch as a schema1 manifest
 	resp, err = http.Get(manifestURL)
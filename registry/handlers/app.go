@@ -26,15 +26,23 @@ import (
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/bandwidth"
+	"github.com/docker/distribution/registry/coordination"
+	"github.com/docker/distribution/registry/layerindex"
 	registrymiddleware "github.com/docker/distribution/registry/middleware/registry"
 	repositorymiddleware "github.com/docker/distribution/registry/middleware/repository"
 	"github.com/docker/distribution/registry/proxy"
+	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/pullstats"
+	"github.com/docker/distribution/registry/scan"
 	"github.com/docker/distribution/registry/storage"
 	memorycache "github.com/docker/distribution/registry/storage/cache/memory"
 	rediscache "github.com/docker/distribution/registry/storage/cache/redis"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	"github.com/docker/distribution/registry/transcode"
+	"github.com/docker/distribution/registry/uploadquota"
 	"github.com/docker/distribution/version"
 	"github.com/docker/go-metrics"
 	"github.com/docker/libtrust"
@@ -50,6 +58,18 @@ const randomSecretSize = 32
 // defaultCheckInterval is the default time in between health checks
 const defaultCheckInterval = 10 * time.Second
 
+// pullStatisticsPath is the path under which each instance persists its pull
+// statistics in the storage driver.
+const pullStatisticsPath = "/pullstats"
+
+// bandwidthUsagePath is the path under which each instance persists the
+// bandwidth usage of subjects in the storage driver.
+const bandwidthUsagePath = "/bandwidth"
+
+// scanReportsPath is the path under which vulnerability scan reports are
+// kept in the storage driver.
+const scanReportsPath = "/scans"
+
 // App is a global registry application object. Shared resources can be placed
 // on this object that will be accessible from all requests. Any writable
 // fields should be protected.
@@ -86,17 +106,131 @@ type App struct {
 
 	// readOnly is true if the registry is in a read-only maintenance mode
 	readOnly bool
+
+	// deleteEnabled is true if manifests, blobs and repositories can be
+	// deleted.
+	deleteEnabled bool
+
+	// uploadLimiter and downloadLimiter bound the number of concurrent blob
+	// transfers. They are nil if unlimited.
+	uploadLimiter   *transferLimiter
+	downloadLimiter *transferLimiter
+
+	// memory accounts for the memory held by in-flight blob uploads and
+	// manifest pushes, and sheds them past its limit.
+	memory *memoryBudget
+
+	// nameValidator checks the names of requested repositories. urlRouter
+	// builds URLs for names outside of the default ones; it is nil if the
+	// default components are allowed.
+	nameValidator *reference.NameValidator
+	urlRouter     *mux.Router
+
+	// headCache remembers recent blob and manifest existence checks. It is
+	// nil if disabled.
+	headCache *headCache
+
+	// authCache remembers recently granted requests. It is nil if
+	// disabled.
+	authCache *authCache
+
+	// bans denies requests from banned clients. It is nil if bans are
+	// disabled.
+	bans *banList
+
+	// admin serves the administrative API. It is nil if the API is
+	// disabled.
+	admin *adminService
+
+	// cors answers cross-origin requests. It is nil if no origin is
+	// allowed.
+	cors *cors
+
+	// manifestMaxSize and manifestMaxDepth bound the size and the nesting
+	// of pushed manifest payloads.
+	manifestMaxSize  int64
+	manifestMaxDepth int
+
+	// elector tells whether this instance runs background jobs. It is nil
+	// if every instance runs them.
+	elector *coordination.Elector
+
+	// uploadGuard aborts blob uploads from stalled or slow clients. It is
+	// nil if disabled.
+	uploadGuard *uploadGuard
+
+	// uploadAffinity is the hint returned with upload locations so that
+	// load balancers keep an upload on this instance. It is empty if
+	// disabled.
+	uploadAffinity string
+
+	// pullStats aggregates pull events. It is nil if pull statistics are
+	// disabled.
+	pullStats *pullstats.Tracker
+
+	// changes keeps the recent changes to repositories and tags for
+	// watchers.
+	changes *changeFeed
+
+	// bandwidth accounts the bytes transferred by authenticated subjects. It
+	// is nil if bandwidth accounting is disabled.
+	bandwidth *bandwidth.Tracker
+
+	// uploadQuota limits the bytes subjects upload per day. It is nil if
+	// upload quotas are disabled.
+	uploadQuota *uploadquota.Quota
+
+	// namespaces enforces namespace quotas and access lists.
+	namespaces *namespaces
+
+	// scanner submits pushed manifests for vulnerability scanning. It is
+	// nil if scanning is disabled.
+	scanner *scan.Scanner
+
+	// helmIndexes caches the Helm chart repository indexes of namespaces.
+	// It is nil if Helm chart repositories are disabled.
+	helmIndexes *helmIndexCache
+
+	// layerIndexer indexes the layers of pushed images. It is nil if layer
+	// indexing is disabled.
+	layerIndexer *layerindex.Indexer
+
+	// transcoder publishes variants of images with their layers
+	// re-compressed in the format requested by clients. It is nil if
+	// transcoding is disabled.
+	transcoder *transcode.Transcoder
+
+	// admission approves manifest pushes through an external webhook. It
+	// is nil if admission is disabled.
+	admission *admissionWebhook
+
+	// tenants overlay the configuration of their repositories. They are
+	// sorted longest name first, so that the first match is the most
+	// specific one.
+	tenants []*tenant
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
 // requests. The app only implements ServeHTTP and can be wrapped in other
 // handlers accordingly.
 func NewApp(ctx context.Context, config *configuration.Configuration) *App {
+	nameValidator, err := reference.NewNameValidator(
+		config.Validation.Repositories.MaxLength,
+		config.Validation.Repositories.MaxComponents,
+		config.Validation.Repositories.Component)
+	if err != nil {
+		panic(fmt.Sprintf("validation.repositories: %v", err))
+	}
+
 	app := &App{
-		Config:  config,
-		Context: ctx,
-		router:  v2.RouterWithPrefix(config.HTTP.Prefix),
-		isCache: config.Proxy.RemoteURL != "",
+		Config:        config,
+		Context:       ctx,
+		router:        v2.RouterWithNameRegexp(config.HTTP.Prefix, nameValidator.NameRegexp()),
+		isCache:       config.Proxy.RemoteURL != "",
+		nameValidator: nameValidator,
+	}
+	if config.Validation.Repositories.Component != "" {
+		app.urlRouter = v2.RouterWithNameRegexp("", nameValidator.NameRegexp())
 	}
 
 	// Register the handler dispatchers.
@@ -105,10 +239,33 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	})
 	app.register(v2.RouteNameManifest, manifestDispatcher)
 	app.register(v2.RouteNameCatalog, catalogDispatcher)
+	app.register(v2.RouteNameFeatures, featuresDispatcher)
 	app.register(v2.RouteNameTags, tagsDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
+	app.register(v2.RouteNameStatistics, statisticsDispatcher)
+	app.register(v2.RouteNameMetadata, metadataDispatcher)
+	app.register(v2.RouteNameEvents, eventsDispatcher)
+	app.register(v2.RouteNameSignatures, signaturesDispatcher)
+	app.register(v2.RouteNameLayerSharing, layerSharingDispatcher)
+	app.register(v2.RouteNamePullSize, pullSizeDispatcher)
+	app.register(v2.RouteNameScanReport, scanReportDispatcher)
+	app.register(v2.RouteNameNamespaceCatalog, namespaceCatalogDispatcher)
+	app.register(v2.RouteNameNamespaceUsage, namespaceUsageDispatcher)
+	app.register(v2.RouteNameHelmIndex, helmIndexDispatcher)
+	app.register(v2.RouteNameHelmChart, helmChartDispatcher)
+	app.register(v2.RouteNameAdminBlob, adminBlobDispatcher)
+	app.register(v2.RouteNameAdminBlobReferences, adminBlobReferencesDispatcher)
+	app.register(v2.RouteNameAdminBans, adminBansDispatcher)
+	app.register(v2.RouteNameAdminIntrospect, adminIntrospectDispatcher)
+	app.register(v2.RouteNameWatch, watchDispatcher)
+
+	for routeName := range config.HTTP.Timeouts.Routes {
+		if app.router.GetRoute(routeName) == nil {
+			panic(fmt.Sprintf("http.timeouts.routes: unknown route %q", routeName))
+		}
+	}
 
 	// override the storage driver's UA string for registry outbound HTTP requests
 	storageParams := config.Storage.Parameters()
@@ -117,7 +274,6 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 	storageParams["useragent"] = fmt.Sprintf("docker-distribution/%s %s", version.Version, runtime.Version())
 
-	var err error
 	app.driver, err = factory.Create(config.Storage.Type(), storageParams)
 	if err != nil {
 		// TODO(stevvooe): Move the creation of a service into a protected
@@ -126,14 +282,8 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		panic(err)
 	}
 
-	purgeConfig := uploadPurgeDefaultConfig()
+	purgeConfig := uploadPurgeConfig(config.Storage)
 	if mc, ok := config.Storage["maintenance"]; ok {
-		if v, ok := mc["uploadpurging"]; ok {
-			purgeConfig, ok = v.(map[interface{}]interface{})
-			if !ok {
-				panic("uploadpurging config key must contain additional keys")
-			}
-		}
 		if v, ok := mc["readonly"]; ok {
 			readOnly, ok := v.(map[interface{}]interface{})
 			if !ok {
@@ -148,19 +298,38 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
-	startUploadPurger(app, app.driver, dcontext.GetLogger(app), purgeConfig)
-
+	purgeDriver := app.driver
 	app.driver, err = applyStorageMiddleware(app.driver, config.Middleware["storage"])
 	if err != nil {
 		panic(err)
 	}
 
+	app.uploadLimiter = newTransferLimiter(config.HTTP.Concurrency.Uploads)
+	app.downloadLimiter = newTransferLimiter(config.HTTP.Concurrency.Downloads)
+	app.memory = newMemoryBudget(config.HTTP.Memory)
+	app.headCache = newHeadCache(config.HTTP.HeadCache)
+	app.authCache = newAuthCache(config.HTTP.AuthCache)
+	app.bans, err = newBanList(config.HTTP.Bans)
+	if err != nil {
+		panic(fmt.Sprintf("http.bans: %v", err))
+	}
+	app.cors = newCORS(config.HTTP.CORS)
+	app.uploadGuard = newUploadGuard(config.HTTP.Timeouts.Upload)
+
 	app.configureSecret(config)
+	app.uploadAffinity = newUploadAffinity(config.HTTP.UploadAffinity, config.HTTP.Secret)
 	app.configureEvents(config)
+	app.configureBandwidth(config)
 	app.configureRedis(config)
+	app.configureUploadQuota(config)
+	app.configureCoordination(config)
+	app.configureAdmin(config)
 	app.configureLogHook(config)
 
+	startUploadPurger(app, purgeDriver, dcontext.GetLogger(app), purgeConfig, app.elector)
+
 	options := registrymiddleware.GetRegistryOptions()
+	options = append(options, storage.RepositoryNameValidator(app.nameValidator))
 	if config.Compatibility.Schema1.TrustKey != "" {
 		app.trustKey, err = libtrust.LoadKeyFile(config.Compatibility.Schema1.TrustKey)
 		if err != nil {
@@ -178,6 +347,9 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	options = append(options, storage.Schema1SigningKey(app.trustKey))
 
 	if config.Compatibility.Schema1.Enabled {
+		if config.Compatibility.Schema1.Disabled {
+			panic("compatibility.schema1: enabled and disabled are exclusive")
+		}
 		options = append(options, storage.EnableSchema1)
 	}
 
@@ -199,6 +371,7 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		if ok {
 			if deleteEnabled, ok := e.(bool); ok && deleteEnabled {
 				options = append(options, storage.EnableDelete)
+				app.deleteEnabled = true
 			}
 		}
 	}
@@ -255,10 +428,56 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				options = append(options, storage.ManifestURLsDenyRegexp(re))
 			}
 		}
+		if config.Validation.Manifests.Configs {
+			options = append(options, storage.EnableConfigValidation)
+		}
+	}
+
+	options = append(options, storage.ManifestReferenceConcurrency(config.Validation.Manifests.Concurrency))
+
+	app.manifestMaxSize = config.Validation.Manifests.MaxSize
+	if app.manifestMaxSize <= 0 {
+		app.manifestMaxSize = defaultManifestMaxSize
+	}
+	app.manifestMaxDepth = config.Validation.Manifests.MaxDepth
+	if app.manifestMaxDepth <= 0 {
+		app.manifestMaxDepth = defaultManifestMaxDepth
+	}
+
+	if config.HTTP.BlobBufferSize > 0 {
+		options = append(options, storage.BlobBufferSize(config.HTTP.BlobBufferSize))
+	}
+
+	if config.Timeline.Enabled {
+		options = append(options, storage.EventTimeline(config.Timeline.Size))
+	}
+
+	if config.ReferenceIndex.Enabled {
+		options = append(options, storage.EnableReferenceIndex)
+	} else if !app.readOnly {
+		// manifests pushed through this instance are not indexed, the index
+		// must be rebuilt before it is relied on again
+		if err := storage.InvalidateReferenceIndex(app, app.driver); err != nil {
+			dcontext.GetLogger(app).Errorf("error invalidating the reference index: %v", err)
+		}
+	}
+
+	if config.TagIndex.Enabled {
+		options = append(options, storage.TagIndex(config.TagIndex.TTL))
+	}
+
+	if config.IntentLog.Enabled {
+		options = append(options, storage.EnableIntentLog)
 	}
 
 	// configure storage caches
+	var warmupManifests int
 	if cc, ok := config.Storage["cache"]; ok {
+		if threshold, size, ok := cacheSmallBlobs(cc); ok {
+			options = append(options, storage.SmallBlobs(threshold, size))
+			dcontext.GetLogger(app).Infof("using small blob fast path")
+		}
+
 		v, ok := cc["blobdescriptor"]
 		if !ok {
 			// Backwards compatible: "layerinfo" == "blobdescriptor"
@@ -277,6 +496,7 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				panic("could not create registry: " + err.Error())
 			}
 			dcontext.GetLogger(app).Infof("using redis blob descriptor cache")
+			warmupManifests = cacheWarmupManifests(cc)
 		case "inmemory":
 			cacheProvider := memorycache.NewInMemoryBlobDescriptorCacheProvider()
 			localOptions := append(options, storage.BlobDescriptorCacheProvider(cacheProvider))
@@ -285,8 +505,9 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				panic("could not create registry: " + err.Error())
 			}
 			dcontext.GetLogger(app).Infof("using inmemory blob descriptor cache")
+			warmupManifests = cacheWarmupManifests(cc)
 		default:
-			if v != "" {
+			if v != nil && v != "" {
 				dcontext.GetLogger(app).Warnf("unknown cache type %q, caching disabled", config.Storage["cache"])
 			}
 		}
@@ -300,11 +521,24 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
+	if config.IntentLog.Enabled {
+		// the intents are recovered through the storage registry, before
+		// it is wrapped by middlewares
+		startIntentRecovery(app, app.registry, config.IntentLog.Grace, app.elector)
+	}
+
 	app.registry, err = applyRegistryMiddleware(app, app.registry, config.Middleware["registry"])
 	if err != nil {
 		panic(err)
 	}
 
+	if warmupManifests > 0 {
+		startCacheWarmup(app, app.driver, app.registry, storage.WarmupOpts{
+			Manifests:     warmupManifests,
+			NameValidator: app.nameValidator,
+		})
+	}
+
 	authType := config.Auth.Type()
 
 	if authType != "" && !strings.EqualFold(authType, "none") {
@@ -318,19 +552,66 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 
 	// configure as a pull through cache
 	if config.Proxy.RemoteURL != "" {
-		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy)
+		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, app.schedulerStore(config.Proxy.Scheduler), config.Proxy, app.nameValidator)
 		if err != nil {
 			panic(err.Error())
 		}
 		app.isCache = true
 		dcontext.GetLogger(app).Info("Registry configured as a proxy cache to ", config.Proxy.RemoteURL)
 	}
+	if config.Transcoding.Enabled {
+		if app.isCache {
+			panic("transcoding: not supported on a pull through cache")
+		}
+		app.transcoder = transcode.New(transcode.Config{
+			MaxSize:     config.Transcoding.MaxSize,
+			Concurrency: config.Transcoding.Concurrency,
+		})
+	}
+	if config.Placement.Tiering.Enabled || len(config.Placement.Rules) > 0 {
+		var stats storage.BlobAccessStats
+		if app.pullStats != nil {
+			stats = app.pullStats
+		}
+		startBlobTiering(app, app.driver, app.registry, stats, config.Placement, app.elector)
+	}
+	if config.Backup.Enabled {
+		startMetadataBackup(app, config, app.driver, app.elector)
+	}
+
 	var ok bool
 	app.repoRemover, ok = app.registry.(distribution.RepositoryRemover)
 	if !ok {
 		dcontext.GetLogger(app).Warnf("Registry does not implement RempositoryRemover. Will not be able to delete repos and tags")
 	}
 
+	app.configureTenants(config, options)
+
+	if app.layerIndexer != nil {
+		if app.isCache {
+			panic("layerindexing: not supported on a pull through cache")
+		}
+		app.layerIndexer.Start(func(name string) distribution.Namespace {
+			return app.tenantFor(name).registry
+		})
+	}
+
+	namespaceEnumerator, _ := app.registry.(distribution.NamespaceEnumerator)
+	for _, definition := range config.Namespaces.Definitions {
+		if _, err := nameValidator.WithName(definition.Name); err != nil {
+			panic(fmt.Sprintf("namespaces: invalid namespace name %q: %v", definition.Name, err))
+		}
+		if t := app.tenantFor(definition.Name); t.ownStorage && (definition.Quota.Size > 0 || definition.Quota.Repositories > 0) {
+			panic(fmt.Sprintf("namespaces: namespace %q has a quota but tenant %q has its own storage", definition.Name, t.name))
+		}
+	}
+	app.namespaces, err = newNamespaces(config.Namespaces, namespaceEnumerator)
+	if err != nil {
+		panic(fmt.Sprintf("namespaces: %v", err))
+	}
+
+	app.admission = newAdmissionWebhook(config.Policy.Admission)
+
 	return app
 }
 
@@ -356,18 +637,27 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 			interval = defaultCheckInterval
 		}
 
-		storageDriverCheck := func() error {
-			_, err := app.driver.Stat(app, "/") // "/" should always exist
-			if _, ok := err.(storagedriver.PathNotFoundError); ok {
-				err = nil // pass this through, backend is responding, but this path doesn't exist.
+		// the storage of tenants with their own is checked too, under the
+		// name of the tenant
+		for _, t := range app.storageTenants() {
+			storageDriver := t.driver
+			storageDriverCheck := func() error {
+				_, err := storageDriver.Stat(app, "/") // "/" should always exist
+				if _, ok := err.(storagedriver.PathNotFoundError); ok {
+					err = nil // pass this through, backend is responding, but this path doesn't exist.
+				}
+				return err
 			}
-			return err
-		}
 
-		if app.Config.Health.StorageDriver.Threshold != 0 {
-			healthRegistry.RegisterPeriodicThresholdFunc("storagedriver_"+app.Config.Storage.Type(), interval, app.Config.Health.StorageDriver.Threshold, storageDriverCheck)
-		} else {
-			healthRegistry.RegisterPeriodicFunc("storagedriver_"+app.Config.Storage.Type(), interval, storageDriverCheck)
+			name := "storagedriver_" + app.Config.Storage.Type()
+			if t.ownStorage {
+				name = "storagedriver_" + storageDriver.Name() + "_tenant_" + t.name
+			}
+			if app.Config.Health.StorageDriver.Threshold != 0 {
+				healthRegistry.RegisterPeriodicThresholdFunc(name, interval, app.Config.Health.StorageDriver.Threshold, storageDriverCheck)
+			} else {
+				healthRegistry.RegisterPeriodicFunc(name, interval, storageDriverCheck)
+			}
 		}
 	}
 
@@ -424,7 +714,7 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 // passed through the application filters and context will be constructed at
 // request time.
 func (app *App) register(routeName string, dispatch dispatchFunc) {
-	handler := app.dispatcher(dispatch)
+	handler := withDeadline(app.dispatcher(dispatch), app.Config.HTTP.Timeouts.Routes[routeName])
 
 	// Chain the handler with prometheus instrumented handler
 	if app.Config.HTTP.Debug.Prometheus.Enabled {
@@ -443,6 +733,32 @@ func (app *App) register(routeName string, dispatch dispatchFunc) {
 	app.router.GetRoute(routeName).Handler(handler)
 }
 
+// configureBandwidth starts the accounting of the bytes transferred by
+// authenticated subjects, if enabled.
+func (app *App) configureBandwidth(configuration *configuration.Configuration) {
+	if !configuration.Bandwidth.Enabled {
+		return
+	}
+
+	app.bandwidth = bandwidth.New(app, app.driver, bandwidthUsagePath, trackerInstance(configuration.Bandwidth.Instance), configuration.Bandwidth.FlushInterval)
+	if err := app.bandwidth.Start(); err != nil {
+		panic(fmt.Sprintf("error starting bandwidth accounting: %v", err))
+	}
+}
+
+// trackerInstance returns the name of the file an instance flushes its pull
+// statistics or bandwidth usage to: the configured instance or, by default,
+// the host name.
+func trackerInstance(instance string) string {
+	if instance != "" {
+		return instance
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "registry"
+}
+
 // configureEvents prepares the event sink for action.
 func (app *App) configureEvents(configuration *configuration.Configuration) {
 	// Configure all of the endpoint sinks.
@@ -466,6 +782,49 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 		sinks = append(sinks, endpoint)
 	}
 
+	app.changes = newChangeFeed()
+	sinks = append(sinks, app.changes)
+
+	if configuration.Helm.Enabled {
+		app.helmIndexes = newHelmIndexCache(configuration.Helm.IndexCache)
+		sinks = append(sinks, app.helmIndexes)
+	}
+
+	if configuration.PullStatistics.Enabled {
+		app.pullStats = pullstats.New(app, app.driver, pullStatisticsPath, trackerInstance(configuration.PullStatistics.Instance), configuration.PullStatistics.FlushInterval)
+		if err := app.pullStats.Start(); err != nil {
+			panic(fmt.Sprintf("error starting pull statistics: %v", err))
+		}
+		sinks = append(sinks, app.pullStats)
+	}
+
+	if configuration.Scanning.Enabled {
+		if configuration.Scanning.Endpoint == "" {
+			panic("scanning: endpoint is required")
+		}
+		if severity := configuration.Scanning.BlockSeverity; severity != "" && !scan.ValidSeverity(severity) {
+			panic(fmt.Sprintf("scanning: invalid blockseverity %q", severity))
+		}
+		app.scanner = scan.New(app, app.driver, scanReportsPath, scan.Config{
+			Endpoint:    configuration.Scanning.Endpoint,
+			Headers:     configuration.Scanning.Headers,
+			Timeout:     configuration.Scanning.Timeout,
+			Concurrency: configuration.Scanning.Concurrency,
+		})
+		sinks = append(sinks, app.scanner)
+	}
+
+	if configuration.LayerIndexing.Enabled {
+		// started once the registry is configured
+		app.layerIndexer = layerindex.New(app, layerindex.Config{
+			MinLayerSize:  configuration.LayerIndexing.MinLayerSize,
+			Concurrency:   configuration.LayerIndexing.Concurrency,
+			SpanSize:      configuration.LayerIndexing.SpanSize,
+			NameValidator: app.nameValidator,
+		})
+		sinks = append(sinks, app.layerIndexer)
+	}
+
 	// NOTE(stevvooe): Moving to a new queuing implementation is as easy as
 	// replacing broadcaster with a rabbitmq implementation. It's recommended
 	// that the registry instances also act as the workers to keep deployment
@@ -490,6 +849,39 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 	}
 }
 
+// configureCoordination starts campaigning for the lease of background jobs,
+// if configured.
+func (app *App) configureCoordination(config *configuration.Configuration) {
+	if config.Coordination.Backend == "" {
+		return
+	}
+
+	lease, err := coordination.NewLease(config.Coordination.Backend, "jobs", app.driver, app.redis)
+	if err != nil {
+		panic(fmt.Sprintf("coordination: %v", err))
+	}
+	app.elector = coordination.NewElector(lease, config.Coordination.LeaseDuration)
+	go app.elector.Run(app)
+}
+
+// schedulerStore returns the state backend configured for the proxy's TTL
+// scheduler, or nil for the default.
+func (app *App) schedulerStore(config configuration.ProxyScheduler) scheduler.Store {
+	switch config.Backend {
+	case "", "file":
+		return nil
+	case "storage":
+		return scheduler.NewEntryStore(app.driver, "/scheduler")
+	case "redis":
+		if app.redis == nil {
+			panic("redis configuration required to use for proxy scheduler state")
+		}
+		return scheduler.NewRedisStore(app.redis, "registry:scheduler:")
+	default:
+		panic(fmt.Sprintf("unknown proxy scheduler backend: %q", config.Backend))
+	}
+}
+
 type redisStartAtKey struct{}
 
 func (app *App) configureRedis(configuration *configuration.Configuration) {
@@ -618,6 +1010,24 @@ func (app *App) configureSecret(configuration *configuration.Configuration) {
 	}
 }
 
+// Close flushes the pull statistics and bandwidth usage accounted since their
+// last flush and stops flushing them. It is called once the server stopped
+// serving requests.
+func (app *App) Close() error {
+	var err error
+	if app.pullStats != nil {
+		if closeErr := app.pullStats.Close(); closeErr != nil {
+			err = fmt.Errorf("error flushing pull statistics: %v", closeErr)
+		}
+	}
+	if app.bandwidth != nil {
+		if closeErr := app.bandwidth.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error flushing bandwidth usage: %v", closeErr)
+		}
+	}
+	return err
+}
+
 func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close() // ensure that request body is always closed.
 
@@ -637,9 +1047,24 @@ func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Set a header with the Docker Distribution API Version for all responses.
 	w.Header().Add("Docker-Distribution-API-Version", "registry/2.0")
+	if status := app.cors.handle(w, r); status != 0 {
+		app.addConfiguredHeaders(w)
+		w.WriteHeader(status)
+		return
+	}
 	app.router.ServeHTTP(w, r)
 }
 
+// addConfiguredHeaders adds the headers of the configuration to the
+// response.
+func (app *App) addConfiguredHeaders(w http.ResponseWriter) {
+	for headerName, headerValues := range app.Config.HTTP.Headers {
+		for _, value := range headerValues {
+			w.Header().Add(headerName, value)
+		}
+	}
+}
+
 // dispatchFunc takes a context and request and returns a constructed handler
 // for the route. The dispatcher will use this to dynamically create request
 // specific handlers for each endpoint without creating a new router for each
@@ -653,14 +1078,18 @@ type dispatchFunc func(ctx *Context, r *http.Request) http.Handler
 // handler, using the dispatch factory function.
 func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		for headerName, headerValues := range app.Config.HTTP.Headers {
-			for _, value := range headerValues {
-				w.Header().Add(headerName, value)
-			}
-		}
+		app.addConfiguredHeaders(w)
 
 		context := app.context(w, r)
 
+		if b, banned := app.bans.check(r); banned {
+			dcontext.GetLogger(context).Warnf("denying request from banned %s %s", b.Kind, b.Value)
+			if err := errcode.ServeJSON(w, errcode.ErrorCodeDenied.WithDetail("client is banned")); err != nil {
+				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+			}
+			return
+		}
+
 		if err := app.authorized(w, r, context); err != nil {
 			dcontext.GetLogger(context).Warnf("error authorizing context: %v", err)
 			return
@@ -672,20 +1101,38 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 		// sync up context on the request.
 		r = r.WithContext(context)
 
+		if app.bandwidth != nil {
+			body := &countingReadCloser{ReadCloser: r.Body}
+			r.Body = body
+			defer func() {
+				written, _ := context.Value("http.response.written").(int64)
+				app.bandwidth.Record(dcontext.GetStringValue(context, auth.UserNameKey), body.n, written)
+			}()
+		}
+
+		if err := app.namespaces.authorize(context, r); err != nil {
+			dcontext.GetLogger(context).Warnf("namespace access denied: %v", err)
+			context.Errors = append(context.Errors, err)
+			if err := errcode.ServeJSON(w, context.Errors); err != nil {
+				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+			}
+			return
+		}
+
 		if app.nameRequired(r) {
-			nameRef, err := reference.WithName(getName(context))
+			nameRef, err := app.nameValidator.WithName(getName(context))
 			if err != nil {
 				dcontext.GetLogger(context).Errorf("error parsing reference from context: %v", err)
-				context.Errors = append(context.Errors, distribution.ErrRepositoryNameInvalid{
+				context.Errors = append(context.Errors, v2.ErrorCodeNameInvalid.WithDetail(distribution.ErrRepositoryNameInvalid{
 					Name:   getName(context),
 					Reason: err,
-				})
+				}))
 				if err := errcode.ServeJSON(w, context.Errors); err != nil {
 					dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
 				}
 				return
 			}
-			repository, err := app.registry.Repository(context, nameRef)
+			repository, err := context.tenant.registry.Repository(context, nameRef)
 
 			if err != nil {
 				dcontext.GetLogger(context).Errorf("error resolving repository: %v", err)
@@ -708,7 +1155,7 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 			// assign and decorate the authorized repository with an event bridge.
 			context.Repository, context.RepositoryRemover = notifications.Listen(
 				repository,
-				context.App.repoRemover,
+				context.tenant.repoRemover,
 				app.eventBridge(context, r))
 
 			context.Repository, err = applyRepoMiddleware(app, context.Repository, app.Config.Middleware["repository"])
@@ -728,6 +1175,7 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 		// own errors if they need different behavior (such as range errors
 		// for layer upload).
 		if context.Errors.Len() > 0 {
+			classifyBackendErrors(context.Errors)
 			if err := errcode.ServeJSON(w, context.Errors); err != nil {
 				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
 			}
@@ -786,9 +1234,15 @@ func (app *App) context(w http.ResponseWriter, r *http.Request) *Context {
 		"vars.digest",
 		"vars.uuid"))
 
+	name := getName(ctx)
+	if name == "" {
+		name = getNamespace(ctx)
+	}
+
 	context := &Context{
 		App:     app,
 		Context: ctx,
+		tenant:  app.tenantFor(name),
 	}
 
 	if app.httpHost.Scheme != "" && app.httpHost.Host != "" {
@@ -799,6 +1253,9 @@ func (app *App) context(w http.ResponseWriter, r *http.Request) *Context {
 	} else {
 		context.urlBuilder = v2.NewURLBuilderFromRequest(r, app.Config.HTTP.RelativeURLs)
 	}
+	if app.urlRouter != nil {
+		context.urlBuilder.WithRouter(app.urlRouter)
+	}
 
 	return context
 }
@@ -810,7 +1267,8 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	dcontext.GetLogger(context).Debug("authorizing request")
 	repo := getName(context)
 
-	if app.accessController == nil {
+	accessController := context.tenant.accessController
+	if accessController == nil {
 		return nil // access controller is not enabled.
 	}
 
@@ -838,9 +1296,12 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			return fmt.Errorf("forbidden: no repository name")
 		}
 		accessRecords = appendCatalogAccessRecord(accessRecords, r)
+		accessRecords = appendAdminBlobAccessRecord(accessRecords, r)
+		accessRecords = appendAdminBansAccessRecord(accessRecords, r)
+		accessRecords = appendAdminIntrospectAccessRecord(accessRecords, r)
 	}
 
-	ctx, err := app.accessController.Authorized(context.Context, accessRecords...)
+	ctx, err := app.authCache.authorized(context.Context, context.tenant, accessController, r, accessRecords)
 	if err != nil {
 		switch err := err.(type) {
 		case auth.Challenge:
@@ -850,6 +1311,10 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			if err := errcode.ServeJSON(w, errcode.ErrorCodeUnauthorized.WithDetail(accessRecords)); err != nil {
 				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
 			}
+		case auth.AccessDenied:
+			if err := errcode.ServeJSON(w, errcode.ErrorCodeDenied.WithDetail(err)); err != nil {
+				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+			}
 		default:
 			// This condition is a potential security problem either in
 			// the configuration or whatever is backing the access
@@ -888,7 +1353,10 @@ func (app *App) nameRequired(r *http.Request) bool {
 		return true
 	}
 	routeName := route.GetName()
-	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog
+	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog && routeName != v2.RouteNameFeatures &&
+		routeName != v2.RouteNameNamespaceCatalog && routeName != v2.RouteNameNamespaceUsage && routeName != v2.RouteNameAdminBlob &&
+		routeName != v2.RouteNameAdminBans && routeName != v2.RouteNameHelmIndex && routeName != v2.RouteNameHelmChart &&
+		routeName != v2.RouteNameAdminBlobReferences && routeName != v2.RouteNameWatch && routeName != v2.RouteNameAdminIntrospect
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -936,12 +1404,15 @@ func appendAccessRecords(records []auth.Access, method string, repo string) []au
 	return records
 }
 
-// Add the access record for the catalog if it's our current route
+// Add the access record for the catalog if it's our current route. Listing
+// the repositories of a namespace, its usage or its Helm charts, and watching
+// changes, requires the same access.
 func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
 	route := mux.CurrentRoute(r)
 	routeName := route.GetName()
 
-	if routeName == v2.RouteNameCatalog {
+	if routeName == v2.RouteNameCatalog || routeName == v2.RouteNameNamespaceCatalog || routeName == v2.RouteNameNamespaceUsage ||
+		routeName == v2.RouteNameHelmIndex || routeName == v2.RouteNameHelmChart || routeName == v2.RouteNameWatch {
 		resource := auth.Resource{
 			Type: "registry",
 			Name: "catalog",
@@ -956,6 +1427,59 @@ func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []a
 	return accessRecords
 }
 
+// Add the access record for fetching blobs regardless of repositories, or
+// listing the manifests referencing them, if it's our current route. It is
+// kept apart from the catalog as it gives access to the content of every
+// repository.
+func appendAdminBlobAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
+	route := mux.CurrentRoute(r)
+	if route.GetName() == v2.RouteNameAdminBlob || route.GetName() == v2.RouteNameAdminBlobReferences {
+		accessRecords = append(accessRecords,
+			auth.Access{
+				Resource: auth.Resource{
+					Type: "registry",
+					Name: "blobs",
+				},
+				Action: "*",
+			})
+	}
+	return accessRecords
+}
+
+// appendAdminBansAccessRecord adds the access record needed to manage the
+// bans of the registry, if it is our current route.
+func appendAdminBansAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
+	route := mux.CurrentRoute(r)
+	if route.GetName() == v2.RouteNameAdminBans {
+		accessRecords = append(accessRecords,
+			auth.Access{
+				Resource: auth.Resource{
+					Type: "registry",
+					Name: "bans",
+				},
+				Action: "*",
+			})
+	}
+	return accessRecords
+}
+
+// appendAdminIntrospectAccessRecord adds the access record needed to
+// introspect tokens, if it is our current route.
+func appendAdminIntrospectAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
+	route := mux.CurrentRoute(r)
+	if route.GetName() == v2.RouteNameAdminIntrospect {
+		accessRecords = append(accessRecords,
+			auth.Access{
+				Resource: auth.Resource{
+					Type: "registry",
+					Name: "introspect",
+				},
+				Action: "*",
+			})
+	}
+	return accessRecords
+}
+
 // applyRegistryMiddleware wraps a registry instance with the configured middlewares
 func applyRegistryMiddleware(ctx context.Context, registry distribution.Namespace, middlewares []configuration.Middleware) (distribution.Namespace, error) {
 	for _, mw := range middlewares {
@@ -981,15 +1505,20 @@ func applyRepoMiddleware(ctx context.Context, repository distribution.Repository
 	return repository, nil
 }
 
-// applyStorageMiddleware wraps a storage driver with the configured middlewares
+// applyStorageMiddleware wraps a storage driver with the configured
+// middlewares, and reports the statistics of the driver and the middlewares
+// on the debug server.
 func applyStorageMiddleware(driver storagedriver.StorageDriver, middlewares []configuration.Middleware) (storagedriver.StorageDriver, error) {
+	layers := []storagedriver.StorageDriver{driver}
 	for _, mw := range middlewares {
 		smw, err := storagemiddleware.Get(mw.Name, mw.Options, driver)
 		if err != nil {
 			return nil, fmt.Errorf("unable to configure storage middleware (%s): %v", mw.Name, err)
 		}
 		driver = smw
+		layers = append(layers, driver)
 	}
+	registerStorageStats(layers)
 	return driver, nil
 }
 
@@ -1005,13 +1534,28 @@ func uploadPurgeDefaultConfig() map[interface{}]interface{} {
 	return config
 }
 
+// uploadPurgeConfig returns the upload purging configuration of the
+// maintenance section of storage, or the default one.
+func uploadPurgeConfig(storage configuration.Storage) map[interface{}]interface{} {
+	if mc, ok := storage["maintenance"]; ok {
+		if v, ok := mc["uploadpurging"]; ok {
+			purgeConfig, ok := v.(map[interface{}]interface{})
+			if !ok {
+				panic("uploadpurging config key must contain additional keys")
+			}
+			return purgeConfig
+		}
+	}
+	return uploadPurgeDefaultConfig()
+}
+
 func badPurgeUploadConfig(reason string) {
 	panic(fmt.Sprintf("Unable to parse upload purge configuration: %s", reason))
 }
 
 // startUploadPurger schedules a goroutine which will periodically
 // check upload directories for old files and delete them
-func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageDriver, log dcontext.Logger, config map[interface{}]interface{}) {
+func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageDriver, log dcontext.Logger, config map[interface{}]interface{}, elector *coordination.Elector) {
 	if config["enabled"] == false {
 		return
 	}
@@ -1066,9 +1610,159 @@ func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageD
 		time.Sleep(jitter)
 
 		for {
-			storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool)
+			if elector.IsLeader() {
+				storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool)
+			} else {
+				log.Infof("Skipping upload purge, another instance runs background jobs")
+			}
 			log.Infof("Starting upload purge in %s", intervalDuration)
 			time.Sleep(intervalDuration)
 		}
 	}()
 }
+
+// cacheWarmupManifests returns the number of manifests whose descriptors are
+// loaded into the blob descriptor cache at startup.
+func cacheWarmupManifests(cc configuration.Parameters) int {
+	v, ok := cc["warmup"]
+	if !ok {
+		return 0
+	}
+	warmup, ok := v.(map[interface{}]interface{})
+	if !ok {
+		panic("cache warmup config key must contain additional keys")
+	}
+	manifests, ok := warmup["manifests"].(int)
+	if !ok {
+		panic("cache warmup's manifests config key must have an integer value")
+	}
+	return manifests
+}
+
+// cacheSmallBlobs returns the size threshold and the cache size of the small
+// blob fast path, with ok set to false if it is not configured.
+func cacheSmallBlobs(cc configuration.Parameters) (threshold, size int64, ok bool) {
+	v, ok := cc["smallblobs"]
+	if !ok {
+		return 0, 0, false
+	}
+	smallBlobs, ok := v.(map[interface{}]interface{})
+	if !ok {
+		panic("cache smallblobs config key must contain additional keys")
+	}
+	for key, value := range map[string]*int64{"threshold": &threshold, "size": &size} {
+		switch v := smallBlobs[key].(type) {
+		case nil:
+		case int:
+			*value = int64(v)
+		default:
+			panic(fmt.Sprintf("cache smallblobs' %s config key must have an integer value", key))
+		}
+	}
+	return threshold, size, true
+}
+
+// startCacheWarmup loads the descriptors of the most recently tagged
+// manifests into the blob descriptor cache in a goroutine, so that the first
+// pulls after a deployment do not all miss the cache.
+func startCacheWarmup(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, opts storage.WarmupOpts) {
+	go func() {
+		log := dcontext.GetLogger(ctx)
+		log.Infof("Warming blob descriptor cache with the %d most recently tagged manifests", opts.Manifests)
+
+		result, err := storage.WarmBlobDescriptorCache(ctx, storageDriver, registry, opts)
+		if err != nil {
+			log.Errorf("error warming blob descriptor cache: %v", err)
+			return
+		}
+		log.Infof("Blob descriptor cache warm up finished. Num manifests=%d, num blobs=%d", result.Manifests, result.Blobs)
+	}()
+}
+
+// startIntentRecovery schedules a goroutine which completes or rolls back the
+// mutations left halfway in the intent log, at startup and then every grace
+// period, so that the intents of a crash right before a restart are
+// recovered once old enough.
+func startIntentRecovery(ctx context.Context, registry distribution.Namespace, grace time.Duration, elector *coordination.Elector) {
+	if grace <= 0 {
+		grace = storage.DefaultIntentGrace
+	}
+
+	go func() {
+		log := dcontext.GetLogger(ctx)
+		for {
+			if elector.IsLeader() {
+				recovered, err := storage.RecoverIntents(ctx, registry, time.Now().Add(-grace), false)
+				if err != nil {
+					log.Errorf("error recovering intents: %v", err)
+				} else if recovered > 0 {
+					log.Infof("recovered %d interrupted mutations", recovered)
+				}
+			}
+			time.Sleep(grace)
+		}
+	}()
+}
+
+// startBlobTiering schedules a goroutine which will periodically move blobs
+// to the storage class of their placement rule, and the other blobs between
+// the hot and cold storage classes if tiering is enabled.
+func startBlobTiering(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, stats storage.BlobAccessStats, config configuration.Placement, elector *coordination.Elector) {
+	tiering := config.Tiering
+	if tiering.Enabled {
+		if tiering.HotClass == "" || tiering.ColdClass == "" {
+			panic("placement.tiering requires both hotclass and coldclass")
+		}
+		if tiering.DemoteAfter <= 0 {
+			panic("placement.tiering requires a positive demoteafter")
+		}
+	}
+
+	var rules []storage.PlacementRule
+	for _, rule := range config.Rules {
+		re, err := regexp.Compile(rule.Repository)
+		if err != nil {
+			panic(fmt.Sprintf("placement.rules: %s", err))
+		}
+		rules = append(rules, storage.PlacementRule{
+			Repository:   re,
+			StorageClass: rule.StorageClass,
+		})
+	}
+
+	interval := tiering.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	opts := storage.TieringOpts{
+		Stats:  stats,
+		Rules:  rules,
+		DryRun: tiering.DryRun,
+	}
+	if tiering.Enabled {
+		opts.HotClass = tiering.HotClass
+		opts.ColdClass = tiering.ColdClass
+		opts.DemoteAfter = tiering.DemoteAfter
+		opts.PromotePulls = tiering.PromotePulls
+	}
+
+	go func() {
+		log := dcontext.GetLogger(ctx)
+		for {
+			log.Infof("Starting blob tiering in %s", interval)
+			time.Sleep(interval)
+
+			if !elector.IsLeader() {
+				log.Infof("Skipping blob tiering, another instance runs background jobs")
+				continue
+			}
+			result, err := storage.TierBlobs(ctx, storageDriver, registry, opts)
+			if err != nil {
+				log.Errorf("error tiering blobs: %v", err)
+				continue
+			}
+			log.Infof("Blob tiering finished. Num placed=%d, num promoted=%d, num demoted=%d", len(result.Placed), len(result.Promoted), len(result.Demoted))
+		}
+	}()
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/auth/token"
+)
+
+const (
+	defaultAuthCacheTTL  = 5 * time.Second
+	defaultAuthCacheSize = 10000
+)
+
+type authCacheKey struct {
+	tenant      *tenant
+	credentials [sha256.Size]byte
+	access      string
+}
+
+type authCacheEntry struct {
+	user      auth.UserInfo
+	resources []auth.Resource
+	expires   time.Time
+}
+
+// authCache remembers the requests granted by access controllers for a short
+// while, so that requests repeating the same credentials for the same access,
+// such as the HEAD requests of a push, skip their verification. Credentials
+// are only kept hashed. Denied requests are not remembered, and revoked
+// credentials are honored once their entries expire. Entries of bearer tokens
+// expire with the token at the latest. A nil authCache caches nothing.
+type authCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[authCacheKey]authCacheEntry
+}
+
+// newAuthCache returns a cache for the given configuration, or nil if it is
+// disabled.
+func newAuthCache(config configuration.AuthCache) *authCache {
+	if !config.Enabled {
+		return nil
+	}
+
+	c := &authCache{
+		ttl:     config.TTL,
+		size:    config.Size,
+		entries: make(map[authCacheKey]authCacheEntry),
+	}
+	if c.ttl <= 0 {
+		c.ttl = defaultAuthCacheTTL
+	}
+	if c.size <= 0 {
+		c.size = defaultAuthCacheSize
+	}
+	return c
+}
+
+// authorized returns the context of a request granted accessRecords by
+// accessController, as accessController.Authorized does, answering from the
+// cache when the same credentials were recently granted the same access.
+func (c *authCache) authorized(ctx context.Context, t *tenant, accessController auth.AccessController, r *http.Request, accessRecords []auth.Access) (context.Context, error) {
+	credentials := r.Header.Get("Authorization")
+	if c == nil || credentials == "" {
+		return accessController.Authorized(ctx, accessRecords...)
+	}
+
+	key := authCacheKey{
+		tenant:      t,
+		credentials: sha256.Sum256([]byte(credentials)),
+		access:      fmt.Sprint(accessRecords),
+	}
+	if entry, ok := c.get(key); ok {
+		if entry.resources != nil {
+			ctx = auth.WithResources(ctx, entry.resources)
+		}
+		return auth.WithUser(ctx, entry.user), nil
+	}
+
+	ctx, err := accessController.Authorized(ctx, accessRecords...)
+	if err != nil {
+		return nil, err
+	}
+	user, _ := ctx.Value(auth.UserKey).(auth.UserInfo)
+	c.put(key, authCacheEntry{
+		user:      user,
+		resources: auth.AuthorizedResources(ctx),
+		expires:   bearerExpiry(credentials),
+	})
+	return ctx, nil
+}
+
+// bearerExpiry returns the expiry of the bearer token of the credentials, or
+// the zero time if they are not a bearer token with an expiry. The token was
+// verified by the access controller granting the request.
+func bearerExpiry(credentials string) time.Time {
+	parts := strings.Split(credentials, " ")
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return time.Time{}
+	}
+	t, err := token.NewToken(parts[1])
+	if err != nil || t.Claims.Expiration == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t.Claims.Expiration, 0)
+}
+
+func (c *authCache) get(key authCacheKey) (authCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return authCacheEntry{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return authCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put remembers entry for the TTL of the cache, or until entry.expires if it
+// is set and earlier.
+func (c *authCache) put(key authCacheKey, entry authCacheEntry) {
+	now := time.Now()
+	if expires := now.Add(c.ttl); entry.expires.IsZero() || entry.expires.After(expires) {
+		entry.expires = expires
+	}
+	if !entry.expires.After(now) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, present := c.entries[key]; !present && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = entry
+}
+
+// evict makes room for an entry, dropping expired entries or, if there are
+// none, an arbitrary one. c.mu must be held.
+func (c *authCache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.size {
+		return
+	}
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
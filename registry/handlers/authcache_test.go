@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+)
+
+// countingAccessController grants requests with the "Bearer granted"
+// credentials, or with the granted credentials if set, counting the decisions
+// it makes.
+type countingAccessController struct {
+	calls   int
+	granted string
+}
+
+func (ac *countingAccessController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	ac.calls++
+	r, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	granted := ac.granted
+	if granted == "" {
+		granted = "Bearer granted"
+	}
+	if r.Header.Get("Authorization") != granted {
+		return nil, errors.New("denied")
+	}
+	ctx = auth.WithResources(ctx, []auth.Resource{access[0].Resource})
+	return auth.WithUser(ctx, auth.UserInfo{Name: "alice"}), nil
+}
+
+func TestAuthCache(t *testing.T) {
+	cache := newAuthCache(configuration.AuthCache{Enabled: true, TTL: 100 * time.Millisecond})
+	ac := &countingAccessController{}
+	pull := []auth.Access{{Resource: auth.Resource{Type: "repository", Name: "foo/bar"}, Action: "pull"}}
+	push := []auth.Access{{Resource: auth.Resource{Type: "repository", Name: "foo/bar"}, Action: "push"}}
+
+	authorize := func(credentials string, access []auth.Access) (context.Context, error) {
+		r := httptest.NewRequest("HEAD", "/", nil)
+		r.Header.Set("Authorization", credentials)
+		ctx := dcontext.WithRequest(context.Background(), r)
+		return cache.authorized(ctx, nil, ac, r, access)
+	}
+	expectCalls := func(msg string, calls int) {
+		t.Helper()
+		if ac.calls != calls {
+			t.Fatalf("%s: expected %d decisions of the access controller, got %d", msg, calls, ac.calls)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx, err := authorize("Bearer granted", pull)
+		if err != nil {
+			t.Fatalf("unexpected error authorizing: %v", err)
+		}
+		if name, _ := ctx.Value(auth.UserNameKey).(string); name != "alice" {
+			t.Fatalf("unexpected user: %q", name)
+		}
+		if resources := auth.AuthorizedResources(ctx); len(resources) != 1 || resources[0].Name != "foo/bar" {
+			t.Fatalf("unexpected resources: %v", resources)
+		}
+	}
+	expectCalls("repeated requests", 1)
+
+	if _, err := authorize("Bearer granted", push); err != nil {
+		t.Fatalf("unexpected error authorizing: %v", err)
+	}
+	expectCalls("other access", 2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := authorize("Bearer denied", pull); err == nil {
+			t.Fatal("expected denied credentials to be rejected")
+		}
+	}
+	expectCalls("denied requests", 4)
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := authorize("Bearer granted", pull); err != nil {
+		t.Fatalf("unexpected error authorizing: %v", err)
+	}
+	expectCalls("expired decision", 5)
+
+	// requests without credentials are always left to the access controller
+	for i := 0; i < 2; i++ {
+		authorize("", pull)
+	}
+	expectCalls("anonymous requests", 7)
+}
+
+func TestAuthCacheTokenExpiry(t *testing.T) {
+	cache := newAuthCache(configuration.AuthCache{Enabled: true, TTL: time.Hour})
+	ac := &countingAccessController{}
+	pull := []auth.Access{{Resource: auth.Resource{Type: "repository", Name: "foo/bar"}, Action: "pull"}}
+
+	bearer := func(expiration int64) string {
+		return "Bearer " + base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"alice","exp":%d}`, expiration))) + ".c2ln"
+	}
+	authorize := func(credentials string) {
+		t.Helper()
+		ac.granted = credentials
+		r := httptest.NewRequest("HEAD", "/", nil)
+		r.Header.Set("Authorization", credentials)
+		ctx := dcontext.WithRequest(context.Background(), r)
+		if _, err := cache.authorized(ctx, nil, ac, r, pull); err != nil {
+			t.Fatalf("unexpected error authorizing: %v", err)
+		}
+	}
+	expectCalls := func(msg string, calls int) {
+		t.Helper()
+		if ac.calls != calls {
+			t.Fatalf("%s: expected %d decisions of the access controller, got %d", msg, calls, ac.calls)
+		}
+	}
+
+	lasting := bearer(time.Now().Add(time.Hour).Unix())
+	authorize(lasting)
+	authorize(lasting)
+	expectCalls("lasting token", 1)
+
+	// tokens past their expiry, as accepted with leeway, are not remembered
+	expired := bearer(time.Now().Add(-time.Minute).Unix())
+	authorize(expired)
+	authorize(expired)
+	expectCalls("expired token", 3)
+
+	expiration := time.Now().Add(time.Second).Unix()
+	expiring := bearer(expiration)
+	authorize(expiring)
+	authorize(expiring)
+	expectCalls("expiring token", 4)
+	time.Sleep(time.Until(time.Unix(expiration, 0)) + 50*time.Millisecond)
+	authorize(expiring)
+	expectCalls("token past its expiry", 5)
+}
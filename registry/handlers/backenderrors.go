@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// backendErrorCodes maps the failures of the storage backend to the error
+// codes reporting them.
+var backendErrorCodes = map[storagedriver.BackendErrorKind]errcode.ErrorCode{
+	storagedriver.BackendThrottled:   v2.ErrorCodeStorageThrottled,
+	storagedriver.BackendUnavailable: v2.ErrorCodeStorageUnavailable,
+	storagedriver.BackendAuthFailed:  v2.ErrorCodeStorageAuthFailed,
+}
+
+// classifyBackendErrors replaces the unknown errors caused by a failure of
+// the storage backend with the error code of the failure, so that clients
+// and dashboards can tell trouble with the backend from their own errors.
+func classifyBackendErrors(errs errcode.Errors) {
+	for i, err := range errs {
+		cause := err
+		if e, ok := err.(errcode.Error); ok {
+			if e.Code != errcode.ErrorCodeUnknown {
+				continue
+			}
+			if cause, ok = e.Detail.(error); !ok {
+				continue
+			}
+		} else if _, ok := err.(errcode.ErrorCoder); ok {
+			continue
+		}
+
+		var backendErr storagedriver.BackendError
+		if !errors.As(cause, &backendErr) {
+			continue
+		}
+		if code, ok := backendErrorCodes[backendErr.Kind]; ok {
+			errs[i] = code.WithDetail(cause.Error())
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+func TestClassifyBackendErrors(t *testing.T) {
+	throttled := storagedriver.BackendError{DriverName: "s3aws", Kind: storagedriver.BackendThrottled, Enclosed: errors.New("SlowDown")}
+	denied := storagedriver.BackendError{DriverName: "s3aws", Kind: storagedriver.BackendAuthFailed, Enclosed: errors.New("InvalidAccessKeyId")}
+	unavailable := storagedriver.BackendError{DriverName: "s3aws", Kind: storagedriver.BackendUnavailable, Enclosed: errors.New("InternalError")}
+
+	errs := errcode.Errors{
+		errcode.ErrorCodeUnknown.WithDetail(throttled),
+		errcode.ErrorCodeUnknown.WithDetail(fmt.Errorf("committing upload: %w", denied)),
+		unavailable,
+		errcode.ErrorCodeUnknown.WithDetail("not a backend error"),
+		v2.ErrorCodeBlobUnknown.WithDetail(throttled),
+		storagedriver.PathNotFoundError{Path: "/a"},
+	}
+	classifyBackendErrors(errs)
+
+	for i, tc := range []struct {
+		code   errcode.ErrorCode
+		status int
+	}{
+		{v2.ErrorCodeStorageThrottled, http.StatusServiceUnavailable},
+		{v2.ErrorCodeStorageAuthFailed, http.StatusInternalServerError},
+		{v2.ErrorCodeStorageUnavailable, http.StatusServiceUnavailable},
+		{errcode.ErrorCodeUnknown, http.StatusInternalServerError},
+		{v2.ErrorCodeBlobUnknown, http.StatusNotFound},
+	} {
+		e, ok := errs[i].(errcode.Error)
+		if !ok || e.Code != tc.code || e.Code.Descriptor().HTTPStatusCode != tc.status {
+			t.Errorf("%d: unexpected error %#v, expected %v", i, errs[i], tc.code)
+		}
+	}
+	if _, ok := errs[5].(storagedriver.PathNotFoundError); !ok {
+		t.Errorf("unexpected error %#v", errs[5])
+	}
+}
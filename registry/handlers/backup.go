@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/coordination"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+)
+
+const defaultBackupPrefix = "/backups"
+
+// BackupTarget returns the storage driver keeping the snapshots of the
+// backup configuration and the prefix they are kept under. storageDriver is
+// returned if no bucket is configured, and otherwise a driver of the same
+// type and parameters accessing the bucket from its root.
+func BackupTarget(config *configuration.Configuration, storageDriver storagedriver.StorageDriver) (storagedriver.StorageDriver, string, error) {
+	prefix := config.Backup.Prefix
+	if prefix == "" {
+		prefix = defaultBackupPrefix
+	}
+	if config.Backup.Bucket == "" {
+		return storageDriver, prefix, nil
+	}
+
+	parameters := make(map[string]interface{}, len(config.Storage.Parameters())+1)
+	for k, v := range config.Storage.Parameters() {
+		parameters[k] = v
+	}
+	parameters["bucket"] = config.Backup.Bucket
+	delete(parameters, "rootdirectory")
+	target, err := factory.Create(config.Storage.Type(), parameters)
+	if err != nil {
+		return nil, "", err
+	}
+	return target, prefix, nil
+}
+
+// startMetadataBackup schedules a goroutine which will periodically snapshot
+// the metadata of the registry.
+func startMetadataBackup(ctx context.Context, config *configuration.Configuration, storageDriver storagedriver.StorageDriver, elector *coordination.Elector) {
+	if config.Backup.Keep < 0 {
+		panic("backup.keep must not be negative")
+	}
+	target, prefix, err := BackupTarget(config, storageDriver)
+	if err != nil {
+		panic("backup: unable to access the bucket: " + err.Error())
+	}
+
+	interval := config.Backup.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	opts := storage.BackupOpts{
+		Prefix: prefix,
+		Keep:   config.Backup.Keep,
+	}
+
+	go func() {
+		log := dcontext.GetLogger(ctx)
+		for {
+			log.Infof("Starting metadata backup in %s", interval)
+			time.Sleep(interval)
+
+			if !elector.IsLeader() {
+				log.Infof("Skipping metadata backup, another instance runs background jobs")
+				continue
+			}
+			snapshot, err := storage.BackupMetadata(ctx, storageDriver, target, opts)
+			if err != nil {
+				log.Errorf("error backing up metadata: %v", err)
+				continue
+			}
+			log.Infof("Metadata backup finished. Snapshot=%s, num files=%d", snapshot.ID, snapshot.Files)
+		}
+	}()
+}
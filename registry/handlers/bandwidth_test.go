@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestBandwidthAccounting(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"silly": {
+				"realm":   "realm-test",
+				"service": "service-test",
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Bandwidth.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/bar")
+	content := bytes.Repeat([]byte("layer"), 1024)
+	dgst := digest.FromBytes(content)
+
+	do := func(msg, method, u string, body io.Reader, authorized bool, status int) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, u, body)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+		checkResponse(t, msg, resp, status)
+		return resp
+	}
+
+	uploadURL, err := env.builder.BuildBlobUploadURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building upload url: %v", err)
+	}
+	do("unauthenticated upload", "POST", uploadURL, nil, false, http.StatusUnauthorized)
+	if subjects := env.app.bandwidth.Subjects(); len(subjects) != 0 {
+		t.Fatalf("expected no accounted subjects, got %v", subjects)
+	}
+
+	resp := do("starting upload", "POST", uploadURL, nil, true, http.StatusAccepted)
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing upload location: %v", err)
+	}
+	values := u.Query()
+	values.Set("digest", dgst.String())
+	u.RawQuery = values.Encode()
+	do("pushing layer", "PUT", u.String(), bytes.NewReader(content), true, http.StatusCreated)
+	usage, ok := env.app.bandwidth.Subject("silly")
+	if !ok || usage.Pushed != int64(len(content)) || usage.Pulled != 0 {
+		t.Fatalf("unexpected usage after push: %#v", usage)
+	}
+
+	ref, _ := reference.WithDigest(name, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+	do("pulling layer", "GET", blobURL, nil, true, http.StatusOK)
+	usage, _ = env.app.bandwidth.Subject("silly")
+	if usage.Pushed != int64(len(content)) || usage.Pulled != int64(len(content)) {
+		t.Fatalf("unexpected usage after pull: %#v", usage)
+	}
+}
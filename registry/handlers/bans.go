@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth/token"
+	"github.com/gorilla/handlers"
+)
+
+const defaultBanTTL = time.Hour
+
+// maxBanRequestSize bounds the body of requests adding a ban.
+const maxBanRequestSize = 4096
+
+// The kinds of bans.
+const (
+	banCIDR    = "cidr"
+	banUser    = "user"
+	banSubject = "subject"
+)
+
+// ban denies the requests of a client address range, of a user authenticated
+// with a password or of the subject of bearer tokens until it expires.
+type ban struct {
+	Kind    string    `json:"kind"`
+	Value   string    `json:"value"`
+	Reason  string    `json:"reason,omitempty"`
+	Expires time.Time `json:"expires"`
+
+	network *net.IPNet
+}
+
+type banKey struct {
+	kind  string
+	value string
+}
+
+// banList holds the bans in effect on this instance. Bans are kept in memory
+// and are neither shared with the other instances nor kept across restarts,
+// so they are added to every instance behind a load balancer. A nil banList
+// bans nothing.
+type banList struct {
+	defaultTTL     time.Duration
+	trustedProxies []*net.IPNet
+
+	mu   sync.Mutex
+	bans map[banKey]ban
+}
+
+// newBanList returns a ban list for the given configuration, or nil if bans
+// are disabled.
+func newBanList(config configuration.Bans) (*banList, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	l := &banList{
+		defaultTTL: config.DefaultTTL,
+		bans:       make(map[banKey]ban),
+	}
+	if l.defaultTTL <= 0 {
+		l.defaultTTL = defaultBanTTL
+	}
+	for _, cidr := range config.TrustedProxies {
+		network, err := parseBanNetwork(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", cidr, err)
+		}
+		l.trustedProxies = append(l.trustedProxies, network)
+	}
+	return l, nil
+}
+
+// trusted reports whether ip belongs to a trusted proxy.
+func (l *banList) trusted(ip net.IP) bool {
+	for _, network := range l.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIPs returns the address r connects from and, while it is that of a
+// trusted proxy, the addresses the proxies forwarded in X-Forwarded-For,
+// from the last one. Addresses forwarded by other clients are ignored, as
+// they could claim any address to evade their bans or get others banned.
+func (l *banList) clientIPs(r *http.Request) []net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+
+	ips := []net.IP{ip}
+	var forwarded []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0 && l.trusted(ip); i-- {
+		if ip = net.ParseIP(strings.TrimSpace(forwarded[i])); ip == nil {
+			break
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// add puts b in effect for ttl, or the default TTL if zero, replacing any ban
+// of the same value. The value is normalized, so that it can be lifted as
+// listed.
+func (l *banList) add(b ban, ttl time.Duration) (ban, error) {
+	switch b.Kind {
+	case banCIDR:
+		network, err := parseBanNetwork(b.Value)
+		if err != nil {
+			return ban{}, err
+		}
+		b.Value = network.String()
+		b.network = network
+	case banUser, banSubject:
+		if b.Value == "" {
+			return ban{}, fmt.Errorf("empty %s", b.Kind)
+		}
+	default:
+		return ban{}, fmt.Errorf("unknown kind of ban %q", b.Kind)
+	}
+	if ttl < 0 {
+		return ban{}, fmt.Errorf("negative ttl %v", ttl)
+	}
+	if ttl == 0 {
+		ttl = l.defaultTTL
+	}
+	b.Expires = time.Now().Add(ttl).UTC()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bans[banKey{kind: b.Kind, value: b.Value}] = b
+	return b, nil
+}
+
+// parseBanNetwork parses a CIDR, or a single IP address.
+func parseBanNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// remove lifts a ban, returning false if it is not in effect.
+func (l *banList) remove(kind, value string) bool {
+	key := banKey{kind: kind, value: value}
+	if kind == banCIDR {
+		if network, err := parseBanNetwork(value); err == nil {
+			key.value = network.String()
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.bans[key]
+	delete(l.bans, key)
+	return ok && time.Now().Before(b.Expires)
+}
+
+// list returns the bans in effect, dropping the expired ones.
+func (l *banList) list() []ban {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bans := make([]ban, 0, len(l.bans))
+	for key, b := range l.bans {
+		if !now.Before(b.Expires) {
+			delete(l.bans, key)
+			continue
+		}
+		bans = append(bans, b)
+	}
+	return bans
+}
+
+// check returns the ban in effect for the client of r, if any. The client is
+// identified by the address it connects from, the addresses forwarded by
+// trusted proxies, the user of basic authentication and the subject of bearer
+// tokens. Tokens are not verified: a forged subject only gets its bearer
+// banned.
+func (l *banList) check(r *http.Request) (ban, bool) {
+	if l == nil {
+		return ban{}, false
+	}
+
+	ips := l.clientIPs(r)
+
+	identities := make(map[banKey]bool)
+	if username, _, ok := r.BasicAuth(); ok {
+		identities[banKey{kind: banUser, value: username}] = true
+	}
+	if parts := strings.Split(r.Header.Get("Authorization"), " "); len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+		if t, err := token.NewToken(parts[1]); err == nil && t.Claims.Subject != "" {
+			identities[banKey{kind: banSubject, value: t.Claims.Subject}] = true
+		}
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.bans {
+		if !now.Before(b.Expires) {
+			delete(l.bans, key)
+			continue
+		}
+		if identities[key] {
+			return b, true
+		}
+		if b.network != nil {
+			for _, ip := range ips {
+				if b.network.Contains(ip) {
+					return b, true
+				}
+			}
+		}
+	}
+	return ban{}, false
+}
+
+// adminBansDispatcher constructs the handler managing the bans.
+func adminBansDispatcher(ctx *Context, r *http.Request) http.Handler {
+	bh := &adminBansHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET":    http.HandlerFunc(bh.GetBans),
+		"POST":   http.HandlerFunc(bh.AddBan),
+		"DELETE": http.HandlerFunc(bh.LiftBan),
+	}
+}
+
+// adminBansHandler manages the bans of the registry instance.
+type adminBansHandler struct {
+	*Context
+}
+
+type bansAPIResponse struct {
+	Bans []ban `json:"bans"`
+}
+
+type banAPIRequest struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+	TTL    string `json:"ttl"`
+}
+
+// enabled reports whether bans are enabled, failing the request otherwise.
+func (bh *adminBansHandler) enabled() bool {
+	if bh.App.bans == nil {
+		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnsupported.WithDetail("bans are not enabled on this registry"))
+		return false
+	}
+	return true
+}
+
+// GetBans lists the bans in effect.
+func (bh *adminBansHandler) GetBans(w http.ResponseWriter, r *http.Request) {
+	if !bh.enabled() {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bansAPIResponse{Bans: bh.App.bans.list()}); err != nil {
+		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
+
+// AddBan puts a ban in effect.
+func (bh *adminBansHandler) AddBan(w http.ResponseWriter, r *http.Request) {
+	if !bh.enabled() {
+		return
+	}
+
+	var request banAPIRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBanRequestSize)).Decode(&request); err != nil {
+		bh.Errors = append(bh.Errors, v2.ErrorCodeBanInvalid.WithDetail(err.Error()))
+		return
+	}
+	var ttl time.Duration
+	if request.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(request.TTL); err != nil {
+			bh.Errors = append(bh.Errors, v2.ErrorCodeBanInvalid.WithDetail(err.Error()))
+			return
+		}
+	}
+
+	b, err := bh.App.bans.add(ban{Kind: request.Kind, Value: request.Value, Reason: request.Reason}, ttl)
+	if err != nil {
+		bh.Errors = append(bh.Errors, v2.ErrorCodeBanInvalid.WithDetail(err.Error()))
+		return
+	}
+	dcontext.GetLogger(bh).Infof("banned %s %s until %s: %s", b.Kind, b.Value, b.Expires.Format(time.RFC3339), b.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(b); err != nil {
+		dcontext.GetLogger(bh).Errorf("error encoding ban: %v", err)
+	}
+}
+
+// LiftBan lifts a ban before it expires.
+func (bh *adminBansHandler) LiftBan(w http.ResponseWriter, r *http.Request) {
+	if !bh.enabled() {
+		return
+	}
+
+	kind, value := r.FormValue("kind"), r.FormValue("value")
+	if !bh.App.bans.remove(kind, value) {
+		bh.Errors = append(bh.Errors, v2.ErrorCodeBanUnknown.WithDetail(map[string]string{"kind": kind, "value": value}))
+		return
+	}
+	dcontext.GetLogger(bh).Infof("lifted ban of %s %s", kind, value)
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/docker/distribution"
@@ -33,7 +34,7 @@ func blobDispatcher(ctx *Context, r *http.Request) http.Handler {
 	}
 
 	mhandler := handlers.MethodHandler{
-		"GET":  http.HandlerFunc(blobHandler.GetBlob),
+		"GET":  ctx.tenant.downloadLimiter.limit(ctx, http.HandlerFunc(blobHandler.GetBlob)),
 		"HEAD": http.HandlerFunc(blobHandler.GetBlob),
 	}
 
@@ -55,17 +56,44 @@ type blobHandler struct {
 // response.
 func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 	context.GetLogger(bh).Debug("GetBlob")
+	name := bh.Repository.Named().Name()
+
+	// Answer existence checks from the cache. If-None-Match is left to
+	// ServeBlob.
+	if r.Method == "HEAD" && r.Header.Get("If-None-Match") == "" {
+		if desc, exists, ok := bh.headCache.get(headCacheBlob, name, bh.Digest); ok {
+			if !exists {
+				bh.Errors = append(bh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(bh.Digest))
+				return
+			}
+			bh.setPullCount(w, desc.Digest)
+			serveBlobHead(w, desc)
+			return
+		}
+	}
+
+	// a pull through cache never fetches foreign layers from the remote
+	if bh.App.isCache && bh.redirectForeign(w, r) {
+		return
+	}
+
 	blobs := bh.Repository.Blobs(bh)
 	desc, err := blobs.Stat(bh, bh.Digest)
 	if err != nil {
 		if err == distribution.ErrBlobUnknown {
+			if !bh.App.isCache && bh.redirectForeign(w, r) {
+				return
+			}
+			bh.headCache.missing(headCacheBlob, name, bh.Digest)
 			bh.Errors = append(bh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(bh.Digest))
 		} else {
 			bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
 		return
 	}
+	bh.headCache.found(headCacheBlob, name, desc)
 
+	bh.setPullCount(w, desc.Digest)
 	if err := blobs.ServeBlob(bh, w, r, desc.Digest); err != nil {
 		context.GetLogger(bh).Debugf("unexpected error getting blob HTTP handler: %v", err)
 		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
@@ -73,6 +101,30 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// redirectForeign redirects the request to the first URL of the blob if it is
+// a layer stored outside of the registry, such as a foreign or
+// non-distributable layer referenced by a manifest of the repository.
+func (bh *blobHandler) redirectForeign(w http.ResponseWriter, r *http.Request) bool {
+	index, ok := bh.tenant.registry.(distribution.ForeignBlobIndex)
+	if !ok {
+		return false
+	}
+	desc, err := index.ForeignBlob(bh, bh.Repository.Named(), bh.Digest)
+	if err != nil {
+		if err != distribution.ErrBlobUnknown {
+			context.GetLogger(bh).Errorf("error resolving foreign layer %s: %v", bh.Digest, err)
+		}
+		return false
+	}
+	if len(desc.URLs) == 0 {
+		return false
+	}
+
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	http.Redirect(w, r, desc.URLs[0], http.StatusTemporaryRedirect)
+	return true
+}
+
 // DeleteBlob deletes a layer blob
 func (bh *blobHandler) DeleteBlob(w http.ResponseWriter, r *http.Request) {
 	context.GetLogger(bh).Debug("DeleteBlob")
@@ -94,6 +146,23 @@ func (bh *blobHandler) DeleteBlob(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	bh.headCache.forget(headCacheBlob, bh.Repository.Named().Name(), bh.Digest)
+
 	w.Header().Set("Content-Length", "0")
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// serveBlobHead writes the response to a HEAD request for a blob known to
+// exist, with the headers ServeBlob would have set.
+func serveBlobHead(w http.ResponseWriter, desc distribution.Descriptor) {
+	mediaType := desc.MediaType
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, desc.Digest))
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", fmt.Sprint(desc.Size))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	_ "github.com/docker/distribution/registry/storage/driver/filesystem"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/metrics"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestForeignLayerRedirect(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Validation.Manifests.URLs.Allow = []string{"^https://example\\.com/"}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/foreign")
+	imageConfig := []byte(`{"architecture":"amd64","os":"windows"}`)
+	configDigest := digest.FromBytes(imageConfig)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(imageConfig))
+
+	// a layer pushed along with its URLs is served from the repository
+	pushedLayer := []byte("pushed layer")
+	pushedDigest := digest.FromBytes(pushedLayer)
+	uploadURLBase, _ = startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, pushedDigest, uploadURLBase, bytes.NewReader(pushedLayer))
+
+	foreignDigest := digest.FromString("foreign layer")
+	foreignURL := "https://example.com/layers/" + foreignDigest.Hex()
+	m := &schema2.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 2,
+			MediaType:     schema2.MediaTypeManifest,
+		},
+		Config: distribution.Descriptor{
+			MediaType: schema2.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(imageConfig)),
+		},
+		Layers: []distribution.Descriptor{{
+			MediaType: schema2.MediaTypeForeignLayer,
+			Digest:    foreignDigest,
+			Size:      1234,
+			URLs:      []string{foreignURL},
+		}, {
+			MediaType: schema2.MediaTypeLayer,
+			Digest:    pushedDigest,
+			Size:      int64(len(pushedLayer)),
+			URLs:      []string{"https://example.com/layers/" + pushedDigest.Hex()},
+		}},
+	}
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp := putManifest(t, "putting manifest with foreign layer", manifestURL, schema2.MediaTypeManifest, m)
+	resp.Body.Close()
+	checkResponse(t, "putting manifest with foreign layer", resp, http.StatusCreated)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, method := range []string{"GET", "HEAD"} {
+		ref, _ := reference.WithDigest(imageName, foreignDigest)
+		blobURL, err := env.builder.BuildBlobURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error building url: %v", err)
+		}
+		req, _ := http.NewRequest(method, blobURL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error fetching foreign layer: %v", err)
+		}
+		resp.Body.Close()
+		checkResponse(t, method+" foreign layer", resp, http.StatusTemporaryRedirect)
+		checkHeaders(t, resp, http.Header{
+			"Location":              []string{foreignURL},
+			"Docker-Content-Digest": []string{foreignDigest.String()},
+		})
+	}
+
+	// layers of other repositories are not redirected to
+	otherName, _ := reference.WithName("foo/other")
+	ref, _ := reference.WithDigest(otherName, foreignDigest)
+	blobURL, _ := env.builder.BuildBlobURL(ref)
+	resp, err = client.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching foreign layer: %v", err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "fetching foreign layer of another repository", resp, http.StatusNotFound)
+
+	ref, _ = reference.WithDigest(imageName, pushedDigest)
+	blobURL, _ = env.builder.BuildBlobURL(ref)
+	resp, err = client.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching pushed layer: %v", err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "fetching pushed layer with urls", resp, http.StatusOK)
+
+	// the layer is no longer redirected to once the manifest is deleted
+	deserialized, _ := schema2.FromStruct(*m)
+	_, payload, _ := deserialized.Payload()
+	digestRef, _ := reference.WithDigest(imageName, digest.FromBytes(payload))
+	digestURL, _ := env.builder.BuildManifestURL(digestRef)
+	resp, err = httpDelete(digestURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "deleting manifest with foreign layer", resp, http.StatusAccepted)
+
+	ref, _ = reference.WithDigest(imageName, foreignDigest)
+	blobURL, _ = env.builder.BuildBlobURL(ref)
+	resp, err = client.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching foreign layer: %v", err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "fetching foreign layer of a deleted manifest", resp, http.StatusNotFound)
+}
+
+// localFileRecorder records whether the content served was read from a
+// local file, as the HTTP server does before using sendfile.
+type localFileRecorder struct {
+	*httptest.ResponseRecorder
+	fromFile bool
+}
+
+func (w *localFileRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if lr, ok := r.(*io.LimitedReader); ok {
+		r = lr.R
+	}
+	_, w.fromFile = r.(*os.File)
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+func TestServeBlobFromLocalFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "localfile-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"filesystem": configuration.Parameters{"rootdirectory": root},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Middleware: map[string][]configuration.Middleware{
+			"storage": {{Name: "metrics"}},
+		},
+	}
+	ctx := context.Background()
+	app := NewApp(ctx, config)
+
+	name, _ := reference.WithName("foo/local")
+	repo, err := app.registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("content served from a local file")
+	desc, err := repo.Blobs(ctx).Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	// the file is handed to the HTTP server through the storage middleware
+	// and the response writers of the registry
+	w := &localFileRecorder{ResponseRecorder: httptest.NewRecorder()}
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/v2/foo/local/blobs/"+desc.Digest.String(), nil))
+	if w.Code != http.StatusOK || w.Body.String() != string(content) {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+	if !w.fromFile {
+		t.Fatal("expected the blob to be served from a local file")
+	}
+}
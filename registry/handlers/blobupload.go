@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -29,9 +32,9 @@ func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
 	}
 
 	if !ctx.readOnly {
-		handler["POST"] = http.HandlerFunc(buh.StartBlobUpload)
-		handler["PATCH"] = http.HandlerFunc(buh.PatchBlobData)
-		handler["PUT"] = http.HandlerFunc(buh.PutBlobUploadComplete)
+		handler["POST"] = limitUploadQuota(ctx, ctx.tenant.uploadLimiter.limit(ctx, ctx.memory.limit(ctx, memoryUpload, ctx.memory.uploadMemory, http.HandlerFunc(buh.StartBlobUpload))))
+		handler["PATCH"] = limitUploadQuota(ctx, ctx.tenant.uploadLimiter.limit(ctx, ctx.memory.limit(ctx, memoryUpload, ctx.memory.uploadMemory, http.HandlerFunc(buh.PatchBlobData))))
+		handler["PUT"] = limitUploadQuota(ctx, ctx.tenant.uploadLimiter.limit(ctx, ctx.memory.limit(ctx, memoryUpload, ctx.memory.uploadMemory, http.HandlerFunc(buh.PutBlobUploadComplete))))
 		handler["DELETE"] = http.HandlerFunc(buh.CancelBlobUpload)
 	}
 
@@ -63,6 +66,11 @@ type blobUploadHandler struct {
 func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Request) {
 	var options []distribution.BlobCreateOption
 
+	if err := buh.namespaces.checkQuota(buh, buh.Repository.Named().Name()); err != nil {
+		buh.Errors = append(buh.Errors, err)
+		return
+	}
+
 	fromRepo := r.FormValue("from")
 	mountDigest := r.FormValue("mount")
 
@@ -78,6 +86,7 @@ func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Req
 
 	if err != nil {
 		if ebm, ok := err.(distribution.ErrBlobMounted); ok {
+			buh.headCache.forget(headCacheBlob, buh.Repository.Named().Name(), ebm.Descriptor.Digest)
 			if err := buh.writeBlobCreatedHeaders(w, ebm.Descriptor); err != nil {
 				buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			}
@@ -91,6 +100,16 @@ func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Req
 
 	buh.Upload = upload
 
+	if expected := r.Header.Get("Docker-Upload-Length"); expected != "" {
+		size, err := strconv.ParseInt(expected, 10, 64)
+		if err != nil || size < 0 {
+			buh.Errors = append(buh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail("invalid Docker-Upload-Length"))
+			upload.Cancel(buh)
+			return
+		}
+		buh.State.ExpectedSize = size
+	}
+
 	if err := buh.blobUploadResponse(w, r, true); err != nil {
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
@@ -107,6 +126,13 @@ func (buh *blobUploadHandler) GetUploadStatus(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Progress must be captured before blobUploadResponse closes the upload,
+	// since closing flushes any buffered content to the backend.
+	progress := distribution.BlobWriteProgress{BytesPersisted: buh.Upload.Size()}
+	if reporter, ok := buh.Upload.(distribution.BlobWriteProgressReporter); ok {
+		progress = reporter.Progress()
+	}
+
 	// TODO(dmcgowan): Set last argument to false in blobUploadResponse when
 	// resumable upload is supported. This will enable returning a non-zero
 	// range for clients to begin uploading at an offset.
@@ -116,9 +142,35 @@ func (buh *blobUploadHandler) GetUploadStatus(w http.ResponseWriter, r *http.Req
 	}
 
 	w.Header().Set("Docker-Upload-UUID", buh.UUID)
+	w.Header().Set("Docker-Upload-Parts-Completed", strconv.Itoa(progress.PartsCompleted))
+	w.Header().Set("Docker-Upload-Bytes-Persisted", strconv.FormatInt(progress.BytesPersisted, 10))
+	w.Header().Set("Docker-Upload-Bytes-Buffered", strconv.FormatInt(progress.BytesBuffered, 10))
+	if eta, ok := estimateUploadCompletion(buh.State.StartedAt, time.Now(), buh.State.Offset, buh.State.ExpectedSize); ok {
+		w.Header().Set("Docker-Upload-Estimated-Completion", eta.UTC().Format(time.RFC3339))
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// estimateUploadCompletion extrapolates the completion time of an upload from
+// its average throughput so far. It returns false if no estimate can be made,
+// either because the expected size is unknown or nothing has been written.
+func estimateUploadCompletion(startedAt, now time.Time, written, expected int64) (time.Time, bool) {
+	if startedAt.IsZero() || written <= 0 || expected <= 0 {
+		return time.Time{}, false
+	}
+	if written >= expected {
+		return now, true
+	}
+
+	elapsed := now.Sub(startedAt)
+	if elapsed <= 0 {
+		return time.Time{}, false
+	}
+
+	remaining := time.Duration(float64(elapsed) * float64(expected-written) / float64(written))
+	return now.Add(remaining), true
+}
+
 // PatchBlobData writes data to an upload.
 func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Request) {
 	if buh.Upload == nil {
@@ -133,10 +185,35 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// TODO(dmcgowan): support Content-Range header to seek and write range
+	// A chunk announcing its range must continue the upload. Retried or
+	// reordered chunks are rejected before any of their content is written,
+	// with the current progress for the client to resume from.
+	if cr := r.Header.Get("Content-Range"); cr != "" {
+		start, end, err := parseContentRange(cr)
+		if err != nil {
+			buh.Errors = append(buh.Errors, v2.ErrorCodeRangeInvalid.WithDetail(err.Error()))
+			return
+		}
+		if offset := buh.Upload.Size(); start != offset {
+			w.Header().Set("Docker-Upload-UUID", buh.UUID)
+			w.Header().Set("Range", uploadRange(offset))
+			buh.Errors = append(buh.Errors, v2.ErrorCodeRangeInvalid.WithDetail(fmt.Sprintf("range starts at %d, the upload is at %d", start, offset)))
+			return
+		}
+		if r.ContentLength >= 0 && r.ContentLength != end-start+1 {
+			buh.Errors = append(buh.Errors, v2.ErrorCodeSizeInvalid.WithDetail(fmt.Sprintf("Content-Length %d does not match Content-Range %s", r.ContentLength, cr)))
+			return
+		}
+	}
 
-	if err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PATCH"); err != nil {
-		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
+	stop := buh.uploadGuard.guard(r)
+	err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PATCH")
+	stop()
+	if err == errUploadStalled || err == errUploadTooSlow {
+		buh.abortSlowUpload(err)
+		return
+	} else if err != nil {
+		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
 
@@ -145,6 +222,14 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// The digest is reported once blobUploadResponse has closed the upload,
+	// flushing its content.
+	if reporter, ok := buh.Upload.(distribution.BlobWriteDigestReporter); ok {
+		if dgst, size, ok := reporter.HashedDigest(); ok {
+			w.Header().Set("Docker-Upload-Digest", dgst.String())
+			w.Header().Set("Docker-Upload-Digest-Offset", strconv.FormatInt(size, 10))
+		}
+	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
@@ -174,8 +259,47 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 		return
 	}
 
-	if err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PUT"); err != nil {
-		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
+	// The digests announced for the body of a monolithic upload must match
+	// the digest of the blob, which spares writing a body known to be
+	// wrong.
+	bodyDigests, err := requestBodyDigests(r)
+	if err != nil {
+		buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err.Error()))
+		return
+	}
+	if buh.Upload.Size() == 0 {
+		// The body is the whole blob, so a body digest equal to the digest
+		// of the blob is verified by the commit, with the hash computed
+		// while writing. Verifying it as the body is read would hash the
+		// content twice.
+		var unverified []digest.Digest
+		for _, bodyDigest := range bodyDigests {
+			if bodyDigest.Algorithm() != dgst.Algorithm() {
+				unverified = append(unverified, bodyDigest)
+			} else if bodyDigest != dgst {
+				buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(fmt.Sprintf("body digest %s does not match blob digest %s", bodyDigest, dgst)))
+				return
+			}
+		}
+		bodyDigests = unverified
+	}
+
+	stop := buh.uploadGuard.guard(r)
+	r.Body = newVerifiedBody(r.Body, bodyDigests)
+	err = copyFullPayload(buh, w, r, buh.Upload, -1, "blob PUT")
+	stop()
+	if err == errUploadStalled || err == errUploadTooSlow {
+		buh.abortSlowUpload(err)
+		return
+	} else if err == errBodyDigestMismatch {
+		dcontext.GetLogger(buh).Warnf("canceling upload %s: %v", buh.UUID, err)
+		buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err.Error()))
+		if err := buh.Upload.Cancel(buh); err != nil {
+			dcontext.GetLogger(buh).Errorf("error canceling upload after error: %v", err)
+		}
+		return
+	} else if err != nil {
+		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
 
@@ -216,6 +340,8 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 
 		return
 	}
+	buh.headCache.forget(headCacheBlob, buh.Repository.Named().Name(), desc.Digest)
+
 	if err := buh.writeBlobCreatedHeaders(w, desc); err != nil {
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
@@ -248,6 +374,13 @@ func (buh *blobUploadHandler) ResumeBlobUpload(ctx *Context, r *http.Request) ht
 	}
 	buh.State = state
 
+	// Requests carrying another instance's hint were routed here after that
+	// instance failed or left the pool. The upload carries on from the state
+	// persisted in storage, and later requests follow the new hint.
+	if hint := requestUploadAffinity(r); hint != "" && ctx.uploadAffinity != "" && hint != ctx.uploadAffinity {
+		dcontext.GetLogger(ctx).Infof("upload %s moved from the instance of affinity %q", buh.UUID, hint)
+	}
+
 	if state.Name != ctx.Repository.Named().Name() {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			dcontext.GetLogger(ctx).Infof("mismatched repository name in upload state: %q != %q", state.Name, buh.Repository.Named().Name())
@@ -308,30 +441,63 @@ func (buh *blobUploadHandler) blobUploadResponse(w http.ResponseWriter, r *http.
 		return err
 	}
 
-	uploadURL, err := buh.urlBuilder.BuildBlobUploadChunkURL(
-		buh.Repository.Named(), buh.Upload.ID(),
-		url.Values{
-			"_state": []string{token},
-		})
+	values := url.Values{
+		"_state": []string{token},
+	}
+	if buh.uploadAffinity != "" {
+		values.Set(uploadAffinityParam, buh.uploadAffinity)
+		w.Header().Set(uploadAffinityHeader, buh.uploadAffinity)
+	}
+
+	uploadURL, err := buh.urlBuilder.BuildBlobUploadChunkURL(buh.Repository.Named(), buh.Upload.ID(), values)
 	if err != nil {
 		dcontext.GetLogger(buh).Infof("error building upload url: %s", err)
 		return err
 	}
 
-	endRange := buh.Upload.Size()
-	if endRange > 0 {
-		endRange = endRange - 1
-	}
-
 	w.Header().Set("Docker-Upload-UUID", buh.UUID)
 	w.Header().Set("Location", uploadURL)
 
 	w.Header().Set("Content-Length", "0")
-	w.Header().Set("Range", fmt.Sprintf("0-%d", endRange))
+	w.Header().Set("Range", uploadRange(buh.Upload.Size()))
 
 	return nil
 }
 
+// uploadRange formats the Range header reporting the progress of an upload of
+// size bytes.
+func uploadRange(size int64) string {
+	endRange := size
+	if endRange > 0 {
+		endRange = endRange - 1
+	}
+	return fmt.Sprintf("0-%d", endRange)
+}
+
+// parseContentRange parses the Content-Range of a chunk, "<start>-<end>" with
+// an inclusive end. The "bytes" unit and a complete length, as in
+// "bytes 0-99/1000", are accepted as well. The range of an empty chunk ends
+// right before its start.
+func parseContentRange(cr string) (start, end int64, err error) {
+	rng := strings.TrimPrefix(cr, "bytes ")
+	if i := strings.IndexByte(rng, '/'); i >= 0 {
+		rng = rng[:i]
+	}
+	parts := strings.SplitN(rng, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", cr)
+	}
+	start, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", cr)
+	}
+	end, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < start-1 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", cr)
+	}
+	return start, end, nil
+}
+
 // mountBlob attempts to mount a blob from another repository by its digest. If
 // successful, the blob is linked into the blob store and 201 Created is
 // returned with the canonical url of the blob.
@@ -341,7 +507,7 @@ func (buh *blobUploadHandler) createBlobMountOption(fromRepo, mountDigest string
 		return nil, err
 	}
 
-	ref, err := reference.WithName(fromRepo)
+	ref, err := buh.nameValidator.WithName(fromRepo)
 	if err != nil {
 		return nil, err
 	}
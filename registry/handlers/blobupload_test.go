@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestEstimateUploadCompletion(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(10 * time.Second)
+
+	for _, tc := range []struct {
+		name     string
+		started  time.Time
+		written  int64
+		expected int64
+		eta      time.Time
+		ok       bool
+	}{
+		{name: "unknown size", started: start, written: 100, expected: 0},
+		{name: "nothing written", started: start, written: 0, expected: 100},
+		{name: "unknown start", written: 10, expected: 100},
+		{name: "half way", started: start, written: 50, expected: 100, eta: now.Add(10 * time.Second), ok: true},
+		{name: "a quarter", started: start, written: 25, expected: 100, eta: now.Add(30 * time.Second), ok: true},
+		{name: "complete", started: start, written: 100, expected: 100, eta: now, ok: true},
+	} {
+		eta, ok := estimateUploadCompletion(tc.started, now, tc.written, tc.expected)
+		if ok != tc.ok {
+			t.Errorf("%s: unexpected ok: %v != %v", tc.name, ok, tc.ok)
+			continue
+		}
+		if ok && !eta.Equal(tc.eta) {
+			t.Errorf("%s: unexpected estimate: %v != %v", tc.name, eta, tc.eta)
+		}
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, tc := range []struct {
+		cr         string
+		start, end int64
+		invalid    bool
+	}{
+		{cr: "0-99", start: 0, end: 99},
+		{cr: "100-199", start: 100, end: 199},
+		{cr: "bytes 100-199/1000", start: 100, end: 199},
+		{cr: "bytes 100-199/*", start: 100, end: 199},
+		{cr: "100-99", start: 100, end: 99},
+		{cr: "0--1", start: 0, end: -1},
+		{cr: "100-98", invalid: true},
+		{cr: "-1-5", invalid: true},
+		{cr: "100", invalid: true},
+		{cr: "a-b", invalid: true},
+	} {
+		start, end, err := parseContentRange(tc.cr)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.cr)
+			}
+			continue
+		}
+		if err != nil || start != tc.start || end != tc.end {
+			t.Errorf("%s: unexpected range %d-%d: %v", tc.cr, start, end, err)
+		}
+	}
+}
+
+// TestChunkedUploadContentRange checks chunks are only written when their
+// Content-Range continues the upload, so that a client retrying a chunk does
+// not corrupt the blob, and that the digest of the content received is
+// reported after each chunk.
+func TestChunkedUploadContentRange(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/chunks")
+	content := []byte("first chunk, second chunk")
+	first, second := content[:13], content[13:]
+
+	patch := func(msg, location, cr string, body io.Reader, status int) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("PATCH", location, body)
+		req.Header.Set("Content-Range", cr)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+		if status >= 400 {
+			checkBodyHasErrorCodes(t, msg, resp, map[int]errcode.ErrorCode{
+				http.StatusBadRequest:                   v2.ErrorCodeSizeInvalid,
+				http.StatusRequestedRangeNotSatisfiable: v2.ErrorCodeRangeInvalid,
+			}[status])
+		}
+		return resp
+	}
+
+	location, _ := startPushLayer(t, env, name)
+	resp := patch("first chunk", location, fmt.Sprintf("0-%d", len(first)-1), bytes.NewReader(first), http.StatusAccepted)
+	location = resp.Header.Get("Location")
+	// the digest of the content received so far lets the client check it
+	checkHeaders(t, resp, http.Header{
+		"Docker-Upload-Digest":        {digest.FromBytes(first).String()},
+		"Docker-Upload-Digest-Offset": {fmt.Sprint(len(first))},
+	})
+
+	// the first chunk is retried
+	resp = patch("retried chunk", location, fmt.Sprintf("0-%d", len(first)-1), bytes.NewReader(first), http.StatusRequestedRangeNotSatisfiable)
+	checkHeaders(t, resp, http.Header{"Range": {fmt.Sprintf("0-%d", len(first)-1)}})
+
+	// a chunk is sent ahead of a lost one
+	patch("out of order chunk", location, fmt.Sprintf("%d-%d", len(content), len(content)+4), bytes.NewReader([]byte("chunk")), http.StatusRequestedRangeNotSatisfiable)
+	patch("invalid range", location, "13", bytes.NewReader(second), http.StatusRequestedRangeNotSatisfiable)
+	patch("short chunk", location, fmt.Sprintf("13-%d", len(content)), bytes.NewReader(second), http.StatusBadRequest)
+
+	// the length of chunks sent with a chunked transfer encoding is unknown
+	resp = patch("second chunk", location, fmt.Sprintf("bytes 13-%d/%d", len(content)-1, len(content)), io.MultiReader(bytes.NewReader(second)), http.StatusAccepted)
+	checkHeaders(t, resp, http.Header{
+		"Range":                       {fmt.Sprintf("0-%d", len(content)-1)},
+		"Docker-Upload-Digest":        {digest.FromBytes(content).String()},
+		"Docker-Upload-Digest-Offset": {fmt.Sprint(len(content))},
+	})
+	finishUpload(t, env.builder, name, resp.Header.Get("Location"), digest.FromBytes(content))
+}
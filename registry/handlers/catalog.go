@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 
 	"github.com/docker/distribution/registry/api/errcode"
@@ -45,21 +46,30 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 
 	repos := make([]string, maxEntries)
 
-	filled, err := ch.App.registry.Repositories(ch.Context, repos, lastEntry)
-	_, pathNotFound := err.(driver.PathNotFoundError)
+	var filled int
+	if storages := ch.App.storageTenants(); len(storages) > 1 {
+		filled, moreEntries, err = ch.mergedRepositories(storages, repos, lastEntry)
+		if err != nil {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	} else {
+		filled, err = ch.App.registry.Repositories(ch.Context, repos, lastEntry)
+		_, pathNotFound := err.(driver.PathNotFoundError)
 
-	if err == io.EOF || pathNotFound {
-		moreEntries = false
-	} else if err != nil {
-		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
-		return
+		if err == io.EOF || pathNotFound {
+			moreEntries = false
+		} else if err != nil {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
 	// Add a link header if there are more entries to retrieve
-	if moreEntries {
-		lastEntry = repos[len(repos)-1]
+	if moreEntries && filled > 0 {
+		lastEntry = repos[filled-1]
 		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, lastEntry)
 		if err != nil {
 			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
@@ -77,6 +87,55 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// mergedRepositories fills repos with the repositories following last in
+// the storages of the tenants, in order. Repositories are only listed from
+// the storage of the tenant serving them. It reports whether more follow.
+func (ch *catalogHandler) mergedRepositories(storages []*tenant, repos []string, last string) (int, bool, error) {
+	if len(repos) == 0 {
+		return 0, false, nil
+	}
+
+	var merged []string
+	more := false
+	for _, t := range storages {
+		names, tenantMore, err := ch.storageRepositories(t, len(repos), last)
+		if err != nil {
+			return 0, false, err
+		}
+		merged = append(merged, names...)
+		more = more || tenantMore
+	}
+	sort.Strings(merged)
+	if len(merged) > len(repos) {
+		merged = merged[:len(repos)]
+		more = true
+	}
+	return copy(repos, merged), more, nil
+}
+
+// storageRepositories lists up to n repositories following last in the
+// storage of the tenant which it serves, and reports whether more follow.
+func (ch *catalogHandler) storageRepositories(t *tenant, n int, last string) ([]string, bool, error) {
+	var names []string
+	page := make([]string, n)
+	for len(names) < n {
+		filled, err := t.registry.Repositories(ch.Context, page, last)
+		for _, name := range page[:filled] {
+			if ch.App.serves(t, name) {
+				names = append(names, name)
+			}
+		}
+		if _, ok := err.(driver.PathNotFoundError); ok || err == io.EOF || filled == 0 {
+			return names, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		last = page[filled-1]
+	}
+	return names[:n], true, nil
+}
+
 // Use the original URL from the request to create a new URL for
 // the link header
 func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string, error) {
@@ -85,9 +144,10 @@ func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string,
 		return "", err
 	}
 
-	v := url.Values{}
-	v.Add("n", strconv.Itoa(maxEntries))
-	v.Add("last", lastEntry)
+	// Keep other parameters, such as the order of tags
+	v := calledURL.Query()
+	v.Set("n", strconv.Itoa(maxEntries))
+	v.Set("last", lastEntry)
 
 	calledURL.RawQuery = v.Encode()
 
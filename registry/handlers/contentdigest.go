@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	_ "crypto/sha256" // register the digest algorithms of Content-Digest
+	_ "crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// errBodyDigestMismatch is returned when the body of a request does not match
+// the digests announced in its headers.
+var errBodyDigestMismatch = errors.New("request body does not match its announced digest")
+
+// contentDigestAlgorithms maps the algorithms of the Content-Digest header to
+// those of blob digests. Other algorithms are ignored.
+var contentDigestAlgorithms = map[string]digest.Algorithm{
+	"sha-256": digest.SHA256,
+	"sha-512": digest.SHA512,
+}
+
+// requestBodyDigests returns the digests of the body of r announced in its
+// Content-Digest header, as defined by RFC 9530, and in its
+// Docker-Content-Digest header.
+func requestBodyDigests(r *http.Request) ([]digest.Digest, error) {
+	var digests []digest.Digest
+
+	for _, header := range r.Header["Content-Digest"] {
+		for _, member := range strings.Split(header, ",") {
+			parts := strings.SplitN(strings.TrimSpace(member), "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid Content-Digest %q", header)
+			}
+			alg, ok := contentDigestAlgorithms[strings.ToLower(parts[0])]
+			if !ok {
+				continue
+			}
+			// the value is a structured field byte sequence, :base64:
+			value := parts[1]
+			if i := strings.IndexByte(value, ';'); i >= 0 {
+				value = value[:i]
+			}
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				return nil, fmt.Errorf("invalid Content-Digest %q", header)
+			}
+			sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+			if err != nil || len(sum) != alg.Size() {
+				return nil, fmt.Errorf("invalid %s Content-Digest %q", parts[0], header)
+			}
+			digests = append(digests, digest.NewDigestFromBytes(alg, sum))
+		}
+	}
+
+	if header := r.Header.Get("Docker-Content-Digest"); header != "" {
+		dgst, err := digest.Parse(header)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Docker-Content-Digest %q: %v", header, err)
+		}
+		digests = append(digests, dgst)
+	}
+
+	return digests, nil
+}
+
+// verifiedBody is a request body failing with errBodyDigestMismatch at its
+// end if it does not match the announced digests, so that a corrupted body
+// is rejected before the upload is committed.
+type verifiedBody struct {
+	io.ReadCloser
+	verifiers []digest.Verifier
+}
+
+func newVerifiedBody(body io.ReadCloser, digests []digest.Digest) io.ReadCloser {
+	if len(digests) == 0 {
+		return body
+	}
+
+	vb := &verifiedBody{ReadCloser: body}
+	for _, dgst := range digests {
+		vb.verifiers = append(vb.verifiers, dgst.Verifier())
+	}
+	return vb
+}
+
+func (b *verifiedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	for _, verifier := range b.verifiers {
+		verifier.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		for _, verifier := range b.verifiers {
+			if !verifier.Verified() {
+				return n, errBodyDigestMismatch
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestRequestBodyDigests(t *testing.T) {
+	content := []byte("content")
+	sum256 := sha256.Sum256(content)
+	sum512 := sha512.Sum512(content)
+	encoded256 := base64.StdEncoding.EncodeToString(sum256[:])
+	encoded512 := base64.StdEncoding.EncodeToString(sum512[:])
+
+	for _, testcase := range []struct {
+		header   http.Header
+		expected []digest.Digest
+		invalid  bool
+	}{
+		{header: http.Header{}},
+		{
+			header:   http.Header{"Content-Digest": {"sha-256=:" + encoded256 + ":"}},
+			expected: []digest.Digest{digest.FromBytes(content)},
+		},
+		{
+			header:   http.Header{"Content-Digest": {"md5=:c3BhbQ==:, SHA-512=:" + encoded512 + ":"}},
+			expected: []digest.Digest{digest.SHA512.FromBytes(content)},
+		},
+		{
+			header:   http.Header{"Docker-Content-Digest": {digest.FromBytes(content).String()}},
+			expected: []digest.Digest{digest.FromBytes(content)},
+		},
+		{header: http.Header{"Content-Digest": {"sha-256=" + encoded256}}, invalid: true},
+		{header: http.Header{"Content-Digest": {"sha-256=:c3BhbQ==:"}}, invalid: true},
+		{header: http.Header{"Docker-Content-Digest": {"sha256:spam"}}, invalid: true},
+	} {
+		r := &http.Request{Header: testcase.header}
+		digests, err := requestBodyDigests(r)
+		if testcase.invalid {
+			if err == nil {
+				t.Fatalf("%v: expected an error", testcase.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", testcase.header, err)
+		}
+		if len(digests) != len(testcase.expected) || (len(digests) > 0 && digests[0] != testcase.expected[0]) {
+			t.Fatalf("%v: expected %v, got %v", testcase.header, testcase.expected, digests)
+		}
+	}
+}
+
+func TestContentDigestUploads(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/contentdigest")
+	content := []byte("layer content")
+	dgst := digest.FromBytes(content)
+	sum := sha512.Sum512(content)
+	contentDigest := "sha-512=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	put := func(location string, dgst digest.Digest, body []byte, contentDigest string) *http.Response {
+		t.Helper()
+		u, err := url.Parse(location)
+		if err != nil {
+			t.Fatalf("unexpected error parsing location: %v", err)
+		}
+		u.RawQuery = url.Values{"_state": u.Query()["_state"], "digest": {dgst.String()}}.Encode()
+		req, _ := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
+		req.Header.Set("Content-Digest", contentDigest)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error putting upload: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// A body digest contradicting the blob digest is rejected before the
+	// body is read, and the upload can be retried
+	location, _ := startPushLayer(t, env, name)
+	other := sha256.Sum256([]byte("other content"))
+	resp := put(location, dgst, content, "sha-256=:"+base64.StdEncoding.EncodeToString(other[:])+":")
+	checkResponse(t, "contradicting digests", resp, http.StatusBadRequest)
+	resp = put(location, dgst, content, contentDigest)
+	checkResponse(t, "retried upload", resp, http.StatusCreated)
+
+	// A body not matching its digest cancels the upload
+	location, _ = startPushLayer(t, env, name)
+	corrupted := append([]byte{}, content...)
+	corrupted[0] = 'L'
+	resp = put(location, digest.FromBytes(corrupted), corrupted, contentDigest)
+	checkResponse(t, "corrupted body", resp, http.StatusBadRequest)
+
+	status, err := http.Get(location)
+	if err != nil {
+		t.Fatalf("unexpected error getting upload status: %v", err)
+	}
+	defer status.Body.Close()
+	checkResponse(t, "corrupted upload status", status, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "corrupted upload status", status, v2.ErrorCodeBlobUploadUnknown)
+
+	// A body digest equal to the blob digest is verified by the commit
+	location, _ = startPushLayer(t, env, name)
+	blobSum := sha256.Sum256(content)
+	resp = put(location, dgst, corrupted, "sha-256=:"+base64.StdEncoding.EncodeToString(blobSum[:])+":")
+	checkResponse(t, "corrupted body with blob digest", resp, http.StatusBadRequest)
+
+	status, err = http.Get(location)
+	if err != nil {
+		t.Fatalf("unexpected error getting upload status: %v", err)
+	}
+	defer status.Body.Close()
+	checkResponse(t, "canceled upload status", status, http.StatusNotFound)
+}
@@ -35,6 +35,9 @@ type Context struct {
 
 	urlBuilder *v2.URLBuilder
 
+	// tenant serves the requested repository or namespace.
+	tenant *tenant
+
 	// TODO(stevvooe): The goal is too completely factor this context and
 	// dispatching out of the web application. Ideally, we should lean on
 	// context.Context for injection of these resources.
@@ -50,6 +53,10 @@ func getName(ctx context.Context) (name string) {
 	return dcontext.GetStringValue(ctx, "vars.name")
 }
 
+func getNamespace(ctx context.Context) (namespace string) {
+	return dcontext.GetStringValue(ctx, "vars.namespace")
+}
+
 func getReference(ctx context.Context) (reference string) {
 	return dcontext.GetStringValue(ctx, "vars.reference")
 }
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+)
+
+var (
+	defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	defaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", "Content-Range", "Range"}
+
+	// defaultCORSExposedHeaders are the response headers of the API which
+	// are not safelisted, and so hidden from cross-origin callers unless
+	// exposed.
+	defaultCORSExposedHeaders = []string{
+		"Content-Range",
+		"Docker-Content-Digest",
+		"Docker-Distribution-Api-Version",
+		"Docker-Upload-Uuid",
+		"Link",
+		"Location",
+		"Range",
+		"Www-Authenticate",
+	}
+)
+
+// cors answers cross-origin requests from the allowed origins. A nil cors
+// answers none.
+type cors struct {
+	origins   map[string]struct{}
+	anyOrigin bool
+	methods   map[string]struct{}
+	headers   map[string]struct{}
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// newCORS returns the cors for the given configuration, or nil if no origin
+// is allowed.
+func newCORS(config configuration.CORS) *cors {
+	if len(config.AllowedOrigins) == 0 {
+		return nil
+	}
+
+	c := &cors{
+		origins: make(map[string]struct{}),
+		methods: make(map[string]struct{}),
+		headers: make(map[string]struct{}),
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+		}
+		c.origins[strings.ToLower(origin)] = struct{}{}
+	}
+
+	allowedMethods := config.AllowedMethods
+	if len(allowedMethods) == 0 {
+		allowedMethods = defaultCORSMethods
+	}
+	var methods []string
+	for _, method := range allowedMethods {
+		method = strings.ToUpper(method)
+		c.methods[method] = struct{}{}
+		methods = append(methods, method)
+	}
+	allowedHeaders := config.AllowedHeaders
+	if len(allowedHeaders) == 0 {
+		allowedHeaders = defaultCORSHeaders
+	}
+	var headers []string
+	for _, header := range allowedHeaders {
+		header = http.CanonicalHeaderKey(header)
+		c.headers[header] = struct{}{}
+		headers = append(headers, header)
+	}
+	exposed := config.ExposedHeaders
+	if len(exposed) == 0 {
+		exposed = defaultCORSExposedHeaders
+	}
+
+	c.allowMethods = strings.Join(methods, ", ")
+	c.allowHeaders = strings.Join(headers, ", ")
+	c.exposeHeaders = strings.Join(exposed, ", ")
+	if config.MaxAge > 0 {
+		c.maxAge = fmt.Sprint(int64(config.MaxAge.Seconds()))
+	}
+	return c
+}
+
+// handle adds the CORS headers to the response to r, if it comes from an
+// allowed origin. If r is a preflight request, it returns the status to
+// answer it with; otherwise it returns zero and r is served as usual.
+func (c *cors) handle(w http.ResponseWriter, r *http.Request) int {
+	if c == nil {
+		return 0
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return 0
+	}
+	w.Header().Add("Vary", "Origin")
+	if !c.allowed(origin) {
+		return 0
+	}
+
+	if c.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	if r.Method != "OPTIONS" || method == "" {
+		w.Header().Set("Access-Control-Expose-Headers", c.exposeHeaders)
+		return 0
+	}
+
+	// Preflight requests only succeed if the method and all headers of the
+	// actual request are allowed.
+	status := http.StatusNoContent
+	if _, ok := c.methods[method]; !ok {
+		status = http.StatusForbidden
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		if _, ok := c.headers[header]; !ok {
+			status = http.StatusForbidden
+		}
+	}
+	if status == http.StatusNoContent {
+		w.Header().Set("Access-Control-Allow-Methods", c.allowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", c.allowHeaders)
+		if c.maxAge != "" {
+			w.Header().Set("Access-Control-Max-Age", c.maxAge)
+		}
+	}
+	return status
+}
+
+func (c *cors) allowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	_, ok := c.origins[strings.ToLower(origin)]
+	return ok
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+func TestCORS(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.CORS = configuration.CORS{
+		AllowedOrigins: []string{"https://ui.example.com"},
+		MaxAge:         10 * time.Minute,
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	baseURL, err := env.builder.BuildBaseURL()
+	if err != nil {
+		t.Fatalf("unexpected error building base url: %v", err)
+	}
+	name, _ := reference.WithName("foo/bar")
+	tagsURL, err := env.builder.BuildTagsURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building tags url: %v", err)
+	}
+
+	do := func(msg, method, u string, header http.Header, status int) http.Header {
+		t.Helper()
+		req, _ := http.NewRequest(method, u, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+		return resp.Header
+	}
+
+	header := do("preflight", "OPTIONS", tagsURL, http.Header{
+		"Origin":                         {"https://ui.example.com"},
+		"Access-Control-Request-Method":  {"GET"},
+		"Access-Control-Request-Headers": {"authorization, accept"},
+	}, http.StatusNoContent)
+	checkHeaders(t, &http.Response{Header: header}, http.Header{
+		"Access-Control-Allow-Origin":  {"https://ui.example.com"},
+		"Access-Control-Allow-Methods": {"GET, HEAD, POST, PUT, PATCH, DELETE"},
+		"Access-Control-Allow-Headers": {"Accept, Authorization, Content-Type, Content-Range, Range"},
+		"Access-Control-Max-Age":       {"600"},
+		"Vary":                         {"Origin"},
+	})
+
+	header = do("preflight with a disallowed header", "OPTIONS", tagsURL, http.Header{
+		"Origin":                         {"https://ui.example.com"},
+		"Access-Control-Request-Method":  {"GET"},
+		"Access-Control-Request-Headers": {"X-Custom"},
+	}, http.StatusForbidden)
+	if header.Get("Access-Control-Allow-Methods") != "" {
+		t.Fatalf("unexpected allowed methods for a disallowed header: %v", header)
+	}
+
+	do("preflight with a disallowed method", "OPTIONS", tagsURL, http.Header{
+		"Origin":                        {"https://ui.example.com"},
+		"Access-Control-Request-Method": {"TRACE"},
+	}, http.StatusForbidden)
+
+	header = do("request", "GET", baseURL, http.Header{
+		"Origin": {"https://ui.example.com"},
+	}, http.StatusOK)
+	if header.Get("Access-Control-Allow-Origin") != "https://ui.example.com" || header.Get("Access-Control-Expose-Headers") == "" {
+		t.Fatalf("missing cors headers: %v", header)
+	}
+
+	header = do("request from another origin", "GET", baseURL, http.Header{
+		"Origin": {"https://evil.example.com"},
+	}, http.StatusOK)
+	if header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("unexpected cors headers for a disallowed origin: %v", header)
+	}
+
+	header = do("same-origin request", "GET", baseURL, nil, http.StatusOK)
+	if header.Get("Access-Control-Allow-Origin") != "" || header.Get("Vary") != "" {
+		t.Fatalf("unexpected cors headers without an origin: %v", header)
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	c := newCORS(configuration.CORS{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"get"},
+	})
+	if !c.allowed("https://anything.example.com") {
+		t.Fatal("expected any origin to be allowed")
+	}
+	if _, ok := c.methods["GET"]; !ok || c.allowMethods != "GET" {
+		t.Fatalf("unexpected allowed methods: %q", c.allowMethods)
+	}
+	if len(defaultCORSMethods) != 6 || defaultCORSMethods[0] != "GET" {
+		t.Fatalf("default methods modified: %v", defaultCORSMethods)
+	}
+
+	if newCORS(configuration.CORS{}) != nil {
+		t.Fatal("expected cors to be disabled without allowed origins")
+	}
+}
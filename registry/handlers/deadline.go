@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+)
+
+// withDeadline bounds the whole processing of the requests served by handler.
+// Past the deadline, the context of the request is cancelled and its body
+// aborted, closing the connection of HTTP/1 clients, which also interrupts
+// the writing of the response. A deadline of zero leaves handler as is.
+func withDeadline(handler http.Handler, deadline time.Duration) http.Handler {
+	if deadline <= 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), deadline)
+		defer cancel()
+
+		timer := time.AfterFunc(deadline, func() {
+			dcontext.GetLogger(ctx).Warnf("aborting request past its deadline of %v", deadline)
+			abortRequestBody(r, r.Body)
+		})
+		defer timer.Stop()
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+func TestRouteDeadlines(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Timeouts.Routes = map[string]time.Duration{
+		v2.RouteNameBlobUploadChunk: 300 * time.Millisecond,
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	server := httptest.NewUnstartedServer(env.app)
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	defer server.Close()
+	env.server = server
+	builder, err := v2.NewURLBuilderFromString(server.URL, false)
+	if err != nil {
+		t.Fatalf("error creating url builder: %v", err)
+	}
+	env.builder = builder
+
+	// Routes without a deadline are served as usual
+	name, _ := reference.WithName("foo/deadline")
+	location, _ := startPushLayer(t, env, name)
+
+	// A request to a route with a deadline is aborted past it
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("error parsing location: %v", err)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "PATCH %s HTTP/1.1\r\nHost: %s\r\nContent-Length: 100\r\n\r\n0123456789", u.RequestURI(), u.Host)
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+		t.Fatalf("expected the connection of a request past its deadline to be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatalf("request past its deadline was not aborted")
+	}
+}
+
+func TestRouteDeadlinesUnknownRoute(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Timeouts.Routes = map[string]time.Duration{"blobs": time.Minute}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected an unknown route to be rejected")
+		}
+	}()
+	newTestEnvWithConfig(t, &config)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// eventsDispatcher constructs the handler listing the events of a repository.
+func eventsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	eventsHandler := &eventsHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(eventsHandler.GetEvents),
+	}
+}
+
+// eventsHandler handles requests for the timeline of a repository.
+type eventsHandler struct {
+	*Context
+}
+
+type eventsAPIResponse struct {
+	Name   string                         `json:"name"`
+	Events []distribution.RepositoryEvent `json:"events"`
+}
+
+// GetEvents returns a page of the events of the repository as json, newest
+// first. The page holds the events older than the id given as last.
+func (eh *eventsHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	eventLog, ok := eh.tenant.registry.(distribution.RepositoryEventLog)
+	if !ok {
+		eh.Errors = append(eh.Errors, errcode.ErrorCodeUnsupported.WithDetail("repository events are not recorded by this registry"))
+		return
+	}
+
+	q := r.URL.Query()
+	maxEntries := maximumReturnedEntries
+	if n := q.Get("n"); n != "" {
+		var err error
+		maxEntries, err = strconv.Atoi(n)
+		if err != nil || maxEntries <= 0 {
+			eh.Errors = append(eh.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(n))
+			return
+		}
+	}
+	var before int64
+	if last := q.Get("last"); last != "" {
+		var err error
+		before, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || before <= 0 {
+			eh.Errors = append(eh.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(last))
+			return
+		}
+	}
+
+	events := make([]distribution.RepositoryEvent, maxEntries)
+	filled, err := eventLog.RepositoryEvents(eh, eh.Repository.Named(), events, before)
+	moreEntries := err == nil
+	if err != nil && err != io.EOF {
+		if err == distribution.ErrUnsupported {
+			eh.Errors = append(eh.Errors, errcode.ErrorCodeUnsupported.WithDetail("repository events are not recorded by this registry"))
+		} else {
+			eh.Errors = append(eh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if moreEntries && filled > 0 {
+		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, strconv.FormatInt(events[filled-1].ID, 10))
+		if err != nil {
+			eh.Errors = append(eh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		w.Header().Set("Link", urlStr)
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(eventsAPIResponse{
+		Name:   eh.Repository.Named().Name(),
+		Events: events[:filled],
+	}); err != nil {
+		eh.Errors = append(eh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+func TestRepositoryEvents(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	config.Timeline.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	first := createRepository(env, t, "foo/events", "v1")
+	second := createRepository(env, t, "foo/events", "v2")
+
+	name, _ := reference.WithName("foo/events")
+	eventsURL, err := env.builder.BuildEventsURL(name, url.Values{"n": []string{"3"}})
+	if err != nil {
+		t.Fatalf("unexpected error building events url: %v", err)
+	}
+
+	var events []distribution.RepositoryEvent
+	for eventsURL != "" {
+		resp, err := http.Get(eventsURL)
+		if err != nil {
+			t.Fatalf("unexpected error getting events: %v", err)
+		}
+		checkResponse(t, "getting events", resp, http.StatusOK)
+
+		var body eventsAPIResponse
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("unexpected error decoding events: %v", err)
+		}
+		if body.Name != "foo/events" {
+			t.Fatalf("unexpected repository name: %q", body.Name)
+		}
+		events = append(events, body.Events...)
+
+		eventsURL = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			matches := regexp.MustCompile("<(.*)>; rel=\"next\"").FindStringSubmatch(link)
+			if len(matches) != 2 {
+				t.Fatalf("unexpected link header: %q", link)
+			}
+			next, err := url.Parse(matches[1])
+			if err != nil {
+				t.Fatalf("unexpected error parsing link: %v", err)
+			}
+			base, _ := url.Parse(env.server.URL)
+			eventsURL = base.ResolveReference(next).String()
+		}
+	}
+
+	expected := []distribution.RepositoryEvent{
+		{Action: distribution.RepositoryEventTag, Digest: second, Tag: "v2"},
+		{Action: distribution.RepositoryEventPush, Digest: second},
+		{Action: distribution.RepositoryEventTag, Digest: first, Tag: "v1"},
+		{Action: distribution.RepositoryEventPush, Digest: first},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, event := range events {
+		if event.Action != expected[i].Action || event.Digest != expected[i].Digest || event.Tag != expected[i].Tag {
+			t.Fatalf("event %d: expected %+v, got %+v", i, expected[i], event)
+		}
+	}
+}
+
+func TestRepositoryEventsDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/events")
+	eventsURL, err := env.builder.BuildEventsURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building events url: %v", err)
+	}
+	resp, err := http.Get(eventsURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting events: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting events", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "getting events", resp, errcode.ErrorCodeUnsupported)
+}
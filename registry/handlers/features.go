@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/gorilla/handlers"
+)
+
+// featuresDispatcher constructs the handler reporting the optional features
+// of the registry.
+func featuresDispatcher(ctx *Context, r *http.Request) http.Handler {
+	featuresHandler := &featuresHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(featuresHandler.GetFeatures),
+	}
+}
+
+// featuresHandler handles requests for the features of the registry.
+type featuresHandler struct {
+	*Context
+}
+
+type featuresAPIResponse struct {
+	APIVersion string          `json:"apiVersion"`
+	Features   map[string]bool `json:"features"`
+}
+
+// GetFeatures returns the optional features of the registry as json.
+func (fh *featuresHandler) GetFeatures(w http.ResponseWriter, r *http.Request) {
+	// features of the storage are only reported if the storages of all
+	// the tenants offer them
+	metadata, adminBlobs := true, true
+	for _, t := range fh.App.storageTenants() {
+		_, ok := t.registry.(distribution.RepositoryMetadataStore)
+		metadata = metadata && ok
+		_, ok = t.registry.(distribution.GlobalBlobServer)
+		adminBlobs = adminBlobs && ok
+	}
+
+	features := map[string]bool{
+		"delete":           fh.App.deleteEnabled && !fh.App.readOnly,
+		"readOnly":         fh.App.readOnly,
+		"pullThroughCache": fh.App.isCache,
+		"schema1":          fh.App.Config.Compatibility.Schema1.Enabled,
+		"statistics":       fh.App.pullStats != nil,
+		"bandwidth":        fh.App.bandwidth != nil,
+		"metadata":         metadata,
+		"signatures":       true,
+		"scanning":         fh.App.scanner != nil,
+		"namespaces":       fh.App.namespaces != nil && fh.App.namespaces.enumerator != nil,
+		"admission":        fh.App.admission != nil,
+		"tenants":          len(fh.App.tenants) > 0,
+		"adminBlobs":       adminBlobs,
+		"helm":             fh.App.Config.Helm.Enabled,
+		"timeline":         fh.App.Config.Timeline.Enabled && !fh.App.isCache,
+		"blobReferences":   fh.App.Config.ReferenceIndex.Enabled && adminBlobs,
+		"layerSharing":     fh.App.Config.ReferenceIndex.Enabled && adminBlobs,
+		"pullSize":         true,
+
+		// Not implemented by this registry. They are reported so that
+		// clients do not need to probe for them.
+		"referrers":   false,
+		"tagHistory":  false,
+		"softDelete":  false,
+		"replication": false,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(featuresAPIResponse{
+		APIVersion: "registry/2.0",
+		Features:   features,
+	}); err != nil {
+		fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
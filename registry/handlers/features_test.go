@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+)
+
+func TestFeaturesAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.PullStatistics.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	featuresURL, err := env.builder.BuildFeaturesURL()
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(featuresURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching features: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching features", resp, http.StatusOK)
+
+	var response featuresAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("error decoding features: %v", err)
+	}
+	if response.APIVersion != "registry/2.0" {
+		t.Fatalf("unexpected api version %q", response.APIVersion)
+	}
+
+	for feature, expected := range map[string]bool{
+		"delete":           true,
+		"readOnly":         false,
+		"pullThroughCache": false,
+		"statistics":       true,
+		"metadata":         true,
+		"namespaces":       true,
+		"scanning":         false,
+		"admission":        false,
+		"tenants":          false,
+		"adminBlobs":       true,
+		"referrers":        false,
+	} {
+		enabled, ok := response.Features[feature]
+		if !ok {
+			t.Errorf("feature %q is not reported", feature)
+		} else if enabled != expected {
+			t.Errorf("feature %q: expected %v, got %v", feature, expected, enabled)
+		}
+	}
+}
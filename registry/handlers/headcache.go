@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultHeadCacheTTL         = 5 * time.Second
+	defaultHeadCacheNegativeTTL = time.Second
+	defaultHeadCacheSize        = 10000
+)
+
+// headCacheKind separates the entries for blobs and manifests.
+type headCacheKind string
+
+const (
+	headCacheBlob     headCacheKind = "blob"
+	headCacheManifest headCacheKind = "manifest"
+)
+
+type headCacheKey struct {
+	kind   headCacheKind
+	repo   string
+	digest digest.Digest
+}
+
+type headCacheEntry struct {
+	desc    distribution.Descriptor
+	exists  bool
+	expires time.Time
+}
+
+// headCache remembers whether blobs and manifests of a repository exist, for
+// a short while, so that HEAD requests repeated during a push are answered
+// without going to storage. Entries are dropped when this instance changes
+// the blob or manifest; changes made through other instances are only seen
+// once the entry expires. A nil headCache caches nothing.
+type headCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+
+	mu      sync.Mutex
+	entries map[headCacheKey]headCacheEntry
+}
+
+// newHeadCache returns a cache for the given configuration, or nil if it is
+// disabled.
+func newHeadCache(config configuration.HeadCache) *headCache {
+	if !config.Enabled {
+		return nil
+	}
+
+	c := &headCache{
+		ttl:         config.TTL,
+		negativeTTL: config.NegativeTTL,
+		size:        config.Size,
+		entries:     make(map[headCacheKey]headCacheEntry),
+	}
+	if c.ttl <= 0 {
+		c.ttl = defaultHeadCacheTTL
+	}
+	if c.negativeTTL <= 0 {
+		c.negativeTTL = defaultHeadCacheNegativeTTL
+	}
+	if c.size <= 0 {
+		c.size = defaultHeadCacheSize
+	}
+	return c
+}
+
+// get returns the remembered result for a digest of a repository, with ok
+// set to false if there is none.
+func (c *headCache) get(kind headCacheKind, repo string, dgst digest.Digest) (desc distribution.Descriptor, exists bool, ok bool) {
+	if c == nil {
+		return distribution.Descriptor{}, false, false
+	}
+
+	key := headCacheKey{kind: kind, repo: repo, digest: dgst}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return distribution.Descriptor{}, false, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return distribution.Descriptor{}, false, false
+	}
+	return entry.desc, entry.exists, true
+}
+
+// found remembers that a digest of a repository exists.
+func (c *headCache) found(kind headCacheKind, repo string, desc distribution.Descriptor) {
+	c.put(headCacheKey{kind: kind, repo: repo, digest: desc.Digest}, headCacheEntry{desc: desc, exists: true})
+}
+
+// missing remembers that a digest of a repository does not exist.
+func (c *headCache) missing(kind headCacheKind, repo string, dgst digest.Digest) {
+	c.put(headCacheKey{kind: kind, repo: repo, digest: dgst}, headCacheEntry{})
+}
+
+func (c *headCache) put(key headCacheKey, entry headCacheEntry) {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	if entry.exists {
+		entry.expires = now.Add(c.ttl)
+	} else {
+		entry.expires = now.Add(c.negativeTTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, present := c.entries[key]; !present && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = entry
+}
+
+// evict makes room for an entry, dropping expired entries or, if there are
+// none, an arbitrary one. c.mu must be held.
+func (c *headCache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.size {
+		return
+	}
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
+
+// forget drops the result for a digest of a repository, after the blob or
+// manifest was pushed or deleted.
+func (c *headCache) forget(kind headCacheKind, repo string, dgst digest.Digest) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, headCacheKey{kind: kind, repo: repo, digest: dgst})
+}
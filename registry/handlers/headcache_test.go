@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestHeadCacheDisabled(t *testing.T) {
+	c := newHeadCache(configuration.HeadCache{})
+	if c != nil {
+		t.Fatalf("expected nil cache when disabled, got %#v", c)
+	}
+
+	dgst := digest.FromString("disabled")
+	c.found(headCacheBlob, "foo/bar", distribution.Descriptor{Digest: dgst})
+	if _, _, ok := c.get(headCacheBlob, "foo/bar", dgst); ok {
+		t.Fatalf("expected no result from a nil cache")
+	}
+	c.forget(headCacheBlob, "foo/bar", dgst)
+}
+
+func TestHeadCache(t *testing.T) {
+	c := newHeadCache(configuration.HeadCache{
+		Enabled:     true,
+		TTL:         time.Hour,
+		NegativeTTL: 10 * time.Millisecond,
+		Size:        2,
+	})
+
+	a := distribution.Descriptor{Digest: digest.FromString("a"), Size: 1, MediaType: "application/octet-stream"}
+	b := digest.FromString("b")
+
+	c.found(headCacheBlob, "foo/bar", a)
+	desc, exists, ok := c.get(headCacheBlob, "foo/bar", a.Digest)
+	if !ok || !exists || desc.Digest != a.Digest || desc.Size != a.Size {
+		t.Fatalf("unexpected result: %v %v %v", desc, exists, ok)
+	}
+
+	// Results are kept per kind and repository
+	if _, _, ok := c.get(headCacheManifest, "foo/bar", a.Digest); ok {
+		t.Fatalf("unexpected manifest result for a blob")
+	}
+	if _, _, ok := c.get(headCacheBlob, "foo/baz", a.Digest); ok {
+		t.Fatalf("unexpected result for another repository")
+	}
+
+	c.missing(headCacheBlob, "foo/bar", b)
+	if _, exists, ok := c.get(headCacheBlob, "foo/bar", b); !ok || exists {
+		t.Fatalf("expected negative result, got %v %v", exists, ok)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, _, ok := c.get(headCacheBlob, "foo/bar", b); ok {
+		t.Fatalf("expected negative result to expire")
+	}
+	if _, _, ok := c.get(headCacheBlob, "foo/bar", a.Digest); !ok {
+		t.Fatalf("expected positive result to be kept")
+	}
+
+	c.forget(headCacheBlob, "foo/bar", a.Digest)
+	if _, _, ok := c.get(headCacheBlob, "foo/bar", a.Digest); ok {
+		t.Fatalf("expected result to be forgotten")
+	}
+
+	for i := 0; i < 5; i++ {
+		c.missing(headCacheBlob, "foo/bar", digest.FromString(string(rune('c'+i))))
+	}
+	if len(c.entries) > 2 {
+		t.Fatalf("expected at most 2 entries, got %d", len(c.entries))
+	}
+}
+
+// TestHeadCacheBlobAPI checks that cached HEAD results are answered without
+// storage and are dropped when the blob is pushed or deleted.
+func TestHeadCacheBlobAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.HeadCache = configuration.HeadCache{Enabled: true, TTL: time.Hour, NegativeTTL: time.Hour}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	args := makeBlobArgs(t)
+	imageName := args.imageName
+	layerURL := blobURL(t, env, imageName, args.layerDigest)
+
+	resp, err := http.Head(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking layer: %v", err)
+	}
+	checkResponse(t, "checking missing layer", resp, http.StatusNotFound)
+
+	// Pushing the layer drops the negative result
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, args.layerDigest, uploadURLBase, args.layerFile)
+
+	resp, err = http.Head(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking layer: %v", err)
+	}
+	checkResponse(t, "checking pushed layer", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{args.layerDigest.String()},
+		"ETag":                  []string{`"` + args.layerDigest.String() + `"`},
+	})
+
+	// The result is cached: removing the link behind the registry's back
+	// goes unnoticed
+	linkPath := path.Join("/docker/registry/v2/repositories", imageName.Name(), "_layers",
+		args.layerDigest.Algorithm().String(), args.layerDigest.Hex(), "link")
+	if err := env.app.driver.Delete(env.ctx, linkPath); err != nil {
+		t.Fatalf("unexpected error deleting link: %v", err)
+	}
+	resp, err = http.Head(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking layer: %v", err)
+	}
+	checkResponse(t, "checking cached layer", resp, http.StatusOK)
+
+	// Deleting through the API drops the cached result
+	uploadURLBase, _ = startPushLayer(t, env, imageName)
+	args.layerFile.Seek(0, 0)
+	pushLayer(t, env.builder, imageName, args.layerDigest, uploadURLBase, args.layerFile)
+
+	resp, err = httpDelete(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting layer: %v", err)
+	}
+	checkResponse(t, "deleting layer", resp, http.StatusAccepted)
+
+	resp, err = http.Head(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking layer: %v", err)
+	}
+	checkResponse(t, "checking deleted layer", resp, http.StatusNotFound)
+}
+
+func blobURL(t *testing.T, env *testEnv, name reference.Named, dgst digest.Digest) string {
+	ref, _ := reference.WithDigest(name, dgst)
+	u, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob url: %v", err)
+	}
+	return u
+}
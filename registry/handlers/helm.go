@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// The media types of charts stored by Helm 3 clients.
+const (
+	helmConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+	helmChartMediaType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+
+	// helmLegacyChartMediaType is used by the experimental registry support
+	// of early Helm 3 releases.
+	helmLegacyChartMediaType = "application/tar+gzip"
+)
+
+// helmRepositoriesPageSize is the number of repositories of a namespace
+// listed at once while building its index.
+const helmRepositoriesPageSize = 100
+
+// defaultHelmIndexCache is how long the index of a namespace is served before
+// it is built again, unless configured.
+const defaultHelmIndexCache = time.Minute
+
+// helmIndexCache keeps the index of each namespace for a while, as building it
+// reads every tag of its repositories. It implements notifications.Sink, so
+// that the index of a namespace is built again as soon as one of its
+// repositories changes on this instance.
+type helmIndexCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	indexes map[string]cachedHelmIndex
+}
+
+type cachedHelmIndex struct {
+	content []byte
+	built   time.Time
+}
+
+var _ notifications.Sink = &helmIndexCache{}
+
+func newHelmIndexCache(ttl time.Duration) *helmIndexCache {
+	if ttl <= 0 {
+		ttl = defaultHelmIndexCache
+	}
+	return &helmIndexCache{
+		ttl:     ttl,
+		indexes: make(map[string]cachedHelmIndex),
+	}
+}
+
+// get returns the index of the namespace, if it was built recently enough.
+func (c *helmIndexCache) get(namespace string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index, ok := c.indexes[namespace]
+	if !ok || time.Since(index.built) > c.ttl {
+		return nil, false
+	}
+	return index.content, true
+}
+
+func (c *helmIndexCache) put(namespace string, content []byte, built time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.indexes[namespace] = cachedHelmIndex{content: content, built: built}
+}
+
+// Write drops the indexes of the namespaces of the repositories pushed to or
+// deleted from.
+func (c *helmIndexCache) Write(events ...notifications.Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, event := range events {
+		if event.Action != notifications.EventActionPush && event.Action != notifications.EventActionDelete {
+			continue
+		}
+		for namespace := range c.indexes {
+			if strings.HasPrefix(event.Target.Repository, namespace+"/") {
+				delete(c.indexes, namespace)
+			}
+		}
+	}
+	return nil
+}
+
+// Close implements notifications.Sink.
+func (c *helmIndexCache) Close() error {
+	return nil
+}
+
+// helmIndexDispatcher constructs the handler serving the Helm chart
+// repository index of a namespace.
+func helmIndexDispatcher(ctx *Context, r *http.Request) http.Handler {
+	helmHandler := &helmHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(helmHandler.GetIndex),
+	}
+}
+
+// helmChartDispatcher constructs the handler serving the charts of the Helm
+// chart repository of a namespace.
+func helmChartDispatcher(ctx *Context, r *http.Request) http.Handler {
+	helmHandler := &helmHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET":  ctx.tenant.downloadLimiter.limit(ctx, http.HandlerFunc(helmHandler.GetChart)),
+		"HEAD": http.HandlerFunc(helmHandler.GetChart),
+	}
+}
+
+// helmHandler serves the charts stored in the repositories of a namespace as
+// a Helm chart repository. A chart is stored as an OCI artifact in the
+// repository named after it, tagged with its version.
+type helmHandler struct {
+	*Context
+}
+
+// helmIndex is the index.yaml file of a Helm chart repository.
+type helmIndex struct {
+	APIVersion string                              `yaml:"apiVersion"`
+	Entries    map[string][]map[string]interface{} `yaml:"entries"`
+	Generated  string                              `yaml:"generated"`
+}
+
+// enabled reports whether the namespace can be served as a chart repository,
+// failing the request otherwise.
+func (hh *helmHandler) enabled() bool {
+	if !hh.App.Config.Helm.Enabled {
+		hh.Errors = append(hh.Errors, errcode.ErrorCodeUnsupported.WithDetail("helm chart repositories are not enabled on this registry"))
+		return false
+	}
+	if hh.App.namespaces.enumerator == nil || hh.tenant.ownStorage {
+		hh.Errors = append(hh.Errors, errcode.ErrorCodeUnsupported.WithDetail("namespaces are not supported by this registry"))
+		return false
+	}
+	return true
+}
+
+// GetIndex returns the index of the charts stored in the repositories of the
+// namespace, from the cache if it was built recently.
+func (hh *helmHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
+	if !hh.enabled() {
+		return
+	}
+
+	namespace := getNamespace(hh)
+	p, ok := hh.App.helmIndexes.get(namespace)
+	if !ok {
+		built := time.Now()
+		var err error
+		p, err = hh.buildIndex(namespace, built)
+		if err != nil {
+			hh.Errors = append(hh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		hh.App.helmIndexes.put(namespace, p, built)
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	w.Write(p)
+}
+
+// buildIndex returns the index of the charts stored in the repositories of the
+// namespace. Repositories nested deeper are left out, as their charts would
+// not be named after them.
+func (hh *helmHandler) buildIndex(namespace string, built time.Time) ([]byte, error) {
+	index := helmIndex{
+		APIVersion: "v1",
+		Entries:    make(map[string][]map[string]interface{}),
+		Generated:  built.UTC().Format(time.RFC3339Nano),
+	}
+
+	last := ""
+	for {
+		repos := make([]string, helmRepositoriesPageSize)
+		n, err := hh.App.namespaces.enumerator.NamespaceRepositories(hh, namespace, repos, last)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		for _, name := range repos[:n] {
+			chart := strings.TrimPrefix(name, namespace+"/")
+			if strings.Contains(chart, "/") {
+				continue
+			}
+			if err := hh.indexRepository(index, namespace, chart); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF || n == 0 {
+			break
+		}
+		last = repos[n-1]
+	}
+
+	return yaml.Marshal(index)
+}
+
+// indexRepository adds the chart versions stored in the repository of the
+// chart to index, leaving out those which would be refused to clients.
+func (hh *helmHandler) indexRepository(index helmIndex, namespace, chart string) error {
+	named, err := hh.nameValidator.WithName(namespace + "/" + chart)
+	if err != nil {
+		return err
+	}
+	repository, err := hh.tenant.registry.Repository(hh, named)
+	if err != nil {
+		return err
+	}
+	tags, err := repository.Tags(hh).All(hh)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			return nil
+		}
+		return err
+	}
+
+	for _, tag := range tags {
+		manifest, dgst, layer, err := helmChart(hh, repository, tag)
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			continue
+		}
+		if err := hh.chartPolicy(repository, dgst); err != nil {
+			if err, ok := err.(errcode.Error); ok && err.Code == errcode.ErrorCodeDenied {
+				continue
+			}
+			return err
+		}
+
+		configJSON, err := repository.Blobs(hh).Get(hh, manifest.Config.Digest)
+		if err != nil {
+			return err
+		}
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal(configJSON, &entry); err != nil {
+			dcontext.GetLogger(hh).Warnf("skipping chart %s:%s with invalid metadata: %v", named.Name(), tag, err)
+			continue
+		}
+
+		chartURL, err := hh.urlBuilder.BuildHelmChartURL(namespace, chart, tag)
+		if err != nil {
+			return err
+		}
+		entry["urls"] = []string{chartURL}
+		entry["digest"] = layer.Digest.Hex()
+		if created, ok := manifest.Annotations[v1.AnnotationCreated]; ok {
+			entry["created"] = created
+		}
+
+		name, _ := entry["name"].(string)
+		if name == "" {
+			name = chart
+		}
+		index.Entries[name] = append(index.Entries[name], entry)
+	}
+	return nil
+}
+
+// GetChart serves the archive of a chart version. The name of the archive is
+// split into the chart and its version at the first dash naming a stored
+// chart version, as both may contain dashes.
+func (hh *helmHandler) GetChart(w http.ResponseWriter, r *http.Request) {
+	if !hh.enabled() {
+		return
+	}
+
+	namespace := getNamespace(hh)
+	file := dcontext.GetStringValue(hh, "vars.file")
+	base := strings.TrimSuffix(file, ".tgz")
+
+	for i := strings.Index(base, "-"); i >= 0; i = nextDash(base, i) {
+		named, err := hh.nameValidator.WithName(namespace + "/" + base[:i])
+		if err != nil {
+			continue
+		}
+		tagged, err := reference.WithTag(named, base[i+1:])
+		if err != nil {
+			continue
+		}
+		repository, err := hh.tenant.registry.Repository(hh, named)
+		if err != nil {
+			continue
+		}
+
+		manifest, dgst, layer, err := helmChart(hh, repository, tagged.Tag())
+		if err != nil {
+			hh.Errors = append(hh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		if manifest == nil {
+			continue
+		}
+
+		if r.Method == "GET" {
+			if err := hh.chartPolicy(repository, dgst); err != nil {
+				hh.Errors = append(hh.Errors, err)
+				return
+			}
+		}
+
+		// serve the archive as a blob pull of the repository, through its
+		// event bridge and middleware
+		repository, _ = notifications.Listen(repository, hh.tenant.repoRemover, hh.App.eventBridge(hh.Context, r))
+		repository, err = applyRepoMiddleware(hh.App, repository, hh.App.Config.Middleware["repository"])
+		if err != nil {
+			hh.Errors = append(hh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+
+		hh.App.setPullCount(w, layer.Digest)
+		if err := repository.Blobs(hh).ServeBlob(hh, w, r, layer.Digest); err != nil {
+			if err == distribution.ErrBlobUnknown {
+				hh.Errors = append(hh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(layer.Digest))
+			} else {
+				hh.Errors = append(hh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+		}
+		return
+	}
+
+	hh.Errors = append(hh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(map[string]string{"namespace": namespace, "chart": file}))
+}
+
+// chartPolicy returns the error refusing to serve the chart whose manifest is
+// dgst, as its manifest would be refused: if its scan report exceeds the
+// configured severity, or it is not signed in a namespace requiring
+// signatures.
+func (hh *helmHandler) chartPolicy(repository distribution.Repository, dgst digest.Digest) error {
+	if err := scanPolicy(hh.Context, repository.Named().Name(), dgst); err != nil {
+		return err
+	}
+	return signaturePolicy(hh.Context, repository, dgst)
+}
+
+// nextDash returns the index of the dash of s following the one at i, or -1.
+func nextDash(s string, i int) int {
+	j := strings.Index(s[i+1:], "-")
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// helmChart returns the manifest of the chart tagged in repository, its
+// digest and the descriptor of its archive. The manifest is nil if the tag is
+// unknown or does not reference a chart.
+func helmChart(ctx context.Context, repository distribution.Repository, tag string) (*ocischema.DeserializedManifest, digest.Digest, distribution.Descriptor, error) {
+	desc, err := repository.Tags(ctx).Get(ctx, tag)
+	if err != nil {
+		if _, ok := err.(distribution.ErrTagUnknown); ok {
+			return nil, "", distribution.Descriptor{}, nil
+		}
+		return nil, "", distribution.Descriptor{}, err
+	}
+
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, "", distribution.Descriptor{}, err
+	}
+	m, err := manifests.Get(ctx, desc.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			return nil, "", distribution.Descriptor{}, nil
+		}
+		return nil, "", distribution.Descriptor{}, err
+	}
+
+	manifest, ok := m.(*ocischema.DeserializedManifest)
+	if !ok || manifest.Config.MediaType != helmConfigMediaType {
+		return nil, "", distribution.Descriptor{}, nil
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == helmChartMediaType || layer.MediaType == helmLegacyChartMediaType {
+			return manifest, desc.Digest, layer, nil
+		}
+	}
+	return nil, "", distribution.Descriptor{}, nil
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// pushHelmChart stores a chart version as Helm 3 clients do, returning the
+// digest of its archive.
+func pushHelmChart(t *testing.T, env *testEnv, name, version string, archive []byte) digest.Digest {
+	t.Helper()
+	named, _ := reference.WithName(name)
+	repository, err := env.app.registry.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repository.Blobs(env.ctx)
+
+	config, err := blobs.Put(env.ctx, helmConfigMediaType, []byte(`{"name":"`+named.Name()[len("charts/"):]+`","version":"`+version+`","apiVersion":"v2"}`))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	config.MediaType = helmConfigMediaType
+	layer, err := blobs.Put(env.ctx, helmChartMediaType, archive)
+	if err != nil {
+		t.Fatalf("unexpected error putting archive: %v", err)
+	}
+	layer.MediaType = helmChartMediaType
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:   manifest.Versioned{SchemaVersion: 2, MediaType: v1.MediaTypeImageManifest},
+		Config:      config,
+		Layers:      []distribution.Descriptor{layer},
+		Annotations: map[string]string{v1.AnnotationCreated: "2020-01-01T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(env.ctx, m)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	if err := repository.Tags(env.ctx).Tag(env.ctx, version, distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+	return layer.Digest
+}
+
+func TestHelmRepository(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	config.Helm.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	web := pushHelmChart(t, env, "charts/web-app", "1.0.0-rc.1", []byte("web-app 1.0.0-rc.1"))
+	pushHelmChart(t, env, "charts/web-app", "1.0.0", []byte("web-app 1.0.0"))
+	pushHelmChart(t, env, "charts/web", "1.0.0", []byte("web 1.0.0"))
+	pushHelmChart(t, env, "charts/nested/chart", "1.0.0", []byte("nested"))
+	createRepository(env, t, "charts/image", "latest")
+
+	indexURL, err := env.builder.BuildHelmIndexURL("charts")
+	if err != nil {
+		t.Fatalf("unexpected error building index url: %v", err)
+	}
+	resp, err := http.Get(indexURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting index: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting index", resp, http.StatusOK)
+
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index struct {
+		APIVersion string `yaml:"apiVersion"`
+		Entries    map[string][]struct {
+			Name    string   `yaml:"name"`
+			Version string   `yaml:"version"`
+			Digest  string   `yaml:"digest"`
+			Created string   `yaml:"created"`
+			URLs    []string `yaml:"urls"`
+		} `yaml:"entries"`
+	}
+	if err := yaml.Unmarshal(p, &index); err != nil {
+		t.Fatalf("unexpected error decoding index: %v\n%s", err, p)
+	}
+	if index.APIVersion != "v1" || len(index.Entries) != 2 || len(index.Entries["web-app"]) != 2 || len(index.Entries["web"]) != 1 {
+		t.Fatalf("unexpected index:\n%s", p)
+	}
+
+	var entryURL string
+	for _, entry := range index.Entries["web-app"] {
+		if entry.Version == "1.0.0-rc.1" {
+			if entry.Digest != web.Hex() || entry.Created != "2020-01-01T00:00:00Z" || len(entry.URLs) != 1 {
+				t.Fatalf("unexpected entry: %+v", entry)
+			}
+			entryURL = entry.URLs[0]
+		}
+	}
+	if chartURL := mustHelmChartURL(t, env, "web-app", "1.0.0-rc.1"); entryURL != chartURL {
+		t.Fatalf("expected chart url %q, got %q", chartURL, entryURL)
+	}
+
+	// Chart names and versions both containing dashes are told apart by the
+	// stored versions
+	for _, tc := range []struct {
+		chart, version string
+		content        string
+	}{
+		{chart: "web-app", version: "1.0.0-rc.1", content: "web-app 1.0.0-rc.1"},
+		{chart: "web", version: "1.0.0", content: "web 1.0.0"},
+	} {
+		resp, err := http.Get(mustHelmChartURL(t, env, tc.chart, tc.version))
+		if err != nil {
+			t.Fatalf("unexpected error getting chart: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		checkResponse(t, "getting chart", resp, http.StatusOK)
+		if string(body) != tc.content {
+			t.Fatalf("expected %q, got %q", tc.content, body)
+		}
+	}
+
+	for _, u := range []string{
+		mustHelmChartURL(t, env, "web-app", "2.0.0"),
+		mustHelmChartURL(t, env, "image", "latest"),
+	} {
+		resp, err := http.Get(u)
+		if err != nil {
+			t.Fatalf("unexpected error getting chart: %v", err)
+		}
+		resp.Body.Close()
+		checkResponse(t, "getting unknown chart", resp, http.StatusNotFound)
+	}
+
+	// The index is served from the cache until a repository of the
+	// namespace changes
+	pushHelmChart(t, env, "charts/api", "1.0.0", []byte("api 1.0.0"))
+	if entries := getHelmIndex(t, indexURL); len(entries) != 2 {
+		t.Fatalf("expected the cached index, got %v", entries)
+	}
+	var pushed notifications.Event
+	pushed.Action = notifications.EventActionPush
+	pushed.Target.Repository = "charts/api"
+	env.app.helmIndexes.Write(pushed)
+	if entries := getHelmIndex(t, indexURL); len(entries) != 3 {
+		t.Fatalf("expected the index to be built again, got %v", entries)
+	}
+}
+
+// getHelmIndex returns the versions of each chart of an index.
+func getHelmIndex(t *testing.T, indexURL string) map[string][]string {
+	t.Helper()
+	resp, err := http.Get(indexURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting index: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting index", resp, http.StatusOK)
+
+	var index struct {
+		Entries map[string][]struct {
+			Version string `yaml:"version"`
+		} `yaml:"entries"`
+	}
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(p, &index); err != nil {
+		t.Fatalf("unexpected error decoding index: %v\n%s", err, p)
+	}
+	entries := make(map[string][]string)
+	for chart, versions := range index.Entries {
+		for _, version := range versions {
+			entries[chart] = append(entries[chart], version.Version)
+		}
+	}
+	return entries
+}
+
+func TestHelmRepositoryPolicies(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+		Namespaces: configuration.Namespaces{
+			Definitions: []configuration.Namespace{
+				{Name: "charts", RequireSignatures: true},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Helm.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	// Charts stored before signatures were required are only served once
+	// signed, as their manifests would be
+	pushHelmChart(t, env, "charts/app", "1.0.0", []byte("app 1.0.0"))
+	pushHelmChart(t, env, "charts/app", "2.0.0", []byte("app 2.0.0"))
+
+	named, _ := reference.WithName("charts/app")
+	repository, err := env.app.registry.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := repository.Tags(env.ctx).Get(env.ctx, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repository.Blobs(env.ctx)
+	signatureConfig, err := blobs.Put(env.ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureLayer, err := blobs.Put(env.ctx, mediaTypeCosignSimpleSigning, []byte("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureConfig.MediaType = schema2.MediaTypeImageConfig
+	signatureLayer.MediaType = mediaTypeCosignSimpleSigning
+	signature, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    signatureConfig,
+		Layers:    []distribution.Descriptor{signatureLayer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureDigest, err := manifests.Put(env.ctx, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Tags(env.ctx).Tag(env.ctx, signatureTag(desc.Digest), distribution.Descriptor{Digest: signatureDigest}); err != nil {
+		t.Fatal(err)
+	}
+
+	indexURL, err := env.builder.BuildHelmIndexURL("charts")
+	if err != nil {
+		t.Fatalf("unexpected error building index url: %v", err)
+	}
+	if entries := getHelmIndex(t, indexURL); len(entries) != 1 || len(entries["app"]) != 1 || entries["app"][0] != "1.0.0" {
+		t.Fatalf("expected only the signed chart in the index, got %v", entries)
+	}
+
+	resp, err := http.Get(mustHelmChartURL(t, env, "app", "1.0.0"))
+	if err != nil {
+		t.Fatalf("unexpected error getting chart: %v", err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "getting signed chart", resp, http.StatusOK)
+
+	resp, err = http.Get(mustHelmChartURL(t, env, "app", "2.0.0"))
+	if err != nil {
+		t.Fatalf("unexpected error getting chart: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting unsigned chart", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "getting unsigned chart", resp, errcode.ErrorCodeDenied)
+}
+
+func mustHelmChartURL(t *testing.T, env *testEnv, chart, version string) string {
+	u, err := env.builder.BuildHelmChartURL("charts", chart, version)
+	if err != nil {
+		t.Fatalf("unexpected error building chart url: %v", err)
+	}
+	return u
+}
+
+func TestHelmRepositoryDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	indexURL, err := env.builder.BuildHelmIndexURL("charts")
+	if err != nil {
+		t.Fatalf("unexpected error building index url: %v", err)
+	}
+	resp, err := http.Get(indexURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting index: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting index", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "getting index", resp, errcode.ErrorCodeUnsupported)
+}
@@ -35,6 +35,10 @@ func copyFullPayload(ctx context.Context, responseWriter http.ResponseWriter, r
 
 	// Read in the data, if any.
 	copied, err := io.Copy(destWriter, body)
+	if err == errUploadStalled || err == errUploadTooSlow || err == errBodyDigestMismatch {
+		// The caller aborts the upload
+		return err
+	}
 	if clientClosed != nil && (err != nil || (r.ContentLength > 0 && copied < r.ContentLength)) {
 		// Didn't receive as much content as expected. Did the client
 		// disconnect during the request? If so, avoid returning a 400
@@ -64,3 +68,15 @@ func copyFullPayload(ctx context.Context, responseWriter http.ResponseWriter, r
 
 	return nil
 }
+
+// countingReadCloser counts the bytes read from a request body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -22,6 +22,10 @@ type blobUploadState struct {
 
 	// StartedAt is the original start time of the upload.
 	StartedAt time.Time
+
+	// ExpectedSize is the total size of the blob announced by the client
+	// when the upload was started, or zero if unknown.
+	ExpectedSize int64
 }
 
 type hmacKey string
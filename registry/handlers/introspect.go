@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth/token"
+	"github.com/gorilla/handlers"
+)
+
+// errNoTokenAuth is returned when introspecting the tokens of a namespace
+// which does not use token authentication.
+var errNoTokenAuth = errors.New("token authentication is not used")
+
+// tokenIntrospection describes a token, in the manner of OAuth 2.0 token
+// introspection (RFC 7662). Only Active is set for tokens which are not
+// accepted.
+type tokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	JWTID     string `json:"jti,omitempty"`
+}
+
+// introspectToken verifies rawToken against the token authentication of the
+// tenant owning namespace, or of the registry if namespace belongs to no
+// tenant, as tenants may trust other issuers and keys.
+func (app *App) introspectToken(namespace, rawToken string) (tokenIntrospection, error) {
+	introspector, ok := app.tenantFor(namespace).accessController.(token.Introspector)
+	if !ok {
+		return tokenIntrospection{}, errNoTokenAuth
+	}
+
+	claims, err := introspector.Introspect(rawToken)
+	if err != nil {
+		return tokenIntrospection{}, nil
+	}
+	scopes := make([]string, 0, len(claims.Access))
+	for _, access := range claims.Access {
+		resourceType := access.Type
+		if access.Class != "" {
+			resourceType += "(" + access.Class + ")"
+		}
+		scopes = append(scopes, resourceType+":"+access.Name+":"+strings.Join(access.Actions, ","))
+	}
+	return tokenIntrospection{
+		Active:    true,
+		Scope:     strings.Join(scopes, " "),
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ExpiresAt: claims.Expiration,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		JWTID:     claims.JWTID,
+	}, nil
+}
+
+// adminIntrospectDispatcher constructs the handler introspecting tokens.
+func adminIntrospectDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ih := &adminIntrospectHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(ih.IntrospectToken),
+	}
+}
+
+// adminIntrospectHandler introspects the tokens accepted by the registry.
+type adminIntrospectHandler struct {
+	*Context
+}
+
+// IntrospectToken reports whether the token of the form is accepted, by the
+// tenant owning the namespace of the form if set.
+func (ih *adminIntrospectHandler) IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxIntrospectRequestSize)
+	rawToken := r.PostFormValue("token")
+	if rawToken == "" {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeIntrospectionInvalid.WithDetail("a token is required"))
+		return
+	}
+	namespace := r.PostFormValue("namespace")
+	if namespace != "" {
+		if _, err := ih.App.nameValidator.WithName(namespace); err != nil {
+			ih.Errors = append(ih.Errors, v2.ErrorCodeIntrospectionInvalid.WithDetail(err.Error()))
+			return
+		}
+	}
+
+	introspection, err := ih.App.introspectToken(namespace, rawToken)
+	if err == errNoTokenAuth {
+		ih.Errors = append(ih.Errors, errcode.ErrorCodeUnsupported.WithDetail("the registry does not use token authentication"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(introspection); err != nil {
+		dcontext.GetLogger(ih).Errorf("error encoding token introspection: %v", err)
+	}
+}
+
+// maxIntrospectRequestSize bounds the form of introspection requests.
+const maxIntrospectRequestSize = 16 << 10
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+// defaultRetryAfter is advertised to clients rejected by a transferLimiter
+// when no retry interval is configured.
+const defaultRetryAfter = 5 * time.Second
+
+// transferLimiter bounds the number of requests of a kind which are processed
+// concurrently. Requests beyond the limit wait for a free slot in a bounded
+// queue, so that bursts of clients cannot exhaust the memory of the instance
+// with buffered writers.
+type transferLimiter struct {
+	slots        chan struct{}
+	maxQueued    int
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+
+	mu     sync.Mutex
+	queued int
+}
+
+// newTransferLimiter returns a limiter for the given configuration, or nil if
+// the limit is disabled.
+func newTransferLimiter(config configuration.ConcurrencyLimit) *transferLimiter {
+	if config.MaxConcurrent <= 0 {
+		return nil
+	}
+
+	retryAfter := config.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	return &transferLimiter{
+		slots:        make(chan struct{}, config.MaxConcurrent),
+		maxQueued:    config.MaxQueued,
+		queueTimeout: config.QueueTimeout,
+		retryAfter:   retryAfter,
+	}
+}
+
+// acquire obtains a slot, waiting in the queue if none is free. It returns
+// false if the queue is full, the queue timeout elapses or ctx is done before
+// a slot becomes available.
+func (l *transferLimiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	l.mu.Lock()
+	if l.queued >= l.maxQueued {
+		l.mu.Unlock()
+		return false
+	}
+	l.queued++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release returns a slot obtained by acquire.
+func (l *transferLimiter) release() {
+	<-l.slots
+}
+
+// limit wraps handler so that it only runs while holding a slot of the
+// limiter. Requests which cannot obtain a slot are rejected as unavailable.
+// The handler is returned unchanged if the limiter is nil.
+func (l *transferLimiter) limit(ctx *Context, handler http.Handler) http.Handler {
+	if l == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire(r.Context()) {
+			dcontext.GetLogger(ctx).Warnf("rejecting %s request: too many concurrent transfers", r.Method)
+			w.Header().Set("Retry-After", strconv.Itoa(int((l.retryAfter+time.Second-1)/time.Second)))
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnavailable.WithDetail("too many concurrent transfers"))
+			return
+		}
+		defer l.release()
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+)
+
+func TestTransferLimiterDisabled(t *testing.T) {
+	if l := newTransferLimiter(configuration.ConcurrencyLimit{}); l != nil {
+		t.Fatalf("expected nil limiter for zero configuration, got %#v", l)
+	}
+}
+
+func TestTransferLimiterQueue(t *testing.T) {
+	l := newTransferLimiter(configuration.ConcurrencyLimit{
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		QueueTimeout:  time.Second,
+	})
+
+	ctx := context.Background()
+	if !l.acquire(ctx) {
+		t.Fatalf("expected first acquire to succeed")
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire(ctx)
+	}()
+
+	// Wait for the second request to be queued.
+	for {
+		l.mu.Lock()
+		queued := l.queued
+		l.mu.Unlock()
+		if queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if l.acquire(ctx) {
+		t.Fatalf("expected acquire to fail with a full queue")
+	}
+
+	l.release()
+	if !<-acquired {
+		t.Fatalf("expected queued acquire to succeed after release")
+	}
+	l.release()
+}
+
+func TestTransferLimiterTimeout(t *testing.T) {
+	l := newTransferLimiter(configuration.ConcurrencyLimit{
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		QueueTimeout:  10 * time.Millisecond,
+	})
+
+	ctx := context.Background()
+	if !l.acquire(ctx) {
+		t.Fatalf("expected first acquire to succeed")
+	}
+	defer l.release()
+
+	if l.acquire(ctx) {
+		t.Fatalf("expected acquire to time out")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	l.queueTimeout = 0
+	if l.acquire(canceled) {
+		t.Fatalf("expected acquire to fail with canceled context")
+	}
+}
+
+func TestTransferLimiterRejects(t *testing.T) {
+	l := newTransferLimiter(configuration.ConcurrencyLimit{
+		MaxConcurrent: 1,
+		RetryAfter:    1500 * time.Millisecond,
+	})
+	if !l.acquire(context.Background()) {
+		t.Fatalf("expected first acquire to succeed")
+	}
+	defer l.release()
+
+	ctx := &Context{Context: context.Background()}
+	called := false
+	handler := l.limit(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PATCH", "/", nil))
+
+	if called {
+		t.Fatalf("expected handler not to be called")
+	}
+	if ctx.Errors.Len() != 1 {
+		t.Fatalf("expected one error, got %v", ctx.Errors)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("unexpected Retry-After header: %q", got)
+	}
+}
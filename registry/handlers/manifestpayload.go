@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	defaultManifestMaxSize  = 4 << 20
+	defaultManifestMaxDepth = 32
+)
+
+// errManifestTooLarge is returned when a manifest payload exceeds the size
+// limit.
+type errManifestTooLarge struct {
+	limit int64
+}
+
+func (err errManifestTooLarge) Error() string {
+	return fmt.Sprintf("manifest payload exceeds the limit of %d bytes", err.limit)
+}
+
+var (
+	errManifestNotObject      = errors.New("manifest payload is not a JSON object")
+	errManifestTrailingData   = errors.New("manifest payload has data after its JSON object")
+	errManifestNestingTooDeep = errors.New("manifest payload is nested too deeply")
+)
+
+// manifestPayload buffers a manifest pushed by a client, checking the
+// structure of its JSON as it arrives so that oversized, deeply nested or
+// malformed payloads are rejected without being read in full. It only tracks
+// nesting and string boundaries; the manifest is parsed once complete.
+type manifestPayload struct {
+	buf      bytes.Buffer
+	maxSize  int64
+	maxDepth int
+
+	depth    int
+	started  bool
+	done     bool
+	inString bool
+	escaped  bool
+}
+
+func newManifestPayload(maxSize int64, maxDepth int) *manifestPayload {
+	return &manifestPayload{
+		maxSize:  maxSize,
+		maxDepth: maxDepth,
+	}
+}
+
+// Write checks and buffers the next part of the payload.
+func (mp *manifestPayload) Write(p []byte) (int, error) {
+	if int64(mp.buf.Len()+len(p)) > mp.maxSize {
+		return 0, errManifestTooLarge{limit: mp.maxSize}
+	}
+	for i, c := range p {
+		if err := mp.scan(c); err != nil {
+			return i, err
+		}
+	}
+	return mp.buf.Write(p)
+}
+
+// Bytes returns the payload received.
+func (mp *manifestPayload) Bytes() []byte {
+	return mp.buf.Bytes()
+}
+
+func (mp *manifestPayload) scan(c byte) error {
+	if mp.inString {
+		switch {
+		case mp.escaped:
+			mp.escaped = false
+		case c == '\\':
+			mp.escaped = true
+		case c == '"':
+			mp.inString = false
+		}
+		return nil
+	}
+
+	switch c {
+	case ' ', '\t', '\n', '\r':
+		return nil
+	}
+	if mp.done {
+		return errManifestTrailingData
+	}
+	if !mp.started {
+		if c != '{' {
+			return errManifestNotObject
+		}
+		mp.started = true
+	}
+
+	switch c {
+	case '"':
+		mp.inString = true
+	case '{', '[':
+		mp.depth++
+		if mp.depth > mp.maxDepth {
+			return errManifestNestingTooDeep
+		}
+	case '}', ']':
+		mp.depth--
+		if mp.depth == 0 {
+			mp.done = true
+		}
+	}
+	return nil
+}
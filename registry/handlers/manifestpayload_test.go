@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+func TestManifestPayload(t *testing.T) {
+	for _, tc := range []struct {
+		payload string
+		err     error
+	}{
+		{payload: `{"schemaVersion": 2, "layers": [{"size": 1}]}`},
+		{payload: " \n{\"a\": \"}]{[\\\"\"}\n"},
+		{payload: `{"a": [[[]]]}`},
+		{payload: `{"a": [[[[]]]]}`, err: errManifestNestingTooDeep},
+		{payload: `[{"a": 1}]`, err: errManifestNotObject},
+		{payload: `"manifest"`, err: errManifestNotObject},
+		{payload: `{"a": 1} {"b": 2}`, err: errManifestTrailingData},
+		{payload: `{"a": "` + strings.Repeat("x", 64) + `"}`, err: errManifestTooLarge{limit: 64}},
+	} {
+		payload := newManifestPayload(64, 4)
+
+		// feed the payload in small parts, as it would arrive
+		var err error
+		for p := []byte(tc.payload); len(p) > 0 && err == nil; {
+			n := 3
+			if n > len(p) {
+				n = len(p)
+			}
+			_, err = payload.Write(p[:n])
+			p = p[n:]
+		}
+		if err != tc.err {
+			t.Errorf("%q: unexpected error: %v != %v", tc.payload, err, tc.err)
+		}
+		if err == nil && string(payload.Bytes()) != tc.payload {
+			t.Errorf("%q: unexpected payload buffered: %q", tc.payload, payload.Bytes())
+		}
+	}
+}
+
+// unsizedReader hides the length of its content, so that requests reading
+// from it are sent without a content length.
+type unsizedReader struct {
+	io.Reader
+}
+
+func TestManifestPayloadLimits(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Validation.Manifests.MaxSize = 1024
+	config.Validation.Manifests.MaxDepth = 8
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/limits")
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+
+	putManifest := func(body io.Reader) *http.Response {
+		req, err := http.NewRequest("PUT", manifestURL, body)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", schema2.MediaTypeManifest)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		return resp
+	}
+
+	large := []byte(`{"schemaVersion": 2, "annotations": {"a": "` + strings.Repeat("x", 2048) + `"}}`)
+	for _, body := range []io.Reader{bytes.NewReader(large), unsizedReader{bytes.NewReader(large)}} {
+		resp := putManifest(body)
+		defer resp.Body.Close()
+		checkResponse(t, "putting oversized manifest", resp, http.StatusRequestEntityTooLarge)
+		checkBodyHasErrorCodes(t, "putting oversized manifest", resp, v2.ErrorCodeManifestTooLarge)
+	}
+
+	nested := []byte(`{"schemaVersion": 2, "a": ` + strings.Repeat("[", 16) + strings.Repeat("]", 16) + `}`)
+	resp := putManifest(unsizedReader{bytes.NewReader(nested)})
+	defer resp.Body.Close()
+	checkResponse(t, "putting deeply nested manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting deeply nested manifest", resp, v2.ErrorCodeManifestInvalid)
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"bytes"
 	"fmt"
 	"mime"
 	"net/http"
@@ -25,10 +24,9 @@ import (
 // These constants determine which architecture and OS to choose from a
 // manifest list when downconverting it to a schema1 manifest.
 const (
-	defaultArch         = "amd64"
-	defaultOS           = "linux"
-	maxManifestBodySize = 4 << 20
-	imageClass          = "image"
+	defaultArch = "amd64"
+	defaultOS   = "linux"
+	imageClass  = "image"
 )
 
 type storageType int
@@ -63,7 +61,7 @@ func manifestDispatcher(ctx *Context, r *http.Request) http.Handler {
 	}
 
 	if !ctx.readOnly {
-		mhandler["PUT"] = http.HandlerFunc(manifestHandler.PutManifest)
+		mhandler["PUT"] = ctx.memory.limit(ctx, memoryManifest, manifestMemory(ctx.manifestMaxSize), http.HandlerFunc(manifestHandler.PutManifest))
 		mhandler["DELETE"] = http.HandlerFunc(manifestHandler.DeleteManifest)
 	}
 
@@ -117,6 +115,15 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	var platform *manifestlist.PlatformSpec
+	if p := r.URL.Query().Get("platform"); p != "" {
+		platform, err = parsePlatform(p)
+		if err != nil {
+			imh.Errors = append(imh.Errors, v2.ErrorCodePlatformInvalid.WithDetail(p))
+			return
+		}
+	}
+
 	if imh.Tag != "" {
 		tags := imh.Repository.Tags(imh)
 		desc, err := tags.Get(imh, imh.Tag)
@@ -131,11 +138,45 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		imh.Digest = desc.Digest
 	}
 
-	if etagMatch(r, imh.Digest.String()) {
+	if r.Method == "GET" {
+		if err := imh.applyScanPolicy(); err != nil {
+			imh.Errors = append(imh.Errors, err)
+			return
+		}
+	}
+
+	// The digest of the selected manifest is only known once the index is
+	// read, so platform selection skips the shortcuts below.
+	if platform == nil && etagMatch(r, imh.Digest.String()) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
+	name := imh.Repository.Named().Name()
+	if r.Method == "HEAD" && imh.Tag == "" && platform == nil {
+		if desc, exists, ok := imh.headCache.get(headCacheManifest, name, imh.Digest); ok {
+			if !exists {
+				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(distribution.ErrManifestUnknownRevision{
+					Name:     name,
+					Revision: imh.Digest,
+				}))
+				return
+			}
+			// OCI manifests are refused to clients not accepting them,
+			// which is left to the full path below.
+			if (desc.MediaType != v1.MediaTypeImageManifest || supports[ociSchema]) &&
+				(desc.MediaType != v1.MediaTypeImageIndex || supports[ociImageIndexSchema]) &&
+				(!imh.schema1Disabled() || !isSchema1MediaType(desc.MediaType)) {
+				w.Header().Set("Content-Type", desc.MediaType)
+				w.Header().Set("Content-Length", fmt.Sprint(desc.Size))
+				w.Header().Set("Docker-Content-Digest", imh.Digest.String())
+				w.Header().Set("Etag", fmt.Sprintf(`"%s"`, imh.Digest))
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+	}
+
 	var options []distribution.ManifestServiceOption
 	if imh.Tag != "" {
 		options = append(options, distribution.WithTag(imh.Tag))
@@ -143,12 +184,56 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 	manifest, err := manifests.Get(imh, imh.Digest, options...)
 	if err != nil {
 		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			if imh.Tag == "" {
+				imh.headCache.missing(headCacheManifest, name, imh.Digest)
+			}
 			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
 		} else {
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
 		return
 	}
+
+	var indexDigest digest.Digest
+	if list, ok := manifest.(*manifestlist.DeserializedManifestList); ok && platform != nil {
+		desc, found := selectPlatform(list, *platform)
+		if !found {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(fmt.Sprintf("no manifest for platform %s", r.URL.Query().Get("platform"))))
+			return
+		}
+
+		manifest, err = manifests.Get(imh, desc.Digest)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+
+		indexDigest = imh.Digest
+		imh.Digest = desc.Digest
+
+		if r.Method == "GET" {
+			if err := imh.applyScanPolicy(); err != nil {
+				imh.Errors = append(imh.Errors, err)
+				return
+			}
+		}
+
+		if etagMatch(r, imh.Digest.String()) {
+			w.Header().Set("Docker-Index-Digest", indexDigest.String())
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if _, isSchema1 := manifest.(*schema1.SignedManifest); isSchema1 && imh.schema1Disabled() {
+		imh.rejectSchema1(fmt.Sprintf("pull of schema1 manifest %s", imh.Digest))
+		return
+	}
+
 	// determine the type of the returned manifest
 	manifestType := manifestSchema1
 	schema2Manifest, isSchema2 := manifest.(*schema2.DeserializedManifest)
@@ -173,9 +258,22 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("OCI index found, but accept header does not support OCI indexes"))
 		return
 	}
+	// Images pulled by tag by clients asking for layers in another
+	// compression are served their transcoded variant once published.
+	if imh.App.transcoder != nil && indexDigest == "" && supports[ociSchema] {
+		if variant, dgst, ok := imh.transcodedVariant(r, manifest); ok {
+			manifest, imh.Digest = variant, dgst
+			manifestType = ociSchema
+		}
+	}
+
 	// Only rewrite schema2 manifests when they are being fetched by tag.
 	// If they are being fetched by digest, we can't return something not
 	// matching the digest.
+	if imh.Tag != "" && imh.schema1Disabled() && manifestType == manifestSchema2 && !supports[manifestSchema2] {
+		imh.rejectSchema1(fmt.Sprintf("pull of tag %s by a client not accepting schema2 manifests", imh.Tag))
+		return
+	}
 	if imh.Tag != "" && manifestType == manifestSchema2 && !supports[manifestSchema2] {
 		// Rewrite manifest in schema1 format
 		dcontext.GetLogger(imh).Infof("rewriting manifest %s in schema1 format to support old client", imh.Digest.String())
@@ -215,6 +313,10 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 
 		// If necessary, convert the image manifest
 		if schema2Manifest, isSchema2 := manifest.(*schema2.DeserializedManifest); isSchema2 && !supports[manifestSchema2] {
+			if imh.schema1Disabled() {
+				imh.rejectSchema1(fmt.Sprintf("pull of tag %s by a client not accepting schema2 manifests", imh.Tag))
+				return
+			}
 			manifest, err = imh.convertSchema2Manifest(schema2Manifest)
 			if err != nil {
 				return
@@ -229,13 +331,62 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if imh.Tag == "" {
+		imh.headCache.found(headCacheManifest, name, distribution.Descriptor{
+			MediaType: ct,
+			Size:      int64(len(p)),
+			Digest:    imh.Digest,
+		})
+	}
+
 	w.Header().Set("Content-Type", ct)
 	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
 	w.Header().Set("Etag", fmt.Sprintf(`"%s"`, imh.Digest))
+	if indexDigest != "" {
+		w.Header().Set("Docker-Index-Digest", indexDigest.String())
+	}
+	imh.setPullCount(w, imh.Digest)
 	w.Write(p)
 }
 
+// parsePlatform parses a platform of the form os/architecture[/variant].
+func parsePlatform(s string) (*manifestlist.PlatformSpec, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid platform %q", s)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid platform %q", s)
+		}
+	}
+
+	platform := &manifestlist.PlatformSpec{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// selectPlatform returns the first manifest of the list matching platform.
+// The variant is only compared if platform names one.
+func selectPlatform(list *manifestlist.DeserializedManifestList, platform manifestlist.PlatformSpec) (manifestlist.ManifestDescriptor, bool) {
+	for _, desc := range list.Manifests {
+		if desc.Platform.OS != platform.OS || desc.Platform.Architecture != platform.Architecture {
+			continue
+		}
+		if platform.Variant != "" && desc.Platform.Variant != platform.Variant {
+			continue
+		}
+		return desc, true
+	}
+	return manifestlist.ManifestDescriptor{}, false
+}
+
 func (imh *manifestHandler) convertSchema2Manifest(schema2Manifest *schema2.DeserializedManifest) (distribution.Manifest, error) {
 	targetDescriptor := schema2Manifest.Target()
 	blobs := imh.Repository.Blobs(imh)
@@ -286,6 +437,23 @@ func etagMatch(r *http.Request, etag string) bool {
 }
 
 // PutManifest validates and stores a manifest in the registry.
+// schema1Disabled returns true if schema1 manifests are neither accepted
+// nor served.
+func (imh *manifestHandler) schema1Disabled() bool {
+	return imh.App.Config.Compatibility.Schema1.Disabled
+}
+
+// rejectSchema1 refuses a request involving a schema1 manifest, logging it so
+// that operators can track the clients still relying on schema1.
+func (imh *manifestHandler) rejectSchema1(attempt string) {
+	dcontext.GetLogger(imh, auth.UserNameKey).Warnf("rejected %s in repository %s: schema1 is disabled", attempt, imh.Repository.Named().Name())
+	imh.Errors = append(imh.Errors, v2.ErrorCodeManifestSchema1Disabled.WithDetail(attempt))
+}
+
+func isSchema1MediaType(mediaType string) bool {
+	return mediaType == schema1.MediaTypeSignedManifest || mediaType == schema1.MediaTypeManifest || mediaType == "application/json"
+}
+
 func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request) {
 	dcontext.GetLogger(imh).Debug("PutImageManifest")
 	manifests, err := imh.Repository.Manifests(imh)
@@ -294,19 +462,40 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var jsonBuf bytes.Buffer
-	if err := copyFullPayload(imh, w, r, &jsonBuf, maxManifestBodySize, "image manifest PUT"); err != nil {
+	if err := imh.namespaces.checkQuota(imh, imh.Repository.Named().Name()); err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+
+	if r.ContentLength > imh.manifestMaxSize {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestTooLarge.WithDetail(errManifestTooLarge{limit: imh.manifestMaxSize}.Error()))
+		return
+	}
+
+	// The payload is checked as it arrives, and the request body is cut off
+	// one byte past the limit so that the check reports oversized payloads.
+	payload := newManifestPayload(imh.manifestMaxSize, imh.manifestMaxDepth)
+	if err := copyFullPayload(imh, w, r, payload, imh.manifestMaxSize+1, "image manifest PUT"); err != nil {
 		// copyFullPayload reports the error if necessary
-		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err.Error()))
+		switch err := err.(type) {
+		case errManifestTooLarge:
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestTooLarge.WithDetail(err.Error()))
+		default:
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err.Error()))
+		}
 		return
 	}
 
 	mediaType := r.Header.Get("Content-Type")
-	manifest, desc, err := distribution.UnmarshalManifest(mediaType, jsonBuf.Bytes())
+	manifest, desc, err := distribution.UnmarshalManifest(mediaType, payload.Bytes())
 	if err != nil {
 		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
 		return
 	}
+	if _, isSchema1 := manifest.(*schema1.SignedManifest); isSchema1 && imh.schema1Disabled() {
+		imh.rejectSchema1(fmt.Sprintf("push of schema1 manifest %s", desc.Digest))
+		return
+	}
 
 	if imh.Digest != "" {
 		if desc.Digest != imh.Digest {
@@ -339,6 +528,16 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := imh.applySignaturePolicy(manifest, desc.Digest); err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+
+	if err := imh.applyAdmissionPolicy(r, mediaType, desc.Digest, payload.Bytes()); err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+
 	_, err = manifests.Put(imh, manifest, options...)
 	if err != nil {
 		// TODO(stevvooe): These error handling switches really need to be
@@ -361,6 +560,12 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 					imh.Errors = append(imh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
 				case distribution.ErrManifestUnverified:
 					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnverified)
+				case distribution.ErrManifestConfigInvalid:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(map[string]string{
+						"digest":    verificationError.Digest.String(),
+						"mediaType": verificationError.MediaType,
+						"reason":    verificationError.Reason.Error(),
+					}))
 				default:
 					if verificationError == digest.ErrDigestInvalidFormat {
 						imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
@@ -403,6 +608,8 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		dcontext.GetLogger(imh).Errorf("error building manifest url from digest: %v", err)
 	}
 
+	imh.headCache.forget(headCacheManifest, imh.Repository.Named().Name(), imh.Digest)
+
 	w.Header().Set("Location", location)
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
 	w.WriteHeader(http.StatusCreated)
@@ -509,6 +716,7 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 			return
 		}
 	}
+	imh.headCache.forget(headCacheManifest, imh.Repository.Named().Name(), imh.Digest)
 
 	tagService := imh.Repository.Tags(imh)
 	referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/go-metrics"
+)
+
+// defaultUploadBuffer is the memory assumed to be held by a blob upload
+// request, the size of the parts buffered by the s3 driver.
+const defaultUploadBuffer = 10 << 20
+
+// Kinds of requests accounted for by a memoryBudget.
+const (
+	memoryUpload   = "upload"
+	memoryManifest = "manifest"
+)
+
+var (
+	memoryNamespace = metrics.NewNamespace(prometheus.NamespacePrefix, "memory", nil)
+
+	// memoryHeld is the approximate memory held by in-flight requests.
+	memoryHeld = memoryNamespace.NewLabeledGauge("held", "The approximate memory held by in-flight requests", metrics.Bytes, "type")
+
+	// memoryRequests counts the requests accounted for and those rejected
+	// for lack of memory.
+	memoryRequests = memoryNamespace.NewLabeledCounter("requests", "The number of requests accounted for", "type", "result")
+)
+
+func init() {
+	metrics.Register(memoryNamespace)
+}
+
+// memoryBudget accounts for the approximate memory held by in-flight blob
+// uploads and manifest pushes and, if it has a limit, rejects the requests
+// which would take it past the limit. The memory of a request is estimated
+// up front and held until it completes.
+type memoryBudget struct {
+	max          int64
+	uploadBuffer int64
+	retryAfter   time.Duration
+
+	mu   sync.Mutex
+	held int64
+}
+
+func newMemoryBudget(config configuration.Memory) *memoryBudget {
+	b := &memoryBudget{
+		max:          config.Limit,
+		uploadBuffer: config.UploadBuffer,
+		retryAfter:   config.RetryAfter,
+	}
+	if b.uploadBuffer <= 0 {
+		b.uploadBuffer = defaultUploadBuffer
+	}
+	if b.retryAfter <= 0 {
+		b.retryAfter = defaultRetryAfter
+	}
+	return b
+}
+
+// reserve accounts for n bytes held by a request of the given kind. It
+// returns false, accounting for nothing, if the budget has a limit which the
+// request would exceed.
+func (b *memoryBudget) reserve(kind string, n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max > 0 && b.held+n > b.max {
+		memoryRequests.WithValues(kind, "rejected").Inc(1)
+		return false
+	}
+	b.held += n
+	memoryHeld.WithValues(kind).Inc(float64(n))
+	memoryRequests.WithValues(kind, "accepted").Inc(1)
+	return true
+}
+
+// release returns n bytes reserved by a request of the given kind.
+func (b *memoryBudget) release(kind string, n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.held -= n
+	memoryHeld.WithValues(kind).Dec(float64(n))
+}
+
+// limit wraps handler so that it only runs while holding the memory
+// estimated for the request. Requests for which there is not enough memory
+// left are rejected as unavailable.
+func (b *memoryBudget) limit(ctx *Context, kind string, estimate func(r *http.Request) int64, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := estimate(r)
+		if !b.reserve(kind, n) {
+			dcontext.GetLogger(ctx).Warnf("rejecting %s request: %d bytes of memory needed, registry is low on memory", r.Method, n)
+			w.Header().Set("Retry-After", strconv.Itoa(int((b.retryAfter+time.Second-1)/time.Second)))
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnavailable.WithDetail("registry is low on memory"))
+			return
+		}
+		defer b.release(kind, n)
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// uploadMemory estimates the memory held by a blob upload request.
+func (b *memoryBudget) uploadMemory(r *http.Request) int64 {
+	return b.uploadBuffer
+}
+
+// manifestMemory returns a function estimating the memory held by a manifest
+// push, which buffers the payload up to maxSize bytes.
+func manifestMemory(maxSize int64) func(r *http.Request) int64 {
+	return func(r *http.Request) int64 {
+		if r.ContentLength > 0 && r.ContentLength < maxSize {
+			return r.ContentLength
+		}
+		return maxSize
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	b := newMemoryBudget(configuration.Memory{Limit: 100})
+	if b.uploadBuffer != defaultUploadBuffer || b.retryAfter != defaultRetryAfter {
+		t.Fatalf("unexpected defaults: %d, %v", b.uploadBuffer, b.retryAfter)
+	}
+
+	if !b.reserve(memoryUpload, 60) {
+		t.Fatal("expected reservation within the limit to succeed")
+	}
+	if b.reserve(memoryManifest, 50) {
+		t.Fatal("expected reservation past the limit to fail")
+	}
+	if !b.reserve(memoryManifest, 40) {
+		t.Fatal("expected reservation up to the limit to succeed")
+	}
+	b.release(memoryUpload, 60)
+	if !b.reserve(memoryManifest, 50) {
+		t.Fatal("expected released memory to be available")
+	}
+	if b.held != 90 {
+		t.Fatalf("unexpected memory held: %d != 90", b.held)
+	}
+
+	unlimited := newMemoryBudget(configuration.Memory{})
+	if !unlimited.reserve(memoryUpload, 1<<40) {
+		t.Fatal("expected a budget without limit to accept any reservation")
+	}
+}
+
+func TestMemoryBudgetRejects(t *testing.T) {
+	b := newMemoryBudget(configuration.Memory{
+		Limit:      1024,
+		RetryAfter: 1500 * time.Millisecond,
+	})
+
+	ctx := &Context{Context: context.Background()}
+	var held int64
+	handler := b.limit(ctx, memoryManifest, manifestMemory(4096), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		held = b.held
+	}))
+
+	// the memory of a request is held while it is handled
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/", strings.NewReader("{}")))
+	if held != 2 || b.held != 0 {
+		t.Fatalf("unexpected memory held: %d during the request, %d after", held, b.held)
+	}
+
+	// a request without a length is assumed to be as large as allowed
+	held = 0
+	r := httptest.NewRequest("PUT", "/", strings.NewReader("{}"))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if held != 0 {
+		t.Fatal("expected handler not to be called")
+	}
+	if ctx.Errors.Len() != 1 {
+		t.Fatalf("expected one error, got %v", ctx.Errors)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("unexpected Retry-After header: %q", got)
+	}
+}
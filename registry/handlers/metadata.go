@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// maxMetadataBodySize is the maximum size of a repository metadata document.
+const maxMetadataBodySize = 64 << 10
+
+// metadataDispatcher constructs the repository metadata handler api endpoint.
+func metadataDispatcher(ctx *Context, r *http.Request) http.Handler {
+	metadataHandler := &metadataHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{
+		"GET": http.HandlerFunc(metadataHandler.GetMetadata),
+	}
+
+	if !ctx.readOnly {
+		mhandler["PUT"] = http.HandlerFunc(metadataHandler.PutMetadata)
+	}
+
+	return mhandler
+}
+
+// metadataHandler handles requests for the metadata of a repository.
+type metadataHandler struct {
+	*Context
+}
+
+// GetMetadata returns the metadata document of a repository.
+func (mh *metadataHandler) GetMetadata(w http.ResponseWriter, r *http.Request) {
+	store, ok := mh.checkRepository()
+	if !ok {
+		return
+	}
+
+	metadata, err := store.RepositoryMetadata(mh, mh.Repository.Named())
+	if err != nil {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(metadata); err != nil {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// PutMetadata replaces the metadata document of a repository.
+func (mh *metadataHandler) PutMetadata(w http.ResponseWriter, r *http.Request) {
+	store, ok := mh.checkRepository()
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := copyFullPayload(mh, w, r, &buf, maxMetadataBodySize, "repository metadata PUT"); err != nil {
+		// copyFullPayload reports the error if necessary
+		mh.Errors = append(mh.Errors, v2.ErrorCodeMetadataInvalid.WithDetail(err.Error()))
+		return
+	}
+
+	var metadata distribution.RepositoryMetadata
+	dec := json.NewDecoder(&buf)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&metadata); err != nil {
+		mh.Errors = append(mh.Errors, v2.ErrorCodeMetadataInvalid.WithDetail(err.Error()))
+		return
+	}
+	if _, ok := metadata.Labels[""]; ok {
+		mh.Errors = append(mh.Errors, v2.ErrorCodeMetadataInvalid.WithDetail("label keys must not be empty"))
+		return
+	}
+
+	if err := store.PutRepositoryMetadata(mh, mh.Repository.Named(), metadata); err != nil {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkRepository returns the metadata store if the registry supports
+// metadata and the repository exists, recording an error otherwise.
+func (mh *metadataHandler) checkRepository() (distribution.RepositoryMetadataStore, bool) {
+	store, ok := mh.tenant.registry.(distribution.RepositoryMetadataStore)
+	if !ok {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnsupported.WithDetail("repository metadata is not supported by this registry"))
+		return nil, false
+	}
+
+	// Metadata can only be attached to repositories with content.
+	if _, err := mh.Repository.Tags(mh).All(mh); err != nil {
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			mh.Errors = append(mh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": mh.Repository.Named().Name()}))
+		case errcode.Error:
+			mh.Errors = append(mh.Errors, err)
+		default:
+			mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return nil, false
+	}
+
+	return store, true
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+func TestRepositoryMetadataAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	unknown, _ := reference.WithName("foo/unknown")
+	unknownURL, err := env.builder.BuildMetadataURL(unknown)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(unknownURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching metadata: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching metadata of unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching metadata of unknown repository", resp, v2.ErrorCodeNameUnknown)
+
+	createRepository(env, t, "foo/bar", "latest")
+	name, _ := reference.WithName("foo/bar")
+	metadataURL, err := env.builder.BuildMetadataURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+
+	getMetadata := func() distribution.RepositoryMetadata {
+		resp, err := http.Get(metadataURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching metadata: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "fetching metadata", resp, http.StatusOK)
+
+		var metadata distribution.RepositoryMetadata
+		if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+			t.Fatalf("error decoding metadata: %v", err)
+		}
+		return metadata
+	}
+
+	putMetadata := func(body []byte) *http.Response {
+		req, err := http.NewRequest("PUT", metadataURL, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error putting metadata: %v", err)
+		}
+		return resp
+	}
+
+	if metadata := getMetadata(); !reflect.DeepEqual(metadata, distribution.RepositoryMetadata{}) {
+		t.Fatalf("expected empty metadata, got %+v", metadata)
+	}
+
+	expected := distribution.RepositoryMetadata{
+		Description: "The bar service",
+		Owner:       "team-foo",
+		Labels:      map[string]string{"tier": "frontend"},
+	}
+	body, _ := json.Marshal(expected)
+	resp = putMetadata(body)
+	defer resp.Body.Close()
+	checkResponse(t, "putting metadata", resp, http.StatusNoContent)
+
+	if metadata := getMetadata(); !reflect.DeepEqual(metadata, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, metadata)
+	}
+
+	for _, invalid := range []string{
+		`{"description": 1}`,
+		`{"unknown": "field"}`,
+		`{"labels": {"": "empty"}}`,
+		`{"description": "` + string(bytes.Repeat([]byte("a"), maxMetadataBodySize)) + `"}`,
+	} {
+		resp := putMetadata([]byte(invalid))
+		defer resp.Body.Close()
+		checkResponse(t, "putting invalid metadata", resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "putting invalid metadata", resp, v2.ErrorCodeMetadataInvalid)
+	}
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/gorilla/handlers"
+)
+
+const defaultNamespaceUsageCache = 5 * time.Minute
+
+// namespaces enforces the quotas and access lists of the configured
+// namespaces and caches their usage.
+type namespaces struct {
+	// definitions are sorted longest name first, so that the first match
+	// is the most specific one.
+	definitions []configuration.Namespace
+	usageCache  time.Duration
+
+	// enumerator is nil if the registry cannot enumerate namespaces, such
+	// as a pull through cache.
+	enumerator distribution.NamespaceEnumerator
+
+	mu    sync.Mutex
+	usage map[string]*namespaceUsage
+}
+
+// namespaceUsage is a cached usage of a namespace.
+type namespaceUsage struct {
+	distribution.NamespaceUsage
+
+	// repositories holds the names of the repositories of the namespace.
+	// It is only listed if the namespace has a repository quota.
+	repositories map[string]struct{}
+	computed     time.Time
+}
+
+func newNamespaces(config configuration.Namespaces, enumerator distribution.NamespaceEnumerator) (*namespaces, error) {
+	definitions := make([]configuration.Namespace, len(config.Definitions))
+	copy(definitions, config.Definitions)
+
+	seen := make(map[string]bool)
+	for _, definition := range definitions {
+		if definition.Name == "" || strings.HasSuffix(definition.Name, "/") {
+			return nil, fmt.Errorf("invalid namespace name %q", definition.Name)
+		}
+		if seen[definition.Name] {
+			return nil, fmt.Errorf("namespace %q is defined more than once", definition.Name)
+		}
+		seen[definition.Name] = true
+		if definition.Quota.Size < 0 || definition.Quota.Repositories < 0 {
+			return nil, fmt.Errorf("namespace %q: quotas must not be negative", definition.Name)
+		}
+	}
+	sort.SliceStable(definitions, func(i, j int) bool {
+		return len(definitions[i].Name) > len(definitions[j].Name)
+	})
+
+	usageCache := config.UsageCache
+	if usageCache <= 0 {
+		usageCache = defaultNamespaceUsageCache
+	}
+
+	return &namespaces{
+		definitions: definitions,
+		usageCache:  usageCache,
+		enumerator:  enumerator,
+		usage:       make(map[string]*namespaceUsage),
+	}, nil
+}
+
+// definition returns the most specific namespace definition containing the
+// repository name, or nil if there is none.
+func (ns *namespaces) definition(name string) *configuration.Namespace {
+	if ns == nil {
+		return nil
+	}
+	for i := range ns.definitions {
+		if strings.HasPrefix(name, ns.definitions[i].Name+"/") {
+			return &ns.definitions[i]
+		}
+	}
+	return nil
+}
+
+// authorize checks the request against the access list of the namespace of
+// the requested repository. Requests for a namespace itself need the pull
+// access of that namespace.
+func (ns *namespaces) authorize(ctx context.Context, r *http.Request) error {
+	if ns == nil || len(ns.definitions) == 0 {
+		return nil
+	}
+
+	user := dcontext.GetStringValue(ctx, auth.UserNameKey)
+
+	if namespace := getNamespace(ctx); namespace != "" {
+		// a namespace is subject to its own access list
+		return ns.allowed(ns.definition(namespace+"/"), user, "pull")
+	}
+
+	name := getName(ctx)
+	if name == "" {
+		return nil
+	}
+
+	definition := ns.definition(name)
+	switch r.Method {
+	case "GET", "HEAD":
+		if err := ns.allowed(definition, user, "pull"); err != nil {
+			return err
+		}
+	case "POST", "PUT", "PATCH":
+		if err := ns.allowed(definition, user, "pull"); err != nil {
+			return err
+		}
+		if err := ns.allowed(definition, user, "push"); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := ns.allowed(definition, user, "delete"); err != nil {
+			return err
+		}
+	}
+
+	if fromRepo := r.FormValue("from"); fromRepo != "" {
+		// mounting a blob from one repository to another requires pull
+		// access to the source repository.
+		return ns.allowed(ns.definition(fromRepo), user, "pull")
+	}
+
+	return nil
+}
+
+func (ns *namespaces) allowed(definition *configuration.Namespace, user, action string) error {
+	if definition == nil {
+		return nil
+	}
+
+	var users []string
+	switch action {
+	case "pull":
+		users = definition.Access.Pull
+	case "push":
+		users = definition.Access.Push
+	case "delete":
+		users = definition.Access.Delete
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	if user != "" {
+		for _, u := range users {
+			if u == user || u == "*" {
+				return nil
+			}
+		}
+	}
+
+	return errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("%s access to namespace %s denied", action, definition.Name))
+}
+
+// checkQuota returns an error if pushing to the named repository would
+// exceed the quota of its namespace. Usage is only refreshed once the cached
+// value expires, so a namespace may exceed its quota by what is pushed in
+// the meantime.
+func (ns *namespaces) checkQuota(ctx context.Context, name string) error {
+	definition := ns.definition(name)
+	if definition == nil || ns.enumerator == nil || (definition.Quota.Size == 0 && definition.Quota.Repositories == 0) {
+		return nil
+	}
+
+	usage, err := ns.cachedUsage(ctx, definition.Name, definition.Quota.Repositories > 0)
+	if err != nil {
+		// a failing usage computation must not prevent pushes
+		dcontext.GetLogger(ctx).Errorf("error computing usage of namespace %s: %v", definition.Name, err)
+		return nil
+	}
+
+	if definition.Quota.Size > 0 && usage.Size >= definition.Quota.Size {
+		return errcode.ErrorCodeDenied.WithMessage("namespace quota exceeded").WithDetail(map[string]interface{}{
+			"namespace": definition.Name,
+			"size":      usage.Size,
+			"quota":     definition.Quota.Size,
+		})
+	}
+
+	if definition.Quota.Repositories > 0 && usage.Repositories >= definition.Quota.Repositories {
+		if _, exists := usage.repositories[name]; !exists {
+			return errcode.ErrorCodeDenied.WithMessage("namespace quota exceeded").WithDetail(map[string]interface{}{
+				"namespace":    definition.Name,
+				"repositories": usage.Repositories,
+				"quota":        definition.Quota.Repositories,
+			})
+		}
+	}
+
+	return nil
+}
+
+// cachedUsage returns the usage of the namespace, computing it again if the
+// cached one expired or lacks the repository names.
+func (ns *namespaces) cachedUsage(ctx context.Context, namespace string, withRepositories bool) (*namespaceUsage, error) {
+	ns.mu.Lock()
+	cached, ok := ns.usage[namespace]
+	ns.mu.Unlock()
+	if ok && time.Since(cached.computed) < ns.usageCache && (!withRepositories || cached.repositories != nil) {
+		return cached, nil
+	}
+
+	usage, err := ns.enumerator.NamespaceUsage(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	cached = &namespaceUsage{
+		NamespaceUsage: usage,
+		computed:       time.Now(),
+	}
+
+	if withRepositories {
+		cached.repositories = make(map[string]struct{})
+		repos := make([]string, maximumReturnedEntries)
+		last := ""
+		for {
+			n, err := ns.enumerator.NamespaceRepositories(ctx, namespace, repos, last)
+			for _, repo := range repos[:n] {
+				cached.repositories[repo] = struct{}{}
+			}
+			if err == io.EOF || (err == nil && n == 0) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			last = repos[n-1]
+		}
+	}
+
+	ns.mu.Lock()
+	ns.usage[namespace] = cached
+	ns.mu.Unlock()
+
+	return cached, nil
+}
+
+// namespaceCatalogDispatcher constructs the handler listing the repositories
+// of a namespace.
+func namespaceCatalogDispatcher(ctx *Context, r *http.Request) http.Handler {
+	namespaceHandler := &namespaceHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(namespaceHandler.GetCatalog),
+	}
+}
+
+// namespaceUsageDispatcher constructs the handler returning the usage of a
+// namespace.
+func namespaceUsageDispatcher(ctx *Context, r *http.Request) http.Handler {
+	namespaceHandler := &namespaceHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(namespaceHandler.GetUsage),
+	}
+}
+
+// namespaceHandler handles requests for a namespace.
+type namespaceHandler struct {
+	*Context
+}
+
+type namespaceCatalogAPIResponse struct {
+	Namespace    string   `json:"namespace"`
+	Repositories []string `json:"repositories"`
+}
+
+type namespaceUsageAPIResponse struct {
+	Namespace string `json:"namespace"`
+	distribution.NamespaceUsage
+	Quota *namespaceQuotaAPIResponse `json:"quota,omitempty"`
+}
+
+type namespaceQuotaAPIResponse struct {
+	Repositories int   `json:"repositories,omitempty"`
+	Size         int64 `json:"size,omitempty"`
+}
+
+// GetCatalog returns a page of the repositories of the namespace as json.
+func (nh *namespaceHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
+	if nh.App.namespaces.enumerator == nil || nh.tenant.ownStorage {
+		nh.Errors = append(nh.Errors, errcode.ErrorCodeUnsupported.WithDetail("namespaces are not supported by this registry"))
+		return
+	}
+
+	var moreEntries = true
+
+	namespace := getNamespace(nh)
+	q := r.URL.Query()
+	lastEntry := q.Get("last")
+	maxEntries, err := strconv.Atoi(q.Get("n"))
+	if err != nil || maxEntries < 0 {
+		maxEntries = maximumReturnedEntries
+	}
+
+	repos := make([]string, maxEntries)
+
+	filled, err := nh.App.namespaces.enumerator.NamespaceRepositories(nh, namespace, repos, lastEntry)
+	if err == io.EOF {
+		moreEntries = false
+	} else if err != nil {
+		nh.Errors = append(nh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if moreEntries && filled > 0 {
+		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, repos[filled-1])
+		if err != nil {
+			nh.Errors = append(nh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		w.Header().Set("Link", urlStr)
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(namespaceCatalogAPIResponse{
+		Namespace:    namespace,
+		Repositories: repos[0:filled],
+	}); err != nil {
+		nh.Errors = append(nh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// GetUsage returns the usage and quota of the namespace as json.
+func (nh *namespaceHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if nh.App.namespaces.enumerator == nil || nh.tenant.ownStorage {
+		nh.Errors = append(nh.Errors, errcode.ErrorCodeUnsupported.WithDetail("namespaces are not supported by this registry"))
+		return
+	}
+
+	namespace := getNamespace(nh)
+	usage, err := nh.App.namespaces.cachedUsage(nh, namespace, false)
+	if err != nil {
+		nh.Errors = append(nh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	response := namespaceUsageAPIResponse{
+		Namespace:      namespace,
+		NamespaceUsage: usage.NamespaceUsage,
+	}
+	for _, definition := range nh.App.namespaces.definitions {
+		if definition.Name == namespace && (definition.Quota.Size > 0 || definition.Quota.Repositories > 0) {
+			response.Quota = &namespaceQuotaAPIResponse{
+				Repositories: definition.Quota.Repositories,
+				Size:         definition.Quota.Size,
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		nh.Errors = append(nh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
+)
+
+func TestNamespacesAuthorize(t *testing.T) {
+	ns, err := newNamespaces(configuration.Namespaces{
+		Definitions: []configuration.Namespace{
+			{
+				Name:   "acme",
+				Access: configuration.NamespaceAccess{Pull: []string{"*"}, Push: []string{"alice"}},
+			},
+			{
+				Name:   "acme/secret",
+				Access: configuration.NamespaceAccess{Pull: []string{"bob"}},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		user      string
+		name      string
+		namespace string
+		method    string
+		allowed   bool
+	}{
+		{user: "alice", name: "acme/app", method: "GET", allowed: true},
+		{user: "alice", name: "acme/app", method: "PUT", allowed: true},
+		{user: "bob", name: "acme/app", method: "GET", allowed: true},
+		{user: "bob", name: "acme/app", method: "PUT"},
+		{name: "acme/app", method: "GET"},
+		{user: "alice", name: "acme/secret/app", method: "GET"},
+		{user: "bob", name: "acme/secret/app", method: "GET", allowed: true},
+		{user: "bob", name: "acme/secret/app", method: "DELETE", allowed: true},
+		{user: "bob", name: "acme", method: "PUT", allowed: true},
+		{user: "bob", name: "other/app", method: "PUT", allowed: true},
+		{user: "alice", namespace: "acme/secret", method: "GET"},
+		{user: "bob", namespace: "acme/secret", method: "GET", allowed: true},
+		{namespace: "acme", method: "GET"},
+	} {
+		ctx := context.WithValue(context.Background(), auth.UserNameKey, tc.user)
+		ctx = context.WithValue(ctx, "vars.name", tc.name)
+		ctx = context.WithValue(ctx, "vars.namespace", tc.namespace)
+		r, _ := http.NewRequest(tc.method, "/", nil)
+
+		err := ns.authorize(ctx, r)
+		if tc.allowed && err != nil {
+			t.Errorf("%s %s%s as %q: unexpected error: %v", tc.method, tc.name, tc.namespace, tc.user, err)
+		} else if !tc.allowed && err == nil {
+			t.Errorf("%s %s%s as %q: expected access to be denied", tc.method, tc.name, tc.namespace, tc.user)
+		}
+	}
+}
+
+func TestNewNamespacesInvalid(t *testing.T) {
+	for _, definitions := range [][]configuration.Namespace{
+		{{Name: ""}},
+		{{Name: "acme/"}},
+		{{Name: "acme"}, {Name: "acme"}},
+		{{Name: "acme", Quota: configuration.NamespaceQuota{Size: -1}}},
+	} {
+		if _, err := newNamespaces(configuration.Namespaces{Definitions: definitions}, nil); err == nil {
+			t.Errorf("expected an error for %+v", definitions)
+		}
+	}
+}
+
+func TestNamespaceAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Namespaces: configuration.Namespaces{
+			UsageCache: time.Nanosecond,
+			Definitions: []configuration.Namespace{
+				{Name: "acme", Quota: configuration.NamespaceQuota{Repositories: 1}},
+			},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	createRepository(env, t, "acme/one", "latest")
+	createRepository(env, t, "other/two", "latest")
+
+	catalogURL, err := env.builder.BuildNamespaceCatalogURL("acme")
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error listing namespace: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "listing namespace", resp, http.StatusOK)
+
+	var catalog namespaceCatalogAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		t.Fatalf("error decoding catalog: %v", err)
+	}
+	if catalog.Namespace != "acme" || !reflect.DeepEqual(catalog.Repositories, []string{"acme/one"}) {
+		t.Fatalf("unexpected catalog: %+v", catalog)
+	}
+
+	usageURL, err := env.builder.BuildNamespaceUsageURL("acme")
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err = http.Get(usageURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching usage: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching usage", resp, http.StatusOK)
+
+	var usage namespaceUsageAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		t.Fatalf("error decoding usage: %v", err)
+	}
+	// one layer and the manifest
+	if usage.Namespace != "acme" || usage.Repositories != 1 || usage.Blobs != 2 || usage.Size <= 0 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if usage.Quota == nil || usage.Quota.Repositories != 1 {
+		t.Fatalf("unexpected quota: %+v", usage.Quota)
+	}
+
+	// the quota allows pushing to the existing repository only
+	one, _ := reference.WithName("acme/one")
+	startPushLayer(t, env, one)
+
+	two, _ := reference.WithName("acme/two")
+	uploadURL, err := env.builder.BuildBlobUploadURL(two)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err = http.Post(uploadURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "pushing beyond quota", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "pushing beyond quota", resp, errcode.ErrorCodeDenied)
+
+	// pagination of the namespace catalog
+	createRepository(env, t, "other/three", "latest")
+	catalogURL, _ = env.builder.BuildNamespaceCatalogURL("other", url.Values{"n": []string{"1"}})
+	resp, err = http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error listing namespace: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "listing namespace page", resp, http.StatusOK)
+	if resp.Header.Get("Link") == "" {
+		t.Fatalf("expected a link to the next page")
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// pullSizeDispatcher constructs the handler estimating the size of pulling a
+// manifest.
+func pullSizeDispatcher(ctx *Context, r *http.Request) http.Handler {
+	pullSizeHandler := &pullSizeHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		// We just have a tag
+		pullSizeHandler.Tag = reference
+	} else {
+		pullSizeHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(pullSizeHandler.GetPullSize),
+	}
+}
+
+// pullSizeHandler handles requests for the size of pulling a manifest.
+type pullSizeHandler struct {
+	*Context
+
+	// One of tag or digest gets set, depending on what is present in context.
+	Tag    string
+	Digest digest.Digest
+}
+
+type platformPullSize struct {
+	Digest   digest.Digest             `json:"digest"`
+	Platform manifestlist.PlatformSpec `json:"platform"`
+	Size     int64                     `json:"size"`
+}
+
+type pullSizeAPIResponse struct {
+	Name      string             `json:"name"`
+	Reference string             `json:"reference"`
+	Digest    digest.Digest      `json:"digest"`
+	MediaType string             `json:"mediaType"`
+	Size      int64              `json:"size"`
+	Platforms []platformPullSize `json:"platforms,omitempty"`
+}
+
+// GetPullSize returns the size of the manifest, its config and layers as
+// json, along with the size of each platform of manifest lists. The sizes are
+// read from the descriptors, except for the layers of schema1 manifests which
+// do not record them.
+func (ph *pullSizeHandler) GetPullSize(w http.ResponseWriter, r *http.Request) {
+	var platform *manifestlist.PlatformSpec
+	if p := r.URL.Query().Get("platform"); p != "" {
+		var err error
+		platform, err = parsePlatform(p)
+		if err != nil {
+			ph.Errors = append(ph.Errors, v2.ErrorCodePlatformInvalid.WithDetail(p))
+			return
+		}
+	}
+
+	response := pullSizeAPIResponse{
+		Name:      ph.Repository.Named().Name(),
+		Reference: ph.Tag,
+	}
+	if ph.Tag != "" {
+		desc, err := ph.Repository.Tags(ph).Get(ph, ph.Tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				ph.Errors = append(ph.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		ph.Digest = desc.Digest
+	} else {
+		response.Reference = ph.Digest.String()
+	}
+	response.Digest = ph.Digest
+
+	manifests, err := ph.Repository.Manifests(ph)
+	if err != nil {
+		ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	blobs := ph.Repository.Blobs(ph)
+
+	sizes := make(map[digest.Digest]int64)
+	manifest, err := pullBlobs(ph, manifests, blobs, ph.Digest, sizes)
+	if err != nil {
+		ph.appendPullSizeError(err)
+		return
+	}
+	response.MediaType, _, _ = manifest.Payload()
+
+	if list, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		descriptors := list.Manifests
+		if platform != nil {
+			desc, found := selectPlatform(list, *platform)
+			if !found {
+				ph.Errors = append(ph.Errors, v2.ErrorCodeManifestUnknown.WithDetail(fmt.Sprintf("no manifest for platform %s", r.URL.Query().Get("platform"))))
+				return
+			}
+			descriptors = []manifestlist.ManifestDescriptor{desc}
+		}
+
+		// the total counts the blobs shared by platforms once
+		for _, desc := range descriptors {
+			platformSizes := make(map[digest.Digest]int64)
+			if _, err := pullBlobs(ph, manifests, blobs, desc.Digest, platformSizes); err != nil {
+				ph.appendPullSizeError(err)
+				return
+			}
+			size := int64(0)
+			for dgst, blobSize := range platformSizes {
+				size += blobSize
+				sizes[dgst] = blobSize
+			}
+			response.Platforms = append(response.Platforms, platformPullSize{
+				Digest:   desc.Digest,
+				Platform: desc.Platform,
+				Size:     size,
+			})
+		}
+	}
+
+	for _, size := range sizes {
+		response.Size += size
+	}
+
+	p, err := json.Marshal(response)
+	if err != nil {
+		ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	w.Write(p)
+}
+
+func (ph *pullSizeHandler) appendPullSizeError(err error) {
+	if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+		ph.Errors = append(ph.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+	} else {
+		ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
+
+// pullBlobs records in sizes the size of the manifest identified by dgst and
+// of the blobs it references, other than the manifests listed by manifest
+// lists, returning the manifest.
+func pullBlobs(ctx context.Context, manifests distribution.ManifestService, blobs distribution.BlobStatter, dgst digest.Digest, sizes map[digest.Digest]int64) (distribution.Manifest, error) {
+	manifest, err := manifests.Get(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return nil, err
+	}
+	sizes[dgst] = int64(len(payload))
+
+	if _, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		return manifest, nil
+	}
+
+	for _, desc := range manifest.References() {
+		if _, ok := sizes[desc.Digest]; ok {
+			continue
+		}
+		if _, ok := manifest.(*schema1.SignedManifest); ok {
+			desc, err = blobs.Stat(ctx, desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sizes[desc.Digest] = desc.Size
+	}
+	return manifest, nil
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestPullSize(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	named, _ := reference.WithName("foo/app")
+	repository, err := env.app.registry.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadSize := func(dgst digest.Digest) int64 {
+		m, err := manifests.Get(env.ctx, dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, payload, _ := m.Payload()
+		return int64(len(payload))
+	}
+
+	configSize := int64(len(`{"architecture":"amd64","os":"linux"}`))
+	amd64 := putImage(t, env, "foo/app", "base", "one")
+	arm64 := putImage(t, env, "foo/app", "base", "two-two")
+	amd64Size := payloadSize(amd64.Digest()) + configSize + 4 + 3
+	arm64Size := payloadSize(arm64.Digest()) + configSize + 4 + 7
+
+	list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{
+			Descriptor: distribution.Descriptor{Digest: amd64.Digest(), Size: payloadSize(amd64.Digest()), MediaType: schema2.MediaTypeManifest},
+			Platform:   manifestlist.PlatformSpec{Architecture: "amd64", OS: "linux"},
+		},
+		{
+			Descriptor: distribution.Descriptor{Digest: arm64.Digest(), Size: payloadSize(arm64.Digest()), MediaType: schema2.MediaTypeManifest},
+			Platform:   manifestlist.PlatformSpec{Architecture: "arm64", OS: "linux", Variant: "v8"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listDigest, err := manifests.Put(env.ctx, list)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest list: %v", err)
+	}
+	if err := repository.Tags(env.ctx).Tag(env.ctx, "multi", distribution.Descriptor{Digest: listDigest}); err != nil {
+		t.Fatal(err)
+	}
+	listSize := payloadSize(listDigest)
+	multi, _ := reference.WithTag(named, "multi")
+
+	for _, tc := range []struct {
+		ref       reference.Named
+		platform  string
+		digest    digest.Digest
+		size      int64
+		platforms []int64
+	}{
+		{
+			ref:    amd64,
+			digest: amd64.Digest(),
+			size:   amd64Size,
+		},
+		{
+			// the layer and config shared by the platforms are counted once
+			ref:       multi,
+			digest:    listDigest,
+			size:      listSize + amd64Size + arm64Size - configSize - 4,
+			platforms: []int64{amd64Size, arm64Size},
+		},
+		{
+			ref:       multi,
+			platform:  "linux/arm64",
+			digest:    listDigest,
+			size:      listSize + arm64Size,
+			platforms: []int64{arm64Size},
+		},
+	} {
+		var values []url.Values
+		if tc.platform != "" {
+			values = append(values, url.Values{"platform": []string{tc.platform}})
+		}
+		sizeURL, err := env.builder.BuildPullSizeURL(tc.ref, values...)
+		if err != nil {
+			t.Fatalf("unexpected error building url: %v", err)
+		}
+		resp, err := http.Get(sizeURL)
+		if err != nil {
+			t.Fatalf("unexpected error getting pull size: %v", err)
+		}
+		checkResponse(t, "getting pull size", resp, http.StatusOK)
+
+		var body pullSizeAPIResponse
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("unexpected error decoding pull size: %v", err)
+		}
+		if body.Digest != tc.digest || body.Size != tc.size || len(body.Platforms) != len(tc.platforms) {
+			t.Fatalf("%s %s: unexpected pull size: %+v", tc.ref, tc.platform, body)
+		}
+		for i, size := range tc.platforms {
+			if body.Platforms[i].Size != size {
+				t.Fatalf("%s %s: unexpected pull size: %+v", tc.ref, tc.platform, body)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		platform string
+		status   int
+		code     errcode.ErrorCode
+	}{
+		{platform: "linux", status: http.StatusBadRequest, code: v2.ErrorCodePlatformInvalid},
+		{platform: "windows/amd64", status: http.StatusNotFound, code: v2.ErrorCodeManifestUnknown},
+	} {
+		sizeURL, _ := env.builder.BuildPullSizeURL(multi, url.Values{"platform": []string{tc.platform}})
+		resp, err := http.Get(sizeURL)
+		if err != nil {
+			t.Fatalf("unexpected error getting pull size: %v", err)
+		}
+		checkResponse(t, "getting pull size", resp, tc.status)
+		checkBodyHasErrorCodes(t, "getting pull size", resp, tc.code)
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	_ "github.com/docker/distribution/registry/storage/driver/s3-aws"
+	"github.com/docker/distribution/registry/storage/driver/s3-aws/s3test"
+)
+
+// TestS3Backend runs the blob and manifest API tests against the s3aws
+// driver, backed by a mock S3 server verifying the requests signatures.
+func TestS3Backend(t *testing.T) {
+	server := s3test.NewServer("accesskey", "secretkey", "registry")
+	defer server.Close()
+
+	// the SDK refuses a CA bundle along with the custom transport the
+	// registry sets its user agent with, and the mock server is plain HTTP
+	if bundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+		os.Unsetenv("AWS_CA_BUNDLE")
+		defer os.Setenv("AWS_CA_BUNDLE", bundle)
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"s3aws": configuration.Parameters{
+				"accesskey":      "accesskey",
+				"secretkey":      "secretkey",
+				"region":         "us-east-1",
+				"regionendpoint": server.URL,
+				"bucket":         "registry",
+				"v4auth":         false,
+				"rootdirectory":  "/registry",
+			},
+			"delete":   configuration.Parameters{"enabled": true},
+			"redirect": configuration.Parameters{"disable": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	args := makeBlobArgs(t)
+	testBlobAPI(t, env, args)
+	testBlobDelete(t, env, args)
+
+	imageName, _ := reference.WithName("foo/schema2")
+	schema2Args := testManifestAPISchema2(t, env, imageName)
+	testManifestAPIManifestList(t, env, schema2Args)
+
+	if server.Requests("CompleteMultipartUpload") == 0 {
+		t.Fatal("expected blobs to be uploaded to the mock server")
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/scan"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// scanReportDispatcher constructs the handler returning the scan report of a
+// manifest.
+func scanReportDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	scanReportHandler := &scanReportHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(scanReportHandler.GetScanReport),
+	}
+}
+
+// scanReportHandler handles requests for the scan report of a manifest.
+type scanReportHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+type scanReportAPIResponse struct {
+	Name   string        `json:"name"`
+	Digest digest.Digest `json:"digest"`
+	Report *scan.Report  `json:"report,omitempty"`
+}
+
+// GetScanReport returns the scan report of a manifest as json.
+func (sh *scanReportHandler) GetScanReport(w http.ResponseWriter, r *http.Request) {
+	if sh.App.scanner == nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnsupported.WithDetail("scanning is not enabled"))
+		return
+	}
+
+	manifests, err := sh.Repository.Manifests(sh)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	exists, err := manifests.Exists(sh, sh.Digest)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if !exists {
+		sh.Errors = append(sh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(sh.Digest))
+		return
+	}
+
+	response := scanReportAPIResponse{
+		Name:   sh.Repository.Named().Name(),
+		Digest: sh.Digest,
+	}
+
+	report, err := sh.App.scanner.Report(sh, response.Name, sh.Digest)
+	switch err {
+	case nil:
+		response.Report = &report
+	case scan.ErrNoReport:
+	default:
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// applyScanPolicy refuses to serve a manifest whose scan report exceeds the
+// configured severity. Manifests which have not been scanned yet are served,
+// as are manifests whose report cannot be read.
+func (imh *manifestHandler) applyScanPolicy() error {
+	return scanPolicy(imh.Context, imh.Repository.Named().Name(), imh.Digest)
+}
+
+// scanPolicy returns the error refusing to serve the manifest dgst of the
+// named repository, or the content it references, if its scan report exceeds
+// the configured severity.
+func scanPolicy(ctx *Context, name string, dgst digest.Digest) error {
+	severity := ctx.App.Config.Scanning.BlockSeverity
+	if ctx.App.scanner == nil || severity == "" {
+		return nil
+	}
+
+	report, err := ctx.App.scanner.Report(ctx, name, dgst)
+	if err != nil {
+		if err != scan.ErrNoReport {
+			dcontext.GetLogger(ctx).Errorf("error reading scan report of %s: %v", dgst, err)
+		}
+		return nil
+	}
+
+	if report.Exceeds(severity) {
+		return errcode.ErrorCodeDenied.WithMessage("manifest blocked by vulnerability policy").WithDetail(map[string]interface{}{
+			"digest":     dgst,
+			"report":     report.Digest,
+			"severities": report.Severities,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/scan"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestScanPolicy(t *testing.T) {
+	reportDigest := digest.FromString("report")
+	scanner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"report":     reportDigest,
+			"severities": map[string]int{"medium": 4, "critical": 1},
+		})
+	}))
+	defer scanner.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Scanning: configuration.Scanning{
+			Enabled:       true,
+			Endpoint:      scanner.URL,
+			BlockSeverity: "critical",
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/scanned")
+	dgst := createRepository(env, t, name.Name(), "latest")
+
+	// Scans run in the background once the push event is received
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err := env.app.scanner.Report(env.ctx, name.Name(), dgst)
+		if err == nil {
+			break
+		}
+		if err != scan.ErrNoReport || time.Now().After(deadline) {
+			t.Fatalf("manifest was not scanned: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tagRef, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+
+	resp, err := http.Get(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching blocked manifest", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "fetching blocked manifest", resp, errcode.ErrorCodeDenied)
+
+	resp, err = http.Head(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "checking blocked manifest", resp, http.StatusOK)
+
+	digestRef, _ := reference.WithDigest(name, dgst)
+	scanReportURL, err := env.builder.BuildScanReportURL(digestRef)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err = http.Get(scanReportURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching scan report: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching scan report", resp, http.StatusOK)
+
+	var response scanReportAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("error decoding scan report: %v", err)
+	}
+	if response.Name != name.Name() || response.Digest != dgst || response.Report == nil {
+		t.Fatalf("unexpected scan report response: %+v", response)
+	}
+	if response.Report.Digest != reportDigest || response.Report.Severities["critical"] != 1 {
+		t.Fatalf("unexpected scan report: %+v", response.Report)
+	}
+
+	unknownRef, _ := reference.WithDigest(name, digest.FromString("unknown"))
+	scanReportURL, _ = env.builder.BuildScanReportURL(unknownRef)
+	resp, err = http.Get(scanReportURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching scan report: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching scan report of unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching scan report of unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+
+	// Relaxing the policy serves the manifest again
+	env.app.Config.Scanning.BlockSeverity = ""
+	resp, err = http.Get(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching unblocked manifest", resp, http.StatusOK)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+)
+
+func TestSchema1Disabled(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.Compatibility.Schema1.Disabled = true
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	// a schema1 manifest stored before schema1 was disabled
+	named, _ := reference.WithName("foo/legacy")
+	legacy, err := storage.NewRegistry(env.ctx, env.app.driver, storage.EnableSchema1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository, err := legacy.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := repository.Blobs(env.ctx).Put(env.ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := schema1.Sign(&schema1.Manifest{
+		Versioned: manifest.Versioned{SchemaVersion: 1},
+		Name:      named.Name(),
+		Tag:       "old",
+		FSLayers:  []schema1.FSLayer{{BlobSum: layer.Digest}},
+		History:   []schema1.History{{V1Compatibility: "{}"}},
+	}, env.pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(env.ctx, signed)
+	if err != nil {
+		t.Fatalf("unexpected error putting schema1 manifest: %v", err)
+	}
+
+	digestRef, _ := reference.WithDigest(named, dgst)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{"GET", "HEAD"} {
+		req, _ := http.NewRequest(method, digestURL, nil)
+		req.Header.Set("Accept", schema1.MediaTypeSignedManifest)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error pulling schema1 manifest: %v", err)
+		}
+		resp.Body.Close()
+		checkResponse(t, method+" schema1 manifest", resp, http.StatusBadRequest)
+	}
+	req, _ := http.NewRequest("GET", digestURL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBodyHasErrorCodes(t, "pulling schema1 manifest", resp, v2.ErrorCodeManifestSchema1Disabled)
+	resp.Body.Close()
+
+	tagRef, _ := reference.WithTag(named, "new")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = putManifest(t, "pushing schema1 manifest", tagURL, schema1.MediaTypeSignedManifest, signed)
+	checkResponse(t, "pushing schema1 manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "pushing schema1 manifest", resp, v2.ErrorCodeManifestSchema1Disabled)
+	resp.Body.Close()
+
+	// schema2 manifests are not converted for clients not accepting them
+	image := putImage(t, env, "foo/app", "layer")
+	appRepository, err := env.app.registry.Repository(env.ctx, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := appRepository.Tags(env.ctx).Tag(env.ctx, "latest", distribution.Descriptor{Digest: image.Digest()}); err != nil {
+		t.Fatal(err)
+	}
+	appNamed, _ := reference.WithName("foo/app")
+	latest, _ := reference.WithTag(appNamed, "latest")
+	latestURL, err := env.builder.BuildManifestURL(latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(latestURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "pulling schema2 manifest without accepting it", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "pulling schema2 manifest without accepting it", resp, v2.ErrorCodeManifestSchema1Disabled)
+	resp.Body.Close()
+
+	req, _ = http.NewRequest("GET", latestURL, nil)
+	req.Header.Set("Accept", schema2.MediaTypeManifest)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "pulling schema2 manifest", resp, http.StatusOK)
+
+	// manifest lists are resolved to the schema2 manifest of the default
+	// platform for clients accepting schema2 manifests only
+	appManifests, err := appRepository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := appManifests.Get(env.ctx, image.Digest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, _ := m.Payload()
+	list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{{
+		Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: image.Digest(), Size: int64(len(payload))},
+		Platform:   manifestlist.PlatformSpec{Architecture: "amd64", OS: "linux"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listDigest, err := appManifests.Put(env.ctx, list)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest list: %v", err)
+	}
+	if err := appRepository.Tags(env.ctx).Tag(env.ctx, "multi", distribution.Descriptor{Digest: listDigest}); err != nil {
+		t.Fatal(err)
+	}
+	multi, _ := reference.WithTag(appNamed, "multi")
+	multiURL, err := env.builder.BuildManifestURL(multi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest("GET", multiURL, nil)
+	req.Header.Set("Accept", schema2.MediaTypeManifest)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "pulling manifest list without accepting it", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{schema2.MediaTypeManifest},
+		"Docker-Content-Digest": []string{image.Digest().String()},
+	})
+
+	resp, err = http.Get(multiURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "pulling manifest list without accepting schema2", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "pulling manifest list without accepting schema2", resp, v2.ErrorCodeManifestSchema1Disabled)
+	resp.Body.Close()
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// layerSharingDispatcher constructs the handler reporting the sharing of the
+// layers of an image.
+func layerSharingDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	layerSharingHandler := &layerSharingHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(layerSharingHandler.GetLayerSharing),
+	}
+}
+
+// layerSharingHandler handles requests for the sharing of the layers of an
+// image.
+type layerSharingHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+type sharedLayer struct {
+	Digest       digest.Digest `json:"digest"`
+	Size         int64         `json:"size"`
+	MediaType    string        `json:"mediaType,omitempty"`
+	Repositories int           `json:"repositories"`
+}
+
+type layerSharingAPIResponse struct {
+	Name       string        `json:"name"`
+	Digest     digest.Digest `json:"digest"`
+	Layers     []sharedLayer `json:"layers"`
+	Size       int64         `json:"size"`
+	SharedSize int64         `json:"sharedSize"`
+	UniqueSize int64         `json:"uniqueSize"`
+}
+
+// GetLayerSharing returns, for each layer of the image, the number of other
+// repositories referencing it as json. The other repositories are not named,
+// as the client may not have access to them.
+func (lh *layerSharingHandler) GetLayerSharing(w http.ResponseWriter, r *http.Request) {
+	index, ok := lh.tenant.registry.(distribution.BlobReferenceIndex)
+	if !ok {
+		lh.Errors = append(lh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the reference index is not maintained by this registry"))
+		return
+	}
+
+	manifests, err := lh.Repository.Manifests(lh)
+	if err != nil {
+		lh.Errors = append(lh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	m, err := manifests.Get(lh, lh.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			lh.Errors = append(lh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(lh.Digest))
+		} else {
+			lh.Errors = append(lh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	var layers []distribution.Descriptor
+	switch m := m.(type) {
+	case *schema2.DeserializedManifest:
+		layers = m.Layers
+	case *ocischema.DeserializedManifest:
+		layers = m.Layers
+	case *schema1.SignedManifest:
+		layers = m.References()
+	case *manifestlist.DeserializedManifestList:
+		lh.Errors = append(lh.Errors, v2.ErrorCodeManifestInvalid.WithDetail("the manifest is a manifest list, query the manifest of a platform"))
+		return
+	default:
+		lh.Errors = append(lh.Errors, errcode.ErrorCodeUnknown.WithDetail(fmt.Errorf("unexpected manifest type %T", m)))
+		return
+	}
+
+	response := layerSharingAPIResponse{
+		Name:   lh.Repository.Named().Name(),
+		Digest: lh.Digest,
+		Layers: []sharedLayer{},
+	}
+	seen := make(map[digest.Digest]struct{})
+	for _, layer := range layers {
+		if _, ok := seen[layer.Digest]; ok {
+			continue
+		}
+		seen[layer.Digest] = struct{}{}
+
+		if layer.Size == 0 {
+			// schema1 manifests do not record the size of layers
+			desc, err := lh.Repository.Blobs(lh).Stat(lh, layer.Digest)
+			if err != nil && err != distribution.ErrBlobUnknown {
+				lh.Errors = append(lh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+				return
+			}
+			layer.Size = desc.Size
+		}
+
+		references, err := index.BlobReferences(lh, layer.Digest)
+		if err != nil {
+			if err == distribution.ErrUnsupported {
+				lh.Errors = append(lh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the reference index is not maintained by this registry"))
+			} else if err == distribution.ErrReferenceIndexIncomplete {
+				lh.Errors = append(lh.Errors, errcode.ErrorCodeUnavailable.WithDetail(referenceIndexIncompleteDetail))
+			} else {
+				lh.Errors = append(lh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		repositories := make(map[string]struct{})
+		for _, reference := range references {
+			if reference.Repository != response.Name {
+				repositories[reference.Repository] = struct{}{}
+			}
+		}
+
+		response.Layers = append(response.Layers, sharedLayer{
+			Digest:       layer.Digest,
+			Size:         layer.Size,
+			MediaType:    layer.MediaType,
+			Repositories: len(repositories),
+		})
+		response.Size += layer.Size
+		if len(repositories) > 0 {
+			response.SharedSize += layer.Size
+		} else {
+			response.UniqueSize += layer.Size
+		}
+	}
+
+	p, err := json.Marshal(response)
+	if err != nil {
+		lh.Errors = append(lh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	w.Write(p)
+}
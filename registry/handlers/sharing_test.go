@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/opencontainers/go-digest"
+)
+
+// putImage stores a schema2 image made of the given layers in the named
+// repository, returning the digest of its manifest.
+func putImage(t *testing.T, env *testEnv, name string, layers ...string) reference.Canonical {
+	t.Helper()
+	named, _ := reference.WithName(name)
+	repository, err := env.app.registry.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repository.Blobs(env.ctx)
+
+	config, err := blobs.Put(env.ctx, schema2.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	config.MediaType = schema2.MediaTypeImageConfig
+	m := schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+	}
+	for _, layer := range layers {
+		desc, err := blobs.Put(env.ctx, schema2.MediaTypeLayer, []byte(layer))
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+		desc.MediaType = schema2.MediaTypeLayer
+		m.Layers = append(m.Layers, desc)
+	}
+
+	deserialized, err := schema2.FromStruct(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(env.ctx, deserialized)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	canonical, _ := reference.WithDigest(named, dgst)
+	return canonical
+}
+
+func TestLayerSharing(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.ReferenceIndex.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	image := putImage(t, env, "foo/app", "base", "app", "app")
+	putImage(t, env, "foo/app", "base", "app v2")
+	putImage(t, env, "foo/other", "base", "other")
+	putImage(t, env, "bar", "base")
+	if err := storage.RebuildReferenceIndex(env.ctx, env.app.driver, env.app.registry, storage.RebuildReferenceIndexOpts{}); err != nil {
+		t.Fatalf("unexpected error rebuilding the reference index: %v", err)
+	}
+
+	sharingURL, err := env.builder.BuildLayerSharingURL(image)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(sharingURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting layer sharing: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting layer sharing", resp, http.StatusOK)
+
+	var body layerSharingAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error decoding layer sharing: %v", err)
+	}
+
+	// layers repeated in a manifest are reported once, and layers shared
+	// with other images of the repository only are unique
+	expected := layerSharingAPIResponse{
+		Name:   "foo/app",
+		Digest: image.Digest(),
+		Layers: []sharedLayer{
+			{Digest: digest.FromString("base"), Size: 4, MediaType: schema2.MediaTypeLayer, Repositories: 2},
+			{Digest: digest.FromString("app"), Size: 3, MediaType: schema2.MediaTypeLayer, Repositories: 0},
+		},
+		Size:       7,
+		SharedSize: 4,
+		UniqueSize: 3,
+	}
+	if len(body.Layers) != len(expected.Layers) || body.Name != expected.Name || body.Digest != expected.Digest ||
+		body.Size != expected.Size || body.SharedSize != expected.SharedSize || body.UniqueSize != expected.UniqueSize {
+		t.Fatalf("expected %+v, got %+v", expected, body)
+	}
+	for i := range body.Layers {
+		if body.Layers[i] != expected.Layers[i] {
+			t.Fatalf("expected %+v, got %+v", expected, body)
+		}
+	}
+
+	// manifest lists have no layers
+	named, _ := reference.WithName("foo/app")
+	repository, _ := env.app.registry.Repository(env.ctx, named)
+	manifests, _ := repository.Manifests(env.ctx)
+	m, err := manifests.Get(env.ctx, image.Digest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, _ := m.Payload()
+	list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{{
+		Descriptor: distribution.Descriptor{Digest: image.Digest(), Size: int64(len(payload)), MediaType: schema2.MediaTypeManifest},
+		Platform:   manifestlist.PlatformSpec{Architecture: "amd64", OS: "linux"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listDigest, err := manifests.Put(env.ctx, list)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest list: %v", err)
+	}
+	listRef, _ := reference.WithDigest(named, listDigest)
+	sharingURL, _ = env.builder.BuildLayerSharingURL(listRef)
+	resp, err = http.Get(sharingURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting layer sharing: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting layer sharing of a manifest list", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "getting layer sharing of a manifest list", resp, v2.ErrorCodeManifestInvalid)
+}
+
+func TestLayerSharingDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	image := putImage(t, env, "foo/app", "base")
+	sharingURL, err := env.builder.BuildLayerSharingURL(image)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(sharingURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting layer sharing: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting layer sharing", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "getting layer sharing", resp, errcode.ErrorCodeUnsupported)
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// mediaTypeCosignSimpleSigning is the media type of the layers of the
+	// manifests under which cosign pushes signatures.
+	mediaTypeCosignSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// mediaTypeDSSEEnvelope is the media type of the layers of the
+	// manifests under which cosign pushes attestations.
+	mediaTypeDSSEEnvelope = "application/vnd.dsse.envelope.v1+json"
+)
+
+// signatureArtifactTagRegexp matches the tags under which cosign pushes the
+// signatures and attestations of a manifest.
+var signatureArtifactTagRegexp = regexp.MustCompile(`^[a-z0-9]+-[a-fA-F0-9]+\.(sig|att)$`)
+
+// signatureArtifactLayerTypes maps the suffix of the tags matching
+// signatureArtifactTagRegexp to the media type of the layers of the
+// artifacts pushed under them.
+var signatureArtifactLayerTypes = map[string]string{
+	"sig": mediaTypeCosignSimpleSigning,
+	"att": mediaTypeDSSEEnvelope,
+}
+
+// signatureArtifactTypes are the artifact types of the signatures attached
+// to a manifest as referrers, by cosign and notation.
+var signatureArtifactTypes = map[string]struct{}{
+	"application/vnd.dev.cosign.artifact.sig.v1+json": {},
+	"application/vnd.cncf.notary.signature":           {},
+}
+
+// attestationArtifactTypes are the artifact types of the attestations
+// attached to a manifest as referrers.
+var attestationArtifactTypes = map[string]struct{}{
+	mediaTypeDSSEEnvelope:          {},
+	"application/vnd.in-toto+json": {},
+}
+
+// signatureTag returns the tag of the cosign signature of the manifest
+// identified by dgst.
+func signatureTag(dgst digest.Digest) string {
+	return strings.Replace(dgst.String(), ":", "-", 1) + ".sig"
+}
+
+// isSignatureArtifact returns true if manifest, pushed under tag, is the
+// signature or attestation of another manifest: either a manifest referring
+// to its subject with the artifact type of a signature or attestation, or a
+// manifest tagged following the cosign conventions whose layers all have
+// the media type of cosign signatures or attestations. Artifacts only named
+// like signatures are not.
+func isSignatureArtifact(tag string, manifest distribution.Manifest) bool {
+	var layers []distribution.Descriptor
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		if m.Subject != nil {
+			artifactType := m.ArtifactType
+			if artifactType == "" {
+				artifactType = m.Config.MediaType
+			}
+			_, signature := signatureArtifactTypes[artifactType]
+			_, attestation := attestationArtifactTypes[artifactType]
+			return signature || attestation
+		}
+		layers = m.Layers
+	case *schema2.DeserializedManifest:
+		layers = m.Layers
+	default:
+		return false
+	}
+
+	match := signatureArtifactTagRegexp.FindStringSubmatch(tag)
+	if match == nil || len(layers) == 0 {
+		return false
+	}
+	for _, layer := range layers {
+		if layer.MediaType != signatureArtifactLayerTypes[match[1]] {
+			return false
+		}
+	}
+	return true
+}
+
+// signaturesDispatcher constructs the handler listing the signatures of a
+// manifest.
+func signaturesDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	signaturesHandler := &signaturesHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(signaturesHandler.GetSignatures),
+	}
+}
+
+// signaturesHandler handles requests for the signatures of a manifest.
+type signaturesHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+type signaturesAPIResponse struct {
+	Name       string                    `json:"name"`
+	Digest     digest.Digest             `json:"digest"`
+	Tag        string                    `json:"tag"`
+	Manifest   *distribution.Descriptor  `json:"manifest,omitempty"`
+	Signatures []distribution.Descriptor `json:"signatures"`
+}
+
+// GetSignatures returns the cosign signatures of a manifest as json. Each
+// signature is a layer of the manifest tagged with the signature tag of the
+// digest, carrying the signature in its annotations.
+func (sh *signaturesHandler) GetSignatures(w http.ResponseWriter, r *http.Request) {
+	manifests, err := sh.Repository.Manifests(sh)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	exists, err := manifests.Exists(sh, sh.Digest)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if !exists {
+		sh.Errors = append(sh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(sh.Digest))
+		return
+	}
+
+	response := signaturesAPIResponse{
+		Name:       sh.Repository.Named().Name(),
+		Digest:     sh.Digest,
+		Tag:        signatureTag(sh.Digest),
+		Signatures: []distribution.Descriptor{},
+	}
+
+	desc, err := sh.Repository.Tags(sh).Get(sh, response.Tag)
+	switch err.(type) {
+	case nil:
+		signatures, err := manifests.Get(sh, desc.Digest)
+		if err != nil {
+			sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		mediaType, _, err := signatures.Payload()
+		if err != nil {
+			sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		desc.MediaType = mediaType
+		response.Manifest = &desc
+
+		switch m := signatures.(type) {
+		case *ocischema.DeserializedManifest:
+			response.Signatures = append(response.Signatures, m.Layers...)
+		case *schema2.DeserializedManifest:
+			response.Signatures = append(response.Signatures, m.Layers...)
+		default:
+			sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(
+				fmt.Errorf("unexpected signature manifest type %s", mediaType)))
+			return
+		}
+	case distribution.ErrTagUnknown:
+		// the manifest is not signed
+	default:
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// applySignaturePolicy checks that a manifest tagged into a namespace
+// requiring signatures has been signed. Pushing the signatures and
+// attestations themselves is always allowed.
+func (imh *manifestHandler) applySignaturePolicy(manifest distribution.Manifest, dgst digest.Digest) error {
+	if imh.Tag == "" || isSignatureArtifact(imh.Tag, manifest) {
+		return nil
+	}
+	return signaturePolicy(imh.Context, imh.Repository, dgst)
+}
+
+// signaturePolicy returns the error refusing the manifest dgst of repository
+// if it belongs to a namespace requiring signatures and has not been signed.
+func signaturePolicy(ctx *Context, repository distribution.Repository, dgst digest.Digest) error {
+	definition := ctx.namespaces.definition(repository.Named().Name())
+	if definition == nil || !definition.RequireSignatures {
+		return nil
+	}
+
+	signed, err := signed(ctx, repository, dgst)
+	if err != nil {
+		return errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+	if !signed {
+		return errcode.ErrorCodeDenied.WithMessage("manifest is not signed").WithDetail(map[string]string{
+			"namespace": definition.Name,
+			"digest":    dgst.String(),
+		})
+	}
+	return nil
+}
+
+// signed returns true if the manifest dgst has a cosign signature tagged
+// following the cosign conventions, or a signature among its referrers.
+func signed(ctx *Context, repository distribution.Repository, dgst digest.Digest) (bool, error) {
+	desc, err := repository.Tags(ctx).Get(ctx, signatureTag(dgst))
+	switch err.(type) {
+	case nil:
+		manifests, err := repository.Manifests(ctx)
+		if err != nil {
+			return false, err
+		}
+		signature, err := manifests.Get(ctx, desc.Digest)
+		if err != nil {
+			return false, err
+		}
+		if isSignatureArtifact(signatureTag(dgst), signature) {
+			return true, nil
+		}
+	case distribution.ErrTagUnknown, distribution.ErrRepositoryUnknown:
+	default:
+		return false, err
+	}
+
+	stored, err := ctx.tenant.registry.Repository(ctx, repository.Named())
+	if err != nil {
+		return false, err
+	}
+	manifests, err := stored.Manifests(ctx)
+	if err != nil {
+		return false, err
+	}
+	lister, ok := manifests.(distribution.ManifestReferrers)
+	if !ok {
+		return false, nil
+	}
+	referrers, err := lister.Referrers(ctx, dgst)
+	if err != nil {
+		return false, err
+	}
+	for _, referrer := range referrers {
+		if _, ok := signatureArtifactTypes[referrer.ArtifactType]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
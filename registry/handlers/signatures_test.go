@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestSignatureArtifacts(t *testing.T) {
+	dgst := digest.FromString("image")
+	if tag := signatureTag(dgst); tag != "sha256-"+dgst.Hex()+".sig" {
+		t.Fatalf("unexpected signature tag %q", tag)
+	}
+
+	schema2Manifest := func(mediaType string) distribution.Manifest {
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromString("config")},
+			Layers:    []distribution.Descriptor{{MediaType: mediaType, Digest: digest.FromString("layer")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	ociManifest := func(artifactType string, subject *distribution.Descriptor) distribution.Manifest {
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: artifactType,
+			Config:       distribution.Descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: digest.FromString("{}")},
+			Layers:       []distribution.Descriptor{{MediaType: "application/octet-stream", Digest: digest.FromString("layer")}},
+			Subject:      subject,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	subject := &distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst}
+
+	for _, tc := range []struct {
+		description string
+		tag         string
+		manifest    distribution.Manifest
+		expected    bool
+	}{
+		{"cosign signature", signatureTag(dgst), schema2Manifest(mediaTypeCosignSimpleSigning), true},
+		{"cosign attestation", "sha256-" + dgst.Hex() + ".att", schema2Manifest(mediaTypeDSSEEnvelope), true},
+		{"image named like a signature", signatureTag(dgst), schema2Manifest(schema2.MediaTypeLayer), false},
+		{"attestation named like a signature", signatureTag(dgst), schema2Manifest(mediaTypeDSSEEnvelope), false},
+		{"cosign sbom", "sha256-" + dgst.Hex() + ".sbom", schema2Manifest("text/spdx+json"), false},
+		{"signature layers under another tag", "latest", schema2Manifest(mediaTypeCosignSimpleSigning), false},
+		{"signature layers under a version tag", "v1.sig", schema2Manifest(mediaTypeCosignSimpleSigning), false},
+		{"notation signature", "latest", ociManifest("application/vnd.cncf.notary.signature", subject), true},
+		{"attestation referrer", "latest", ociManifest(mediaTypeDSSEEnvelope, subject), true},
+		{"other referrer", signatureTag(dgst), ociManifest("application/vnd.example", subject), false},
+		{"signature type without subject", "latest", ociManifest("application/vnd.cncf.notary.signature", nil), false},
+	} {
+		if isSignatureArtifact(tc.tag, tc.manifest) != tc.expected {
+			t.Errorf("%s: expected isSignatureArtifact to be %v", tc.description, tc.expected)
+		}
+	}
+}
+
+func TestSignaturesAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Namespaces: configuration.Namespaces{
+			Definitions: []configuration.Namespace{
+				{Name: "signed", RequireSignatures: true},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("signed/app")
+	repo, err := env.app.registry.Repository(env.ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+
+	// makeManifest stores the blobs of a schema2 manifest with one layer
+	// of the given media type and returns its payload.
+	makeManifest := func(mediaType string, layer []byte, annotations map[string]string) []byte {
+		blobs := repo.Blobs(env.ctx)
+		config, err := blobs.Put(env.ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+		layerDesc, err := blobs.Put(env.ctx, schema2.MediaTypeLayer, layer)
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+		layerDesc.MediaType = mediaType
+		layerDesc.Annotations = annotations
+
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    config,
+			Layers:    []distribution.Descriptor{layerDesc},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+		_, payload, _ := m.Payload()
+		return payload
+	}
+
+	putTagged := func(tag string, payload []byte) *http.Response {
+		ref, _ := reference.WithTag(name, tag)
+		manifestURL, err := env.builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error building url: %v", err)
+		}
+		req, _ := http.NewRequest("PUT", manifestURL, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", schema2.MediaTypeManifest)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		return resp
+	}
+
+	getSignatures := func(dgst digest.Digest) signaturesAPIResponse {
+		ref, _ := reference.WithDigest(name, dgst)
+		signaturesURL, err := env.builder.BuildSignaturesURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error building url: %v", err)
+		}
+		resp, err := http.Get(signaturesURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching signatures: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "fetching signatures", resp, http.StatusOK)
+
+		var response signaturesAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatalf("error decoding signatures: %v", err)
+		}
+		return response
+	}
+
+	image := makeManifest(schema2.MediaTypeLayer, []byte("image layer"), nil)
+	imageDigest := digest.FromBytes(image)
+
+	// The signature requirement does not apply to pushes by digest
+	ref, _ := reference.WithDigest(name, imageDigest)
+	manifestURL, _ := env.builder.BuildManifestURL(ref)
+	req, _ := http.NewRequest("PUT", manifestURL, bytes.NewReader(image))
+	req.Header.Set("Content-Type", schema2.MediaTypeManifest)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest by digest", resp, http.StatusCreated)
+
+	if response := getSignatures(imageDigest); len(response.Signatures) != 0 || response.Manifest != nil {
+		t.Fatalf("expected no signatures, got %+v", response)
+	}
+
+	resp = putTagged("latest", image)
+	defer resp.Body.Close()
+	checkResponse(t, "tagging unsigned manifest", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "tagging unsigned manifest", resp, errcode.ErrorCodeDenied)
+
+	// images named like signatures are not exempt
+	resp = putTagged(signatureTag(imageDigest), makeManifest(schema2.MediaTypeLayer, []byte("other layer"), nil))
+	defer resp.Body.Close()
+	checkResponse(t, "tagging image as a signature", resp, http.StatusForbidden)
+
+	signature := makeManifest(mediaTypeCosignSimpleSigning, []byte(`{"critical":{}}`), map[string]string{
+		"dev.cosignproject.cosign/signature": "MEUCIQ...",
+	})
+	resp = putTagged(signatureTag(imageDigest), signature)
+	defer resp.Body.Close()
+	checkResponse(t, "pushing signature", resp, http.StatusCreated)
+
+	response := getSignatures(imageDigest)
+	if response.Tag != signatureTag(imageDigest) || response.Manifest == nil || response.Manifest.Digest != digest.FromBytes(signature) {
+		t.Fatalf("unexpected signatures response: %+v", response)
+	}
+	if len(response.Signatures) != 1 || response.Signatures[0].Annotations["dev.cosignproject.cosign/signature"] != "MEUCIQ..." {
+		t.Fatalf("unexpected signatures: %+v", response.Signatures)
+	}
+
+	resp = putTagged("latest", image)
+	defer resp.Body.Close()
+	checkResponse(t, "tagging signed manifest", resp, http.StatusCreated)
+
+	// signatures attached as referrers sign their subject too
+	other := makeManifest(schema2.MediaTypeLayer, []byte("other image layer"), nil)
+	otherDigest := digest.FromBytes(other)
+	resp = putTagged("other", other)
+	defer resp.Body.Close()
+	checkResponse(t, "tagging unsigned manifest", resp, http.StatusForbidden)
+
+	blobs := repo.Blobs(env.ctx)
+	emptyConfig, err := blobs.Put(env.ctx, "application/vnd.oci.empty.v1+json", []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	emptyConfig.MediaType = "application/vnd.oci.empty.v1+json"
+	envelope, err := blobs.Put(env.ctx, "application/jose+json", []byte("signature envelope"))
+	if err != nil {
+		t.Fatalf("unexpected error putting signature: %v", err)
+	}
+	envelope.MediaType = "application/jose+json"
+	referrer, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: "application/vnd.cncf.notary.signature",
+		Config:       emptyConfig,
+		Layers:       []distribution.Descriptor{envelope},
+		Subject:      &distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: otherDigest, Size: int64(len(other))},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating signature: %v", err)
+	}
+	_, referrerPayload, _ := referrer.Payload()
+	ref, _ = reference.WithDigest(name, digest.FromBytes(referrerPayload))
+	manifestURL, _ = env.builder.BuildManifestURL(ref)
+	req, _ = http.NewRequest("PUT", manifestURL, bytes.NewReader(referrerPayload))
+	req.Header.Set("Content-Type", v1.MediaTypeImageManifest)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error putting signature: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "pushing signature referrer", resp, http.StatusCreated)
+
+	resp = putTagged("other", other)
+	defer resp.Body.Close()
+	checkResponse(t, "tagging manifest signed by a referrer", resp, http.StatusCreated)
+
+	ref, _ = reference.WithDigest(name, digest.FromString("unknown"))
+	signaturesURL, _ := env.builder.BuildSignaturesURL(ref)
+	resp, err = http.Get(signaturesURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching signatures: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching signatures of unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching signatures of unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+}
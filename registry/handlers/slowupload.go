@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+// defaultUploadGracePeriod delays the enforcement of the minimum upload rate
+// when no grace period is configured.
+const defaultUploadGracePeriod = 30 * time.Second
+
+var (
+	// errUploadStalled is returned when an upload receives no data for
+	// longer than the stall timeout.
+	errUploadStalled = errors.New("upload stalled")
+
+	// errUploadTooSlow is returned when an upload is slower on average than
+	// the minimum rate.
+	errUploadTooSlow = errors.New("upload too slow")
+)
+
+// connContextKey stores the connection of a request in its context.
+type connContextKey struct{}
+
+// ConnContext stores the connection of requests in their context, so that
+// stalled uploads can be aborted. Set it as the ConnContext of the
+// http.Server serving the app.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// uploadGuard aborts blob uploads from clients which stall or send data too
+// slowly, which would otherwise hold buffers and upload sessions open
+// indefinitely.
+type uploadGuard struct {
+	stall       time.Duration
+	minRate     int64
+	gracePeriod time.Duration
+}
+
+// newUploadGuard returns a guard for the given configuration, or nil if
+// neither limit is enabled.
+func newUploadGuard(config configuration.UploadTimeouts) *uploadGuard {
+	if config.Stall <= 0 && config.MinRate <= 0 {
+		return nil
+	}
+
+	gracePeriod := config.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultUploadGracePeriod
+	}
+
+	return &uploadGuard{
+		stall:       config.Stall,
+		minRate:     config.MinRate,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// guard replaces the body of r with one failing with errUploadStalled or
+// errUploadTooSlow when the client is too slow. The returned function must be
+// called once the body has been read. A nil guard leaves the body as is.
+func (g *uploadGuard) guard(r *http.Request) func() {
+	if g == nil {
+		return func() {}
+	}
+
+	body := &guardedBody{
+		ReadCloser: r.Body,
+		guard:      g,
+		started:    time.Now(),
+	}
+	if g.stall > 0 {
+		body.timer = time.AfterFunc(g.stall, func() {
+			atomic.StoreInt32(&body.stalled, 1)
+			abortRequestBody(r, body.ReadCloser)
+		})
+	}
+	r.Body = body
+
+	return func() {
+		if body.timer != nil {
+			body.timer.Stop()
+		}
+	}
+}
+
+// abortRequestBody unblocks pending reads of a request body. Closing the body
+// is enough for HTTP/2 streams, while HTTP/1 requests need their connection
+// closed.
+func abortRequestBody(r *http.Request, body io.Closer) {
+	if r.ProtoMajor >= 2 {
+		body.Close()
+		return
+	}
+	if conn, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+		conn.Close()
+	}
+}
+
+// guardedBody is a request body enforcing the limits of an uploadGuard.
+type guardedBody struct {
+	io.ReadCloser
+	guard   *uploadGuard
+	started time.Time
+	read    int64
+	timer   *time.Timer
+	stalled int32
+}
+
+func (b *guardedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+
+	if atomic.LoadInt32(&b.stalled) != 0 {
+		return n, errUploadStalled
+	}
+	if n > 0 && b.timer != nil {
+		b.timer.Reset(b.guard.stall)
+	}
+
+	if err == nil && b.guard.minRate > 0 {
+		elapsed := time.Since(b.started)
+		if elapsed > b.guard.gracePeriod && float64(b.read) < float64(b.guard.minRate)*elapsed.Seconds() {
+			return n, errUploadTooSlow
+		}
+	}
+
+	return n, err
+}
+
+// abortSlowUpload cancels an upload aborted by the upload guard, releasing
+// its storage, including any multipart upload of the storage driver.
+func (buh *blobUploadHandler) abortSlowUpload(err error) {
+	dcontext.GetLogger(buh).Warnf("aborting upload %s: %v", buh.UUID, err)
+	if err := buh.Upload.Cancel(buh); err != nil {
+		dcontext.GetLogger(buh).Errorf("error canceling upload after abort: %v", err)
+	}
+	buh.Errors = append(buh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail(err.Error()))
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+func TestSlowUploadsAborted(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Timeouts.Upload = configuration.UploadTimeouts{
+		Stall:       300 * time.Millisecond,
+		MinRate:     1 << 20,
+		GracePeriod: 100 * time.Millisecond,
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	// Serve the app with connections in the request context, as the
+	// registry does.
+	server := httptest.NewUnstartedServer(env.app)
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	defer server.Close()
+	env.server = server
+	builder, err := v2.NewURLBuilderFromString(server.URL, false)
+	if err != nil {
+		t.Fatalf("error creating url builder: %v", err)
+	}
+	env.builder = builder
+
+	name, _ := reference.WithName("foo/slow")
+	repo, err := env.app.registry.Repository(env.ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	checkCancelled := func(msg, uuid string) {
+		if _, err := repo.Blobs(env.ctx).Resume(env.ctx, uuid); err != distribution.ErrBlobUploadUnknown {
+			t.Fatalf("%s: expected the upload to be cancelled, got %v", msg, err)
+		}
+	}
+
+	// A client stalling mid-body gets its connection closed
+	location, uuid := startPushLayer(t, env, name)
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("error parsing location: %v", err)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "PATCH %s HTTP/1.1\r\nHost: %s\r\nContent-Length: 100\r\n\r\n0123456789", u.RequestURI(), u.Host)
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+		t.Fatalf("expected the connection of a stalled upload to be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatalf("stalled upload was not aborted")
+	}
+	checkCancelled("stalled upload", uuid)
+
+	// A client trickling data is rejected once the grace period is over
+	location, uuid = startPushLayer(t, env, name)
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		for i := 0; i < 100; i++ {
+			if _, err := pw.Write([]byte{'a'}); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		pw.Close()
+	}()
+	req, _ := http.NewRequest("PATCH", location, pr)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error patching upload: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "trickling upload", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "trickling upload", resp, v2.ErrorCodeBlobUploadInvalid)
+	checkCancelled("trickling upload", uuid)
+}
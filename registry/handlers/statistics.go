@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/pullstats"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// statisticsDispatcher constructs the pull statistics handler api endpoint.
+func statisticsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	statisticsHandler := &statisticsHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(statisticsHandler.GetStatistics),
+	}
+}
+
+// statisticsHandler handles requests for the pull statistics of a repository.
+type statisticsHandler struct {
+	*Context
+}
+
+type statisticsAPIResponse struct {
+	Name       string                      `json:"name"`
+	Pulls      int64                       `json:"pulls"`
+	LastPulled *time.Time                  `json:"lastPulled,omitempty"`
+	Tags       map[string]pullstats.Record `json:"tags"`
+}
+
+// GetStatistics returns the pull statistics of a repository as json.
+func (sh *statisticsHandler) GetStatistics(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if sh.App.pullStats == nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnsupported.WithDetail("pull statistics are not enabled"))
+		return
+	}
+
+	name := sh.Repository.Named().Name()
+	stats, ok := sh.App.pullStats.Repository(name)
+	if !ok {
+		// Repositories which were never pulled have empty statistics, as
+		// long as they exist.
+		if _, err := sh.Repository.Tags(sh).All(sh); err != nil {
+			switch err := err.(type) {
+			case distribution.ErrRepositoryUnknown:
+				sh.Errors = append(sh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": name}))
+			case errcode.Error:
+				sh.Errors = append(sh.Errors, err)
+			default:
+				sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+	}
+
+	response := statisticsAPIResponse{
+		Name:  name,
+		Pulls: stats.Pulls,
+		Tags:  stats.Tags,
+	}
+	if !stats.LastPulled.IsZero() {
+		response.LastPulled = &stats.LastPulled
+	}
+	if response.Tags == nil {
+		response.Tags = make(map[string]pullstats.Record)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// setPullCount reports on a response serving the content of dgst the number
+// of pulls recorded for it, if pull statistics are enabled.
+func (app *App) setPullCount(w http.ResponseWriter, dgst digest.Digest) {
+	if app.pullStats == nil {
+		return
+	}
+	_, pulls, _ := app.pullStats.BlobAccess(app, dgst)
+	w.Header().Set(pullstats.CountHeader, strconv.FormatInt(pulls, 10))
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// storageStatsPath is where the debug server exposes the statistics of the
+// storage drivers.
+const storageStatsPath = "/debug/storage"
+
+var (
+	storageStatsMu     sync.Mutex
+	storageStacks      [][]storagedriver.StorageDriver
+	storageStatsRoutes sync.Once
+)
+
+// registerStorageStats reports the statistics of a storage driver and the
+// middlewares wrapping it, given from the innermost, on the debug server.
+func registerStorageStats(layers []storagedriver.StorageDriver) {
+	storageStatsMu.Lock()
+	storageStacks = append(storageStacks, layers)
+	storageStatsMu.Unlock()
+	storageStatsRoutes.Do(func() {
+		http.HandleFunc(storageStatsPath, serveStorageStats)
+	})
+}
+
+// serveStorageStats writes the statistics of every storage driver as JSON,
+// merging the sections reported by the driver and its middlewares, along
+// with the hit rate of the blob descriptor cache.
+func serveStorageStats(w http.ResponseWriter, r *http.Request) {
+	storageStatsMu.Lock()
+	drivers := make([]map[string]interface{}, 0, len(storageStacks))
+	for _, layers := range storageStacks {
+		stats := map[string]interface{}{"driver": layers[0].Name()}
+		for _, layer := range layers {
+			if reporter, ok := layer.(storagedriver.StatsReporter); ok {
+				for section, value := range reporter.Stats() {
+					stats[section] = value
+				}
+			}
+		}
+		drivers = append(drivers, stats)
+	}
+	storageStatsMu.Unlock()
+
+	metrics := storage.BlobDescriptorCacheMetrics()
+	var hitRate float64
+	if metrics.Requests > 0 {
+		hitRate = float64(metrics.Hits) / float64(metrics.Requests)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]interface{}{
+		"drivers": drivers,
+		"cache": map[string]interface{}{
+			"blobdescriptor": map[string]interface{}{
+				"requests": metrics.Requests,
+				"hits":     metrics.Hits,
+				"misses":   metrics.Misses,
+				"hitrate":  hitRate,
+			},
+		},
+	})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/circuitbreaker"
+)
+
+func TestStorageStats(t *testing.T) {
+	driver, err := applyStorageMiddleware(inmemory.New(), []configuration.Middleware{
+		{Name: "circuitbreaker", Options: configuration.Parameters{"threshold": 3}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error applying middleware: %v", err)
+	}
+	ctx := context.Background()
+	if err := driver.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Stat(ctx, "/missing"); err == nil {
+		t.Fatal("expected a missing path")
+	}
+
+	w := httptest.NewRecorder()
+	serveStorageStats(w, httptest.NewRequest("GET", storageStatsPath, nil))
+	var stats struct {
+		Drivers []struct {
+			Driver     string `json:"driver"`
+			Operations map[string]struct {
+				InFlight int64 `json:"inflight"`
+				Total    int64 `json:"total"`
+			} `json:"operations"`
+			CircuitBreaker struct {
+				Open      bool `json:"open"`
+				Threshold int  `json:"threshold"`
+			} `json:"circuitbreaker"`
+		} `json:"drivers"`
+		Cache map[string]map[string]float64 `json:"cache"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("unexpected error decoding statistics: %v", err)
+	}
+	if len(stats.Drivers) == 0 {
+		t.Fatal("expected the statistics of the driver")
+	}
+
+	// the driver is the last registered
+	d := stats.Drivers[len(stats.Drivers)-1]
+	if d.Driver != "inmemory" {
+		t.Fatalf("unexpected driver %q", d.Driver)
+	}
+	if op := d.Operations["PutContent"]; op.Total != 1 || op.InFlight != 0 {
+		t.Fatalf("unexpected PutContent counts: %+v", op)
+	}
+	if op := d.Operations["Stat"]; op.Total != 1 {
+		t.Fatalf("unexpected Stat counts: %+v", op)
+	}
+	if d.CircuitBreaker.Open || d.CircuitBreaker.Threshold != 3 {
+		t.Fatalf("unexpected circuit breaker state: %+v", d.CircuitBreaker)
+	}
+	if _, ok := stats.Cache["blobdescriptor"]["hitrate"]; !ok {
+		t.Fatalf("expected the hit rate of the blob descriptor cache, got %v", stats.Cache)
+	}
+}
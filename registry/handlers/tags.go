@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/registry/api/errcode"
@@ -31,26 +34,68 @@ type tagsAPIResponse struct {
 	Tags []string `json:"tags"`
 }
 
-// GetTags returns a json list of tags for a specific image name.
+// GetTags returns a json list of tags for a specific image name. The list is
+// paginated with the n and last parameters, and ordered according to the
+// order parameter.
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
+	q := r.URL.Query()
+	lastEntry := q.Get("last")
+
+	var order distribution.TagOrder
+	switch q.Get("order") {
+	case "", "lexical":
+		order = distribution.TagOrderLexical
+	case "created":
+		order = distribution.TagOrderCreated
+	default:
+		th.Errors = append(th.Errors, v2.ErrorCodeTagOrderInvalid.WithDetail(q.Get("order")))
+		return
+	}
+
+	maxEntries := -1
+	if n := q.Get("n"); n != "" {
+		var err error
+		maxEntries, err = strconv.Atoi(n)
+		if err != nil || maxEntries < 0 {
+			th.Errors = append(th.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(n))
+			return
+		}
+	}
+
 	tagService := th.Repository.Tags(th)
-	tags, err := tagService.All(th)
+	tags, moreEntries, err := th.listTags(tagService, maxEntries, lastEntry, order)
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
 			th.Errors = append(th.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": th.Repository.Named().Name()}))
+		case distribution.ErrTagUnknown:
+			th.Errors = append(th.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
 		case errcode.Error:
 			th.Errors = append(th.Errors, err)
 		default:
-			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			if err == distribution.ErrUnsupported {
+				th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported)
+			} else {
+				th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
 		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
+	// Add a link header if there are more entries to retrieve
+	if moreEntries {
+		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, tags[len(tags)-1])
+		if err != nil {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		w.Header().Set("Link", urlStr)
+	}
+
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(tagsAPIResponse{
 		Name: th.Repository.Named().Name(),
@@ -60,3 +105,56 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// listTags returns up to maxEntries tags following last, or all of them if
+// maxEntries is negative, and whether more tags follow. Tag services that
+// cannot page tags are listed in full and paged here, in lexical order only.
+func (th *tagsHandler) listTags(tagService distribution.TagService, maxEntries int, last string, order distribution.TagOrder) ([]string, bool, error) {
+	if maxEntries < 0 && last == "" && order == distribution.TagOrderLexical {
+		tags, err := tagService.All(th)
+		return tags, false, err
+	}
+
+	if pager, ok := tagService.(distribution.TagPager); ok {
+		size := maxEntries
+		if size < 0 {
+			// Size the page from the full listing to return all tags
+			all, err := tagService.All(th)
+			if err != nil {
+				return nil, false, err
+			}
+			size = len(all)
+		}
+
+		tags := make([]string, size)
+		filled, err := pager.Page(th, tags, last, order)
+		switch err {
+		case nil:
+			return tags[:filled], filled > 0 && maxEntries >= 0, nil
+		case io.EOF:
+			return tags[:filled], false, nil
+		case distribution.ErrUnsupported:
+		default:
+			return nil, false, err
+		}
+	}
+
+	if order != distribution.TagOrderLexical {
+		return nil, false, distribution.ErrUnsupported
+	}
+
+	all, err := tagService.All(th)
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Strings(all)
+
+	tags := all[sort.SearchStrings(all, last):]
+	if len(tags) > 0 && tags[0] == last {
+		tags = tags[1:]
+	}
+	if maxEntries >= 0 && len(tags) > maxEntries {
+		return tags[:maxEntries], maxEntries > 0, nil
+	}
+	return tags, false, nil
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/version"
+)
+
+// tenant holds the resources serving the repositories of a tenant. Sections
+// the tenant does not override are shared with the app.
+type tenant struct {
+	name string
+
+	// ownStorage is true if the tenant has its own storage driver, rather
+	// than sharing the storage of the app.
+	ownStorage bool
+
+	driver           storagedriver.StorageDriver
+	registry         distribution.Namespace
+	repoRemover      distribution.RepositoryRemover
+	accessController auth.AccessController
+	uploadLimiter    *transferLimiter
+	downloadLimiter  *transferLimiter
+}
+
+// configureTenants sets up the tenants of the configuration. options are
+// those of the registry of the app, and are applied to the registries of
+// tenants with their own storage.
+func (app *App) configureTenants(config *configuration.Configuration, options []storage.RegistryOption) {
+	if len(config.Tenants) == 0 {
+		return
+	}
+	if app.isCache {
+		panic("tenants: not supported on a pull through cache")
+	}
+
+	seen := make(map[string]bool)
+	for _, tc := range config.Tenants {
+		if _, err := app.nameValidator.WithName(tc.Name); err != nil {
+			panic(fmt.Sprintf("tenants: invalid tenant name %q: %v", tc.Name, err))
+		}
+		if seen[tc.Name] {
+			panic(fmt.Sprintf("tenants: tenant %q is defined more than once", tc.Name))
+		}
+		seen[tc.Name] = true
+
+		t := app.defaultTenant()
+		t.name = tc.Name
+
+		if storageType := tc.Storage.Type(); storageType != "" {
+			storageParams := tc.Storage.Parameters()
+			if storageParams == nil {
+				storageParams = make(configuration.Parameters)
+			}
+			storageParams["useragent"] = fmt.Sprintf("docker-distribution/%s %s", version.Version, runtime.Version())
+
+			driver, err := factory.Create(storageType, storageParams)
+			if err != nil {
+				panic(fmt.Sprintf("tenants: tenant %q: %v", tc.Name, err))
+			}
+			startUploadPurger(app, driver, dcontext.GetLogger(app, "tenant"), uploadPurgeConfig(tc.Storage), app.elector)
+
+			driver, err = applyStorageMiddleware(driver, config.Middleware["storage"])
+			if err != nil {
+				panic(fmt.Sprintf("tenants: tenant %q: %v", tc.Name, err))
+			}
+
+			if !config.ReferenceIndex.Enabled && !app.readOnly {
+				if err := storage.InvalidateReferenceIndex(app, driver); err != nil {
+					dcontext.GetLogger(app).Errorf("tenants: tenant %q: error invalidating the reference index: %v", tc.Name, err)
+				}
+			}
+
+			registry, err := storage.NewRegistry(app, driver, options...)
+			if err != nil {
+				panic(fmt.Sprintf("tenants: tenant %q: could not create registry: %v", tc.Name, err))
+			}
+			if config.IntentLog.Enabled {
+				startIntentRecovery(app, registry, config.IntentLog.Grace, app.elector)
+			}
+			t.registry, err = applyRegistryMiddleware(app, registry, config.Middleware["registry"])
+			if err != nil {
+				panic(fmt.Sprintf("tenants: tenant %q: %v", tc.Name, err))
+			}
+			t.repoRemover, _ = t.registry.(distribution.RepositoryRemover)
+			t.driver = driver
+			t.ownStorage = true
+
+			if config.Placement.Tiering.Enabled || len(config.Placement.Rules) > 0 {
+				var stats storage.BlobAccessStats
+				if app.pullStats != nil {
+					stats = app.pullStats
+				}
+				startBlobTiering(app, driver, t.registry, stats, config.Placement, app.elector)
+			}
+		}
+
+		if authType := tc.Auth.Type(); strings.EqualFold(authType, "none") {
+			t.accessController = nil
+		} else if authType != "" {
+			accessController, err := auth.GetAccessController(authType, tc.Auth.Parameters())
+			if err != nil {
+				panic(fmt.Sprintf("tenants: tenant %q: unable to configure authorization (%s): %v", tc.Name, authType, err))
+			}
+			t.accessController = accessController
+		}
+
+		if limiter := newTransferLimiter(tc.Concurrency.Uploads); limiter != nil {
+			t.uploadLimiter = limiter
+		}
+		if limiter := newTransferLimiter(tc.Concurrency.Downloads); limiter != nil {
+			t.downloadLimiter = limiter
+		}
+
+		app.tenants = append(app.tenants, t)
+		dcontext.GetLogger(app).Infof("configured tenant %s", tc.Name)
+	}
+
+	sort.SliceStable(app.tenants, func(i, j int) bool {
+		return len(app.tenants[i].name) > len(app.tenants[j].name)
+	})
+}
+
+// defaultTenant returns the resources of the app, serving repositories which
+// do not belong to any tenant.
+func (app *App) defaultTenant() *tenant {
+	return &tenant{
+		driver:           app.driver,
+		registry:         app.registry,
+		repoRemover:      app.repoRemover,
+		accessController: app.accessController,
+		uploadLimiter:    app.uploadLimiter,
+		downloadLimiter:  app.downloadLimiter,
+	}
+}
+
+// tenantFor returns the tenant of the named repository or namespace, or the
+// default tenant if it does not belong to any.
+func (app *App) tenantFor(name string) *tenant {
+	if name != "" {
+		for _, t := range app.tenants {
+			if name == t.name || strings.HasPrefix(name, t.name+"/") {
+				return t
+			}
+		}
+	}
+	return app.defaultTenant()
+}
+
+// storageTenants returns the tenants serving the storages of the app: the
+// default tenant, for the storage of the app, and the tenants with their own.
+func (app *App) storageTenants() []*tenant {
+	tenants := []*tenant{app.defaultTenant()}
+	for _, t := range app.tenants {
+		if t.ownStorage {
+			tenants = append(tenants, t)
+		}
+	}
+	return tenants
+}
+
+// serves reports whether the tenant serves the named repository from its
+// storage, rather than another tenant with its own.
+func (app *App) serves(t *tenant, name string) bool {
+	owner := app.tenantFor(name)
+	return owner.ownStorage == t.ownStorage && (!t.ownStorage || owner.name == t.name)
+}
+
+// RetentionRules returns the retention of the registry and of its tenants,
+// applied by garbage collection.
+func RetentionRules(config *configuration.Configuration) []storage.RetentionRule {
+	rules := []storage.RetentionRule{{UntaggedOlderThan: config.Retention.UntaggedOlderThan}}
+	for _, tc := range config.Tenants {
+		if tc.Retention.UntaggedOlderThan > 0 {
+			rules = append(rules, storage.RetentionRule{Namespace: tc.Name, UntaggedOlderThan: tc.Retention.UntaggedOlderThan})
+		}
+	}
+	return rules
+}
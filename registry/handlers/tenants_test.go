@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+func TestTenants(t *testing.T) {
+	storageConfig := func() configuration.Storage {
+		return configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		}
+	}
+
+	config := configuration.Configuration{
+		Storage: storageConfig(),
+		Tenants: []configuration.Tenant{
+			{
+				Name:    "acme",
+				Storage: storageConfig(),
+				Auth: configuration.Auth{
+					"silly": {
+						"realm":   "acme-realm",
+						"service": "acme-service",
+					},
+				},
+			},
+			{
+				Name: "acme/open",
+				Auth: configuration.Auth{"none": {}},
+				Concurrency: configuration.Concurrency{
+					Downloads: configuration.ConcurrencyLimit{MaxConcurrent: 1},
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	acme := env.app.tenantFor("acme/app")
+	if acme.name != "acme" || !acme.ownStorage || acme.registry == env.app.registry {
+		t.Fatalf("unexpected tenant for acme/app: %+v", acme)
+	}
+	if tenant := env.app.tenantFor("acme"); tenant != acme {
+		t.Fatalf("expected the tenant namespace to belong to the tenant, got %+v", tenant)
+	}
+	open := env.app.tenantFor("acme/open/app")
+	if open.name != "acme/open" || open.ownStorage || open.accessController != nil || open.downloadLimiter == nil {
+		t.Fatalf("unexpected tenant for acme/open/app: %+v", open)
+	}
+	if open.uploadLimiter != env.app.uploadLimiter {
+		t.Fatalf("expected unset limits to be inherited")
+	}
+	if tenant := env.app.tenantFor("acmeco/app"); tenant.name != "" || tenant.registry != env.app.registry {
+		t.Fatalf("unexpected tenant for acmeco/app: %+v", tenant)
+	}
+
+	// Requests for the tenant are authenticated against its realm
+	name, _ := reference.WithName("acme/app")
+	tagsURL, err := env.builder.BuildTagsURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	resp, err := http.Get(tagsURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching tags: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching tenant tags anonymously", resp, http.StatusUnauthorized)
+	checkBodyHasErrorCodes(t, "fetching tenant tags anonymously", resp, errcode.ErrorCodeUnauthorized)
+	if header := resp.Header.Get("WWW-Authenticate"); header != `Bearer realm="acme-realm",service="acme-service",scope="repository:acme/app:pull"` {
+		t.Fatalf("unexpected WWW-Authenticate header: %q", header)
+	}
+
+	// Uploads are kept in the storage of their tenant
+	other, _ := reference.WithName("other/app")
+	_, otherUUID := startPushLayer(t, env, other)
+
+	uploadURL, err := env.builder.BuildBlobUploadURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building url: %v", err)
+	}
+	req, _ := http.NewRequest("POST", uploadURL, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "starting tenant upload", resp, http.StatusAccepted)
+	acmeUUID := resp.Header.Get("Docker-Upload-UUID")
+
+	for _, tc := range []struct {
+		tenant *tenant
+		repo   reference.Named
+		uuid   string
+		found  bool
+	}{
+		{acme, name, acmeUUID, true},
+		{env.app.defaultTenant(), name, acmeUUID, false},
+		{env.app.defaultTenant(), other, otherUUID, true},
+		{acme, other, otherUUID, false},
+	} {
+		repo, err := tc.tenant.registry.Repository(env.ctx, tc.repo)
+		if err != nil {
+			t.Fatalf("unexpected error getting repository: %v", err)
+		}
+		_, err = repo.Blobs(env.ctx).Resume(env.ctx, tc.uuid)
+		if found := err == nil; found != tc.found {
+			t.Errorf("upload %s of %s in storage of tenant %q: expected found %v, got %v", tc.uuid, tc.repo, tc.tenant.name, tc.found, err)
+		}
+	}
+
+	// The catalog lists the repositories of each storage served by it, in
+	// order, and not those shadowed by a tenant with its own storage
+	for _, tc := range []struct {
+		tenant *tenant
+		name   string
+	}{
+		{acme, "acme/app"},
+		{env.app.defaultTenant(), "acme/stale"},
+		{env.app.defaultTenant(), "acme/open/app"},
+		{env.app.defaultTenant(), "other/app"},
+	} {
+		named, _ := reference.WithName(tc.name)
+		repo, err := tc.tenant.registry.Repository(env.ctx, named)
+		if err != nil {
+			t.Fatalf("unexpected error getting repository: %v", err)
+		}
+		if _, err := repo.Blobs(env.ctx).Put(env.ctx, "application/octet-stream", []byte(tc.name)); err != nil {
+			t.Fatalf("unexpected error putting blob: %v", err)
+		}
+	}
+	var catalog []string
+	for last, pages := "", 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("too many catalog pages: %v", catalog)
+		}
+		catalogURL, err := env.builder.BuildCatalogURL(url.Values{"n": []string{"2"}, "last": []string{last}})
+		if err != nil {
+			t.Fatalf("unexpected error building url: %v", err)
+		}
+		resp, err := http.Get(catalogURL)
+		if err != nil {
+			t.Fatalf("unexpected error listing catalog: %v", err)
+		}
+		var body catalogAPIResponse
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("unexpected error decoding catalog: %v", err)
+		}
+		catalog = append(catalog, body.Repositories...)
+		if resp.Header.Get("Link") == "" {
+			break
+		}
+		last = body.Repositories[len(body.Repositories)-1]
+	}
+	if expected := []string{"acme/app", "acme/open/app", "other/app"}; !reflect.DeepEqual(catalog, expected) {
+		t.Fatalf("expected catalog %v, got %v", expected, catalog)
+	}
+}
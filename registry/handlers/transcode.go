@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/transcode"
+	"github.com/opencontainers/go-digest"
+)
+
+// transcodedVariant returns the variant of the image manifest, pulled by
+// tag, with its layers in the compression requested by the client, if it was
+// published. Otherwise the variant is scheduled to be built, and the image is
+// served as stored. Pulls by digest are always served the manifest asked for,
+// but also schedule the variant, which clients find among the referrers of
+// the image.
+func (imh *manifestHandler) transcodedVariant(r *http.Request, manifest distribution.Manifest) (distribution.Manifest, digest.Digest, bool) {
+	format := transcode.Requested(r)
+	if format == "" {
+		return nil, "", false
+	}
+	switch m := manifest.(type) {
+	case *schema2.DeserializedManifest:
+	case *ocischema.DeserializedManifest:
+		if m.Subject != nil {
+			return nil, "", false
+		}
+	default:
+		return nil, "", false
+	}
+
+	// variants are written to the storage repository rather than through
+	// the event bridge, they are not pushes
+	repository, err := imh.tenant.registry.Repository(imh, imh.Repository.Named())
+	if err != nil {
+		dcontext.GetLogger(imh).Errorf("error resolving repository for transcoding: %v", err)
+		return nil, "", false
+	}
+
+	variant, ok, err := transcode.Variant(imh, repository, imh.Digest, format)
+	if err != nil {
+		dcontext.GetLogger(imh).Errorf("error looking up the %s variant of %s: %v", format, imh.Digest, err)
+		return nil, "", false
+	}
+	if !ok {
+		if !imh.readOnly {
+			imh.App.transcoder.Schedule(repository, imh.Digest, format)
+		}
+		return nil, "", false
+	}
+	if imh.Tag == "" {
+		return nil, "", false
+	}
+
+	manifests, err := repository.Manifests(imh)
+	if err != nil {
+		dcontext.GetLogger(imh).Errorf("error reading the %s variant of %s: %v", format, imh.Digest, err)
+		return nil, "", false
+	}
+	transcoded, err := manifests.Get(imh, variant.Digest)
+	if err != nil {
+		dcontext.GetLogger(imh).Errorf("error reading the %s variant of %s: %v", format, imh.Digest, err)
+		return nil, "", false
+	}
+	return transcoded, variant.Digest, true
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/transcode"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestTranscoding(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.Transcoding.Enabled = true
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	content := bytes.Repeat([]byte("layer content "), 100)
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write(content)
+	gw.Close()
+	image := putImage(t, env, "foo/transcoded", compressed.String())
+	named, _ := reference.WithName("foo/transcoded")
+	tagged, _ := reference.WithTag(named, "latest")
+	repository, err := env.app.registry.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Tags(env.ctx).Tag(env.ctx, "latest", distribution.Descriptor{Digest: image.Digest()}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(ref reference.Reference, accept string) (*http.Response, []byte) {
+		manifestURL, err := env.builder.BuildManifestURL(ref.(reference.Named))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", manifestURL, nil)
+		req.Header.Set("Accept", schema2.MediaTypeManifest+", "+v1.MediaTypeImageManifest+", "+accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error fetching manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "fetching manifest", resp, http.StatusOK)
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	// the image is served as stored until its variant is published
+	resp, _ := get(tagged, transcode.MediaTypeLayerZstd)
+	checkHeaders(t, resp, http.Header{"Docker-Content-Digest": []string{image.Digest().String()}})
+
+	var variant *http.Response
+	var body []byte
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		variant, body = get(tagged, transcode.MediaTypeLayerZstd)
+		if variant.Header.Get("Docker-Content-Digest") != image.Digest().String() {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected the variant to be served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkHeaders(t, variant, http.Header{
+		"Content-Type":          []string{v1.MediaTypeImageManifest},
+		"Docker-Content-Digest": []string{digest.FromBytes(body).String()},
+	})
+	var m ocischema.Manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject == nil || m.Subject.Digest != image.Digest() || len(m.Layers) != 1 || m.Layers[0].MediaType != transcode.MediaTypeLayerZstd {
+		t.Fatalf("unexpected variant %s", body)
+	}
+
+	// the image is served as stored when pulled by digest, or by clients
+	// not asking for zstd, and its layer is always served as stored
+	for _, tc := range []struct {
+		ref    reference.Reference
+		accept string
+	}{
+		{image, transcode.MediaTypeLayerZstd},
+		{tagged, ""},
+		{tagged, v1.MediaTypeImageLayerGzip},
+	} {
+		resp, _ := get(tc.ref, tc.accept)
+		checkHeaders(t, resp, http.Header{"Docker-Content-Digest": []string{image.Digest().String()}})
+	}
+	layer := digest.FromBytes(compressed.Bytes())
+	ref, _ := reference.WithDigest(named, layer)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", blobURL, nil)
+	req.Header.Set("Accept", transcode.MediaTypeLayerZstd)
+	blob, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Body.Close()
+	checkResponse(t, "pulling layer", blob, http.StatusOK)
+	if stored, _ := ioutil.ReadAll(blob.Body); !bytes.Equal(stored, compressed.Bytes()) {
+		t.Fatal("expected the layer as stored")
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/uploadquota"
+)
+
+// configureUploadQuota sets up the daily upload quotas of subjects, if
+// enabled. It must be called after configureRedis.
+func (app *App) configureUploadQuota(config *configuration.Configuration) {
+	if !config.UploadQuota.Enabled {
+		return
+	}
+
+	counter, err := uploadquota.NewCounter(config.UploadQuota.Backend, app.driver, app.redis)
+	if err != nil {
+		panic(fmt.Sprintf("upload quota: %v", err))
+	}
+	app.uploadQuota = uploadquota.New(counter, uploadquota.Config{
+		Daily:    config.UploadQuota.Daily,
+		Subjects: config.UploadQuota.Subjects,
+	})
+}
+
+// limitUploadQuota rejects the uploads of subjects which used their quota of
+// the day, or whose upload would exceed it, and counts the bytes uploaded by
+// the others. Uploads are allowed when the counters cannot be read.
+func limitUploadQuota(ctx *Context, handler http.Handler) http.Handler {
+	if ctx.uploadQuota == nil {
+		return handler
+	}
+	subject := dcontext.GetStringValue(ctx, auth.UserNameKey)
+	if subject == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		length := r.ContentLength
+		if length < 0 {
+			length = 0
+		}
+		allowed, used, limit, err := ctx.uploadQuota.Allow(ctx, subject, length)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error reading upload quota of %q: %v", subject, err)
+		} else if !allowed {
+			dcontext.GetLogger(ctx).Warnf("rejecting %s request: %q uploaded %d of %d bytes today", r.Method, subject, used, limit)
+			retryAfter := time.Until(ctx.uploadQuota.Reset())
+			w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeTooManyRequests.WithDetail(map[string]int64{
+				"used":  used,
+				"limit": limit,
+			}))
+			return
+		}
+
+		body := &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+		defer func() {
+			if err := ctx.uploadQuota.Record(ctx, subject, body.n); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error recording upload of %q: %v", subject, err)
+			}
+		}()
+
+		handler.ServeHTTP(w, r)
+	})
+}
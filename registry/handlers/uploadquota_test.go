@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestUploadQuota(t *testing.T) {
+	content := bytes.Repeat([]byte("layer"), 1024)
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"silly": {
+				"realm":   "realm-test",
+				"service": "service-test",
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.UploadQuota.Enabled = true
+	config.UploadQuota.Daily = int64(len(content)) + 1
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/bar")
+	do := func(msg, method, u string, body io.Reader, status int) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, u, body)
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		if status == http.StatusTooManyRequests {
+			checkBodyHasErrorCodes(t, msg, resp, errcode.ErrorCodeTooManyRequests)
+		} else {
+			io.Copy(ioutil.Discard, resp.Body)
+		}
+		checkResponse(t, msg, resp, status)
+		return resp
+	}
+	push := func(msg string, content []byte, status int) {
+		t.Helper()
+		uploadURL, err := env.builder.BuildBlobUploadURL(name)
+		if err != nil {
+			t.Fatalf("unexpected error building upload url: %v", err)
+		}
+		resp := do(msg, "POST", uploadURL, nil, http.StatusAccepted)
+		u, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("unexpected error parsing upload location: %v", err)
+		}
+		values := u.Query()
+		values.Set("digest", digest.FromBytes(content).String())
+		u.RawQuery = values.Encode()
+		resp = do(msg, "PUT", u.String(), bytes.NewReader(content), status)
+		if status == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+			t.Fatalf("%s: expected a Retry-After header", msg)
+		}
+	}
+
+	push("pushing within quota", content, http.StatusCreated)
+	// the content length of the upload exceeds what is left of the quota
+	push("pushing beyond quota", []byte("two"), http.StatusTooManyRequests)
+	push("pushing the rest of the quota", []byte("a"), http.StatusCreated)
+
+	uploadURL, err := env.builder.BuildBlobUploadURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building upload url: %v", err)
+	}
+	do("starting upload with quota used", "POST", uploadURL, nil, http.StatusTooManyRequests)
+}
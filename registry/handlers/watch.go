@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// maxWatchEvents bounds the number of changes kept for watchers.
+	maxWatchEvents = 1000
+
+	defaultWatchWait = 30 * time.Second
+	maxWatchWait     = 50 * time.Second
+)
+
+// watchEvent is a change to the repositories and tags of the registry, as
+// returned to watchers.
+type watchEvent struct {
+	ID         int64         `json:"id"`
+	Time       time.Time     `json:"time"`
+	Action     string        `json:"action"`
+	Repository string        `json:"repository"`
+	Tag        string        `json:"tag,omitempty"`
+	Digest     digest.Digest `json:"digest,omitempty"`
+	MediaType  string        `json:"mediaType,omitempty"`
+}
+
+// changeFeed is a notifications.Sink keeping the most recent changes to
+// repositories and tags in memory, and waking up the requests waiting for
+// them. The feed is local to the instance: it neither sees the changes served
+// by other instances nor understands their cursors.
+type changeFeed struct {
+	mu      sync.Mutex
+	events  []watchEvent
+	last    int64
+	changed chan struct{}
+}
+
+func newChangeFeed() *changeFeed {
+	// ids start from the time of creation, so that the cursors issued
+	// before a restart are recognized.
+	return &changeFeed{last: time.Now().UnixNano(), changed: make(chan struct{})}
+}
+
+// Write records the manifest pushes and the deletions among events. Blob
+// pushes and pulls are ignored.
+func (f *changeFeed) Write(events ...notifications.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	recorded := false
+	for _, event := range events {
+		switch {
+		case event.Action == notifications.EventActionPush && isManifestEvent(event):
+		case event.Action == notifications.EventActionDelete:
+		default:
+			continue
+		}
+		f.last++
+		f.events = append(f.events, watchEvent{
+			ID:         f.last,
+			Time:       event.Timestamp,
+			Action:     event.Action,
+			Repository: event.Target.Repository,
+			Tag:        event.Target.Tag,
+			Digest:     event.Target.Digest,
+			MediaType:  event.Target.MediaType,
+		})
+		recorded = true
+	}
+	if !recorded {
+		return nil
+	}
+	if len(f.events) > maxWatchEvents {
+		f.events = append([]watchEvent(nil), f.events[len(f.events)-maxWatchEvents:]...)
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+	return nil
+}
+
+// Close does nothing, the changes are only kept in memory.
+func (f *changeFeed) Close() error {
+	return nil
+}
+
+// since returns at most n of the changes following cursor within namespace,
+// and the cursor following them. missed is true if changes following cursor
+// are no longer kept. The returned channel is closed on the next change.
+func (f *changeFeed) since(cursor int64, namespace string, n int) (events []watchEvent, next int64, missed bool, changed <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if cursor < 0 {
+		cursor = f.last
+	}
+	if oldest := f.last - int64(len(f.events)); cursor > f.last || cursor < oldest {
+		// the cursor was issued before a restart, or its changes were
+		// dropped
+		missed = true
+		cursor = oldest
+	}
+
+	next = cursor
+	for _, event := range f.events {
+		if event.ID <= cursor {
+			continue
+		}
+		if len(events) == n {
+			break
+		}
+		next = event.ID
+		if namespace == "" || event.Repository == namespace || strings.HasPrefix(event.Repository, namespace+"/") {
+			events = append(events, event)
+		}
+	}
+	return events, next, missed, f.changed
+}
+
+func isManifestEvent(event notifications.Event) bool {
+	for _, mediaType := range distribution.ManifestMediaTypes() {
+		if event.Target.MediaType == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// watchDispatcher constructs the handler waiting for changes to the
+// repositories and tags of the registry.
+func watchDispatcher(ctx *Context, r *http.Request) http.Handler {
+	watchHandler := &watchHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(watchHandler.GetChanges),
+	}
+}
+
+type watchHandler struct {
+	*Context
+}
+
+type watchAPIResponse struct {
+	Cursor int64        `json:"cursor"`
+	Missed bool         `json:"missed"`
+	Events []watchEvent `json:"events"`
+}
+
+// GetChanges returns the changes following the cursor as json, waiting for
+// them if there are none yet.
+func (wh *watchHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cursor := int64(-1)
+	if c := q.Get("cursor"); c != "" {
+		var err error
+		cursor, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || cursor < 0 {
+			wh.Errors = append(wh.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(c))
+			return
+		}
+	}
+	maxEntries := maximumReturnedEntries
+	if n := q.Get("n"); n != "" {
+		var err error
+		maxEntries, err = strconv.Atoi(n)
+		if err != nil || maxEntries <= 0 {
+			wh.Errors = append(wh.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(n))
+			return
+		}
+	}
+	wait := defaultWatchWait
+	if s := q.Get("wait"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil || seconds < 0 {
+			wh.Errors = append(wh.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(s))
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > maxWatchWait {
+			wait = maxWatchWait
+		}
+	}
+	namespace := q.Get("namespace")
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var response watchAPIResponse
+poll:
+	for {
+		events, next, missed, changed := wh.App.changes.since(cursor, namespace, maxEntries)
+		response = watchAPIResponse{Cursor: next, Missed: missed, Events: events}
+		if len(events) > 0 || missed {
+			break
+		}
+		// changes outside the namespace move the cursor forward
+		cursor = next
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			break poll
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if response.Events == nil {
+		response.Events = []watchEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		wh.Errors = append(wh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/client"
+)
+
+func TestWatch(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	ctx := context.Background()
+	reg, err := client.NewRegistry(env.server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := reg.(client.Watcher)
+
+	start, err := registry.Watch(ctx, client.WatchOptions{Wait: -1})
+	if err != nil {
+		t.Fatalf("unexpected error watching: %v", err)
+	}
+	if start.Missed || len(start.Changes) != 0 {
+		t.Fatalf("unexpected changes %+v", start)
+	}
+
+	// a waiting watcher is woken up by the push
+	watched := make(chan client.Changes)
+	go func() {
+		changes, err := registry.Watch(ctx, client.WatchOptions{Cursor: start.Cursor, Namespace: "foo", Wait: 10 * time.Second})
+		if err != nil {
+			t.Errorf("unexpected error watching: %v", err)
+		}
+		watched <- changes
+	}()
+	dgst := createRepository(env, t, "foo/watch", "latest")
+	changes := <-watched
+	if len(changes.Changes) != 1 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	change := changes.Changes[0]
+	if change.Action != "push" || change.Repository != "foo/watch" || change.Tag != "latest" || change.Digest != dgst || change.ID != changes.Cursor {
+		t.Fatalf("unexpected change %+v", change)
+	}
+
+	// changes outside of the namespace move the cursor forward
+	createRepository(env, t, "bar/watch", "latest")
+	other, err := registry.Watch(ctx, client.WatchOptions{Cursor: changes.Cursor, Namespace: "bar", Wait: 10 * time.Second})
+	if err != nil || len(other.Changes) != 1 || other.Changes[0].Repository != "bar/watch" {
+		t.Fatalf("unexpected changes %+v: %v", other, err)
+	}
+	none, err := registry.Watch(ctx, client.WatchOptions{Cursor: changes.Cursor, Namespace: "foo", Wait: -1})
+	if err != nil || len(none.Changes) != 0 || none.Cursor != other.Cursor {
+		t.Fatalf("unexpected changes %+v: %v", none, err)
+	}
+
+	// cursors of changes no longer kept, or of another run, are reported
+	for _, cursor := range []int64{1, other.Cursor + 1} {
+		missed, err := registry.Watch(ctx, client.WatchOptions{Cursor: cursor, Wait: -1})
+		if err != nil || !missed.Missed || len(missed.Changes) != 2 {
+			t.Fatalf("unexpected changes for cursor %d %+v: %v", cursor, missed, err)
+		}
+	}
+
+	watchURL, err := env.builder.BuildWatchURL(url.Values{"cursor": []string{"last"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(watchURL)
+	if err != nil {
+		t.Fatalf("unexpected error watching: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "watching with an invalid cursor", resp, http.StatusBadRequest)
+}
@@ -0,0 +1,446 @@
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+)
+
+var importRepository string
+
+func init() {
+	RootCmd.AddCommand(ImportCmd)
+	ImportCmd.Flags().StringVarP(&importRepository, "repository", "r", "", "repository to import the images into, instead of the repositories of their tags")
+}
+
+// ImportCmd is the cobra command that corresponds to the import subcommand
+var ImportCmd = &cobra.Command{
+	Use:   "import <config> <archive>...",
+	Short: "`import` stores the images of `docker save` archives",
+	Long: "`import` converts the images of archives written by `docker save`, optionally\n" +
+		"gzipped, to OCI images and stores them in the storage of the registry\n" +
+		"configured by <config>, tagged as they were in the Docker daemon.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args[:1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		k, err := libtrust.GenerateECP256PrivateKey()
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		nameValidator, err := repositoryNameValidator(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name constraints: %v", err)
+			os.Exit(1)
+		}
+
+		options := referenceIndexOptions(config, []storage.RegistryOption{storage.Schema1SigningKey(k), storage.RepositoryNameValidator(nameValidator)})
+		registry, err := storage.NewRegistry(ctx, driver, options...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+		tenants, err := tenantRegistries(ctx, config, options...)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := invalidateReferenceIndexes(ctx, config, driver, tenants); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to invalidate the reference index: %v", err)
+			os.Exit(1)
+		}
+
+		im := &importer{
+			dest:          tenantNamespace{Namespace: registry, tenants: tenants},
+			repository:    importRepository,
+			nameValidator: nameValidator,
+			out:           os.Stdout,
+		}
+
+		failed := false
+		for _, archive := range args[1:] {
+			if err := im.importArchive(ctx, archive); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to import %s: %v\n", archive, err)
+				failed = true
+			}
+		}
+		fmt.Fprintf(os.Stdout, "%d images imported, %d tags, %d blobs stored (%d bytes)\n",
+			im.stats.images, im.stats.tags, im.stats.blobs, im.stats.bytes)
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// dockerSaveImage is an entry of the manifest.json file of a `docker save`
+// archive.
+type dockerSaveImage struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// importStats counts what an importer did.
+type importStats struct {
+	images int
+	tags   int
+	blobs  int
+	bytes  int64
+}
+
+// importer stores the images of `docker save` archives.
+type importer struct {
+	dest          distribution.Namespace
+	repository    string                   // repository overriding those of the image tags
+	nameValidator *reference.NameValidator // nil for the default constraints
+	out           io.Writer                // progress output
+
+	stats importStats
+}
+
+// importTarget is a repository an image of an archive is imported into, with
+// the tags it is given there.
+type importTarget struct {
+	named reference.Named
+	tags  []string
+}
+
+// importArchive stores the images of a `docker save` archive. The archive is
+// read twice: once for its manifest, which may be written after the layers,
+// then to store the files the images reference.
+func (im *importer) importArchive(ctx context.Context, archive string) error {
+	var images []dockerSaveImage
+	links := make(map[string]string)
+	err := walkArchive(archive, func(hdr *tar.Header, r io.Reader) error {
+		switch {
+		case hdr.Typeflag == tar.TypeSymlink:
+			links[path.Clean(hdr.Name)] = path.Join(path.Dir(hdr.Name), hdr.Linkname)
+		case hdr.Typeflag == tar.TypeLink:
+			links[path.Clean(hdr.Name)] = path.Clean(hdr.Linkname)
+		case path.Clean(hdr.Name) == "manifest.json":
+			return json.NewDecoder(r).Decode(&images)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if images == nil {
+		return fmt.Errorf("no manifest.json, not an archive written by docker save")
+	}
+
+	// Each file is stored once, in the first repository referencing it, and
+	// mounted into the others.
+	targets := make([][]importTarget, len(images))
+	home := make(map[string]reference.Named)
+	for i, image := range images {
+		targets[i], err = im.targets(image)
+		if err != nil {
+			return err
+		}
+		for _, name := range append([]string{image.Config}, image.Layers...) {
+			name = resolveLink(links, name)
+			if _, ok := home[name]; !ok {
+				home[name] = targets[i][0].named
+			}
+		}
+	}
+
+	stored := make(map[string]distribution.Descriptor)
+	err = walkArchive(archive, func(hdr *tar.Header, r io.Reader) error {
+		name := path.Clean(hdr.Name)
+		named, ok := home[name]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		repo, err := im.dest.Repository(ctx, named)
+		if err != nil {
+			return err
+		}
+		desc, err := im.storeBlob(ctx, repo.Blobs(ctx), r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		stored[name] = desc
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, image := range images {
+		for _, target := range targets[i] {
+			if err := im.importImage(ctx, image, target, links, home, stored); err != nil {
+				return fmt.Errorf("%s: %v", target.named.Name(), err)
+			}
+		}
+		im.stats.images++
+	}
+	return nil
+}
+
+// targets returns the repositories an image is imported into.
+func (im *importer) targets(image dockerSaveImage) ([]importTarget, error) {
+	var targets []importTarget
+	index := make(map[string]int)
+	for _, repoTag := range image.RepoTags {
+		ref, err := reference.ParseNormalizedNamed(repoTag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag %q: %v", repoTag, err)
+		}
+		tag := "latest"
+		if tagged, ok := ref.(reference.Tagged); ok {
+			tag = tagged.Tag()
+		}
+		name := reference.Path(ref)
+		if im.repository != "" {
+			name = im.repository
+		}
+
+		i, ok := index[name]
+		if !ok {
+			named, err := im.nameValidator.WithName(name)
+			if err != nil {
+				return nil, err
+			}
+			i = len(targets)
+			index[name] = i
+			targets = append(targets, importTarget{named: named})
+		}
+		targets[i].tags = append(targets[i].tags, tag)
+	}
+
+	if len(targets) == 0 {
+		if im.repository == "" {
+			return nil, fmt.Errorf("image %s is not tagged, import it with --repository", image.Config)
+		}
+		named, err := im.nameValidator.WithName(im.repository)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, importTarget{named: named})
+	}
+	return targets, nil
+}
+
+// importImage puts the OCI manifest of an image in the target repository,
+// mounting the blobs stored in other repositories, and tags it.
+func (im *importer) importImage(ctx context.Context, image dockerSaveImage, target importTarget, links map[string]string, home map[string]reference.Named, stored map[string]distribution.Descriptor) error {
+	repo, err := im.dest.Repository(ctx, target.named)
+	if err != nil {
+		return err
+	}
+	blobs := repo.Blobs(ctx)
+
+	descriptor := func(name string) (distribution.Descriptor, error) {
+		name = resolveLink(links, name)
+		desc, ok := stored[name]
+		if !ok {
+			return distribution.Descriptor{}, fmt.Errorf("%s is missing from the archive", name)
+		}
+		if home[name].Name() != target.named.Name() {
+			if err := mountBlob(ctx, blobs, home[name], desc.Digest); err != nil {
+				return distribution.Descriptor{}, err
+			}
+		}
+		return desc, nil
+	}
+
+	config, err := descriptor(image.Config)
+	if err != nil {
+		return err
+	}
+	configJSON, err := blobs.Get(ctx, config.Digest)
+	if err != nil {
+		return err
+	}
+
+	builder := ocischema.NewManifestBuilder(blobs, configJSON, nil)
+	for _, layer := range image.Layers {
+		desc, err := descriptor(layer)
+		if err != nil {
+			return err
+		}
+		if err := builder.AppendReference(desc); err != nil {
+			return err
+		}
+	}
+	manifest, err := builder.Build(ctx)
+	if err != nil {
+		return err
+	}
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	dgst, err := manifests.Put(ctx, manifest)
+	if err != nil {
+		return err
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return err
+	}
+	desc := distribution.Descriptor{MediaType: mediaType, Digest: dgst, Size: int64(len(payload))}
+
+	if len(target.tags) == 0 {
+		im.printf("image %s@%s\n", target.named.Name(), dgst)
+	}
+	for _, tag := range target.tags {
+		if err := repo.Tags(ctx).Tag(ctx, tag, desc); err != nil {
+			return err
+		}
+		im.printf("tag %s:%s -> %s\n", target.named.Name(), tag, dgst)
+		im.stats.tags++
+	}
+	return nil
+}
+
+// storeBlob stores the content of r, described as an OCI layer. Layers are
+// stored as they are in the archive, usually uncompressed.
+func (im *importer) storeBlob(ctx context.Context, blobs distribution.BlobStore, r io.Reader) (distribution.Descriptor, error) {
+	br := bufio.NewReader(r)
+	mediaType := v1.MediaTypeImageLayer
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		mediaType = v1.MediaTypeImageLayerGzip
+	}
+
+	bw, err := blobs.Create(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(io.MultiWriter(bw, digester.Hash()), br)
+	if err != nil {
+		bw.Cancel(ctx)
+		return distribution.Descriptor{}, err
+	}
+
+	desc, err := bw.Commit(ctx, distribution.Descriptor{Digest: digester.Digest(), Size: size})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	desc.MediaType = mediaType
+	im.printf("store %s (%d bytes)\n", desc.Digest, desc.Size)
+	im.stats.blobs++
+	im.stats.bytes += desc.Size
+	return desc, nil
+}
+
+// mountBlob links a blob stored in the from repository into blobs.
+func mountBlob(ctx context.Context, blobs distribution.BlobStore, from reference.Named, dgst digest.Digest) error {
+	if _, err := blobs.Stat(ctx, dgst); err == nil {
+		return nil
+	}
+	canonical, err := reference.WithDigest(from, dgst)
+	if err != nil {
+		return err
+	}
+	bw, err := blobs.Create(ctx, storage.WithMountFrom(canonical))
+	if err == nil {
+		bw.Cancel(ctx)
+		return fmt.Errorf("unable to mount %s from %s", dgst, from.Name())
+	}
+	if _, ok := err.(distribution.ErrBlobMounted); !ok {
+		return err
+	}
+	return nil
+}
+
+// resolveLink follows the links of an archive, which `docker save` writes
+// for layers shared by several images.
+func resolveLink(links map[string]string, name string) string {
+	name = path.Clean(name)
+	for i := 0; i < len(links); i++ {
+		target, ok := links[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	return name
+}
+
+// walkArchive calls fn for each file of a tar archive, which may be gzipped.
+func walkArchive(archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (im *importer) printf(format string, args ...interface{}) {
+	if im.out == nil {
+		return
+	}
+	fmt.Fprintf(im.out, format, args...)
+}
@@ -0,0 +1,173 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// archiveFile is a file of a test archive, a symlink if link is set.
+type archiveFile struct {
+	name    string
+	content []byte
+	link    string
+}
+
+// writeArchive writes a tar archive of files, gzipped if compress is set.
+func writeArchive(t *testing.T, dir string, compress bool, files ...archiveFile) string {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if f.link != "" {
+			hdr = &tar.Header{Name: f.name, Mode: 0777, Linkname: f.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "archive.tar")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shared := []byte("shared layer")
+	own := []byte("own layer")
+	configA := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"},"tag":"a"}`)
+	configB := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"},"tag":"b"}`)
+	manifest, _ := json.Marshal([]dockerSaveImage{
+		{Config: "a.json", RepoTags: []string{"foo/a:v1", "foo/a:latest"}, Layers: []string{"1/layer.tar", "2/layer.tar"}},
+		{Config: "b.json", RepoTags: []string{"alpine:3"}, Layers: []string{"3/layer.tar"}},
+	})
+	// the manifest is written last, as docker save does
+	files := []archiveFile{
+		{name: "1/layer.tar", content: shared},
+		{name: "2/layer.tar", content: own},
+		{name: "3/layer.tar", link: "../1/layer.tar"},
+		{name: "a.json", content: configA},
+		{name: "b.json", content: configB},
+		{name: "manifest.json", content: manifest},
+	}
+
+	checkTag := func(dest distribution.Namespace, name, tag string, layers ...[]byte) {
+		t.Helper()
+		named, _ := reference.WithName(name)
+		repo, err := dest.Repository(ctx, named)
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc, err := repo.Tags(ctx).Get(ctx, tag)
+		if err != nil {
+			t.Fatalf("%s:%s: unexpected error getting tag: %v", name, tag, err)
+		}
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := manifests.Get(ctx, desc.Digest)
+		if err != nil {
+			t.Fatalf("%s:%s: unexpected error getting manifest: %v", name, tag, err)
+		}
+		oci, ok := m.(*ocischema.DeserializedManifest)
+		if !ok {
+			t.Fatalf("%s:%s: expected an OCI manifest, got %T", name, tag, m)
+		}
+		if len(oci.Layers) != len(layers) {
+			t.Fatalf("%s:%s: expected %d layers, got %d", name, tag, len(layers), len(oci.Layers))
+		}
+		for i, layer := range layers {
+			if oci.Layers[i].Digest != digest.FromBytes(layer) || oci.Layers[i].MediaType != v1.MediaTypeImageLayer {
+				t.Fatalf("%s:%s: unexpected layer %v", name, tag, oci.Layers[i])
+			}
+			if _, err := repo.Blobs(ctx).Stat(ctx, oci.Layers[i].Digest); err != nil {
+				t.Fatalf("%s:%s: layer %s not linked: %v", name, tag, oci.Layers[i].Digest, err)
+			}
+		}
+	}
+
+	for _, compress := range []bool{false, true} {
+		dest, err := storage.NewRegistry(ctx, inmemory.New())
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+		im := &importer{dest: dest}
+		if err := im.importArchive(ctx, writeArchive(t, dir, compress, files...)); err != nil {
+			t.Fatalf("unexpected error importing: %v", err)
+		}
+		if im.stats.images != 2 || im.stats.tags != 3 || im.stats.blobs != 4 {
+			t.Fatalf("unexpected stats: %+v", im.stats)
+		}
+		checkTag(dest, "foo/a", "v1", shared, own)
+		checkTag(dest, "foo/a", "latest", shared, own)
+		checkTag(dest, "library/alpine", "3", shared)
+	}
+
+	// Untagged images are imported only into the given repository
+	untagged, _ := json.Marshal([]dockerSaveImage{{Config: "a.json", Layers: []string{"2/layer.tar"}}})
+	archive := writeArchive(t, dir, false,
+		archiveFile{name: "2/layer.tar", content: own},
+		archiveFile{name: "a.json", content: configA},
+		archiveFile{name: "manifest.json", content: untagged})
+	dest, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	if err := (&importer{dest: dest}).importArchive(ctx, archive); err == nil {
+		t.Fatal("expected an untagged image to require a repository")
+	}
+	im := &importer{dest: dest, repository: "foo/untagged"}
+	if err := im.importArchive(ctx, archive); err != nil {
+		t.Fatalf("unexpected error importing: %v", err)
+	}
+	if im.stats.images != 1 || im.stats.tags != 0 {
+		t.Fatalf("unexpected stats: %+v", im.stats)
+	}
+
+	// Other archives are rejected
+	if err := im.importArchive(ctx, writeArchive(t, dir, false, archiveFile{name: "oci-layout", content: []byte("{}")})); err == nil {
+		t.Fatal("expected an archive without manifest.json to be rejected")
+	}
+}
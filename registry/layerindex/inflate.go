@@ -0,0 +1,540 @@
+package layerindex
+
+import (
+	"bufio"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// This file implements a DEFLATE (RFC 1951) decoder for gzip streams (RFC
+// 1952) which records checkpoints at block boundaries, in the manner of
+// zlib's zran example. compress/flate does not expose where its blocks
+// start, which is needed to resume decompression in the middle of a gzip
+// member.
+
+const (
+	maxBits    = 15
+	maxLCodes  = 286
+	maxDCodes  = 30
+	windowSize = 1 << 15
+
+	// flushSize is the size the decoded output of a member grows to before
+	// it is written out.
+	flushSize = 4 * windowSize
+)
+
+var (
+	errInvalidHeader  = errors.New("layerindex: invalid gzip header")
+	errInvalidData    = errors.New("layerindex: invalid deflate data")
+	errInvalidTrailer = errors.New("layerindex: invalid gzip checksum")
+)
+
+var (
+	lengthBase  = [...]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [...]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [...]int{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [...]uint{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+	// codeLengthOrder is the order in which the code lengths of the code
+	// length code are stored.
+	codeLengthOrder = [...]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+	fixedLengths, fixedDists = fixedCodes()
+)
+
+// huffman is a canonical Huffman code: the number of symbols of each length
+// and the symbols ordered by code.
+type huffman struct {
+	count  [maxBits + 1]int
+	symbol []int
+}
+
+// construct builds the code from the code lengths of its symbols. It
+// returns 0 for a complete code, a negative value for an over-subscribed
+// one and a positive value for an incomplete one.
+func (h *huffman) construct(lengths []int) int {
+	h.count = [maxBits + 1]int{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	if h.count[0] == len(lengths) {
+		// no codes, decoding any fails
+		return 0
+	}
+
+	left := 1
+	for l := 1; l <= maxBits; l++ {
+		left <<= 1
+		left -= h.count[l]
+		if left < 0 {
+			return left
+		}
+	}
+
+	var offsets [maxBits + 1]int
+	for l := 1; l < maxBits; l++ {
+		offsets[l+1] = offsets[l] + h.count[l]
+	}
+	h.symbol = make([]int, len(lengths))
+	for symbol, l := range lengths {
+		if l != 0 {
+			h.symbol[offsets[l]] = symbol
+			offsets[l]++
+		}
+	}
+	return left
+}
+
+func fixedCodes() (*huffman, *huffman) {
+	lengths := make([]int, 288)
+	for symbol := range lengths {
+		switch {
+		case symbol < 144:
+			lengths[symbol] = 8
+		case symbol < 256:
+			lengths[symbol] = 9
+		case symbol < 280:
+			lengths[symbol] = 7
+		default:
+			lengths[symbol] = 8
+		}
+	}
+	var lengthCode, distCode huffman
+	lengthCode.construct(lengths)
+
+	dists := make([]int, maxDCodes)
+	for symbol := range dists {
+		dists[symbol] = 5
+	}
+	distCode.construct(dists)
+	return &lengthCode, &distCode
+}
+
+// bitReader reads the bits of a deflate stream, least significant first,
+// and counts the bytes it consumed.
+type bitReader struct {
+	r      *bufio.Reader
+	n      int64
+	bitbuf uint32
+	bitcnt uint
+}
+
+// bits returns the next need bits of the stream.
+func (b *bitReader) bits(need uint) (int, error) {
+	val := b.bitbuf
+	for b.bitcnt < need {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		b.n++
+		val |= uint32(c) << b.bitcnt
+		b.bitcnt += 8
+	}
+	b.bitbuf = val >> need
+	b.bitcnt -= need
+	return int(val & (1<<need - 1)), nil
+}
+
+// align drops the bits left of the current byte.
+func (b *bitReader) align() {
+	b.bitbuf = 0
+	b.bitcnt = 0
+}
+
+// offset returns the position of the next bit of the stream, as the offset
+// of its byte and its index in the byte.
+func (b *bitReader) offset() (int64, uint) {
+	pos := b.n*8 - int64(b.bitcnt)
+	return pos / 8, uint(pos % 8)
+}
+
+func (b *bitReader) readByte() (byte, error) {
+	c, err := b.r.ReadByte()
+	if err == nil {
+		b.n++
+	}
+	return c, err
+}
+
+func (b *bitReader) readFull(p []byte) error {
+	n, err := io.ReadFull(b.r, p)
+	b.n += int64(n)
+	return err
+}
+
+// decode reads a symbol of the code h.
+func (b *bitReader) decode(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= maxBits; l++ {
+		bit, err := b.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= bit
+		count := h.count[l]
+		if code-count < first {
+			return h.symbol[index+code-first], nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	return 0, errInvalidData
+}
+
+// inflater decompresses the members of a gzip stream to a writer, and
+// records a checkpoint at the start of every member and at the first block
+// boundary after every spanSize bytes of output.
+type inflater struct {
+	in       *bitReader
+	w        io.Writer
+	spanSize int64
+
+	// hist holds the output of the current member not yet written, after
+	// the window of output preceding it.
+	hist    []byte
+	flushed int
+	crc     uint32
+
+	// out is the size of the output, memberOut of the output of the
+	// current member.
+	out       int64
+	memberOut int64
+
+	checkpoints []Checkpoint
+	lastOut     int64
+}
+
+func newInflater(r io.Reader, w io.Writer, spanSize int64) *inflater {
+	return &inflater{
+		in:       &bitReader{r: bufio.NewReader(r)},
+		w:        w,
+		spanSize: spanSize,
+		hist:     make([]byte, 0, flushSize+windowSize),
+	}
+}
+
+// inflate decompresses all the members of the stream.
+func (x *inflater) inflate() error {
+	for first := true; ; first = false {
+		if !first {
+			if _, err := x.in.r.Peek(1); err == io.EOF {
+				return nil
+			}
+		}
+		if err := x.header(); err != nil {
+			return err
+		}
+		x.checkpoint(nil)
+		if err := x.member(); err != nil {
+			return err
+		}
+	}
+}
+
+// header reads the header of a gzip member.
+func (x *inflater) header() error {
+	var header [10]byte
+	if err := x.in.readFull(header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errInvalidHeader
+		}
+		return err
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[2] != 8 {
+		return errInvalidHeader
+	}
+	flags := header[3]
+	if flags&0x04 != 0 {
+		var extra [2]byte
+		if err := x.in.readFull(extra[:]); err != nil {
+			return err
+		}
+		if err := x.in.readFull(make([]byte, int(extra[0])|int(extra[1])<<8)); err != nil {
+			return err
+		}
+	}
+	for _, flag := range []byte{0x08, 0x10} {
+		if flags&flag == 0 {
+			continue
+		}
+		// zero terminated file name or comment
+		for {
+			c, err := x.in.readByte()
+			if err != nil {
+				return err
+			}
+			if c == 0 {
+				break
+			}
+		}
+	}
+	if flags&0x02 != 0 {
+		var crc [2]byte
+		if err := x.in.readFull(crc[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// member decompresses the blocks of a member and checks its trailer.
+func (x *inflater) member() error {
+	x.hist = x.hist[:0]
+	x.flushed = 0
+	x.crc = 0
+	x.memberOut = 0
+
+	for {
+		if x.memberOut > 0 && x.out-x.lastOut >= x.spanSize {
+			window := x.hist
+			if len(window) > windowSize {
+				window = window[len(window)-windowSize:]
+			}
+			x.checkpoint(append([]byte(nil), window...))
+		}
+
+		last, err := x.in.bits(1)
+		if err != nil {
+			return err
+		}
+		kind, err := x.in.bits(2)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 0:
+			err = x.stored()
+		case 1:
+			err = x.codes(fixedLengths, fixedDists)
+		case 2:
+			err = x.dynamic()
+		default:
+			err = errInvalidData
+		}
+		if err != nil {
+			return err
+		}
+		if last == 1 {
+			break
+		}
+	}
+	if err := x.flush(); err != nil {
+		return err
+	}
+
+	x.in.align()
+	var trailer [8]byte
+	if err := x.in.readFull(trailer[:]); err != nil {
+		return err
+	}
+	crc := uint32(trailer[0]) | uint32(trailer[1])<<8 | uint32(trailer[2])<<16 | uint32(trailer[3])<<24
+	size := uint32(trailer[4]) | uint32(trailer[5])<<8 | uint32(trailer[6])<<16 | uint32(trailer[7])<<24
+	if crc != x.crc || size != uint32(x.memberOut) {
+		return errInvalidTrailer
+	}
+	return nil
+}
+
+// checkpoint records that decompression can resume at the current position
+// of the input, given the window of output preceding it.
+func (x *inflater) checkpoint(window []byte) {
+	offset, bits := x.in.offset()
+	x.checkpoints = append(x.checkpoints, Checkpoint{
+		CompressedOffset:   offset,
+		Bits:               bits,
+		UncompressedOffset: x.out,
+		Window:             window,
+	})
+	x.lastOut = x.out
+}
+
+// flush writes the output not yet written, and keeps the window preceding
+// the output to come.
+func (x *inflater) flush() error {
+	pending := x.hist[x.flushed:]
+	if len(pending) > 0 {
+		x.crc = crc32.Update(x.crc, crc32.IEEETable, pending)
+		if _, err := x.w.Write(pending); err != nil {
+			return err
+		}
+	}
+	if len(x.hist) > windowSize {
+		x.hist = x.hist[:copy(x.hist, x.hist[len(x.hist)-windowSize:])]
+	}
+	x.flushed = len(x.hist)
+	return nil
+}
+
+func (x *inflater) emit(b []byte) error {
+	x.hist = append(x.hist, b...)
+	x.out += int64(len(b))
+	x.memberOut += int64(len(b))
+	if len(x.hist) >= flushSize {
+		return x.flush()
+	}
+	return nil
+}
+
+// stored copies a stored block.
+func (x *inflater) stored() error {
+	x.in.align()
+	var header [4]byte
+	if err := x.in.readFull(header[:]); err != nil {
+		return err
+	}
+	length := int(header[0]) | int(header[1])<<8
+	if header[2] != ^header[0] || header[3] != ^header[1] {
+		return errInvalidData
+	}
+	buf := make([]byte, length)
+	if err := x.in.readFull(buf); err != nil {
+		return err
+	}
+	return x.emit(buf)
+}
+
+// dynamic reads the codes of a block compressed with dynamic codes, then
+// decodes it.
+func (x *inflater) dynamic() error {
+	nlen, err := x.in.bits(5)
+	if err != nil {
+		return err
+	}
+	ndist, err := x.in.bits(5)
+	if err != nil {
+		return err
+	}
+	ncode, err := x.in.bits(4)
+	if err != nil {
+		return err
+	}
+	nlen, ndist, ncode = nlen+257, ndist+1, ncode+4
+	if nlen > maxLCodes || ndist > maxDCodes {
+		return errInvalidData
+	}
+
+	lengths := make([]int, maxLCodes+maxDCodes)
+	for i := 0; i < ncode; i++ {
+		if lengths[codeLengthOrder[i]], err = x.in.bits(3); err != nil {
+			return err
+		}
+	}
+	var lengthCode, distCode huffman
+	if lengthCode.construct(lengths[:19]) != 0 {
+		return errInvalidData
+	}
+
+	for index := 0; index < nlen+ndist; {
+		symbol, err := x.in.decode(&lengthCode)
+		if err != nil {
+			return err
+		}
+		if symbol < 16 {
+			lengths[index] = symbol
+			index++
+			continue
+		}
+
+		length, repeat := 0, 0
+		switch symbol {
+		case 16:
+			if index == 0 {
+				return errInvalidData
+			}
+			length = lengths[index-1]
+			repeat, err = x.in.bits(2)
+			repeat += 3
+		case 17:
+			repeat, err = x.in.bits(3)
+			repeat += 3
+		default:
+			repeat, err = x.in.bits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if index+repeat > nlen+ndist {
+			return errInvalidData
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[index] = length
+			index++
+		}
+	}
+	if lengths[256] == 0 {
+		// no end of block code
+		return errInvalidData
+	}
+
+	// incomplete codes are only allowed for a single length
+	if left := lengthCode.construct(lengths[:nlen]); left < 0 || (left > 0 && nlen-lengthCode.count[0] != 1) {
+		return errInvalidData
+	}
+	if left := distCode.construct(lengths[nlen : nlen+ndist]); left < 0 || (left > 0 && ndist-distCode.count[0] != 1) {
+		return errInvalidData
+	}
+	return x.codes(&lengthCode, &distCode)
+}
+
+// codes decodes the literals and matches of a compressed block.
+func (x *inflater) codes(lengthCode, distCode *huffman) error {
+	var literal [1]byte
+	for {
+		symbol, err := x.in.decode(lengthCode)
+		if err != nil {
+			return err
+		}
+		if symbol < 256 {
+			literal[0] = byte(symbol)
+			if err := x.emit(literal[:]); err != nil {
+				return err
+			}
+			continue
+		}
+		if symbol == 256 {
+			return nil
+		}
+
+		symbol -= 257
+		if symbol >= len(lengthBase) {
+			return errInvalidData
+		}
+		extra, err := x.in.bits(lengthExtra[symbol])
+		if err != nil {
+			return err
+		}
+		length := lengthBase[symbol] + extra
+
+		symbol, err = x.in.decode(distCode)
+		if err != nil {
+			return err
+		}
+		if symbol >= len(distBase) {
+			return errInvalidData
+		}
+		extra, err = x.in.bits(distExtra[symbol])
+		if err != nil {
+			return err
+		}
+		dist := distBase[symbol] + extra
+		if int64(dist) > x.memberOut {
+			return errInvalidData
+		}
+
+		// byte by byte, the match may overlap the bytes it produces
+		for ; length > 0; length-- {
+			literal[0] = x.hist[len(x.hist)-dist]
+			if err := x.emit(literal[:]); err != nil {
+				return err
+			}
+		}
+	}
+}
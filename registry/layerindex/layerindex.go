@@ -0,0 +1,387 @@
+// Package layerindex generates seekable indexes of the gzip layers of pushed
+// images and stores them next to the images, as artifacts referring to the
+// image manifest through their subject, so that lazily pulling runtimes can
+// fetch the files of a layer with range requests rather than downloading it
+// whole.
+package layerindex
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// ArtifactType is the artifact type of the index artifacts.
+	ArtifactType = "application/vnd.docker.distribution.layer.index.v2+json"
+
+	// MediaTypeTOC is the media type of the index of a layer, a TOC
+	// encoded as json.
+	MediaTypeTOC = "application/vnd.docker.distribution.layer.toc.v2+json"
+
+	// LayerAnnotation is set on the TOCs of an index artifact to the
+	// digest of the layer they index.
+	LayerAnnotation = "org.docker.distribution.layer.digest"
+
+	// mediaTypeEmpty is the media type of the empty config of artifacts.
+	mediaTypeEmpty = "application/vnd.oci.empty.v1+json"
+
+	defaultConcurrency = 2
+
+	// defaultSpanSize is the default amount of uncompressed data between
+	// checkpoints.
+	defaultSpanSize = 4 << 20
+
+	// queueSize bounds the number of manifests waiting to be indexed.
+	// Pushes beyond it are not indexed.
+	queueSize = 1000
+)
+
+// Checkpoint is a position of a layer decompression can resume from without
+// the preceding data, as in zlib's zran example. The raw deflate stream
+// resumes at bit Bits, counted from the least significant, of the byte at
+// CompressedOffset, and its back references reach into Window, the
+// uncompressed data preceding UncompressedOffset. The start of a gzip member
+// has no window.
+type Checkpoint struct {
+	CompressedOffset   int64  `json:"compressedOffset"`
+	Bits               uint   `json:"bits,omitempty"`
+	UncompressedOffset int64  `json:"uncompressedOffset"`
+	Window             []byte `json:"window,omitempty"`
+}
+
+// Entry is a file of a layer.
+type Entry struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size,omitempty"`
+	Mode     int64  `json:"mode"`
+	LinkName string `json:"linkName,omitempty"`
+
+	// Offset is the offset of the content of the file in the uncompressed
+	// layer.
+	Offset int64 `json:"offset"`
+}
+
+// TOC is the index of a layer.
+type TOC struct {
+	Version     int           `json:"version"`
+	Layer       digest.Digest `json:"layer"`
+	Checkpoints []Checkpoint  `json:"checkpoints"`
+	Entries     []Entry       `json:"entries"`
+}
+
+// Config configures an Indexer.
+type Config struct {
+	// MinLayerSize is the size of the smallest layer indexed. Small layers
+	// are faster to pull whole.
+	MinLayerSize int64
+
+	// Concurrency is the number of manifests indexed at the same time. It
+	// defaults to 2.
+	Concurrency int
+
+	// SpanSize is the amount of uncompressed data between the checkpoints
+	// of a layer. It defaults to 4MiB.
+	SpanSize int64
+
+	// NameValidator checks the names of the repositories indexed. If nil,
+	// the default constraints of reference.WithName apply.
+	NameValidator *reference.NameValidator
+}
+
+// Indexer indexes the layers of manifests when they are pushed. It
+// implements notifications.Sink, so that it can be fed by the registry event
+// bridge.
+type Indexer struct {
+	ctx        context.Context
+	config     Config
+	registries func(repository string) distribution.Namespace
+	queue      chan target
+	wg         sync.WaitGroup
+	closing    sync.Once
+}
+
+type target struct {
+	repository string
+	digest     digest.Digest
+}
+
+var _ notifications.Sink = &Indexer{}
+
+// New returns an Indexer. Pushes are queued until it is started.
+func New(ctx context.Context, config Config) *Indexer {
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultConcurrency
+	}
+	if config.SpanSize <= 0 {
+		config.SpanSize = defaultSpanSize
+	}
+
+	return &Indexer{
+		ctx:    ctx,
+		config: config,
+		queue:  make(chan target, queueSize),
+	}
+}
+
+// Start starts the workers of the indexer. registries returns the registry
+// storing a repository.
+func (x *Indexer) Start(registries func(repository string) distribution.Namespace) {
+	x.registries = registries
+	for i := 0; i < x.config.Concurrency; i++ {
+		x.wg.Add(1)
+		go func() {
+			defer x.wg.Done()
+			for t := range x.queue {
+				if _, err := x.Index(x.ctx, t.repository, t.digest); err != nil {
+					dcontext.GetLogger(x.ctx).Errorf("error indexing layers of %s@%s: %v", t.repository, t.digest, err)
+				}
+			}
+		}()
+	}
+}
+
+// Write queues the image manifests pushed in events for indexing. It never
+// blocks: manifests are dropped when the queue is full.
+func (x *Indexer) Write(events ...notifications.Event) error {
+	for _, event := range events {
+		if event.Action != notifications.EventActionPush {
+			continue
+		}
+		switch event.Target.MediaType {
+		case schema2.MediaTypeManifest, v1.MediaTypeImageManifest:
+		default:
+			continue
+		}
+
+		t := target{repository: event.Target.Repository, digest: event.Target.Digest}
+		select {
+		case x.queue <- t:
+		default:
+			dcontext.GetLogger(x.ctx).Warnf("layer index queue full, not indexing %s@%s", t.repository, t.digest)
+		}
+	}
+	return nil
+}
+
+// Close waits for the queued manifests to be indexed.
+func (x *Indexer) Close() error {
+	x.closing.Do(func() {
+		close(x.queue)
+	})
+	x.wg.Wait()
+	return nil
+}
+
+// Index indexes the gzip layers of the manifest dgst of repository, and
+// stores the index artifact, referring to the manifest. It returns the
+// digest of the artifact, or "" if the manifest has no layer to index.
+func (x *Indexer) Index(ctx context.Context, repository string, dgst digest.Digest) (digest.Digest, error) {
+	named, err := x.config.NameValidator.WithName(repository)
+	if err != nil {
+		return "", err
+	}
+	repo, err := x.registries(repository).Repository(ctx, named)
+	if err != nil {
+		return "", err
+	}
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return "", err
+	}
+	if lister, ok := manifests.(distribution.ManifestReferrers); ok {
+		referrers, err := lister.Referrers(ctx, dgst)
+		if err != nil {
+			return "", err
+		}
+		for _, referrer := range referrers {
+			if referrer.ArtifactType == ArtifactType {
+				// indexed by an earlier push
+				return referrer.Digest, nil
+			}
+		}
+	}
+
+	m, err := manifests.Get(ctx, dgst)
+	if err != nil {
+		return "", err
+	}
+	var layers []distribution.Descriptor
+	switch m := m.(type) {
+	case *schema2.DeserializedManifest:
+		layers = m.Layers
+	case *ocischema.DeserializedManifest:
+		if m.Subject != nil {
+			// artifacts, such as indexes, are not indexed
+			return "", nil
+		}
+		layers = m.Layers
+	default:
+		return "", nil
+	}
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return "", err
+	}
+
+	blobs := repo.Blobs(ctx)
+	artifact := ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: ArtifactType,
+		Subject: &distribution.Descriptor{
+			MediaType: mediaType,
+			Size:      int64(len(payload)),
+			Digest:    dgst,
+		},
+	}
+	indexed := make(map[digest.Digest]bool)
+	for _, layer := range layers {
+		switch layer.MediaType {
+		case schema2.MediaTypeLayer, v1.MediaTypeImageLayerGzip:
+		default:
+			continue
+		}
+		if layer.Size < x.config.MinLayerSize || indexed[layer.Digest] {
+			continue
+		}
+		indexed[layer.Digest] = true
+
+		toc, err := x.indexLayer(ctx, blobs, layer.Digest)
+		if err != nil {
+			return "", fmt.Errorf("layer %s: %v", layer.Digest, err)
+		}
+		content, err := json.Marshal(toc)
+		if err != nil {
+			return "", err
+		}
+		desc, err := blobs.Put(ctx, MediaTypeTOC, content)
+		if err != nil {
+			return "", err
+		}
+		desc.MediaType = MediaTypeTOC
+		desc.Annotations = map[string]string{LayerAnnotation: layer.Digest.String()}
+		artifact.Layers = append(artifact.Layers, desc)
+	}
+	if len(artifact.Layers) == 0 {
+		return "", nil
+	}
+
+	artifact.Config, err = blobs.Put(ctx, mediaTypeEmpty, []byte("{}"))
+	if err != nil {
+		return "", err
+	}
+	artifact.Config.MediaType = mediaTypeEmpty
+	deserialized, err := ocischema.FromStruct(artifact)
+	if err != nil {
+		return "", err
+	}
+	return manifests.Put(ctx, deserialized)
+}
+
+func (x *Indexer) indexLayer(ctx context.Context, blobs distribution.BlobStore, dgst digest.Digest) (TOC, error) {
+	rc, err := blobs.Open(ctx, dgst)
+	if err != nil {
+		return TOC{}, err
+	}
+	defer rc.Close()
+
+	toc, err := BuildTOC(rc, x.config.SpanSize)
+	if err != nil {
+		return TOC{}, err
+	}
+	toc.Layer = dgst
+	return toc, nil
+}
+
+// BuildTOC reads a gzip compressed tar layer and returns its index, with a
+// checkpoint at the start of every gzip member and about every spanSize
+// bytes of uncompressed data.
+func BuildTOC(r io.Reader, spanSize int64) (TOC, error) {
+	pr, pw := io.Pipe()
+	x := newInflater(r, pw, spanSize)
+	done := make(chan error, 1)
+	go func() {
+		err := x.inflate()
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	uncompressed := &countingReader{r: pr}
+	toc := TOC{Version: 2}
+	tr := tar.NewReader(uncompressed)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			pr.CloseWithError(err)
+			<-done
+			return TOC{}, err
+		}
+		toc.Entries = append(toc.Entries, Entry{
+			Name:     hdr.Name,
+			Type:     entryType(hdr.Typeflag),
+			Size:     hdr.Size,
+			Mode:     hdr.Mode,
+			LinkName: hdr.Linkname,
+			Offset:   uncompressed.n,
+		})
+	}
+	// the checkpoints of the data following the end of the archive
+	if _, err := io.Copy(ioutil.Discard, uncompressed); err != nil {
+		return TOC{}, err
+	}
+	if err := <-done; err != nil {
+		return TOC{}, err
+	}
+	toc.Checkpoints = x.checkpoints
+	return toc, nil
+}
+
+func entryType(flag byte) string {
+	switch flag {
+	case tar.TypeReg:
+		return "reg"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeFifo:
+		return "fifo"
+	default:
+		return string(flag)
+	}
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
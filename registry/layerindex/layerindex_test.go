@@ -0,0 +1,296 @@
+package layerindex
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+// buildLayer returns a tar archive of files, compressed as one gzip member
+// per file.
+func buildLayer(t *testing.T, files map[string]string, names ...string) []byte {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	var boundaries []int
+	for _, name := range names {
+		boundaries = append(boundaries, archive.Len())
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(files[name]))
+		tw.Flush()
+	}
+	tw.Close()
+	// the last member holds the end of the archive
+	boundaries = append(boundaries, archive.Len())
+
+	var compressed bytes.Buffer
+	for i := 0; i < len(names); i++ {
+		gw := gzip.NewWriter(&compressed)
+		gw.Write(archive.Bytes()[boundaries[i]:boundaries[i+1]])
+		gw.Close()
+	}
+	return compressed.Bytes()
+}
+
+// resume decompresses a gzip member of layer from the checkpoint c, with
+// compress/flate, up to the end of the member.
+func resume(t *testing.T, layer []byte, c Checkpoint) []byte {
+	data := layer[c.CompressedOffset:]
+	if c.Bits > 0 {
+		// drop the bits preceding the checkpoint
+		shifted := make([]byte, len(data))
+		for i := range data {
+			shifted[i] = data[i] >> c.Bits
+			if i+1 < len(data) {
+				shifted[i] |= data[i+1] << (8 - c.Bits)
+			}
+		}
+		data = shifted
+	}
+	var out bytes.Buffer
+	if _, err := out.ReadFrom(flate.NewReaderDict(bytes.NewReader(data), c.Window)); err != nil {
+		t.Fatalf("error resuming at %+v: %v", c, err)
+	}
+	return out.Bytes()
+}
+
+// checkTOC checks that the entries of toc find the files in the layer, and
+// that decompression resumed from its checkpoints produces the layer.
+func checkTOC(t *testing.T, toc TOC, layer []byte, files map[string]string) {
+	zr, err := gzip.NewReader(bytes.NewReader(layer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(toc.Entries) != len(files) {
+		t.Fatalf("unexpected entries %+v", toc.Entries)
+	}
+	for _, entry := range toc.Entries {
+		content := uncompressed[entry.Offset : entry.Offset+entry.Size]
+		if entry.Type != "reg" || string(content) != files[entry.Name] {
+			t.Errorf("unexpected content of %s", entry.Name)
+		}
+	}
+
+	for _, c := range toc.Checkpoints {
+		resumed := resume(t, layer, c)
+		if c.UncompressedOffset < int64(len(uncompressed)) && len(resumed) == 0 || !bytes.Equal(resumed, uncompressed[c.UncompressedOffset:c.UncompressedOffset+int64(len(resumed))]) {
+			t.Errorf("unexpected data resumed at checkpoint %d/%d", c.CompressedOffset, c.UncompressedOffset)
+		}
+	}
+}
+
+func TestBuildTOC(t *testing.T) {
+	files := map[string]string{"a.txt": "first file", "b.txt": "second file"}
+	layer := buildLayer(t, files, "a.txt", "b.txt")
+
+	toc, err := BuildTOC(bytes.NewReader(layer), defaultSpanSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each member starts a checkpoint
+	if len(toc.Checkpoints) != 2 || toc.Checkpoints[0].CompressedOffset != 10 || toc.Checkpoints[1].UncompressedOffset != 1024 {
+		t.Fatalf("unexpected checkpoints %+v", toc.Checkpoints)
+	}
+	checkTOC(t, toc, layer, files)
+
+	if _, err := BuildTOC(bytes.NewReader([]byte("not gzip")), defaultSpanSize); err == nil {
+		t.Fatal("expected an error indexing a layer not compressed with gzip")
+	}
+	corrupted := append([]byte(nil), layer...)
+	corrupted[len(layer)-5]++
+	if _, err := BuildTOC(bytes.NewReader(corrupted), defaultSpanSize); err == nil {
+		t.Fatal("expected an error indexing a layer with an invalid checksum")
+	}
+}
+
+func TestBuildTOCCheckpoints(t *testing.T) {
+	// compressible files, so that matches reach across checkpoints
+	words := []string{"layer", "index", "checkpoint", "registry", "window", "deflate", "\n"}
+	rnd := rand.New(rand.NewSource(1))
+	files := make(map[string]string)
+	var names []string
+	for i := 0; i < 8; i++ {
+		var content strings.Builder
+		for content.Len() < 128<<10 {
+			fmt.Fprintf(&content, "%s%d ", words[rnd.Intn(len(words))], rnd.Intn(1000))
+		}
+		name := fmt.Sprintf("file%d", i)
+		files[name] = content.String()
+		names = append(names, name)
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(files[name]))
+	}
+	tw.Close()
+
+	for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression, gzip.HuffmanOnly, gzip.NoCompression} {
+		// a single member, as most layers are
+		var layer bytes.Buffer
+		gw, _ := gzip.NewWriterLevel(&layer, level)
+		gw.Write(archive.Bytes())
+		gw.Close()
+
+		toc, err := BuildTOC(bytes.NewReader(layer.Bytes()), 64<<10)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if len(toc.Checkpoints) < 3 {
+			t.Fatalf("level %d: expected checkpoints within the member, got %d", level, len(toc.Checkpoints))
+		}
+		for _, c := range toc.Checkpoints[1:] {
+			if len(c.Window) != windowSize {
+				t.Fatalf("level %d: unexpected window of %d bytes", level, len(c.Window))
+			}
+		}
+		checkTOC(t, toc, layer.Bytes(), files)
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry, err := storage.NewRegistry(ctx, d, storage.EnableDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, _ := reference.WithName("foo/bar")
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repository.Blobs(ctx)
+
+	config, err := blobs.Put(ctx, schema2.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MediaType = schema2.MediaTypeImageConfig
+	m := schema2.Manifest{Versioned: schema2.SchemaVersion, Config: config}
+	for _, content := range [][]byte{
+		buildLayer(t, map[string]string{"large": string(bytes.Repeat([]byte("x"), 4096))}, "large"),
+		buildLayer(t, map[string]string{"small": ""}, "small"),
+	} {
+		desc, err := blobs.Put(ctx, schema2.MediaTypeLayer, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc.MediaType = schema2.MediaTypeLayer
+		m.Layers = append(m.Layers, desc)
+	}
+	deserialized, err := schema2.FromStruct(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(ctx, deserialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// small layers are not indexed
+	indexer := New(ctx, Config{MinLayerSize: m.Layers[1].Size + 1})
+	indexer.Start(func(string) distribution.Namespace { return registry })
+	var event notifications.Event
+	event.Action = notifications.EventActionPush
+	event.Target.MediaType = schema2.MediaTypeManifest
+	event.Target.Repository = "foo/bar"
+	event.Target.Digest = dgst
+	indexer.Write(event)
+
+	referrers := manifests.(distribution.ManifestReferrers)
+	var artifact digest.Digest
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		indexes, err := referrers.Referrers(ctx, dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(indexes) == 1 {
+			if indexes[0].ArtifactType != ArtifactType {
+				t.Fatalf("unexpected referrer %+v", indexes[0])
+			}
+			artifact = indexes[0].Digest
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("manifest not indexed")
+		}
+	}
+	indexer.Close()
+
+	stored, err := manifests.Get(ctx, artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, ok := stored.(*ocischema.DeserializedManifest)
+	if !ok || index.ArtifactType != ArtifactType || index.Subject == nil || index.Subject.Digest != dgst || len(index.Layers) != 1 {
+		t.Fatalf("unexpected index artifact %+v", stored)
+	}
+	tocDesc := index.Layers[0]
+	if tocDesc.MediaType != MediaTypeTOC || tocDesc.Annotations[LayerAnnotation] != m.Layers[0].Digest.String() {
+		t.Fatalf("unexpected layer index %+v", tocDesc)
+	}
+	content, err := blobs.Get(ctx, tocDesc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var toc TOC
+	if err := json.Unmarshal(content, &toc); err != nil {
+		t.Fatal(err)
+	}
+	if toc.Layer != m.Layers[0].Digest || len(toc.Entries) != 1 || toc.Entries[0].Name != "large" {
+		t.Fatalf("unexpected layer index %+v", toc)
+	}
+
+	// indexing again returns the stored artifact
+	again, err := indexer.Index(ctx, "foo/bar", dgst)
+	if err != nil || again != artifact {
+		t.Fatalf("unexpected artifact %s: %v", again, err)
+	}
+
+	// the index is collected along with its image
+	if err := manifests.Delete(ctx, dgst); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.MarkAndSweep(ctx, d, registry, storage.GCOpts{}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if exists, err := manifests.Exists(ctx, artifact); err != nil || exists {
+		t.Fatalf("expected the index artifact to be removed: %v", err)
+	}
+	if _, err := blobs.Stat(ctx, tocDesc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected the layer index to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/libtrust"
+	"github.com/spf13/cobra"
+)
+
+var (
+	layoutTarget           int
+	layoutDryRun           bool
+	layoutResume           bool
+	layoutProgressInterval time.Duration
+)
+
+func init() {
+	RootCmd.AddCommand(UpgradeLayoutCmd)
+	UpgradeLayoutCmd.Flags().IntVarP(&layoutTarget, "to", "t", 0, "layout to upgrade to, 0 for the latest supported layout")
+	UpgradeLayoutCmd.Flags().BoolVarP(&layoutDryRun, "dry-run", "d", false, "report the changes without making them")
+	UpgradeLayoutCmd.Flags().BoolVarP(&layoutResume, "resume", "r", false, "resume an interrupted upgrade from its checkpoint")
+	UpgradeLayoutCmd.Flags().DurationVarP(&layoutProgressInterval, "progress-interval", "i", time.Minute, "how often to report progress and save a checkpoint, 0 to disable")
+}
+
+// UpgradeLayoutCmd is the cobra command that corresponds to the
+// upgrade-layout subcommand
+var UpgradeLayoutCmd = &cobra.Command{
+	Use:   "upgrade-layout <config>",
+	Short: "`upgrade-layout` migrates storage to a more recent layout",
+	Long: "`upgrade-layout` migrates the repositories of the storage configured by\n" +
+		"<config> to a more recent layout, one revision at a time. Registries\n" +
+		"serving the storage must support the target layout.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		k, err := libtrust.GenerateECP256PrivateKey()
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		options := referenceIndexOptions(config, []storage.RegistryOption{storage.Schema1SigningKey(k)})
+		registry, err := storage.NewRegistry(ctx, driver, options...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		tenants, err := tenantRegistries(ctx, config, options...)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !layoutDryRun {
+			if err := invalidateReferenceIndexes(ctx, config, driver, tenants); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to invalidate the reference index: %v", err)
+				os.Exit(1)
+			}
+		}
+
+		// each storage keeps its own layout
+		upgrade := func() error {
+			opts := storage.UpgradeLayoutOpts{
+				Target:           layoutTarget,
+				DryRun:           layoutDryRun,
+				Resume:           layoutResume,
+				ProgressInterval: layoutProgressInterval,
+			}
+			if err := storage.UpgradeLayout(ctx, driver, registry, opts); err != nil {
+				return err
+			}
+			for _, t := range tenants {
+				fmt.Printf("upgrading the layout of tenant %s\n", t.name)
+				if err := storage.UpgradeLayout(ctx, t.driver, t.registry, opts); err != nil {
+					return fmt.Errorf("tenant %s: %v", t.name, err)
+				}
+			}
+			return nil
+		}
+		if layoutDryRun {
+			err = upgrade()
+		} else {
+			err = runWithLease(ctx, config, driver, "layout", upgrade)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to upgrade layout: %v", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -27,13 +27,17 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 }
 
 // NewListener announces on laddr and net. Accepted values of the net are
-// 'unix' and 'tcp'
+// 'unix', 'tcp', 'tcp4' and 'tcp6'. A 'tcp' listener on a wildcard address
+// accepts both IPv4 and IPv6 connections where the system supports it, while
+// 'tcp4' and 'tcp6' restrict it to one family.
 func NewListener(net, laddr string) (net.Listener, error) {
 	switch net {
 	case "unix":
 		return newUnixListener(laddr)
 	case "tcp", "": // an empty net means tcp
-		return newTCPListener(laddr)
+		return newTCPListener("tcp", laddr)
+	case "tcp4", "tcp6":
+		return newTCPListener(net, laddr)
 	default:
 		return nil, fmt.Errorf("unknown address type %s", net)
 	}
@@ -64,8 +68,8 @@ func isSocket(m os.FileMode) bool {
 	return m&os.ModeSocket != 0
 }
 
-func newTCPListener(laddr string) (net.Listener, error) {
-	ln, err := net.Listen("tcp", laddr)
+func newTCPListener(network, laddr string) (net.Listener, error) {
+	ln, err := net.Listen(network, laddr)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,258 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultProxyHeaderTimeout bounds the time a client has to send the
+	// PROXY protocol header.
+	defaultProxyHeaderTimeout = 5 * time.Second
+
+	// maxProxyV1HeaderLength is the longest version 1 header allowed by
+	// the specification, including the trailing CRLF.
+	maxProxyV1HeaderLength = 107
+)
+
+// proxyV2Signature starts every version 2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// errInvalidProxyHeader is returned when a connection from a trusted source
+// does not start with a valid PROXY protocol header.
+var errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// proxyProtocolListener reads the HAProxy PROXY protocol header sent by load
+// balancers at the start of connections, so that the address of the client
+// is reported instead of the address of the load balancer.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted       []*net.IPNet
+	headerTimeout time.Duration
+}
+
+// NewProxyProtocolListener wraps ln so that connections from the trusted
+// networks must start with a PROXY protocol header, version 1 or 2. The
+// remote address of these connections is the client address carried by the
+// header. Connections from other networks are served unchanged, so no TCP
+// connection is trusted if trusted is empty. Connections without an IP
+// address, such as those of unix sockets, are always trusted. A header not received within
+// headerTimeout fails the connection; zero means five seconds.
+func NewProxyProtocolListener(ln net.Listener, trusted []*net.IPNet, headerTimeout time.Duration) net.Listener {
+	if headerTimeout <= 0 {
+		headerTimeout = defaultProxyHeaderTimeout
+	}
+	return &proxyProtocolListener{
+		Listener:      ln,
+		trusted:       trusted,
+		headerTimeout: headerTimeout,
+	}
+}
+
+// Accept returns the next connection. The header is read on the first use of
+// the connection rather than here, so that a slow client cannot hold up the
+// accept loop.
+func (ln *proxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !ln.isTrusted(c.RemoteAddr()) {
+		return c, nil
+	}
+	return &proxyProtocolConn{
+		Conn:          c,
+		reader:        bufio.NewReader(c),
+		headerTimeout: ln.headerTimeout,
+	}, nil
+}
+
+func (ln *proxyProtocolListener) isTrusted(addr net.Addr) bool {
+	var ip net.IP
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	default:
+		return true
+	}
+
+	for _, network := range ln.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyProtocolConn is a connection starting with a PROXY protocol header.
+type proxyProtocolConn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+// Read reads data following the header.
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address carried by the header, or the
+// address of the peer if the header does not carry one.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	c.remoteAddr, c.err = readProxyHeader(c.reader)
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// readProxyHeader reads a version 1 or 2 PROXY protocol header from r and
+// returns the source address it carries. The address is nil for headers
+// which do not carry one, such as health checks of the load balancer.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case proxyV2Signature[0]:
+		signature, err := r.Peek(len(proxyV2Signature))
+		if err != nil || !bytes.Equal(signature, proxyV2Signature) {
+			return nil, errInvalidProxyHeader
+		}
+		return readProxyV2Header(r)
+	case 'P':
+		return readProxyV1Header(r)
+	default:
+		return nil, errInvalidProxyHeader
+	}
+}
+
+// readProxyV1Header reads a header such as
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= maxProxyV1HeaderLength {
+			return nil, errInvalidProxyHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errInvalidProxyHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errInvalidProxyHeader
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, errInvalidProxyHeader
+	}
+
+	if len(fields) != 6 {
+		return nil, errInvalidProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, errInvalidProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errInvalidProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2Header reads a binary header.
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	versionCommand := header[12]
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if versionCommand>>4 != 2 {
+		return nil, fmt.Errorf("%v: unsupported version %d", errInvalidProxyHeader, versionCommand>>4)
+	}
+	switch versionCommand & 0xf {
+	case 0x0:
+		// LOCAL: the connection was established by the proxy itself
+		return nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, errInvalidProxyHeader
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}, nil
+	default:
+		// other protocols do not carry a usable client address
+		return nil, nil
+	}
+}
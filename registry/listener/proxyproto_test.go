@@ -0,0 +1,124 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func proxyV2Header(command, family byte, payload []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4Payload := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x01, 0xbb}
+	ipv6Payload := make([]byte, 36)
+	copy(ipv6Payload, net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(ipv6Payload[32:34], 56324)
+
+	for _, tc := range []struct {
+		name   string
+		header []byte
+		addr   string
+		err    bool
+	}{
+		{name: "v1 tcp4", header: []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"), addr: "192.0.2.1:56324"},
+		{name: "v1 tcp6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), addr: "[2001:db8::1]:56324"},
+		{name: "v1 unknown", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 family mismatch", header: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n"), err: true},
+		{name: "v1 invalid port", header: []byte("PROXY TCP4 192.0.2.1 192.0.2.2 http 443\r\n"), err: true},
+		{name: "v1 missing crlf", header: []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\n"), err: true},
+		{name: "v1 too long", header: []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), err: true},
+		{name: "v2 tcp4", header: proxyV2Header(0x1, 0x11, ipv4Payload), addr: "192.0.2.1:56324"},
+		{name: "v2 tcp6", header: proxyV2Header(0x1, 0x21, ipv6Payload), addr: "[2001:db8::1]:56324"},
+		{name: "v2 local", header: proxyV2Header(0x0, 0x00, nil)},
+		{name: "v2 short payload", header: proxyV2Header(0x1, 0x11, ipv4Payload[:8]), err: true},
+		{name: "plain http", header: []byte("GET / HTTP/1.1\r\n"), err: true},
+	} {
+		r := bufio.NewReader(bytes.NewReader(append(tc.header, "payload"...)))
+		addr, err := readProxyHeader(r)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+
+		if tc.addr == "" && addr != nil {
+			t.Errorf("%s: expected no address, got %v", tc.name, addr)
+		} else if tc.addr != "" && (addr == nil || addr.String() != tc.addr) {
+			t.Errorf("%s: expected address %s, got %v", tc.name, tc.addr, addr)
+		}
+
+		if rest, _ := ioutil.ReadAll(r); string(rest) != "payload" {
+			t.Errorf("%s: unexpected data after header: %q", tc.name, rest)
+		}
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	ln, err := NewListener("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	defer ln.Close()
+
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, other, _ := net.ParseCIDR("192.0.2.0/24")
+
+	// accept sends a message through a connection accepted by a proxy
+	// protocol listener and returns the remote address and data seen by
+	// the server.
+	accept := func(trusted []*net.IPNet, message string) (string, string, error) {
+		pln := NewProxyProtocolListener(ln, trusted, time.Second)
+
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("unexpected error dialing: %v", err)
+		}
+		client.Write([]byte(message))
+		client.Close()
+
+		conn, err := pln.Accept()
+		if err != nil {
+			t.Fatalf("unexpected error accepting: %v", err)
+		}
+		defer conn.Close()
+
+		data, err := ioutil.ReadAll(conn)
+		return conn.RemoteAddr().String(), string(data), err
+	}
+
+	addr, data, err := accept([]*net.IPNet{loopback}, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nGET / HTTP/1.1\r\n\r\n")
+	if err != nil || addr != "192.0.2.1:56324" || data != "GET / HTTP/1.1\r\n\r\n" {
+		t.Fatalf("unexpected connection from trusted proxy: %s %q %v", addr, data, err)
+	}
+
+	if _, _, err := accept([]*net.IPNet{loopback}, "GET / HTTP/1.1\r\n\r\n"); err == nil {
+		t.Fatalf("expected connections from trusted proxies without header to fail")
+	}
+
+	addr, data, err = accept([]*net.IPNet{other}, "GET / HTTP/1.1\r\n\r\n")
+	if err != nil || !strings.HasPrefix(addr, "127.0.0.1:") || data != "GET / HTTP/1.1\r\n\r\n" {
+		t.Fatalf("unexpected connection from untrusted client: %s %q %v", addr, data, err)
+	}
+
+	// no network is trusted unless listed, so that clients cannot spoof
+	// their address
+	addr, data, err = accept(nil, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nGET / HTTP/1.1\r\n\r\n")
+	if err != nil || !strings.HasPrefix(addr, "127.0.0.1:") || !strings.HasPrefix(data, "PROXY TCP4") {
+		t.Fatalf("unexpected connection without trusted networks: %s %q %v", addr, data, err)
+	}
+}
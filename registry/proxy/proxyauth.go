@@ -1,10 +1,17 @@
 package proxy
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/docker/distribution/configuration"
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/distribution/registry/client/auth/challenge"
@@ -12,46 +19,174 @@ import (
 
 const challengeHeader = "Docker-Distribution-Api-Version"
 
+// defaultCredentialTTL is how long credentials obtained from a file or a
+// credential helper are used if no TTL is configured.
+const defaultCredentialTTL = 5 * time.Minute
+
 type userpass struct {
 	username string
 	password string
 }
 
+// credentialSource provides the credentials for the remote registry.
+type credentialSource interface {
+	credentials() (userpass, error)
+}
+
+// staticCredentials are configured directly in the registry configuration.
+type staticCredentials userpass
+
+func (c staticCredentials) credentials() (userpass, error) {
+	return userpass(c), nil
+}
+
+// fileCredentials are read from a JSON file with "username" and "password"
+// fields.
+type fileCredentials struct {
+	path string
+}
+
+func (c fileCredentials) credentials() (userpass, error) {
+	p, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return userpass{}, err
+	}
+
+	var file struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(p, &file); err != nil {
+		return userpass{}, fmt.Errorf("invalid credentials file %s: %v", c.path, err)
+	}
+	return userpass{username: file.Username, password: file.Password}, nil
+}
+
+// helperCredentials are obtained from a docker credential helper, following
+// the protocol of github.com/docker/docker-credential-helpers: the server URL
+// is written to the standard input of "docker-credential-<helper> get",
+// which prints the credentials as JSON.
+type helperCredentials struct {
+	helper    string
+	serverURL string
+}
+
+func (c helperCredentials) credentials() (userpass, error) {
+	cmd := exec.Command("docker-credential-"+c.helper, "get")
+	cmd.Stdin = strings.NewReader(c.serverURL)
+
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return userpass{}, fmt.Errorf("credential helper %s failed: %s", c.helper, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return userpass{}, err
+	}
+
+	var resp struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return userpass{}, fmt.Errorf("invalid output of credential helper %s: %v", c.helper, err)
+	}
+	return userpass{username: resp.Username, password: resp.Secret}, nil
+}
+
+// credentials implements auth.CredentialStore for the token authentication
+// URLs of the remote registry. Credentials are fetched from their source
+// when they are older than the TTL, and refresh tokens issued by the remote
+// are kept until the credentials change.
 type credentials struct {
-	creds map[string]userpass
+	authURLs map[string]struct{}
+	source   credentialSource
+	ttl      time.Duration
+
+	mu            sync.Mutex
+	cached        userpass
+	fetched       time.Time
+	refreshTokens map[string]string
 }
 
-func (c credentials) Basic(u *url.URL) (string, string) {
-	up := c.creds[u.String()]
+func (c *credentials) Basic(u *url.URL) (string, string) {
+	if _, ok := c.authURLs[u.String()]; !ok {
+		return "", ""
+	}
 
-	return up.username, up.password
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fetched.IsZero() || time.Since(c.fetched) > c.ttl {
+		up, err := c.source.credentials()
+		if err != nil {
+			// Keep using the previous credentials, they may still be
+			// accepted by the remote.
+			context.GetLogger(context.Background()).Errorf("error obtaining credentials for %s: %v", u, err)
+		} else {
+			if up != c.cached {
+				c.refreshTokens = make(map[string]string)
+			}
+			c.cached = up
+			c.fetched = time.Now()
+		}
+	}
+
+	return c.cached.username, c.cached.password
 }
 
-func (c credentials) RefreshToken(u *url.URL, service string) string {
-	return ""
+func (c *credentials) RefreshToken(u *url.URL, service string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refreshTokens[u.String()+"|"+service]
 }
 
-func (c credentials) SetRefreshToken(u *url.URL, service, token string) {
+func (c *credentials) SetRefreshToken(u *url.URL, service, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refreshTokens[u.String()+"|"+service] = token
 }
 
 // configureAuth stores credentials for challenge responses
-func configureAuth(username, password, remoteURL string) (auth.CredentialStore, error) {
-	creds := map[string]userpass{}
+func configureAuth(config configuration.Proxy) (auth.CredentialStore, error) {
+	remoteURL, err := url.Parse(config.RemoteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var source credentialSource
+	switch {
+	case config.CredentialHelper != "":
+		source = helperCredentials{helper: config.CredentialHelper, serverURL: remoteURL.Host}
+	case config.CredentialsFile != "":
+		source = fileCredentials{path: config.CredentialsFile}
+	default:
+		source = staticCredentials{username: config.Username, password: config.Password}
+	}
+
+	ttl := config.CredentialTTL
+	if ttl <= 0 {
+		ttl = defaultCredentialTTL
+	}
 
-	authURLs, err := getAuthURLs(remoteURL)
+	authURLs, err := getAuthURLs(config.RemoteURL)
 	if err != nil {
 		return nil, err
 	}
 
+	creds := &credentials{
+		authURLs:      make(map[string]struct{}),
+		source:        source,
+		ttl:           ttl,
+		refreshTokens: make(map[string]string),
+	}
 	for _, url := range authURLs {
 		context.GetLogger(context.Background()).Infof("Discovered token authentication URL: %s", url)
-		creds[url] = userpass{
-			username: username,
-			password: password,
-		}
+		creds.authURLs[url] = struct{}{}
 	}
 
-	return credentials{creds: creds}, nil
+	return creds, nil
 }
 
 func getAuthURLs(remoteURL string) ([]string, error) {
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+)
+
+func newChallengingServer() *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	return server
+}
+
+func TestCredentialsFile(t *testing.T) {
+	server := newChallengingServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(path, []byte(`{"username": "alice", "password": "first"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := configureAuth(configuration.Proxy{
+		RemoteURL:       server.URL,
+		CredentialsFile: path,
+		CredentialTTL:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error configuring auth: %v", err)
+	}
+	realm, _ := url.Parse(server.URL + "/token")
+
+	if username, password := cs.Basic(realm); username != "alice" || password != "first" {
+		t.Fatalf("unexpected credentials: %q, %q", username, password)
+	}
+	other, _ := url.Parse("https://example.com/token")
+	if username, _ := cs.Basic(other); username != "" {
+		t.Fatalf("unexpected credentials for unknown realm: %q", username)
+	}
+
+	cs.SetRefreshToken(realm, "registry", "refresh")
+	if token := cs.RefreshToken(realm, "registry"); token != "refresh" {
+		t.Fatalf("unexpected refresh token: %q", token)
+	}
+
+	// Rotated credentials are picked up once the cached ones expire, and
+	// refresh tokens issued for the previous credentials are dropped.
+	if err := ioutil.WriteFile(path, []byte(`{"username": "alice", "password": "second"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, password := cs.Basic(realm); password != "first" {
+		t.Fatalf("expected cached credentials, got password %q", password)
+	}
+	cs.(*credentials).fetched = time.Now().Add(-2 * time.Hour)
+	if _, password := cs.Basic(realm); password != "second" {
+		t.Fatalf("expected rotated credentials, got password %q", password)
+	}
+	if token := cs.RefreshToken(realm, "registry"); token != "" {
+		t.Fatalf("expected refresh token to be dropped, got %q", token)
+	}
+
+	// Failing to read the credentials keeps the previous ones.
+	os.Remove(path)
+	cs.(*credentials).fetched = time.Now().Add(-2 * time.Hour)
+	if _, password := cs.Basic(realm); password != "second" {
+		t.Fatalf("expected previous credentials, got password %q", password)
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper script requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := "#!/bin/sh\nread server\necho \"{\\\"ServerURL\\\": \\\"$server\\\", \\\"Username\\\": \\\"AWS\\\", \\\"Secret\\\": \\\"$server\\\"}\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	up, err := helperCredentials{helper: "test", serverURL: "registry.example.com"}.credentials()
+	if err != nil {
+		t.Fatalf("unexpected error running credential helper: %v", err)
+	}
+	if up.username != "AWS" || up.password != "registry.example.com" {
+		t.Fatalf("unexpected credentials: %#v", up)
+	}
+
+	if _, err := (helperCredentials{helper: "missing", serverURL: "registry.example.com"}).credentials(); err == nil {
+		t.Fatalf("expected error running missing credential helper")
+	}
+}
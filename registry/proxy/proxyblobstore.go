@@ -18,8 +18,10 @@ type proxyBlobStore struct {
 	localStore     distribution.BlobStore
 	remoteStore    distribution.BlobService
 	scheduler      *scheduler.TTLExpirationScheduler
+	hints          *pullHints
 	repositoryName reference.Named
 	authChallenger authChallenger
+	retry          retryPolicy
 }
 
 var _ distribution.BlobStore = &proxyBlobStore{}
@@ -51,12 +53,43 @@ func (pbs *proxyBlobStore) copyContent(ctx context.Context, dgst digest.Digest,
 	if err != nil {
 		return distribution.Descriptor{}, err
 	}
+	defer func() {
+		remoteReader.Close()
+	}()
 
-	defer remoteReader.Close()
+	var written int64
+	for attempt := 1; ; attempt++ {
+		upstream := &upstreamReader{Reader: remoteReader}
+		n, err := io.CopyN(writer, upstream, desc.Size-written)
+		written += n
+		if err == nil {
+			break
+		}
 
-	_, err = io.CopyN(writer, remoteReader, desc.Size)
-	if err != nil {
-		return distribution.Descriptor{}, err
+		// Only interrupted upstream reads can be resumed; write errors
+		// mean the client or the local store gave up.
+		if upstream.err == nil && err != io.EOF {
+			return distribution.Descriptor{}, err
+		}
+		if attempt >= pbs.retry.maxAttempts || ctx.Err() != nil {
+			return distribution.Descriptor{}, err
+		}
+
+		backoff := pbs.retry.backoff(attempt)
+		dcontext.GetLogger(ctx).Warnf("Error reading blob %s from upstream at offset %d, resuming in %s: %v", dgst, written, backoff, err)
+		if err := pbs.retry.wait(ctx, backoff); err != nil {
+			return distribution.Descriptor{}, err
+		}
+
+		resumed, err := pbs.remoteStore.Open(ctx, dgst)
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		remoteReader.Close()
+		remoteReader = resumed
+		if _, err := remoteReader.Seek(written, io.SeekStart); err != nil {
+			return distribution.Descriptor{}, err
+		}
 	}
 
 	proxyMetrics.BlobPush(uint64(desc.Size))
@@ -64,6 +97,21 @@ func (pbs *proxyBlobStore) copyContent(ctx context.Context, dgst digest.Digest,
 	return desc, nil
 }
 
+// upstreamReader records errors reading from the remote registry, so that
+// they can be told apart from errors writing the content.
+type upstreamReader struct {
+	io.Reader
+	err error
+}
+
+func (r *upstreamReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
 func (pbs *proxyBlobStore) serveLocal(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) (bool, error) {
 	localDesc, err := pbs.localStore.Stat(ctx, dgst)
 	if err != nil {
@@ -74,6 +122,10 @@ func (pbs *proxyBlobStore) serveLocal(ctx context.Context, w http.ResponseWriter
 
 	if err == nil {
 		proxyMetrics.BlobPush(uint64(localDesc.Size))
+		cacheEvent("blob", pbs.repositoryName, cacheHit)
+		if blobRef, err := reference.WithDigest(pbs.repositoryName, dgst); err == nil {
+			setCacheHeaders(w, true, pbs.scheduler, blobRef)
+		}
 		return true, pbs.localStore.ServeBlob(ctx, w, r, dgst)
 	}
 
@@ -107,6 +159,7 @@ func (pbs *proxyBlobStore) storeLocal(ctx context.Context, dgst digest.Digest) e
 		return err
 	}
 
+	cacheEvent("blob", pbs.repositoryName, cacheInsert)
 	return nil
 }
 
@@ -125,6 +178,9 @@ func (pbs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter,
 		return err
 	}
 
+	cacheEvent("blob", pbs.repositoryName, cacheMiss)
+	setCacheHeaders(w, false, nil, nil)
+
 	mu.Lock()
 	_, ok := inflight[dgst]
 	if ok {
@@ -146,7 +202,7 @@ func (pbs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter,
 			return
 		}
 
-		pbs.scheduler.AddBlob(blobRef, repositoryTTL)
+		pbs.scheduler.AddBlob(blobRef, pbs.hints.ttl(dgst))
 	}(dgst)
 
 	_, err = pbs.copyContent(ctx, dgst, w)
@@ -176,8 +232,10 @@ func (pbs *proxyBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distri
 func (pbs *proxyBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
 	blob, err := pbs.localStore.Get(ctx, dgst)
 	if err == nil {
+		cacheEvent("blob", pbs.repositoryName, cacheHit)
 		return blob, nil
 	}
+	cacheEvent("blob", pbs.repositoryName, cacheMiss)
 
 	if err := pbs.authChallenger.tryEstablishChallenges(ctx); err != nil {
 		return []byte{}, err
@@ -192,6 +250,7 @@ func (pbs *proxyBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte,
 	if err != nil {
 		return []byte{}, err
 	}
+	cacheEvent("blob", pbs.repositoryName, cacheInsert)
 	return blob, nil
 }
 
@@ -1,7 +1,9 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
@@ -310,6 +312,112 @@ func TestProxyStoreServeMany(t *testing.T) {
 	testProxyStoreServe(t, te, numClients)
 }
 
+func TestProxyStoreCacheHeaders(t *testing.T) {
+	te := makeTestEnv(t, "foo/bar")
+	populate(t, te, 1, 10, 1)
+	if err := te.store.scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer te.store.scheduler.Stop()
+
+	dgst := te.inRemote[0].Digest
+	r, _ := http.NewRequest("GET", "", nil)
+
+	w := httptest.NewRecorder()
+	if err := te.store.ServeBlob(te.ctx, w, r, dgst); err != nil {
+		t.Fatal(err)
+	}
+	if cache := w.Header().Get("X-Cache"); cache != "MISS" {
+		t.Fatalf("unexpected X-Cache header on first pull: %q", cache)
+	}
+
+	// Wait for the blob to be cached and scheduled for expiry.
+	blobRef, _ := reference.WithDigest(te.store.repositoryName, dgst)
+	for i := 0; i < 100; i++ {
+		if _, ok := te.store.scheduler.Expiry(blobRef); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w = httptest.NewRecorder()
+	if err := te.store.ServeBlob(te.ctx, w, r, dgst); err != nil {
+		t.Fatal(err)
+	}
+	if cache := w.Header().Get("X-Cache"); cache != "HIT" {
+		t.Fatalf("unexpected X-Cache header on second pull: %q", cache)
+	}
+	if age := w.Header().Get("Age"); age != "0" {
+		t.Fatalf("unexpected Age header: %q", age)
+	}
+}
+
+// flakyBlobStore fails reads of the first blob it opens halfway through.
+type flakyBlobStore struct {
+	distribution.BlobStore
+	failed bool
+}
+
+func (fbs *flakyBlobStore) Open(ctx context.Context, dgst digest.Digest) (distribution.ReadSeekCloser, error) {
+	rsc, err := fbs.BlobStore.Open(ctx, dgst)
+	if err != nil || fbs.failed {
+		return rsc, err
+	}
+	fbs.failed = true
+
+	desc, err := fbs.BlobStore.Stat(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	return &failingReader{ReadSeekCloser: rsc, remaining: desc.Size / 2}, nil
+}
+
+type failingReader struct {
+	distribution.ReadSeekCloser
+	remaining int64
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if fr.remaining <= 0 {
+		return 0, errors.New("connection reset by peer")
+	}
+	if int64(len(p)) > fr.remaining {
+		p = p[:fr.remaining]
+	}
+	n, err := fr.ReadSeekCloser.Read(p)
+	fr.remaining -= int64(n)
+	return n, err
+}
+
+func TestProxyStoreResume(t *testing.T) {
+	te := makeTestEnv(t, "foo/bar")
+	populate(t, te, 1, 1<<16, 1)
+
+	remote := &flakyBlobStore{BlobStore: te.store.remoteStore.(distribution.BlobStore)}
+	te.store.remoteStore = remote
+	te.store.retry = retryPolicy{maxAttempts: 2, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	var buf bytes.Buffer
+	desc, err := te.store.copyContent(te.ctx, te.inRemote[0].Digest, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error copying content: %v", err)
+	}
+	if !remote.failed {
+		t.Fatalf("expected the first read to fail")
+	}
+	if int64(buf.Len()) != desc.Size || digest.FromBytes(buf.Bytes()) != te.inRemote[0].Digest {
+		t.Fatalf("resumed content does not match the remote blob")
+	}
+
+	// Without retries the interrupted read fails the copy.
+	remote.failed = false
+	te.store.retry = retryPolicy{}
+	buf.Reset()
+	if _, err := te.store.copyContent(te.ctx, te.inRemote[0].Digest, &buf); err == nil {
+		t.Fatalf("expected error copying content without retries")
+	}
+}
+
 // todo(richardscothern): blobCount must be smaller than num clients
 func TestProxyStoreServeBig(t *testing.T) {
 	te := makeTestEnv(t, "foo/bar")
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/registry/pullstats"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// maxPullHints bounds the number of pull counts remembered between the
+	// response of the remote registry and the caching of its content.
+	maxPullHints = 10000
+
+	// maxTTLFactor bounds the extension of the time to live of popular
+	// content.
+	maxTTLFactor = 4
+)
+
+// pullHints remembers the pull counts the remote registry reports for the
+// content it serves, so that popular content is kept longer in the cache.
+type pullHints struct {
+	mu     sync.Mutex
+	counts map[digest.Digest]int64
+}
+
+func newPullHints() *pullHints {
+	return &pullHints{counts: make(map[digest.Digest]int64)}
+}
+
+// record remembers the pull count reported by a response of the remote
+// registry, if any.
+func (h *pullHints) record(resp *http.Response) {
+	pulls, err := strconv.ParseInt(resp.Header.Get(pullstats.CountHeader), 10, 64)
+	if err != nil || pulls < 0 {
+		return
+	}
+	dgst, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		// redirected blob requests may not report the digest
+		if dgst, err = digest.Parse(path.Base(resp.Request.URL.Path)); err != nil {
+			return
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.counts[dgst]; !ok && len(h.counts) >= maxPullHints {
+		for evicted := range h.counts {
+			delete(h.counts, evicted)
+			break
+		}
+	}
+	h.counts[dgst] = pulls
+}
+
+// ttl returns the time to live of dgst in the cache, and forgets its pull
+// count. Content pulled from the remote registry at least ten times is kept
+// twice as long as other content, a hundred times three times as long, and
+// so on up to maxTTLFactor.
+func (h *pullHints) ttl(dgst digest.Digest) time.Duration {
+	if h == nil {
+		return repositoryTTL
+	}
+	h.mu.Lock()
+	pulls, ok := h.counts[dgst]
+	delete(h.counts, dgst)
+	h.mu.Unlock()
+	if !ok {
+		return repositoryTTL
+	}
+
+	factor := 1
+	for threshold := int64(10); pulls >= threshold && factor < maxTTLFactor; threshold *= 10 {
+		factor++
+	}
+	return time.Duration(factor) * repositoryTTL
+}
+
+// pullHintTransport is an http.RoundTripper recording the pull counts
+// reported by the remote registry.
+type pullHintTransport struct {
+	base  http.RoundTripper
+	hints *pullHints
+}
+
+func (t *pullHintTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.hints.record(resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/pullstats"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestPullHints(t *testing.T) {
+	hints := newPullHints()
+	counts := map[digest.Digest]string{
+		digest.FromString("never"):   "0",
+		digest.FromString("some"):    "10",
+		digest.FromString("many"):    "999",
+		digest.FromString("popular"): "1000000",
+		digest.FromString("invalid"): "lots",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dgst := digest.Digest(r.URL.Query().Get("digest"))
+		if r.URL.Query().Get("redirected") == "" {
+			w.Header().Set("Docker-Content-Digest", dgst.String())
+		}
+		w.Header().Set(pullstats.CountHeader, counts[dgst])
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &pullHintTransport{base: http.DefaultTransport, hints: hints}}
+	for dgst := range counts {
+		resp, err := client.Get(server.URL + "/v2/foo/blobs/x?digest=" + dgst.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// responses without digest are matched by the path of the request
+	redirected := digest.FromString("redirected")
+	counts[redirected] = "50"
+	resp, err := client.Get(server.URL + "/v2/foo/blobs/" + redirected.String() + "?redirected=1&digest=" + redirected.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for _, tc := range []struct {
+		content string
+		ttl     time.Duration
+	}{
+		{"never", repositoryTTL},
+		{"some", 2 * repositoryTTL},
+		{"many", 3 * repositoryTTL},
+		{"popular", maxTTLFactor * repositoryTTL},
+		{"invalid", repositoryTTL},
+		{"unknown", repositoryTTL},
+		{"redirected", 2 * repositoryTTL},
+	} {
+		if ttl := hints.ttl(digest.FromString(tc.content)); ttl != tc.ttl {
+			t.Errorf("unexpected ttl of %s content: %s, expected %s", tc.content, ttl, tc.ttl)
+		}
+	}
+
+	// hints are forgotten once used
+	if ttl := hints.ttl(digest.FromString("popular")); ttl != repositoryTTL {
+		t.Fatalf("expected the hint to be forgotten, got a ttl of %s", ttl)
+	}
+	var none *pullHints
+	if ttl := none.ttl(redirected); ttl != repositoryTTL {
+		t.Fatalf("unexpected ttl without hints: %s", ttl)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/proxy/scheduler"
 	"github.com/opencontainers/go-digest"
@@ -20,7 +21,13 @@ type proxyManifestStore struct {
 	remoteManifests distribution.ManifestService
 	repositoryName  reference.Named
 	scheduler       *scheduler.TTLExpirationScheduler
+	hints           *pullHints
 	authChallenger  authChallenger
+
+	// platforms whose manifests and blobs are prefetched when a manifest
+	// list is fetched, through blobs
+	platforms platforms
+	blobs     *proxyBlobStore
 }
 
 var _ distribution.ManifestService = &proxyManifestStore{}
@@ -61,26 +68,39 @@ func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, optio
 		return nil, err
 	}
 
+	repoBlob, err := reference.WithDigest(pms.repositoryName, dgst)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("Error creating reference: %s", err)
+		return nil, err
+	}
+
+	// Report the cache status on the response, if serving a request.
+	if w, err := dcontext.GetResponseWriter(ctx); err == nil {
+		setCacheHeaders(w, !fromRemote, pms.scheduler, repoBlob)
+	}
+
 	proxyMetrics.ManifestPush(uint64(len(payload)))
-	if fromRemote {
+	if !fromRemote {
+		cacheEvent("manifest", pms.repositoryName, cacheHit)
+	} else {
+		cacheEvent("manifest", pms.repositoryName, cacheMiss)
 		proxyMetrics.ManifestPull(uint64(len(payload)))
 
 		_, err = pms.localManifests.Put(ctx, manifest)
 		if err != nil {
 			return nil, err
 		}
+		cacheEvent("manifest", pms.repositoryName, cacheInsert)
 
 		// Schedule the manifest blob for removal
-		repoBlob, err := reference.WithDigest(pms.repositoryName, dgst)
-		if err != nil {
-			dcontext.GetLogger(ctx).Errorf("Error creating reference: %s", err)
-			return nil, err
-		}
-
-		pms.scheduler.AddManifest(repoBlob, repositoryTTL)
+		pms.scheduler.AddManifest(repoBlob, pms.hints.ttl(dgst))
 		// Ensure the manifest blob is cleaned up
 		//pms.scheduler.AddBlob(blobRef, repositoryTTL)
 
+		if list, ok := manifest.(*manifestlist.DeserializedManifestList); ok && len(pms.platforms) > 0 {
+			go pms.prefetch(ctx, list)
+		}
+
 	}
 
 	return manifest, err
@@ -2,9 +2,28 @@ package proxy
 
 import (
 	"expvar"
+	"net/http"
+	"strconv"
 	"sync/atomic"
+	"time"
+
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/go-metrics"
+)
+
+const (
+	cacheHit    = "hit"
+	cacheMiss   = "miss"
+	cacheInsert = "insert"
+	cacheEvict  = "evict"
 )
 
+// cacheEvents counts hits, misses, insertions and evictions of the cache by
+// content type and repository.
+var cacheEvents = prometheus.ProxyNamespace.NewLabeledCounter("cache_events", "The number of proxy cache events", "type", "repository", "event")
+
 // Metrics is used to hold metric counters
 // related to the proxy
 type Metrics struct {
@@ -46,11 +65,45 @@ func (pmc *proxyMetricsCollector) ManifestPush(bytesPushed uint64) {
 	atomic.AddUint64(&pmc.manifestMetrics.BytesPushed, bytesPushed)
 }
 
+// cacheEvent records a cache event for content of the given type, "blob" or
+// "manifest", in the named repository.
+func cacheEvent(contentType string, repo reference.Named, event string) {
+	cacheEvents.WithValues(contentType, repo.Name(), event).Inc(1)
+}
+
+// setCacheHeaders reports on a response whether content was served from the
+// cache and, for hits, how long ago it was cached. The age is derived from
+// the expiry and time to live scheduled for the content when it was cached.
+func setCacheHeaders(w http.ResponseWriter, hit bool, s *scheduler.TTLExpirationScheduler, ref reference.Canonical) {
+	if !hit {
+		w.Header().Set("X-Cache", "MISS")
+		return
+	}
+
+	w.Header().Set("X-Cache", "HIT")
+	if s == nil {
+		return
+	}
+	if entry, ok := s.Entry(ref); ok {
+		ttl := entry.TTL
+		if ttl == 0 {
+			ttl = repositoryTTL
+		}
+		age := ttl - time.Until(entry.Expiry)
+		if age < 0 {
+			age = 0
+		}
+		w.Header().Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	}
+}
+
 // proxyMetrics tracks metrics about the proxy cache.  This is
 // kept globally and made available via expvar.
 var proxyMetrics = &proxyMetricsCollector{}
 
 func init() {
+	metrics.Register(prometheus.ProxyNamespace)
+
 	registry := expvar.Get("registry")
 	if registry == nil {
 		registry = expvar.NewMap("registry")
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// namespaceMapping maps the repositories under a local namespace to those
+// under a namespace of the remote registry.
+type namespaceMapping struct {
+	local  string
+	remote string
+}
+
+// namespaceMappings rewrites local repository names into the names of the
+// remote repositories they mirror. Content is stored locally under the local
+// name, unchanged, so that manifest digests are preserved.
+type namespaceMappings struct {
+	mappings      []namespaceMapping
+	nameValidator *reference.NameValidator
+}
+
+func newNamespaceMappings(config []configuration.ProxyNamespace, nameValidator *reference.NameValidator) (namespaceMappings, error) {
+	m := namespaceMappings{nameValidator: nameValidator}
+	for _, ns := range config {
+		for _, name := range []string{ns.Local, ns.Remote} {
+			if _, err := nameValidator.WithName(name); err != nil {
+				return namespaceMappings{}, fmt.Errorf("invalid proxy namespace %q: %v", name, err)
+			}
+		}
+		m.mappings = append(m.mappings, namespaceMapping{local: ns.Local, remote: ns.Remote})
+	}
+	return m, nil
+}
+
+// remoteName returns the name of the remote repository mirrored by the named
+// local repository.
+func (m namespaceMappings) remoteName(name reference.Named) (reference.Named, error) {
+	for _, mapping := range m.mappings {
+		switch {
+		case name.Name() == mapping.local:
+			return m.nameValidator.WithName(mapping.remote)
+		case strings.HasPrefix(name.Name(), mapping.local+"/"):
+			return m.nameValidator.WithName(mapping.remote + strings.TrimPrefix(name.Name(), mapping.local))
+		}
+	}
+	return name, nil
+}
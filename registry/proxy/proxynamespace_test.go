@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+func TestNamespaceMappings(t *testing.T) {
+	mappings, err := newNamespaceMappings([]configuration.ProxyNamespace{
+		{Local: "mirror", Remote: "library"},
+		{Local: "team/tools", Remote: "upstream/tools"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for local, remote := range map[string]string{
+		"mirror/nginx":       "library/nginx",
+		"mirror/nginx/extra": "library/nginx/extra",
+		"mirror":             "library",
+		"mirrored/nginx":     "mirrored/nginx",
+		"team/tools/linter":  "upstream/tools/linter",
+		"team/other":         "team/other",
+		"library/nginx":      "library/nginx",
+	} {
+		name, _ := reference.WithName(local)
+		mapped, err := mappings.remoteName(name)
+		if err != nil {
+			t.Fatalf("unexpected error mapping %s: %v", local, err)
+		}
+		if mapped.Name() != remote {
+			t.Errorf("unexpected remote name for %s: %s != %s", local, mapped.Name(), remote)
+		}
+	}
+
+	if _, err := newNamespaceMappings([]configuration.ProxyNamespace{{Local: "Mirror", Remote: "library"}}, nil); err == nil {
+		t.Fatalf("expected error for invalid namespace")
+	}
+
+	// names are checked against the configured constraints
+	validator, err := reference.NewNameValidator(0, 0, "[A-Za-z0-9]+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings, err = newNamespaceMappings([]configuration.ProxyNamespace{{Local: "Mirror", Remote: "library"}}, validator)
+	if err != nil {
+		t.Fatalf("unexpected error with a validator allowing uppercase: %v", err)
+	}
+	name, _ := validator.WithName("Mirror/Nginx")
+	if mapped, err := mappings.remoteName(name); err != nil || mapped.Name() != "library/Nginx" {
+		t.Fatalf("unexpected remote name %v: %v", mapped, err)
+	}
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// platform identifies the manifests of a manifest list to prefetch. An empty
+// variant matches any variant.
+type platform struct {
+	os           string
+	architecture string
+	variant      string
+}
+
+// platforms is the set of platforms whose manifests and blobs are cached in
+// the background when a manifest list is fetched from the remote registry.
+type platforms []platform
+
+func newPlatforms(config []string) (platforms, error) {
+	var ps platforms
+	for _, p := range config {
+		parts := strings.Split(p, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid prefetch platform %q: expected os/architecture[/variant]", p)
+		}
+		pl := platform{os: parts[0], architecture: parts[1]}
+		if len(parts) == 3 {
+			pl.variant = parts[2]
+		}
+		ps = append(ps, pl)
+	}
+	return ps, nil
+}
+
+// match reports whether the platform of a manifest list entry is one of ps.
+func (ps platforms) match(spec manifestlist.PlatformSpec) bool {
+	for _, p := range ps {
+		if p.os == spec.OS && p.architecture == spec.Architecture &&
+			(p.variant == "" || p.variant == spec.Variant) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefetch caches the manifests of the list matching the configured
+// platforms, and the blobs they reference. It outlives the request which
+// fetched the list, so it runs with a context of its own.
+func (pms proxyManifestStore) prefetch(ctx context.Context, list *manifestlist.DeserializedManifestList) {
+	ctx = dcontext.WithLogger(dcontext.Background(), dcontext.GetLogger(ctx))
+
+	for _, desc := range list.Manifests {
+		if !pms.platforms.match(desc.Platform) {
+			continue
+		}
+
+		manifest, err := pms.Get(ctx, desc.Digest)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("Error prefetching manifest %s@%s: %s", pms.repositoryName, desc.Digest, err)
+			continue
+		}
+		for _, ref := range manifest.References() {
+			if err := pms.blobs.prefetch(ctx, ref.Digest); err != nil {
+				dcontext.GetLogger(ctx).Errorf("Error prefetching blob %s@%s: %s", pms.repositoryName, ref.Digest, err)
+			}
+		}
+	}
+}
+
+// prefetch caches a blob unless it is cached already or being fetched.
+func (pbs *proxyBlobStore) prefetch(ctx context.Context, dgst digest.Digest) error {
+	if _, err := pbs.localStore.Stat(ctx, dgst); err == nil {
+		return nil
+	}
+
+	mu.Lock()
+	if _, ok := inflight[dgst]; ok {
+		mu.Unlock()
+		return nil
+	}
+	inflight[dgst] = struct{}{}
+	mu.Unlock()
+
+	if err := pbs.storeLocal(ctx, dgst); err != nil {
+		return err
+	}
+
+	blobRef, err := reference.WithDigest(pbs.repositoryName, dgst)
+	if err != nil {
+		return err
+	}
+	return pbs.scheduler.AddBlob(blobRef, pbs.hints.ttl(dgst))
+}
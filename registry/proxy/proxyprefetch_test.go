@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestNewPlatforms(t *testing.T) {
+	ps, err := newPlatforms([]string{"linux/amd64", "linux/arm/v7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		spec  manifestlist.PlatformSpec
+		match bool
+	}{
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}, true},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64", Variant: "v3"}, true},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v7"}, true},
+		{manifestlist.PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v6"}, false},
+		{manifestlist.PlatformSpec{OS: "windows", Architecture: "amd64"}, false},
+	} {
+		if got := ps.match(tc.spec); got != tc.match {
+			t.Errorf("match(%+v) = %v, expected %v", tc.spec, got, tc.match)
+		}
+	}
+
+	for _, invalid := range []string{"linux", "linux/", "/amd64", "linux/arm/v7/extra"} {
+		if _, err := newPlatforms([]string{invalid}); err == nil {
+			t.Errorf("expected error for platform %q", invalid)
+		}
+	}
+}
+
+func TestProxyManifestsPrefetch(t *testing.T) {
+	ctx := context.Background()
+	name, err := reference.WithName("foo/multiarch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRepo := func() distribution.Repository {
+		registry, err := storage.NewRegistry(ctx, inmemory.New(), storage.BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+		repo, err := registry.Repository(ctx, name)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+		return repo
+	}
+	truthRepo := newRepo()
+	localRepo := newRepo()
+
+	truthManifests, err := truthRepo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localManifests, err := localRepo.Manifests(ctx, storage.SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One image per architecture, each with its own layer
+	images := make(map[string]distribution.Manifest)
+	var descriptors []manifestlist.ManifestDescriptor
+	for _, arch := range []string{"amd64", "arm64"} {
+		layer, err := truthRepo.Blobs(ctx).Put(ctx, schema2.MediaTypeLayer, []byte("layer for "+arch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder := schema2.NewManifestBuilder(truthRepo.Blobs(ctx), schema2.MediaTypeImageConfig, []byte(`{"architecture":"`+arch+`"}`))
+		if err := builder.AppendReference(layer); err != nil {
+			t.Fatal(err)
+		}
+		image, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := truthManifests.Put(ctx, image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, payload, err := image.Payload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		images[arch] = image
+		descriptors = append(descriptors, manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{Digest: dgst, MediaType: mediaType, Size: int64(len(payload))},
+			Platform:   manifestlist.PlatformSpec{OS: "linux", Architecture: arch},
+		})
+	}
+	list, err := manifestlist.FromDescriptors(descriptors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listDigest, err := truthManifests.Put(ctx, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := scheduler.New(ctx, inmemory.New(), "/scheduler-state.json")
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	platforms, err := newPlatforms([]string{"linux/amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pms := proxyManifestStore{
+		ctx:             ctx,
+		localManifests:  localManifests,
+		remoteManifests: truthManifests,
+		scheduler:       s,
+		repositoryName:  name,
+		authChallenger:  &mockChallenger{},
+		platforms:       platforms,
+		blobs: &proxyBlobStore{
+			localStore:     localRepo.Blobs(ctx),
+			remoteStore:    truthRepo.Blobs(ctx),
+			scheduler:      s,
+			repositoryName: name,
+			authChallenger: &mockChallenger{},
+		},
+	}
+
+	if _, err := pms.Get(ctx, listDigest); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := func(arch int) bool {
+		if exists, err := localManifests.Exists(ctx, descriptors[arch].Digest); err != nil || !exists {
+			return false
+		}
+		for _, desc := range images[descriptors[arch].Platform.Architecture].References() {
+			if _, err := localRepo.Blobs(ctx).Stat(ctx, desc.Digest); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cached(0) {
+		if time.Now().After(deadline) {
+			t.Fatalf("linux/amd64 image was not prefetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if exists, err := localManifests.Exists(ctx, descriptors[1].Digest); err != nil || exists {
+		t.Errorf("linux/arm64 manifest was prefetched")
+	}
+	for _, desc := range images["arm64"].References() {
+		if _, err := localRepo.Blobs(ctx).Stat(ctx, desc.Digest); err == nil {
+			t.Errorf("linux/arm64 blob %s was prefetched", desc.Digest)
+		}
+	}
+}
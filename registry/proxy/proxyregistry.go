@@ -18,6 +18,7 @@ import (
 	"github.com/docker/distribution/registry/proxy/scheduler"
 	"github.com/docker/distribution/registry/storage"
 	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
 )
 
 // proxyingRegistry fetches content from a remote registry and caches it locally
@@ -26,17 +27,38 @@ type proxyingRegistry struct {
 	scheduler      *scheduler.TTLExpirationScheduler
 	remoteURL      url.URL
 	authChallenger authChallenger
+	retry          retryPolicy
+	upstream       http.RoundTripper // transport to the remote registry
+	hints          *pullHints        // pull counts reported by the remote registry
+	namespaces     namespaceMappings
+	platforms      platforms // prefetched for manifest lists
 }
 
 // NewRegistryPullThroughCache creates a registry acting as a pull through cache
-func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver, config configuration.Proxy) (distribution.Namespace, error) {
+// expiring cached content after its TTL. If store is nil, the scheduler
+// state is kept in a single file in the storage. Mapped repository names are
+// checked by nameValidator, or by the default constraints if it is nil.
+func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver, store scheduler.Store, config configuration.Proxy, nameValidator *reference.NameValidator) (distribution.Namespace, error) {
 	remoteURL, err := url.Parse(config.RemoteURL)
 	if err != nil {
 		return nil, err
 	}
 
+	namespaces, err := newNamespaceMappings(config.Namespaces, nameValidator)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms, err := newPlatforms(config.Prefetch.Platforms)
+	if err != nil {
+		return nil, err
+	}
+
 	v := storage.NewVacuum(ctx, driver)
-	s := scheduler.New(ctx, driver, "/scheduler-state.json")
+	if store == nil {
+		store = scheduler.NewFileStore(driver, "/scheduler-state.json")
+	}
+	s := scheduler.NewWithStore(ctx, store, config.Scheduler.LeaseDuration)
 	s.OnBlobExpire(func(ref reference.Reference) error {
 		var r reference.Canonical
 		var ok bool
@@ -62,6 +84,7 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 			return err
 		}
 
+		cacheEvent("blob", r, cacheEvict)
 		return nil
 	})
 
@@ -85,6 +108,8 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 		if err != nil {
 			return err
 		}
+
+		cacheEvent("manifest", r, cacheEvict)
 		return nil
 	})
 
@@ -93,11 +118,14 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 		return nil, err
 	}
 
-	cs, err := configureAuth(config.Username, config.Password, config.RemoteURL)
+	cs, err := configureAuth(config)
 	if err != nil {
 		return nil, err
 	}
 
+	retry := newRetryPolicy(config.Retry)
+	hints := newPullHints()
+
 	return &proxyingRegistry{
 		embedded:  registry,
 		scheduler: s,
@@ -107,6 +135,11 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 			cm:        challenge.NewSimpleManager(),
 			cs:        cs,
 		},
+		retry:      retry,
+		upstream:   &pullHintTransport{base: newRetryTransport(http.DefaultTransport, retry), hints: hints},
+		hints:      hints,
+		namespaces: namespaces,
+		platforms:  platforms,
 	}, nil
 }
 
@@ -121,19 +154,24 @@ func (pr *proxyingRegistry) Repositories(ctx context.Context, repos []string, la
 func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
 	c := pr.authChallenger
 
+	remoteName, err := pr.namespaces.remoteName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	tkopts := auth.TokenHandlerOptions{
-		Transport:   http.DefaultTransport,
+		Transport:   pr.upstream,
 		Credentials: c.credentialStore(),
 		Scopes: []auth.Scope{
 			auth.RepositoryScope{
-				Repository: name.Name(),
+				Repository: remoteName.Name(),
 				Actions:    []string{"pull"},
 			},
 		},
 		Logger: dcontext.GetLogger(ctx),
 	}
 
-	tr := transport.NewTransport(http.DefaultTransport,
+	tr := transport.NewTransport(pr.upstream,
 		auth.NewAuthorizer(c.challengeManager(),
 			auth.NewTokenHandlerWithOptions(tkopts)))
 
@@ -146,7 +184,7 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 		return nil, err
 	}
 
-	remoteRepo, err := client.NewRepository(name, pr.remoteURL.String(), tr)
+	remoteRepo, err := client.NewRepository(remoteName, pr.remoteURL.String(), tr)
 	if err != nil {
 		return nil, err
 	}
@@ -156,21 +194,28 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 		return nil, err
 	}
 
+	blobStore := &proxyBlobStore{
+		localStore:     localRepo.Blobs(ctx),
+		remoteStore:    remoteRepo.Blobs(ctx),
+		scheduler:      pr.scheduler,
+		hints:          pr.hints,
+		repositoryName: name,
+		authChallenger: pr.authChallenger,
+		retry:          pr.retry,
+	}
+
 	return &proxiedRepository{
-		blobStore: &proxyBlobStore{
-			localStore:     localRepo.Blobs(ctx),
-			remoteStore:    remoteRepo.Blobs(ctx),
-			scheduler:      pr.scheduler,
-			repositoryName: name,
-			authChallenger: pr.authChallenger,
-		},
+		blobStore: blobStore,
 		manifests: &proxyManifestStore{
 			repositoryName:  name,
 			localManifests:  localManifests, // Options?
 			remoteManifests: remoteManifests,
 			ctx:             ctx,
 			scheduler:       pr.scheduler,
+			hints:           pr.hints,
 			authChallenger:  pr.authChallenger,
+			platforms:       pr.platforms,
+			blobs:           blobStore,
 		},
 		name: name,
 		tags: &proxyTagService{
@@ -189,6 +234,16 @@ func (pr *proxyingRegistry) BlobStatter() distribution.BlobStatter {
 	return pr.embedded.BlobStatter()
 }
 
+// ForeignBlob resolves the foreign layers of the manifests cached locally, so
+// that their data is never fetched from the remote.
+func (pr *proxyingRegistry) ForeignBlob(ctx context.Context, name reference.Named, dgst digest.Digest) (distribution.Descriptor, error) {
+	index, ok := pr.embedded.(distribution.ForeignBlobIndex)
+	if !ok {
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	}
+	return index.ForeignBlob(ctx, name, dgst)
+}
+
 // authChallenger encapsulates a request to the upstream to establish credential challenges
 type authChallenger interface {
 	tryEstablishChallenges(context.Context) error
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+)
+
+const (
+	defaultRetryMaxAttempts    = 5
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 30 * time.Second
+)
+
+// retryPolicy describes how often and how long to wait before retrying a
+// failed request to the remote registry. The zero value disables retries.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(config configuration.ProxyRetry) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:    config.MaxAttempts,
+		initialBackoff: config.InitialBackoff,
+		maxBackoff:     config.MaxBackoff,
+	}
+	if policy.maxAttempts <= 0 {
+		policy.maxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultRetryMaxBackoff
+	}
+	return policy
+}
+
+// backoff returns the wait before the given retry, counting from one.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	backoff := p.initialBackoff
+	for i := 1; i < retry && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+	return backoff
+}
+
+// wait sleeps for d, returning early with an error if ctx is done.
+func (p retryPolicy) wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryTransport is an http.RoundTripper retrying idempotent requests to the
+// remote registry which fail with a connection error or a status indicating
+// a transient condition, such as rate limiting.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy retryPolicy
+}
+
+func newRetryTransport(base http.RoundTripper, policy retryPolicy) http.RoundTripper {
+	return &retryTransport{
+		base:   base,
+		policy: policy,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.policy.maxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		backoff := t.policy.backoff(attempt)
+		if err == nil {
+			if !retryableStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > t.policy.maxBackoff {
+					// Waiting that long would stall the client; let it
+					// see the upstream response instead.
+					return resp, nil
+				}
+				backoff = retryAfter
+			}
+			resp.Body.Close()
+			dcontext.GetLogger(ctx).Warnf("upstream responded to %s %s with %s, retrying in %s", req.Method, req.URL, resp.Status, backoff)
+		} else {
+			dcontext.GetLogger(ctx).Warnf("upstream request %s %s failed, retrying in %s: %v", req.Method, req.URL, backoff, err)
+		}
+
+		if err := t.policy.wait(ctx, backoff); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryableStatus reports whether a response status from the remote registry
+// indicates a condition which may clear up by itself.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses the value of a Retry-After header, given either in
+// seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if date.Before(now) {
+			return 0, true
+		}
+		return date.Sub(now), true
+	}
+	return 0, false
+}
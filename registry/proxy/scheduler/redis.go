@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/docker/distribution/registry/coordination"
+	"github.com/garyburd/redigo/redis"
+)
+
+// redisStore keeps entries in a redis hash, keyed by reference, and the
+// lease in a redis key expiring with it.
+type redisStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisStore returns a Store keeping entries in redis, below keys
+// starting with prefix. It may be shared between registry instances.
+func NewRedisStore(pool *redis.Pool, prefix string) Store {
+	return &redisStore{
+		pool:   pool,
+		prefix: prefix,
+	}
+}
+
+func (rs *redisStore) entriesKey() string {
+	return rs.prefix + "entries"
+}
+
+func (rs *redisStore) leaseKey() string {
+	return rs.prefix + "lease"
+}
+
+func (rs *redisStore) Load(ctx context.Context) (map[string]*Entry, error) {
+	conn := rs.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.StringMap(conn.Do("HGETALL", rs.entriesKey()))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*Entry, len(values))
+	for key, value := range values {
+		var entry Entry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			return nil, err
+		}
+		entries[key] = &entry
+	}
+	return entries, nil
+}
+
+func (rs *redisStore) Put(ctx context.Context, entry *Entry) error {
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	conn := rs.pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("HSET", rs.entriesKey(), entry.Key, jsonBytes)
+	return err
+}
+
+func (rs *redisStore) Delete(ctx context.Context, key string) error {
+	conn := rs.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HDEL", rs.entriesKey(), key)
+	return err
+}
+
+func (rs *redisStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (rs *redisStore) AcquireLease(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return coordination.NewRedisLease(rs.pool, rs.leaseKey()).Acquire(ctx, owner, ttl)
+}
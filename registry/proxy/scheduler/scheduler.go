@@ -2,7 +2,6 @@ package scheduler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -10,6 +9,7 @@ import (
 	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
 )
 
 // onTTLExpiryFunc is called when a repository's TTL expires
@@ -19,28 +19,51 @@ const (
 	entryTypeBlob = iota
 	entryTypeManifest
 	indexSaveFrequency = 5 * time.Second
+
+	defaultLeaseDuration = 30 * time.Second
 )
 
-// schedulerEntry represents an entry in the scheduler
+// Entry represents an entry in the scheduler
 // fields are exported for serialization
-type schedulerEntry struct {
+type Entry struct {
 	Key       string    `json:"Key"`
 	Expiry    time.Time `json:"ExpiryData"`
 	EntryType int       `json:"EntryType"`
 
+	// TTL is the time to live the entry was added with. It is zero for
+	// entries saved before it was recorded.
+	TTL time.Duration `json:"TTL,omitempty"`
+
 	timer *time.Timer
+
+	// deferred is set when the entry expired while another instance held
+	// the lease.
+	deferred bool
 }
 
-// New returns a new instance of the scheduler
+// New returns a new instance of the scheduler keeping its state in the JSON
+// file at path
 func New(ctx context.Context, driver driver.StorageDriver, path string) *TTLExpirationScheduler {
+	return NewWithStore(ctx, NewFileStore(driver, path), 0)
+}
+
+// NewWithStore returns a new instance of the scheduler keeping its state in
+// store. If store is shared between registry instances, leaseDuration is
+// how long an instance keeps running expiry callbacks after last renewing
+// its lease; it defaults to 30 seconds.
+func NewWithStore(ctx context.Context, store Store, leaseDuration time.Duration) *TTLExpirationScheduler {
+	if leaseDuration <= 0 {
+		leaseDuration = defaultLeaseDuration
+	}
 	return &TTLExpirationScheduler{
-		entries:         make(map[string]*schedulerEntry),
-		driver:          driver,
-		pathToStateFile: path,
-		ctx:             ctx,
-		stopped:         true,
-		doneChan:        make(chan struct{}),
-		saveTimer:       time.NewTicker(indexSaveFrequency),
+		entries:       make(map[string]*Entry),
+		store:         store,
+		owner:         uuid.Generate().String(),
+		leaseDuration: leaseDuration,
+		ctx:           ctx,
+		stopped:       true,
+		doneChan:      make(chan struct{}),
+		saveTimer:     time.NewTicker(indexSaveFrequency),
 	}
 }
 
@@ -49,20 +72,21 @@ func New(ctx context.Context, driver driver.StorageDriver, path string) *TTLExpi
 type TTLExpirationScheduler struct {
 	sync.Mutex
 
-	entries map[string]*schedulerEntry
+	entries map[string]*Entry
 
-	driver          driver.StorageDriver
-	ctx             context.Context
-	pathToStateFile string
+	store         Store
+	owner         string
+	leaseDuration time.Duration
+	lastSync      time.Time
+	ctx           context.Context
 
 	stopped bool
 
 	onBlobExpire     expiryFunc
 	onManifestExpire expiryFunc
 
-	indexDirty bool
-	saveTimer  *time.Ticker
-	doneChan   chan struct{}
+	saveTimer *time.Ticker
+	doneChan  chan struct{}
 }
 
 // OnBlobExpire is called when a scheduled blob's TTL expires
@@ -90,8 +114,7 @@ func (ttles *TTLExpirationScheduler) AddBlob(blobRef reference.Canonical, ttl ti
 		return fmt.Errorf("scheduler not started")
 	}
 
-	ttles.add(blobRef, ttl, entryTypeBlob)
-	return nil
+	return ttles.add(blobRef, ttl, entryTypeBlob)
 }
 
 // AddManifest schedules a manifest cleanup after ttl expires
@@ -103,24 +126,56 @@ func (ttles *TTLExpirationScheduler) AddManifest(manifestRef reference.Canonical
 		return fmt.Errorf("scheduler not started")
 	}
 
-	ttles.add(manifestRef, ttl, entryTypeManifest)
-	return nil
+	return ttles.add(manifestRef, ttl, entryTypeManifest)
 }
 
-// Start starts the scheduler
-func (ttles *TTLExpirationScheduler) Start() error {
+// Expiry returns the time the entry for the given reference expires, and
+// false if there is no such entry.
+func (ttles *TTLExpirationScheduler) Expiry(ref reference.Reference) (time.Time, bool) {
 	ttles.Lock()
 	defer ttles.Unlock()
 
-	err := ttles.readState()
-	if err != nil {
-		return err
+	entry, ok := ttles.entries[ref.String()]
+	if !ok {
+		return time.Time{}, false
+	}
+	return entry.Expiry, true
+}
+
+// Entry returns a copy of the entry for the given reference, and false if
+// there is no such entry.
+func (ttles *TTLExpirationScheduler) Entry(ref reference.Reference) (Entry, bool) {
+	ttles.Lock()
+	defer ttles.Unlock()
+
+	entry, ok := ttles.entries[ref.String()]
+	if !ok {
+		return Entry{}, false
 	}
+	return Entry{
+		Key:       entry.Key,
+		Expiry:    entry.Expiry,
+		EntryType: entry.EntryType,
+		TTL:       entry.TTL,
+	}, true
+}
+
+// Start starts the scheduler
+func (ttles *TTLExpirationScheduler) Start() error {
+	ttles.Lock()
+	defer ttles.Unlock()
 
 	if !ttles.stopped {
 		return fmt.Errorf("scheduler already started")
 	}
 
+	entries, err := ttles.store.Load(ttles.ctx)
+	if err != nil {
+		return err
+	}
+	ttles.entries = entries
+	ttles.lastSync = time.Now()
+
 	dcontext.GetLogger(ttles.ctx).Infof("Starting cached object TTL expiration scheduler...")
 	ttles.stopped = false
 
@@ -129,23 +184,21 @@ func (ttles *TTLExpirationScheduler) Start() error {
 		entry.timer = ttles.startTimer(entry, time.Until(entry.Expiry))
 	}
 
-	// Start a ticker to periodically save the entries index
+	// Start a ticker to periodically save the entries index and, if the
+	// store is shared, pick up entries added by other instances
 
 	go func() {
 		for {
 			select {
 			case <-ttles.saveTimer.C:
 				ttles.Lock()
-				if !ttles.indexDirty {
-					ttles.Unlock()
-					continue
-				}
-
-				err := ttles.writeState()
-				if err != nil {
+				if err := ttles.store.Flush(ttles.ctx); err != nil {
 					dcontext.GetLogger(ttles.ctx).Errorf("Error writing scheduler state: %s", err)
-				} else {
-					ttles.indexDirty = false
+				}
+				if _, ok := ttles.store.(Leaser); ok && time.Since(ttles.lastSync) >= ttles.leaseDuration {
+					if err := ttles.sync(); err != nil {
+						dcontext.GetLogger(ttles.ctx).Errorf("Error reading scheduler state: %s", err)
+					}
 				}
 				ttles.Unlock()
 
@@ -158,11 +211,37 @@ func (ttles *TTLExpirationScheduler) Start() error {
 	return nil
 }
 
-func (ttles *TTLExpirationScheduler) add(r reference.Reference, ttl time.Duration, eType int) {
-	entry := &schedulerEntry{
+// sync replaces the entries with those in the store, restarting the timers
+// of entries which were added or changed by other instances.
+func (ttles *TTLExpirationScheduler) sync() error {
+	entries, err := ttles.store.Load(ttles.ctx)
+	if err != nil {
+		return err
+	}
+	ttles.lastSync = time.Now()
+
+	for key, entry := range ttles.entries {
+		if stored, ok := entries[key]; ok && stored.Expiry.Equal(entry.Expiry) {
+			entries[key] = entry
+			continue
+		}
+		entry.timer.Stop()
+	}
+	for _, entry := range entries {
+		if entry.timer == nil {
+			entry.timer = ttles.startTimer(entry, time.Until(entry.Expiry))
+		}
+	}
+	ttles.entries = entries
+	return nil
+}
+
+func (ttles *TTLExpirationScheduler) add(r reference.Reference, ttl time.Duration, eType int) error {
+	entry := &Entry{
 		Key:       r.String(),
 		Expiry:    time.Now().Add(ttl),
 		EntryType: eType,
+		TTL:       ttl,
 	}
 	dcontext.GetLogger(ttles.ctx).Infof("Adding new scheduler entry for %s with ttl=%s", entry.Key, time.Until(entry.Expiry))
 	if oldEntry, present := ttles.entries[entry.Key]; present && oldEntry.timer != nil {
@@ -170,14 +249,43 @@ func (ttles *TTLExpirationScheduler) add(r reference.Reference, ttl time.Duratio
 	}
 	ttles.entries[entry.Key] = entry
 	entry.timer = ttles.startTimer(entry, ttl)
-	ttles.indexDirty = true
+	return ttles.store.Put(ttles.ctx, entry)
 }
 
-func (ttles *TTLExpirationScheduler) startTimer(entry *schedulerEntry, ttl time.Duration) *time.Timer {
+func (ttles *TTLExpirationScheduler) startTimer(entry *Entry, ttl time.Duration) *time.Timer {
 	return time.AfterFunc(ttl, func() {
 		ttles.Lock()
 		defer ttles.Unlock()
 
+		if ttles.entries[entry.Key] != entry {
+			// replaced or removed while the timer fired
+			return
+		}
+
+		if leaser, ok := ttles.store.(Leaser); ok {
+			held, err := leaser.AcquireLease(ttles.ctx, ttles.owner, ttles.leaseDuration)
+			if err != nil {
+				dcontext.GetLogger(ttles.ctx).Errorf("Error acquiring scheduler lease: %s", err)
+			}
+			if !held {
+				// Another instance expires the entry; check again once
+				// its lease may have lapsed.
+				entry.deferred = true
+				entry.timer = ttles.startTimer(entry, ttles.leaseDuration)
+				return
+			}
+			if entry.deferred {
+				// The previous lease holder may have expired the entry
+				// since it was last loaded.
+				if err := ttles.sync(); err != nil {
+					dcontext.GetLogger(ttles.ctx).Errorf("Error reading scheduler state: %s", err)
+				}
+				if ttles.entries[entry.Key] != entry {
+					return
+				}
+			}
+		}
+
 		var f expiryFunc
 
 		switch entry.EntryType {
@@ -201,7 +309,9 @@ func (ttles *TTLExpirationScheduler) startTimer(entry *schedulerEntry, ttl time.
 		}
 
 		delete(ttles.entries, entry.Key)
-		ttles.indexDirty = true
+		if err := ttles.store.Delete(ttles.ctx, entry.Key); err != nil {
+			dcontext.GetLogger(ttles.ctx).Errorf("Error removing scheduler entry %s: %s", entry.Key, err)
+		}
 	})
 }
 
@@ -210,7 +320,7 @@ func (ttles *TTLExpirationScheduler) Stop() {
 	ttles.Lock()
 	defer ttles.Unlock()
 
-	if err := ttles.writeState(); err != nil {
+	if err := ttles.store.Flush(ttles.ctx); err != nil {
 		dcontext.GetLogger(ttles.ctx).Errorf("Error writing scheduler state: %s", err)
 	}
 
@@ -222,39 +332,3 @@ func (ttles *TTLExpirationScheduler) Stop() {
 	ttles.saveTimer.Stop()
 	ttles.stopped = true
 }
-
-func (ttles *TTLExpirationScheduler) writeState() error {
-	jsonBytes, err := json.Marshal(ttles.entries)
-	if err != nil {
-		return err
-	}
-
-	err = ttles.driver.PutContent(ttles.ctx, ttles.pathToStateFile, jsonBytes)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (ttles *TTLExpirationScheduler) readState() error {
-	if _, err := ttles.driver.Stat(ttles.ctx, ttles.pathToStateFile); err != nil {
-		switch err := err.(type) {
-		case driver.PathNotFoundError:
-			return nil
-		default:
-			return err
-		}
-	}
-
-	bytes, err := ttles.driver.GetContent(ttles.ctx, ttles.pathToStateFile)
-	if err != nil {
-		return err
-	}
-
-	err = json.Unmarshal(bytes, &ttles.entries)
-	if err != nil {
-		return err
-	}
-	return nil
-}
@@ -108,7 +108,7 @@ func TestRestoreOld(t *testing.T) {
 	}
 
 	timeUnit := time.Millisecond
-	serialized, err := json.Marshal(&map[string]schedulerEntry{
+	serialized, err := json.Marshal(&map[string]Entry{
 		ref1.String(): {
 			Expiry:    time.Now().Add(10 * timeUnit),
 			Key:       ref1.String(),
@@ -209,3 +209,114 @@ func TestDoubleStart(t *testing.T) {
 		t.Fatalf("Scheduler started twice without error")
 	}
 }
+
+func TestSharedStore(t *testing.T) {
+	ref1, ref2, _ := testRefs(t)
+	ctx := context.Background()
+	timeUnit := time.Millisecond
+
+	store := NewEntryStore(inmemory.New(), "/scheduler")
+	for _, ref := range []reference.Reference{ref1, ref2} {
+		err := store.Put(ctx, &Entry{
+			Key:       ref.String(),
+			Expiry:    time.Now().Add(10 * timeUnit),
+			EntryType: entryTypeBlob,
+		})
+		if err != nil {
+			t.Fatalf("Error storing entry: %s", err)
+		}
+	}
+
+	// Another instance holds the lease
+	held, err := store.(Leaser).AcquireLease(ctx, "other", 200*timeUnit)
+	if err != nil || !held {
+		t.Fatalf("Unable to acquire lease: %v", err)
+	}
+
+	var mu sync.Mutex
+	expired := map[string]int{}
+	s := NewWithStore(ctx, store, 50*timeUnit)
+	s.OnBlobExpire(func(r reference.Reference) error {
+		mu.Lock()
+		defer mu.Unlock()
+		expired[r.String()]++
+		return nil
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting ttlExpirationScheduler: %s", err)
+	}
+	defer s.Stop()
+
+	<-time.After(50 * timeUnit)
+	mu.Lock()
+	if len(expired) != 0 {
+		t.Fatalf("Entries expired while another instance holds the lease: %#v", expired)
+	}
+	mu.Unlock()
+
+	// The other instance expires ref1, then its lease lapses
+	if err := store.Delete(ctx, ref1.String()); err != nil {
+		t.Fatalf("Error deleting entry: %s", err)
+	}
+	<-time.After(400 * timeUnit)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expired[ref1.String()] != 0 {
+		t.Errorf("Entry expired by another instance expired again")
+	}
+	if expired[ref2.String()] != 1 {
+		t.Errorf("Expected remaining entry to expire once, got %d", expired[ref2.String()])
+	}
+
+	entries, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Error loading entries: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Entries remaining in store: %#v", entries)
+	}
+}
+
+func TestSharedStoreSync(t *testing.T) {
+	ref1, _, _ := testRefs(t)
+	ctx := context.Background()
+
+	store := NewEntryStore(inmemory.New(), "/scheduler")
+	s := NewWithStore(ctx, store, 0)
+	expired := make(chan string, 1)
+	s.OnBlobExpire(func(r reference.Reference) error {
+		expired <- r.String()
+		return nil
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting ttlExpirationScheduler: %s", err)
+	}
+	defer s.Stop()
+
+	// Another instance adds an entry
+	err := store.Put(ctx, &Entry{
+		Key:       ref1.String(),
+		Expiry:    time.Now().Add(10 * time.Millisecond),
+		EntryType: entryTypeBlob,
+	})
+	if err != nil {
+		t.Fatalf("Error storing entry: %s", err)
+	}
+
+	s.Lock()
+	err = s.sync()
+	s.Unlock()
+	if err != nil {
+		t.Fatalf("Error syncing entries: %s", err)
+	}
+
+	select {
+	case key := <-expired:
+		if key != ref1.String() {
+			t.Fatalf("Unexpected entry expired: %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Entry added by another instance did not expire")
+	}
+}
@@ -0,0 +1,202 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/registry/coordination"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// Store persists the entries of a TTLExpirationScheduler, so that they
+// survive restarts.
+type Store interface {
+	// Load returns all persisted entries, keyed by reference.
+	Load(ctx context.Context) (map[string]*Entry, error)
+
+	// Put persists an entry, replacing any entry with the same key.
+	Put(ctx context.Context, entry *Entry) error
+
+	// Delete removes the entry with the given key. Deleting a missing
+	// entry is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// Flush persists changes which the store buffers.
+	Flush(ctx context.Context) error
+}
+
+// Leaser is implemented by stores which are shared by several registry
+// instances. Only the instance holding the lease runs expiry callbacks;
+// the others periodically reload the entries from the store and take over
+// once the lease lapses.
+type Leaser interface {
+	// AcquireLease acquires or renews the lease for owner, for ttl. It
+	// returns false if another owner holds the lease.
+	AcquireLease(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+}
+
+// fileStore keeps all entries in a single JSON file written through a
+// storage driver. Changes are buffered until Flush.
+type fileStore struct {
+	mu      sync.Mutex
+	driver  driver.StorageDriver
+	path    string
+	entries map[string]Entry
+	dirty   bool
+}
+
+// NewFileStore returns a Store keeping all entries in the JSON file at path.
+// It is not safe to share between registry instances.
+func NewFileStore(driver driver.StorageDriver, path string) Store {
+	return &fileStore{
+		driver:  driver,
+		path:    path,
+		entries: make(map[string]Entry),
+	}
+}
+
+func (fs *fileStore) Load(ctx context.Context) (map[string]*Entry, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	bytes, err := fs.driver.GetContent(ctx, fs.path)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return make(map[string]*Entry), nil
+		}
+		return nil, err
+	}
+
+	entries := make(map[string]*Entry)
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return nil, err
+	}
+	fs.entries = make(map[string]Entry, len(entries))
+	for key, entry := range entries {
+		fs.entries[key] = *entry
+	}
+	return entries, nil
+}
+
+func (fs *fileStore) Put(ctx context.Context, entry *Entry) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.entries[entry.Key] = *entry
+	fs.dirty = true
+	return nil
+}
+
+func (fs *fileStore) Delete(ctx context.Context, key string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.entries[key]; ok {
+		delete(fs.entries, key)
+		fs.dirty = true
+	}
+	return nil
+}
+
+func (fs *fileStore) Flush(ctx context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if !fs.dirty {
+		return nil
+	}
+	jsonBytes, err := json.Marshal(fs.entries)
+	if err != nil {
+		return err
+	}
+	if err := fs.driver.PutContent(ctx, fs.path, jsonBytes); err != nil {
+		return err
+	}
+	fs.dirty = false
+	return nil
+}
+
+// entryStore keeps each entry in its own file below a root directory,
+// named after the digest of its key, so that registry instances sharing
+// the storage do not overwrite each other's entries.
+type entryStore struct {
+	driver driver.StorageDriver
+	root   string
+}
+
+// NewEntryStore returns a Store keeping each entry in its own file below
+// root. It may be shared between registry instances. Since storage drivers
+// offer no atomic compare-and-swap, its lease is best effort: two instances
+// may briefly both run expiry callbacks, which must therefore tolerate
+// content that is already gone.
+func NewEntryStore(driver driver.StorageDriver, root string) Store {
+	return &entryStore{
+		driver: driver,
+		root:   root,
+	}
+}
+
+func (es *entryStore) entriesPath() string {
+	return path.Join(es.root, "entries")
+}
+
+func (es *entryStore) entryPath(key string) string {
+	return path.Join(es.entriesPath(), digest.FromString(key).Hex())
+}
+
+func (es *entryStore) Load(ctx context.Context) (map[string]*Entry, error) {
+	entries := make(map[string]*Entry)
+
+	paths, err := es.driver.List(ctx, es.entriesPath())
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return entries, nil
+		}
+		return nil, err
+	}
+
+	for _, p := range paths {
+		bytes, err := es.driver.GetContent(ctx, p)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// deleted by another instance in the meantime
+				continue
+			}
+			return nil, err
+		}
+		var entry Entry
+		if err := json.Unmarshal(bytes, &entry); err != nil {
+			return nil, err
+		}
+		entries[entry.Key] = &entry
+	}
+	return entries, nil
+}
+
+func (es *entryStore) Put(ctx context.Context, entry *Entry) error {
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return es.driver.PutContent(ctx, es.entryPath(entry.Key), jsonBytes)
+}
+
+func (es *entryStore) Delete(ctx context.Context, key string) error {
+	err := es.driver.Delete(ctx, es.entryPath(key))
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+func (es *entryStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (es *entryStore) AcquireLease(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return coordination.NewStorageLease(es.driver, path.Join(es.root, "lease")).Acquire(ctx, owner, ttl)
+}
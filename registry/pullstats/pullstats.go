@@ -0,0 +1,451 @@
+// Package pullstats tracks how often and how recently repositories, tags and
+// blobs are pulled. Statistics are aggregated in memory from registry events
+// and periodically flushed to the storage driver, so that they survive
+// restarts and can drive retention and tiering decisions. Each instance of the
+// registry flushes the pulls it served to its own file, and reports the sum of
+// the statistics flushed by all instances.
+package pullstats
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/go-metrics"
+	"github.com/opencontainers/go-digest"
+)
+
+const defaultFlushInterval = time.Minute
+
+// CountHeader reports on the responses serving a manifest or blob the number
+// of pulls recorded for its digest, as a hint for the eviction decisions of
+// caches in front of the registry.
+const CountHeader = "Docker-Pull-Count"
+
+var (
+	namespace = metrics.NewNamespace(prometheus.NamespacePrefix, "pullstats", nil)
+
+	// pullCount counts the recorded pulls by kind of content.
+	pullCount = namespace.NewLabeledCounter("pulls", "The number of pulls recorded", "type")
+
+	// invalidInstanceChars matches the characters of an instance name which
+	// are not allowed in the name of its file.
+	invalidInstanceChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+func init() {
+	metrics.Register(namespace)
+}
+
+// Record describes the pull history of a repository, tag or blob.
+type Record struct {
+	// Pulls is the number of pulls recorded.
+	Pulls int64 `json:"pulls"`
+
+	// LastPulled is the time of the most recent pull.
+	LastPulled time.Time `json:"lastPulled"`
+}
+
+func (r *Record) add(other Record) {
+	r.Pulls += other.Pulls
+	if other.LastPulled.After(r.LastPulled) {
+		r.LastPulled = other.LastPulled
+	}
+}
+
+// RepositoryStats describes the pull history of a repository and its tags.
+type RepositoryStats struct {
+	Record
+	Tags map[string]Record `json:"tags,omitempty"`
+}
+
+// state is the serialized form of the statistics.
+type state struct {
+	Repositories map[string]*RepositoryStats `json:"repositories"`
+	Blobs        map[digest.Digest]Record    `json:"blobs"`
+
+	// Deleted holds the times the repositories and tags, keyed by
+	// deletionKey, were deleted, so that the pulls of the other instances
+	// before the deletion are discarded as well.
+	Deleted map[string]time.Time `json:"deleted,omitempty"`
+}
+
+func newState() state {
+	return state{
+		Repositories: make(map[string]*RepositoryStats),
+		Blobs:        make(map[digest.Digest]Record),
+		Deleted:      make(map[string]time.Time),
+	}
+}
+
+// deletionKey returns the key of the deletion of a repository, if tag is
+// empty, or of one of its tags.
+func deletionKey(repository, tag string) string {
+	if tag == "" {
+		return repository
+	}
+	return repository + ":" + tag
+}
+
+func (s state) repository(name string) *RepositoryStats {
+	repo, ok := s.Repositories[name]
+	if !ok {
+		repo = &RepositoryStats{Tags: make(map[string]Record)}
+		s.Repositories[name] = repo
+	}
+	return repo
+}
+
+// merge adds the statistics of other to s.
+func (s state) merge(other state) {
+	for name, stats := range other.Repositories {
+		repo := s.repository(name)
+		repo.add(stats.Record)
+		for tag, record := range stats.Tags {
+			merged := repo.Tags[tag]
+			merged.add(record)
+			repo.Tags[tag] = merged
+		}
+	}
+	for dgst, record := range other.Blobs {
+		merged := s.Blobs[dgst]
+		merged.add(record)
+		s.Blobs[dgst] = merged
+	}
+	for key, deleted := range other.Deleted {
+		if deleted.After(s.Deleted[key]) {
+			s.Deleted[key] = deleted
+		}
+	}
+}
+
+// prune discards the statistics of the repositories and tags not pulled
+// since their deletion.
+func (s state) prune(deleted map[string]time.Time) {
+	for name, repo := range s.Repositories {
+		if at, ok := deleted[deletionKey(name, "")]; ok && !repo.LastPulled.After(at) {
+			delete(s.Repositories, name)
+			continue
+		}
+		for tag, record := range repo.Tags {
+			if at, ok := deleted[deletionKey(name, tag)]; ok && !record.LastPulled.After(at) {
+				delete(repo.Tags, tag)
+			}
+		}
+	}
+}
+
+// Tracker aggregates pull events into statistics. It implements
+// notifications.Sink, so that it can be fed by the registry event bridge.
+type Tracker struct {
+	sync.Mutex
+
+	ctx             context.Context
+	driver          driver.StorageDriver
+	root            string
+	pathToStateFile string
+	flushInterval   time.Duration
+
+	// stats holds the pulls served by this instance, peers the statistics
+	// last flushed by the other instances.
+	stats   state
+	peers   state
+	dirty   bool
+	started bool
+	done    chan struct{}
+}
+
+var _ notifications.Sink = &Tracker{}
+
+// New returns a Tracker persisting the statistics of the named instance in a
+// file under root, next to those of the other instances. Statistics are
+// flushed, and those of the other instances read, every flushInterval, or
+// every minute if flushInterval is zero.
+func New(ctx context.Context, driver driver.StorageDriver, root, instance string, flushInterval time.Duration) *Tracker {
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	return &Tracker{
+		ctx:             ctx,
+		driver:          driver,
+		root:            root,
+		pathToStateFile: path.Join(root, invalidInstanceChars.ReplaceAllString(instance, "-")+".json"),
+		flushInterval:   flushInterval,
+		stats:           newState(),
+		peers:           newState(),
+		done:            make(chan struct{}),
+	}
+}
+
+// Start loads previously flushed statistics and starts flushing periodically.
+func (t *Tracker) Start() error {
+	if err := t.Refresh(); err != nil {
+		return err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.started {
+		return nil
+	}
+
+	persisted, err := t.readState(t.pathToStateFile)
+	if err != nil {
+		return err
+	}
+	t.stats.merge(persisted)
+	t.stats.prune(t.peers.Deleted)
+	t.started = true
+
+	go func() {
+		ticker := time.NewTicker(t.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					dcontext.GetLogger(t.ctx).Errorf("error flushing pull statistics: %v", err)
+				}
+				if err := t.Refresh(); err != nil {
+					dcontext.GetLogger(t.ctx).Errorf("error reading the pull statistics of other instances: %v", err)
+				}
+			case <-t.done:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Write records the pull events among events. Deletions of tags and
+// repositories discard their statistics.
+func (t *Tracker) Write(events ...notifications.Event) error {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, event := range events {
+		switch event.Action {
+		case notifications.EventActionPull:
+			t.recordPull(event)
+		case notifications.EventActionDelete:
+			t.recordDelete(event)
+		}
+	}
+
+	return nil
+}
+
+func (t *Tracker) recordPull(event notifications.Event) {
+	pulled := event.Timestamp
+	if pulled.IsZero() {
+		pulled = time.Now()
+	}
+	pull := Record{Pulls: 1, LastPulled: pulled}
+
+	if event.Target.Digest != "" {
+		record := t.stats.Blobs[event.Target.Digest]
+		record.add(pull)
+		t.stats.Blobs[event.Target.Digest] = record
+	}
+
+	// Only manifest pulls count as pulls of the repository. Layer pulls are
+	// tracked by digest above.
+	if !isManifest(event) {
+		pullCount.WithValues("blob").Inc(1)
+		t.dirty = true
+		return
+	}
+	pullCount.WithValues("manifest").Inc(1)
+
+	repo := t.stats.repository(event.Target.Repository)
+	repo.add(pull)
+	if event.Target.Tag != "" {
+		record := repo.Tags[event.Target.Tag]
+		record.add(pull)
+		repo.Tags[event.Target.Tag] = record
+	}
+	t.dirty = true
+}
+
+func (t *Tracker) recordDelete(event notifications.Event) {
+	if event.Target.Tag == "" && event.Target.Digest != "" {
+		return
+	}
+
+	deleted := event.Timestamp
+	if deleted.IsZero() {
+		deleted = time.Now()
+	}
+	key := deletionKey(event.Target.Repository, event.Target.Tag)
+	if deleted.After(t.stats.Deleted[key]) {
+		t.stats.Deleted[key] = deleted
+	}
+	t.stats.prune(t.stats.Deleted)
+	t.peers.prune(t.stats.Deleted)
+	t.dirty = true
+}
+
+// isManifest reports whether a pull event refers to a manifest rather than a
+// blob.
+func isManifest(event notifications.Event) bool {
+	for _, mediaType := range distribution.ManifestMediaTypes() {
+		if event.Target.MediaType == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Close flushes the statistics and stops the periodic flush.
+func (t *Tracker) Close() error {
+	t.Lock()
+	if t.started {
+		close(t.done)
+		t.started = false
+	}
+	t.Unlock()
+
+	return t.Flush()
+}
+
+// Flush writes the statistics to storage, if they changed since the last
+// flush.
+func (t *Tracker) Flush() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.dirty {
+		return nil
+	}
+
+	p, err := json.Marshal(t.stats)
+	if err != nil {
+		return err
+	}
+	if err := t.driver.PutContent(t.ctx, t.pathToStateFile, p); err != nil {
+		return err
+	}
+
+	t.dirty = false
+	return nil
+}
+
+// Refresh reads the statistics last flushed by the other instances.
+func (t *Tracker) Refresh() error {
+	files, err := t.driver.List(t.ctx, t.root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	peers := newState()
+	for _, file := range files {
+		if file == t.pathToStateFile || !strings.HasSuffix(file, ".json") {
+			continue
+		}
+		persisted, err := t.readState(file)
+		if err != nil {
+			return err
+		}
+		peers.merge(persisted)
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	peers.prune(peers.Deleted)
+	peers.prune(t.stats.Deleted)
+	t.stats.prune(peers.Deleted)
+	t.peers = peers
+	return nil
+}
+
+// Repository returns the statistics of the named repository across all
+// instances. It returns false if no pull of the repository was recorded.
+func (t *Tracker) Repository(name string) (RepositoryStats, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	stats := RepositoryStats{Tags: make(map[string]Record)}
+	found := false
+	for _, s := range []state{t.stats, t.peers} {
+		repo, ok := s.Repositories[name]
+		if !ok {
+			continue
+		}
+		found = true
+		stats.add(repo.Record)
+		for tag, record := range repo.Tags {
+			merged := stats.Tags[tag]
+			merged.add(record)
+			stats.Tags[tag] = merged
+		}
+	}
+	if !found {
+		return RepositoryStats{}, false
+	}
+	return stats, true
+}
+
+// Repositories returns the names of all repositories with recorded pulls, in
+// lexical order.
+func (t *Tracker) Repositories() []string {
+	t.Lock()
+	defer t.Unlock()
+
+	names := make([]string, 0, len(t.stats.Repositories)+len(t.peers.Repositories))
+	for name := range t.stats.Repositories {
+		names = append(names, name)
+	}
+	for name := range t.peers.Repositories {
+		if _, ok := t.stats.Repositories[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BlobAccess returns the time a blob was last pulled and the number of pulls
+// recorded for it by all instances. It implements storage.BlobAccessStats.
+func (t *Tracker) BlobAccess(ctx context.Context, dgst digest.Digest) (time.Time, int64, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	record := t.stats.Blobs[dgst]
+	record.add(t.peers.Blobs[dgst])
+	return record.LastPulled, record.Pulls, nil
+}
+
+func (t *Tracker) readState(file string) (state, error) {
+	persisted := newState()
+
+	p, err := t.driver.GetContent(t.ctx, file)
+	if err != nil {
+		switch err.(type) {
+		case driver.PathNotFoundError:
+			return persisted, nil
+		default:
+			return persisted, err
+		}
+	}
+
+	if err := json.Unmarshal(p, &persisted); err != nil {
+		return persisted, err
+	}
+	return persisted, nil
+}
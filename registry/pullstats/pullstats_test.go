@@ -0,0 +1,191 @@
+package pullstats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func pullEvent(repo, tag string, mediaType string, dgst digest.Digest, pulled time.Time) notifications.Event {
+	var event notifications.Event
+	event.Action = notifications.EventActionPull
+	event.Timestamp = pulled
+	event.Target.Repository = repo
+	event.Target.Tag = tag
+	event.Target.MediaType = mediaType
+	event.Target.Digest = dgst
+	return event
+}
+
+func TestTrackerRecordsPulls(t *testing.T) {
+	ctx := context.Background()
+	tracker := New(ctx, inmemory.New(), "/pullstats", "registry-0", time.Hour)
+
+	manifest := digest.FromString("manifest")
+	layer := digest.FromString("layer")
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	if err := tracker.Write(
+		pullEvent("foo/bar", "latest", schema2.MediaTypeManifest, manifest, first),
+		pullEvent("foo/bar", "", "application/octet-stream", layer, first),
+		pullEvent("foo/bar", "", schema2.MediaTypeManifest, manifest, second),
+	); err != nil {
+		t.Fatalf("unexpected error writing events: %v", err)
+	}
+
+	stats, ok := tracker.Repository("foo/bar")
+	if !ok {
+		t.Fatalf("expected statistics for foo/bar")
+	}
+	if stats.Pulls != 2 || !stats.LastPulled.Equal(second) {
+		t.Fatalf("unexpected repository statistics: %#v", stats.Record)
+	}
+	if tag := stats.Tags["latest"]; tag.Pulls != 1 || !tag.LastPulled.Equal(first) {
+		t.Fatalf("unexpected tag statistics: %#v", tag)
+	}
+
+	lastPulled, pulls, err := tracker.BlobAccess(ctx, layer)
+	if err != nil {
+		t.Fatalf("unexpected error getting blob access: %v", err)
+	}
+	if pulls != 1 || !lastPulled.Equal(first) {
+		t.Fatalf("unexpected blob access: %d pulls, last at %s", pulls, lastPulled)
+	}
+
+	if _, ok := tracker.Repository("foo/unknown"); ok {
+		t.Fatalf("expected no statistics for unpulled repository")
+	}
+}
+
+func TestTrackerDeletes(t *testing.T) {
+	tracker := New(context.Background(), inmemory.New(), "/pullstats", "registry-0", time.Hour)
+	now := time.Now()
+
+	tracker.Write(
+		pullEvent("foo/bar", "latest", schema2.MediaTypeManifest, digest.FromString("a"), now),
+		pullEvent("foo/bar", "old", schema2.MediaTypeManifest, digest.FromString("b"), now),
+		pullEvent("foo/baz", "latest", schema2.MediaTypeManifest, digest.FromString("c"), now),
+	)
+
+	var tagDeleted, repoDeleted notifications.Event
+	tagDeleted.Action = notifications.EventActionDelete
+	tagDeleted.Target.Repository = "foo/bar"
+	tagDeleted.Target.Tag = "old"
+	repoDeleted.Action = notifications.EventActionDelete
+	repoDeleted.Target.Repository = "foo/baz"
+	tracker.Write(tagDeleted, repoDeleted)
+
+	stats, _ := tracker.Repository("foo/bar")
+	if _, ok := stats.Tags["old"]; ok || len(stats.Tags) != 1 {
+		t.Fatalf("unexpected tags after deletion: %#v", stats.Tags)
+	}
+	if names := tracker.Repositories(); len(names) != 1 || names[0] != "foo/bar" {
+		t.Fatalf("unexpected repositories after deletion: %v", names)
+	}
+}
+
+func TestTrackerPersistence(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	now := time.Now().UTC()
+
+	tracker := New(ctx, driver, "/pullstats", "registry-0", time.Hour)
+	if err := tracker.Start(); err != nil {
+		t.Fatalf("unexpected error starting tracker: %v", err)
+	}
+	tracker.Write(pullEvent("foo/bar", "latest", schema2.MediaTypeManifest, digest.FromString("a"), now))
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("unexpected error closing tracker: %v", err)
+	}
+
+	// Pulls recorded before the statistics are loaded are merged with the
+	// persisted ones.
+	restarted := New(ctx, driver, "/pullstats", "registry-0", time.Hour)
+	restarted.Write(pullEvent("foo/bar", "latest", schema2.MediaTypeManifest, digest.FromString("a"), now))
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("unexpected error starting tracker: %v", err)
+	}
+	defer restarted.Close()
+
+	stats, ok := restarted.Repository("foo/bar")
+	if !ok || stats.Pulls != 2 || stats.Tags["latest"].Pulls != 2 {
+		t.Fatalf("unexpected statistics after restart: %#v", stats)
+	}
+	if _, pulls, _ := restarted.BlobAccess(ctx, digest.FromString("a")); pulls != 2 {
+		t.Fatalf("unexpected blob pulls after restart: %d", pulls)
+	}
+}
+
+func TestTrackerInstances(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	now := time.Now().UTC()
+	layer := digest.FromString("layer")
+
+	first := New(ctx, driver, "/pullstats", "registry-0", time.Hour)
+	second := New(ctx, driver, "/pullstats", "registry-1", time.Hour)
+	for _, tracker := range []*Tracker{first, second} {
+		if err := tracker.Start(); err != nil {
+			t.Fatalf("unexpected error starting tracker: %v", err)
+		}
+		defer tracker.Close()
+	}
+
+	flush := func() {
+		for _, tracker := range []*Tracker{first, second} {
+			if err := tracker.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing tracker: %v", err)
+			}
+		}
+		for _, tracker := range []*Tracker{first, second} {
+			if err := tracker.Refresh(); err != nil {
+				t.Fatalf("unexpected error refreshing tracker: %v", err)
+			}
+		}
+	}
+
+	// Each instance flushes to its own file, neither overwrites the other.
+	first.Write(
+		pullEvent("foo/bar", "latest", schema2.MediaTypeManifest, digest.FromString("a"), now),
+		pullEvent("foo/bar", "", "application/octet-stream", layer, now),
+	)
+	second.Write(
+		pullEvent("foo/bar", "latest", schema2.MediaTypeManifest, digest.FromString("a"), now),
+		pullEvent("foo/bar", "old", schema2.MediaTypeManifest, digest.FromString("b"), now),
+		pullEvent("foo/bar", "", "application/octet-stream", layer, now),
+	)
+	flush()
+
+	for _, tracker := range []*Tracker{first, second} {
+		stats, ok := tracker.Repository("foo/bar")
+		if !ok || stats.Pulls != 3 || stats.Tags["latest"].Pulls != 2 || stats.Tags["old"].Pulls != 1 {
+			t.Fatalf("unexpected statistics: %#v", stats)
+		}
+		if _, pulls, _ := tracker.BlobAccess(ctx, layer); pulls != 2 {
+			t.Fatalf("unexpected blob pulls: %d", pulls)
+		}
+	}
+
+	// A deletion served by one instance discards the pulls recorded by the
+	// other.
+	var tagDeleted notifications.Event
+	tagDeleted.Action = notifications.EventActionDelete
+	tagDeleted.Timestamp = now.Add(time.Second)
+	tagDeleted.Target.Repository = "foo/bar"
+	tagDeleted.Target.Tag = "old"
+	first.Write(tagDeleted)
+	flush()
+
+	for _, tracker := range []*Tracker{first, second} {
+		stats, _ := tracker.Repository("foo/bar")
+		if _, ok := stats.Tags["old"]; ok {
+			t.Fatalf("unexpected statistics of a deleted tag: %#v", stats.Tags)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/libtrust"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(RebuildReferenceIndexCmd)
+}
+
+// RebuildReferenceIndexCmd is the cobra command that corresponds to the
+// rebuild-reference-index subcommand
+var RebuildReferenceIndexCmd = &cobra.Command{
+	Use:   "rebuild-reference-index <config>",
+	Short: "`rebuild-reference-index` indexes the references of every manifest",
+	Long: "`rebuild-reference-index` records the blobs referenced by every manifest\n" +
+		"of the storage configured by <config>, and of the storage of its tenants,\n" +
+		"in the reference index, and marks the index as complete. Queries of the\n" +
+		"index are refused until it is.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		k, err := libtrust.GenerateECP256PrivateKey()
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		nameValidator, err := repositoryNameValidator(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name constraints: %v", err)
+			os.Exit(1)
+		}
+
+		options := []storage.RegistryOption{storage.Schema1SigningKey(k), storage.RepositoryNameValidator(nameValidator), storage.EnableReferenceIndex}
+		registry, err := storage.NewRegistry(ctx, driver, options...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		tenants, err := tenantRegistries(ctx, config, options...)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		err = runWithLease(ctx, config, driver, "referenceindex", func() error {
+			opts := storage.RebuildReferenceIndexOpts{NameValidator: nameValidator}
+			if err := storage.RebuildReferenceIndex(ctx, driver, registry, opts); err != nil {
+				return err
+			}
+			for _, t := range tenants {
+				fmt.Printf("rebuilding the reference index of tenant %s\n", t.name)
+				if err := storage.RebuildReferenceIndex(ctx, t.driver, t.registry, opts); err != nil {
+					return fmt.Errorf("tenant %s: %v", t.name, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to rebuild the reference index: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// referenceIndexOptions adds the option maintaining the reference index to
+// the registry options of a command writing to storage, if the index is
+// enabled.
+func referenceIndexOptions(config *configuration.Configuration, options []storage.RegistryOption) []storage.RegistryOption {
+	if config.ReferenceIndex.Enabled {
+		options = append(options, storage.EnableReferenceIndex)
+	}
+	return options
+}
+
+// invalidateReferenceIndexes marks the reference index of the storage, and
+// of the storage of each tenant, as incomplete if the index is not enabled,
+// as the manifests the command writes are not indexed. Registries started
+// without the index do the same.
+func invalidateReferenceIndexes(ctx context.Context, config *configuration.Configuration, driver storagedriver.StorageDriver, tenants []tenantRegistry) error {
+	if config.ReferenceIndex.Enabled {
+		return nil
+	}
+	if err := storage.InvalidateReferenceIndex(ctx, driver); err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		if err := storage.InvalidateReferenceIndex(ctx, t.driver); err != nil {
+			return fmt.Errorf("tenant %s: %v", t.name, err)
+		}
+	}
+	return nil
+}
@@ -6,9 +6,11 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,12 +24,15 @@ import (
 	"github.com/yvasiyarov/gorelic"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
 
 	"github.com/docker/distribution/configuration"
 	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/health"
+	"github.com/docker/distribution/registry/admin"
 	"github.com/docker/distribution/registry/handlers"
 	"github.com/docker/distribution/registry/listener"
+	"github.com/docker/distribution/registry/ui"
 	"github.com/docker/distribution/uuid"
 	"github.com/docker/distribution/version"
 )
@@ -53,12 +58,16 @@ var ServeCmd = &cobra.Command{
 		}
 
 		if config.HTTP.Debug.Addr != "" {
-			go func(addr string) {
-				log.Infof("debug server listening %v", addr)
-				if err := http.ListenAndServe(addr, nil); err != nil {
-					log.Fatalf("error listening on debug interface: %v", err)
+			ln, err := listener.NewListener(config.HTTP.Debug.Net, config.HTTP.Debug.Addr)
+			if err != nil {
+				log.Fatalf("error listening on debug interface: %v", err)
+			}
+			go func() {
+				log.Infof("debug server listening %v", ln.Addr())
+				if err := http.Serve(ln, nil); err != nil {
+					log.Fatalf("error serving debug interface: %v", err)
 				}
-			}(config.HTTP.Debug.Addr)
+			}()
 		}
 
 		registry, err := NewRegistry(ctx, config)
@@ -66,6 +75,11 @@ var ServeCmd = &cobra.Command{
 			log.Fatalln(err)
 		}
 
+		if registry.adminHandler != nil {
+			log.Info("providing the admin endpoints on the debug server")
+			http.Handle(adminRoutesPrefix(config), registry.adminHandler)
+		}
+
 		if config.HTTP.Debug.Prometheus.Enabled {
 			path := config.HTTP.Debug.Prometheus.Path
 			if path == "" {
@@ -87,6 +101,10 @@ type Registry struct {
 	config *configuration.Configuration
 	app    *handlers.App
 	server *http.Server
+
+	// adminHandler serves the admin endpoints on the debug server. It is
+	// nil if they are served on the public listeners.
+	adminHandler http.Handler
 }
 
 // NewRegistry creates a new registry from a context and configuration struct.
@@ -108,6 +126,18 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 	// can only be called once per process.
 	app.RegisterHealthChecks()
 	handler := configureReporting(app)
+	var adminHandler http.Handler
+	if config.HTTP.Debug.AdminRoutes {
+		if config.HTTP.Debug.Addr == "" {
+			return nil, fmt.Errorf("http.debug.adminroutes requires a debug server address")
+		}
+		adminHandler = panicHandler(handler)
+		handler = hidePrefix(adminRoutesPrefix(config), handler)
+	}
+	handler, err = ui.Handler(config.UI, config.HTTP.Prefix, handler)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring ui: %v", err)
+	}
 	handler = alive("/", handler)
 	handler = health.Handler(handler)
 	handler = panicHandler(handler)
@@ -116,13 +146,19 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 	}
 
 	server := &http.Server{
-		Handler: handler,
+		Handler:           handler,
+		ReadHeaderTimeout: config.HTTP.Timeouts.ReadHeader,
+		ReadTimeout:       config.HTTP.Timeouts.Read,
+		WriteTimeout:      config.HTTP.Timeouts.Write,
+		IdleTimeout:       config.HTTP.Timeouts.Idle,
+		ConnContext:       handlers.ConnContext,
 	}
 
 	return &Registry{
-		app:    app,
-		config: config,
-		server: server,
+		app:          app,
+		config:       config,
+		server:       server,
+		adminHandler: adminHandler,
 	}, nil
 }
 
@@ -130,11 +166,14 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 func (registry *Registry) ListenAndServe() error {
 	config := registry.config
 
-	ln, err := listener.NewListener(config.HTTP.Net, config.HTTP.Addr)
+	listeners, err := registry.listeners()
 	if err != nil {
 		return err
 	}
 
+	// challengeServer answers ACME HTTP-01 challenges, if configured
+	var challengeServer *http.Server
+
 	if config.HTTP.TLS.Certificate != "" || config.HTTP.TLS.LetsEncrypt.CacheFile != "" {
 		var tlsMinVersion uint16
 		if config.HTTP.TLS.MinimumTLS == "" {
@@ -171,20 +210,34 @@ func (registry *Registry) ListenAndServe() error {
 			if config.HTTP.TLS.Certificate != "" {
 				return fmt.Errorf("cannot specify both certificate and Let's Encrypt")
 			}
+			if len(config.HTTP.TLS.LetsEncrypt.Hosts) == 0 {
+				return fmt.Errorf("http.tls.letsencrypt.hosts must list the hosts to obtain certificates for")
+			}
 			m := &autocert.Manager{
-				HostPolicy: autocert.HostWhitelist(config.HTTP.TLS.LetsEncrypt.Hosts...),
-				Cache:      autocert.DirCache(config.HTTP.TLS.LetsEncrypt.CacheFile),
-				Email:      config.HTTP.TLS.LetsEncrypt.Email,
-				Prompt:     autocert.AcceptTOS,
+				HostPolicy:  autocert.HostWhitelist(config.HTTP.TLS.LetsEncrypt.Hosts...),
+				Cache:       autocert.DirCache(config.HTTP.TLS.LetsEncrypt.CacheFile),
+				Email:       config.HTTP.TLS.LetsEncrypt.Email,
+				Prompt:      autocert.AcceptTOS,
+				RenewBefore: config.HTTP.TLS.LetsEncrypt.RenewBefore,
+			}
+			if config.HTTP.TLS.LetsEncrypt.DirectoryURL != "" {
+				m.Client = &acme.Client{DirectoryURL: config.HTTP.TLS.LetsEncrypt.DirectoryURL}
 			}
 			tlsConf.GetCertificate = m.GetCertificate
 			tlsConf.NextProtos = append(tlsConf.NextProtos, acme.ALPNProto)
+
+			if addr := config.HTTP.TLS.LetsEncrypt.HTTPAddr; addr != "" {
+				challengeServer = &http.Server{
+					Addr:    addr,
+					Handler: m.HTTPHandler(nil),
+				}
+			}
 		} else {
-			tlsConf.Certificates = make([]tls.Certificate, 1)
-			tlsConf.Certificates[0], err = tls.LoadX509KeyPair(config.HTTP.TLS.Certificate, config.HTTP.TLS.Key)
+			reloader, err := newCertificateReloader(config.HTTP.TLS.Certificate, config.HTTP.TLS.Key, config.HTTP.TLS.ReloadInterval, dcontext.GetLogger(registry.app))
 			if err != nil {
 				return err
 			}
+			tlsConf.GetCertificate = reloader.GetCertificate
 		}
 
 		if len(config.HTTP.TLS.ClientCAs) != 0 {
@@ -209,29 +262,62 @@ func (registry *Registry) ListenAndServe() error {
 			tlsConf.ClientCAs = pool
 		}
 
-		ln = tls.NewListener(ln, tlsConf)
-		dcontext.GetLogger(registry.app).Infof("listening on %v, tls", ln.Addr())
+		for i, ln := range listeners {
+			listeners[i] = tls.NewListener(ln, tlsConf)
+			dcontext.GetLogger(registry.app).Infof("listening on %v, tls", ln.Addr())
+		}
 	} else {
-		dcontext.GetLogger(registry.app).Infof("listening on %v", ln.Addr())
+		for _, ln := range listeners {
+			dcontext.GetLogger(registry.app).Infof("listening on %v", ln.Addr())
+		}
 	}
 
-	if config.HTTP.DrainTimeout == 0 {
-		return registry.server.Serve(ln)
+	// Start serving every listener in a goroutine. The first one to fail
+	// stops the registry.
+	serveErr := make(chan error, len(listeners)+2)
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			serveErr <- registry.server.Serve(ln)
+		}(ln)
+	}
+	if config.Admin.Addr != "" {
+		adminServer, ln, err := registry.adminServer()
+		if err != nil {
+			return err
+		}
+		dcontext.GetLogger(registry.app).Infof("serving the admin api on %v", ln.Addr())
+		go func() {
+			serveErr <- adminServer.Serve(ln)
+		}()
+		defer adminServer.Stop()
+	}
+	if challengeServer != nil {
+		dcontext.GetLogger(registry.app).Infof("answering ACME HTTP-01 challenges on %v", challengeServer.Addr)
+		go func() {
+			serveErr <- challengeServer.ListenAndServe()
+		}()
+		defer challengeServer.Close()
 	}
 
+	// flush what the app accounted in memory once requests are no longer
+	// served
+	defer func() {
+		if err := registry.app.Close(); err != nil {
+			dcontext.GetLogger(registry.app).Errorf("error closing the app: %v", err)
+		}
+	}()
+
 	// setup channel to get notified on SIGTERM signal
 	signal.Notify(quit, syscall.SIGTERM)
-	serveErr := make(chan error)
-
-	// Start serving in goroutine and listen for stop signal in main thread
-	go func() {
-		serveErr <- registry.server.Serve(ln)
-	}()
 
 	select {
 	case err := <-serveErr:
 		return err
 	case <-quit:
+		if config.HTTP.DrainTimeout == 0 {
+			dcontext.GetLogger(registry.app).Info("stopping server")
+			return registry.server.Close()
+		}
 		dcontext.GetLogger(registry.app).Info("stopping server gracefully. Draining connections for ", config.HTTP.DrainTimeout)
 		// shutdown the server with a grace period of configured timeout
 		c, cancel := context.WithTimeout(context.Background(), config.HTTP.DrainTimeout)
@@ -240,6 +326,84 @@ func (registry *Registry) ListenAndServe() error {
 	}
 }
 
+// adminServer returns the gRPC server of the administrative API and the
+// listener it serves, which requires client certificates.
+func (registry *Registry) adminServer() (*grpc.Server, net.Listener, error) {
+	config := registry.config.Admin
+	if config.TLS.Certificate == "" || config.TLS.Key == "" || len(config.TLS.ClientCAs) == 0 {
+		return nil, nil, fmt.Errorf("admin.tls must configure a certificate, a key and client CAs")
+	}
+
+	reloader, err := newCertificateReloader(config.TLS.Certificate, config.TLS.Key, registry.config.HTTP.TLS.ReloadInterval, dcontext.GetLogger(registry.app))
+	if err != nil {
+		return nil, nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, ca := range config.TLS.ClientCAs {
+		caPem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok := pool.AppendCertsFromPEM(caPem); !ok {
+			return nil, nil, fmt.Errorf("could not add CA to pool")
+		}
+	}
+	tlsConf := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+		MinVersion:     tls.VersionTLS12,
+	}
+
+	ln, err := listener.NewListener(config.Net, config.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return admin.NewServer(registry.app.AdminServer(), tlsConf), ln, nil
+}
+
+// listeners announces on the configured bind addresses. Connections are
+// expected to start with a PROXY protocol header if it is enabled.
+func (registry *Registry) listeners() ([]net.Listener, error) {
+	config := registry.config
+
+	var trusted []*net.IPNet
+	for _, cidr := range config.HTTP.ProxyProtocol.TrustedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http.proxyprotocol.trustednetworks entry %q: %v", cidr, err)
+		}
+		trusted = append(trusted, network)
+	}
+
+	addrs := append([]configuration.Listener{{Net: config.HTTP.Net, Addr: config.HTTP.Addr}}, config.HTTP.Listeners...)
+	if config.HTTP.ProxyProtocol.Enabled && len(trusted) == 0 {
+		for _, addr := range addrs {
+			if addr.Net != "unix" {
+				return nil, fmt.Errorf("http.proxyprotocol.trustednetworks must list the networks of the load balancers when the PROXY protocol is enabled")
+			}
+		}
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := listener.NewListener(addr.Net, addr.Addr)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, err
+		}
+
+		if config.HTTP.ProxyProtocol.Enabled {
+			ln = listener.NewProxyProtocolListener(ln, trusted, config.HTTP.ProxyProtocol.HeaderTimeout)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
 func configureReporting(app *handlers.App) http.Handler {
 	var handler http.Handler = app
 
@@ -361,6 +525,24 @@ func panicHandler(handler http.Handler) http.Handler {
 	})
 }
 
+// adminRoutesPrefix returns the path prefix of the admin endpoints.
+func adminRoutesPrefix(config *configuration.Configuration) string {
+	return strings.TrimSuffix(config.HTTP.Prefix, "/") + "/v2/_admin/"
+}
+
+// hidePrefix wraps the handler so that the paths starting with prefix are not
+// found, for endpoints served on another listener.
+func hidePrefix(prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
 // alive simply wraps the handler with a route that always returns an http 200
 // response when the path is matched. If the path is not matched, the request
 // is passed to the provided handler. There is no guarantee of anything but
@@ -7,13 +7,14 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/docker/distribution/configuration"
-	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
 )
 
 // Tests to ensure nextProtos returns the correct protocols when:
@@ -98,3 +99,77 @@ func TestGracefulShutdown(t *testing.T) {
 		t.Error("Body is not {}; ", string(body))
 	}
 }
+
+func TestAdminRoutesOnDebugServer(t *testing.T) {
+	config := &configuration.Configuration{}
+	config.HTTP.Addr = freeAddr(t)
+	config.Storage = map[string]configuration.Parameters{"inmemory": map[string]interface{}{}}
+	config.HTTP.Debug.AdminRoutes = true
+	if _, err := NewRegistry(context.Background(), config); err == nil {
+		t.Fatal("expected an error serving the admin endpoints without debug server")
+	}
+
+	config.HTTP.Debug.Addr = freeAddr(t)
+	registry, err := NewRegistry(context.Background(), config)
+	if err != nil {
+		t.Fatalf("unexpected error creating registry: %v", err)
+	}
+
+	for _, tc := range []struct {
+		handler http.Handler
+		path    string
+		found   bool
+	}{
+		{registry.server.Handler, "/v2/", true},
+		{registry.server.Handler, "/v2/_admin/bans", false},
+		{registry.adminHandler, "/v2/_admin/bans", true},
+	} {
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+		if found := w.Code != http.StatusNotFound; found != tc.found {
+			t.Errorf("unexpected status of %s: %d", tc.path, w.Code)
+		}
+	}
+}
+
+// TestRunWithLeaseReleasesOnError checks a command failing releases its
+// lease, for the next run not to wait for the lease to expire.
+func TestRunWithLeaseReleasesOnError(t *testing.T) {
+	ctx := context.Background()
+	config := &configuration.Configuration{}
+	config.Coordination.Backend = "storage"
+	driver := inmemory.New()
+
+	failure := fmt.Errorf("failure")
+	err := runWithLease(ctx, config, driver, "gc", func() error { return failure })
+	if err != failure {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ran := false
+	err = runWithLease(ctx, config, driver, "gc", func() error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ran {
+		t.Fatalf("expected the lease to be released, ran=%v: %v", ran, err)
+	}
+}
+
+func TestProxyProtocolRequiresTrustedNetworks(t *testing.T) {
+	config := &configuration.Configuration{}
+	config.HTTP.Addr = "127.0.0.1:0"
+	config.HTTP.ProxyProtocol.Enabled = true
+	if _, err := (&Registry{config: config}).listeners(); err == nil {
+		t.Fatal("expected an error enabling the PROXY protocol without trusted networks")
+	}
+
+	config.HTTP.ProxyProtocol.TrustedNetworks = []string{"10.0.0.0/8"}
+	listeners, err := (&Registry{config: config}).listeners()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
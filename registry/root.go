@@ -1,14 +1,22 @@
 package registry
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/docker/distribution/configuration"
 	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/coordination"
+	"github.com/docker/distribution/registry/handlers"
 	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	"github.com/docker/distribution/version"
 	"github.com/docker/libtrust"
+	"github.com/garyburd/redigo/redis"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +27,12 @@ func init() {
 	RootCmd.AddCommand(GCCmd)
 	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
 	GCCmd.Flags().BoolVarP(&removeUntagged, "delete-untagged", "m", false, "delete manifests that are not currently referenced via tag")
+	GCCmd.Flags().DurationVar(&untaggedOlderThan, "delete-untagged-older-than", 0, "delete manifests not referenced via tag which were pushed at least this long ago")
+	GCCmd.Flags().DurationVarP(&progressInterval, "progress-interval", "i", time.Minute, "how often to report progress and save a checkpoint, 0 to disable")
+	GCCmd.Flags().BoolVarP(&resume, "resume", "r", false, "resume from the checkpoint saved by an interrupted run")
+	GCCmd.Flags().IntVar(&markConcurrency, "mark-concurrency", 1, "number of repositories marked concurrently")
+	GCCmd.Flags().IntVar(&sweepConcurrency, "sweep-concurrency", 1, "number of blob batches deleted concurrently")
+	GCCmd.Flags().Float64Var(&maxDeletesPerSecond, "max-deletes-per-second", 0, "maximum number of blobs deleted per second, 0 for no limit")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
 }
 
@@ -38,6 +52,12 @@ var RootCmd = &cobra.Command{
 
 var dryRun bool
 var removeUntagged bool
+var untaggedOlderThan time.Duration
+var progressInterval time.Duration
+var resume bool
+var markConcurrency int
+var sweepConcurrency int
+var maxDeletesPerSecond float64
 
 // GCCmd is the cobra command that corresponds to the garbage-collect subcommand
 var GCCmd = &cobra.Command{
@@ -71,15 +91,57 @@ var GCCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		registry, err := storage.NewRegistry(ctx, driver, storage.Schema1SigningKey(k))
+		nameValidator, err := repositoryNameValidator(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name constraints: %v", err)
+			os.Exit(1)
+		}
+
+		options := []storage.RegistryOption{storage.Schema1SigningKey(k), storage.RepositoryNameValidator(nameValidator)}
+		if config.Timeline.Enabled {
+			options = append(options, storage.EventTimeline(config.Timeline.Size))
+		}
+		if config.ReferenceIndex.Enabled {
+			options = append(options, storage.EnableReferenceIndex)
+		}
+		registry, err := storage.NewRegistry(ctx, driver, options...)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
 			os.Exit(1)
 		}
 
-		err = storage.MarkAndSweep(ctx, driver, registry, storage.GCOpts{
-			DryRun:         dryRun,
-			RemoveUntagged: removeUntagged,
+		tenants, err := tenantRegistries(ctx, config, options...)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// the storage of tenants with their own is collected after that of
+		// the registry, under the same lease
+		err = runWithLease(ctx, config, driver, "gc", func() error {
+			opts := storage.GCOpts{
+				DryRun:              dryRun,
+				RemoveUntagged:      removeUntagged,
+				UntaggedOlderThan:   untaggedOlderThan,
+				ProgressInterval:    progressInterval,
+				Resume:              resume,
+				MarkConcurrency:     markConcurrency,
+				SweepConcurrency:    sweepConcurrency,
+				MaxDeletesPerSecond: maxDeletesPerSecond,
+				NameValidator:       nameValidator,
+				IntentGrace:         config.IntentLog.Grace,
+				Retention:           handlers.RetentionRules(config),
+			}
+			if err := storage.MarkAndSweep(ctx, driver, registry, opts); err != nil {
+				return err
+			}
+			for _, t := range tenants {
+				fmt.Printf("collecting the storage of tenant %s\n", t.name)
+				if err := storage.MarkAndSweep(ctx, t.driver, t.registry, opts); err != nil {
+					return fmt.Errorf("tenant %s: %v", t.name, err)
+				}
+			}
+			return nil
 		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to garbage collect: %v", err)
@@ -87,3 +149,63 @@ var GCCmd = &cobra.Command{
 		}
 	},
 }
+
+// repositoryNameValidator returns the validator of the repository names
+// allowed by the configuration.
+func repositoryNameValidator(config *configuration.Configuration) (*reference.NameValidator, error) {
+	return reference.NewNameValidator(
+		config.Validation.Repositories.MaxLength,
+		config.Validation.Repositories.MaxComponents,
+		config.Validation.Repositories.Component)
+}
+
+// runWithLease calls run holding the named lease, if a coordination backend
+// is configured. The lease is released once run returns, before the caller
+// may exit on its error.
+func runWithLease(ctx context.Context, config *configuration.Configuration, driver storagedriver.StorageDriver, name string, run func() error) error {
+	if config.Coordination.Backend == "" {
+		return run()
+	}
+	release, err := holdLease(ctx, config, driver, name)
+	if err != nil {
+		return fmt.Errorf("failed to acquire %s lease: %v", name, err)
+	}
+	defer release()
+	return run()
+}
+
+// holdLease acquires the named lease guarding runs of a command, such as
+// garbage collection, so that runs started on several instances sharing a
+// storage backend do not overlap. The returned function releases it.
+func holdLease(ctx context.Context, config *configuration.Configuration, driver storagedriver.StorageDriver, name string) (func(), error) {
+	var pool *redis.Pool
+	if config.Coordination.Backend == "redis" && config.Redis.Addr != "" {
+		pool = &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				conn, err := redis.DialTimeout("tcp", config.Redis.Addr, config.Redis.DialTimeout, config.Redis.ReadTimeout, config.Redis.WriteTimeout)
+				if err != nil {
+					return nil, err
+				}
+				if config.Redis.Password != "" {
+					if _, err := conn.Do("AUTH", config.Redis.Password); err != nil {
+						conn.Close()
+						return nil, err
+					}
+				}
+				if config.Redis.DB != 0 {
+					if _, err := conn.Do("SELECT", config.Redis.DB); err != nil {
+						conn.Close()
+						return nil, err
+					}
+				}
+				return conn, nil
+			},
+		}
+	}
+
+	lease, err := coordination.NewLease(config.Coordination.Backend, name, driver, pool)
+	if err != nil {
+		return nil, err
+	}
+	return coordination.Hold(ctx, lease, coordination.NewOwner(), config.Coordination.LeaseDuration)
+}
@@ -0,0 +1,272 @@
+// Package scan submits pushed manifests to an external vulnerability scanner
+// and keeps the reports it returns, so that the registry can refuse to serve
+// images with severe vulnerabilities.
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultTimeout     = 30 * time.Second
+	defaultConcurrency = 2
+
+	// queueSize bounds the number of manifests waiting to be scanned.
+	// Pushes beyond it are not scanned.
+	queueSize = 1000
+)
+
+// ErrNoReport is returned when a manifest has not been scanned.
+var ErrNoReport = errors.New("scan: no report")
+
+// Severities lists the vulnerability severities understood by the scanner
+// policy, from the least to the most severe.
+var Severities = []string{"low", "medium", "high", "critical"}
+
+// Report is the outcome of scanning a manifest.
+type Report struct {
+	// Digest identifies the full report kept by the scanner.
+	Digest digest.Digest `json:"report"`
+
+	// Severities counts the vulnerabilities found by severity.
+	Severities map[string]int `json:"severities,omitempty"`
+
+	// ScannedAt is the time the report was received.
+	ScannedAt time.Time `json:"scannedAt"`
+}
+
+// Exceeds returns true if the report has a vulnerability of the given
+// severity or a more severe one.
+func (r Report) Exceeds(severity string) bool {
+	found := false
+	for _, s := range Severities {
+		found = found || s == severity
+		if found && r.Severities[s] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidSeverity returns true if severity is one of Severities.
+func ValidSeverity(severity string) bool {
+	for _, s := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Config configures the scanner endpoint.
+type Config struct {
+	// Endpoint is the URL manifests are posted to.
+	Endpoint string
+
+	// Headers are added to every request, for example to authenticate.
+	Headers http.Header
+
+	// Timeout bounds each scan request. It defaults to 30 seconds.
+	Timeout time.Duration
+
+	// Concurrency is the number of concurrent scan requests. It defaults
+	// to 2.
+	Concurrency int
+
+	// Transport is used to send requests. It defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Target identifies a manifest to scan.
+type Target struct {
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+	MediaType  string        `json:"mediaType,omitempty"`
+	Tag        string        `json:"tag,omitempty"`
+	URL        string        `json:"url,omitempty"`
+}
+
+// Scanner scans manifests when they are pushed. It implements
+// notifications.Sink, so that it can be fed by the registry event bridge.
+type Scanner struct {
+	ctx     context.Context
+	driver  driver.StorageDriver
+	root    string
+	config  Config
+	client  *http.Client
+	queue   chan Target
+	wg      sync.WaitGroup
+	closing sync.Once
+}
+
+var _ notifications.Sink = &Scanner{}
+
+// New returns a Scanner keeping reports under root in driver and starts its
+// workers.
+func New(ctx context.Context, driver driver.StorageDriver, root string, config Config) *Scanner {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultConcurrency
+	}
+
+	s := &Scanner{
+		ctx:    ctx,
+		driver: driver,
+		root:   root,
+		config: config,
+		client: &http.Client{
+			Transport: config.Transport,
+			Timeout:   config.Timeout,
+		},
+		queue: make(chan Target, queueSize),
+	}
+
+	for i := 0; i < config.Concurrency; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for target := range s.queue {
+				if _, err := s.Scan(s.ctx, target); err != nil {
+					dcontext.GetLogger(s.ctx).Errorf("error scanning %s@%s: %v", target.Repository, target.Digest, err)
+				}
+			}
+		}()
+	}
+
+	return s
+}
+
+// Write queues the manifests pushed in events for scanning. It never
+// blocks: manifests are dropped when the queue is full.
+func (s *Scanner) Write(events ...notifications.Event) error {
+	for _, event := range events {
+		if event.Action != notifications.EventActionPush || !isManifest(event) {
+			continue
+		}
+
+		target := Target{
+			Repository: event.Target.Repository,
+			Digest:     event.Target.Digest,
+			MediaType:  event.Target.MediaType,
+			Tag:        event.Target.Tag,
+			URL:        event.Target.URL,
+		}
+		select {
+		case s.queue <- target:
+		default:
+			dcontext.GetLogger(s.ctx).Warnf("scan queue full, not scanning %s@%s", target.Repository, target.Digest)
+		}
+	}
+	return nil
+}
+
+// Close waits for the queued scans to complete.
+func (s *Scanner) Close() error {
+	s.closing.Do(func() {
+		close(s.queue)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// Scan submits target to the scanner and stores the report returned.
+func (s *Scanner) Scan(ctx context.Context, target Target) (Report, error) {
+	body, err := json.Marshal(target)
+	if err != nil {
+		return Report{}, err
+	}
+
+	req, err := http.NewRequest("POST", s.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Report{}, err
+	}
+	for name, values := range s.config.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Report{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Report{}, fmt.Errorf("scanner responded with status %s", resp.Status)
+	}
+
+	var report Report
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&report); err != nil {
+		return Report{}, fmt.Errorf("error decoding scanner response: %v", err)
+	}
+	if err := report.Digest.Validate(); err != nil {
+		return Report{}, fmt.Errorf("invalid report digest %q: %v", report.Digest, err)
+	}
+	report.ScannedAt = time.Now().UTC()
+
+	content, err := json.Marshal(report)
+	if err != nil {
+		return Report{}, err
+	}
+	if err := s.driver.PutContent(ctx, s.reportPath(target.Repository, target.Digest), content); err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// Report returns the stored report of a manifest, or ErrNoReport if it has
+// not been scanned.
+func (s *Scanner) Report(ctx context.Context, repository string, dgst digest.Digest) (Report, error) {
+	content, err := s.driver.GetContent(ctx, s.reportPath(repository, dgst))
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return Report{}, ErrNoReport
+		}
+		return Report{}, err
+	}
+
+	var report Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// reportPath returns the path of the report of a manifest. Repository name
+// components cannot start with an underscore, so reports never collide with
+// nested repositories.
+func (s *Scanner) reportPath(repository string, dgst digest.Digest) string {
+	return path.Join(s.root, repository, "_reports", dgst.Algorithm().String(), dgst.Hex())
+}
+
+// isManifest reports whether an event refers to a manifest rather than a
+// blob.
+func isManifest(event notifications.Event) bool {
+	for _, mediaType := range distribution.ManifestMediaTypes() {
+		if event.Target.MediaType == mediaType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestReportExceeds(t *testing.T) {
+	report := Report{Severities: map[string]int{"low": 3, "high": 1}}
+
+	for severity, expected := range map[string]bool{
+		"low":      true,
+		"medium":   true,
+		"high":     true,
+		"critical": false,
+	} {
+		if report.Exceeds(severity) != expected {
+			t.Errorf("Exceeds(%q) != %v", severity, expected)
+		}
+	}
+
+	if !ValidSeverity("critical") || ValidSeverity("severe") {
+		t.Errorf("unexpected severity validation")
+	}
+}
+
+func TestScanner(t *testing.T) {
+	reportDigest := digest.FromString("report")
+
+	var mu sync.Mutex
+	var received []Target
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var target Target
+		if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, target)
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"report":     reportDigest,
+			"severities": map[string]int{"critical": 2},
+		})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	s := New(ctx, inmemory.New(), "/scans", Config{
+		Endpoint: server.URL,
+		Headers:  http.Header{"Authorization": []string{"Bearer secret"}},
+	})
+
+	manifestDigest := digest.FromString("manifest")
+	if _, err := s.Report(ctx, "foo/bar", manifestDigest); err != ErrNoReport {
+		t.Fatalf("expected ErrNoReport, got %v", err)
+	}
+
+	var layer, manifest notifications.Event
+	layer.Action = notifications.EventActionPush
+	layer.Target.MediaType = schema2.MediaTypeLayer
+	layer.Target.Repository = "foo/bar"
+	layer.Target.Digest = digest.FromString("layer")
+	manifest.Action = notifications.EventActionPush
+	manifest.Target.MediaType = schema2.MediaTypeManifest
+	manifest.Target.Repository = "foo/bar"
+	manifest.Target.Digest = manifestDigest
+	manifest.Target.Tag = "latest"
+
+	if err := s.Write(layer, manifest); err != nil {
+		t.Fatalf("unexpected error writing events: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error closing scanner: %v", err)
+	}
+
+	if len(received) != 1 || received[0].Digest != manifestDigest || received[0].Tag != "latest" {
+		t.Fatalf("unexpected scan requests: %+v", received)
+	}
+
+	report, err := s.Report(ctx, "foo/bar", manifestDigest)
+	if err != nil {
+		t.Fatalf("unexpected error reading report: %v", err)
+	}
+	if report.Digest != reportDigest || report.Severities["critical"] != 2 || report.ScannedAt.IsZero() {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if _, err := s.Report(ctx, "foo", manifestDigest); err != ErrNoReport {
+		t.Fatalf("expected reports to be scoped to the repository, got %v", err)
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/invalid":
+			w.Write([]byte(`{"report": "not a digest"}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	target := Target{Repository: "foo/bar", Digest: digest.FromString("manifest")}
+	for _, endpoint := range []string{"/fail", "/invalid"} {
+		s := New(ctx, inmemory.New(), "/scans", Config{Endpoint: server.URL + endpoint})
+		if _, err := s.Scan(ctx, target); err == nil {
+			t.Errorf("%s: expected an error", endpoint)
+		}
+		if _, err := s.Report(ctx, target.Repository, target.Digest); err != ErrNoReport {
+			t.Errorf("%s: expected no report, got %v", endpoint, err)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,489 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// backupIDFormat names snapshots after their time, so that they sort in
+// chronological order.
+const backupIDFormat = "20060102T150405Z"
+
+// backupManifestName is the file written last in a snapshot, telling it is
+// complete.
+const backupManifestName = "snapshot.json"
+
+// BackupSnapshot describes a complete snapshot of the metadata of a registry.
+type BackupSnapshot struct {
+	// ID names the directory of the snapshot under the prefix.
+	ID string `json:"id"`
+
+	// CreatedAt is the time the snapshot was started.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Files is the number of files in the snapshot.
+	Files int `json:"files"`
+}
+
+// BackupOpts configures a snapshot of the metadata of a registry.
+type BackupOpts struct {
+	// Prefix is the path of the target under which each snapshot gets a
+	// directory.
+	Prefix string
+
+	// Keep is the number of most recent snapshots kept, older ones being
+	// removed. All snapshots are kept if zero.
+	Keep int
+}
+
+// BackupMetadata copies the tags, manifest links, layer links and layout of
+// the registry stored by storageDriver to a new snapshot under the prefix of
+// target, which may be storageDriver itself. Blobs and uploads are not
+// copied. The snapshot is only listed once all its files are copied.
+func BackupMetadata(ctx context.Context, storageDriver driver.StorageDriver, target driver.StorageDriver, opts BackupOpts) (BackupSnapshot, error) {
+	if target == storageDriver && strings.HasPrefix(path.Clean(opts.Prefix)+"/", storagePathRoot) {
+		return BackupSnapshot{}, fmt.Errorf("backup prefix %s is within the storage of the registry", opts.Prefix)
+	}
+
+	snapshot := BackupSnapshot{CreatedAt: time.Now().UTC()}
+	snapshot.ID = snapshot.CreatedAt.Format(backupIDFormat)
+	dir := path.Join(opts.Prefix, snapshot.ID)
+
+	copyFile := func(p string) error {
+		if err := copyBetween(ctx, storageDriver, p, target, path.Join(dir, p)); err != nil {
+			return err
+		}
+		snapshot.Files++
+		return nil
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return snapshot, err
+	}
+	err = storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			if path.Base(fileInfo.Path()) == "_uploads" {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+		return copyFile(fileInfo.Path())
+	})
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return snapshot, err
+	}
+	if err := copyFile(layoutPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return snapshot, err
+		}
+	}
+
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := target.PutContent(ctx, path.Join(dir, backupManifestName), content); err != nil {
+		return snapshot, err
+	}
+
+	if opts.Keep > 0 {
+		snapshots, err := ListBackups(ctx, target, opts.Prefix)
+		if err != nil {
+			return snapshot, err
+		}
+		for len(snapshots) > opts.Keep {
+			dcontext.GetLogger(ctx).Infof("removing backup snapshot %s", snapshots[0].ID)
+			if err := target.Delete(ctx, path.Join(opts.Prefix, snapshots[0].ID)); err != nil {
+				return snapshot, err
+			}
+			snapshots = snapshots[1:]
+		}
+	}
+	return snapshot, nil
+}
+
+// ListBackups returns the complete snapshots under the prefix of target, the
+// oldest first.
+func ListBackups(ctx context.Context, target driver.StorageDriver, prefix string) ([]BackupSnapshot, error) {
+	dirs, err := target.List(ctx, prefix)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []BackupSnapshot
+	for _, dir := range dirs {
+		content, err := target.GetContent(ctx, path.Join(dir, backupManifestName))
+		if err != nil {
+			// snapshots in progress or interrupted are not listed
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		var snapshot BackupSnapshot
+		if err := json.Unmarshal(content, &snapshot); err != nil {
+			return nil, fmt.Errorf("invalid backup snapshot %s: %v", dir, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID < snapshots[j].ID
+	})
+	return snapshots, nil
+}
+
+// RestoreOpts configures the restore of a snapshot.
+type RestoreOpts struct {
+	// Prefix is the path of the source under which snapshots are kept.
+	Prefix string
+
+	// ID is the snapshot restored.
+	ID string
+
+	// Repository restricts the restore to a repository, and the
+	// repositories nested in it. Every repository is restored if empty.
+	Repository string
+
+	// DryRun logs the files which would be restored without writing them.
+	DryRun bool
+}
+
+// RestoreBackup copies the files of a snapshot kept under the prefix of
+// source back to the registry stored by storageDriver, returning the number
+// of files restored. Files of the registry missing from the snapshot are left
+// in place, and the layout is only restored to storage which has none.
+// Manifests whose blobs were garbage collected since the snapshot cannot be
+// pulled once restored. The reference index is invalidated, as the manifests
+// restored are not indexed.
+func RestoreBackup(ctx context.Context, storageDriver driver.StorageDriver, source driver.StorageDriver, opts RestoreOpts) (int, error) {
+	dir := path.Join(opts.Prefix, opts.ID)
+	if _, err := source.Stat(ctx, path.Join(dir, backupManifestName)); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return 0, fmt.Errorf("no complete backup snapshot %s under %s", opts.ID, opts.Prefix)
+		}
+		return 0, err
+	}
+
+	restore := func(p string) error {
+		if opts.DryRun {
+			dcontext.GetLogger(ctx).Infof("would restore %s", p)
+			return nil
+		}
+		return copyBetween(ctx, source, path.Join(dir, p), storageDriver, p)
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return 0, err
+	}
+	if opts.Repository != "" {
+		root = path.Join(root, opts.Repository)
+	}
+
+	// the manifests restored are written without going through the
+	// manifest store, so they are missing from the reference index
+	if !opts.DryRun {
+		if err := InvalidateReferenceIndex(ctx, storageDriver); err != nil {
+			return 0, err
+		}
+	}
+
+	// the tag indexes of the snapshot are left out: the ones of the
+	// repositories whose tags are restored are invalidated instead
+	restored := 0
+	retagged := map[string]struct{}{}
+	err = source.Walk(ctx, path.Join(dir, root), func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		p := strings.TrimPrefix(fileInfo.Path(), dir)
+		if strings.Contains(p, "/_tagindex/") {
+			return nil
+		}
+		if err := restore(p); err != nil {
+			return err
+		}
+		if i := strings.Index(p, "/_manifests/tags/"); i >= 0 {
+			retagged[strings.TrimPrefix(p[:i], root+"/")] = struct{}{}
+		}
+		restored++
+		return nil
+	})
+	if !opts.DryRun {
+		for name := range retagged {
+			if ierr := invalidateTagIndex(ctx, storageDriver, name); ierr != nil && err == nil {
+				err = ierr
+			}
+		}
+	}
+	if err != nil {
+		return restored, err
+	}
+
+	if opts.Repository == "" {
+		if _, err := storageDriver.Stat(ctx, layoutPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return restored, err
+			}
+			if err := restore(layoutPath); err != nil {
+				if _, ok := err.(driver.PathNotFoundError); !ok {
+					return restored, err
+				}
+			}
+		}
+	}
+	return restored, nil
+}
+
+// RestoreChange is a change made to a repository by RestoreRepositoryAt.
+type RestoreChange struct {
+	// Kind is "tag", "manifest" or "layer".
+	Kind string
+
+	// Tag is the tag changed, if Kind is "tag".
+	Tag string
+
+	// From is the digest a tag pointed to before the restore, empty if the
+	// tag was restored after being deleted.
+	From digest.Digest
+
+	// To is the digest a tag points to after the restore, or the manifest
+	// or layer linked again. It is empty if the tag was removed.
+	To digest.Digest
+}
+
+// String formats the change as a line of a diff.
+func (c RestoreChange) String() string {
+	switch {
+	case c.Kind != "tag":
+		return fmt.Sprintf("+ %s %s", c.Kind, c.To)
+	case c.From == "":
+		return fmt.Sprintf("+ tag %s %s", c.Tag, c.To)
+	case c.To == "":
+		return fmt.Sprintf("- tag %s %s", c.Tag, c.From)
+	default:
+		return fmt.Sprintf("~ tag %s %s -> %s", c.Tag, c.From, c.To)
+	}
+}
+
+// PointInTimeOpts configures the restore of a repository to a point in time.
+type PointInTimeOpts struct {
+	// Prefix is the path of the source under which snapshots are kept.
+	Prefix string
+
+	// Repository is the repository restored.
+	Repository string
+
+	// At is the point in time the repository is restored to, that of the
+	// most recent snapshot taken at or before it.
+	At time.Time
+
+	// DryRun reports the changes without making them.
+	DryRun bool
+}
+
+// RestoreRepositoryAt restores the tags of a repository to those recorded by
+// the most recent snapshot taken by At: tags are moved back, restored if
+// deleted and removed if created since, and the manifest and layer links of
+// the snapshot are restored if deleted. Manifests pushed since stay linked,
+// untagged, and blobs are left intact. The reference index is invalidated if
+// manifests are linked again. It returns the snapshot restored and
+// the changes made, in the order of tags, manifests and layers.
+func RestoreRepositoryAt(ctx context.Context, storageDriver driver.StorageDriver, source driver.StorageDriver, opts PointInTimeOpts) (BackupSnapshot, []RestoreChange, error) {
+	snapshots, err := ListBackups(ctx, source, opts.Prefix)
+	if err != nil {
+		return BackupSnapshot{}, nil, err
+	}
+	var snapshot BackupSnapshot
+	for _, s := range snapshots {
+		if s.CreatedAt.After(opts.At) {
+			break
+		}
+		snapshot = s
+	}
+	if snapshot.ID == "" {
+		return snapshot, nil, fmt.Errorf("no complete backup snapshot taken by %s under %s", opts.At.Format(time.RFC3339), opts.Prefix)
+	}
+	dir := path.Join(opts.Prefix, snapshot.ID)
+
+	tagsPath, err := pathFor(manifestTagsPathSpec{name: opts.Repository})
+	if err != nil {
+		return snapshot, nil, err
+	}
+	previous, err := readTags(ctx, source, path.Join(dir, tagsPath))
+	if err != nil {
+		return snapshot, nil, err
+	}
+	if len(previous) == 0 {
+		return snapshot, nil, fmt.Errorf("repository %s has no tags in backup snapshot %s", opts.Repository, snapshot.ID)
+	}
+	current, err := readTags(ctx, storageDriver, tagsPath)
+	if err != nil {
+		return snapshot, nil, err
+	}
+
+	changes, err := restoreTags(ctx, storageDriver, source, dir, tagsPath, previous, current, opts.DryRun)
+	if !opts.DryRun && len(changes) > 0 {
+		// the tags were written without going through the tag store
+		if ierr := invalidateTagIndex(ctx, storageDriver, opts.Repository); ierr != nil && err == nil {
+			err = ierr
+		}
+	}
+	if err != nil {
+		return snapshot, changes, err
+	}
+
+	revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: opts.Repository})
+	if err != nil {
+		return snapshot, changes, err
+	}
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return snapshot, changes, err
+	}
+	indexInvalidated := false
+	for _, links := range []struct {
+		kind string
+		path string
+	}{
+		{"manifest", revisionsPath},
+		{"layer", path.Join(root, opts.Repository, "_layers")},
+	} {
+		err := source.Walk(ctx, path.Join(dir, links.path), func(fileInfo driver.FileInfo) error {
+			if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+				return nil
+			}
+			livePath := strings.TrimPrefix(fileInfo.Path(), dir)
+			if _, err := storageDriver.Stat(ctx, livePath); err == nil {
+				return nil
+			} else if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+			content, err := source.GetContent(ctx, fileInfo.Path())
+			if err != nil {
+				return err
+			}
+			changes = append(changes, RestoreChange{Kind: links.kind, To: digest.Digest(content)})
+			if opts.DryRun {
+				return nil
+			}
+			if links.kind == "manifest" && !indexInvalidated {
+				// the manifest was removed from the reference index
+				// when it was deleted
+				if err := InvalidateReferenceIndex(ctx, storageDriver); err != nil {
+					return err
+				}
+				indexInvalidated = true
+			}
+			return storageDriver.PutContent(ctx, livePath, content)
+		})
+		if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+			return snapshot, changes, err
+		}
+	}
+	return snapshot, changes, nil
+}
+
+// restoreTags moves the tags kept under tagsPath from current back to
+// previous, read from the snapshot kept in dir of source, returning the
+// changes made.
+func restoreTags(ctx context.Context, storageDriver driver.StorageDriver, source driver.StorageDriver, dir string, tagsPath string, previous, current map[string]digest.Digest, dryRun bool) ([]RestoreChange, error) {
+	var changes []RestoreChange
+	for _, tag := range sortedTags(previous) {
+		if current[tag] == previous[tag] {
+			continue
+		}
+		changes = append(changes, RestoreChange{Kind: "tag", Tag: tag, From: current[tag], To: previous[tag]})
+		if dryRun {
+			continue
+		}
+		// the whole directory of the tag is restored, with its index
+		tagPath := path.Join(tagsPath, tag)
+		err := source.Walk(ctx, path.Join(dir, tagPath), func(fileInfo driver.FileInfo) error {
+			if fileInfo.IsDir() {
+				return nil
+			}
+			return copyBetween(ctx, source, fileInfo.Path(), storageDriver, strings.TrimPrefix(fileInfo.Path(), dir))
+		})
+		if err != nil {
+			return changes, err
+		}
+	}
+	for _, tag := range sortedTags(current) {
+		if _, ok := previous[tag]; ok {
+			continue
+		}
+		changes = append(changes, RestoreChange{Kind: "tag", Tag: tag, From: current[tag]})
+		if dryRun {
+			continue
+		}
+		if err := storageDriver.Delete(ctx, path.Join(tagsPath, tag)); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// readTags returns the digest of each tag kept under tagsPath.
+func readTags(ctx context.Context, storageDriver driver.StorageDriver, tagsPath string) (map[string]digest.Digest, error) {
+	entries, err := storageDriver.List(ctx, tagsPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	tags := make(map[string]digest.Digest, len(entries))
+	for _, entry := range entries {
+		content, err := storageDriver.GetContent(ctx, path.Join(entry, "current", "link"))
+		if err != nil {
+			// a tag being deleted may have lost its link
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		dgst, err := digest.Parse(string(content))
+		if err != nil {
+			return nil, err
+		}
+		tags[path.Base(entry)] = dgst
+	}
+	return tags, nil
+}
+
+func sortedTags(tags map[string]digest.Digest) []string {
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copyBetween copies the file at sourcePath of source to destPath of dest,
+// server side if they are the same driver.
+func copyBetween(ctx context.Context, source driver.StorageDriver, sourcePath string, dest driver.StorageDriver, destPath string) error {
+	if source == dest {
+		return CopyPath(ctx, source, sourcePath, destPath)
+	}
+	content, err := source.GetContent(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	return dest.PutContent(ctx, destPath, content)
+}
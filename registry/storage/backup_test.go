@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry := createRegistry(t, d)
+
+	repo := makeRepository(t, registry, "foo/bar")
+	image := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	if _, err := repo.Blobs(ctx).Create(ctx); err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+
+	// an older complete snapshot and an interrupted one
+	if err := d.PutContent(ctx, "/backups/20000101T000000Z/"+backupManifestName, []byte(`{"id":"20000101T000000Z"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutContent(ctx, "/backups/20000102T000000Z/file", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BackupMetadata(ctx, d, d, BackupOpts{Prefix: "/docker/registry/v2/backups"}); err == nil {
+		t.Fatal("expected a prefix within the storage of the registry to be rejected")
+	}
+	snapshot, err := BackupMetadata(ctx, d, d, BackupOpts{Prefix: "/backups", Keep: 1})
+	if err != nil {
+		t.Fatalf("unexpected error backing up: %v", err)
+	}
+	snapshots, err := ListBackups(ctx, d, "/backups")
+	if err != nil {
+		t.Fatalf("unexpected error listing snapshots: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != snapshot.ID || snapshots[0].Files != snapshot.Files || snapshot.Files == 0 {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+	if _, err := d.Stat(ctx, "/backups/20000101T000000Z"); err == nil {
+		t.Fatal("expected the older snapshot to be removed")
+	}
+
+	// neither blobs nor uploads are backed up
+	if err := d.Walk(ctx, path.Join("/backups", snapshot.ID), func(fileInfo driver.FileInfo) error {
+		if p := fileInfo.Path(); path.Base(p) == "_uploads" || path.Base(p) == "blobs" {
+			t.Errorf("unexpected path in snapshot %s", p)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Tags(ctx).Untag(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+	if _, err := RestoreBackup(ctx, d, d, RestoreOpts{Prefix: "/backups", ID: "20000102T000000Z"}); err == nil {
+		t.Fatal("expected an interrupted snapshot not to be restored")
+	}
+	restored, err := RestoreBackup(ctx, d, d, RestoreOpts{Prefix: "/backups", ID: snapshot.ID, Repository: "foo/bar", DryRun: true})
+	if err != nil || restored == 0 {
+		t.Fatalf("unexpected dry run of %d files: %v", restored, err)
+	}
+	if _, err := repo.Tags(ctx).Get(ctx, "latest"); err == nil {
+		t.Fatal("expected a dry run not to restore the tag")
+	}
+
+	// restoring to other storage copies the files
+	other := inmemory.New()
+	if _, err := RestoreBackup(ctx, other, d, RestoreOpts{Prefix: "/backups", ID: snapshot.ID}); err != nil {
+		t.Fatalf("unexpected error restoring to other storage: %v", err)
+	}
+	if _, err := makeRepository(t, createRegistry(t, other), "foo/bar").Tags(ctx).Get(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error getting the restored tag: %v", err)
+	}
+
+	if _, err := RestoreBackup(ctx, d, d, RestoreOpts{Prefix: "/backups", ID: snapshot.ID, Repository: "foo/bar"}); err != nil {
+		t.Fatalf("unexpected error restoring: %v", err)
+	}
+	desc, err := repo.Tags(ctx).Get(ctx, "latest")
+	if err != nil || desc.Digest != image.manifestDigest {
+		t.Fatalf("unexpected restored tag %v: %v", desc, err)
+	}
+}
+
+func TestRestoreRepositoryAt(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	// the restored tags are resolved through the tag index, which the
+	// restore invalidates
+	repo := makeRepository(t, createRegistry(t, d, TagIndex(0)), "foo/bar")
+	tags := repo.Tags(ctx)
+
+	first := uploadRandomSchema2Image(t, repo)
+	for _, tag := range []string{"latest", "old"} {
+		if err := tags.Tag(ctx, tag, distribution.Descriptor{Digest: first.manifestDigest}); err != nil {
+			t.Fatalf("unexpected error tagging: %v", err)
+		}
+	}
+	snapshot, err := BackupMetadata(ctx, d, d, BackupOpts{Prefix: "/backups"})
+	if err != nil {
+		t.Fatalf("unexpected error backing up: %v", err)
+	}
+
+	second := uploadRandomSchema2Image(t, repo)
+	for _, tag := range []string{"latest", "new"} {
+		if err := tags.Tag(ctx, tag, distribution.Descriptor{Digest: second.manifestDigest}); err != nil {
+			t.Fatalf("unexpected error tagging: %v", err)
+		}
+	}
+	if err := tags.Untag(ctx, "old"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+	revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: "foo/bar", revision: first.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(ctx, revisionPath); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := PointInTimeOpts{Prefix: "/backups", Repository: "foo/bar", At: snapshot.CreatedAt.Add(-time.Minute)}
+	if _, _, err := RestoreRepositoryAt(ctx, d, d, opts); err == nil {
+		t.Fatal("expected no snapshot to be taken before the first one")
+	}
+
+	opts.At = time.Now()
+	opts.DryRun = true
+	_, changes, err := RestoreRepositoryAt(ctx, d, d, opts)
+	if err != nil {
+		t.Fatalf("unexpected error in dry run: %v", err)
+	}
+	var diff []string
+	for _, change := range changes {
+		diff = append(diff, change.String())
+	}
+	expected := []string{
+		"~ tag latest " + second.manifestDigest.String() + " -> " + first.manifestDigest.String(),
+		"+ tag old " + first.manifestDigest.String(),
+		"- tag new " + second.manifestDigest.String(),
+		"+ manifest " + first.manifestDigest.String(),
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("unexpected diff:\n%s\nexpected:\n%s", strings.Join(diff, "\n"), strings.Join(expected, "\n"))
+	}
+	if desc, err := tags.Get(ctx, "latest"); err != nil || desc.Digest != second.manifestDigest {
+		t.Fatalf("expected a dry run not to move tags, got %v: %v", desc, err)
+	}
+
+	opts.DryRun = false
+	restored, changes, err := RestoreRepositoryAt(ctx, d, d, opts)
+	if err != nil || restored.ID != snapshot.ID || len(changes) != len(expected) {
+		t.Fatalf("unexpected restore of %s with %v: %v", restored.ID, changes, err)
+	}
+	all, err := tags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(all)
+	if !reflect.DeepEqual(all, []string{"latest", "old"}) {
+		t.Fatalf("unexpected tags %v", all)
+	}
+	if desc, err := tags.Get(ctx, "latest"); err != nil || desc.Digest != first.manifestDigest {
+		t.Fatalf("unexpected restored tag %v: %v", desc, err)
+	}
+	if _, err := makeManifestService(t, repo).Get(ctx, first.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting the restored manifest: %v", err)
+	}
+
+	// restoring again changes nothing
+	if _, changes, err := RestoreRepositoryAt(ctx, d, d, opts); err != nil || len(changes) != 0 {
+		t.Fatalf("unexpected changes %v: %v", changes, err)
+	}
+}
+
+func TestRestoreInvalidatesReferenceIndex(t *testing.T) {
+	ctx := context.Background()
+	for _, restore := range []struct {
+		name string
+		run  func(d driver.StorageDriver, snapshot BackupSnapshot) error
+	}{
+		{"snapshot", func(d driver.StorageDriver, snapshot BackupSnapshot) error {
+			_, err := RestoreBackup(ctx, d, d, RestoreOpts{Prefix: "/backups", ID: snapshot.ID})
+			return err
+		}},
+		{"point in time", func(d driver.StorageDriver, snapshot BackupSnapshot) error {
+			_, _, err := RestoreRepositoryAt(ctx, d, d, PointInTimeOpts{Prefix: "/backups", Repository: "foo/bar", At: time.Now()})
+			return err
+		}},
+	} {
+		d := inmemory.New()
+		registry := createRegistry(t, d, EnableReferenceIndex)
+		repo := makeRepository(t, registry, "foo/bar")
+		image := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("%s: unexpected error tagging: %v", restore.name, err)
+		}
+		if err := RebuildReferenceIndex(ctx, d, registry, RebuildReferenceIndexOpts{}); err != nil {
+			t.Fatalf("%s: unexpected error rebuilding the reference index: %v", restore.name, err)
+		}
+		snapshot, err := BackupMetadata(ctx, d, d, BackupOpts{Prefix: "/backups"})
+		if err != nil {
+			t.Fatalf("%s: unexpected error backing up: %v", restore.name, err)
+		}
+
+		// deleting the manifest removes it from the index
+		if err := makeManifestService(t, repo).Delete(ctx, image.manifestDigest); err != nil {
+			t.Fatalf("%s: unexpected error deleting the manifest: %v", restore.name, err)
+		}
+		if err := restore.run(d, snapshot); err != nil {
+			t.Fatalf("%s: unexpected error restoring: %v", restore.name, err)
+		}
+
+		if err := MarkAndSweep(ctx, d, registry, GCOpts{}); err != nil {
+			t.Fatalf("%s: unexpected error collecting garbage: %v", restore.name, err)
+		}
+		for dgst := range image.layers {
+			if _, err := registry.BlobStatter().Stat(ctx, dgst); err != nil {
+				t.Errorf("%s: layer %s of the restored manifest was collected: %v", restore.name, dgst, err)
+			}
+		}
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/middleware/faults"
 	"github.com/docker/distribution/registry/storage/driver/testdriver"
 	"github.com/docker/distribution/testutil"
 	"github.com/opencontainers/go-digest"
@@ -611,3 +613,49 @@ func addBlob(ctx context.Context, bs distribution.BlobIngester, desc distributio
 
 	return wr.Commit(ctx, desc)
 }
+
+// TestBlobUploadFaults tests that an upload failing to commit leaves no blob
+// behind, and can be retried once the storage backend recovers.
+func TestBlobUploadFaults(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	faulty, err := faults.New(backend, map[string]interface{}{
+		"operations": map[interface{}]interface{}{
+			"Move": map[interface{}]interface{}{"errorrate": 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("layer"), 1024)
+	desc := distribution.Descriptor{Digest: digest.FromBytes(content), Size: int64(len(content))}
+	upload := func(registry distribution.Namespace) error {
+		repo := makeRepository(t, registry, "foo/faults")
+		bw, err := repo.Blobs(ctx).Create(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(content); err != nil {
+			return err
+		}
+		_, err = bw.Commit(ctx, desc)
+		return err
+	}
+
+	if err := upload(createRegistry(t, faulty)); err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	registry := createRegistry(t, backend)
+	repo := makeRepository(t, registry, "foo/faults")
+	if _, err := repo.Blobs(ctx).Stat(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected the failed upload to leave no blob, got %v", err)
+	}
+
+	if err := upload(registry); err != nil {
+		t.Fatalf("unexpected error retrying the upload: %v", err)
+	}
+	if _, err := repo.Blobs(ctx).Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("unexpected error checking the blob: %v", err)
+	}
+}
@@ -37,6 +37,12 @@ func (bsc *blobStatCollector) Logger(ctx context.Context) cache.Logger {
 // implementation.
 var blobStatterCacheMetrics cache.MetricsTracker = &blobStatCollector{}
 
+// BlobDescriptorCacheMetrics returns the requests to the blob descriptor
+// cache and how many of them hit it.
+func BlobDescriptorCacheMetrics() cache.Metrics {
+	return blobStatterCacheMetrics.Metrics()
+}
+
 func init() {
 	registry := expvar.Get("registry")
 	if registry == nil {
@@ -1,9 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/docker/distribution"
@@ -17,10 +20,12 @@ const blobCacheControlMaxAge = 365 * 24 * time.Hour
 // blobServer simply serves blobs from a driver instance using a path function
 // to identify paths and a descriptor service to fill in metadata.
 type blobServer struct {
-	driver   driver.StorageDriver
-	statter  distribution.BlobStatter
-	pathFn   func(dgst digest.Digest) (string, error)
-	redirect bool // allows disabling URLFor redirects
+	driver     driver.StorageDriver
+	statter    distribution.BlobStatter
+	pathFn     func(dgst digest.Digest) (string, error)
+	redirect   bool // allows disabling URLFor redirects
+	smallBlobs *smallBlobCache
+	buffers    *bufferPool
 }
 
 func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
@@ -34,6 +39,21 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		return err
 	}
 
+	if bs.smallBlobs.small(desc.Size) {
+		// Small blobs are served directly, sparing clients the redirect
+		// and the storage driver a ranged read.
+		content := bs.smallBlobs.get(desc.Digest)
+		if content == nil {
+			content, err = getContent(ctx, bs.driver, path)
+			if err != nil {
+				return err
+			}
+			bs.smallBlobs.add(desc.Digest, content)
+		}
+		bs.serveContent(w, r, desc, bytes.NewReader(content))
+		return nil
+	}
+
 	if bs.redirect {
 		redirectURL, err := bs.driver.URLFor(ctx, path, map[string]interface{}{"method": r.Method})
 		switch err.(type) {
@@ -50,12 +70,36 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		}
 	}
 
+	if opener, ok := bs.driver.(driver.LocalFileOpener); ok {
+		// Local files are left to the HTTP server, which sends them with
+		// sendfile where the platform supports it.
+		f, err := opener.OpenLocalFile(ctx, path)
+		switch err.(type) {
+		case nil:
+			defer f.Close()
+
+			bs.serveContent(w, r, desc, f)
+			return nil
+
+		case driver.ErrUnsupportedMethod:
+			// Fallback to reading the content through the driver.
+		default:
+			return err
+		}
+	}
+
 	br, err := newFileReader(ctx, bs.driver, path, desc.Size)
 	if err != nil {
 		return err
 	}
 	defer br.Close()
 
+	bs.serveContent(w, r, desc, br)
+	return nil
+}
+
+// serveContent writes the headers of a blob and serves its content.
+func (bs *blobServer) serveContent(w http.ResponseWriter, r *http.Request, desc distribution.Descriptor, content io.ReadSeeker) {
 	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, desc.Digest)) // If-None-Match handled by ServeContent
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%.f", blobCacheControlMaxAge.Seconds()))
 
@@ -73,6 +117,8 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		w.Header().Set("Content-Length", fmt.Sprint(desc.Size))
 	}
 
-	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, br)
-	return nil
+	if _, ok := content.(*os.File); !ok && bs.buffers != nil {
+		w = bufferedResponseWriter{ResponseWriter: w, buffers: bs.buffers}
+	}
+	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, content)
 }
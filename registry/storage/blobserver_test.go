@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+)
+
+// fileResponseRecorder records whether the content served was read from a
+// local file, as the HTTP server does before using sendfile.
+type fileResponseRecorder struct {
+	*httptest.ResponseRecorder
+	fromFile bool
+}
+
+func (w *fileResponseRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if lr, ok := r.(*io.LimitedReader); ok {
+		r = lr.R
+	}
+	_, w.fromFile = r.(*os.File)
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+func TestServeBlobFromLocalFile(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "blobserver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := filesystem.New(filesystem.DriverParameters{RootDirectory: root, MaxThreads: 100})
+	registry, err := NewRegistry(ctx, d, BlobBufferSize(1<<20))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	name, _ := reference.WithName("foo/local")
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repo.Blobs(ctx)
+
+	content := []byte("content served from a local file")
+	desc, err := blobs.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	etag := fmt.Sprintf(`"%s"`, desc.Digest)
+
+	for _, testcase := range []struct {
+		ifRange string
+		status  int
+		body    string
+	}{
+		{"", http.StatusPartialContent, string(content[8:])},
+		{etag, http.StatusPartialContent, string(content[8:])},
+		{`"sha256:stale"`, http.StatusOK, string(content)},
+	} {
+		w := &fileResponseRecorder{ResponseRecorder: httptest.NewRecorder()}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Range", "bytes=8-")
+		if testcase.ifRange != "" {
+			r.Header.Set("If-Range", testcase.ifRange)
+		}
+		if err := blobs.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+			t.Fatalf("unexpected error serving blob: %v", err)
+		}
+		if w.Code != testcase.status || w.Body.String() != testcase.body {
+			t.Fatalf("unexpected response with If-Range %q: %d %q", testcase.ifRange, w.Code, w.Body.String())
+		}
+		if !w.fromFile {
+			t.Fatalf("expected the blob to be served from a local file")
+		}
+	}
+}
@@ -15,14 +15,20 @@ import (
 // intentionally a leaky abstraction, providing utility methods that support
 // creating and traversing backend links.
 type blobStore struct {
-	driver  driver.StorageDriver
-	statter distribution.BlobStatter
+	driver     driver.StorageDriver
+	statter    distribution.BlobStatter
+	smallBlobs *smallBlobCache
+	buffers    *bufferPool
 }
 
 var _ distribution.BlobProvider = &blobStore{}
 
 // Get implements the BlobReadService.Get call.
 func (bs *blobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if content := bs.smallBlobs.get(dgst); content != nil {
+		return append([]byte(nil), content...), nil
+	}
+
 	bp, err := bs.path(dgst)
 	if err != nil {
 		return nil, err
@@ -37,6 +43,7 @@ func (bs *blobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error
 
 		return nil, err
 	}
+	bs.smallBlobs.add(dgst, p)
 
 	return p, nil
 }
@@ -58,16 +65,21 @@ func (bs *blobStore) Open(ctx context.Context, dgst digest.Digest) (distribution
 // Put stores the content p in the blob store, calculating the digest. If the
 // content is already present, only the digest will be returned. This should
 // only be used for small objects, such as manifests. This implemented as a convenience for other Put implementations
+// Content taking the small blob fast path is written without checking for it
+// first, rewriting it being as cheap as the check.
 func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
 	dgst := digest.FromBytes(p)
-	desc, err := bs.statter.Stat(ctx, dgst)
-	if err == nil {
-		// content already present
-		return desc, nil
-	} else if err != distribution.ErrBlobUnknown {
-		dcontext.GetLogger(ctx).Errorf("blobStore: error stating content (%v): %v", dgst, err)
-		// real error, return it
-		return distribution.Descriptor{}, err
+	small := bs.smallBlobs.small(int64(len(p)))
+	if !small {
+		desc, err := bs.statter.Stat(ctx, dgst)
+		if err == nil {
+			// content already present
+			return desc, nil
+		} else if err != distribution.ErrBlobUnknown {
+			dcontext.GetLogger(ctx).Errorf("blobStore: error stating content (%v): %v", dgst, err)
+			// real error, return it
+			return distribution.Descriptor{}, err
+		}
 	}
 
 	bp, err := bs.path(dgst)
@@ -75,6 +87,14 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 		return distribution.Descriptor{}, err
 	}
 
+	if err := bs.driver.PutContent(ctx, bp, p); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if small {
+		smallBlobCount.WithValues("Put").Inc(1)
+		bs.smallBlobs.add(dgst, p)
+	}
+
 	// TODO(stevvooe): Write out mediatype here, as well.
 	return distribution.Descriptor{
 		Size: int64(len(p)),
@@ -84,7 +104,7 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 		// for the specific repository.
 		MediaType: "application/octet-stream",
 		Digest:    dgst,
-	}, bs.driver.PutContent(ctx, bp, p)
+	}, nil
 }
 
 func (bs *blobStore) Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error {
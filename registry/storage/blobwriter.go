@@ -41,9 +41,13 @@ type blobWriter struct {
 
 	resumableDigestEnabled bool
 	committed              bool
+
+	// sharded is set if the upload is kept in the sharded layout.
+	sharded bool
 }
 
 var _ distribution.BlobWriter = &blobWriter{}
+var _ distribution.BlobWriteProgressReporter = &blobWriter{}
 
 // ID returns the identifier for this upload.
 func (bw *blobWriter) ID() string {
@@ -111,6 +115,33 @@ func (bw *blobWriter) Size() int64 {
 	return bw.fileWriter.Size()
 }
 
+// Progress reports the upload progress of the underlying file writer. If the
+// driver cannot report progress, all written bytes are assumed persisted.
+func (bw *blobWriter) Progress() distribution.BlobWriteProgress {
+	reporter, ok := bw.fileWriter.(storagedriver.ProgressReporter)
+	if !ok {
+		return distribution.BlobWriteProgress{BytesPersisted: bw.Size()}
+	}
+
+	progress := reporter.Progress()
+	return distribution.BlobWriteProgress{
+		PartsCompleted: progress.PartsCompleted,
+		BytesPersisted: progress.BytesPersisted,
+		BytesBuffered:  progress.BytesBuffered,
+	}
+}
+
+// HashedDigest returns the digest of the content written so far. It is only
+// available once the content is flushed to the file writer, and if the
+// content written by earlier requests was hashed, which requires digest
+// resumption.
+func (bw *blobWriter) HashedDigest() (digest.Digest, int64, bool) {
+	if bw.written == 0 || bw.written != bw.Size() {
+		return "", 0, false
+	}
+	return bw.digester.Digest(), bw.written, true
+}
+
 func (bw *blobWriter) Write(p []byte) (int, error) {
 	// Ensure that the current write offset matches how many bytes have been
 	// written to the digester. If not, we need to update the digest state to
@@ -138,11 +169,20 @@ func (bw *blobWriter) ReadFrom(r io.Reader) (n int64, err error) {
 		return 0, err
 	}
 
+	// A file writer reading the content itself receives it without copying
+	// it through an intermediate buffer, and the content is hashed as it is
+	// read.
+	if rf, ok := bw.fileWriter.(io.ReaderFrom); ok {
+		nn, err := rf.ReadFrom(io.TeeReader(r, bw.digester.Hash()))
+		bw.written += nn
+		return nn, err
+	}
+
 	// Using a TeeReader instead of MultiWriter ensures Copy returns
 	// the amount written to the digester as well as ensuring that we
 	// write to the fileWriter first
 	tee := io.TeeReader(r, bw.fileWriter)
-	nn, err := io.Copy(bw.digester.Hash(), tee)
+	nn, err := bw.blobStore.buffers.copy(bw.digester.Hash(), tee)
 	bw.written += nn
 
 	return nn, err
@@ -352,8 +392,9 @@ func (bw *blobWriter) moveBlob(ctx context.Context, desc distribution.Descriptor
 // resources are already not present, no error will be returned.
 func (bw *blobWriter) removeResources(ctx context.Context) error {
 	dataPath, err := pathFor(uploadDataPathSpec{
-		name: bw.blobStore.repository.Named().Name(),
-		id:   bw.id,
+		name:    bw.blobStore.repository.Named().Name(),
+		id:      bw.id,
+		sharded: bw.sharded,
 	})
 
 	if err != nil {
@@ -79,10 +79,11 @@ type hashStateEntry struct {
 // getStoredHashStates returns a slice of hashStateEntries for this upload.
 func (bw *blobWriter) getStoredHashStates(ctx context.Context) ([]hashStateEntry, error) {
 	uploadHashStatePathPrefix, err := pathFor(uploadHashStatePathSpec{
-		name: bw.blobStore.repository.Named().String(),
-		id:   bw.id,
-		alg:  bw.digester.Digest().Algorithm(),
-		list: true,
+		name:    bw.blobStore.repository.Named().String(),
+		id:      bw.id,
+		alg:     bw.digester.Digest().Algorithm(),
+		list:    true,
+		sharded: bw.sharded,
 	})
 
 	if err != nil {
@@ -130,10 +131,11 @@ func (bw *blobWriter) storeHashState(ctx context.Context) error {
 	}
 
 	uploadHashStatePath, err := pathFor(uploadHashStatePathSpec{
-		name:   bw.blobStore.repository.Named().String(),
-		id:     bw.id,
-		alg:    bw.digester.Digest().Algorithm(),
-		offset: bw.written,
+		name:    bw.blobStore.repository.Named().String(),
+		id:      bw.id,
+		alg:     bw.digester.Digest().Algorithm(),
+		offset:  bw.written,
+		sharded: bw.sharded,
 	})
 
 	if err != nil {
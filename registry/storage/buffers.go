@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// BlobBufferSize is a functional option for NewRegistry. It sets the size of
+// the buffers through which blob content is copied between the storage driver
+// and HTTP clients, when served directly or uploaded. Large buffers spare
+// system calls when transferring large blobs, at the cost of the memory held
+// by each transfer. By default, the buffers of the Go standard library are
+// used.
+func BlobBufferSize(size int) RegistryOption {
+	return func(registry *registry) error {
+		if size <= 0 {
+			return fmt.Errorf("invalid blob buffer size: %d", size)
+		}
+		buffers := newBufferPool(size)
+		registry.blobStore.buffers = buffers
+		registry.blobServer.buffers = buffers
+		return nil
+	}
+}
+
+// bufferPool recycles the buffers blob content is copied through. A nil
+// bufferPool copies with the buffers of the io package.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	return &bufferPool{
+		pool: sync.Pool{
+			New: func() interface{} {
+				buf := make([]byte, size)
+				return &buf
+			},
+		},
+	}
+}
+
+// copy copies src to dst through a buffer of the pool.
+func (p *bufferPool) copy(dst io.Writer, src io.Reader) (int64, error) {
+	if p == nil {
+		return io.Copy(dst, src)
+	}
+	buf := p.pool.Get().(*[]byte)
+	defer p.pool.Put(buf)
+
+	// hide the io.ReaderFrom and io.WriterTo implementations, which would
+	// bypass the buffer
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// bufferedResponseWriter has the content served with http.ServeContent copied
+// through the buffers of a pool, instead of those of the HTTP server.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	buffers *bufferPool
+}
+
+// ReadFrom implements io.ReaderFrom, which http.ServeContent copies the
+// content with.
+func (w bufferedResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	return w.buffers.copy(w.ResponseWriter, r)
+}
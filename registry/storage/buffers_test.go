@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+// sizeRecorder records the largest read from it, or write to it.
+type sizeRecorder struct {
+	r       io.Reader
+	w       http.ResponseWriter
+	largest int
+}
+
+func (s *sizeRecorder) Read(p []byte) (int, error) {
+	if len(p) > s.largest {
+		s.largest = len(p)
+	}
+	return s.r.Read(p)
+}
+
+func (s *sizeRecorder) Header() http.Header {
+	return s.w.Header()
+}
+
+func (s *sizeRecorder) WriteHeader(status int) {
+	s.w.WriteHeader(status)
+}
+
+func (s *sizeRecorder) Write(p []byte) (int, error) {
+	if len(p) > s.largest {
+		s.largest = len(p)
+	}
+	return s.w.Write(p)
+}
+
+func TestBlobBufferSize(t *testing.T) {
+	const size = 1 << 20
+	ctx := context.Background()
+
+	if _, err := NewRegistry(ctx, inmemory.New(), BlobBufferSize(0)); err == nil {
+		t.Fatal("expected an error for an empty buffer size")
+	}
+	registry, err := NewRegistry(ctx, inmemory.New(), BlobBufferSize(size))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	name, _ := reference.WithName("foo/buffers")
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repo.Blobs(ctx)
+
+	content := make([]byte, 3*size)
+	rand.Read(content)
+	dgst := digest.FromBytes(content)
+
+	bw, err := blobs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	upload := &sizeRecorder{r: bytes.NewReader(content)}
+	if _, err := bw.ReadFrom(upload); err != nil {
+		t.Fatalf("unexpected error uploading: %v", err)
+	}
+	if upload.largest != size {
+		t.Fatalf("expected the upload to be read in %d bytes, got %d", size, upload.largest)
+	}
+	desc, err := bw.Commit(ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		t.Fatalf("unexpected error committing upload: %v", err)
+	}
+
+	w := &sizeRecorder{w: httptest.NewRecorder()}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Range", "bytes=1-")
+	if err := blobs.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+	served := w.w.(*httptest.ResponseRecorder)
+	if served.Code != http.StatusPartialContent || !bytes.Equal(served.Body.Bytes(), content[1:]) {
+		t.Fatalf("unexpected response: %d, %d bytes", served.Code, served.Body.Len())
+	}
+	if w.largest != size {
+		t.Fatalf("expected the blob to be served in %d bytes, got %d", size, w.largest)
+	}
+}
@@ -26,8 +26,10 @@ func NewInMemoryBlobDescriptorCacheProvider() cache.BlobDescriptorCacheProvider
 }
 
 func (imbdcp *inMemoryBlobDescriptorCacheProvider) RepositoryScoped(repo string) (distribution.BlobDescriptorService, error) {
-	if _, err := reference.ParseNormalizedNamed(repo); err != nil {
-		return nil, err
+	// Names are checked by the registry, whose constraints on them are
+	// configurable, before reaching the cache.
+	if repo == "" {
+		return nil, reference.ErrNameEmpty
 	}
 
 	imbdcp.mu.RLock()
@@ -41,8 +41,10 @@ func NewRedisBlobDescriptorCacheProvider(pool *redis.Pool) cache.BlobDescriptorC
 
 // RepositoryScoped returns the scoped cache.
 func (rbds *redisBlobDescriptorService) RepositoryScoped(repo string) (distribution.BlobDescriptorService, error) {
-	if _, err := reference.ParseNormalizedNamed(repo); err != nil {
-		return nil, err
+	// Names are checked by the registry, whose constraints on them are
+	// configurable, before reaching the cache.
+	if repo == "" {
+		return nil, reference.ErrNameEmpty
 	}
 
 	return &repositoryScopedRedisBlobDescriptorService{
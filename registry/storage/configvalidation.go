@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// MediaTypeHelmChartConfig is the media type of the config blob of Helm
+// charts stored as OCI artifacts. The blob holds the chart metadata from
+// Chart.yaml, encoded as json.
+const MediaTypeHelmChartConfig = "application/vnd.cncf.helm.config.v1+json"
+
+// maxConfigSize bounds the size of the config blobs that are read to be
+// validated.
+const maxConfigSize = 8 << 20
+
+// imageConfig holds the fields of an image config that must be present.
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	RootFS       *struct {
+		Type string `json:"type"`
+	} `json:"rootfs"`
+}
+
+// helmChartConfig holds the fields of Helm chart metadata that must be
+// present.
+type helmChartConfig struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// verifyConfig reads the config blob of a pushed manifest and checks that
+// it parses as its declared media type. Image configs must name an
+// architecture and an operating system and describe layered root
+// filesystems, Helm chart metadata must name the chart and its version.
+// Other media types are only checked to be json if declared as such.
+func verifyConfig(ctx context.Context, blobs distribution.BlobStore, desc distribution.Descriptor) error {
+	var check func([]byte) error
+	switch {
+	case desc.MediaType == schema2.MediaTypeImageConfig || desc.MediaType == v1.MediaTypeImageConfig:
+		check = checkImageConfig
+	case desc.MediaType == MediaTypeHelmChartConfig:
+		check = checkHelmChartConfig
+	case strings.HasSuffix(desc.MediaType, "+json") || desc.MediaType == "application/json":
+		check = checkJSON
+	default:
+		return nil
+	}
+
+	if desc.Size > maxConfigSize {
+		return configInvalid(desc, fmt.Errorf("size %d exceeds the limit of %d bytes", desc.Size, maxConfigSize))
+	}
+
+	rc, err := blobs.Open(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	p, err := ioutil.ReadAll(io.LimitReader(rc, maxConfigSize))
+	if err != nil {
+		return err
+	}
+
+	if err := check(p); err != nil {
+		return configInvalid(desc, err)
+	}
+
+	return nil
+}
+
+func configInvalid(desc distribution.Descriptor, reason error) error {
+	return distribution.ErrManifestConfigInvalid{
+		Digest:    desc.Digest,
+		MediaType: desc.MediaType,
+		Reason:    reason,
+	}
+}
+
+func checkImageConfig(p []byte) error {
+	var config imageConfig
+	if err := json.Unmarshal(p, &config); err != nil {
+		return err
+	}
+
+	switch {
+	case config.Architecture == "":
+		return errors.New("architecture is missing")
+	case config.OS == "":
+		return errors.New("os is missing")
+	case config.RootFS == nil:
+		return errors.New("rootfs is missing")
+	case config.RootFS.Type != "layers":
+		return fmt.Errorf("unsupported rootfs type %q", config.RootFS.Type)
+	}
+
+	return nil
+}
+
+func checkHelmChartConfig(p []byte) error {
+	var config helmChartConfig
+	if err := json.Unmarshal(p, &config); err != nil {
+		return err
+	}
+
+	switch {
+	case config.Name == "":
+		return errors.New("chart name is missing")
+	case config.Version == "":
+		return errors.New("chart version is missing")
+	}
+
+	return nil
+}
+
+func checkJSON(p []byte) error {
+	if !json.Valid(p) {
+		return errors.New("malformed json")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestVerifyManifestConfig(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New(), EnableConfigValidation)
+	repo := makeRepository(t, registry, "test")
+	manifestService := makeManifestService(t, repo)
+
+	layer, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		mediaType string
+		content   string
+		valid     bool
+	}{
+		{schema2.MediaTypeImageConfig, `{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`, true},
+		{schema2.MediaTypeImageConfig, `{"architecture":"amd64","os":"linux"}`, false},
+		{v1.MediaTypeImageConfig, `{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"}}`, true},
+		{v1.MediaTypeImageConfig, `{"os":"linux","rootfs":{"type":"layers"}}`, false},
+		{v1.MediaTypeImageConfig, `{"architecture":"amd64","os":"linux","rootfs":{"type":"squashfs"}}`, false},
+		{v1.MediaTypeImageConfig, `not json`, false},
+		{MediaTypeHelmChartConfig, `{"apiVersion":"v2","name":"chart","version":"1.0.0"}`, true},
+		{MediaTypeHelmChartConfig, `{"apiVersion":"v2","name":"chart"}`, false},
+		{"application/vnd.example.config.v1+json", `{}`, true},
+		{"application/vnd.example.config.v1+json", `{`, false},
+		{"application/octet-stream", `{`, true},
+	} {
+		config, err := repo.Blobs(ctx).Put(ctx, tc.mediaType, []byte(tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.MediaType = tc.mediaType
+
+		var m distribution.Manifest
+		if tc.mediaType == schema2.MediaTypeImageConfig {
+			m, err = schema2.FromStruct(schema2.Manifest{
+				Versioned: schema2.SchemaVersion,
+				Config:    config,
+				Layers:    []distribution.Descriptor{layer},
+			})
+		} else {
+			m, err = ocischema.FromStruct(ocischema.Manifest{
+				Versioned: manifest.Versioned{
+					SchemaVersion: 2,
+					MediaType:     v1.MediaTypeImageManifest,
+				},
+				Config: config,
+				Layers: []distribution.Descriptor{layer},
+			})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = manifestService.Put(ctx, m)
+		if tc.valid {
+			if err != nil {
+				t.Errorf("%s %s: unexpected error: %v", tc.mediaType, tc.content, err)
+			}
+			continue
+		}
+
+		verificationErrs, ok := err.(distribution.ErrManifestVerification)
+		if !ok || len(verificationErrs) != 1 {
+			t.Errorf("%s %s: expected a verification error, got %v", tc.mediaType, tc.content, err)
+			continue
+		}
+		configErr, ok := verificationErrs[0].(distribution.ErrManifestConfigInvalid)
+		if !ok {
+			t.Errorf("%s %s: expected ErrManifestConfigInvalid, got %T", tc.mediaType, tc.content, verificationErrs[0])
+			continue
+		}
+		if configErr.Digest != config.Digest || configErr.MediaType != tc.mediaType {
+			t.Errorf("%s %s: unexpected error details: %v", tc.mediaType, tc.content, configErr)
+		}
+	}
+}
@@ -61,6 +61,7 @@ func init() {
 // common path and bounds checking.
 type Base struct {
 	storagedriver.StorageDriver
+	stats operationStats
 }
 
 // Format errors received from the storage driver
@@ -80,6 +81,9 @@ func (base *Base) setDriverName(e error) error {
 	case storagedriver.InvalidOffsetError:
 		actual.DriverName = base.StorageDriver.Name()
 		return actual
+	case storagedriver.BackendError:
+		actual.DriverName = base.StorageDriver.Name()
+		return actual
 	default:
 		storageError := storagedriver.Error{
 			DriverName: base.StorageDriver.Name(),
@@ -99,6 +103,7 @@ func (base *Base) GetContent(ctx context.Context, path string) ([]byte, error) {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("GetContent")()
 	start := time.Now()
 	b, e := base.StorageDriver.GetContent(ctx, path)
 	storageAction.WithValues(base.Name(), "GetContent").UpdateSince(start)
@@ -114,6 +119,7 @@ func (base *Base) PutContent(ctx context.Context, path string, content []byte) e
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("PutContent")()
 	start := time.Now()
 	err := base.setDriverName(base.StorageDriver.PutContent(ctx, path, content))
 	storageAction.WithValues(base.Name(), "PutContent").UpdateSince(start)
@@ -133,6 +139,7 @@ func (base *Base) Reader(ctx context.Context, path string, offset int64) (io.Rea
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("Reader")()
 	rc, e := base.StorageDriver.Reader(ctx, path, offset)
 	return rc, base.setDriverName(e)
 }
@@ -146,6 +153,7 @@ func (base *Base) Writer(ctx context.Context, path string, append bool) (storage
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("Writer")()
 	writer, e := base.StorageDriver.Writer(ctx, path, append)
 	return writer, base.setDriverName(e)
 }
@@ -159,6 +167,7 @@ func (base *Base) Stat(ctx context.Context, path string) (storagedriver.FileInfo
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("Stat")()
 	start := time.Now()
 	fi, e := base.StorageDriver.Stat(ctx, path)
 	storageAction.WithValues(base.Name(), "Stat").UpdateSince(start)
@@ -174,6 +183,7 @@ func (base *Base) List(ctx context.Context, path string) ([]string, error) {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("List")()
 	start := time.Now()
 	str, e := base.StorageDriver.List(ctx, path)
 	storageAction.WithValues(base.Name(), "List").UpdateSince(start)
@@ -191,6 +201,7 @@ func (base *Base) Move(ctx context.Context, sourcePath string, destPath string)
 		return storagedriver.InvalidPathError{Path: destPath, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("Move")()
 	start := time.Now()
 	err := base.setDriverName(base.StorageDriver.Move(ctx, sourcePath, destPath))
 	storageAction.WithValues(base.Name(), "Move").UpdateSince(start)
@@ -206,6 +217,7 @@ func (base *Base) Delete(ctx context.Context, path string) error {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("Delete")()
 	start := time.Now()
 	err := base.setDriverName(base.StorageDriver.Delete(ctx, path))
 	storageAction.WithValues(base.Name(), "Delete").UpdateSince(start)
@@ -221,6 +233,7 @@ func (base *Base) URLFor(ctx context.Context, path string, options map[string]in
 		return "", storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("URLFor")()
 	start := time.Now()
 	str, e := base.StorageDriver.URLFor(ctx, path, options)
 	storageAction.WithValues(base.Name(), "URLFor").UpdateSince(start)
@@ -236,5 +249,166 @@ func (base *Base) Walk(ctx context.Context, path string, f storagedriver.WalkFn)
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
+	defer base.stats.begin("Walk")()
 	return base.setDriverName(base.StorageDriver.Walk(ctx, path, f))
 }
+
+// Copy wraps Copy of underlying storage driver, returning ErrUnsupportedMethod
+// if the driver is not a Copier.
+func (base *Base) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.Copy(%q, %q)", base.Name(), sourcePath, destPath)
+
+	if !storagedriver.PathRegexp.MatchString(sourcePath) {
+		return storagedriver.InvalidPathError{Path: sourcePath, DriverName: base.StorageDriver.Name()}
+	} else if !storagedriver.PathRegexp.MatchString(destPath) {
+		return storagedriver.InvalidPathError{Path: destPath, DriverName: base.StorageDriver.Name()}
+	}
+
+	copier, ok := base.StorageDriver.(storagedriver.Copier)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	defer base.stats.begin("Copy")()
+	start := time.Now()
+	err := base.setDriverName(copier.Copy(ctx, sourcePath, destPath))
+	storageAction.WithValues(base.Name(), "Copy").UpdateSince(start)
+	return err
+}
+
+// Export wraps Export of underlying storage driver, returning
+// ErrUnsupportedMethod if the driver is not an Exporter.
+func (base *Base) Export(ctx context.Context, path string, bucket string, key string) error {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.Export(%q, %q, %q)", base.Name(), path, bucket, key)
+
+	if !storagedriver.PathRegexp.MatchString(path) {
+		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	exporter, ok := base.StorageDriver.(storagedriver.Exporter)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	defer base.stats.begin("Export")()
+	start := time.Now()
+	err := base.setDriverName(exporter.Export(ctx, path, bucket, key))
+	storageAction.WithValues(base.Name(), "Export").UpdateSince(start)
+	return err
+}
+
+// DeleteBatch wraps DeleteBatch of underlying storage driver, returning
+// ErrUnsupportedMethod if the driver is not a BatchDeleter.
+func (base *Base) DeleteBatch(ctx context.Context, paths []string) error {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.DeleteBatch(%d paths)", base.Name(), len(paths))
+
+	for _, path := range paths {
+		if !storagedriver.PathRegexp.MatchString(path) {
+			return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+		}
+	}
+
+	deleter, ok := base.StorageDriver.(storagedriver.BatchDeleter)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	defer base.stats.begin("DeleteBatch")()
+	start := time.Now()
+	err := base.setDriverName(deleter.DeleteBatch(ctx, paths))
+	storageAction.WithValues(base.Name(), "DeleteBatch").UpdateSince(start)
+	return err
+}
+
+// ListMultipartUploads wraps ListMultipartUploads of underlying storage
+// driver, returning ErrUnsupportedMethod if the driver is not a
+// MultipartAborter.
+func (base *Base) ListMultipartUploads(ctx context.Context, prefix string) ([]storagedriver.MultipartUpload, error) {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.ListMultipartUploads(%q)", base.Name(), prefix)
+
+	if !storagedriver.PathRegexp.MatchString(prefix) && prefix != "/" {
+		return nil, storagedriver.InvalidPathError{Path: prefix, DriverName: base.StorageDriver.Name()}
+	}
+
+	aborter, ok := base.StorageDriver.(storagedriver.MultipartAborter)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	defer base.stats.begin("ListMultipartUploads")()
+	start := time.Now()
+	uploads, e := aborter.ListMultipartUploads(ctx, prefix)
+	storageAction.WithValues(base.Name(), "ListMultipartUploads").UpdateSince(start)
+	return uploads, base.setDriverName(e)
+}
+
+// AbortMultipartUpload wraps AbortMultipartUpload of underlying storage
+// driver, returning ErrUnsupportedMethod if the driver is not a
+// MultipartAborter.
+func (base *Base) AbortMultipartUpload(ctx context.Context, upload storagedriver.MultipartUpload) error {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.AbortMultipartUpload(%q)", base.Name(), upload.Path)
+
+	if !storagedriver.PathRegexp.MatchString(upload.Path) {
+		return storagedriver.InvalidPathError{Path: upload.Path, DriverName: base.StorageDriver.Name()}
+	}
+
+	aborter, ok := base.StorageDriver.(storagedriver.MultipartAborter)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	defer base.stats.begin("AbortMultipartUpload")()
+	start := time.Now()
+	err := base.setDriverName(aborter.AbortMultipartUpload(ctx, upload))
+	storageAction.WithValues(base.Name(), "AbortMultipartUpload").UpdateSince(start)
+	return err
+}
+
+// GetStorageClass wraps GetStorageClass of underlying storage driver, returning
+// ErrUnsupportedMethod if the driver is not a StorageClasser.
+func (base *Base) GetStorageClass(ctx context.Context, path string) (string, error) {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.GetStorageClass(%q)", base.Name(), path)
+
+	if !storagedriver.PathRegexp.MatchString(path) {
+		return "", storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	classer, ok := base.StorageDriver.(storagedriver.StorageClasser)
+	if !ok {
+		return "", storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	defer base.stats.begin("GetStorageClass")()
+	start := time.Now()
+	class, e := classer.GetStorageClass(ctx, path)
+	storageAction.WithValues(base.Name(), "GetStorageClass").UpdateSince(start)
+	return class, base.setDriverName(e)
+}
+
+// SetStorageClass wraps SetStorageClass of underlying storage driver,
+// returning ErrUnsupportedMethod if the driver is not a StorageClasser.
+func (base *Base) SetStorageClass(ctx context.Context, path string, class string) error {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.SetStorageClass(%q, %q)", base.Name(), path, class)
+
+	if !storagedriver.PathRegexp.MatchString(path) {
+		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	classer, ok := base.StorageDriver.(storagedriver.StorageClasser)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	defer base.stats.begin("SetStorageClass")()
+	start := time.Now()
+	err := base.setDriverName(classer.SetStorageClass(ctx, path, class))
+	storageAction.WithValues(base.Name(), "SetStorageClass").UpdateSince(start)
+	return err
+}
@@ -0,0 +1,54 @@
+package base
+
+import (
+	"sync"
+)
+
+// operationCounts counts the calls to an operation.
+type operationCounts struct {
+	InFlight int64 `json:"inflight"`
+	Total    int64 `json:"total"`
+}
+
+// operationStats counts the calls to the storage driver in flight and
+// completed, by operation, for operators to see where requests are stuck.
+type operationStats struct {
+	mu         sync.Mutex
+	operations map[string]*operationCounts
+}
+
+// begin counts a call to op as in flight, and returns the function counting
+// it as completed.
+func (s *operationStats) begin(op string) func() {
+	s.mu.Lock()
+	if s.operations == nil {
+		s.operations = make(map[string]*operationCounts)
+	}
+	counts, ok := s.operations[op]
+	if !ok {
+		counts = &operationCounts{}
+		s.operations[op] = counts
+	}
+	counts.InFlight++
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		counts.InFlight--
+		counts.Total++
+		s.mu.Unlock()
+	}
+}
+
+// Stats implements storagedriver.StatsReporter, reporting the calls in
+// flight and completed by operation under "operations".
+func (base *Base) Stats() map[string]interface{} {
+	base.stats.mu.Lock()
+	defer base.stats.mu.Unlock()
+
+	operations := make(map[string]operationCounts, len(base.stats.operations))
+	for op, counts := range base.stats.operations {
+		operations[op] = *counts
+	}
+	return map[string]interface{}{"operations": operations}
+}
@@ -57,8 +57,11 @@ type baseEmbed struct {
 // filesystem. All provided paths will be subpaths of the RootDirectory.
 type Driver struct {
 	baseEmbed
+	driver *driver
 }
 
+var _ storagedriver.LocalFileOpener = &Driver{}
+
 // FromParameters constructs a new Driver with a given parameters map
 // Optional Parameters:
 // - rootdirectory
@@ -106,7 +109,25 @@ func New(params DriverParameters) *Driver {
 				StorageDriver: base.NewRegulator(fsDriver, params.MaxThreads),
 			},
 		},
+		driver: fsDriver,
+	}
+}
+
+// OpenLocalFile opens the file holding the content stored at path, for it to
+// be sent straight from the file system.
+func (d *Driver) OpenLocalFile(ctx context.Context, path string) (*os.File, error) {
+	if !storagedriver.PathRegexp.MatchString(path) {
+		return nil, storagedriver.InvalidPathError{Path: path, DriverName: driverName}
 	}
+
+	file, err := os.Open(d.driver.fullPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, storagedriver.PathNotFoundError{Path: path, DriverName: driverName}
+		}
+		return nil, err
+	}
+	return file, nil
 }
 
 // Implement the storagedriver.StorageDriver interface
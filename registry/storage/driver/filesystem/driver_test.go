@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -111,3 +112,36 @@ func TestFromParametersImpl(t *testing.T) {
 	}
 
 }
+
+func TestOpenLocalFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := New(DriverParameters{RootDirectory: root, MaxThreads: minThreads})
+	ctx := context.Background()
+	if err := d.PutContent(ctx, "/a/b", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := d.OpenLocalFile(ctx, "/a/b")
+	if err != nil {
+		t.Fatalf("unexpected error opening file: %v", err)
+	}
+	p, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil || string(p) != "content" {
+		t.Fatalf("unexpected file content: %q, %v", p, err)
+	}
+
+	if _, err := d.OpenLocalFile(ctx, "/a/c"); err == nil {
+		t.Fatal("expected an error opening a missing file")
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error opening a missing file: %v", err)
+	}
+	if _, err := d.OpenLocalFile(ctx, "/a/../../b"); err == nil {
+		t.Fatal("expected an error opening an invalid path")
+	}
+}
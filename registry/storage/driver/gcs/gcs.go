@@ -697,6 +697,21 @@ func (d *driver) Move(context context.Context, sourcePath string, destPath strin
 	return nil
 }
 
+// Copy copies an object stored at sourcePath to destPath without downloading
+// it.
+func (d *driver) Copy(context context.Context, sourcePath string, destPath string) error {
+	_, err := storageCopyObject(d.context(context), d.bucket, d.pathToKey(sourcePath), d.bucket, d.pathToKey(destPath), nil)
+	if err != nil {
+		if status, ok := err.(*googleapi.Error); ok {
+			if status.Code == http.StatusNotFound {
+				return storagedriver.PathNotFoundError{Path: sourcePath}
+			}
+		}
+		return err
+	}
+	return nil
+}
+
 // listAll recursively lists all names of objects stored at "prefix" and its subpaths.
 func (d *driver) listAll(context context.Context, prefix string) ([]string, error) {
 	list := make([]string, 0, 64)
@@ -222,6 +222,15 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	}
 }
 
+// Copy copies an object stored at sourcePath to destPath.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	content, err := d.GetContent(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, destPath, content)
+}
+
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (d *driver) Delete(ctx context.Context, path string) error {
 	d.mutex.Lock()
@@ -238,6 +247,19 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 	}
 }
 
+// DeleteBatch deletes the objects stored at paths.
+func (d *driver) DeleteBatch(ctx context.Context, paths []string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, path := range paths {
+		if err := d.root.delete(normalize(path)); err != nil && err != errNotExists {
+			return err
+		}
+	}
+	return nil
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
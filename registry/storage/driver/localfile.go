@@ -0,0 +1,14 @@
+package driver
+
+import (
+	"context"
+	"os"
+)
+
+// LocalFileOpener is implemented by storage drivers keeping content in local
+// files. Such content may be served by the operating system straight from the
+// file, rather than being copied through the registry.
+type LocalFileOpener interface {
+	// OpenLocalFile opens the file holding the content stored at path.
+	OpenLocalFile(ctx context.Context, path string) (*os.File, error)
+}
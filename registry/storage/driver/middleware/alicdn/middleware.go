@@ -18,7 +18,7 @@ import (
 // constructs temporary signed AliCDN URLs from the storagedriver layer URL,
 // then issues HTTP Temporary Redirects to this AliCDN content URL.
 type aliCDNStorageMiddleware struct {
-	storagedriver.StorageDriver
+	storagemiddleware.Forwarder
 	baseURL   string
 	urlSigner *auth.URLSigner
 	duration  time.Duration
@@ -89,10 +89,10 @@ func newAliCDNStorageMiddleware(storageDriver storagedriver.StorageDriver, optio
 	}
 
 	return &aliCDNStorageMiddleware{
-		StorageDriver: storageDriver,
-		baseURL:       baseURL,
-		urlSigner:     urlSigner,
-		duration:      duration,
+		Forwarder: storagemiddleware.Forwarder{StorageDriver: storageDriver},
+		baseURL:   baseURL,
+		urlSigner: urlSigner,
+		duration:  duration,
 	}, nil
 }
 
@@ -0,0 +1,379 @@
+// Package circuitbreaker provides a storage middleware failing the calls to a
+// storage driver immediately while its backend is down, rather than letting
+// requests pile up waiting for it.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+const (
+	defaultThreshold     = 5
+	defaultCooldown      = 30 * time.Second
+	defaultProbeInterval = 5 * time.Second
+	defaultProbePath     = "/"
+)
+
+// ErrCircuitOpen is the error enclosed in the storagedriver.BackendError
+// returned by the calls failed while the circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// breakerStorageMiddleware counts the consecutive calls to the wrapped driver
+// failing because of the backend. Once threshold calls have failed, the
+// circuit opens: calls fail immediately, and after cooldown the backend is
+// probed every probeInterval until it recovers, which closes the circuit.
+type breakerStorageMiddleware struct {
+	storagemiddleware.Forwarder
+	threshold     int
+	cooldown      time.Duration
+	probeInterval time.Duration
+	probePath     string
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+}
+
+var _ storagedriver.StorageDriver = &breakerStorageMiddleware{}
+
+// New wraps sd with a circuit breaker. The circuit opens after threshold
+// consecutive failures, stays open for at least cooldown, and closes once
+// a Stat of probepath, run every probeinterval, no longer fails:
+//
+//	options:
+//	  threshold: 5
+//	  cooldown: 30s
+//	  probeinterval: 5s
+//	  probepath: /
+func New(sd storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	b := &breakerStorageMiddleware{
+		Forwarder:     storagemiddleware.Forwarder{StorageDriver: sd},
+		threshold:     defaultThreshold,
+		cooldown:      defaultCooldown,
+		probeInterval: defaultProbeInterval,
+		probePath:     defaultProbePath,
+	}
+
+	if t, ok := options["threshold"]; ok {
+		n, ok := t.(int)
+		if !ok || n < 1 {
+			return nil, fmt.Errorf("threshold must be a positive integer")
+		}
+		b.threshold = n
+	}
+	var err error
+	if b.cooldown, err = parseDuration(options, "cooldown", b.cooldown); err != nil {
+		return nil, err
+	}
+	if b.probeInterval, err = parseDuration(options, "probeinterval", b.probeInterval); err != nil {
+		return nil, err
+	}
+	if p, ok := options["probepath"]; ok {
+		if b.probePath, ok = p.(string); !ok {
+			return nil, fmt.Errorf("probepath must be a string")
+		}
+	}
+	return b, nil
+}
+
+func parseDuration(options map[string]interface{}, name string, d time.Duration) (time.Duration, error) {
+	v, ok := options[name]
+	if !ok {
+		return d, nil
+	}
+	switch v := v.(type) {
+	case time.Duration:
+		d = v
+	case string:
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return d, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	default:
+		return d, fmt.Errorf("%s must be a duration", name)
+	}
+	if d <= 0 {
+		return d, fmt.Errorf("%s must be positive", name)
+	}
+	return d, nil
+}
+
+// failure tells whether err shows the backend failing: only the errors the
+// driver classifies as storagedriver.BackendError and timeouts count. Other
+// errors, such as missing paths, canceled requests or uploads cut short by
+// clients, are caused by the call rather than by the backend.
+func failure(err error) bool {
+	if e, ok := err.(storagedriver.Error); ok {
+		err = e.Enclosed
+	}
+	switch err := err.(type) {
+	case storagedriver.BackendError:
+		return true
+	case net.Error:
+		return err.Timeout()
+	}
+	return err == context.DeadlineExceeded
+}
+
+// allow returns the error failing a call immediately while the circuit is
+// open, and nil otherwise.
+func (b *breakerStorageMiddleware) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	return storagedriver.BackendError{
+		DriverName: b.Name(),
+		Kind:       storagedriver.BackendUnavailable,
+		Enclosed:   ErrCircuitOpen,
+	}
+}
+
+// record counts the outcome of a call, opening the circuit once threshold
+// calls in a row have failed. It returns err.
+func (b *breakerStorageMiddleware) record(err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failure(err) {
+		b.failures = 0
+		return err
+	}
+	b.failures++
+	if !b.open && b.failures >= b.threshold {
+		b.open = true
+		dcontext.GetLogger(context.Background()).WithError(err).Warnf("%s storage backend failed %d times in a row, failing calls for %s", b.Name(), b.failures, b.cooldown)
+		go b.probe()
+	}
+	return err
+}
+
+// probe waits for the cool-down, then tries the backend until it answers
+// again and closes the circuit.
+func (b *breakerStorageMiddleware) probe() {
+	time.Sleep(b.cooldown)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), b.probeInterval)
+		_, err := b.StorageDriver.Stat(ctx, b.probePath)
+		cancel()
+		if !failure(err) {
+			break
+		}
+		dcontext.GetLogger(ctx).WithError(err).Debugf("%s storage backend still failing", b.Name())
+		time.Sleep(b.probeInterval)
+	}
+
+	b.mu.Lock()
+	b.open = false
+	b.failures = 0
+	b.mu.Unlock()
+	dcontext.GetLogger(context.Background()).Infof("%s storage backend recovered", b.Name())
+}
+
+// Stats implements storagedriver.StatsReporter, reporting the state of the
+// circuit under "circuitbreaker".
+func (b *breakerStorageMiddleware) Stats() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return map[string]interface{}{
+		"circuitbreaker": map[string]interface{}{
+			"open":      b.open,
+			"failures":  b.failures,
+			"threshold": b.threshold,
+		},
+	}
+}
+
+func (b *breakerStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	content, err := b.StorageDriver.GetContent(ctx, path)
+	return content, b.record(err)
+}
+
+func (b *breakerStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.StorageDriver.PutContent(ctx, path, content))
+}
+
+func (b *breakerStorageMiddleware) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	rc, err := b.StorageDriver.Reader(ctx, path, offset)
+	return rc, b.record(err)
+}
+
+func (b *breakerStorageMiddleware) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	fw, err := b.StorageDriver.Writer(ctx, path, append)
+	if b.record(err) != nil {
+		return nil, err
+	}
+	bw := &breakerFileWriter{FileWriter: fw, breaker: b}
+	if _, ok := fw.(io.ReaderFrom); ok {
+		return &breakerReaderFromWriter{bw}, nil
+	}
+	return bw, nil
+}
+
+func (b *breakerStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	fi, err := b.StorageDriver.Stat(ctx, path)
+	return fi, b.record(err)
+}
+
+func (b *breakerStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	children, err := b.StorageDriver.List(ctx, path)
+	return children, b.record(err)
+}
+
+func (b *breakerStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.StorageDriver.Move(ctx, sourcePath, destPath))
+}
+
+func (b *breakerStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.StorageDriver.Delete(ctx, path))
+}
+
+func (b *breakerStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	if err := b.allow(); err != nil {
+		return "", err
+	}
+	u, err := b.StorageDriver.URLFor(ctx, path, options)
+	return u, b.record(err)
+}
+
+func (b *breakerStorageMiddleware) Walk(ctx context.Context, path string, fn storagedriver.WalkFn) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	// the errors of fn are the caller's, not the backend's
+	var fnErr error
+	err := b.StorageDriver.Walk(ctx, path, func(fi storagedriver.FileInfo) error {
+		fnErr = fn(fi)
+		return fnErr
+	})
+	if err != nil && fnErr != nil && fnErr != storagedriver.ErrSkipDir {
+		return err
+	}
+	return b.record(err)
+}
+
+func (b *breakerStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.Forwarder.Copy(ctx, sourcePath, destPath))
+}
+
+func (b *breakerStorageMiddleware) Export(ctx context.Context, path string, bucket string, key string) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.Forwarder.Export(ctx, path, bucket, key))
+}
+
+func (b *breakerStorageMiddleware) DeleteBatch(ctx context.Context, paths []string) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.Forwarder.DeleteBatch(ctx, paths))
+}
+
+func (b *breakerStorageMiddleware) ListMultipartUploads(ctx context.Context, prefix string) ([]storagedriver.MultipartUpload, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	uploads, err := b.Forwarder.ListMultipartUploads(ctx, prefix)
+	return uploads, b.record(err)
+}
+
+func (b *breakerStorageMiddleware) AbortMultipartUpload(ctx context.Context, upload storagedriver.MultipartUpload) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.Forwarder.AbortMultipartUpload(ctx, upload))
+}
+
+func (b *breakerStorageMiddleware) GetStorageClass(ctx context.Context, path string) (string, error) {
+	if err := b.allow(); err != nil {
+		return "", err
+	}
+	class, err := b.Forwarder.GetStorageClass(ctx, path)
+	return class, b.record(err)
+}
+
+func (b *breakerStorageMiddleware) SetStorageClass(ctx context.Context, path string, class string) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	return b.record(b.Forwarder.SetStorageClass(ctx, path, class))
+}
+
+// breakerFileWriter counts the outcome of the writes and commits of a
+// FileWriter. Cancel and Close are always let through, so that uploads can
+// be cleaned up.
+type breakerFileWriter struct {
+	storagedriver.FileWriter
+	breaker *breakerStorageMiddleware
+}
+
+func (w *breakerFileWriter) Write(p []byte) (int, error) {
+	if err := w.breaker.allow(); err != nil {
+		return 0, err
+	}
+	n, err := w.FileWriter.Write(p)
+	return n, w.breaker.record(err)
+}
+
+func (w *breakerFileWriter) Commit() error {
+	if err := w.breaker.allow(); err != nil {
+		return err
+	}
+	return w.breaker.record(w.FileWriter.Commit())
+}
+
+// breakerReaderFromWriter keeps the io.ReaderFrom implementation of the
+// FileWriters streaming their content, such as the one of the s3 driver.
+type breakerReaderFromWriter struct {
+	*breakerFileWriter
+}
+
+func (w *breakerReaderFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	if err := w.breaker.allow(); err != nil {
+		return 0, err
+	}
+	n, err := w.FileWriter.(io.ReaderFrom).ReadFrom(r)
+	return n, w.breaker.record(err)
+}
+
+func init() {
+	storagemiddleware.Register("circuitbreaker", storagemiddleware.InitFunc(New))
+}
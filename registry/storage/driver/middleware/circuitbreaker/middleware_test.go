@@ -0,0 +1,179 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// flakyDriver fails every Stat while the backend is down.
+type flakyDriver struct {
+	storagedriver.StorageDriver
+
+	mu    sync.Mutex
+	down  bool
+	calls int
+}
+
+func (d *flakyDriver) setDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down = down
+}
+
+func (d *flakyDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	d.mu.Lock()
+	d.calls++
+	down := d.down
+	d.mu.Unlock()
+	if down {
+		return nil, storagedriver.BackendError{DriverName: d.Name(), Kind: storagedriver.BackendUnavailable, Enclosed: errors.New("unreachable")}
+	}
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+func (d *flakyDriver) statCalls() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls
+}
+
+func TestOptions(t *testing.T) {
+	d, err := New(inmemory.New(), map[string]interface{}{
+		"threshold":     3,
+		"cooldown":      "1m",
+		"probeinterval": "10s",
+		"probepath":     "/docker",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := d.(*breakerStorageMiddleware)
+	if b.threshold != 3 || b.cooldown != time.Minute || b.probeInterval != 10*time.Second || b.probePath != "/docker" {
+		t.Fatalf("unexpected options: %+v", b)
+	}
+
+	for _, options := range []map[string]interface{}{
+		{"threshold": 0},
+		{"cooldown": "soon"},
+		{"probeinterval": "-1s"},
+		{"probepath": 1},
+	} {
+		if _, err := New(inmemory.New(), options); err == nil {
+			t.Errorf("expected an error for options %v", options)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	backend := &flakyDriver{StorageDriver: inmemory.New()}
+	if err := backend.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(backend, map[string]interface{}{
+		"threshold":     2,
+		"cooldown":      "50ms",
+		"probeinterval": "10ms",
+		"probepath":     "/a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// missing paths are not failures of the backend
+	for i := 0; i < 3; i++ {
+		if _, err := d.Stat(ctx, "/missing"); !errors.As(err, new(storagedriver.PathNotFoundError)) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	backend.setDown(true)
+	for i := 0; i < 2; i++ {
+		if _, err := d.Stat(ctx, "/a"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the backend error, got %v", err)
+		}
+	}
+
+	// the circuit is open: calls fail without reaching the backend
+	calls := backend.statCalls()
+	_, err = d.Stat(ctx, "/a")
+	var backendErr storagedriver.BackendError
+	if !errors.As(err, &backendErr) || backendErr.Kind != storagedriver.BackendUnavailable || backendErr.Enclosed != ErrCircuitOpen {
+		t.Fatalf("expected the call to fail fast, got %v", err)
+	}
+	if _, err := d.GetContent(ctx, "/a"); err == nil {
+		t.Fatal("expected GetContent to fail fast")
+	}
+	if backend.statCalls() != calls {
+		t.Fatal("expected the backend not to be called while the circuit is open")
+	}
+
+	// probes run after the cool-down and close the circuit once the backend
+	// recovers
+	time.Sleep(100 * time.Millisecond)
+	if backend.statCalls() == calls {
+		t.Fatal("expected the backend to be probed")
+	}
+	if _, err := d.Stat(ctx, "/a"); err == nil {
+		t.Fatal("expected the circuit to stay open while the backend is down")
+	}
+	backend.setDown(false)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := d.Stat(ctx, "/a"); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected the circuit to close, got %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	if err := backend.PutContent(ctx, "/a/b", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(backend, map[string]interface{}{"threshold": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the errors of the walk function do not open the circuit
+	stop := errors.New("stop")
+	if err := d.Walk(ctx, "/", func(storagedriver.FileInfo) error { return stop }); err == nil {
+		t.Fatal("expected the error of the walk function")
+	}
+	if _, err := d.Stat(ctx, "/a/b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// timeoutError is a network error timing out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestFailure(t *testing.T) {
+	backendErr := storagedriver.BackendError{Kind: storagedriver.BackendThrottled}
+	for _, err := range []error{backendErr, storagedriver.Error{Enclosed: backendErr}, timeoutError{}, context.DeadlineExceeded} {
+		if !failure(err) {
+			t.Errorf("expected %v to be a failure of the backend", err)
+		}
+	}
+	for _, err := range []error{nil, storagedriver.PathNotFoundError{}, context.Canceled, io.ErrUnexpectedEOF, errors.New("upload aborted")} {
+		if failure(err) {
+			t.Errorf("expected %v not to be a failure of the backend", err)
+		}
+	}
+}
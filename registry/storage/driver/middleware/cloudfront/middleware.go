@@ -23,7 +23,7 @@ import (
 // constructs temporary signed CloudFront URLs from the storagedriver layer URL,
 // then issues HTTP Temporary Redirects to this CloudFront content URL.
 type cloudFrontStorageMiddleware struct {
-	storagedriver.StorageDriver
+	storagemiddleware.Forwarder
 	awsIPs    *awsIPs
 	urlSigner *sign.URLSigner
 	baseURL   string
@@ -168,11 +168,11 @@ func newCloudFrontStorageMiddleware(storageDriver storagedriver.StorageDriver, o
 	}
 
 	return &cloudFrontStorageMiddleware{
-		StorageDriver: storageDriver,
-		urlSigner:     urlSigner,
-		baseURL:       baseURL,
-		duration:      duration,
-		awsIPs:        awsIPs,
+		Forwarder: storagemiddleware.Forwarder{StorageDriver: storageDriver},
+		urlSigner: urlSigner,
+		baseURL:   baseURL,
+		duration:  duration,
+		awsIPs:    awsIPs,
 	}, nil
 }
 
@@ -0,0 +1,323 @@
+// Package faults provides a storage middleware injecting failures into the
+// calls to a storage driver, to test how the registry copes with a
+// misbehaving backend. It is only registered in builds with the
+// include_faults tag.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// ErrInjected is the error returned by the calls failed on purpose.
+var ErrInjected = errors.New("injected fault")
+
+// operations are the calls faults can be injected into. Write and Commit are
+// calls to the FileWriters returned by Writer.
+var operations = []string{"GetContent", "PutContent", "Reader", "Writer", "Write", "Commit", "Stat", "List", "Move", "Delete", "URLFor", "Walk"}
+
+// rule describes the faults injected into an operation.
+type rule struct {
+	// errorRate is the probability of a call failing with ErrInjected.
+	errorRate float64
+
+	// latency delays every call.
+	latency time.Duration
+
+	// truncateRate is the probability of the content read by GetContent or
+	// Reader, or written by Write, being cut short.
+	truncateRate float64
+}
+
+// faultsStorageMiddleware injects faults into the calls to the wrapped
+// driver, according to the rule of each operation.
+type faultsStorageMiddleware struct {
+	storagemiddleware.Forwarder
+	rules map[string]rule
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ storagedriver.StorageDriver = &faultsStorageMiddleware{}
+
+// New wraps sd with a middleware injecting faults. The errorrate, latency and
+// truncaterate options apply to every operation, unless overridden by the
+// options of the operation under operations, and seed makes the faults
+// reproducible:
+//
+//	options:
+//	  seed: 42
+//	  errorrate: 0.01
+//	  operations:
+//	    Reader:
+//	      latency: 200ms
+//	      truncaterate: 0.1
+func New(sd storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	defaults, err := parseRule(options, rule{})
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]rule, len(operations))
+	for _, op := range operations {
+		rules[op] = defaults
+	}
+	if o, ok := options["operations"]; ok {
+		ops, ok := o.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operations must be a map of operations to options")
+		}
+		for k, v := range ops {
+			op := fmt.Sprint(k)
+			if _, ok := rules[op]; !ok {
+				return nil, fmt.Errorf("unknown operation %q, must be one of %s", op, strings.Join(operations, ", "))
+			}
+			opOptions, ok := v.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("the options of %s must be a map", op)
+			}
+			converted := make(map[string]interface{}, len(opOptions))
+			for name, value := range opOptions {
+				converted[fmt.Sprint(name)] = value
+			}
+			if rules[op], err = parseRule(converted, defaults); err != nil {
+				return nil, fmt.Errorf("%s: %v", op, err)
+			}
+		}
+	}
+
+	seed := time.Now().UnixNano()
+	if s, ok := options["seed"]; ok {
+		n, ok := s.(int)
+		if !ok {
+			return nil, fmt.Errorf("seed must be an integer")
+		}
+		seed = int64(n)
+	}
+
+	return &faultsStorageMiddleware{
+		Forwarder: storagemiddleware.Forwarder{StorageDriver: sd},
+		rules:     rules,
+		rand:      rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+func parseRule(options map[string]interface{}, r rule) (rule, error) {
+	var err error
+	if r.errorRate, err = parseRate(options, "errorrate", r.errorRate); err != nil {
+		return r, err
+	}
+	if r.truncateRate, err = parseRate(options, "truncaterate", r.truncateRate); err != nil {
+		return r, err
+	}
+	if l, ok := options["latency"]; ok {
+		switch v := l.(type) {
+		case time.Duration:
+			r.latency = v
+		case string:
+			if r.latency, err = time.ParseDuration(v); err != nil {
+				return r, fmt.Errorf("invalid latency: %v", err)
+			}
+		default:
+			return r, fmt.Errorf("latency must be a duration")
+		}
+	}
+	return r, nil
+}
+
+func parseRate(options map[string]interface{}, name string, rate float64) (float64, error) {
+	v, ok := options[name]
+	if !ok {
+		return rate, nil
+	}
+	switch v := v.(type) {
+	case float64:
+		rate = v
+	case int:
+		rate = float64(v)
+	default:
+		return rate, fmt.Errorf("%s must be a number", name)
+	}
+	if rate < 0 || rate > 1 {
+		return rate, fmt.Errorf("%s must be between 0 and 1", name)
+	}
+	return rate, nil
+}
+
+// chance returns true with the given probability.
+func (f *faultsStorageMiddleware) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64() < p
+}
+
+// inject applies the rule of op, returning ErrInjected if the call fails.
+func (f *faultsStorageMiddleware) inject(ctx context.Context, op string) error {
+	r := f.rules[op]
+	if r.latency > 0 {
+		select {
+		case <-time.After(r.latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if f.chance(r.errorRate) {
+		return storagedriver.Error{DriverName: f.Name(), Enclosed: ErrInjected}
+	}
+	return nil
+}
+
+// truncate reports whether the content of a call to op is cut short.
+func (f *faultsStorageMiddleware) truncate(op string) bool {
+	return f.chance(f.rules[op].truncateRate)
+}
+
+// cut returns a random length shorter than n.
+func (f *faultsStorageMiddleware) cut(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Intn(n)
+}
+
+func (f *faultsStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if err := f.inject(ctx, "GetContent"); err != nil {
+		return nil, err
+	}
+	content, err := f.StorageDriver.GetContent(ctx, path)
+	if err == nil && f.truncate("GetContent") {
+		content = content[:f.cut(len(content))]
+	}
+	return content, err
+}
+
+func (f *faultsStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := f.inject(ctx, "PutContent"); err != nil {
+		return err
+	}
+	return f.StorageDriver.PutContent(ctx, path, content)
+}
+
+func (f *faultsStorageMiddleware) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if err := f.inject(ctx, "Reader"); err != nil {
+		return nil, err
+	}
+	rc, err := f.StorageDriver.Reader(ctx, path, offset)
+	if err != nil || !f.truncate("Reader") {
+		return rc, err
+	}
+
+	// end the stream early, as a dropped connection would
+	fi, err := f.StorageDriver.Stat(ctx, path)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &truncatedReader{
+		Reader: io.LimitReader(rc, int64(f.cut(int(fi.Size()-offset)))),
+		Closer: rc,
+	}, nil
+}
+
+func (f *faultsStorageMiddleware) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	if err := f.inject(ctx, "Writer"); err != nil {
+		return nil, err
+	}
+	fw, err := f.StorageDriver.Writer(ctx, path, append)
+	if err != nil {
+		return nil, err
+	}
+	return &faultsFileWriter{FileWriter: fw, ctx: ctx, faults: f}, nil
+}
+
+func (f *faultsStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if err := f.inject(ctx, "Stat"); err != nil {
+		return nil, err
+	}
+	return f.StorageDriver.Stat(ctx, path)
+}
+
+func (f *faultsStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	if err := f.inject(ctx, "List"); err != nil {
+		return nil, err
+	}
+	return f.StorageDriver.List(ctx, path)
+}
+
+func (f *faultsStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := f.inject(ctx, "Move"); err != nil {
+		return err
+	}
+	return f.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+func (f *faultsStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if err := f.inject(ctx, "Delete"); err != nil {
+		return err
+	}
+	return f.StorageDriver.Delete(ctx, path)
+}
+
+func (f *faultsStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	if err := f.inject(ctx, "URLFor"); err != nil {
+		return "", err
+	}
+	return f.StorageDriver.URLFor(ctx, path, options)
+}
+
+func (f *faultsStorageMiddleware) Walk(ctx context.Context, path string, fn storagedriver.WalkFn) error {
+	if err := f.inject(ctx, "Walk"); err != nil {
+		return err
+	}
+	return f.StorageDriver.Walk(ctx, path, fn)
+}
+
+// truncatedReader ends before the content it reads from, without an error.
+type truncatedReader struct {
+	io.Reader
+	io.Closer
+}
+
+// faultsFileWriter injects faults into the calls to a FileWriter.
+type faultsFileWriter struct {
+	storagedriver.FileWriter
+	ctx    context.Context
+	faults *faultsStorageMiddleware
+}
+
+func (w *faultsFileWriter) Write(p []byte) (int, error) {
+	if err := w.faults.inject(w.ctx, "Write"); err != nil {
+		return 0, err
+	}
+	if w.faults.truncate("Write") {
+		// write part of p, as an interrupted request would
+		n, err := w.FileWriter.Write(p[:w.faults.cut(len(p))])
+		if err == nil {
+			err = storagedriver.Error{DriverName: w.faults.Name(), Enclosed: ErrInjected}
+		}
+		return n, err
+	}
+	return w.FileWriter.Write(p)
+}
+
+func (w *faultsFileWriter) Commit() error {
+	if err := w.faults.inject(w.ctx, "Commit"); err != nil {
+		return err
+	}
+	return w.FileWriter.Commit()
+}
@@ -0,0 +1,97 @@
+package faults
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestOptions(t *testing.T) {
+	d, err := New(inmemory.New(), map[string]interface{}{
+		"seed":      1,
+		"errorrate": 0.5,
+		"operations": map[interface{}]interface{}{
+			"Reader": map[interface{}]interface{}{
+				"latency":      "10ms",
+				"truncaterate": 1,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rules := d.(*faultsStorageMiddleware).rules
+	if r := rules["Stat"]; r != (rule{errorRate: 0.5}) {
+		t.Fatalf("unexpected default rule: %+v", r)
+	}
+	if r := rules["Reader"]; r != (rule{errorRate: 0.5, latency: 10 * time.Millisecond, truncateRate: 1}) {
+		t.Fatalf("unexpected Reader rule: %+v", r)
+	}
+
+	for _, options := range []map[string]interface{}{
+		{"errorrate": 2},
+		{"latency": "soon"},
+		{"operations": map[interface{}]interface{}{"Frobnicate": map[interface{}]interface{}{}}},
+	} {
+		if _, err := New(inmemory.New(), options); err == nil {
+			t.Errorf("expected an error for options %v", options)
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	content := []byte("0123456789")
+	if err := backend.PutContent(ctx, "/a", content); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(backend, map[string]interface{}{
+		"seed": 1,
+		"operations": map[interface{}]interface{}{
+			"Stat":       map[interface{}]interface{}{"errorrate": 1},
+			"GetContent": map[interface{}]interface{}{"truncaterate": 1},
+			"Reader":     map[interface{}]interface{}{"truncaterate": 1},
+			"Write":      map[interface{}]interface{}{"truncaterate": 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Stat(ctx, "/a"); err == nil {
+		t.Fatal("expected Stat to fail")
+	} else if e, ok := err.(storagedriver.Error); !ok || e.Enclosed != ErrInjected {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := d.List(ctx, "/"); err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+
+	if p, err := d.GetContent(ctx, "/a"); err != nil || len(p) >= len(content) {
+		t.Fatalf("expected truncated content, got %q, %v", p, err)
+	}
+	rc, err := d.Reader(ctx, "/a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || len(p) >= len(content)-2 {
+		t.Fatalf("expected truncated stream, got %q, %v", p, err)
+	}
+
+	fw, err := d.Writer(ctx, "/b", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Cancel()
+	if n, err := fw.Write(content); err == nil || n >= len(content) {
+		t.Fatalf("expected a short write, got %d, %v", n, err)
+	}
+}
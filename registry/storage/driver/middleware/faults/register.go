@@ -0,0 +1,11 @@
+// +build include_faults
+
+package faults
+
+import (
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+func init() {
+	storagemiddleware.Register("faults", storagemiddleware.InitFunc(New))
+}
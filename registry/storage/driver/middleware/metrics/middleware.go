@@ -0,0 +1,263 @@
+// Package metrics provides a storage middleware recording the latency and
+// the errors of the calls to any storage driver, labeled with the name of the
+// driver, so that every backend is observed the same way.
+package metrics
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	prometheus "github.com/docker/distribution/metrics"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	gometrics "github.com/docker/go-metrics"
+)
+
+var (
+	namespace = gometrics.NewNamespace(prometheus.NamespacePrefix, "storage_driver", nil)
+
+	// operationDuration is the latency of the calls to the driver, labeled
+	// with the name of the driver and of the operation.
+	operationDuration = namespace.NewLabeledTimer("operation", "The number of seconds the calls to the storage driver take", "driver", "operation")
+
+	// operationErrors counts the calls to the driver which failed, labeled
+	// with the class of the error.
+	operationErrors = namespace.NewLabeledCounter("errors", "The number of calls to the storage driver which failed", "driver", "operation", "error")
+)
+
+// metricsStorageMiddleware records the latency and the errors of the calls
+// to the wrapped driver.
+type metricsStorageMiddleware struct {
+	storagemiddleware.Forwarder
+}
+
+var _ storagedriver.StorageDriver = &metricsStorageMiddleware{}
+
+// New wraps sd with a middleware recording metrics of its calls. It takes no
+// options.
+func New(sd storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return &metricsStorageMiddleware{Forwarder: storagemiddleware.Forwarder{StorageDriver: sd}}, nil
+}
+
+// observe records a call to op which started at start and returned err.
+func (m *metricsStorageMiddleware) observe(op string, start time.Time, err error) {
+	m.observeDuration(op, time.Since(start), err)
+}
+
+// observeDuration records a call to op which took d and returned err.
+func (m *metricsStorageMiddleware) observeDuration(op string, d time.Duration, err error) {
+	operationDuration.WithValues(m.Name(), op).Update(d)
+	if err != nil {
+		operationErrors.WithValues(m.Name(), op, errorClass(err)).Inc(1)
+	}
+}
+
+// requestCanceledCode is the code of the errors returned by the AWS SDK for
+// requests whose context was canceled, which do not enclose context.Canceled.
+const requestCanceledCode = "RequestCanceled"
+
+// errorClass classifies err, keeping the errors expected in the normal course
+// of operations, such as missing paths, apart from the failures of the
+// backend.
+func errorClass(err error) string {
+	if e, ok := err.(storagedriver.Error); ok {
+		err = e.Enclosed
+	}
+	switch err.(type) {
+	case storagedriver.PathNotFoundError:
+		return "not_found"
+	case storagedriver.InvalidPathError, storagedriver.InvalidOffsetError:
+		return "invalid"
+	case storagedriver.ErrUnsupportedMethod:
+		return "unsupported"
+	case storagedriver.BackendError:
+		return "backend"
+	}
+	if coded, ok := err.(interface{ Code() string }); ok && coded.Code() == requestCanceledCode {
+		return "canceled"
+	}
+	switch err {
+	case context.Canceled, context.DeadlineExceeded:
+		return "canceled"
+	case storagedriver.ErrSkipDir:
+		return "skip"
+	}
+	return "other"
+}
+
+func (m *metricsStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	start := time.Now()
+	content, err := m.StorageDriver.GetContent(ctx, path)
+	m.observe("GetContent", start, err)
+	return content, err
+}
+
+func (m *metricsStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	start := time.Now()
+	err := m.StorageDriver.PutContent(ctx, path, content)
+	m.observe("PutContent", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := m.StorageDriver.Reader(ctx, path, offset)
+	m.observe("Reader", start, err)
+	return rc, err
+}
+
+func (m *metricsStorageMiddleware) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	start := time.Now()
+	fw, err := m.StorageDriver.Writer(ctx, path, append)
+	m.observe("Writer", start, err)
+	if err != nil {
+		return nil, err
+	}
+	mw := &metricsFileWriter{FileWriter: fw, metrics: m}
+	if _, ok := fw.(io.ReaderFrom); ok {
+		return &metricsReaderFromWriter{mw}, nil
+	}
+	return mw, nil
+}
+
+func (m *metricsStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	start := time.Now()
+	fi, err := m.StorageDriver.Stat(ctx, path)
+	m.observe("Stat", start, err)
+	return fi, err
+}
+
+func (m *metricsStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	start := time.Now()
+	entries, err := m.StorageDriver.List(ctx, path)
+	m.observe("List", start, err)
+	return entries, err
+}
+
+func (m *metricsStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	start := time.Now()
+	err := m.StorageDriver.Move(ctx, sourcePath, destPath)
+	m.observe("Move", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) Delete(ctx context.Context, path string) error {
+	start := time.Now()
+	err := m.StorageDriver.Delete(ctx, path)
+	m.observe("Delete", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	start := time.Now()
+	u, err := m.StorageDriver.URLFor(ctx, path, options)
+	m.observe("URLFor", start, err)
+	return u, err
+}
+
+// Walk records the time spent by the driver alone, leaving out the time spent
+// in fn, and the errors of the driver rather than the ones of fn.
+func (m *metricsStorageMiddleware) Walk(ctx context.Context, path string, fn storagedriver.WalkFn) error {
+	start := time.Now()
+	var inFn time.Duration
+	var fnErr error
+	err := m.StorageDriver.Walk(ctx, path, func(fi storagedriver.FileInfo) error {
+		fnStart := time.Now()
+		fnErr = fn(fi)
+		inFn += time.Since(fnStart)
+		return fnErr
+	})
+	observed := err
+	if err != nil && fnErr != nil && fnErr != storagedriver.ErrSkipDir {
+		observed = nil
+	}
+	m.observeDuration("Walk", time.Since(start)-inFn, observed)
+	return err
+}
+
+func (m *metricsStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	start := time.Now()
+	err := m.Forwarder.Copy(ctx, sourcePath, destPath)
+	m.observe("Copy", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) Export(ctx context.Context, path string, bucket string, key string) error {
+	start := time.Now()
+	err := m.Forwarder.Export(ctx, path, bucket, key)
+	m.observe("Export", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) DeleteBatch(ctx context.Context, paths []string) error {
+	start := time.Now()
+	err := m.Forwarder.DeleteBatch(ctx, paths)
+	m.observe("DeleteBatch", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) ListMultipartUploads(ctx context.Context, prefix string) ([]storagedriver.MultipartUpload, error) {
+	start := time.Now()
+	uploads, err := m.Forwarder.ListMultipartUploads(ctx, prefix)
+	m.observe("ListMultipartUploads", start, err)
+	return uploads, err
+}
+
+func (m *metricsStorageMiddleware) AbortMultipartUpload(ctx context.Context, upload storagedriver.MultipartUpload) error {
+	start := time.Now()
+	err := m.Forwarder.AbortMultipartUpload(ctx, upload)
+	m.observe("AbortMultipartUpload", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) GetStorageClass(ctx context.Context, path string) (string, error) {
+	start := time.Now()
+	class, err := m.Forwarder.GetStorageClass(ctx, path)
+	m.observe("GetStorageClass", start, err)
+	return class, err
+}
+
+func (m *metricsStorageMiddleware) SetStorageClass(ctx context.Context, path string, class string) error {
+	start := time.Now()
+	err := m.Forwarder.SetStorageClass(ctx, path, class)
+	m.observe("SetStorageClass", start, err)
+	return err
+}
+
+func (m *metricsStorageMiddleware) OpenLocalFile(ctx context.Context, path string) (*os.File, error) {
+	start := time.Now()
+	f, err := m.Forwarder.OpenLocalFile(ctx, path)
+	m.observe("OpenLocalFile", start, err)
+	return f, err
+}
+
+// metricsFileWriter records the latency and the errors of the commits of a
+// FileWriter. Writes are not recorded, for they are buffered by most drivers.
+type metricsFileWriter struct {
+	storagedriver.FileWriter
+	metrics *metricsStorageMiddleware
+}
+
+func (w *metricsFileWriter) Commit() error {
+	start := time.Now()
+	err := w.FileWriter.Commit()
+	w.metrics.observe("Commit", start, err)
+	return err
+}
+
+// metricsReaderFromWriter keeps the io.ReaderFrom implementation of the
+// FileWriters streaming their content, such as the one of the s3 driver.
+type metricsReaderFromWriter struct {
+	*metricsFileWriter
+}
+
+func (w *metricsReaderFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	return w.FileWriter.(io.ReaderFrom).ReadFrom(r)
+}
+
+func init() {
+	gometrics.Register(namespace)
+	storagemiddleware.Register("metrics", storagemiddleware.InitFunc(New))
+}
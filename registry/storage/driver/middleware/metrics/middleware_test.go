@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// samples returns the values of the samples of the metric family ending with
+// suffix, keyed by their labels.
+func samples(t *testing.T, suffix string) map[string]float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %v", err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		if !strings.HasSuffix(family.GetName(), suffix) {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetValue())
+			}
+			key := strings.Join(labels, ",")
+			if m.GetHistogram() != nil {
+				values[key] = float64(m.GetHistogram().GetSampleCount())
+			} else {
+				values[key] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	d, err := New(inmemory.New(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	if err := d.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetContent(ctx, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetContent(ctx, "/missing"); err == nil {
+		t.Fatal("expected an error getting a missing path")
+	}
+	if _, err := d.URLFor(ctx, "/a", nil); err == nil {
+		t.Fatal("expected the inmemory driver not to support URLFor")
+	}
+
+	fw, err := d.Writer(ctx, "/b", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	fw.Close()
+
+	calls := samples(t, "storage_driver_operation_seconds")
+	for key, expected := range map[string]float64{
+		"inmemory,GetContent": 2,
+		"inmemory,PutContent": 1,
+		"inmemory,URLFor":     1,
+		"inmemory,Writer":     1,
+		"inmemory,Commit":     1,
+	} {
+		if calls[key] != expected {
+			t.Errorf("unexpected number of calls for %s: %v, expected %v", key, calls[key], expected)
+		}
+	}
+
+	errors := samples(t, "storage_driver_errors_total")
+	for key, expected := range map[string]float64{
+		"inmemory,not_found,GetContent": 1,
+		"inmemory,unsupported,URLFor":   1,
+	} {
+		if errors[key] != expected {
+			t.Errorf("unexpected number of errors for %s: %v, expected %v", key, errors[key], expected)
+		}
+	}
+	if len(errors) != 2 {
+		t.Errorf("unexpected errors: %v", errors)
+	}
+}
+
+// copyingDriver copies objects server side.
+type copyingDriver struct {
+	storagedriver.StorageDriver
+	copies int
+}
+
+func (d *copyingDriver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	d.copies++
+	return nil
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	backend := &copyingDriver{StorageDriver: inmemory.New()}
+	d, err := New(backend, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	// copies are still made by the wrapped driver
+	copier, ok := d.(storagedriver.Copier)
+	if !ok {
+		t.Fatal("expected the middleware to be a Copier")
+	}
+	if err := copier.Copy(ctx, "/a", "/b"); err != nil || backend.copies != 1 {
+		t.Fatalf("expected the copy to be made by the wrapped driver, got %d copies: %v", backend.copies, err)
+	}
+	if calls := samples(t, "storage_driver_operation_seconds"); calls["inmemory,Copy"] != 1 {
+		t.Errorf("unexpected number of copies recorded: %v", calls["inmemory,Copy"])
+	}
+
+	// drivers unable to copy are reported as such, for the copy to be
+	// streamed
+	d, _ = New(struct{ storagedriver.StorageDriver }{inmemory.New()}, nil)
+	if err := d.(storagedriver.Copier).Copy(ctx, "/a", "/b"); err == nil {
+		t.Fatal("expected the driver not to copy")
+	} else if _, ok := err.(storagedriver.ErrUnsupportedMethod); !ok {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+}
+
+// namedDriver gives its own name to a driver, for its metrics to be told
+// apart from the ones of other tests.
+type namedDriver struct {
+	storagedriver.StorageDriver
+	name string
+}
+
+func (d namedDriver) Name() string {
+	return d.name
+}
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	if err := backend.PutContent(ctx, "/a/b", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(namedDriver{StorageDriver: backend, name: "walking"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	// the time spent and the errors returned by the callback are not the
+	// driver's
+	callbackErr := errors.New("callback failed")
+	err = d.Walk(ctx, "/", func(fi storagedriver.FileInfo) error {
+		time.Sleep(100 * time.Millisecond)
+		return callbackErr
+	})
+	if err == nil || !strings.Contains(err.Error(), callbackErr.Error()) {
+		t.Fatalf("expected the error of the callback, got %v", err)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if !strings.HasSuffix(family.GetName(), "storage_driver_operation_seconds") {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetLabel()[0].GetValue() != "walking" {
+				continue
+			}
+			if sum := m.GetHistogram().GetSampleSum(); sum >= 0.1 {
+				t.Errorf("expected the time spent in the callback to be left out, got %vs", sum)
+			}
+		}
+	}
+	if errs := samples(t, "storage_driver_errors_total"); errs["walking,other,Walk"] != 0 {
+		t.Errorf("expected the error of the callback not to be recorded, got %v", errs)
+	}
+}
+
+// codedError is an error with a code, as the ones of the AWS SDK.
+type codedError struct {
+	code string
+}
+
+func (e codedError) Error() string {
+	return e.code
+}
+
+func (e codedError) Code() string {
+	return e.code
+}
+
+func TestErrorClass(t *testing.T) {
+	for err, expected := range map[error]string{
+		context.Canceled:              "canceled",
+		codedError{"RequestCanceled"}: "canceled",
+		storagedriver.Error{Enclosed: codedError{"RequestCanceled"}}: "canceled",
+		codedError{"InternalError"}:                                  "other",
+		storagedriver.PathNotFoundError{}:                            "not_found",
+	} {
+		if class := errorClass(err); class != expected {
+			t.Errorf("unexpected class of %v: %s, expected %s", err, class, expected)
+		}
+	}
+}
@@ -10,7 +10,7 @@ import (
 )
 
 type redirectStorageMiddleware struct {
-	storagedriver.StorageDriver
+	storagemiddleware.Forwarder
 	scheme string
 	host   string
 }
@@ -37,7 +37,7 @@ func newRedirectStorageMiddleware(sd storagedriver.StorageDriver, options map[st
 		return nil, fmt.Errorf("no host specified for redirect baseurl")
 	}
 
-	return &redirectStorageMiddleware{StorageDriver: sd, scheme: u.Scheme, host: u.Host}, nil
+	return &redirectStorageMiddleware{Forwarder: storagemiddleware.Forwarder{StorageDriver: sd}, scheme: u.Scheme, host: u.Host}, nil
 }
 
 func (r *redirectStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
@@ -0,0 +1,205 @@
+// Package rewrite provides a storage middleware rewriting the URLs returned
+// by a storage driver for the clients of some networks, such as the clients
+// outside of the network boundary the registry sits behind, which cannot reach
+// the internal endpoint of the storage backend.
+package rewrite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	dcontext "github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// rule rewrites the URLs returned to the clients it matches: those whose
+// address is in one of networks, or whose requests carry header, with value
+// if set.
+type rule struct {
+	networks []*net.IPNet
+	header   string
+	value    string
+
+	// hosts maps the hosts of the URLs returned by the driver to the hosts
+	// they are rewritten to. If empty, the URLs of every host are rewritten.
+	hosts map[string]string
+
+	// scheme replaces the scheme of the URLs, if set.
+	scheme string
+}
+
+// rewriteStorageMiddleware rewrites the URLs returned by URLFor according to
+// the first rule matching the client of the registry request.
+type rewriteStorageMiddleware struct {
+	storagemiddleware.Forwarder
+	rules []rule
+}
+
+var _ storagedriver.StorageDriver = &rewriteStorageMiddleware{}
+
+// New wraps sd with a middleware rewriting the URLs returned by URLFor. Each
+// rule matches the clients in its networks, or sending its header, and maps
+// the hosts of the URLs and overrides their scheme:
+//
+//	options:
+//	  rules:
+//	    - networks: [203.0.113.0/24]
+//	      header: X-Client-Network
+//	      value: external
+//	      hosts:
+//	        storage.internal.example.com: storage.example.com
+//	      scheme: https
+func New(sd storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	r, ok := options["rules"]
+	if !ok {
+		return nil, fmt.Errorf("no rules provided")
+	}
+	list, ok := r.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rules must be a list")
+	}
+
+	m := &rewriteStorageMiddleware{Forwarder: storagemiddleware.Forwarder{StorageDriver: sd}}
+	for i, v := range list {
+		ruleOptions, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rule %d must be a map", i)
+		}
+		rl, err := parseRule(ruleOptions)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		m.rules = append(m.rules, rl)
+	}
+	return m, nil
+}
+
+func parseRule(options map[interface{}]interface{}) (rule, error) {
+	var r rule
+	var err error
+
+	if n, ok := options["networks"]; ok {
+		networks, ok := n.([]interface{})
+		if !ok {
+			return r, fmt.Errorf("networks must be a list of CIDRs")
+		}
+		for _, cidr := range networks {
+			_, network, err := net.ParseCIDR(fmt.Sprint(cidr))
+			if err != nil {
+				return r, fmt.Errorf("invalid network: %v", err)
+			}
+			r.networks = append(r.networks, network)
+		}
+	}
+	if r.header, err = parseString(options, "header"); err != nil {
+		return r, err
+	}
+	if r.value, err = parseString(options, "value"); err != nil {
+		return r, err
+	}
+	if len(r.networks) == 0 && r.header == "" {
+		return r, fmt.Errorf("networks or header must be set")
+	}
+	if r.value != "" && r.header == "" {
+		return r, fmt.Errorf("value set without a header")
+	}
+
+	if h, ok := options["hosts"]; ok {
+		hosts, ok := h.(map[interface{}]interface{})
+		if !ok {
+			return r, fmt.Errorf("hosts must be a map of hosts to the hosts they are rewritten to")
+		}
+		r.hosts = make(map[string]string, len(hosts))
+		for from, to := range hosts {
+			r.hosts[fmt.Sprint(from)] = fmt.Sprint(to)
+		}
+	}
+	if r.scheme, err = parseString(options, "scheme"); err != nil {
+		return r, err
+	}
+	switch r.scheme {
+	case "", "http", "https":
+	default:
+		return r, fmt.Errorf("scheme must be http or https")
+	}
+	if len(r.hosts) == 0 && r.scheme == "" {
+		return r, fmt.Errorf("hosts or scheme must be set")
+	}
+	return r, nil
+}
+
+func parseString(options map[interface{}]interface{}, name string) (string, error) {
+	v, ok := options[name]
+	if !ok {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+	return s, nil
+}
+
+// URLFor returns the URL of the wrapped driver, rewritten by the first rule
+// matching the client of the registry request.
+func (m *rewriteStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	u, err := m.StorageDriver.URLFor(ctx, path, options)
+	if err != nil {
+		return u, err
+	}
+
+	request, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		// not made for a client
+		return u, nil
+	}
+	ip := net.ParseIP(dcontext.RemoteIP(request))
+	for _, r := range m.rules {
+		if r.matches(ip, request.Header.Get(r.header)) {
+			return r.rewrite(u)
+		}
+	}
+	return u, nil
+}
+
+// matches tells whether the rule applies to the client with the address ip,
+// which sent value in the header of the rule.
+func (r rule) matches(ip net.IP, value string) bool {
+	if r.header != "" && value != "" && (r.value == "" || r.value == value) {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, network := range r.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rule) rewrite(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if len(r.hosts) > 0 {
+		host, ok := r.hosts[u.Host]
+		if !ok {
+			return rawurl, nil
+		}
+		u.Host = host
+	}
+	if r.scheme != "" {
+		u.Scheme = r.scheme
+	}
+	return u.String(), nil
+}
+
+func init() {
+	storagemiddleware.Register("rewrite", storagemiddleware.InitFunc(New))
+}
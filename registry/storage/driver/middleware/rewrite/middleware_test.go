@@ -0,0 +1,88 @@
+package rewrite
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	dcontext "github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// signingDriver returns URLs on the internal endpoint of the backend.
+type signingDriver struct {
+	storagedriver.StorageDriver
+}
+
+func (signingDriver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return "http://storage.internal:9000/bucket" + path + "?Signature=abc", nil
+}
+
+func TestRewrite(t *testing.T) {
+	d, err := New(signingDriver{inmemory.New()}, map[string]interface{}{
+		"rules": []interface{}{
+			map[interface{}]interface{}{
+				"networks": []interface{}{"203.0.113.0/24", "2001:db8::/32"},
+				"hosts": map[interface{}]interface{}{
+					"storage.internal:9000": "storage.example.com",
+				},
+				"scheme": "https",
+			},
+			map[interface{}]interface{}{
+				"header": "X-Client-Network",
+				"value":  "vpn",
+				"scheme": "https",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	for _, tc := range []struct {
+		remoteAddr string
+		header     string
+		expected   string
+	}{
+		{"203.0.113.7:4242", "", "https://storage.example.com/bucket/a/data?Signature=abc"},
+		{"[2001:db8::1]:4242", "", "https://storage.example.com/bucket/a/data?Signature=abc"},
+		{"10.0.0.7:4242", "vpn", "https://storage.internal:9000/bucket/a/data?Signature=abc"},
+		{"10.0.0.7:4242", "office", "http://storage.internal:9000/bucket/a/data?Signature=abc"},
+		{"10.0.0.7:4242", "", "http://storage.internal:9000/bucket/a/data?Signature=abc"},
+	} {
+		r, _ := http.NewRequest("GET", "/v2/a/blobs/sha256:abc", nil)
+		r.RemoteAddr = tc.remoteAddr
+		if tc.header != "" {
+			r.Header.Set("X-Client-Network", tc.header)
+		}
+		ctx := dcontext.WithRequest(context.Background(), r)
+		u, err := d.URLFor(ctx, "/a/data", nil)
+		if err != nil {
+			t.Fatalf("unexpected error getting url: %v", err)
+		}
+		if u != tc.expected {
+			t.Errorf("unexpected url for %s %q: %s, expected %s", tc.remoteAddr, tc.header, u, tc.expected)
+		}
+	}
+
+	// URLs requested outside of a registry request are left alone
+	if u, _ := d.URLFor(context.Background(), "/a/data", nil); u != "http://storage.internal:9000/bucket/a/data?Signature=abc" {
+		t.Errorf("unexpected url: %s", u)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, rules := range []interface{}{
+		"rule",
+		[]interface{}{map[interface{}]interface{}{"scheme": "https"}},
+		[]interface{}{map[interface{}]interface{}{"networks": []interface{}{"10.0.0.0/8"}}},
+		[]interface{}{map[interface{}]interface{}{"networks": []interface{}{"10.0.0.0"}, "scheme": "https"}},
+		[]interface{}{map[interface{}]interface{}{"header": "X-Net", "scheme": "ftp"}},
+		[]interface{}{map[interface{}]interface{}{"value": "vpn", "networks": []interface{}{"10.0.0.0/8"}, "scheme": "https"}},
+	} {
+		if _, err := New(inmemory.New(), map[string]interface{}{"rules": rules}); err == nil {
+			t.Errorf("expected an error for rules %v", rules)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package storagemiddleware
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 )
@@ -37,3 +39,105 @@ func Get(name string, options map[string]interface{}, storageDriver storagedrive
 
 	return nil, fmt.Errorf("no storage middleware registered with name: %s", name)
 }
+
+// Forwarder is embedded by storage middlewares in place of the driver they
+// wrap. Besides the methods of StorageDriver, it forwards the optional
+// interfaces of drivers to the wrapped driver, returning ErrUnsupportedMethod
+// from their methods when it does not implement them, so that copies,
+// batched deletions and storage classes still reach the backend through the
+// middlewares. Callers must therefore be ready for ErrUnsupportedMethod
+// rather than rely on type assertions alone.
+type Forwarder struct {
+	storagedriver.StorageDriver
+}
+
+var (
+	_ storagedriver.Copier           = Forwarder{}
+	_ storagedriver.Exporter         = Forwarder{}
+	_ storagedriver.BatchDeleter     = Forwarder{}
+	_ storagedriver.MultipartAborter = Forwarder{}
+	_ storagedriver.StorageClasser   = Forwarder{}
+	_ storagedriver.LocalFileOpener  = Forwarder{}
+)
+
+func (f Forwarder) unsupported() error {
+	return storagedriver.ErrUnsupportedMethod{DriverName: f.Name()}
+}
+
+// Copy calls Copy of the wrapped driver, if it is a Copier.
+func (f Forwarder) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	copier, ok := f.StorageDriver.(storagedriver.Copier)
+	if !ok {
+		return f.unsupported()
+	}
+	return copier.Copy(ctx, sourcePath, destPath)
+}
+
+// Export calls Export of the wrapped driver, if it is an Exporter.
+func (f Forwarder) Export(ctx context.Context, path string, bucket string, key string) error {
+	exporter, ok := f.StorageDriver.(storagedriver.Exporter)
+	if !ok {
+		return f.unsupported()
+	}
+	return exporter.Export(ctx, path, bucket, key)
+}
+
+// DeleteBatch calls DeleteBatch of the wrapped driver, if it is a
+// BatchDeleter.
+func (f Forwarder) DeleteBatch(ctx context.Context, paths []string) error {
+	deleter, ok := f.StorageDriver.(storagedriver.BatchDeleter)
+	if !ok {
+		return f.unsupported()
+	}
+	return deleter.DeleteBatch(ctx, paths)
+}
+
+// ListMultipartUploads calls ListMultipartUploads of the wrapped driver, if
+// it is a MultipartAborter.
+func (f Forwarder) ListMultipartUploads(ctx context.Context, prefix string) ([]storagedriver.MultipartUpload, error) {
+	aborter, ok := f.StorageDriver.(storagedriver.MultipartAborter)
+	if !ok {
+		return nil, f.unsupported()
+	}
+	return aborter.ListMultipartUploads(ctx, prefix)
+}
+
+// AbortMultipartUpload calls AbortMultipartUpload of the wrapped driver, if
+// it is a MultipartAborter.
+func (f Forwarder) AbortMultipartUpload(ctx context.Context, upload storagedriver.MultipartUpload) error {
+	aborter, ok := f.StorageDriver.(storagedriver.MultipartAborter)
+	if !ok {
+		return f.unsupported()
+	}
+	return aborter.AbortMultipartUpload(ctx, upload)
+}
+
+// GetStorageClass calls GetStorageClass of the wrapped driver, if it is a
+// StorageClasser.
+func (f Forwarder) GetStorageClass(ctx context.Context, path string) (string, error) {
+	classer, ok := f.StorageDriver.(storagedriver.StorageClasser)
+	if !ok {
+		return "", f.unsupported()
+	}
+	return classer.GetStorageClass(ctx, path)
+}
+
+// SetStorageClass calls SetStorageClass of the wrapped driver, if it is a
+// StorageClasser.
+func (f Forwarder) SetStorageClass(ctx context.Context, path string, class string) error {
+	classer, ok := f.StorageDriver.(storagedriver.StorageClasser)
+	if !ok {
+		return f.unsupported()
+	}
+	return classer.SetStorageClass(ctx, path, class)
+}
+
+// OpenLocalFile calls OpenLocalFile of the wrapped driver, if it is a
+// LocalFileOpener.
+func (f Forwarder) OpenLocalFile(ctx context.Context, path string) (*os.File, error) {
+	opener, ok := f.StorageDriver.(storagedriver.LocalFileOpener)
+	if !ok {
+		return nil, f.unsupported()
+	}
+	return opener.OpenLocalFile(ctx, path)
+}
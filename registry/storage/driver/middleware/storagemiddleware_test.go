@@ -0,0 +1,85 @@
+package storagemiddleware
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// classingDriver keeps the storage classes of objects.
+type classingDriver struct {
+	storagedriver.StorageDriver
+	classes map[string]string
+}
+
+func (d *classingDriver) GetStorageClass(ctx context.Context, path string) (string, error) {
+	return d.classes[path], nil
+}
+
+func (d *classingDriver) SetStorageClass(ctx context.Context, path string, class string) error {
+	d.classes[path] = class
+	return nil
+}
+
+func TestForwarder(t *testing.T) {
+	ctx := context.Background()
+
+	backend := &classingDriver{StorageDriver: inmemory.New(), classes: make(map[string]string)}
+	var sd storagedriver.StorageDriver = Forwarder{StorageDriver: backend}
+	classer, ok := sd.(storagedriver.StorageClasser)
+	if !ok {
+		t.Fatal("expected the forwarder to be a StorageClasser")
+	}
+	if err := classer.SetStorageClass(ctx, "/a", "GLACIER"); err != nil {
+		t.Fatalf("unexpected error setting the storage class: %v", err)
+	}
+	if class, err := classer.GetStorageClass(ctx, "/a"); err != nil || class != "GLACIER" {
+		t.Fatalf("expected the storage class of the wrapped driver, got %q: %v", class, err)
+	}
+
+	// the methods the wrapped driver lacks are reported as unsupported
+	f := Forwarder{StorageDriver: backend}
+	unsupported := map[string]error{
+		"DeleteBatch":          f.DeleteBatch(ctx, []string{"/a"}),
+		"AbortMultipartUpload": f.AbortMultipartUpload(ctx, storagedriver.MultipartUpload{Path: "/a"}),
+		"Copy":                 f.Copy(ctx, "/a", "/b"),
+	}
+	_, unsupported["ListMultipartUploads"] = f.ListMultipartUploads(ctx, "/")
+	_, unsupported["OpenLocalFile"] = f.OpenLocalFile(ctx, "/a")
+	for method, err := range unsupported {
+		if _, ok := err.(storagedriver.ErrUnsupportedMethod); !ok {
+			t.Errorf("expected %s to be unsupported, got %v", method, err)
+		}
+	}
+}
+
+func TestForwarderOpenLocalFile(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "forwarder-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	backend, err := filesystem.FromParameters(map[string]interface{}{"rootdirectory": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	var sd storagedriver.StorageDriver = Forwarder{StorageDriver: backend}
+	file, err := sd.(storagedriver.LocalFileOpener).OpenLocalFile(ctx, "/a")
+	if err != nil {
+		t.Fatalf("unexpected error opening the local file: %v", err)
+	}
+	defer file.Close()
+	if p, _ := ioutil.ReadAll(file); string(p) != "content" {
+		t.Errorf("unexpected content: %q", p)
+	}
+}
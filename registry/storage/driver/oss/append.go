@@ -0,0 +1,216 @@
+// +build include_oss
+
+package oss
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/denverdino/aliyungo/oss"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// appendTimeout is the validity of the signed URL of an append request.
+const appendTimeout = 15 * time.Minute
+
+// appendObject appends data to the appendable object at key, creating it if
+// position is 0. position must be the current size of the object. It returns
+// the position of the next append.
+//
+// The client library has no call for the append API, so the request is sent
+// to a signed URL.
+func (d *driver) appendObject(key string, position int64, data []byte) (int64, error) {
+	params := url.Values{}
+	params.Set("append", "")
+	params.Set("position", strconv.FormatInt(position, 10))
+
+	headers := http.Header{}
+	headers.Set("Content-Type", d.getContentType())
+	if position == 0 {
+		// encryption may only be requested when creating the object
+		if d.EncryptionKeyID != "" {
+			headers.Set("x-oss-server-side-encryption", "KMS")
+			headers.Set("x-oss-server-side-encryption-key-id", d.EncryptionKeyID)
+		} else if d.Encrypt {
+			headers.Set("x-oss-server-side-encryption", "AES256")
+		}
+	}
+
+	u := d.Bucket.SignedURLWithMethodForAssumeRole("POST", key, time.Now().Add(appendTimeout), params, headers)
+	req, err := http.NewRequest("POST", u, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		ossErr := &oss.Error{}
+		xml.NewDecoder(resp.Body).Decode(ossErr)
+		ossErr.StatusCode = resp.StatusCode
+		if ossErr.Message == "" {
+			ossErr.Message = resp.Status
+		}
+		return 0, ossErr
+	}
+
+	next, err := strconv.ParseInt(resp.Header.Get("x-oss-next-append-position"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid next append position: %v", err)
+	}
+	return next, nil
+}
+
+// newHTTPClient returns an HTTP client with the settings of the clients the
+// OSS client library sends its requests with: the connect timeout of client
+// and the proxy of the environment.
+func newHTTPClient(client *oss.Client) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialer := net.Dialer{Timeout: client.ConnectTimeout}
+				return dialer.DialContext(ctx, network, addr)
+			},
+			Proxy: http.ProxyFromEnvironment,
+		},
+		Timeout: defaultTimeout,
+	}
+}
+
+// appendableSize returns the size of the appendable object at key, and false
+// if there is no such object.
+func (d *driver) appendableSize(key string) (int64, bool, error) {
+	resp, err := d.Bucket.Head(key, nil)
+	if err != nil {
+		if ossErr, ok := err.(*oss.Error); ok && ossErr.StatusCode == http.StatusNotFound {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("x-oss-object-type") != "Appendable" {
+		return 0, false, nil
+	}
+	return resp.ContentLength, true, nil
+}
+
+// appendWriter writes to an appendable object, appending a chunk every time
+// one is buffered. The content appended is visible at once, so resuming only
+// needs the size of the object and committing has nothing left to do but
+// flush the last chunk.
+type appendWriter struct {
+	driver    *driver
+	key       string
+	position  int64
+	buffer    []byte
+	closed    bool
+	committed bool
+	cancelled bool
+}
+
+func (d *driver) newAppendWriter(key string, position int64) storagedriver.FileWriter {
+	return &appendWriter{
+		driver:   d,
+		key:      key,
+		position: position,
+	}
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("already closed")
+	} else if w.committed {
+		return 0, fmt.Errorf("already committed")
+	} else if w.cancelled {
+		return 0, fmt.Errorf("already cancelled")
+	}
+
+	w.buffer = append(w.buffer, p...)
+	if int64(len(w.buffer)) >= w.driver.ChunkSize {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *appendWriter) Size() int64 {
+	return w.position + int64(len(w.buffer))
+}
+
+// Progress reports the bytes appended to the object and those still
+// buffered.
+func (w *appendWriter) Progress() storagedriver.FileWriterProgress {
+	return storagedriver.FileWriterProgress{
+		BytesPersisted: w.position,
+		BytesBuffered:  int64(len(w.buffer)),
+	}
+}
+
+func (w *appendWriter) Close() error {
+	if w.closed {
+		return fmt.Errorf("already closed")
+	}
+	w.closed = true
+	return w.flush()
+}
+
+func (w *appendWriter) Cancel() error {
+	if w.closed {
+		return fmt.Errorf("already closed")
+	} else if w.committed {
+		return fmt.Errorf("already committed")
+	}
+	w.cancelled = true
+	return w.driver.Bucket.Del(w.key)
+}
+
+func (w *appendWriter) Commit() error {
+	if w.closed {
+		return fmt.Errorf("already closed")
+	} else if w.committed {
+		return fmt.Errorf("already committed")
+	} else if w.cancelled {
+		return fmt.Errorf("already cancelled")
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.position == 0 {
+		// nothing was appended, create the empty object
+		if err := w.driver.Bucket.Put(w.key, nil, w.driver.getContentType(), getPermissions(), w.driver.getOptions()); err != nil {
+			return err
+		}
+	}
+	w.committed = true
+	return nil
+}
+
+// flush appends the buffered content to the object.
+func (w *appendWriter) flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	next, err := w.driver.appendObject(w.key, w.position, w.buffer)
+	if err != nil {
+		return err
+	}
+	w.position = next
+	w.buffer = nil
+	return nil
+}
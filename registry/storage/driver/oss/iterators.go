@@ -0,0 +1,135 @@
+// +build include_oss
+
+package oss
+
+import (
+	"github.com/denverdino/aliyungo/oss"
+)
+
+// listItem is an object or, for listings with a delimiter, a common prefix,
+// in which case Dir is set and Key holds the prefix.
+type listItem struct {
+	oss.Key
+	Dir bool
+}
+
+// objectIterator lists the objects below a prefix, fetching a page at a
+// time and following the markers of truncated responses.
+type objectIterator struct {
+	bucket *oss.Bucket
+	prefix string
+	delim  string
+	max    int
+
+	items     []listItem
+	marker    string
+	truncated bool
+	started   bool
+	err       error
+}
+
+func (d *driver) listObjects(prefix, delim string) *objectIterator {
+	return &objectIterator{
+		bucket: d.Bucket,
+		prefix: prefix,
+		delim:  delim,
+		max:    listMax,
+	}
+}
+
+// Next advances to the next item, fetching the next page if needed. It
+// returns false once all the items have been listed or an error occurred.
+func (it *objectIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.items) > 0 {
+		it.items = it.items[1:]
+	}
+	for len(it.items) == 0 {
+		if it.started && !it.truncated {
+			return false
+		}
+		it.fetch()
+		if it.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// fetch lists the next page of items.
+func (it *objectIterator) fetch() {
+	it.started = true
+	resp, err := it.bucket.List(it.prefix, it.delim, it.marker, it.max)
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	for _, key := range resp.Contents {
+		it.items = append(it.items, listItem{Key: key})
+	}
+	for _, prefix := range resp.CommonPrefixes {
+		it.items = append(it.items, listItem{Key: oss.Key{Key: prefix}, Dir: true})
+	}
+	it.marker = resp.NextMarker
+	it.truncated = resp.IsTruncated && it.marker != ""
+}
+
+// Item returns the current item. It is only valid after Next returned true.
+func (it *objectIterator) Item() listItem {
+	return it.items[0]
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *objectIterator) Err() error {
+	return it.err
+}
+
+// multiIterator lists the incomplete multipart uploads below a prefix. The
+// client library follows the markers of the listing itself, so the uploads
+// are all listed by the first call to Next.
+type multiIterator struct {
+	bucket *oss.Bucket
+	prefix string
+
+	multis  []*oss.Multi
+	started bool
+	err     error
+}
+
+func (d *driver) listMultis(prefix string) *multiIterator {
+	return &multiIterator{
+		bucket: d.Bucket,
+		prefix: prefix,
+	}
+}
+
+// Next advances to the next upload. It returns false once all the uploads
+// have been listed or an error occurred.
+func (it *multiIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.multis, _, it.err = it.bucket.ListMulti(it.prefix, "")
+		return it.err == nil && len(it.multis) > 0
+	}
+	if len(it.multis) > 0 {
+		it.multis = it.multis[1:]
+	}
+	return len(it.multis) > 0
+}
+
+// Item returns the current upload. It is only valid after Next returned
+// true.
+func (it *multiIterator) Item() *oss.Multi {
+	return it.multis[0]
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *multiIterator) Err() error {
+	return it.err
+}
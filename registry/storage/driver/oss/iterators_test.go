@@ -0,0 +1,63 @@
+// +build include_oss
+
+package oss
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	alioss "github.com/denverdino/aliyungo/oss"
+)
+
+func TestObjectIterator(t *testing.T) {
+	keys := []string{"a/1", "a/2", "a/3", "a/4", "a/5"}
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		// serve two keys at a time, after the marker
+		var resp alioss.ListResp
+		marker := r.URL.Query().Get("marker")
+		for _, key := range keys {
+			if key <= marker {
+				continue
+			}
+			if len(resp.Contents) == 2 {
+				resp.IsTruncated = true
+				break
+			}
+			resp.Contents = append(resp.Contents, alioss.Key{Key: key})
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name `xml:"ListBucketResult"`
+			alioss.ListResp
+		}{ListResp: resp})
+	}))
+	defer server.Close()
+
+	client := alioss.NewOSSClient(alioss.Hangzhou, false, "id", "secret", false)
+	client.SetEndpoint(strings.TrimPrefix(server.URL, "http://"))
+	d := &driver{Client: client, Bucket: client.Bucket("bucket")}
+
+	var listed []string
+	it := d.listObjects("a/", "")
+	for it.Next() {
+		listed = append(listed, it.Item().Key.Key)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error listing objects: %v", err)
+	}
+	if strings.Join(listed, ",") != strings.Join(keys, ",") {
+		t.Fatalf("unexpected objects listed: %v", listed)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 pages to be fetched, got %d", requests)
+	}
+	if it.Next() {
+		t.Fatal("expected the iteration to be over")
+	}
+}
@@ -55,6 +55,7 @@ type DriverParameters struct {
 	RootDirectory   string
 	Endpoint        string
 	EncryptionKeyID string
+	Append          bool
 }
 
 func init() {
@@ -75,6 +76,11 @@ type driver struct {
 	Encrypt         bool
 	RootDirectory   string
 	EncryptionKeyID string
+	Append          bool
+
+	// httpClient sends the requests the client library has no call for,
+	// the same way the library sends its own.
+	httpClient *http.Client
 }
 
 type baseEmbed struct {
@@ -171,6 +177,15 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		}
 	}
 
+	appendBool := false
+	appendParam, ok := parameters["append"]
+	if ok {
+		appendBool, ok = appendParam.(bool)
+		if !ok {
+			return nil, fmt.Errorf("The append parameter should be a boolean")
+		}
+	}
+
 	rootDirectory, ok := parameters["rootdirectory"]
 	if !ok {
 		rootDirectory = ""
@@ -193,6 +208,7 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		Internal:        internalBool,
 		Endpoint:        fmt.Sprint(endpoint),
 		EncryptionKeyID: fmt.Sprint(encryptionKeyID),
+		Append:          appendBool,
 	}
 
 	return New(params)
@@ -223,6 +239,8 @@ func New(params DriverParameters) (*Driver, error) {
 		Encrypt:         params.Encrypt,
 		RootDirectory:   params.RootDirectory,
 		EncryptionKeyID: params.EncryptionKeyID,
+		Append:          params.Append,
+		httpClient:      newHTTPClient(client),
 	}
 
 	return &Driver{
@@ -279,8 +297,26 @@ func (d *driver) Reader(ctx context.Context, path string, offset int64) (io.Read
 
 // Writer returns a FileWriter which will store the content written to it
 // at the location designated by "path" after the call to Commit.
+//
+// If the driver uses appendable objects, new content is written with the
+// append API. Uploads started as multipart uploads are still resumed.
 func (d *driver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
 	key := d.ossPath(path)
+	if d.Append {
+		if !append {
+			if err := d.Bucket.Del(key); err != nil {
+				return nil, parseError(path, err)
+			}
+			return d.newAppendWriter(key, 0), nil
+		}
+		size, ok, err := d.appendableSize(key)
+		if err != nil {
+			return nil, parseError(path, err)
+		}
+		if ok {
+			return d.newAppendWriter(key, size), nil
+		}
+	}
 	if !append {
 		// TODO (brianbland): cancel other uploads at this path
 		multi, err := d.Bucket.InitMulti(key, d.getContentType(), getPermissions(), d.getOptions())
@@ -289,11 +325,9 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 		}
 		return d.newWriter(key, multi, nil), nil
 	}
-	multis, _, err := d.Bucket.ListMulti(key, "")
-	if err != nil {
-		return nil, parseError(path, err)
-	}
-	for _, multi := range multis {
+	it := d.listMultis(key)
+	for it.Next() {
+		multi := it.Item()
 		if key != multi.Key {
 			continue
 		}
@@ -301,12 +335,11 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 		if err != nil {
 			return nil, parseError(path, err)
 		}
-		var multiSize int64
-		for _, part := range parts {
-			multiSize += part.Size
-		}
 		return d.newWriter(key, multi, parts), nil
 	}
+	if err := it.Err(); err != nil {
+		return nil, parseError(path, err)
+	}
 	return nil, storagedriver.PathNotFoundError{Path: path}
 }
 
@@ -360,32 +393,21 @@ func (d *driver) List(ctx context.Context, opath string) ([]string, error) {
 	}
 
 	ossPath := d.ossPath(path)
-	listResponse, err := d.Bucket.List(ossPath, "/", "", listMax)
-	if err != nil {
-		return nil, parseError(opath, err)
-	}
-
 	files := []string{}
 	directories := []string{}
 
-	for {
-		for _, key := range listResponse.Contents {
-			files = append(files, strings.Replace(key.Key, d.ossPath(""), prefix, 1))
-		}
-
-		for _, commonPrefix := range listResponse.CommonPrefixes {
-			directories = append(directories, strings.Replace(commonPrefix[0:len(commonPrefix)-1], d.ossPath(""), prefix, 1))
-		}
-
-		if listResponse.IsTruncated {
-			listResponse, err = d.Bucket.List(ossPath, "/", listResponse.NextMarker, listMax)
-			if err != nil {
-				return nil, err
-			}
+	it := d.listObjects(ossPath, "/")
+	for it.Next() {
+		item := it.Item()
+		if item.Dir {
+			directories = append(directories, strings.Replace(item.Key.Key[0:len(item.Key.Key)-1], d.ossPath(""), prefix, 1))
 		} else {
-			break
+			files = append(files, strings.Replace(item.Key.Key, d.ossPath(""), prefix, 1))
 		}
 	}
+	if err := it.Err(); err != nil {
+		return nil, parseError(opath, err)
+	}
 
 	// This is to cover for the cases when the first key equal to ossPath.
 	if len(files) > 0 && files[0] == strings.Replace(ossPath, d.ossPath(""), prefix, 1) {
@@ -422,45 +444,115 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	return d.Delete(ctx, sourcePath)
 }
 
+// Copy copies an object stored at sourcePath to destPath without downloading
+// it.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	err := d.Bucket.CopyLargeFileInParallel(d.ossPath(sourcePath), d.ossPath(destPath),
+		d.getContentType(),
+		getPermissions(),
+		d.getOptions(),
+		maxConcurrency)
+	if err != nil {
+		return parseError(sourcePath, err)
+	}
+	return nil
+}
+
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (d *driver) Delete(ctx context.Context, path string) error {
 	ossPath := d.ossPath(path)
-	listResponse, err := d.Bucket.List(ossPath, "", "", listMax)
-	if err != nil || len(listResponse.Contents) == 0 {
+	ossObjects := make([]oss.Object, 0, listMax)
+	found := false
+
+	it := d.listObjects(ossPath, "")
+	for it.Next() {
+		key := it.Item().Key.Key
+		// Skip keys that are not subpaths (so that deleting "/a" does not delete "/ab").
+		if len(key) > len(ossPath) && key[len(ossPath)] != '/' {
+			continue
+		}
+		found = true
+
+		ossObjects = append(ossObjects, oss.Object{Key: key})
+		if len(ossObjects) == listMax {
+			if err := d.Bucket.DelMulti(oss.Delete{Quiet: false, Objects: ossObjects}); err != nil {
+				return err
+			}
+			ossObjects = ossObjects[:0]
+		}
+	}
+	if err := it.Err(); err != nil {
+		return parseError(path, err)
+	}
+	if !found {
 		return storagedriver.PathNotFoundError{Path: path}
 	}
 
-	ossObjects := make([]oss.Object, listMax)
+	if len(ossObjects) > 0 {
+		return d.Bucket.DelMulti(oss.Delete{Quiet: false, Objects: ossObjects})
+	}
+	return nil
+}
 
-	for len(listResponse.Contents) > 0 {
-		numOssObjects := len(listResponse.Contents)
-		for index, key := range listResponse.Contents {
-			// Stop if we encounter a key that is not a subpath (so that deleting "/a" does not delete "/ab").
-			if len(key.Key) > len(ossPath) && (key.Key)[len(ossPath)] != '/' {
-				numOssObjects = index
-				break
+// DeleteBatch recursively deletes all objects stored at paths and their
+// subpaths, using as few delete requests as possible.
+func (d *driver) DeleteBatch(ctx context.Context, paths []string) error {
+	ossObjects := make([]oss.Object, 0, listMax)
+	for _, path := range paths {
+		ossPath := d.ossPath(path)
+		it := d.listObjects(ossPath, "")
+		for it.Next() {
+			key := it.Item().Key.Key
+			// Skip keys that are not subpaths (so that deleting "/a" does not delete "/ab").
+			if len(key) > len(ossPath) && key[len(ossPath)] != '/' {
+				continue
 			}
-			ossObjects[index].Key = key.Key
-		}
 
-		err := d.Bucket.DelMulti(oss.Delete{Quiet: false, Objects: ossObjects[0:numOssObjects]})
-		if err != nil {
-			return nil
+			ossObjects = append(ossObjects, oss.Object{Key: key})
+			if len(ossObjects) == listMax {
+				if err := d.Bucket.DelMulti(oss.Delete{Quiet: true, Objects: ossObjects}); err != nil {
+					return parseError(path, err)
+				}
+				ossObjects = ossObjects[:0]
+			}
 		}
-
-		if numOssObjects < len(listResponse.Contents) {
-			return nil
-		}
-
-		listResponse, err = d.Bucket.List(d.ossPath(path), "", "", listMax)
-		if err != nil {
-			return err
+		if err := it.Err(); err != nil {
+			return parseError(path, err)
 		}
 	}
 
+	if len(ossObjects) > 0 {
+		return d.Bucket.DelMulti(oss.Delete{Quiet: true, Objects: ossObjects})
+	}
 	return nil
 }
 
+// ListMultipartUploads returns the incomplete multipart uploads to paths below
+// prefix.
+func (d *driver) ListMultipartUploads(ctx context.Context, prefix string) ([]storagedriver.MultipartUpload, error) {
+	root := d.ossPath("/")
+	var uploads []storagedriver.MultipartUpload
+	it := d.listMultis(d.ossPath(prefix))
+	for it.Next() {
+		multi := it.Item()
+		uploads = append(uploads, storagedriver.MultipartUpload{
+			Path: "/" + strings.TrimPrefix(multi.Key, root),
+			ID:   multi.UploadId,
+		})
+	}
+	return uploads, it.Err()
+}
+
+// AbortMultipartUpload aborts an upload, deleting the parts stored.
+func (d *driver) AbortMultipartUpload(ctx context.Context, upload storagedriver.MultipartUpload) error {
+	multi := &oss.Multi{
+		Bucket:   d.Bucket,
+		Key:      d.ossPath(upload.Path),
+		UploadId: upload.ID,
+	}
+	return multi.Abort()
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
@@ -648,6 +740,20 @@ func (w *writer) Size() int64 {
 	return w.size
 }
 
+// Progress reports the number of parts uploaded to OSS and the bytes still
+// held in the part buffers.
+func (w *writer) Progress() storagedriver.FileWriterProgress {
+	var persisted int64
+	for _, part := range w.parts {
+		persisted += part.Size
+	}
+	return storagedriver.FileWriterProgress{
+		PartsCompleted: len(w.parts),
+		BytesPersisted: persisted,
+		BytesBuffered:  int64(len(w.readyPart) + len(w.pendingPart)),
+	}
+}
+
 func (w *writer) Close() error {
 	if w.closed {
 		return fmt.Errorf("already closed")
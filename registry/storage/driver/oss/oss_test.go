@@ -32,6 +32,7 @@ func init() {
 	secure := os.Getenv("OSS_SECURE")
 	endpoint := os.Getenv("OSS_ENDPOINT")
 	encryptionKeyID := os.Getenv("OSS_ENCRYPTIONKEYID")
+	appendable := os.Getenv("OSS_APPEND")
 	root, err := ioutil.TempDir("", "driver-")
 	if err != nil {
 		panic(err)
@@ -63,6 +64,14 @@ func init() {
 			}
 		}
 
+		appendBool := false
+		if appendable != "" {
+			appendBool, err = strconv.ParseBool(appendable)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		parameters := DriverParameters{
 			AccessKeyID:     accessKey,
 			AccessKeySecret: secretKey,
@@ -75,6 +84,7 @@ func init() {
 			Secure:          secureBool,
 			Endpoint:        endpoint,
 			EncryptionKeyID: encryptionKeyID,
+			Append:          appendBool,
 		}
 
 		return New(parameters)
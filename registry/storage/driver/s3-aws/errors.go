@@ -0,0 +1,70 @@
+package s3
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// backendErrorCodes classifies the error codes of S3 and the AWS SDK which
+// report failures of the backend rather than of the operation.
+var backendErrorCodes = map[string]storagedriver.BackendErrorKind{
+	"SlowDown":              storagedriver.BackendThrottled,
+	"Throttling":            storagedriver.BackendThrottled,
+	"ThrottlingException":   storagedriver.BackendThrottled,
+	"RequestThrottled":      storagedriver.BackendThrottled,
+	"RequestLimitExceeded":  storagedriver.BackendThrottled,
+	"TooManyRequests":       storagedriver.BackendThrottled,
+	"InternalError":         storagedriver.BackendUnavailable,
+	"ServiceUnavailable":    storagedriver.BackendUnavailable,
+	"RequestTimeout":        storagedriver.BackendUnavailable,
+	"RequestError":          storagedriver.BackendUnavailable,
+	"AccessDenied":          storagedriver.BackendAuthFailed,
+	"AllAccessDisabled":     storagedriver.BackendAuthFailed,
+	"AccountProblem":        storagedriver.BackendAuthFailed,
+	"InvalidAccessKeyId":    storagedriver.BackendAuthFailed,
+	"SignatureDoesNotMatch": storagedriver.BackendAuthFailed,
+	"ExpiredToken":          storagedriver.BackendAuthFailed,
+	"InvalidToken":          storagedriver.BackendAuthFailed,
+	"NoCredentialProviders": storagedriver.BackendAuthFailed,
+}
+
+// classifyError returns a storagedriver.BackendError for the errors of S3
+// reporting a failure of the backend, such as throttling or rejected
+// credentials, and err otherwise.
+func classifyError(err error) error {
+	kind, ok := backendErrorKind(err)
+	if !ok {
+		return err
+	}
+	return storagedriver.BackendError{
+		DriverName: driverName,
+		Kind:       kind,
+		Enclosed:   err,
+	}
+}
+
+func backendErrorKind(err error) (storagedriver.BackendErrorKind, bool) {
+	switch err := err.(type) {
+	case awserr.Error:
+		if kind, ok := backendErrorCodes[err.Code()]; ok {
+			return kind, true
+		}
+		if failure, ok := err.(awserr.RequestFailure); ok {
+			switch status := failure.StatusCode(); {
+			case status == http.StatusTooManyRequests:
+				return storagedriver.BackendThrottled, true
+			case status >= 500:
+				return storagedriver.BackendUnavailable, true
+			}
+		}
+	case net.Error:
+		if err.Timeout() {
+			return storagedriver.BackendUnavailable, true
+		}
+	}
+	return 0, false
+}
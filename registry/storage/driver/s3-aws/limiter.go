@@ -0,0 +1,237 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultLatencyTarget is the latency above which the concurrency of
+	// requests to S3 is decreased, unless configured.
+	defaultLatencyTarget = time.Second
+
+	// initialConcurrency is the concurrency limit requests start with, so
+	// that a registry starting under load does not flood the backend before
+	// observing it.
+	initialConcurrency = 8
+)
+
+// adaptiveLimiter is an http.RoundTripper limiting the number of concurrent
+// requests to S3 with additive increase, multiplicative decrease (AIMD): the
+// limit increases by one each time as many requests as the limit complete
+// with a latency below the target, and it is halved when a request fails with
+// a 5xx or 429 status or a timeout, or is slower than the target. Server-side
+// copies and completions of multipart uploads are never too slow, for their
+// latency grows with the size of the objects. The limit ranges from one to
+// max.
+//
+// The latency of a request is measured from the end of its body to its
+// response headers, so that it does not depend on the size of uploaded
+// parts. A request holds its slot until its response headers are received,
+// not while its response body is read.
+type adaptiveLimiter struct {
+	transport http.RoundTripper
+	max       int
+	target    time.Duration
+
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	// successes counts the healthy requests since the limit last changed.
+	successes int
+	// epoch counts the decreases of the limit. Only requests started since
+	// the last decrease may decrease it again, so that a burst of failures
+	// halves the limit once rather than collapsing it.
+	epoch   uint64
+	waiters []chan struct{}
+}
+
+func newAdaptiveLimiter(transport http.RoundTripper, max int64, target time.Duration) *adaptiveLimiter {
+	l := &adaptiveLimiter{
+		transport: transport,
+		max:       int(max),
+		target:    target,
+		limit:     initialConcurrency,
+	}
+	if l.limit > l.max {
+		l.limit = l.max
+	}
+	return l
+}
+
+// Limit returns the current concurrency limit.
+func (l *adaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// stats reports the limit, the requests in flight and the requests waiting
+// for a slot.
+func (l *adaptiveLimiter) stats() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return map[string]int{
+		"limit":    l.limit,
+		"inflight": l.inflight,
+		"waiting":  len(l.waiters),
+	}
+}
+
+func (l *adaptiveLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	epoch, err := l.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	start := time.Now()
+	var body *timedBody
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &timedBody{ReadCloser: req.Body}
+		clone := *req
+		clone.Body = body
+		req = &clone
+	}
+
+	resp, err := l.transport.RoundTrip(req)
+	if body != nil {
+		if sent := body.sent(); !sent.IsZero() {
+			start = sent
+		}
+	}
+	l.observe(epoch, healthy(resp, err) && (time.Since(start) <= l.target || waitsForServerWork(req)))
+	return resp, err
+}
+
+// waitsForServerWork tells whether the response to req is only sent once S3
+// has done work proportional to the size of objects, such as server-side
+// copies and the completion of multipart uploads. Their latency says nothing
+// of the load of the backend, so they are judged by their outcome only.
+func waitsForServerWork(req *http.Request) bool {
+	if req.Header.Get("x-amz-copy-source") != "" {
+		// CopyObject and UploadPartCopy
+		return true
+	}
+	// CompleteMultipartUpload
+	return req.Method == http.MethodPost && req.URL.Query().Get("uploadId") != ""
+}
+
+// healthy tells whether a response shows the backend keeps up with the
+// requests.
+func healthy(resp *http.Response, err error) bool {
+	if err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return false
+		}
+		return err != context.DeadlineExceeded
+	}
+	return resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+}
+
+// acquire waits for a slot, returning the epoch the request starts in.
+func (l *adaptiveLimiter) acquire(ctx context.Context) (uint64, error) {
+	l.mu.Lock()
+	if l.inflight < l.limit && len(l.waiters) == 0 {
+		l.inflight++
+		epoch := l.epoch
+		l.mu.Unlock()
+		return epoch, nil
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.epoch, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, waiter := range l.waiters {
+			if waiter == ready {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return 0, ctx.Err()
+			}
+		}
+		// the slot was handed over while the context was done
+		l.inflight--
+		l.wake()
+		return 0, ctx.Err()
+	}
+}
+
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	l.inflight--
+	l.wake()
+	l.mu.Unlock()
+}
+
+// observe adjusts the limit to the outcome of a request started in epoch.
+func (l *adaptiveLimiter) observe(epoch uint64, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ok {
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.max {
+			l.limit++
+			l.successes = 0
+			l.wake()
+		}
+		return
+	}
+	if epoch != l.epoch {
+		return
+	}
+	l.epoch++
+	l.successes = 0
+	l.limit /= 2
+	if l.limit < 1 {
+		l.limit = 1
+	}
+}
+
+// wake hands the free slots to waiting requests. It must be called with mu
+// held.
+func (l *adaptiveLimiter) wake() {
+	for len(l.waiters) > 0 && l.inflight < l.limit {
+		l.inflight++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// timedBody records when a request body has been entirely read by the
+// transport.
+type timedBody struct {
+	io.ReadCloser
+
+	mu  sync.Mutex
+	eof time.Time
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.mu.Lock()
+		if b.eof.IsZero() {
+			b.eof = time.Now()
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *timedBody) sent() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.eof
+}
@@ -0,0 +1,173 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func respond(status int) roundTripperFunc {
+	return func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	}
+}
+
+func roundTrip(t *testing.T, l *adaptiveLimiter) {
+	t.Helper()
+	req, _ := http.NewRequest("PUT", "http://s3.local/bucket/key", strings.NewReader("part"))
+	if _, err := l.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAdaptiveLimiterIncrease(t *testing.T) {
+	l := newAdaptiveLimiter(respond(http.StatusOK), 10, time.Second)
+	if l.Limit() != initialConcurrency {
+		t.Fatalf("unexpected initial limit %d", l.Limit())
+	}
+
+	// the limit increases by one every limit requests
+	for i := 0; i < initialConcurrency; i++ {
+		roundTrip(t, l)
+	}
+	if l.Limit() != initialConcurrency+1 {
+		t.Fatalf("unexpected limit %d after healthy requests", l.Limit())
+	}
+	for i := 0; i < 100; i++ {
+		roundTrip(t, l)
+	}
+	if l.Limit() != 10 {
+		t.Fatalf("expected the limit to be capped, got %d", l.Limit())
+	}
+}
+
+func TestAdaptiveLimiterDecrease(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		status = http.StatusServiceUnavailable
+		delay  time.Duration
+	)
+	l := newAdaptiveLimiter(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		mu.Lock()
+		s, d := status, delay
+		mu.Unlock()
+		time.Sleep(d)
+		return &http.Response{StatusCode: s, Body: http.NoBody}, nil
+	}), 100, 50*time.Millisecond)
+
+	// a burst of failures of concurrent requests halves the limit once
+	var wg sync.WaitGroup
+	mu.Lock()
+	delay = 20 * time.Millisecond
+	mu.Unlock()
+	for i := 0; i < initialConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			roundTrip(t, l)
+		}()
+	}
+	wg.Wait()
+	if l.Limit() != initialConcurrency/2 {
+		t.Fatalf("unexpected limit %d after a burst of failures", l.Limit())
+	}
+
+	// slow requests decrease the limit
+	mu.Lock()
+	status, delay = http.StatusOK, 100*time.Millisecond
+	mu.Unlock()
+	roundTrip(t, l)
+	if l.Limit() != initialConcurrency/4 {
+		t.Fatalf("unexpected limit %d after a slow request", l.Limit())
+	}
+
+	// the limit never drops below one
+	for i := 0; i < 4; i++ {
+		roundTrip(t, l)
+	}
+	if l.Limit() != 1 {
+		t.Fatalf("unexpected limit %d", l.Limit())
+	}
+}
+
+func TestAdaptiveLimiterWaits(t *testing.T) {
+	unblock := make(chan struct{})
+	started := make(chan struct{}, 10)
+	l := newAdaptiveLimiter(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		started <- struct{}{}
+		<-unblock
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}), 2, time.Second)
+
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			req, _ := http.NewRequest("GET", "http://s3.local/bucket/key", nil)
+			l.RoundTrip(req)
+			done <- struct{}{}
+		}()
+	}
+	<-started
+	<-started
+	select {
+	case <-started:
+		t.Fatal("expected the third request to wait for a slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a waiting request gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "http://s3.local/bucket/key", nil)
+	if _, err := l.RoundTrip(req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Fatalf("expected the request to time out waiting, got %v", err)
+	}
+
+	close(unblock)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	if len(l.waiters) != 0 || l.inflight != 0 {
+		t.Fatalf("unexpected %d waiters and %d requests in flight", len(l.waiters), l.inflight)
+	}
+}
+
+// TestAdaptiveLimiterServerSideWork checks requests answered once S3 has
+// copied or assembled objects do not decrease the limit by their latency,
+// but still do by their failures.
+func TestAdaptiveLimiterServerSideWork(t *testing.T) {
+	status := http.StatusOK
+	l := newAdaptiveLimiter(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		time.Sleep(20 * time.Millisecond)
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	}), 100, 10*time.Millisecond)
+
+	copyObject, _ := http.NewRequest("PUT", "http://s3.local/bucket/dest", nil)
+	copyObject.Header.Set("x-amz-copy-source", "bucket/source")
+	complete, _ := http.NewRequest("POST", "http://s3.local/bucket/key?uploadId=abc", strings.NewReader("<CompleteMultipartUpload/>"))
+	for _, req := range []*http.Request{copyObject, complete} {
+		if _, err := l.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if l.Limit() != initialConcurrency {
+		t.Fatalf("unexpected limit %d after slow server-side work", l.Limit())
+	}
+
+	status = http.StatusServiceUnavailable
+	if _, err := l.RoundTrip(copyObject); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.Limit() != initialConcurrency/2 {
+		t.Fatalf("unexpected limit %d after a failed copy", l.Limit())
+	}
+}
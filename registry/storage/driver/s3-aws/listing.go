@@ -0,0 +1,221 @@
+package s3
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/restxml"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// listingBufferSize is the size of the buffers listings are read through.
+const listingBufferSize = 32 << 10
+
+var listingReaders = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, listingBufferSize)
+	},
+}
+
+// setListingHandlers makes the driver decode object listings as they are
+// read. The SDK unmarshaler builds a tree of the whole response before
+// filling the output, which for listings of a thousand long keys allocates
+// several times their size.
+func setListingHandlers(svc *s3.S3) {
+	svc.Handlers.Unmarshal.Swap(restxml.UnmarshalHandler.Name, request.NamedHandler{
+		Name: "s3aws.UnmarshalListing",
+		Fn:   unmarshalListing,
+	})
+}
+
+// unmarshalListing decodes the responses of ListObjects and ListObjectsV2,
+// and hands the other responses to the SDK unmarshaler.
+func unmarshalListing(r *request.Request) {
+	switch r.Data.(type) {
+	case *s3.ListObjectsOutput, *s3.ListObjectsV2Output:
+	default:
+		restxml.Unmarshal(r)
+		return
+	}
+	defer r.HTTPResponse.Body.Close()
+
+	br := listingReaders.Get().(*bufio.Reader)
+	br.Reset(r.HTTPResponse.Body)
+	defer func() {
+		br.Reset(nil)
+		listingReaders.Put(br)
+	}()
+
+	var l listing
+	if err := l.decode(xml.NewDecoder(br)); err != nil {
+		r.Error = awserr.New("SerializationError", "failed to decode REST XML response", err)
+		return
+	}
+	l.fill(r.Data)
+}
+
+// listing holds the elements of the listing responses of both versions.
+type listing struct {
+	name, prefix, delimiter, encodingType    *string
+	marker, nextMarker                       *string
+	continuationToken, nextContinuationToken *string
+	startAfter                               *string
+	maxKeys, keyCount                        *int64
+	isTruncated                              *bool
+	contents                                 []*s3.Object
+	commonPrefixes                           []*s3.CommonPrefix
+}
+
+// decode reads a listing from d token by token, keeping only the values of
+// the elements.
+func (l *listing) decode(d *xml.Decoder) error {
+	var (
+		// names is the path of the current element below the root
+		names  [5]string
+		depth  int
+		text   []byte
+		object *s3.Object
+		prefix *s3.CommonPrefix
+	)
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			if depth != 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth < len(names) {
+				names[depth] = t.Name.Local
+			}
+			text = text[:0]
+			switch {
+			case depth == 2 && t.Name.Local == "Contents":
+				object = &s3.Object{}
+				l.contents = append(l.contents, object)
+			case depth == 2 && t.Name.Local == "CommonPrefixes":
+				prefix = &s3.CommonPrefix{}
+				l.commonPrefixes = append(l.commonPrefixes, prefix)
+			case depth == 3 && names[2] == "Contents" && t.Name.Local == "Owner":
+				object.Owner = &s3.Owner{}
+			}
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.EndElement:
+			if depth == 0 {
+				return fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			var err error
+			switch {
+			case depth == 2:
+				err = l.set(t.Name.Local, text)
+			case depth == 3 && names[2] == "Contents":
+				err = setObject(object, t.Name.Local, text)
+			case depth == 3 && names[2] == "CommonPrefixes" && t.Name.Local == "Prefix":
+				prefix.Prefix = stringValue(text)
+			case depth == 4 && names[2] == "Contents" && names[3] == "Owner":
+				switch t.Name.Local {
+				case "ID":
+					object.Owner.ID = stringValue(text)
+				case "DisplayName":
+					object.Owner.DisplayName = stringValue(text)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", t.Name.Local, err)
+			}
+			depth--
+		}
+	}
+}
+
+func (l *listing) set(name string, text []byte) (err error) {
+	switch name {
+	case "Name":
+		l.name = stringValue(text)
+	case "Prefix":
+		l.prefix = stringValue(text)
+	case "Delimiter":
+		l.delimiter = stringValue(text)
+	case "EncodingType":
+		l.encodingType = stringValue(text)
+	case "Marker":
+		l.marker = stringValue(text)
+	case "NextMarker":
+		l.nextMarker = stringValue(text)
+	case "ContinuationToken":
+		l.continuationToken = stringValue(text)
+	case "NextContinuationToken":
+		l.nextContinuationToken = stringValue(text)
+	case "StartAfter":
+		l.startAfter = stringValue(text)
+	case "MaxKeys":
+		l.maxKeys, err = int64Value(text)
+	case "KeyCount":
+		l.keyCount, err = int64Value(text)
+	case "IsTruncated":
+		var truncated bool
+		truncated, err = strconv.ParseBool(string(text))
+		l.isTruncated = &truncated
+	}
+	return err
+}
+
+func setObject(object *s3.Object, name string, text []byte) (err error) {
+	switch name {
+	case "Key":
+		object.Key = stringValue(text)
+	case "ETag":
+		object.ETag = stringValue(text)
+	case "StorageClass":
+		object.StorageClass = stringValue(text)
+	case "Size":
+		object.Size, err = int64Value(text)
+	case "LastModified":
+		var modified time.Time
+		modified, err = time.Parse(time.RFC3339, string(text))
+		object.LastModified = &modified
+	}
+	return err
+}
+
+// fill sets the fields of the output of ListObjects or ListObjectsV2.
+func (l *listing) fill(data interface{}) {
+	switch out := data.(type) {
+	case *s3.ListObjectsOutput:
+		out.Name, out.Prefix, out.Delimiter, out.EncodingType = l.name, l.prefix, l.delimiter, l.encodingType
+		out.Marker, out.NextMarker = l.marker, l.nextMarker
+		out.MaxKeys, out.IsTruncated = l.maxKeys, l.isTruncated
+		out.Contents, out.CommonPrefixes = l.contents, l.commonPrefixes
+	case *s3.ListObjectsV2Output:
+		out.Name, out.Prefix, out.Delimiter, out.EncodingType = l.name, l.prefix, l.delimiter, l.encodingType
+		out.ContinuationToken, out.NextContinuationToken = l.continuationToken, l.nextContinuationToken
+		out.StartAfter = l.startAfter
+		out.MaxKeys, out.KeyCount, out.IsTruncated = l.maxKeys, l.keyCount, l.isTruncated
+		out.Contents, out.CommonPrefixes = l.contents, l.commonPrefixes
+	}
+}
+
+func stringValue(text []byte) *string {
+	s := string(text)
+	return &s
+}
+
+func int64Value(text []byte) (*int64, error) {
+	n, err := strconv.ParseInt(string(text), 10, 64)
+	return &n, err
+}
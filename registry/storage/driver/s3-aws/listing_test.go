@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/restxml"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// listingBody returns a ListObjectsV2 response listing n keys of about
+// keyLength bytes, and a common prefix.
+func listingBody(n, keyLength int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+	b.WriteString(`<Name>bucket</Name><Prefix>docker/</Prefix><KeyCount>` + fmt.Sprint(n) + `</KeyCount><MaxKeys>1000</MaxKeys>`)
+	b.WriteString(`<IsTruncated>true</IsTruncated><NextContinuationToken>token&amp;next</NextContinuationToken>`)
+	b.WriteString(`<Marker>docker/</Marker><NextMarker>docker/next</NextMarker>`)
+	padding := strings.Repeat("k", keyLength)
+	for i := 0; i < n; i++ {
+		var owner string
+		if i == 0 {
+			owner = `<Owner><ID>75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a</ID><DisplayName>owner</DisplayName></Owner>`
+		}
+		fmt.Fprintf(&b, `<Contents><Key>docker/%s/%06d</Key><LastModified>2021-03-04T05:06:07.000Z</LastModified>`+
+			`<ETag>&quot;d41d8cd98f00b204e9800998ecf8427e&quot;</ETag><Size>%d</Size>%s<StorageClass>STANDARD</StorageClass></Contents>`, padding, i, i, owner)
+	}
+	b.WriteString(`<CommonPrefixes><Prefix>docker/registry/</Prefix></CommonPrefixes>`)
+	b.WriteString(`</ListBucketResult>`)
+	return b.Bytes()
+}
+
+func unmarshalRequest(body []byte, data interface{}) *request.Request {
+	return &request.Request{
+		HTTPResponse: &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(body))},
+		Data:         data,
+	}
+}
+
+func TestUnmarshalListing(t *testing.T) {
+	body := listingBody(3, 10)
+	for _, newOutput := range []func() interface{}{
+		func() interface{} { return &s3.ListObjectsV2Output{} },
+		func() interface{} { return &s3.ListObjectsOutput{} },
+	} {
+		expected, got := unmarshalRequest(body, newOutput()), unmarshalRequest(body, newOutput())
+		restxml.Unmarshal(expected)
+		unmarshalListing(got)
+		if expected.Error != nil || got.Error != nil {
+			t.Fatalf("unexpected errors: %v, %v", expected.Error, got.Error)
+		}
+		if !reflect.DeepEqual(got.Data, expected.Data) {
+			t.Fatalf("unexpected listing:\n%v\nexpected:\n%v", got.Data, expected.Data)
+		}
+	}
+
+	r := unmarshalRequest([]byte("<ListBucketResult><Contents>"), &s3.ListObjectsV2Output{})
+	unmarshalListing(r)
+	if r.Error == nil {
+		t.Fatal("expected an error decoding a truncated listing")
+	}
+}
+
+func BenchmarkUnmarshalListing(b *testing.B) {
+	body := listingBody(1000, 200)
+	for _, bc := range []struct {
+		name      string
+		unmarshal func(*request.Request)
+	}{
+		{"sdk", restxml.Unmarshal},
+		{"streaming", unmarshalListing},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				r := unmarshalRequest(body, &s3.ListObjectsV2Output{})
+				bc.unmarshal(r)
+				if r.Error != nil {
+					b.Fatal(r.Error)
+				}
+			}
+		})
+	}
+}
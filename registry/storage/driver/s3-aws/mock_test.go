@@ -0,0 +1,707 @@
+package s3
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/s3-aws/s3test"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+)
+
+var (
+	mockServer     *s3test.Server
+	mockServerOnce sync.Once
+)
+
+// newMockDriver returns a driver using signature version 2 against the mock
+// S3 server, started on first use.
+func newMockDriver(rootDirectory, secretKey string) (*Driver, error) {
+	return New(mockDriverParameters(rootDirectory, secretKey))
+}
+
+func mockDriverParameters(rootDirectory, secretKey string) DriverParameters {
+	mockServerOnce.Do(func() {
+		mockServer = s3test.NewServer(exampleAccessKey, exampleSecretKey, "bucket", "backup")
+	})
+
+	return DriverParameters{
+		AccessKey:                   exampleAccessKey,
+		SecretKey:                   secretKey,
+		Bucket:                      "bucket",
+		Region:                      "us-east-1",
+		RegionEndpoint:              mockServer.URL,
+		ChunkSize:                   minChunkSize,
+		MultipartCopyChunkSize:      defaultMultipartCopyChunkSize,
+		MultipartCopyMaxConcurrency: defaultMultipartCopyMaxConcurrency,
+		MultipartCopyThresholdSize:  defaultMultipartCopyThresholdSize,
+		RootDirectory:               rootDirectory,
+		StorageClass:                s3.StorageClassStandard,
+		ObjectACL:                   s3.ObjectCannedACLPrivate,
+	}
+}
+
+func init() {
+	// The mock server holds objects in memory, which rules out the tests
+	// writing streams of several gigabytes.
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newMockDriver("/mock", exampleSecretKey)
+	}, func() string {
+		if !testing.Short() {
+			return "The mock S3 server only runs with -short"
+		}
+		return ""
+	})
+}
+
+func TestMockServerFaults(t *testing.T) {
+	d, err := newMockDriver("/faults", exampleSecretKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	defer mockServer.SetFault(nil)
+
+	ctx := context.Background()
+	contents := []byte("contents")
+
+	// failed requests are retried by the SDK
+	mockServer.SetFault(s3test.FailTimes("PutObject", 2, s3test.ErrSlowDown))
+	before := mockServer.Requests("PutObject")
+	if err := d.PutContent(ctx, "/retried", contents); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if n := mockServer.Requests("PutObject") - before; n != 3 {
+		t.Fatalf("expected 3 PutObject requests, got %d", n)
+	}
+
+	mockServer.SetFault(s3test.FailTimes("GetObject", 100, s3test.ErrInternal))
+	_, err = d.GetContent(ctx, "/retried")
+	if awsErr, ok := enclosed(err).(awserr.Error); !ok || awsErr.Code() != "InternalError" {
+		t.Fatalf("expected an internal error, got %v", err)
+	}
+	checkBackendError(t, err, storagedriver.BackendUnavailable)
+
+	mockServer.SetFault(s3test.FailTimes("PutObject", 100, s3test.ErrSlowDown))
+	err = d.PutContent(ctx, "/throttled", contents)
+	checkBackendError(t, err, storagedriver.BackendThrottled)
+
+	// errors of writers are classified as well
+	fw, err := d.Writer(ctx, "/throttled", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	mockServer.SetFault(s3test.FailTimes("UploadPart", 100, s3test.ErrSlowDown))
+	if _, err := fw.Write(contents); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	checkBackendError(t, fw.Commit(), storagedriver.BackendThrottled)
+	mockServer.SetFault(nil)
+
+	p, err := d.GetContent(ctx, "/retried")
+	if err != nil || string(p) != string(contents) {
+		t.Fatalf("unexpected content: %q, %v", p, err)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	params := mockDriverParameters("/retrypolicy", exampleSecretKey)
+	params.MaxAttempts = 2
+	params.RetryDelay = time.Millisecond
+	d, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	defer mockServer.SetFault(nil)
+
+	ctx := context.Background()
+	contents := []byte("contents")
+
+	mockServer.SetFault(s3test.FailTimes("PutObject", 1, s3test.ErrInternal))
+	if err := d.PutContent(ctx, "/retried", contents); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	// the last error reports the attempts made
+	mockServer.SetFault(s3test.FailTimes("PutObject", 100, s3test.ErrInternal))
+	before := mockServer.Requests("PutObject")
+	err = d.PutContent(ctx, "/failed", contents)
+	if n := mockServer.Requests("PutObject") - before; n != 2 {
+		t.Fatalf("expected 2 PutObject requests, got %d", n)
+	}
+	checkBackendError(t, err, storagedriver.BackendUnavailable)
+	if !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Fatalf("expected the attempts in the error, got %v", err)
+	}
+
+	// operations which may have taken effect are only retried when
+	// rejected
+	mockServer.SetFault(s3test.FailTimes("CreateMultipartUpload", 1, s3test.ErrSlowDown))
+	fw, err := d.Writer(ctx, "/multipart", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	if _, err := fw.Write(contents); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	mockServer.SetFault(s3test.FailTimes("CompleteMultipartUpload", 1, s3test.ErrInternal))
+	before = mockServer.Requests("CompleteMultipartUpload")
+	if err := fw.Commit(); err == nil {
+		t.Fatal("expected the failed completion not to be retried")
+	}
+	if n := mockServer.Requests("CompleteMultipartUpload") - before; n != 1 {
+		t.Fatalf("expected 1 CompleteMultipartUpload request, got %d", n)
+	}
+}
+
+func TestMockServerSignature(t *testing.T) {
+	d, err := newMockDriver("/signature", "wrong"+exampleSecretKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	err = d.PutContent(context.Background(), "/signed", []byte("contents"))
+	if awsErr, ok := enclosed(err).(awserr.Error); !ok || awsErr.Code() != "SignatureDoesNotMatch" || !strings.Contains(awsErr.Message(), "/bucket/signature/signed") {
+		t.Fatalf("expected the signature to be rejected, got %v", err)
+	}
+	checkBackendError(t, err, storagedriver.BackendAuthFailed)
+}
+
+func TestRequestHeader(t *testing.T) {
+	params := mockDriverParameters("/origin", exampleSecretKey)
+	params.RequestHeader = "X-Registry-Origin"
+	d, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	defer mockServer.SetFault(nil)
+
+	var origins []string
+	mockServer.SetFault(func(op string, r *http.Request) *s3test.Error {
+		origins = append(origins, r.Header.Get("X-Registry-Origin"))
+		return nil
+	})
+
+	ctx := context.WithValues(context.Background(), map[string]interface{}{
+		"http.request.id":         "4f3c",
+		"http.request.remoteaddr": "192.0.2.1",
+		"auth.user.name":          "alice",
+	})
+	if err := d.PutContent(ctx, "/traced", []byte("contents")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.PutContent(context.Background(), "/untraced", []byte("contents")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	expected := []string{"request=4f3c user=alice addr=192.0.2.1", ""}
+	if !reflect.DeepEqual(origins, expected) {
+		t.Fatalf("unexpected request origins: %q, expected %q", origins, expected)
+	}
+}
+
+// TestDetachedContext checks storage mutations outlive the cancellation of
+// the registry request they are made for, while reads are cancelled with it.
+func TestDetachedContext(t *testing.T) {
+	d, err := newMockDriver("/detached", exampleSecretKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx, cancel := stdcontext.WithCancel(context.Background())
+	cancel()
+	if err := d.PutContent(ctx, "/canceled", []byte("contents")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	if _, err := d.GetContent(ctx, "/canceled"); err == nil {
+		t.Fatal("expected the read of a canceled request to fail")
+	}
+	if _, err := d.Stat(ctx, "/canceled"); err == nil {
+		t.Fatal("expected the stat of a canceled request to fail")
+	}
+	if _, err := d.List(ctx, "/"); err == nil {
+		t.Fatal("expected the listing of a canceled request to fail")
+	}
+	if _, err := d.GetContent(context.Background(), "/canceled"); err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+}
+
+// TestWriterReadFrom checks content read by the writer lands in the part
+// buffers and parts as if it were written.
+func TestWriterReadFrom(t *testing.T) {
+	d, err := newMockDriver("/readfrom", exampleSecretKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	ctx := context.Background()
+
+	content := make([]byte, 3*minChunkSize+1024)
+	rand.Read(content)
+
+	fw, err := d.Writer(ctx, "/blob", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	if _, err := fw.Write(content[:100]); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	n, err := fw.(io.ReaderFrom).ReadFrom(iotest.HalfReader(bytes.NewReader(content[100 : 2*minChunkSize+10])))
+	if err != nil || n != 2*minChunkSize-90 {
+		t.Fatalf("unexpected read of %d bytes: %v", n, err)
+	}
+	if progress := fw.(storagedriver.ProgressReporter).Progress(); progress.PartsCompleted != 1 || progress.BytesBuffered != minChunkSize+10 {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("unexpected error closing writer: %v", err)
+	}
+
+	fw, err = d.Writer(ctx, "/blob", true)
+	if err != nil {
+		t.Fatalf("unexpected error resuming writer: %v", err)
+	}
+	if _, err := io.Copy(fw, bytes.NewReader(content[2*minChunkSize+10:])); err != nil {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+	if fw.Size() != int64(len(content)) {
+		t.Fatalf("unexpected size %d, expected %d", fw.Size(), len(content))
+	}
+	if err := fw.Commit(); err != nil {
+		t.Fatalf("unexpected error committing: %v", err)
+	}
+
+	stored, err := d.GetContent(ctx, "/blob")
+	if err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Fatal("stored content differs from the content written")
+	}
+}
+
+func TestWriterRetriedParts(t *testing.T) {
+	d, err := newMockDriver("/retriedparts", exampleSecretKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	defer mockServer.SetFault(nil)
+	defer mockServer.SetResponseFault(nil)
+	ctx := context.Background()
+
+	content := make([]byte, 2*minChunkSize+1024)
+	rand.Read(content)
+	fw, err := d.Writer(ctx, "/blob", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+
+	// the first part is stored, but its upload fails
+	mockServer.SetResponseFault(s3test.FailTimes("UploadPart", 100, s3test.ErrInternal))
+	if _, err := fw.Write(content[:2*minChunkSize]); err == nil {
+		t.Fatal("expected the upload of the first part to fail")
+	}
+	mockServer.SetResponseFault(nil)
+
+	// the stored part is found rather than uploaded again
+	uploads, lists := mockServer.Requests("UploadPart"), mockServer.Requests("ListParts")
+	if _, err := fw.Write(content[2*minChunkSize : 2*minChunkSize+512]); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if n := mockServer.Requests("UploadPart") - uploads; n != 0 {
+		t.Fatalf("expected the stored part not to be uploaded again, got %d uploads", n)
+	}
+	if n := mockServer.Requests("ListParts") - lists; n != 1 {
+		t.Fatalf("expected the parts to be listed once, got %d lists", n)
+	}
+
+	// a part which was not stored is uploaded again
+	if _, err := fw.Write(content[2*minChunkSize+512:]); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	mockServer.SetFault(s3test.FailTimes("UploadPart", 100, s3test.ErrInternal))
+	if err := fw.Commit(); err == nil {
+		t.Fatal("expected the upload of the last part to fail")
+	}
+	mockServer.SetFault(nil)
+	uploads = mockServer.Requests("UploadPart")
+	if err := fw.Commit(); err != nil {
+		t.Fatalf("unexpected error committing: %v", err)
+	}
+	if n := mockServer.Requests("UploadPart") - uploads; n != 1 {
+		t.Fatalf("expected the last part to be uploaded again, got %d uploads", n)
+	}
+
+	stored, err := d.GetContent(ctx, "/blob")
+	if err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Fatal("stored content differs from the content written")
+	}
+}
+
+func TestWriterVerifyParts(t *testing.T) {
+	params := mockDriverParameters("/verifyparts", exampleSecretKey)
+	params.VerifyParts = true
+	d, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	s3obj := d.Base.StorageDriver.(*driver).S3
+	ctx := context.Background()
+
+	content := make([]byte, 2*minChunkSize+10)
+	rand.Read(content)
+	write := func(path string) *writer {
+		t.Helper()
+		fw, err := d.Writer(ctx, path, false)
+		if err != nil {
+			t.Fatalf("unexpected error creating writer: %v", err)
+		}
+		if _, err := fw.Write(content); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+		return fw.(*writer)
+	}
+	uploadPart := func(w *writer, number int64, body []byte) {
+		t.Helper()
+		_, err := s3obj.UploadPart(&s3.UploadPartInput{
+			Bucket:     aws.String("bucket"),
+			Key:        aws.String(w.key),
+			PartNumber: aws.Int64(number),
+			UploadId:   aws.String(w.uploadID),
+			Body:       bytes.NewReader(body),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error uploading part: %v", err)
+		}
+	}
+
+	// parts the writer did not upload are left out
+	w := write("/stray")
+	uploadPart(w, 5, []byte("stray"))
+	if err := w.Commit(); err != nil {
+		t.Fatalf("unexpected error committing: %v", err)
+	}
+	stored, err := d.GetContent(ctx, "/stray")
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Fatalf("stored content differs from the content written: %v", err)
+	}
+
+	// diverging parts abort the upload
+	w = write("/diverged")
+	uploadPart(w, 1, content[:minChunkSize-1])
+	aborts := mockServer.Requests("AbortMultipartUpload")
+	if err := w.Commit(); err == nil || !strings.Contains(err.Error(), "part 1") {
+		t.Fatalf("expected the divergence of part 1 to be reported, got %v", err)
+	}
+	if n := mockServer.Requests("AbortMultipartUpload") - aborts; n != 1 {
+		t.Fatalf("expected the upload to be aborted, got %d aborts", n)
+	}
+	if _, err := d.Stat(ctx, "/diverged"); !errors.As(err, new(storagedriver.PathNotFoundError)) {
+		t.Fatalf("expected nothing to be stored, got %v", err)
+	}
+}
+
+func TestDriverStats(t *testing.T) {
+	d, err := newMockDriver("/stats", exampleSecretKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	defer mockServer.SetFault(nil)
+	ctx := context.Background()
+
+	mockServer.SetFault(s3test.FailTimes("PutObject", 2, s3test.ErrSlowDown))
+	if err := d.PutContent(ctx, "/retried", []byte("contents")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	fw, err := d.Writer(ctx, "/blob", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	if _, err := fw.Write(make([]byte, 100)); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+
+	stats := d.Stats()
+	if retries := stats["retries"]; retries != int64(2) {
+		t.Fatalf("expected 2 retries, got %v", retries)
+	}
+	if writers := stats["writers"]; !reflect.DeepEqual(writers, map[string]int64{"open": 1, "buffered": 100}) {
+		t.Fatalf("unexpected writers: %v", writers)
+	}
+	if _, ok := stats["operations"]; !ok {
+		t.Fatal("expected the operations of the driver")
+	}
+
+	if err := fw.Cancel(); err != nil {
+		t.Fatalf("unexpected error cancelling: %v", err)
+	}
+	if writers := d.Stats()["writers"]; !reflect.DeepEqual(writers, map[string]int64{"open": 0, "buffered": 0}) {
+		t.Fatalf("unexpected writers after cancelling: %v", writers)
+	}
+}
+
+func TestExport(t *testing.T) {
+	params := mockDriverParameters("/export", exampleSecretKey)
+	d, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	// copy objects of any size in parts
+	params.MultipartCopyThresholdSize = 0
+	multipart, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	params.Bucket = "backup"
+	params.RootDirectory = "/snapshot"
+	backup, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	ctx := context.Background()
+
+	contents := []byte("contents")
+	if err := d.PutContent(ctx, "/object", contents); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.Export(ctx, "/object", "backup", "/snapshot/copy"); err != nil {
+		t.Fatalf("unexpected error exporting: %v", err)
+	}
+	if err := multipart.Export(ctx, "/object", "backup", "snapshot/multipart"); err != nil {
+		t.Fatalf("unexpected error exporting in parts: %v", err)
+	}
+	for _, p := range []string{"/copy", "/multipart"} {
+		if got, err := backup.GetContent(ctx, p); err != nil || !bytes.Equal(got, contents) {
+			t.Fatalf("unexpected content of %s %q: %v", p, got, err)
+		}
+	}
+
+	if err := d.Export(ctx, "/missing", "backup", "/snapshot/missing"); !errors.As(err, new(storagedriver.PathNotFoundError)) {
+		t.Fatalf("expected a missing object not to be exported, got %v", err)
+	}
+}
+
+// enclosed returns the error a storage driver error wraps.
+func enclosed(err error) error {
+	switch e := err.(type) {
+	case storagedriver.Error:
+		return e.Enclosed
+	case storagedriver.BackendError:
+		return e.Enclosed
+	}
+	return err
+}
+
+// checkBackendError fails t unless err is a backend error of the given kind.
+func checkBackendError(t *testing.T, err error, kind storagedriver.BackendErrorKind) {
+	t.Helper()
+	if e, ok := err.(storagedriver.BackendError); !ok || e.Kind != kind || e.DriverName != driverName {
+		t.Fatalf("expected a backend error of kind %v, got %#v", kind, err)
+	}
+}
+
+func TestRegionCheck(t *testing.T) {
+	params := mockDriverParameters("/region", exampleSecretKey)
+	defer mockServer.SetRegion("")
+
+	region := func(d *Driver) string {
+		return aws.StringValue(d.Base.StorageDriver.(*driver).S3.Config.Region)
+	}
+
+	// services not reporting regions serve the bucket at the configured
+	// endpoint
+	params.RegionCheck = regionCheckVerify
+	d, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if region(d) != params.Region {
+		t.Fatalf("unexpected region %s", region(d))
+	}
+
+	mockServer.SetRegion("eu-west-1")
+	if _, err := New(params); err == nil || !strings.Contains(err.Error(), "eu-west-1") {
+		t.Fatalf("expected an error naming the region of the bucket, got %v", err)
+	}
+
+	params.RegionCheck = regionCheckDiscover
+	d, err = New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if region(d) != "eu-west-1" {
+		t.Fatalf("expected the region of the bucket to be discovered, got %s", region(d))
+	}
+	if err := d.PutContent(context.Background(), "/file", []byte("content")); err != nil {
+		t.Fatalf("unexpected error writing with the discovered region: %v", err)
+	}
+
+	// buckets served elsewhere are reported
+	mockServer.SetFault(func(op string, r *http.Request) *s3test.Error {
+		if op == "HeadBucket" {
+			return &s3test.Error{Status: http.StatusMovedPermanently, Code: "PermanentRedirect", Message: "The bucket you are attempting to access must be addressed using the specified endpoint."}
+		}
+		return nil
+	})
+	defer mockServer.SetFault(nil)
+	if _, err := New(params); err == nil || !strings.Contains(err.Error(), "regionendpoint") {
+		t.Fatalf("expected an error pointing to the endpoint, got %v", err)
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	// sessions fail to load the bundle of the environment into the
+	// transport of the driver
+	if bundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+		os.Unsetenv("AWS_CA_BUNDLE")
+		defer os.Setenv("AWS_CA_BUNDLE", bundle)
+	}
+
+	params := mockDriverParameters("/tls", exampleSecretKey)
+	server := httptest.NewTLSServer(mockServer)
+	defer server.Close()
+	params.RegionEndpoint = server.URL
+
+	dir, err := ioutil.TempDir("", "s3-cabundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	d, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if err := d.PutContent(ctx, "/file", []byte("content")); err == nil {
+		t.Fatal("expected the certificate of the endpoint to be rejected")
+	}
+
+	params.CABundle = bundle
+	d, err = New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if err := d.PutContent(ctx, "/file", []byte("content")); err != nil {
+		t.Fatalf("unexpected error writing over TLS: %v", err)
+	}
+
+	params.CABundle = filepath.Join(dir, "missing.pem")
+	if _, err := New(params); err == nil {
+		t.Fatal("expected an error reading a missing bundle")
+	}
+}
+
+func TestTransportTimeouts(t *testing.T) {
+	// sessions fail to load the bundle of the environment into the
+	// transport of the driver
+	if bundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+		os.Unsetenv("AWS_CA_BUNDLE")
+		defer os.Setenv("AWS_CA_BUNDLE", bundle)
+	}
+
+	params := mockDriverParameters("/timeouts", exampleSecretKey)
+	params.MaxAttempts = 1
+	params.MaxIdleConnsPerHost = 64
+	params.ResponseHeaderTimeout = time.Second
+	params.OperationTimeout = 100 * time.Millisecond
+	d, err := New(params)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	defer mockServer.SetFault(nil)
+
+	ctx := context.Background()
+	if err := d.PutContent(ctx, "/stalled", []byte("contents")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	stall := func(op string) s3test.Fault {
+		return func(requestOp string, r *http.Request) *s3test.Error {
+			if requestOp == op {
+				time.Sleep(300 * time.Millisecond)
+			}
+			return nil
+		}
+	}
+
+	// operations stalling past their deadline fail
+	mockServer.SetFault(stall("PutObject"))
+	if err := d.PutContent(ctx, "/stalled", []byte("contents")); err == nil {
+		t.Fatal("expected the stalled operation to time out")
+	}
+
+	// downloads, streamed to clients, have no deadline
+	mockServer.SetFault(stall("GetObject"))
+	if _, err := d.GetContent(ctx, "/stalled"); err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+
+	// but the response headers must arrive in time
+	params.OperationTimeout = 0
+	params.ResponseHeaderTimeout = 100 * time.Millisecond
+	if d, err = New(params); err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if _, err := d.GetContent(ctx, "/stalled"); err == nil {
+		t.Fatal("expected the stalled download to time out")
+	}
+}
+
+// TestWriterBufferGrowth checks small uploads do not allocate the buffer of
+// a full chunk, and that buffers grow up to one as content is written.
+func TestWriterBufferGrowth(t *testing.T) {
+	d, err := newMockDriver("/growth", exampleSecretKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	ctx := context.Background()
+
+	fw, err := d.Writer(ctx, "/blob", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	defer fw.Close()
+	w := fw.(*writer)
+
+	if _, err := fw.Write(make([]byte, 100)); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if cap(w.readyPart) > initialPartCapacity {
+		t.Fatalf("unexpected buffer of %d bytes for a small write", cap(w.readyPart))
+	}
+
+	if _, err := fw.Write(make([]byte, minChunkSize)); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if cap(w.readyPart) != int(w.driver.ChunkSize) || len(w.readyPart)+len(w.pendingPart) != minChunkSize+100 {
+		t.Fatalf("unexpected parts of %d and %d bytes, capacity %d", len(w.readyPart), len(w.pendingPart), cap(w.readyPart))
+	}
+}
@@ -0,0 +1,88 @@
+package s3
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	dcontext "github.com/docker/distribution/context"
+)
+
+// originFields are the context values identifying the registry request S3
+// requests are made for, along with the names they are reported under.
+var originFields = []struct {
+	name string
+	key  string
+}{
+	{"request", "http.request.id"},
+	{"user", "auth.user.name"},
+	{"addr", "http.request.remoteaddr"},
+}
+
+// requestOrigin describes the registry request made with ctx: its id, the
+// authenticated user and the client address, as far as they are known.
+func requestOrigin(ctx context.Context) string {
+	var fields []string
+	for _, field := range originFields {
+		if value := dcontext.GetStringValue(ctx, field.key); value != "" {
+			fields = append(fields, field.name+"="+value)
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// setOriginHeader returns a request handler setting header to the origin of
+// the S3 requests, so that they can be traced back to the registry request
+// in the S3 server logs.
+func setOriginHeader(header string) func(*request.Request) {
+	return func(r *request.Request) {
+		if origin := requestOrigin(r.Context()); origin != "" {
+			r.HTTPRequest.Header.Set(header, origin)
+		}
+	}
+}
+
+// logRequest logs S3 requests with the fields of the registry request they
+// are made for, and the request id assigned by the S3 server.
+func logRequest(r *request.Request) {
+	fields := map[interface{}]interface{}{
+		"s3.operation": r.Operation.Name,
+		"s3.requestid": r.RequestID,
+		"s3.duration":  time.Since(r.Time),
+	}
+	if r.HTTPResponse != nil {
+		fields["s3.status"] = r.HTTPResponse.StatusCode
+	}
+	logger := dcontext.GetLoggerWithFields(r.Context(), fields)
+	if r.Error != nil {
+		logger.Debugf("s3 request failed: %v", r.Error)
+		return
+	}
+	logger.Debug("s3 request")
+}
+
+// detachedContext carries the values of a context, but neither its deadline
+// nor its cancellation: a client going away must not interrupt the storage
+// operations made on its behalf halfway through. Only the mutations are
+// detached: reads leave nothing behind, and follow the registry request so
+// that the downloads of a client going away stop, freeing their connection.
+type detachedContext struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -0,0 +1,254 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// recorderPath is where the debug server exposes the recorded requests.
+	recorderPath = "/debug/s3"
+
+	// maxRecordedRequests and maxRecordedBodySize bound the memory used to
+	// record requests.
+	maxRecordedRequests = 10000
+	maxRecordedBodySize = 1 << 20
+
+	// maxRecordedBodies bounds the memory used by the bodies of all the
+	// exchanges kept by a recorder. The bodies of the oldest exchanges are
+	// dropped beyond it.
+	maxRecordedBodies = 64 << 20
+)
+
+// sensitiveHeaders and sensitiveParams carry credentials, and are left out of
+// recorded requests.
+var (
+	sensitiveHeaders = []string{"Authorization", "X-Amz-Security-Token", "X-Amz-Server-Side-Encryption-Customer-Key", "X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"}
+	sensitiveParams  = []string{"Signature", "AWSAccessKeyId", "X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token"}
+)
+
+var (
+	recordersMu    sync.Mutex
+	recorders      []*exchangeRecorder
+	registerRoutes sync.Once
+)
+
+// exchange describes a request sent to S3 and its response.
+type exchange struct {
+	Time            time.Time     `json:"time"`
+	Duration        time.Duration `json:"duration"`
+	Method          string        `json:"method"`
+	URL             string        `json:"url"`
+	RequestHeaders  http.Header   `json:"requestHeaders"`
+	RequestBody     string        `json:"requestBody,omitempty"`
+	Status          int           `json:"status,omitempty"`
+	ResponseHeaders http.Header   `json:"responseHeaders,omitempty"`
+	ResponseBody    string        `json:"responseBody,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	// BodiesDropped tells the bodies were recorded, but dropped since to
+	// bound the memory used by the recorder.
+	BodiesDropped bool `json:"bodiesDropped,omitempty"`
+}
+
+// bodySize returns the memory used by the bodies of the exchange.
+func (e exchange) bodySize() int64 {
+	return int64(len(e.RequestBody) + len(e.ResponseBody))
+}
+
+// exchangeRecorder is an http.RoundTripper keeping the last exchanges with
+// S3 in a ring buffer, for operators to inspect when diagnosing failures.
+// Credentials are left out, and bodies are only kept up to bodySize bytes:
+// request bodies as they are sent, and response bodies of failed requests.
+// The bodies of all exchanges are kept up to maxBodies bytes.
+type exchangeRecorder struct {
+	transport http.RoundTripper
+	bodySize  int64
+	maxBodies int64
+
+	mu        sync.Mutex
+	exchanges []exchange
+	next      int
+	full      bool
+	// bodies is the memory used by the bodies of the exchanges.
+	bodies int64
+}
+
+// newExchangeRecorder records the last n exchanges sent through transport,
+// and exposes them on the debug server.
+func newExchangeRecorder(transport http.RoundTripper, n, bodySize int64) *exchangeRecorder {
+	r := &exchangeRecorder{
+		transport: transport,
+		bodySize:  bodySize,
+		maxBodies: maxRecordedBodies,
+		exchanges: make([]exchange, n),
+	}
+
+	recordersMu.Lock()
+	recorders = append(recorders, r)
+	recordersMu.Unlock()
+	registerRoutes.Do(func() {
+		http.HandleFunc(recorderPath, serveRecorded)
+	})
+	return r
+}
+
+// RoundTrip sends req through the underlying transport and records it.
+func (r *exchangeRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := exchange{
+		Time:           time.Now(),
+		Method:         req.Method,
+		URL:            sanitizeURL(req),
+		RequestHeaders: sanitizeHeaders(req.Header),
+	}
+
+	var body *limitedBuffer
+	if r.bodySize > 0 && req.Body != nil {
+		body = &limitedBuffer{limit: r.bodySize}
+		sent := *req
+		sent.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(req.Body, body), req.Body}
+		req = &sent
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	e.Duration = time.Since(e.Time)
+	if body != nil {
+		e.RequestBody = body.String()
+	}
+	if err != nil {
+		e.Error = err.Error()
+		r.record(e)
+		return resp, err
+	}
+
+	e.Status = resp.StatusCode
+	e.ResponseHeaders = sanitizeHeaders(resp.Header)
+	if r.bodySize > 0 && resp.StatusCode >= 300 {
+		p, err := ioutil.ReadAll(io.LimitReader(resp.Body, r.bodySize))
+		e.ResponseBody = string(p)
+		if err != nil {
+			e.Error = err.Error()
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(p), resp.Body), resp.Body}
+	}
+	r.record(e)
+	return resp, nil
+}
+
+func (r *exchangeRecorder) record(e exchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bodies += e.bodySize() - r.exchanges[r.next].bodySize()
+	r.exchanges[r.next] = e
+	r.next = (r.next + 1) % len(r.exchanges)
+	if r.next == 0 {
+		r.full = true
+	}
+
+	// drop the bodies of the oldest exchanges beyond the memory bound
+	oldest := 0
+	if r.full {
+		oldest = r.next
+	}
+	for i := 0; r.bodies > r.maxBodies && i < len(r.exchanges); i++ {
+		old := &r.exchanges[(oldest+i)%len(r.exchanges)]
+		if size := old.bodySize(); size > 0 {
+			r.bodies -= size
+			old.RequestBody, old.ResponseBody = "", ""
+			old.BodiesDropped = true
+		}
+	}
+}
+
+// recorded returns the exchanges recorded, oldest first.
+func (r *exchangeRecorder) recorded() []exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]exchange(nil), r.exchanges[:r.next]...)
+	}
+	return append(append([]exchange(nil), r.exchanges[r.next:]...), r.exchanges[:r.next]...)
+}
+
+// serveRecorded writes the exchanges recorded by every recorder as JSON.
+func serveRecorded(w http.ResponseWriter, req *http.Request) {
+	recordersMu.Lock()
+	exchanges := []exchange{}
+	for _, r := range recorders {
+		exchanges = append(exchanges, r.recorded()...)
+	}
+	recordersMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(exchanges)
+}
+
+func sanitizeURL(req *http.Request) string {
+	u := *req.URL
+	q := u.Query()
+	for _, param := range sensitiveParams {
+		if q.Get(param) != "" {
+			q.Set(param, "REDACTED")
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func sanitizeHeaders(headers http.Header) http.Header {
+	sanitized := make(http.Header, len(headers))
+	for k, v := range headers {
+		sanitized[k] = v
+	}
+	for _, header := range sensitiveHeaders {
+		for k := range sanitized {
+			if strings.EqualFold(k, header) {
+				sanitized[k] = []string{"REDACTED"}
+			}
+		}
+	}
+	return sanitized
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	limit int64
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if left := b.limit - int64(b.buf.Len()); left > 0 {
+		if int64(len(p)) > left {
+			b.buf.Write(p[:left])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
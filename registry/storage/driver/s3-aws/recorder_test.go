@@ -0,0 +1,98 @@
+package s3
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExchangeRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+			return
+		}
+		ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	recorder := newExchangeRecorder(http.DefaultTransport, 2, 16)
+	client := &http.Client{Transport: recorder}
+
+	req, _ := http.NewRequest("PUT", server.URL+"/a?Signature=secret&partNumber=1", strings.NewReader("0123456789abcdefghij"))
+	req.Header.Set("Authorization", "AWS key:secret")
+	req.Header.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key", "secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = client.Get(server.URL + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "<Error><Code>NoSuchKey</Code></Error>" {
+		t.Fatalf("unexpected response body read through the recorder: %q", body)
+	}
+
+	exchanges := recorder.recorded()
+	if len(exchanges) != 2 {
+		t.Fatalf("unexpected exchanges recorded: %d", len(exchanges))
+	}
+	put, get := exchanges[0], exchanges[1]
+	if strings.Contains(put.URL, "secret") || put.RequestHeaders.Get("Authorization") != "REDACTED" ||
+		put.RequestHeaders.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key") != "REDACTED" {
+		t.Fatalf("expected credentials to be redacted: %s %v", put.URL, put.RequestHeaders)
+	}
+	if put.RequestBody != "0123456789abcdef" || put.Status != http.StatusOK || put.ResponseBody != "" {
+		t.Fatalf("unexpected exchange recorded: %+v", put)
+	}
+	if get.Status != http.StatusNotFound || get.ResponseBody != "<Error><Code>NoS" {
+		t.Fatalf("unexpected exchange recorded: %+v", get)
+	}
+
+	// the oldest exchange makes room for the next one
+	resp, err = client.Get(server.URL + "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	exchanges = recorder.recorded()
+	if len(exchanges) != 2 || exchanges[0].Method != "GET" || !strings.HasSuffix(exchanges[1].URL, "/b") {
+		t.Fatalf("unexpected exchanges recorded: %+v", exchanges)
+	}
+
+	w := httptest.NewRecorder()
+	serveRecorded(w, httptest.NewRequest("GET", recorderPath, nil))
+	var served []exchange
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatalf("unexpected error decoding exchanges: %v", err)
+	}
+	if len(served) < 2 {
+		t.Fatalf("expected the exchanges to be served, got %d", len(served))
+	}
+
+	// the bodies of the oldest exchanges are dropped beyond the memory bound
+	recorder.maxBodies = 20
+	for _, path := range []string{"/missing", "/missing"} {
+		resp, err = client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	exchanges = recorder.recorded()
+	if !exchanges[0].BodiesDropped || exchanges[0].ResponseBody != "" || exchanges[1].ResponseBody != "<Error><Code>NoS" {
+		t.Fatalf("unexpected exchanges recorded: %+v", exchanges)
+	}
+	if recorder.bodies != 16 {
+		t.Fatalf("unexpected memory used by bodies: %d", recorder.bodies)
+	}
+}
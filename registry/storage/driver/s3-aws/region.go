@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// regionCheckVerify fails the creation of the driver if the bucket is
+	// not in the configured region.
+	regionCheckVerify = "verify"
+
+	// regionCheckDiscover switches the driver to the region of the bucket
+	// if it differs from the configured one.
+	regionCheckDiscover = "discover"
+)
+
+// checkRegion returns the region the driver should use to reach its bucket,
+// the configured one unless the bucket is in another region and the region
+// check discovers it. It returns an error explaining the misconfiguration
+// otherwise, rather than letting requests fail later with signature errors
+// or redirects.
+func checkRegion(svc *s3.S3, params DriverParameters) (string, error) {
+	endpoint := params.RegionEndpoint
+	if endpoint == "" {
+		endpoint = "the endpoint of region " + params.Region
+	}
+
+	region, redirected, err := bucketRegion(svc, params.Bucket)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("s3aws: could not check the region of bucket %s at %s: %v", params.Bucket, endpoint, err)
+	case redirected && region == "":
+		return "", fmt.Errorf("s3aws: bucket %s is not served by %s, which redirects to the endpoint of its region: set the region and regionendpoint parameters to its region", params.Bucket, endpoint)
+	case region == "", region == params.Region:
+		// the service does not report regions, and serves the bucket
+		return params.Region, nil
+	case params.RegionCheck == regionCheckVerify:
+		return "", fmt.Errorf("s3aws: bucket %s is in region %s, not in the configured region %s: set the region parameter to %s", params.Bucket, region, params.Region, region)
+	case redirected && params.RegionEndpoint != "":
+		return "", fmt.Errorf("s3aws: bucket %s is in region %s, which %s does not serve: set the regionendpoint parameter to the endpoint of region %s", params.Bucket, region, endpoint, region)
+	}
+	return region, nil
+}
+
+// bucketRegion returns the region of the bucket as reported by the service,
+// or "" if it does not report it, and whether the service redirected the
+// request to another endpoint.
+func bucketRegion(svc *s3.S3, bucket string) (region string, redirected bool, err error) {
+	// S3 reports the region of buckets in the responses to HeadBucket,
+	// including redirects and denials
+	req, _ := svc.HeadBucketRequest(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	err = req.Send()
+	if req.HTTPResponse != nil {
+		region = req.HTTPResponse.Header.Get("x-amz-bucket-region")
+		redirected = req.HTTPResponse.StatusCode == http.StatusMovedPermanently
+	}
+	switch {
+	case redirected, region != "":
+		return region, redirected, nil
+	case err != nil:
+		return "", false, err
+	}
+
+	// not every S3 compatible service implements locations, and the
+	// endpoint serves the bucket anyway. An empty location stands for the
+	// default region of the service, which is us-east-1 only on S3.
+	out, err := svc.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil || aws.StringValue(out.LocationConstraint) == "" {
+		return "", false, nil
+	}
+	return s3.NormalizeBucketLocation(aws.StringValue(out.LocationConstraint)), false, nil
+}
@@ -0,0 +1,148 @@
+package s3
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	// defaultMaxAttempts is the number of attempts made for a request,
+	// as many as the SDK makes by default.
+	defaultMaxAttempts = 4
+
+	// defaultRetryDelay and defaultRetryJitter wait, as the SDK does by
+	// default, between 30ms and 60ms before the first retry.
+	defaultRetryDelay  = 60 * time.Millisecond
+	defaultRetryJitter = 50
+
+	// throttledRetryDelay is the least delay before retrying a throttled
+	// request.
+	throttledRetryDelay = time.Second
+
+	// maxRetryDelay bounds the delay before retrying a request, including
+	// the delays asked by the service.
+	maxRetryDelay = 20 * time.Second
+)
+
+// nonIdempotentOperations lists the operations which may have taken effect
+// even though they failed, and whose retry would then fail or leak an
+// upload. They are only retried when the service rejected them.
+var nonIdempotentOperations = map[string]struct{}{
+	"CreateMultipartUpload":   {},
+	"CompleteMultipartUpload": {},
+}
+
+// retryer retries the requests failing with server errors, throttling or
+// network errors, waiting for an exponential backoff of which jitter percent
+// is random.
+type retryer struct {
+	client.DefaultRetryer
+	delay  time.Duration
+	jitter int64
+}
+
+func newRetryer(maxAttempts int64, delay time.Duration, jitter int64) retryer {
+	return retryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: int(maxAttempts) - 1},
+		delay:          delay,
+		jitter:         jitter,
+	}
+}
+
+// ShouldRetry reports whether the failed request is retried.
+func (rr retryer) ShouldRetry(r *request.Request) bool {
+	if !rr.DefaultRetryer.ShouldRetry(r) {
+		return false
+	}
+	if _, ok := nonIdempotentOperations[r.Operation.Name]; ok {
+		return rejected(r)
+	}
+	return true
+}
+
+// RetryRules returns the delay before retrying the request.
+func (rr retryer) RetryRules(r *request.Request) time.Duration {
+	delay := rr.delay
+	if throttled(r) {
+		if retryAfter, ok := retryAfter(r); ok {
+			if retryAfter > maxRetryDelay {
+				return maxRetryDelay
+			}
+			return retryAfter
+		}
+		if delay < throttledRetryDelay {
+			delay = throttledRetryDelay
+		}
+	}
+
+	for i := 0; i < r.RetryCount && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	if spread := int64(delay) * rr.jitter / 100; spread > 0 {
+		delay -= time.Duration(rand.Int63n(spread + 1))
+	}
+	return delay
+}
+
+// throttled reports whether the service asked to slow down.
+func throttled(r *request.Request) bool {
+	switch r.HTTPResponse.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return r.IsErrorThrottle()
+}
+
+// rejected reports whether the request failed before the service processed
+// it: it was throttled, or no connection could be made.
+func rejected(r *request.Request) bool {
+	if throttled(r) {
+		return true
+	}
+	if err, ok := r.Error.(awserr.Error); ok {
+		if urlErr, ok := err.OrigErr().(*url.Error); ok {
+			if opErr, ok := urlErr.Err.(*net.OpError); ok && opErr.Op == "dial" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retryAfter returns the delay asked by the Retry-After header of a
+// throttled response.
+func retryAfter(r *request.Request) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(r.HTTPResponse.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// reportAttempts is a handler of the AfterRetry phase adding the number of
+// attempts made to the error of requests which were retried, once they are
+// no longer retried.
+func reportAttempts(r *request.Request) {
+	err, ok := r.Error.(awserr.Error)
+	if !ok || r.RetryCount == 0 {
+		return
+	}
+	wrapped := awserr.New(err.Code(), fmt.Sprintf("%s (after %d attempts)", err.Message(), r.RetryCount+1), err.OrigErr())
+	if failure, ok := err.(awserr.RequestFailure); ok {
+		r.Error = awserr.NewRequestFailure(wrapped, failure.StatusCode(), failure.RequestID())
+		return
+	}
+	r.Error = wrapped
+}
@@ -14,7 +14,10 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -70,6 +73,10 @@ const (
 	defaultMultipartCopyThresholdSize = 32 << 20
 )
 
+// initialPartCapacity is the capacity of the part buffers of writers when
+// they are allocated. They grow up to a full chunk as content is written.
+const initialPartCapacity = 64 << 10
+
 // listMax is the largest amount of objects you can request from S3 in a list call
 const listMax = 1000
 
@@ -103,6 +110,23 @@ type DriverParameters struct {
 	UserAgent                   string
 	ObjectACL                   string
 	SessionToken                string
+	RecordRequests              int64
+	RecordBodySize              int64
+	RequestHeader               string
+	MaxConcurrency              int64
+	LatencyTarget               time.Duration
+	VerifyParts                 bool
+	RegionCheck                 string
+	CABundle                    string
+	MaxAttempts                 int64
+	RetryDelay                  time.Duration
+	RetryJitter                 int64
+	MaxIdleConnsPerHost         int64
+	DialTimeout                 time.Duration
+	ResponseHeaderTimeout       time.Duration
+	IdleConnTimeout             time.Duration
+	DisableKeepAlives           bool
+	OperationTimeout            time.Duration
 }
 
 func init() {
@@ -149,6 +173,8 @@ type driver struct {
 	RootDirectory               string
 	StorageClass                string
 	ObjectACL                   string
+	VerifyParts                 bool
+	stats                       *driverStats
 }
 
 type baseEmbed struct {
@@ -296,6 +322,140 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		return nil, err
 	}
 
+	recordRequests, err := getParameterAsInt64(parameters, "recordrequests", 0, 0, maxRecordedRequests)
+	if err != nil {
+		return nil, err
+	}
+
+	recordBodySize, err := getParameterAsInt64(parameters, "recordbodysize", 0, 0, maxRecordedBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	requestHeader := parameters["requestheader"]
+	if requestHeader == nil {
+		requestHeader = ""
+	}
+
+	maxConcurrency, err := getParameterAsInt64(parameters, "maxconcurrency", 0, 0, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	latencyTarget := defaultLatencyTarget
+	switch v := parameters["latencytarget"].(type) {
+	case string:
+		latencyTarget, err = time.ParseDuration(v)
+		if err != nil || latencyTarget <= 0 {
+			return nil, fmt.Errorf("the latencytarget parameter must be a positive duration, %v invalid", v)
+		}
+	case nil:
+		// use the default
+	default:
+		return nil, fmt.Errorf("invalid value for latencytarget: %#v", v)
+	}
+
+	verifyPartsBool := false
+	verifyParts := parameters["verifyparts"]
+	switch verifyParts := verifyParts.(type) {
+	case string:
+		b, err := strconv.ParseBool(verifyParts)
+		if err != nil {
+			return nil, fmt.Errorf("the verifyparts parameter should be a boolean")
+		}
+		verifyPartsBool = b
+	case bool:
+		verifyPartsBool = verifyParts
+	case nil:
+		// do nothing
+	default:
+		return nil, fmt.Errorf("the verifyparts parameter should be a boolean")
+	}
+
+	caBundle := parameters["cabundle"]
+	if caBundle == nil {
+		caBundle = ""
+	}
+
+	maxAttempts, err := getParameterAsInt64(parameters, "maxattempts", defaultMaxAttempts, 1, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	retryDelay := defaultRetryDelay
+	switch v := parameters["retrydelay"].(type) {
+	case string:
+		retryDelay, err = time.ParseDuration(v)
+		if err != nil || retryDelay <= 0 {
+			return nil, fmt.Errorf("the retrydelay parameter must be a positive duration, %v invalid", v)
+		}
+	case nil:
+		// use the default
+	default:
+		return nil, fmt.Errorf("invalid value for retrydelay: %#v", v)
+	}
+
+	retryJitter, err := getParameterAsInt64(parameters, "retryjitter", defaultRetryJitter, 0, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	maxIdleConnsPerHost, err := getParameterAsInt64(parameters, "maxidleconnsperhost", 0, 0, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	dialTimeout, err := getParameterAsDuration(parameters, "dialtimeout", defaultDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	responseHeaderTimeout, err := getParameterAsDuration(parameters, "responseheadertimeout", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	idleConnTimeout, err := getParameterAsDuration(parameters, "idleconntimeout", defaultIdleConnTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	disableKeepAlivesBool := false
+	switch disableKeepAlives := parameters["disablekeepalives"].(type) {
+	case string:
+		b, err := strconv.ParseBool(disableKeepAlives)
+		if err != nil {
+			return nil, fmt.Errorf("the disablekeepalives parameter should be a boolean")
+		}
+		disableKeepAlivesBool = b
+	case bool:
+		disableKeepAlivesBool = disableKeepAlives
+	case nil:
+		// do nothing
+	default:
+		return nil, fmt.Errorf("the disablekeepalives parameter should be a boolean")
+	}
+
+	operationTimeout, err := getParameterAsDuration(parameters, "operationtimeout", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	regionCheck := ""
+	switch v := parameters["regioncheck"].(type) {
+	case string:
+		if v != "" && v != regionCheckVerify && v != regionCheckDiscover {
+			return nil, fmt.Errorf("the regioncheck parameter must be one of %v, %v invalid",
+				[]string{regionCheckVerify, regionCheckDiscover}, v)
+		}
+		regionCheck = v
+	case nil:
+		// do nothing
+	default:
+		return nil, fmt.Errorf("the regioncheck parameter must be one of %v, %v invalid",
+			[]string{regionCheckVerify, regionCheckDiscover}, v)
+	}
+
 	rootDirectory := parameters["rootdirectory"]
 	if rootDirectory == nil {
 		rootDirectory = ""
@@ -361,11 +521,42 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		fmt.Sprint(userAgent),
 		objectACL,
 		fmt.Sprint(sessionToken),
+		recordRequests,
+		recordBodySize,
+		fmt.Sprint(requestHeader),
+		maxConcurrency,
+		latencyTarget,
+		verifyPartsBool,
+		regionCheck,
+		fmt.Sprint(caBundle),
+		maxAttempts,
+		retryDelay,
+		retryJitter,
+		maxIdleConnsPerHost,
+		dialTimeout,
+		responseHeaderTimeout,
+		idleConnTimeout,
+		disableKeepAlivesBool,
+		operationTimeout,
 	}
 
 	return New(params)
 }
 
+// loadCABundle returns a pool of the certificates of the PEM file at path,
+// which replaces the system roots when verifying the endpoint.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the cabundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificate found in the cabundle %s", path)
+	}
+	return pool, nil
+}
+
 // getParameterAsInt64 converts paramaters[name] to an int64 value (using
 // defaultt if nil), verifies it is no smaller than min, and returns it.
 func getParameterAsInt64(parameters map[string]interface{}, name string, defaultt int64, min int64, max int64) (int64, error) {
@@ -431,12 +622,44 @@ func New(params DriverParameters) (*Driver, error) {
 	awsConfig.WithRegion(params.Region)
 	awsConfig.WithDisableSSL(!params.Secure)
 
-	if params.UserAgent != "" || params.SkipVerify {
+	maxAttempts, retryDelay := params.MaxAttempts, params.RetryDelay
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if retryDelay <= 0 {
+		retryDelay = defaultRetryDelay
+	}
+	request.WithRetryer(awsConfig, newRetryer(maxAttempts, retryDelay, params.RetryJitter))
+	// the retryer decides on network errors too
+	awsConfig.EnforceShouldRetryCheck = aws.Bool(true)
+
+	var limiter *adaptiveLimiter
+	if params.UserAgent != "" || params.SkipVerify || params.CABundle != "" || params.RecordRequests > 0 || params.MaxConcurrency > 0 || params.tunesTransport() {
 		httpTransport := http.DefaultTransport
-		if params.SkipVerify {
-			httpTransport = &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		if params.SkipVerify || params.CABundle != "" || params.tunesTransport() {
+			var tlsConfig *tls.Config
+			if params.SkipVerify || params.CABundle != "" {
+				tlsConfig = &tls.Config{InsecureSkipVerify: params.SkipVerify}
 			}
+			if params.CABundle != "" {
+				pool, err := loadCABundle(params.CABundle)
+				if err != nil {
+					return nil, err
+				}
+				tlsConfig.RootCAs = pool
+			}
+			httpTransport = newHTTPTransport(params, tlsConfig)
+		}
+		if params.RecordRequests > 0 {
+			httpTransport = newExchangeRecorder(httpTransport, params.RecordRequests, params.RecordBodySize)
+		}
+		if params.MaxConcurrency > 0 {
+			latencyTarget := params.LatencyTarget
+			if latencyTarget <= 0 {
+				latencyTarget = defaultLatencyTarget
+			}
+			limiter = newAdaptiveLimiter(httpTransport, params.MaxConcurrency, latencyTarget)
+			httpTransport = limiter
 		}
 		if params.UserAgent != "" {
 			awsConfig.WithHTTPClient(&http.Client{
@@ -449,15 +672,49 @@ func New(params DriverParameters) (*Driver, error) {
 		}
 	}
 
-	sess, err = session.NewSession(awsConfig)
+	stats := &driverStats{limiter: limiter}
+	newService := func() (*s3.S3, error) {
+		sess, err := session.NewSession(awsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new session with aws config: %v", err)
+		}
+		s3obj := s3.New(sess)
+		setListingHandlers(s3obj)
+
+		// enable S3 compatible signature v2 signing instead
+		if !params.V4Auth {
+			setv2Handlers(s3obj)
+		}
+
+		if params.RequestHeader != "" {
+			s3obj.Handlers.Build.PushBack(setOriginHeader(params.RequestHeader))
+		}
+		if params.OperationTimeout > 0 {
+			s3obj.Handlers.Build.PushBack(setOperationTimeout(params.OperationTimeout))
+			s3obj.Handlers.Complete.PushBack(cancelOperationTimeout)
+		}
+		s3obj.Handlers.AfterRetry.PushBack(reportAttempts)
+		s3obj.Handlers.Complete.PushBack(logRequest)
+		s3obj.Handlers.Send.PushFront(stats.countRetry)
+		return s3obj, nil
+	}
+	s3obj, err := newService()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new session with aws config: %v", err)
+		return nil, err
 	}
-	s3obj := s3.New(sess)
 
-	// enable S3 compatible signature v2 signing instead
-	if !params.V4Auth {
-		setv2Handlers(s3obj)
+	if params.RegionCheck != "" {
+		region, err := checkRegion(s3obj, params)
+		if err != nil {
+			return nil, err
+		}
+		if region != params.Region {
+			dcontext.GetLogger(context.Background()).Warnf("s3aws: bucket %s is in region %s, not in the configured %s: using %s", params.Bucket, region, params.Region, region)
+			awsConfig.WithRegion(region)
+			if s3obj, err = newService(); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// TODO Currently multipart uploads have no timestamps, so this would be unwise
@@ -487,6 +744,8 @@ func New(params DriverParameters) (*Driver, error) {
 		RootDirectory:               params.RootDirectory,
 		StorageClass:                params.StorageClass,
 		ObjectACL:                   params.ObjectACL,
+		VerifyParts:                 params.VerifyParts,
+		stats:                       stats,
 	}
 
 	return &Driver{
@@ -515,7 +774,7 @@ func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
 
 // PutContent stores the []byte content at a location designated by "path".
 func (d *driver) PutContent(ctx context.Context, path string, contents []byte) error {
-	_, err := d.S3.PutObject(&s3.PutObjectInput{
+	_, err := d.S3.PutObjectWithContext(detach(ctx), &s3.PutObjectInput{
 		Bucket:               aws.String(d.Bucket),
 		Key:                  aws.String(d.s3Path(path)),
 		ContentType:          d.getContentType(),
@@ -531,7 +790,7 @@ func (d *driver) PutContent(ctx context.Context, path string, contents []byte) e
 // Reader retrieves an io.ReadCloser for the content stored at "path" with a
 // given byte offset.
 func (d *driver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
-	resp, err := d.S3.GetObject(&s3.GetObjectInput{
+	resp, err := d.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(d.Bucket),
 		Key:    aws.String(d.s3Path(path)),
 		Range:  aws.String("bytes=" + strconv.FormatInt(offset, 10) + "-"),
@@ -553,7 +812,7 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 	key := d.s3Path(path)
 	if !append {
 		// TODO (brianbland): cancel other uploads at this path
-		resp, err := d.S3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		resp, err := d.S3.CreateMultipartUploadWithContext(detach(ctx), &s3.CreateMultipartUploadInput{
 			Bucket:               aws.String(d.Bucket),
 			Key:                  aws.String(key),
 			ContentType:          d.getContentType(),
@@ -563,11 +822,11 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 			StorageClass:         d.getStorageClass(),
 		})
 		if err != nil {
-			return nil, err
+			return nil, parseError(path, err)
 		}
-		return d.newWriter(key, *resp.UploadId, nil), nil
+		return d.newWriter(ctx, key, *resp.UploadId, nil), nil
 	}
-	resp, err := d.S3.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+	resp, err := d.S3.ListMultipartUploadsWithContext(detach(ctx), &s3.ListMultipartUploadsInput{
 		Bucket: aws.String(d.Bucket),
 		Prefix: aws.String(key),
 	})
@@ -579,7 +838,7 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 		if key != *multi.Key {
 			continue
 		}
-		resp, err := d.S3.ListParts(&s3.ListPartsInput{
+		resp, err := d.S3.ListPartsWithContext(detach(ctx), &s3.ListPartsInput{
 			Bucket:   aws.String(d.Bucket),
 			Key:      aws.String(key),
 			UploadId: multi.UploadId,
@@ -591,7 +850,7 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 		for _, part := range resp.Parts {
 			multiSize += *part.Size
 		}
-		return d.newWriter(key, *multi.UploadId, resp.Parts), nil
+		return d.newWriter(ctx, key, *multi.UploadId, resp.Parts), nil
 	}
 	return nil, storagedriver.PathNotFoundError{Path: path}
 }
@@ -599,13 +858,13 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 // Stat retrieves the FileInfo for the given path, including the current size
 // in bytes and the creation time.
 func (d *driver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
-	resp, err := d.S3.ListObjects(&s3.ListObjectsInput{
+	resp, err := d.S3.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
 		Bucket:  aws.String(d.Bucket),
 		Prefix:  aws.String(d.s3Path(path)),
 		MaxKeys: aws.Int64(1),
 	})
 	if err != nil {
-		return nil, err
+		return nil, parseError(path, err)
 	}
 
 	fi := storagedriver.FileInfoFields{
@@ -644,7 +903,7 @@ func (d *driver) List(ctx context.Context, opath string) ([]string, error) {
 		prefix = "/"
 	}
 
-	resp, err := d.S3.ListObjects(&s3.ListObjectsInput{
+	resp, err := d.S3.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
 		Bucket:    aws.String(d.Bucket),
 		Prefix:    aws.String(d.s3Path(path)),
 		Delimiter: aws.String("/"),
@@ -668,7 +927,7 @@ func (d *driver) List(ctx context.Context, opath string) ([]string, error) {
 		}
 
 		if *resp.IsTruncated {
-			resp, err = d.S3.ListObjects(&s3.ListObjectsInput{
+			resp, err = d.S3.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
 				Bucket:    aws.String(d.Bucket),
 				Prefix:    aws.String(d.s3Path(path)),
 				Delimiter: aws.String("/"),
@@ -676,7 +935,7 @@ func (d *driver) List(ctx context.Context, opath string) ([]string, error) {
 				Marker:    resp.NextMarker,
 			})
 			if err != nil {
-				return nil, err
+				return nil, parseError(opath, err)
 			}
 		} else {
 			break
@@ -704,8 +963,33 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	return d.Delete(ctx, sourcePath)
 }
 
+// Copy copies an object stored at sourcePath to destPath without
+// downloading it.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	return d.copy(ctx, sourcePath, destPath)
+}
+
 // copy copies an object stored at sourcePath to destPath.
 func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) error {
+	return d.copyWithStorageClass(ctx, sourcePath, destPath, d.getStorageClass())
+}
+
+// copyWithStorageClass copies an object stored at sourcePath to destPath,
+// placing the copy in the given storage class.
+func (d *driver) copyWithStorageClass(ctx context.Context, sourcePath string, destPath string, storageClass *string) error {
+	return d.copyObject(ctx, sourcePath, d.Bucket, d.s3Path(destPath), storageClass)
+}
+
+// Export copies an object stored at sourcePath to the key of another bucket
+// without downloading it. The credentials of the driver must be allowed to
+// write to the bucket.
+func (d *driver) Export(ctx context.Context, sourcePath string, bucket string, key string) error {
+	return d.copyObject(ctx, sourcePath, bucket, strings.TrimLeft(key, "/"), d.getStorageClass())
+}
+
+// copyObject copies an object stored at sourcePath to the key of bucket,
+// placing the copy in the given storage class.
+func (d *driver) copyObject(ctx context.Context, sourcePath string, bucket string, key string, storageClass *string) error {
 	// S3 can copy objects up to 5 GB in size with a single PUT Object - Copy
 	// operation. For larger objects, the multipart upload API must be used.
 	//
@@ -718,14 +1002,14 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 	}
 
 	if fileInfo.Size() <= d.MultipartCopyThresholdSize {
-		_, err := d.S3.CopyObject(&s3.CopyObjectInput{
-			Bucket:               aws.String(d.Bucket),
-			Key:                  aws.String(d.s3Path(destPath)),
+		_, err := d.S3.CopyObjectWithContext(detach(ctx), &s3.CopyObjectInput{
+			Bucket:               aws.String(bucket),
+			Key:                  aws.String(key),
 			ContentType:          d.getContentType(),
 			ACL:                  d.getACL(),
 			ServerSideEncryption: d.getEncryptionMode(),
 			SSEKMSKeyId:          d.getSSEKMSKeyID(),
-			StorageClass:         d.getStorageClass(),
+			StorageClass:         storageClass,
 			CopySource:           aws.String(d.Bucket + "/" + d.s3Path(sourcePath)),
 		})
 		if err != nil {
@@ -734,17 +1018,17 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 		return nil
 	}
 
-	createResp, err := d.S3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
-		Bucket:               aws.String(d.Bucket),
-		Key:                  aws.String(d.s3Path(destPath)),
+	createResp, err := d.S3.CreateMultipartUploadWithContext(detach(ctx), &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
 		ContentType:          d.getContentType(),
 		ACL:                  d.getACL(),
 		SSEKMSKeyId:          d.getSSEKMSKeyID(),
 		ServerSideEncryption: d.getEncryptionMode(),
-		StorageClass:         d.getStorageClass(),
+		StorageClass:         storageClass,
 	})
 	if err != nil {
-		return err
+		return parseError(sourcePath, err)
 	}
 
 	numParts := (fileInfo.Size() + d.MultipartCopyChunkSize - 1) / d.MultipartCopyChunkSize
@@ -761,10 +1045,10 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 			if lastByte >= fileInfo.Size() {
 				lastByte = fileInfo.Size() - 1
 			}
-			uploadResp, err := d.S3.UploadPartCopy(&s3.UploadPartCopyInput{
-				Bucket:          aws.String(d.Bucket),
+			uploadResp, err := d.S3.UploadPartCopyWithContext(detach(ctx), &s3.UploadPartCopyInput{
+				Bucket:          aws.String(bucket),
 				CopySource:      aws.String(d.Bucket + "/" + d.s3Path(sourcePath)),
-				Key:             aws.String(d.s3Path(destPath)),
+				Key:             aws.String(key),
 				PartNumber:      aws.Int64(i + 1),
 				UploadId:        createResp.UploadId,
 				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", firstByte, lastByte)),
@@ -783,17 +1067,47 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 	for range completedParts {
 		err := <-errChan
 		if err != nil {
-			return err
+			return parseError(sourcePath, err)
 		}
 	}
 
-	_, err = d.S3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
-		Bucket:          aws.String(d.Bucket),
-		Key:             aws.String(d.s3Path(destPath)),
+	_, err = d.S3.CompleteMultipartUploadWithContext(detach(ctx), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
 		UploadId:        createResp.UploadId,
 		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completedParts},
 	})
-	return err
+	return parseError(sourcePath, err)
+}
+
+// GetStorageClass returns the storage class of the object stored at path.
+func (d *driver) GetStorageClass(ctx context.Context, path string) (string, error) {
+	resp, err := d.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(d.Bucket),
+		Key:    aws.String(d.s3Path(path)),
+	})
+	if err != nil {
+		// HEAD responses carry no body, so a missing key is reported with
+		// a bare "NotFound" code.
+		if s3Err, ok := err.(awserr.Error); ok && s3Err.Code() == "NotFound" {
+			return "", storagedriver.PathNotFoundError{Path: path}
+		}
+		return "", parseError(path, err)
+	}
+	// S3 omits the storage class of objects in the standard class.
+	if resp.StorageClass == nil {
+		return s3.StorageClassStandard, nil
+	}
+	return *resp.StorageClass, nil
+}
+
+// SetStorageClass moves the object stored at path to the given storage class
+// by copying it onto itself.
+func (d *driver) SetStorageClass(ctx context.Context, path string, class string) error {
+	if d.StorageClass == noStorageClass {
+		return storagedriver.ErrUnsupportedMethod{}
+	}
+	return d.copyWithStorageClass(ctx, path, path, aws.String(class))
 }
 
 func min(a, b int) int {
@@ -806,6 +1120,33 @@ func min(a, b int) int {
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 // We must be careful since S3 does not guarantee read after delete consistency
 func (d *driver) Delete(ctx context.Context, path string) error {
+	s3Objects, err := d.listSubpaths(ctx, path)
+	if err != nil {
+		return err
+	}
+	if len(s3Objects) == 0 {
+		return storagedriver.PathNotFoundError{Path: path}
+	}
+
+	return d.deleteObjects(ctx, s3Objects)
+}
+
+// DeleteBatch recursively deletes all objects stored at paths and their
+// subpaths, using as few delete requests as possible.
+func (d *driver) DeleteBatch(ctx context.Context, paths []string) error {
+	var s3Objects []*s3.ObjectIdentifier
+	for _, path := range paths {
+		objects, err := d.listSubpaths(ctx, path)
+		if err != nil {
+			return err
+		}
+		s3Objects = append(s3Objects, objects...)
+	}
+	return d.deleteObjects(ctx, s3Objects)
+}
+
+// listSubpaths returns the objects stored at path and its subpaths.
+func (d *driver) listSubpaths(ctx context.Context, path string) ([]*s3.ObjectIdentifier, error) {
 	s3Objects := make([]*s3.ObjectIdentifier, 0, listMax)
 	s3Path := d.s3Path(path)
 	listObjectsInput := &s3.ListObjectsInput{
@@ -815,13 +1156,12 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 ListLoop:
 	for {
 		// list all the objects
-		resp, err := d.S3.ListObjects(listObjectsInput)
-
-		// resp.Contents can only be empty on the first call
-		// if there were no more results to return after the first call, resp.IsTruncated would have been false
-		// and the loop would be exited without recalling ListObjects
-		if err != nil || len(resp.Contents) == 0 {
-			return storagedriver.PathNotFoundError{Path: path}
+		resp, err := d.S3.ListObjectsWithContext(detach(ctx), listObjectsInput)
+		if err != nil {
+			return nil, parseError(path, err)
+		}
+		if len(resp.Contents) == 0 {
+			break
 		}
 
 		for _, key := range resp.Contents {
@@ -834,7 +1174,6 @@ ListLoop:
 			})
 		}
 
-		// resp.Contents must have at least one element or we would have returned not found
 		listObjectsInput.Marker = resp.Contents[len(resp.Contents)-1].Key
 
 		// from the s3 api docs, IsTruncated "specifies whether (true) or not (false) all of the results were returned"
@@ -843,24 +1182,71 @@ ListLoop:
 			break
 		}
 	}
+	return s3Objects, nil
+}
 
-	// need to chunk objects into groups of 1000 per s3 restrictions
+// deleteObjects deletes the given objects in chunks of at most 1000 objects,
+// the maximum accepted by a single DeleteObjects request.
+func (d *driver) deleteObjects(ctx context.Context, s3Objects []*s3.ObjectIdentifier) error {
 	total := len(s3Objects)
 	for i := 0; i < total; i += 1000 {
-		_, err := d.S3.DeleteObjects(&s3.DeleteObjectsInput{
+		resp, err := d.S3.DeleteObjectsWithContext(detach(ctx), &s3.DeleteObjectsInput{
 			Bucket: aws.String(d.Bucket),
 			Delete: &s3.Delete{
 				Objects: s3Objects[i:min(i+1000, total)],
-				Quiet:   aws.Bool(false),
+				Quiet:   aws.Bool(true),
 			},
 		})
 		if err != nil {
-			return err
+			return classifyError(err)
+		}
+		if len(resp.Errors) > 0 {
+			deleteErr := resp.Errors[0]
+			return fmt.Errorf("failed to delete %d objects, first error on %s: %s", len(resp.Errors), aws.StringValue(deleteErr.Key), aws.StringValue(deleteErr.Message))
 		}
 	}
 	return nil
 }
 
+// ListMultipartUploads returns the incomplete multipart uploads to paths below
+// prefix.
+func (d *driver) ListMultipartUploads(ctx context.Context, prefix string) ([]storagedriver.MultipartUpload, error) {
+	root := d.s3Path("/")
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(d.Bucket),
+		Prefix: aws.String(d.s3Path(prefix)),
+	}
+
+	var uploads []storagedriver.MultipartUpload
+	for {
+		resp, err := d.S3.ListMultipartUploadsWithContext(ctx, input)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		for _, multi := range resp.Uploads {
+			uploads = append(uploads, storagedriver.MultipartUpload{
+				Path: "/" + strings.TrimPrefix(*multi.Key, root),
+				ID:   *multi.UploadId,
+			})
+		}
+		if resp.IsTruncated == nil || !*resp.IsTruncated {
+			return uploads, nil
+		}
+		input.KeyMarker = resp.NextKeyMarker
+		input.UploadIdMarker = resp.NextUploadIdMarker
+	}
+}
+
+// AbortMultipartUpload aborts an upload, deleting the parts stored.
+func (d *driver) AbortMultipartUpload(ctx context.Context, upload storagedriver.MultipartUpload) error {
+	_, err := d.S3.AbortMultipartUploadWithContext(detach(ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(d.Bucket),
+		Key:      aws.String(d.s3Path(upload.Path)),
+		UploadId: aws.String(upload.ID),
+	})
+	return parseError(upload.Path, err)
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
@@ -917,7 +1303,7 @@ func (d *driver) Walk(ctx context.Context, from string, f storagedriver.WalkFn)
 
 	var objectCount int64
 	if err := d.doWalk(ctx, &objectCount, d.s3Path(path), prefix, f); err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	// S3 doesn't have the concept of empty directories, so it'll return path not found if there are no objects
@@ -1057,7 +1443,7 @@ func parseError(path string, err error) error {
 		return storagedriver.PathNotFoundError{Path: path}
 	}
 
-	return err
+	return classifyError(err)
 }
 
 func (d *driver) getEncryptionMode() *string {
@@ -1097,6 +1483,10 @@ func (d *driver) getStorageClass() *string {
 // cleanly resumed in the future. This is violated if Close is called after less
 // than a full chunk is written.
 type writer struct {
+	// buffered is the number of bytes held in the part buffers, read
+	// atomically by the statistics of the driver.
+	buffered    int64
+	ctx         context.Context
 	driver      *driver
 	key         string
 	uploadID    string
@@ -1107,20 +1497,27 @@ type writer struct {
 	closed      bool
 	committed   bool
 	cancelled   bool
+	// attempted holds the MD5 sums of the parts whose upload failed, by part
+	// number. A failed upload may still have stored the part, in which case
+	// it is not uploaded again.
+	attempted map[int64][md5.Size]byte
 }
 
-func (d *driver) newWriter(key, uploadID string, parts []*s3.Part) storagedriver.FileWriter {
+func (d *driver) newWriter(ctx context.Context, key, uploadID string, parts []*s3.Part) storagedriver.FileWriter {
 	var size int64
 	for _, part := range parts {
 		size += *part.Size
 	}
-	return &writer{
+	w := &writer{
+		ctx:      detach(ctx),
 		driver:   d,
 		key:      key,
 		uploadID: uploadID,
 		parts:    parts,
 		size:     size,
 	}
+	d.stats.open(w)
+	return w
 }
 
 type completedParts []*s3.CompletedPart
@@ -1130,14 +1527,103 @@ func (a completedParts) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a completedParts) Less(i, j int) bool { return *a[i].PartNumber < *a[j].PartNumber }
 
 func (w *writer) Write(p []byte) (int, error) {
+	if err := w.writable(); err != nil {
+		return 0, err
+	}
+	defer w.updateBuffered()
+	if err := w.restartSmallUpload(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	for len(p) > 0 {
+		part, free := w.fillablePart()
+		m := copy(free, p)
+		*part = (*part)[:len(*part)+m]
+		n += m
+		p = p[m:]
+
+		if len(w.pendingPart) == int(w.driver.ChunkSize) {
+			if err := w.flushPart(); err != nil {
+				w.size += int64(n)
+				return n, err
+			}
+		}
+	}
+	w.size += int64(n)
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom, reading r straight into the part
+// buffers. This spares copying the content through an intermediate buffer,
+// which matters for large blobs uploaded in a single request.
+func (w *writer) ReadFrom(r io.Reader) (int64, error) {
+	if err := w.writable(); err != nil {
+		return 0, err
+	}
+	defer w.updateBuffered()
+	if err := w.restartSmallUpload(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for {
+		part, free := w.fillablePart()
+		m, err := r.Read(free)
+		*part = (*part)[:len(*part)+m]
+		n += int64(m)
+		w.size += int64(m)
+
+		if len(w.pendingPart) == int(w.driver.ChunkSize) {
+			if err := w.flushPart(); err != nil {
+				return n, err
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+func (w *writer) writable() error {
 	if w.closed {
-		return 0, fmt.Errorf("already closed")
+		return fmt.Errorf("already closed")
 	} else if w.committed {
-		return 0, fmt.Errorf("already committed")
+		return fmt.Errorf("already committed")
 	} else if w.cancelled {
-		return 0, fmt.Errorf("already cancelled")
+		return fmt.Errorf("already cancelled")
 	}
+	return nil
+}
+
+// fillablePart returns the part buffer the next written bytes go to, and the
+// free space of the buffer they are written to: the ready part until it holds
+// a full chunk, then the pending part. Buffers grow as content is written, up
+// to a full chunk, so that small uploads do not hold a buffer of a full chunk.
+func (w *writer) fillablePart() (*[]byte, []byte) {
+	chunkSize := int(w.driver.ChunkSize)
+	part := &w.readyPart
+	if len(w.readyPart) >= chunkSize {
+		part = &w.pendingPart
+	}
+	if len(*part) == cap(*part) {
+		capacity := 2 * cap(*part)
+		if capacity < initialPartCapacity {
+			capacity = initialPartCapacity
+		}
+		buf := make([]byte, len(*part), min(capacity, chunkSize))
+		copy(buf, *part)
+		*part = buf
+	}
+	return part, (*part)[len(*part):min(cap(*part), chunkSize)]
+}
 
+// restartSmallUpload starts a new multipart upload holding the content
+// written so far if the last written part is smaller than minChunkSize, as
+// S3 only accepts such a part as the last part of an upload.
+func (w *writer) restartSmallUpload() error {
 	// If the last written part is smaller than minChunkSize, we need to make a
 	// new multipart upload :sadface:
 	if len(w.parts) > 0 && int(*w.parts[len(w.parts)-1].Size) < minChunkSize {
@@ -1151,7 +1637,7 @@ func (w *writer) Write(p []byte) (int, error) {
 
 		sort.Sort(completedUploadedParts)
 
-		_, err := w.driver.S3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		_, err := w.driver.S3.CompleteMultipartUploadWithContext(w.ctx, &s3.CompleteMultipartUploadInput{
 			Bucket:   aws.String(w.driver.Bucket),
 			Key:      aws.String(w.key),
 			UploadId: aws.String(w.uploadID),
@@ -1160,15 +1646,15 @@ func (w *writer) Write(p []byte) (int, error) {
 			},
 		})
 		if err != nil {
-			w.driver.S3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			w.driver.S3.AbortMultipartUploadWithContext(w.ctx, &s3.AbortMultipartUploadInput{
 				Bucket:   aws.String(w.driver.Bucket),
 				Key:      aws.String(w.key),
 				UploadId: aws.String(w.uploadID),
 			})
-			return 0, err
+			return classifyError(err)
 		}
 
-		resp, err := w.driver.S3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		resp, err := w.driver.S3.CreateMultipartUploadWithContext(w.ctx, &s3.CreateMultipartUploadInput{
 			Bucket:               aws.String(w.driver.Bucket),
 			Key:                  aws.String(w.key),
 			ContentType:          w.driver.getContentType(),
@@ -1177,29 +1663,30 @@ func (w *writer) Write(p []byte) (int, error) {
 			StorageClass:         w.driver.getStorageClass(),
 		})
 		if err != nil {
-			return 0, err
+			return classifyError(err)
 		}
 		w.uploadID = *resp.UploadId
+		w.attempted = nil
 
 		// If the entire written file is smaller than minChunkSize, we need to make
 		// a new part from scratch :double sad face:
 		if w.size < minChunkSize {
-			resp, err := w.driver.S3.GetObject(&s3.GetObjectInput{
+			resp, err := w.driver.S3.GetObjectWithContext(w.ctx, &s3.GetObjectInput{
 				Bucket: aws.String(w.driver.Bucket),
 				Key:    aws.String(w.key),
 			})
 			if err != nil {
-				return 0, err
+				return classifyError(err)
 			}
 			defer resp.Body.Close()
 			w.parts = nil
 			w.readyPart, err = ioutil.ReadAll(resp.Body)
 			if err != nil {
-				return 0, err
+				return classifyError(err)
 			}
 		} else {
 			// Otherwise we can use the old file as the new first part
-			copyPartResp, err := w.driver.S3.UploadPartCopy(&s3.UploadPartCopyInput{
+			copyPartResp, err := w.driver.S3.UploadPartCopyWithContext(w.ctx, &s3.UploadPartCopyInput{
 				Bucket:     aws.String(w.driver.Bucket),
 				CopySource: aws.String(w.driver.Bucket + "/" + w.key),
 				Key:        aws.String(w.key),
@@ -1207,7 +1694,7 @@ func (w *writer) Write(p []byte) (int, error) {
 				UploadId:   resp.UploadId,
 			})
 			if err != nil {
-				return 0, err
+				return classifyError(err)
 			}
 			w.parts = []*s3.Part{
 				{
@@ -1218,53 +1705,33 @@ func (w *writer) Write(p []byte) (int, error) {
 			}
 		}
 	}
-
-	var n int
-
-	for len(p) > 0 {
-		// If no parts are ready to write, fill up the first part
-		if neededBytes := int(w.driver.ChunkSize) - len(w.readyPart); neededBytes > 0 {
-			if len(p) >= neededBytes {
-				w.readyPart = append(w.readyPart, p[:neededBytes]...)
-				n += neededBytes
-				p = p[neededBytes:]
-			} else {
-				w.readyPart = append(w.readyPart, p...)
-				n += len(p)
-				p = nil
-			}
-		}
-
-		if neededBytes := int(w.driver.ChunkSize) - len(w.pendingPart); neededBytes > 0 {
-			if len(p) >= neededBytes {
-				w.pendingPart = append(w.pendingPart, p[:neededBytes]...)
-				n += neededBytes
-				p = p[neededBytes:]
-				err := w.flushPart()
-				if err != nil {
-					w.size += int64(n)
-					return n, err
-				}
-			} else {
-				w.pendingPart = append(w.pendingPart, p...)
-				n += len(p)
-				p = nil
-			}
-		}
-	}
-	w.size += int64(n)
-	return n, nil
+	return nil
 }
 
 func (w *writer) Size() int64 {
 	return w.size
 }
 
+// Progress reports the number of parts uploaded to S3 and the bytes still
+// held in the part buffers.
+func (w *writer) Progress() storagedriver.FileWriterProgress {
+	var persisted int64
+	for _, part := range w.parts {
+		persisted += *part.Size
+	}
+	return storagedriver.FileWriterProgress{
+		PartsCompleted: len(w.parts),
+		BytesPersisted: persisted,
+		BytesBuffered:  int64(len(w.readyPart) + len(w.pendingPart)),
+	}
+}
+
 func (w *writer) Close() error {
 	if w.closed {
 		return fmt.Errorf("already closed")
 	}
 	w.closed = true
+	defer w.driver.stats.close(w)
 	return w.flushPart()
 }
 
@@ -1275,12 +1742,13 @@ func (w *writer) Cancel() error {
 		return fmt.Errorf("already committed")
 	}
 	w.cancelled = true
-	_, err := w.driver.S3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+	w.driver.stats.close(w)
+	_, err := w.driver.S3.AbortMultipartUploadWithContext(w.ctx, &s3.AbortMultipartUploadInput{
 		Bucket:   aws.String(w.driver.Bucket),
 		Key:      aws.String(w.key),
 		UploadId: aws.String(w.uploadID),
 	})
-	return err
+	return classifyError(err)
 }
 
 func (w *writer) Commit() error {
@@ -1293,9 +1761,10 @@ func (w *writer) Commit() error {
 	}
 	err := w.flushPart()
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 	w.committed = true
+	defer w.driver.stats.close(w)
 
 	var completedUploadedParts completedParts
 	for _, part := range w.parts {
@@ -1305,9 +1774,39 @@ func (w *writer) Commit() error {
 		})
 	}
 
+	// S3 refuses to complete a multipart upload without parts, so an empty
+	// file is uploaded as a single empty part.
+	if len(completedUploadedParts) == 0 {
+		resp, err := w.driver.S3.UploadPartWithContext(w.ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(w.driver.Bucket),
+			Key:        aws.String(w.key),
+			PartNumber: aws.Int64(1),
+			UploadId:   aws.String(w.uploadID),
+			Body:       bytes.NewReader(nil),
+		})
+		if err != nil {
+			return classifyError(err)
+		}
+		completedUploadedParts = append(completedUploadedParts, &s3.CompletedPart{
+			ETag:       resp.ETag,
+			PartNumber: aws.Int64(1),
+		})
+	}
+
 	sort.Sort(completedUploadedParts)
 
-	_, err = w.driver.S3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+	if w.driver.VerifyParts && len(w.parts) > 0 {
+		if err := w.verifyParts(); err != nil {
+			w.driver.S3.AbortMultipartUploadWithContext(w.ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(w.driver.Bucket),
+				Key:      aws.String(w.key),
+				UploadId: aws.String(w.uploadID),
+			})
+			return err
+		}
+	}
+
+	_, err = w.driver.S3.CompleteMultipartUploadWithContext(w.ctx, &s3.CompleteMultipartUploadInput{
 		Bucket:   aws.String(w.driver.Bucket),
 		Key:      aws.String(w.key),
 		UploadId: aws.String(w.uploadID),
@@ -1316,19 +1815,60 @@ func (w *writer) Commit() error {
 		},
 	})
 	if err != nil {
-		w.driver.S3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		w.driver.S3.AbortMultipartUploadWithContext(w.ctx, &s3.AbortMultipartUploadInput{
 			Bucket:   aws.String(w.driver.Bucket),
 			Key:      aws.String(w.key),
 			UploadId: aws.String(w.uploadID),
 		})
-		return err
+		return classifyError(err)
+	}
+	return nil
+}
+
+// verifyParts checks that the parts stored by S3 for the upload are the parts
+// uploaded by the writer, with the same sizes and ETags, so that an upload
+// assembled from diverging parts is failed before being completed rather
+// than when its digest is verified. The parts stored but not uploaded by the
+// writer are left out of the completed upload, and S3 discards them.
+func (w *writer) verifyParts() error {
+	stored := make(map[int64]*s3.Part)
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(w.driver.Bucket),
+		Key:      aws.String(w.key),
+		UploadId: aws.String(w.uploadID),
+	}
+	err := w.driver.S3.ListPartsPagesWithContext(w.ctx, input, func(resp *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range resp.Parts {
+			stored[*part.PartNumber] = part
+		}
+		return true
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	for _, part := range w.parts {
+		s, ok := stored[*part.PartNumber]
+		if !ok {
+			return fmt.Errorf("part %d of the upload of %s is missing", *part.PartNumber, w.key)
+		}
+		if *s.Size != *part.Size || *s.ETag != *part.ETag {
+			return fmt.Errorf("part %d of the upload of %s diverged: %d bytes with ETag %s stored, %d bytes with ETag %s uploaded",
+				*part.PartNumber, w.key, *s.Size, *s.ETag, *part.Size, *part.ETag)
+		}
+		delete(stored, *part.PartNumber)
+	}
+	if len(stored) > 0 {
+		dcontext.GetLogger(w.ctx).Warnf("s3aws: leaving %d unexpected parts out of the upload of %s", len(stored), w.key)
 	}
 	return nil
 }
 
 // flushPart flushes buffers to write a part to S3.
-// Only called by Write (with both buffers full) and Close/Commit (always)
+// Only called by Write and ReadFrom (with both buffers full) and Close/Commit
+// (always)
 func (w *writer) flushPart() error {
+	defer w.updateBuffered()
 	if len(w.readyPart) == 0 && len(w.pendingPart) == 0 {
 		// nothing to write
 		return nil
@@ -1340,23 +1880,66 @@ func (w *writer) flushPart() error {
 		w.pendingPart = nil
 	}
 
-	partNumber := aws.Int64(int64(len(w.parts) + 1))
-	resp, err := w.driver.S3.UploadPart(&s3.UploadPartInput{
-		Bucket:     aws.String(w.driver.Bucket),
-		Key:        aws.String(w.key),
-		PartNumber: partNumber,
-		UploadId:   aws.String(w.uploadID),
-		Body:       bytes.NewReader(w.readyPart),
-	})
+	partNumber := int64(len(w.parts) + 1)
+	sum := md5.Sum(w.readyPart)
+	part, err := w.uploadedPart(partNumber, sum)
 	if err != nil {
 		return err
 	}
-	w.parts = append(w.parts, &s3.Part{
-		ETag:       resp.ETag,
-		PartNumber: partNumber,
-		Size:       aws.Int64(int64(len(w.readyPart))),
-	})
-	w.readyPart = w.pendingPart
-	w.pendingPart = nil
+	if part == nil {
+		resp, err := w.driver.S3.UploadPartWithContext(w.ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(w.driver.Bucket),
+			Key:        aws.String(w.key),
+			PartNumber: aws.Int64(partNumber),
+			UploadId:   aws.String(w.uploadID),
+			Body:       bytes.NewReader(w.readyPart),
+		})
+		if err != nil {
+			if w.attempted == nil {
+				w.attempted = make(map[int64][md5.Size]byte)
+			}
+			w.attempted[partNumber] = sum
+			return classifyError(err)
+		}
+		part = &s3.Part{
+			ETag:       resp.ETag,
+			PartNumber: aws.Int64(partNumber),
+			Size:       aws.Int64(int64(len(w.readyPart))),
+		}
+	}
+	delete(w.attempted, partNumber)
+	w.parts = append(w.parts, part)
+	// the buffer of the uploaded part is reused for the next pending part
+	w.readyPart, w.pendingPart = w.pendingPart, w.readyPart[:0]
 	return nil
 }
+
+// uploadedPart returns the part numbered partNumber if an earlier attempt to
+// upload it with the content summed up by sum failed, but stored it anyway,
+// as happens when a response is lost after the part was received. It
+// returns nil if the part must be uploaded. Parts are only recognized by
+// ETag if it is the MD5 sum of their content, which is not the case of the
+// parts encrypted with KMS: these are uploaded again, replacing the part
+// stored by the earlier attempt.
+func (w *writer) uploadedPart(partNumber int64, sum [md5.Size]byte) (*s3.Part, error) {
+	if attempted, ok := w.attempted[partNumber]; !ok || attempted != sum {
+		return nil, nil
+	}
+	resp, err := w.driver.S3.ListPartsWithContext(w.ctx, &s3.ListPartsInput{
+		Bucket:           aws.String(w.driver.Bucket),
+		Key:              aws.String(w.key),
+		UploadId:         aws.String(w.uploadID),
+		PartNumberMarker: aws.Int64(partNumber - 1),
+		MaxParts:         aws.Int64(1),
+	})
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	etag := fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+	for _, part := range resp.Parts {
+		if *part.PartNumber == partNumber && *part.ETag == etag && *part.Size == int64(len(w.readyPart)) {
+			return part, nil
+		}
+	}
+	return nil, nil
+}
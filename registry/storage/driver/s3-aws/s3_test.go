@@ -96,6 +96,23 @@ func init() {
 			driverName + "-test",
 			objectACL,
 			sessionToken,
+			0,
+			0,
+			"",
+			0,
+			0,
+			false,
+			"",
+			"",
+			defaultMaxAttempts,
+			defaultRetryDelay,
+			defaultRetryJitter,
+			0,
+			defaultDialTimeout,
+			0,
+			defaultIdleConnTimeout,
+			false,
+			0,
 		}
 
 		return New(parameters)
@@ -29,7 +29,9 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/corehandlers"
@@ -47,6 +49,55 @@ type signer struct {
 	Query        url.Values
 	stringToSign string
 	signature    string
+
+	// resources memoizes the canonical resources of URLs. It may be nil.
+	resources *resourceCache
+}
+
+// resourceCacheSize bounds the number of canonical resources memoized by a
+// driver.
+const resourceCacheSize = 1024
+
+// canonicalResource is the host and the signed resource of a request URL: its
+// path followed by its sorted sub-resources.
+type canonicalResource struct {
+	host     string
+	resource string
+}
+
+// resourceCache memoizes the canonical resources of request URLs, so that
+// bursts of requests for the same objects, such as the HEAD requests checking
+// blob existence, do not parse and sort their URL every time. It is cleared
+// when full.
+type resourceCache struct {
+	mu        sync.Mutex
+	resources map[string]canonicalResource
+}
+
+func newResourceCache() *resourceCache {
+	return &resourceCache{resources: make(map[string]canonicalResource)}
+}
+
+func (c *resourceCache) get(u string) (canonicalResource, bool) {
+	if c == nil {
+		return canonicalResource{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.resources[u]
+	return r, ok
+}
+
+func (c *resourceCache) put(u string, r canonicalResource) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.resources) >= resourceCacheSize {
+		c.resources = make(map[string]canonicalResource)
+	}
+	c.resources[u] = r
 }
 
 var s3ParamsToSign = map[string]bool{
@@ -80,11 +131,16 @@ func setv2Handlers(svc *s3.S3) {
 		if err != nil {
 			log.Fatalf("Failed to parse URL: %v", err)
 		}
-		r.HTTPRequest.URL.Opaque = parsedURL.Path
+		// keep the host in the opaque form, so the URL still renders whole
+		// when presigned
+		r.HTTPRequest.URL.Opaque = "//" + parsedURL.Host + parsedURL.Path
 	})
 
+	resources := newResourceCache()
 	svc.Handlers.Sign.Clear()
-	svc.Handlers.Sign.PushBack(Sign)
+	svc.Handlers.Sign.PushBack(func(req *request.Request) {
+		sign(req, resources)
+	})
 	svc.Handlers.Sign.PushBackNamed(corehandlers.BuildContentLengthHandler)
 }
 
@@ -94,6 +150,10 @@ func setv2Handlers(svc *s3.S3) {
 // Signing is skipped if the credentials is the credentials.AnonymousCredentials
 // object.
 func Sign(req *request.Request) {
+	sign(req, nil)
+}
+
+func sign(req *request.Request, resources *resourceCache) {
 	// If the request does not need to be signed ignore the signing of the
 	// request if the AnonymousCredentials object is used.
 	if req.Config.Credentials == credentials.AnonymousCredentials {
@@ -104,6 +164,14 @@ func Sign(req *request.Request) {
 		Request:     req.HTTPRequest,
 		Time:        req.Time,
 		Credentials: req.Config.Credentials,
+		resources:   resources,
+	}
+	if req.IsPresigned() {
+		// presigned requests carry their expiry, and their signature, in
+		// the query
+		query := req.HTTPRequest.URL.Query()
+		query.Set("Expires", strconv.FormatInt(req.Time.Add(req.ExpireTime).Unix(), 10))
+		req.HTTPRequest.URL.RawQuery = query.Encode()
 	}
 	v2.Sign()
 }
@@ -115,30 +183,39 @@ func (v2 *signer) Sign() error {
 	}
 	accessKey := credValue.AccessKeyID
 	var (
-		md5, ctype, date, xamz string
-		xamzDate               bool
-		sarray                 []string
-		smap                   map[string]string
-		sharray                []string
+		md5, ctype, date string
+		xamzDate         bool
 	)
 
 	headers := v2.Request.Header
-	params := v2.Request.URL.Query()
-	parsedURL, err := url.Parse(v2.Request.URL.String())
-	if err != nil {
-		return err
+
+	// only presigned requests carry their expiry in the query, their
+	// resources are not memoized since it changes with every request
+	var params url.Values
+	if strings.Contains(v2.Request.URL.RawQuery, "Expires=") {
+		params = v2.Request.URL.Query()
+	}
+	_, expires := params["Expires"]
+
+	rawURL := v2.Request.URL.String()
+	resource, ok := v2.resources.get(rawURL)
+	if !ok {
+		resource, err = canonicalizeResource(rawURL)
+		if err != nil {
+			return err
+		}
+		if !expires {
+			v2.resources.put(rawURL, resource)
+		}
 	}
-	host, canonicalPath := parsedURL.Host, parsedURL.Path
-	v2.Request.Header["Host"] = []string{host}
+	v2.Request.Header["Host"] = []string{resource.host}
 	v2.Request.Header["date"] = []string{v2.Time.In(time.UTC).Format(time.RFC1123)}
 	if credValue.SessionToken != "" {
 		v2.Request.Header["x-amz-security-token"] = []string{credValue.SessionToken}
 	}
 
-	smap = make(map[string]string)
 	for k, v := range headers {
-		k = strings.ToLower(k)
-		switch k {
+		switch strings.ToLower(k) {
 		case "content-md5":
 			md5 = v[0]
 		case "content-type":
@@ -147,56 +224,24 @@ func (v2 *signer) Sign() error {
 			if !xamzDate {
 				date = v[0]
 			}
-		default:
-			if strings.HasPrefix(k, "x-amz-") {
-				vall := strings.Join(v, ",")
-				smap[k] = k + ":" + vall
-				if k == "x-amz-date" {
-					xamzDate = true
-					date = ""
-				}
-				sharray = append(sharray, k)
-			}
+		case "x-amz-date":
+			xamzDate = true
+			date = ""
 		}
 	}
-	if len(sharray) > 0 {
-		sort.StringSlice(sharray).Sort()
-		for _, h := range sharray {
-			sarray = append(sarray, smap[h])
-		}
-		xamz = strings.Join(sarray, "\n") + "\n"
-	}
+	xamz := canonicalizedAmzHeaders(headers)
 
-	expires := false
-	if v, ok := params["Expires"]; ok {
-		expires = true
-		date = v[0]
+	if expires {
+		date = params["Expires"][0]
 		params["AWSAccessKeyId"] = []string{accessKey}
 	}
 
-	sarray = sarray[0:0]
-	for k, v := range params {
-		if s3ParamsToSign[k] {
-			for _, vi := range v {
-				if vi == "" {
-					sarray = append(sarray, k)
-				} else {
-					sarray = append(sarray, k+"="+vi)
-				}
-			}
-		}
-	}
-	if len(sarray) > 0 {
-		sort.StringSlice(sarray).Sort()
-		canonicalPath = canonicalPath + "?" + strings.Join(sarray, "&")
-	}
-
 	v2.stringToSign = strings.Join([]string{
 		v2.Request.Method,
 		md5,
 		ctype,
 		date,
-		xamz + canonicalPath,
+		xamz + resource.resource,
 	}, "\n")
 	hash := hmac.New(sha1.New, []byte(credValue.SecretAccessKey))
 	hash.Write([]byte(v2.stringToSign))
@@ -204,6 +249,7 @@ func (v2 *signer) Sign() error {
 
 	if expires {
 		params["Signature"] = []string{v2.signature}
+		v2.Request.URL.RawQuery = params.Encode()
 	} else {
 		headers["Authorization"] = []string{"AWS " + accessKey + ":" + v2.signature}
 	}
@@ -214,3 +260,64 @@ func (v2 *signer) Sign() error {
 	}).Debugln("request signature")
 	return nil
 }
+
+// canonicalizeResource returns the host and the signed resource of a request
+// URL.
+func canonicalizeResource(rawURL string) (canonicalResource, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return canonicalResource{}, err
+	}
+
+	var sarray []string
+	for k, v := range parsedURL.Query() {
+		if s3ParamsToSign[k] {
+			for _, vi := range v {
+				if vi == "" {
+					sarray = append(sarray, k)
+				} else {
+					sarray = append(sarray, k+"="+vi)
+				}
+			}
+		}
+	}
+	resource := parsedURL.Path
+	if len(sarray) > 0 {
+		sort.Strings(sarray)
+		resource = resource + "?" + strings.Join(sarray, "&")
+	}
+	return canonicalResource{host: parsedURL.Host, resource: resource}, nil
+}
+
+// canonicalizedAmzHeaders returns the x-amz- headers as they are signed, one
+// per line: named in lowercase and sorted, with the values of names differing
+// in case merged, and the whitespace around and within values folded.
+func canonicalizedAmzHeaders(headers http.Header) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make(map[string][]string)
+	var names []string
+	for _, k := range keys {
+		name := strings.ToLower(k)
+		if !strings.HasPrefix(name, "x-amz-") {
+			continue
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		for _, v := range headers[k] {
+			values[name] = append(values[name], strings.Join(strings.Fields(v), " "))
+		}
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, name+":"+strings.Join(values[name], ",")+"\n")
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,1002 @@
+// Package s3test implements an in-memory S3 server, for testing the s3aws
+// storage driver and the registry on top of it without a live bucket.
+//
+// The server supports the subset of the S3 API used by the driver: objects,
+// multipart uploads, listings and batch deletions, addressed in path style.
+// Requests signed with signature version 2 are verified; for signature
+// version 4 only the access key is checked. Faults may be injected to have
+// chosen requests fail.
+package s3test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minPartSize is the minimum size of the parts of a multipart upload, the
+// last one excepted.
+const minPartSize = 5 << 20
+
+// maxKeys is the default and maximum number of entries returned by a
+// listing.
+const maxKeys = 1000
+
+// Error is an S3 error response.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3test: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+var (
+	// ErrInternal is the error S3 replies with when it failed to serve a
+	// request, which clients are expected to retry.
+	ErrInternal = &Error{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+
+	// ErrSlowDown is the error S3 replies with when throttling requests.
+	ErrSlowDown = &Error{http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate."}
+)
+
+// Fault decides whether a request for the S3 operation op, such as
+// "PutObject" or "ListObjectsV2", fails. It returns the error to reply with,
+// or nil to serve the request.
+type Fault func(op string, r *http.Request) *Error
+
+// FailTimes returns a Fault failing the next n requests for op with err.
+func FailTimes(op string, n int, err *Error) Fault {
+	var mu sync.Mutex
+	return func(requested string, r *http.Request) *Error {
+		mu.Lock()
+		defer mu.Unlock()
+		if requested != op || n <= 0 {
+			return nil
+		}
+		n--
+		return err
+	}
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	modTime      time.Time
+	storageClass string
+}
+
+type part struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+type upload struct {
+	bucket       string
+	key          string
+	id           string
+	initiated    time.Time
+	storageClass string
+	parts        map[int]*part
+}
+
+// Server is an in-memory S3 server listening on a system-chosen port on the
+// local loopback interface.
+type Server struct {
+	// URL is the base URL of the server, to be used as the region endpoint
+	// of the driver.
+	URL string
+
+	accessKey string
+	secretKey string
+	server    *httptest.Server
+
+	mu         sync.Mutex
+	buckets    map[string]map[string]*object
+	uploads    map[string]*upload
+	lastID     int
+	fault      Fault
+	lost       Fault
+	operations map[string]int
+	region     string
+}
+
+// NewServer starts a server holding the given empty buckets, and accepting
+// requests signed with the given credentials. If accessKey is empty,
+// requests are not authenticated.
+func NewServer(accessKey, secretKey string, buckets ...string) *Server {
+	s := &Server{
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		buckets:    make(map[string]map[string]*object),
+		uploads:    make(map[string]*upload),
+		operations: make(map[string]int),
+	}
+	for _, bucket := range buckets {
+		s.buckets[bucket] = make(map[string]*object)
+	}
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetFault sets the fault deciding which requests fail, replacing the
+// previous one. A nil fault has every request served.
+func (s *Server) SetFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault = fault
+}
+
+// SetResponseFault sets the fault deciding which requests fail after being
+// served, as when their response is lost: the operation takes effect, but
+// the client gets an error. A nil fault has every response delivered.
+func (s *Server) SetResponseFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lost = fault
+}
+
+// SetRegion sets the region of the buckets, reported in the
+// x-amz-bucket-region header of HeadBucket responses and by
+// GetBucketLocation. By default buckets report no region, as many S3
+// compatible services, and are located in us-east-1.
+func (s *Server) SetRegion(region string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.region = region
+}
+
+// Requests returns the number of requests received for the S3 operation op,
+// failed ones included.
+func (s *Server) Requests(op string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.operations[op]
+}
+
+// ServeHTTP serves an S3 request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key := r.URL.Path, ""
+	if i := strings.Index(bucket[1:], "/"); i >= 0 {
+		bucket, key = bucket[1:i+1], bucket[i+2:]
+	} else {
+		bucket = bucket[1:]
+	}
+	op := operation(r, key)
+
+	s.mu.Lock()
+	s.operations[op]++
+	s.lastID++
+	fault, lost := s.fault, s.lost
+	requestID := strconv.Itoa(s.lastID)
+	s.mu.Unlock()
+	w.Header().Set("x-amz-request-id", requestID)
+
+	if err := s.authenticate(r); err != nil {
+		writeError(w, r, requestID, err)
+		return
+	}
+	if fault != nil {
+		if err := fault(op, r); err != nil {
+			writeError(w, r, requestID, err)
+			return
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, requestID, &Error{http.StatusBadRequest, "IncompleteBody", err.Error()})
+		return
+	}
+
+	result, data, err := s.serve(w, r, op, bucket, key, body)
+	if err != nil {
+		writeError(w, r, requestID, err.(*Error))
+		return
+	}
+	if lost != nil {
+		if err := lost(op, r); err != nil {
+			writeError(w, r, requestID, err)
+			return
+		}
+	}
+	if result != nil {
+		p, _ := xml.Marshal(result)
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(p)))
+		w.Write([]byte(xml.Header))
+		w.Write(p)
+	}
+	if data != nil {
+		w.Write(data)
+	}
+}
+
+// serve serves the operation op, returning the result to reply with as XML,
+// or the object data to reply with. Replies are written once the server is
+// unlocked, so that slow clients do not hold it.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, op, bucket, key string, body []byte) (result interface{}, data []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return nil, nil, &Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	}
+	q := r.URL.Query()
+
+	switch op {
+	case "HeadBucket":
+		if s.region != "" {
+			w.Header().Set("x-amz-bucket-region", s.region)
+		}
+	case "GetBucketLocation":
+		result = locationConstraint{Xmlns: s3Namespace, Location: s.region}
+	case "ListObjects":
+		result, err = s.listObjects(bucket, objects, q)
+	case "ListObjectsV2":
+		result, err = s.listObjectsV2(bucket, objects, q)
+	case "ListMultipartUploads":
+		result, err = s.listMultipartUploads(bucket, q)
+	case "DeleteObjects":
+		result, err = s.deleteObjects(objects, body)
+	case "GetObject", "HeadObject":
+		data, err = s.getObject(w, r, objects, key)
+	case "PutObject":
+		err = s.putObject(w, r, objects, key, body)
+	case "CopyObject":
+		result, err = s.copyObject(r, objects, key)
+	case "DeleteObject":
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case "CreateMultipartUpload":
+		result = s.createMultipartUpload(r, bucket, key)
+	case "UploadPart":
+		err = s.uploadPart(w, q, bucket, key, body)
+	case "UploadPartCopy":
+		result, err = s.uploadPartCopy(r, q, bucket, key)
+	case "ListParts":
+		result, err = s.listParts(q, bucket, key)
+	case "CompleteMultipartUpload":
+		result, err = s.completeMultipartUpload(q, bucket, key, body)
+	case "AbortMultipartUpload":
+		if _, err = s.getUpload(q, bucket, key); err == nil {
+			delete(s.uploads, q.Get("uploadId"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		err = &Error{http.StatusNotImplemented, "NotImplemented", "A header you provided implies functionality that is not implemented"}
+	}
+	return result, data, err
+}
+
+// operation returns the name of the S3 operation requested.
+func operation(r *http.Request, key string) string {
+	q := r.URL.Query()
+	_, uploads := q["uploads"]
+	_, uploadID := q["uploadId"]
+	copied := r.Header.Get("x-amz-copy-source") != ""
+
+	if key == "" {
+		switch {
+		case r.Method == "HEAD":
+			return "HeadBucket"
+		case r.Method == "GET" && uploads:
+			return "ListMultipartUploads"
+		case r.Method == "GET" && q["location"] != nil:
+			return "GetBucketLocation"
+		case r.Method == "GET" && q.Get("list-type") == "2":
+			return "ListObjectsV2"
+		case r.Method == "GET":
+			return "ListObjects"
+		case r.Method == "POST" && q["delete"] != nil:
+			return "DeleteObjects"
+		}
+		return r.Method + "Bucket"
+	}
+
+	switch {
+	case r.Method == "GET" && uploadID:
+		return "ListParts"
+	case r.Method == "GET":
+		return "GetObject"
+	case r.Method == "HEAD":
+		return "HeadObject"
+	case r.Method == "PUT" && uploadID && copied:
+		return "UploadPartCopy"
+	case r.Method == "PUT" && uploadID:
+		return "UploadPart"
+	case r.Method == "PUT" && copied:
+		return "CopyObject"
+	case r.Method == "PUT":
+		return "PutObject"
+	case r.Method == "POST" && uploads:
+		return "CreateMultipartUpload"
+	case r.Method == "POST" && uploadID:
+		return "CompleteMultipartUpload"
+	case r.Method == "DELETE" && uploadID:
+		return "AbortMultipartUpload"
+	case r.Method == "DELETE":
+		return "DeleteObject"
+	}
+	return r.Method + "Object"
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, requestID string, err *Error) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(err.Status)
+	// responses to HEAD requests carry no body, clients only get the status
+	if r.Method == "HEAD" {
+		return
+	}
+	p, _ := xml.Marshal(errorResult{
+		Code:      err.Code,
+		Message:   err.Message,
+		Resource:  r.URL.Path,
+		RequestID: requestID,
+	})
+	w.Write([]byte(xml.Header))
+	w.Write(p)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func storageClass(r *http.Request) string {
+	if class := r.Header.Get("x-amz-storage-class"); class != "" {
+		return class
+	}
+	return "STANDARD"
+}
+
+// listing holds the entries of a page of a listing.
+type listing struct {
+	contents  []contents
+	prefixes  []commonPrefix
+	truncated bool
+	last      string
+}
+
+// list lists up to max entries below prefix and after marker, grouping the
+// keys sharing a prefix up to the delimiter.
+func list(objects map[string]*object, prefix, delimiter, marker string, max int) listing {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var l listing
+	for _, key := range keys {
+		entry := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry <= marker || entry == l.last {
+			continue
+		}
+		if len(l.contents)+len(l.prefixes) == max {
+			l.truncated = true
+			break
+		}
+		if entry != key {
+			l.prefixes = append(l.prefixes, commonPrefix{Prefix: entry})
+		} else {
+			o := objects[key]
+			l.contents = append(l.contents, contents{
+				Key:          key,
+				LastModified: o.modTime.UTC().Format(timeFormat),
+				ETag:         o.etag,
+				Size:         int64(len(o.data)),
+				StorageClass: o.storageClass,
+			})
+		}
+		l.last = entry
+	}
+	return l
+}
+
+func maxParam(q url.Values, name string) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return maxKeys, nil
+	}
+	max, err := strconv.Atoi(v)
+	if err != nil || max < 0 {
+		return 0, &Error{http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Invalid %s %q", name, v)}
+	}
+	if max > maxKeys {
+		max = maxKeys
+	}
+	return max, nil
+}
+
+func (s *Server) listObjects(bucket string, objects map[string]*object, q url.Values) (interface{}, error) {
+	max, err := maxParam(q, "max-keys")
+	if err != nil {
+		return nil, err
+	}
+	l := list(objects, q.Get("prefix"), q.Get("delimiter"), q.Get("marker"), max)
+	result := listBucketResult{
+		Xmlns:          s3Namespace,
+		Name:           bucket,
+		Prefix:         q.Get("prefix"),
+		Marker:         q.Get("marker"),
+		MaxKeys:        max,
+		Delimiter:      q.Get("delimiter"),
+		IsTruncated:    l.truncated,
+		Contents:       l.contents,
+		CommonPrefixes: l.prefixes,
+	}
+	// like S3, only return the next marker when listing with a delimiter
+	if l.truncated && result.Delimiter != "" {
+		result.NextMarker = l.last
+	}
+	return result, nil
+}
+
+func (s *Server) listObjectsV2(bucket string, objects map[string]*object, q url.Values) (interface{}, error) {
+	max, err := maxParam(q, "max-keys")
+	if err != nil {
+		return nil, err
+	}
+	marker := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		p, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, &Error{http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect"}
+		}
+		marker = string(p)
+	}
+	l := list(objects, q.Get("prefix"), q.Get("delimiter"), marker, max)
+	result := listBucketV2Result{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            q.Get("prefix"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		KeyCount:          len(l.contents) + len(l.prefixes),
+		MaxKeys:           max,
+		Delimiter:         q.Get("delimiter"),
+		IsTruncated:       l.truncated,
+		Contents:          l.contents,
+		CommonPrefixes:    l.prefixes,
+	}
+	if l.truncated {
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(l.last))
+	}
+	return result, nil
+}
+
+func (s *Server) deleteObjects(objects map[string]*object, body []byte) (interface{}, error) {
+	var req deleteRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, &Error{http.StatusBadRequest, "MalformedXML", err.Error()}
+	}
+	if len(req.Objects) > maxKeys {
+		return nil, &Error{http.StatusBadRequest, "MalformedXML", "The request may not delete more than 1000 objects"}
+	}
+	result := deleteResult{Xmlns: s3Namespace}
+	for _, o := range req.Objects {
+		delete(objects, o.Key)
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, struct{ Key string }{o.Key})
+		}
+	}
+	return result, nil
+}
+
+// byteRange parses the Range header of a request for size bytes, returning
+// the offsets of the first and last bytes requested.
+func byteRange(header string, size int64) (int64, int64, bool, error) {
+	if header == "" {
+		return 0, size - 1, false, nil
+	}
+	invalid := &Error{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+	spec := strings.TrimPrefix(header, "bytes=")
+	dash := strings.Index(spec, "-")
+	if spec == header || dash < 0 {
+		return 0, 0, false, invalid
+	}
+
+	var first, last int64
+	var err error
+	switch {
+	case dash == 0:
+		// the last n bytes
+		n, err := strconv.ParseInt(spec[1:], 10, 64)
+		if err != nil || n == 0 {
+			return 0, 0, false, invalid
+		}
+		if n > size {
+			n = size
+		}
+		first, last = size-n, size-1
+	default:
+		if first, err = strconv.ParseInt(spec[:dash], 10, 64); err != nil {
+			return 0, 0, false, invalid
+		}
+		last = size - 1
+		if spec[dash+1:] != "" {
+			if last, err = strconv.ParseInt(spec[dash+1:], 10, 64); err != nil || last < first {
+				return 0, 0, false, invalid
+			}
+			if last >= size {
+				last = size - 1
+			}
+		}
+	}
+	if first >= size {
+		return 0, 0, false, invalid
+	}
+	return first, last, true, nil
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, objects map[string]*object, key string) ([]byte, error) {
+	o, ok := objects[key]
+	if !ok {
+		return nil, &Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	}
+	size := int64(len(o.data))
+	first, last := int64(0), size-1
+	partial := false
+	if r.Method == "GET" {
+		var err error
+		if first, last, partial, err = byteRange(r.Header.Get("Range"), size); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(last-first+1, 10))
+	w.Header().Set("ETag", o.etag)
+	w.Header().Set("Last-Modified", o.modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if o.storageClass != "STANDARD" {
+		w.Header().Set("x-amz-storage-class", o.storageClass)
+	}
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	if r.Method == "HEAD" {
+		return nil, nil
+	}
+	// objects are never modified in place, their data may be written unlocked
+	return o.data[first : last+1], nil
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, objects map[string]*object, key string, body []byte) error {
+	if sum := r.Header.Get("Content-MD5"); sum != "" {
+		if err := checkMD5(sum, body); err != nil {
+			return err
+		}
+	}
+	o := &object{
+		data:         body,
+		etag:         etag(body),
+		modTime:      time.Now(),
+		storageClass: storageClass(r),
+	}
+	objects[key] = o
+	w.Header().Set("ETag", o.etag)
+	return nil
+}
+
+func checkMD5(expected string, body []byte) error {
+	sum := md5.Sum(body)
+	if expected != base64.StdEncoding.EncodeToString(sum[:]) {
+		return &Error{http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received."}
+	}
+	return nil
+}
+
+// copySource returns the object named by the x-amz-copy-source header.
+func (s *Server) copySource(r *http.Request) (*object, error) {
+	source, err := url.PathUnescape(r.Header.Get("x-amz-copy-source"))
+	if err != nil {
+		return nil, &Error{http.StatusBadRequest, "InvalidArgument", "Invalid copy source encoding"}
+	}
+	source = strings.TrimPrefix(source, "/")
+	if i := strings.Index(source, "?"); i >= 0 {
+		source = source[:i]
+	}
+	i := strings.Index(source, "/")
+	if i < 0 {
+		return nil, &Error{http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey"}
+	}
+	objects, ok := s.buckets[source[:i]]
+	if !ok {
+		return nil, &Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	}
+	o, ok := objects[source[i+1:]]
+	if !ok {
+		return nil, &Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	}
+	return o, nil
+}
+
+func (s *Server) copyObject(r *http.Request, objects map[string]*object, key string) (interface{}, error) {
+	source, err := s.copySource(r)
+	if err != nil {
+		return nil, err
+	}
+	class := storageClass(r)
+	if source == objects[key] && class == source.storageClass {
+		return nil, &Error{http.StatusBadRequest, "InvalidRequest", "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes."}
+	}
+	o := &object{
+		data:         source.data,
+		etag:         source.etag,
+		modTime:      time.Now(),
+		storageClass: class,
+	}
+	objects[key] = o
+	return copyObjectResult{
+		Xmlns:        s3Namespace,
+		LastModified: o.modTime.UTC().Format(timeFormat),
+		ETag:         o.etag,
+	}, nil
+}
+
+func (s *Server) createMultipartUpload(r *http.Request, bucket, key string) interface{} {
+	s.lastID++
+	u := &upload{
+		bucket:       bucket,
+		key:          key,
+		id:           fmt.Sprintf("%016d", s.lastID),
+		initiated:    time.Now(),
+		storageClass: storageClass(r),
+		parts:        make(map[int]*part),
+	}
+	s.uploads[u.id] = u
+	return initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: u.id,
+	}
+}
+
+func (s *Server) getUpload(q url.Values, bucket, key string) (*upload, error) {
+	u, ok := s.uploads[q.Get("uploadId")]
+	if !ok || u.bucket != bucket || u.key != key {
+		return nil, &Error{http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist. The upload ID may be invalid, or the upload may have been aborted or completed."}
+	}
+	return u, nil
+}
+
+func partNumber(q url.Values) (int, error) {
+	n, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || n < 1 || n > 10000 {
+		return 0, &Error{http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive"}
+	}
+	return n, nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, q url.Values, bucket, key string, body []byte) error {
+	u, err := s.getUpload(q, bucket, key)
+	if err != nil {
+		return err
+	}
+	n, err := partNumber(q)
+	if err != nil {
+		return err
+	}
+	p := &part{data: body, etag: etag(body), modTime: time.Now()}
+	u.parts[n] = p
+	w.Header().Set("ETag", p.etag)
+	return nil
+}
+
+func (s *Server) uploadPartCopy(r *http.Request, q url.Values, bucket, key string) (interface{}, error) {
+	u, err := s.getUpload(q, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	n, err := partNumber(q)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.copySource(r)
+	if err != nil {
+		return nil, err
+	}
+	data := source.data
+	if header := r.Header.Get("x-amz-copy-source-range"); header != "" {
+		first, last, _, err := byteRange(header, int64(len(data)))
+		if err != nil {
+			return nil, &Error{http.StatusBadRequest, "InvalidArgument", "The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy"}
+		}
+		data = data[first : last+1]
+	}
+	p := &part{data: data, etag: etag(data), modTime: time.Now()}
+	u.parts[n] = p
+	return copyPartResult{
+		Xmlns:        s3Namespace,
+		LastModified: p.modTime.UTC().Format(timeFormat),
+		ETag:         p.etag,
+	}, nil
+}
+
+func (s *Server) listParts(q url.Values, bucket, key string) (interface{}, error) {
+	u, err := s.getUpload(q, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxParam(q, "max-parts")
+	if err != nil {
+		return nil, err
+	}
+	marker, _ := strconv.Atoi(q.Get("part-number-marker"))
+
+	numbers := make([]int, 0, len(u.parts))
+	for n := range u.parts {
+		if n > marker {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	result := listPartsResult{
+		Xmlns:            s3Namespace,
+		Bucket:           bucket,
+		Key:              key,
+		UploadID:         u.id,
+		PartNumberMarker: marker,
+		MaxParts:         max,
+	}
+	for _, n := range numbers {
+		if len(result.Parts) == max {
+			result.IsTruncated = true
+			break
+		}
+		p := u.parts[n]
+		result.Parts = append(result.Parts, partResult{
+			PartNumber:   n,
+			LastModified: p.modTime.UTC().Format(timeFormat),
+			ETag:         p.etag,
+			Size:         int64(len(p.data)),
+		})
+		result.NextPartNumberMarker = n
+	}
+	return result, nil
+}
+
+func (s *Server) completeMultipartUpload(q url.Values, bucket, key string, body []byte) (interface{}, error) {
+	u, err := s.getUpload(q, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	var req completeMultipartUpload
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		return nil, &Error{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema."}
+	}
+
+	var data bytes.Buffer
+	sums := md5.New()
+	for i, completed := range req.Parts {
+		if i > 0 && completed.PartNumber <= req.Parts[i-1].PartNumber {
+			return nil, &Error{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order. The parts list must be specified in order by part number."}
+		}
+		p, ok := u.parts[completed.PartNumber]
+		if !ok || p.etag != completed.ETag {
+			return nil, &Error{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found. The part might not have been uploaded, or the specified entity tag might not have matched the part's entity tag."}
+		}
+		if i < len(req.Parts)-1 && len(p.data) < minPartSize {
+			return nil, &Error{http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size."}
+		}
+		data.Write(p.data)
+		sum, _ := hex.DecodeString(strings.Trim(p.etag, `"`))
+		sums.Write(sum)
+	}
+
+	o := &object{
+		data:         data.Bytes(),
+		etag:         fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), len(req.Parts)),
+		modTime:      time.Now(),
+		storageClass: u.storageClass,
+	}
+	s.buckets[bucket][key] = o
+	delete(s.uploads, u.id)
+	return completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: s.URL + "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     o.etag,
+	}, nil
+}
+
+func (s *Server) listMultipartUploads(bucket string, q url.Values) (interface{}, error) {
+	max, err := maxParam(q, "max-uploads")
+	if err != nil {
+		return nil, err
+	}
+	prefix, keyMarker, idMarker := q.Get("prefix"), q.Get("key-marker"), q.Get("upload-id-marker")
+
+	var uploads []*upload
+	for _, u := range s.uploads {
+		if u.bucket != bucket || !strings.HasPrefix(u.key, prefix) {
+			continue
+		}
+		if u.key < keyMarker || (u.key == keyMarker && (idMarker == "" || u.id <= idMarker)) {
+			continue
+		}
+		uploads = append(uploads, u)
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].key != uploads[j].key {
+			return uploads[i].key < uploads[j].key
+		}
+		return uploads[i].id < uploads[j].id
+	})
+
+	result := listMultipartUploadsResult{
+		Xmlns:          s3Namespace,
+		Bucket:         bucket,
+		KeyMarker:      keyMarker,
+		UploadIDMarker: idMarker,
+		Prefix:         prefix,
+		MaxUploads:     max,
+	}
+	for _, u := range uploads {
+		if len(result.Uploads) == max {
+			result.IsTruncated = true
+			break
+		}
+		result.Uploads = append(result.Uploads, uploadResult{
+			Key:          u.key,
+			UploadID:     u.id,
+			Initiated:    u.initiated.UTC().Format(timeFormat),
+			StorageClass: u.storageClass,
+		})
+		result.NextKeyMarker, result.NextUploadIDMarker = u.key, u.id
+	}
+	return result, nil
+}
+
+// subresources are the query parameters signed with signature version 2.
+var subresources = map[string]bool{
+	"acl": true, "delete": true, "lifecycle": true, "location": true,
+	"logging": true, "notification": true, "partNumber": true, "policy": true,
+	"requestPayment": true, "torrent": true, "uploadId": true, "uploads": true,
+	"versionId": true, "versioning": true, "versions": true, "website": true,
+	"response-cache-control": true, "response-content-disposition": true,
+	"response-content-encoding": true, "response-content-language": true,
+	"response-content-type": true, "response-expires": true,
+}
+
+// authenticate checks the credentials a request is signed with.
+func (s *Server) authenticate(r *http.Request) *Error {
+	if s.accessKey == "" {
+		return nil
+	}
+	denied := &Error{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	q := r.URL.Query()
+
+	var accessKey, signature, date string
+	auth := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(auth, "AWS "):
+		i := strings.LastIndex(auth, ":")
+		if i < 0 {
+			return denied
+		}
+		accessKey, signature = auth[len("AWS "):i], auth[i+1:]
+		if r.Header.Get("x-amz-date") == "" {
+			date = r.Header.Get("Date")
+		}
+	case q.Get("Signature") != "":
+		accessKey, signature, date = q.Get("AWSAccessKeyId"), q.Get("Signature"), q.Get("Expires")
+		if expires, err := strconv.ParseInt(date, 10, 64); err != nil || time.Now().Unix() > expires {
+			return &Error{http.StatusForbidden, "AccessDenied", "Request has expired"}
+		}
+	case strings.HasPrefix(auth, "AWS4-HMAC-SHA256 "):
+		// signature version 4 is not verified, only the access key
+		i := strings.Index(auth, "Credential=")
+		if i < 0 {
+			return denied
+		}
+		credential := auth[i+len("Credential="):]
+		return s.checkAccessKey(credential[:strings.Index(credential+"/", "/")])
+	case q.Get("X-Amz-Credential") != "":
+		credential := q.Get("X-Amz-Credential")
+		return s.checkAccessKey(credential[:strings.Index(credential+"/", "/")])
+	default:
+		return denied
+	}
+	if err := s.checkAccessKey(accessKey); err != nil {
+		return err
+	}
+
+	stringToSign := stringToSignV2(r, date)
+	hash := hmac.New(sha1.New, []byte(s.secretKey))
+	hash.Write([]byte(stringToSign))
+	if expected := base64.StdEncoding.EncodeToString(hash.Sum(nil)); signature != expected {
+		return &Error{http.StatusForbidden, "SignatureDoesNotMatch", fmt.Sprintf("The request signature we calculated does not match the signature you provided. String to sign: %q", stringToSign)}
+	}
+	return nil
+}
+
+func (s *Server) checkAccessKey(accessKey string) *Error {
+	if accessKey != s.accessKey {
+		return &Error{http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."}
+	}
+	return nil
+}
+
+// stringToSignV2 returns the string a request is signed from with signature
+// version 2, following the REST authentication section of the S3
+// documentation.
+func stringToSignV2(r *http.Request, date string) string {
+	var amzHeaders []string
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, "x-amz-") {
+			continue
+		}
+		folded := make([]string, len(values))
+		for i, v := range values {
+			folded[i] = strings.Join(strings.Fields(v), " ")
+		}
+		amzHeaders = append(amzHeaders, name+":"+strings.Join(folded, ",")+"\n")
+	}
+	// headers are sorted by name, a name being a prefix of another, such as
+	// x-amz-copy-source of x-amz-copy-source-range, coming first
+	sort.Slice(amzHeaders, func(i, j int) bool {
+		return amzHeaders[i][:strings.Index(amzHeaders[i], ":")] < amzHeaders[j][:strings.Index(amzHeaders[j], ":")]
+	})
+
+	var params []string
+	for name, values := range r.URL.Query() {
+		if !subresources[name] {
+			continue
+		}
+		for _, v := range values {
+			if v == "" {
+				params = append(params, name)
+			} else {
+				params = append(params, name+"="+v)
+			}
+		}
+	}
+	sort.Strings(params)
+	resource := r.URL.Path
+	if len(params) > 0 {
+		resource += "?" + strings.Join(params, "&")
+	}
+
+	return r.Method + "\n" +
+		r.Header.Get("Content-MD5") + "\n" +
+		r.Header.Get("Content-Type") + "\n" +
+		date + "\n" +
+		strings.Join(amzHeaders, "") + resource
+}
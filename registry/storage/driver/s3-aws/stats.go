@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// driverStats counts the activity of a driver, reported by Stats.
+type driverStats struct {
+	// retries counts the requests sent again by the SDK. It is accessed
+	// atomically.
+	retries int64
+
+	limiter *adaptiveLimiter
+
+	mu      sync.Mutex
+	writers map[*writer]struct{}
+}
+
+// countRetry is a handler of the Send phase counting the retried requests.
+func (s *driverStats) countRetry(r *request.Request) {
+	if r.RetryCount > 0 {
+		atomic.AddInt64(&s.retries, 1)
+	}
+}
+
+// open counts w as open until it is closed, committed or cancelled.
+func (s *driverStats) open(w *writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writers == nil {
+		s.writers = make(map[*writer]struct{})
+	}
+	s.writers[w] = struct{}{}
+}
+
+func (s *driverStats) close(w *writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.writers, w)
+}
+
+func (w *writer) updateBuffered() {
+	atomic.StoreInt64(&w.buffered, int64(len(w.readyPart)+len(w.pendingPart)))
+}
+
+// Stats implements storagedriver.StatsReporter. On top of the operations of
+// the driver, it reports the open writers and the bytes they buffer, the
+// requests retried by the SDK and, if maxconcurrency is set, the concurrency
+// of the requests to S3.
+func (d *Driver) Stats() map[string]interface{} {
+	stats := d.Base.Stats()
+	s := d.Base.StorageDriver.(*driver).stats
+
+	s.mu.Lock()
+	var buffered int64
+	for w := range s.writers {
+		buffered += atomic.LoadInt64(&w.buffered)
+	}
+	stats["writers"] = map[string]int64{
+		"open":     int64(len(s.writers)),
+		"buffered": buffered,
+	}
+	s.mu.Unlock()
+
+	stats["retries"] = atomic.LoadInt64(&s.retries)
+	if s.limiter != nil {
+		stats["concurrency"] = s.limiter.stats()
+	}
+	return stats
+}
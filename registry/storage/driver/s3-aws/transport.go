@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	// defaultDialTimeout and defaultIdleConnTimeout are the timeouts of
+	// http.DefaultTransport.
+	defaultDialTimeout     = 30 * time.Second
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+// tunesTransport reports whether the parameters change the settings of the
+// HTTP transport from those of http.DefaultTransport. Unset settings keep
+// their default.
+func (params DriverParameters) tunesTransport() bool {
+	return params.MaxIdleConnsPerHost > 0 ||
+		(params.DialTimeout > 0 && params.DialTimeout != defaultDialTimeout) ||
+		params.ResponseHeaderTimeout > 0 ||
+		(params.IdleConnTimeout > 0 && params.IdleConnTimeout != defaultIdleConnTimeout) ||
+		params.DisableKeepAlives
+}
+
+// newHTTPTransport returns a transport with the settings of
+// http.DefaultTransport, tuned by the parameters, and verifying the
+// certificates of the endpoint with tlsConfig, if set.
+func newHTTPTransport(params DriverParameters, tlsConfig *tls.Config) *http.Transport {
+	maxIdleConnsPerHost := int(params.MaxIdleConnsPerHost)
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = http.DefaultMaxIdleConnsPerHost
+	}
+	dialTimeout := params.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	idleConnTimeout := params.IdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = defaultIdleConnTimeout
+	}
+	maxIdleConns := 100
+	if maxIdleConns < maxIdleConnsPerHost {
+		maxIdleConns = maxIdleConnsPerHost
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: params.ResponseHeaderTimeout,
+		DisableKeepAlives:     params.DisableKeepAlives,
+		TLSClientConfig:       tlsConfig,
+	}
+}
+
+// getParameterAsDuration returns the duration of the named parameter, which
+// must not be negative, or defaultt if it is unset.
+func getParameterAsDuration(parameters map[string]interface{}, name string, defaultt time.Duration) (time.Duration, error) {
+	rv := defaultt
+	switch v := parameters[name].(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("the %s parameter must be a duration, %v invalid", name, v)
+		}
+		rv = d
+	case time.Duration:
+		rv = v
+	case nil:
+		// use the default
+	default:
+		return 0, fmt.Errorf("invalid value for %s: %#v", name, v)
+	}
+	if rv < 0 {
+		return 0, fmt.Errorf("the %s parameter must not be negative, %v invalid", name, rv)
+	}
+	return rv, nil
+}
+
+// operationTimeoutKey is the key of the function canceling the deadline of
+// a request in its context.
+type operationTimeoutKey struct{}
+
+// setOperationTimeout returns a handler of the Build phase giving requests,
+// retries included, timeout to complete. GetObject requests are left alone,
+// for their body is streamed to clients once they completed, and presigned
+// requests are never sent by the driver.
+func setOperationTimeout(timeout time.Duration) func(*request.Request) {
+	return func(r *request.Request) {
+		if r.Operation.Name == "GetObject" || r.ExpireTime > 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		r.SetContext(context.WithValue(ctx, operationTimeoutKey{}, cancel))
+	}
+}
+
+// cancelOperationTimeout is a handler of the Complete phase releasing the
+// deadline set by setOperationTimeout.
+func cancelOperationTimeout(r *request.Request) {
+	if cancel, ok := r.Context().Value(operationTimeoutKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
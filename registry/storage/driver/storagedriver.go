@@ -111,6 +111,99 @@ type FileWriter interface {
 	Commit() error
 }
 
+// FileWriterProgress describes how much of the content written to a
+// FileWriter has been durably persisted to the storage backend.
+type FileWriterProgress struct {
+	// PartsCompleted is the number of parts which have been uploaded to the
+	// backend. Drivers which do not write in parts report zero.
+	PartsCompleted int
+
+	// BytesPersisted is the number of bytes stored in the backend.
+	BytesPersisted int64
+
+	// BytesBuffered is the number of bytes accepted by the FileWriter which
+	// are still held in memory awaiting a flush to the backend.
+	BytesBuffered int64
+}
+
+// ProgressReporter is an optional interface which may be implemented by a
+// FileWriter to report upload progress in more detail than Size.
+type ProgressReporter interface {
+	// Progress returns the current progress of the FileWriter.
+	Progress() FileWriterProgress
+}
+
+// StatsReporter is an optional interface which may be implemented by a
+// StorageDriver or a storage middleware to report live statistics about its
+// operations, which the registry serves on its debug server.
+type StatsReporter interface {
+	// Stats returns the statistics of the driver by section, such as
+	// "operations". The sections must be encodable as JSON.
+	Stats() map[string]interface{}
+}
+
+// StorageClasser is an optional interface which may be implemented by a
+// StorageDriver whose backend offers several storage classes, trading access
+// cost against storage cost.
+type StorageClasser interface {
+	// GetStorageClass returns the storage class of the object stored at path.
+	GetStorageClass(ctx context.Context, path string) (string, error)
+
+	// SetStorageClass moves the object stored at path to the given storage
+	// class, preserving its content.
+	SetStorageClass(ctx context.Context, path string, class string) error
+}
+
+// Copier is an optional interface which may be implemented by a StorageDriver
+// whose backend can copy objects without streaming their content through the
+// registry. Storage middlewares implement it by forwarding the copies to the
+// driver they wrap.
+type Copier interface {
+	// Copy copies the object stored at sourcePath to destPath, overwriting
+	// any object at destPath. The original object is left intact.
+	Copy(ctx context.Context, sourcePath string, destPath string) error
+}
+
+// Exporter is an optional interface which may be implemented by a
+// StorageDriver whose backend can copy objects to another bucket without
+// streaming their content through the registry.
+type Exporter interface {
+	// Export copies the object stored at path to the given key of bucket,
+	// overwriting any object there. The key is not relative to the root
+	// directory of the driver.
+	Export(ctx context.Context, path string, bucket string, key string) error
+}
+
+// BatchDeleter is an optional interface which may be implemented by a
+// StorageDriver whose backend can delete many objects in a single request.
+type BatchDeleter interface {
+	// DeleteBatch recursively deletes the objects stored at paths, as Delete
+	// does. Paths which do not exist are ignored.
+	DeleteBatch(ctx context.Context, paths []string) error
+}
+
+// MultipartUpload identifies an incomplete multipart upload, started by a
+// FileWriter and neither committed nor cancelled.
+type MultipartUpload struct {
+	// Path is the path the upload writes to.
+	Path string
+
+	// ID identifies the upload to the backend.
+	ID string
+}
+
+// MultipartAborter is an optional interface which may be implemented by a
+// StorageDriver whose backend keeps the parts of incomplete multipart
+// uploads, invisible to List and Stat, until they are aborted.
+type MultipartAborter interface {
+	// ListMultipartUploads returns the incomplete multipart uploads to paths
+	// below prefix.
+	ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error)
+
+	// AbortMultipartUpload aborts an upload, deleting the parts stored.
+	AbortMultipartUpload(ctx context.Context, upload MultipartUpload) error
+}
+
 // PathRegexp is the regular expression which each file path must match. A
 // file path is absolute, beginning with a slash and containing a positive
 // number of path components separated by slashes, where each component is
@@ -159,6 +252,48 @@ func (err InvalidOffsetError) Error() string {
 	return fmt.Sprintf("%s: invalid offset: %d for path: %s", err.DriverName, err.Offset, err.Path)
 }
 
+// BackendErrorKind classifies the failures of a storage backend which are
+// caused neither by the operation nor by the path it operates on.
+type BackendErrorKind int
+
+const (
+	// BackendThrottled means the backend rejected requests because of their
+	// rate.
+	BackendThrottled BackendErrorKind = iota + 1
+
+	// BackendUnavailable means the backend failed or could not be reached.
+	BackendUnavailable
+
+	// BackendAuthFailed means the backend rejected the credentials of the
+	// driver, or did not grant them access.
+	BackendAuthFailed
+)
+
+func (k BackendErrorKind) String() string {
+	switch k {
+	case BackendThrottled:
+		return "throttled"
+	case BackendUnavailable:
+		return "unavailable"
+	case BackendAuthFailed:
+		return "authentication failed"
+	}
+	return "unknown"
+}
+
+// BackendError is returned when the storage backend fails an operation for a
+// reason of its own, so that callers can tell trouble with the backend from
+// errors of their own.
+type BackendError struct {
+	DriverName string
+	Kind       BackendErrorKind
+	Enclosed   error
+}
+
+func (err BackendError) Error() string {
+	return fmt.Sprintf("%s: storage backend %s: %s", err.DriverName, err.Kind, err.Enclosed)
+}
+
 // Error is a catch-all error type which captures an error string and
 // the driver type on which it occurred.
 type Error struct {
@@ -600,6 +600,82 @@ func (suite *DriverSuite) TestMoveInvalid(c *check.C) {
 	c.Assert(err, check.NotNil) // non-nil error
 }
 
+// TestCopy checks that a copied object exists at both the source and the
+// destination, if the driver supports copying.
+func (suite *DriverSuite) TestCopy(c *check.C) {
+	copier, ok := suite.StorageDriver.(storagedriver.Copier)
+	if !ok {
+		c.Skip("driver does not support copying")
+	}
+
+	contents := randomContents(32)
+	sourcePath := randomPath(32)
+	destPath := randomPath(32)
+
+	defer suite.deletePath(c, firstPart(sourcePath))
+	defer suite.deletePath(c, firstPart(destPath))
+
+	err := suite.StorageDriver.PutContent(suite.ctx, sourcePath, contents)
+	c.Assert(err, check.IsNil)
+
+	err = copier.Copy(suite.ctx, sourcePath, destPath)
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); ok {
+		c.Skip("driver does not support copying")
+	}
+	c.Assert(err, check.IsNil)
+
+	received, err := suite.StorageDriver.GetContent(suite.ctx, destPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, contents)
+
+	received, err = suite.StorageDriver.GetContent(suite.ctx, sourcePath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, contents)
+
+	err = copier.Copy(suite.ctx, randomPath(32), destPath)
+	c.Assert(err, check.NotNil)
+	c.Assert(err, check.FitsTypeOf, storagedriver.PathNotFoundError{})
+}
+
+// TestDeleteBatch checks that a batch delete removes all given objects and
+// directories and ignores missing ones, if the driver supports batch deletes.
+func (suite *DriverSuite) TestDeleteBatch(c *check.C) {
+	deleter, ok := suite.StorageDriver.(storagedriver.BatchDeleter)
+	if !ok {
+		c.Skip("driver does not support batch deletes")
+	}
+
+	dirname := randomPath(32)
+	kept := path.Join(dirname, randomFilename(32))
+	subdir := path.Join(dirname, randomFilename(32))
+	paths := []string{path.Join(dirname, randomFilename(32)), path.Join(dirname, randomFilename(32)), path.Join(subdir, "data")}
+
+	defer suite.deletePath(c, firstPart(dirname))
+
+	for _, p := range append([]string{kept}, paths...) {
+		err := suite.StorageDriver.PutContent(suite.ctx, p, randomContents(32))
+		c.Assert(err, check.IsNil)
+	}
+
+	err := deleter.DeleteBatch(suite.ctx, []string{paths[0], paths[1], subdir, path.Join(dirname, randomFilename(32))})
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); ok {
+		c.Skip("driver does not support batch deletes")
+	}
+	c.Assert(err, check.IsNil)
+
+	for _, p := range paths {
+		_, err = suite.StorageDriver.GetContent(suite.ctx, p)
+		c.Assert(err, check.NotNil)
+		c.Assert(err, check.FitsTypeOf, storagedriver.PathNotFoundError{})
+	}
+
+	_, err = suite.StorageDriver.Stat(suite.ctx, subdir)
+	c.Assert(err, check.FitsTypeOf, storagedriver.PathNotFoundError{})
+
+	_, err = suite.StorageDriver.GetContent(suite.ctx, kept)
+	c.Assert(err, check.IsNil)
+}
+
 // TestDelete checks that the delete operation removes data from the storage
 // driver
 func (suite *DriverSuite) TestDelete(c *check.C) {
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.RepositoryEventLog = &registry{}
+
+const (
+	defaultEventTimelineSize = 1000
+
+	// eventSegmentSize is the number of events of a segment of a timeline.
+	// Recording an event only rewrites the last segment, full segments are
+	// never written again.
+	eventSegmentSize = 64
+
+	// eventLockShards is the number of locks serializing the updates of
+	// timelines, shared by the repositories hashing to the same shard.
+	eventLockShards = 64
+)
+
+// eventLog bounds the timelines of repositories to size events. Timelines are
+// stored in segments of up to eventSegmentSize events, the oldest of which is
+// removed once the newer ones hold size events.
+type eventLog struct {
+	size int
+
+	// locks serialize the updates of the timeline of a repository by this
+	// instance. Instances sharing a storage backend may still lose events
+	// updating the same timeline at once.
+	locks [eventLockShards]sync.Mutex
+}
+
+// lock returns the lock serializing the updates of the timeline of the named
+// repository.
+func (l *eventLog) lock(name string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return &l.locks[h.Sum32()%eventLockShards]
+}
+
+// segmentSize returns the number of events of a segment, which is at most the
+// size of timelines.
+func (l *eventLog) segmentSize() int {
+	if l.size < eventSegmentSize {
+		return l.size
+	}
+	return eventSegmentSize
+}
+
+// EventTimeline returns a functional option for NewRegistry. It causes the
+// events of each repository to be recorded in storage, keeping the last size
+// events.
+func EventTimeline(size int) RegistryOption {
+	return func(registry *registry) error {
+		if size <= 0 {
+			size = defaultEventTimelineSize
+		}
+		registry.events = &eventLog{size: size}
+		return nil
+	}
+}
+
+// RepositoryEvents reads the timeline of the named repository.
+func (reg *registry) RepositoryEvents(ctx context.Context, name reference.Named, events []distribution.RepositoryEvent, before int64) (int, error) {
+	if reg.events == nil {
+		return 0, distribution.ErrUnsupported
+	}
+
+	segments, err := reg.eventSegments(ctx, name.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	// segments and the events within them are stored oldest first. Only the
+	// last size events are part of the timeline, the oldest segment may
+	// still hold older ones.
+	n, kept := 0, 0
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment, err := reg.readEventSegment(ctx, segments[i])
+		if err != nil {
+			return 0, err
+		}
+		for j := len(segment) - 1; j >= 0; j-- {
+			if kept == reg.events.size {
+				return n, io.EOF
+			}
+			kept++
+			if before > 0 && segment[j].ID >= before {
+				continue
+			}
+			if n == len(events) {
+				return n, nil
+			}
+			events[n] = segment[j]
+			n++
+		}
+	}
+	return n, io.EOF
+}
+
+// RecordRepositoryEvent appends an event to the last segment of the timeline
+// of the named repository, or to a new segment if it is full, dropping the
+// oldest segment once the newer ones hold the size of timelines.
+func (reg *registry) RecordRepositoryEvent(ctx context.Context, name reference.Named, event distribution.RepositoryEvent) error {
+	if reg.events == nil {
+		return nil
+	}
+
+	lock := reg.events.lock(name.Name())
+	lock.Lock()
+	defer lock.Unlock()
+
+	segments, err := reg.eventSegments(ctx, name.Name())
+	if err != nil {
+		return err
+	}
+
+	var last []distribution.RepositoryEvent
+	event.ID = 1
+	if len(segments) > 0 {
+		last, err = reg.readEventSegment(ctx, segments[len(segments)-1])
+		if err != nil {
+			return err
+		}
+		if len(last) > 0 {
+			event.ID = last[len(last)-1].ID + 1
+		}
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	segmentSize := reg.events.segmentSize()
+	if len(segments) == 0 || len(last) >= segmentSize {
+		segmentPath, err := pathFor(repositoryEventSegmentPathSpec{name: name.Name(), first: event.ID})
+		if err != nil {
+			return err
+		}
+		segments = append(segments, segmentPath)
+		last = nil
+	}
+	last = append(last, event)
+
+	content, err := json.Marshal(last)
+	if err != nil {
+		return err
+	}
+	if err := reg.blobStore.driver.PutContent(ctx, segments[len(segments)-1], content); err != nil {
+		return err
+	}
+
+	// all segments but the last are full
+	for len(segments) > 1 && (len(segments)-2)*segmentSize+len(last) >= reg.events.size {
+		if err := reg.blobStore.driver.Delete(ctx, segments[0]); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+// eventSegments returns the paths of the segments of the timeline of the
+// named repository, oldest first.
+func (reg *registry) eventSegments(ctx context.Context, name string) ([]string, error) {
+	eventsPath, err := pathFor(repositoryEventsPathSpec{name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := reg.blobStore.driver.List(ctx, eventsPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	segments := children[:0]
+	for _, child := range children {
+		if _, err := strconv.ParseInt(path.Base(child), 10, 64); err == nil {
+			segments = append(segments, child)
+		}
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+func (reg *registry) readEventSegment(ctx context.Context, segmentPath string) ([]distribution.RepositoryEvent, error) {
+	content, err := reg.blobStore.driver.GetContent(ctx, segmentPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var segment []distribution.RepositoryEvent
+	if err := json.Unmarshal(content, &segment); err != nil {
+		return nil, err
+	}
+	return segment, nil
+}
+
+// recordEvent records an event of the repository caused by the user of ctx.
+// Failing to record an event does not fail the operation that caused it.
+func (repo *repository) recordEvent(ctx context.Context, action string, dgst digest.Digest, tag string, previous digest.Digest) {
+	if repo.registry.events == nil {
+		return
+	}
+
+	err := repo.registry.RecordRepositoryEvent(ctx, repo.name, distribution.RepositoryEvent{
+		Action:   action,
+		Digest:   dgst,
+		Tag:      tag,
+		Previous: previous,
+		Actor:    dcontext.GetStringValue(ctx, "auth.user.name"),
+	})
+	if err != nil {
+		dcontext.GetLogger(ctx).Warnf("error recording %s event of %s: %v", action, repo.name.Name(), err)
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"context"
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestRepositoryEvents(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "auth.user.name", "alice")
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver, EventTimeline(6))
+	eventLog := registry.(distribution.RepositoryEventLog)
+	repo := makeRepository(t, registry, "foo/events")
+	tags := repo.Tags(ctx)
+	manifests, _ := repo.Manifests(ctx)
+
+	image1 := uploadRandomSchema2Image(t, repo)
+	image2 := uploadRandomSchema2Image(t, repo)
+	image3 := uploadRandomSchema2Image(t, repo)
+	for _, dgst := range []digest.Digest{image1.manifestDigest, image2.manifestDigest, image2.manifestDigest} {
+		if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatalf("unexpected error tagging: %v", err)
+		}
+	}
+	if err := tags.Untag(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+	if err := manifests.Delete(ctx, image3.manifestDigest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{RemoveUntagged: true})
+	if err != nil {
+		t.Fatalf("failed mark and sweep: %v", err)
+	}
+
+	// The timeline keeps the last 6 of 9 events, dropping the pushes: the tag
+	// moves, the untag, the delete and the removal of the untagged images.
+	// Retagging a manifest with the same tag is not an event.
+	expected := []distribution.RepositoryEvent{
+		{Action: distribution.RepositoryEventGC},
+		{Action: distribution.RepositoryEventGC},
+		{Action: distribution.RepositoryEventDelete, Digest: image3.manifestDigest, Actor: "alice"},
+		{Action: distribution.RepositoryEventUntag, Tag: "latest", Previous: image2.manifestDigest, Actor: "alice"},
+		{Action: distribution.RepositoryEventTag, Digest: image2.manifestDigest, Tag: "latest", Previous: image1.manifestDigest, Actor: "alice"},
+		{Action: distribution.RepositoryEventTag, Digest: image1.manifestDigest, Tag: "latest", Actor: "alice"},
+	}
+
+	name, _ := reference.WithName("foo/events")
+	events := make([]distribution.RepositoryEvent, 4)
+	n, err := eventLog.RepositoryEvents(ctx, name, events, 0)
+	if err != nil || n != 4 {
+		t.Fatalf("expected a full page of events, got %d: %v", n, err)
+	}
+	page := append([]distribution.RepositoryEvent{}, events[:n]...)
+	n, err = eventLog.RepositoryEvents(ctx, name, events, page[3].ID)
+	if err != io.EOF || n != 2 {
+		t.Fatalf("expected the last 2 events, got %d: %v", n, err)
+	}
+	page = append(page, events[:n]...)
+
+	for i, event := range page {
+		if event.Action != expected[i].Action || event.Tag != expected[i].Tag || event.Previous != expected[i].Previous || event.Actor != expected[i].Actor ||
+			(expected[i].Digest != "" && event.Digest != expected[i].Digest) {
+			t.Fatalf("event %d: expected %+v, got %+v", i, expected[i], event)
+		}
+		if event.Time.IsZero() || (i > 0 && event.ID != page[i-1].ID-1) {
+			t.Fatalf("event %d: unexpected id or time: %+v", i, event)
+		}
+	}
+	if page[0].ID != 9 {
+		t.Fatalf("expected 9 events to be recorded, got %d", page[0].ID)
+	}
+}
+
+func TestRepositoryEventsDisabled(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "foo/events")
+	uploadRandomSchema2Image(t, repo)
+
+	events := make([]distribution.RepositoryEvent, 10)
+	_, err := registry.(distribution.RepositoryEventLog).RepositoryEvents(ctx, repo.Named(), events, 0)
+	if err != distribution.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestRepositoryEventSegments(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver, EventTimeline(100))
+	eventLog := registry.(distribution.RepositoryEventLog)
+
+	name, _ := reference.WithName("foo/segments")
+	for i := 0; i < 250; i++ {
+		if err := eventLog.RecordRepositoryEvent(ctx, name, distribution.RepositoryEvent{Action: distribution.RepositoryEventPush}); err != nil {
+			t.Fatalf("unexpected error recording event: %v", err)
+		}
+	}
+
+	// the timeline keeps the last 100 events, in segments of 64 events of
+	// which the oldest is only partly part of the timeline
+	eventsPath, err := pathFor(repositoryEventsPathSpec{name: name.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, err := inmemoryDriver.List(ctx, eventsPath)
+	if err != nil {
+		t.Fatalf("unexpected error listing segments: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 segments, got %v", segments)
+	}
+
+	events := make([]distribution.RepositoryEvent, 150)
+	n, err := eventLog.RepositoryEvents(ctx, name, events, 0)
+	if err != io.EOF || n != 100 {
+		t.Fatalf("expected the last 100 events, got %d: %v", n, err)
+	}
+	for i, event := range events[:n] {
+		if event.ID != int64(250-i) {
+			t.Fatalf("event %d: unexpected id %d", i, event.ID)
+		}
+	}
+}
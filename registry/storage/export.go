@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// ExportResult counts the objects copied by ExportRepository.
+type ExportResult struct {
+	// Files is the number of links, signatures and other metadata of the
+	// repository copied.
+	Files int
+	// Blobs is the number of blobs copied.
+	Blobs int
+}
+
+// ExportRepository copies the repository name and the blobs it links to the
+// prefix of another bucket, with server-side copies of the storage driver,
+// which must be a driver.Exporter. Objects keep their path below the prefix,
+// so that a registry rooted at the prefix of the bucket serves the copy.
+// Uploads in progress and the repositories nested in name are not copied.
+func ExportRepository(ctx context.Context, storageDriver driver.StorageDriver, name string, bucket string, prefix string) (ExportResult, error) {
+	var result ExportResult
+
+	exporter, ok := storageDriver.(driver.Exporter)
+	if !ok {
+		return result, driver.ErrUnsupportedMethod{DriverName: storageDriver.Name()}
+	}
+	export := func(p string) error {
+		return exporter.Export(ctx, p, bucket, path.Join("/", prefix, p))
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return result, err
+	}
+	repoPath := path.Join(root, name)
+
+	blobs := make(map[digest.Digest]struct{})
+	err = storageDriver.Walk(ctx, repoPath, func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+		if fileInfo.IsDir() {
+			// the directories of a repository start with an underscore,
+			// others hold nested repositories
+			if dir := path.Base(filePath); path.Dir(filePath) == repoPath && !strings.HasPrefix(dir, "_") || dir == "_uploads" {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+
+		if path.Base(filePath) == "link" {
+			content, err := storageDriver.GetContent(ctx, filePath)
+			if err != nil {
+				return err
+			}
+			if dgst, err := digest.Parse(string(content)); err == nil {
+				blobs[dgst] = struct{}{}
+			}
+		}
+		if err := export(filePath); err != nil {
+			return err
+		}
+		result.Files++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for dgst := range blobs {
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			return result, err
+		}
+		// links may outlive the blobs removed by a garbage collection
+		if err := export(blobPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return result, err
+		}
+		result.Blobs++
+	}
+
+	// the layout tells the registry serving the copy where to find links
+	if err := export(layoutPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return result, err
+		}
+	}
+	return result, nil
+}
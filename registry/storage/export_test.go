@@ -0,0 +1,98 @@
+package storage
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// exportDriver exports objects to in-memory buckets.
+type exportDriver struct {
+	driver.StorageDriver
+	buckets map[string]driver.StorageDriver
+}
+
+func (d *exportDriver) Export(ctx gocontext.Context, path string, bucket string, key string) error {
+	content, err := d.GetContent(ctx, path)
+	if err != nil {
+		return err
+	}
+	return d.buckets[bucket].PutContent(ctx, key, content)
+}
+
+func TestExportRepository(t *testing.T) {
+	ctx := context.Background()
+	backup := inmemory.New()
+	d := &exportDriver{StorageDriver: inmemory.New(), buckets: map[string]driver.StorageDriver{"backup": backup}}
+	registry := createRegistry(t, d)
+
+	repo := makeRepository(t, registry, "foo/bar")
+	image := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	upload, err := repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	defer upload.Cancel(ctx)
+	uploadRandomSchema2Image(t, makeRepository(t, registry, "foo/bar/baz"))
+
+	if _, err := ExportRepository(ctx, d, "foo/missing", "backup", "/snapshot"); err == nil {
+		t.Fatal("expected a missing repository not to be exported")
+	}
+	result, err := ExportRepository(ctx, d, "foo/bar", "backup", "/snapshot")
+	if err != nil {
+		t.Fatalf("unexpected error exporting: %v", err)
+	}
+	// the layers, the config and the manifest
+	if result.Blobs != len(image.layers)+2 || result.Files == 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// the copy is served by a registry rooted at the prefix
+	root := inmemory.New()
+	if err := backup.Walk(ctx, "/snapshot", func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		content, err := backup.GetContent(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+		return root.PutContent(ctx, fileInfo.Path()[len("/snapshot"):], content)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	copied := makeRepository(t, createRegistry(t, root), "foo/bar")
+	if _, err := copied.Tags(ctx).Get(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error getting the exported tag: %v", err)
+	}
+	if _, err := makeManifestService(t, copied).Get(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting the exported manifest: %v", err)
+	}
+	for dgst := range image.layers {
+		r, err := copied.Blobs(ctx).Open(ctx, dgst)
+		if err != nil {
+			t.Fatalf("unexpected error opening exported layer: %v", err)
+		}
+		ioutil.ReadAll(r)
+		r.Close()
+	}
+
+	// neither uploads nor nested repositories are exported
+	if err := root.Walk(ctx, "/", func(fileInfo driver.FileInfo) error {
+		if strings.Contains(fileInfo.Path(), "/_uploads") || strings.Contains(fileInfo.Path(), "/foo/bar/baz") {
+			t.Errorf("unexpected exported path %s", fileInfo.Path())
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var _ distribution.ForeignBlobIndex = &registry{}
+
+// foreignLayerMediaTypes are the media types of the layers clients download
+// from their URLs rather than from the registry.
+var foreignLayerMediaTypes = map[string]struct{}{
+	schema2.MediaTypeForeignLayer:              {},
+	v1.MediaTypeImageLayerNonDistributable:     {},
+	v1.MediaTypeImageLayerNonDistributableGzip: {},
+}
+
+// ForeignBlob returns the descriptor of a layer of the named repository
+// stored outside of the registry, as recorded when a manifest referencing it
+// was pushed. The records of manifests which no longer exist are dropped as
+// they are found.
+func (reg *registry) ForeignBlob(ctx context.Context, name reference.Named, dgst digest.Digest) (distribution.Descriptor, error) {
+	layerPath, err := pathFor(foreignLayerPathSpec{name: name.Name(), digest: dgst})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	var records []string
+	err = reg.driver.Walk(ctx, layerPath, func(fileInfo driver.FileInfo) error {
+		if !fileInfo.IsDir() && path.Base(fileInfo.Path()) == "data" {
+			records = append(records, fileInfo.Path())
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return distribution.Descriptor{}, distribution.ErrBlobUnknown
+		}
+		return distribution.Descriptor{}, err
+	}
+
+	for _, record := range records {
+		manifest, ok := parseForeignRecord(strings.TrimPrefix(record, layerPath+"/"))
+		if !ok {
+			continue
+		}
+		revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: name.Name(), revision: manifest})
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		if _, err := reg.driver.Stat(ctx, revisionPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return distribution.Descriptor{}, err
+			}
+			if err := reg.driver.Delete(ctx, path.Dir(record)); err != nil {
+				dcontext.GetLogger(ctx).Warnf("error removing stale foreign layer %s of %s@%s: %v", dgst, name.Name(), manifest, err)
+			}
+			continue
+		}
+
+		content, err := reg.driver.GetContent(ctx, record)
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		var desc distribution.Descriptor
+		if err := json.Unmarshal(content, &desc); err != nil {
+			return distribution.Descriptor{}, err
+		}
+		return desc, nil
+	}
+	return distribution.Descriptor{}, distribution.ErrBlobUnknown
+}
+
+// parseForeignRecord returns the digest of the manifest of a record, from
+// its path relative to the records of the layer.
+func parseForeignRecord(p string) (digest.Digest, bool) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 3 || parts[2] != "data" {
+		return "", false
+	}
+	dgst := digest.NewDigestFromHex(parts[0], parts[1])
+	return dgst, dgst.Validate() == nil
+}
+
+// foreignLayers returns the layers of the manifest which clients download
+// from their URLs: foreign and non-distributable layers whose URLs are all
+// accepted by the URL validation of manifests, and which were not pushed to
+// the repository.
+func (repo *repository) foreignLayers(ctx context.Context, manifest distribution.Manifest) []distribution.Descriptor {
+	blobs := repo.Blobs(ctx)
+	var layers []distribution.Descriptor
+	for _, descriptor := range manifest.References() {
+		if _, ok := foreignLayerMediaTypes[descriptor.MediaType]; !ok || len(descriptor.URLs) == 0 {
+			continue
+		}
+		valid := true
+		for _, u := range descriptor.URLs {
+			valid = valid && repo.manifestURLs.valid(u)
+		}
+		if !valid {
+			continue
+		}
+		if _, err := blobs.Stat(ctx, descriptor.Digest); err != distribution.ErrBlobUnknown {
+			// pushed along with the URLs, or unknown
+			continue
+		}
+		layers = append(layers, descriptor)
+	}
+	return layers
+}
+
+// recordForeignLayers records, for the manifest dgst, the descriptors of its
+// layers which clients download from their URLs. Only the descriptors are
+// stored, the data is never fetched. Failing to record one does not fail the
+// push, as clients honoring the URLs do not ask the registry for the layer.
+func (repo *repository) recordForeignLayers(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) {
+	for _, descriptor := range repo.foreignLayers(ctx, manifest) {
+		foreignPath, err := pathFor(foreignLayerPathSpec{name: repo.name.Name(), digest: descriptor.Digest, manifest: dgst})
+		if err != nil {
+			continue
+		}
+		content, err := json.Marshal(distribution.Descriptor{
+			MediaType: descriptor.MediaType,
+			Size:      descriptor.Size,
+			Digest:    descriptor.Digest,
+			URLs:      descriptor.URLs,
+		})
+		if err == nil {
+			err = repo.driver.PutContent(ctx, foreignPath, content)
+		}
+		if err != nil {
+			dcontext.GetLogger(ctx).Warnf("error recording foreign layer %s of %s: %v", descriptor.Digest, repo.name.Name(), err)
+		}
+	}
+}
+
+// removeForeignLayers removes the records of the foreign layers of the
+// manifest dgst. Those left behind are dropped when found by ForeignBlob.
+func (repo *repository) removeForeignLayers(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) {
+	for _, descriptor := range manifest.References() {
+		if _, ok := foreignLayerMediaTypes[descriptor.MediaType]; !ok || len(descriptor.URLs) == 0 {
+			continue
+		}
+		foreignPath, err := pathFor(foreignLayerPathSpec{name: repo.name.Name(), digest: descriptor.Digest, manifest: dgst})
+		if err == nil {
+			err = repo.driver.Delete(ctx, path.Dir(foreignPath))
+		}
+		if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+			dcontext.GetLogger(ctx).Warnf("error removing foreign layer %s of %s@%s: %v", descriptor.Digest, repo.name.Name(), dgst, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestForeignLayers(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry := createRegistry(t, d)
+	repository := makeRepository(t, registry, "foo/bar")
+	manifests := makeManifestService(t, repository)
+	foreign := registry.(distribution.ForeignBlobIndex)
+
+	config, err := repository.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MediaType = v1.MediaTypeImageConfig
+	layer := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageLayerNonDistributableGzip,
+		Digest:    digest.FromString("foreign layer"),
+		Size:      1234,
+		URLs:      []string{"https://example.com/layer"},
+	}
+	// descriptors of other types are not checked against the URL
+	// validation, and are never redirected to
+	other := distribution.Descriptor{
+		MediaType: "application/vnd.example",
+		Digest:    digest.FromString("other"),
+		Size:      5678,
+		URLs:      []string{"https://example.org/other"},
+	}
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer, other},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := foreign.ForeignBlob(ctx, repository.Named(), layer.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error looking up foreign layer: %v", err)
+	}
+	if desc.Digest != layer.Digest || len(desc.URLs) != 1 || desc.URLs[0] != layer.URLs[0] {
+		t.Fatalf("unexpected foreign layer: %v", desc)
+	}
+	if _, err := foreign.ForeignBlob(ctx, repository.Named(), other.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected the descriptor of another type not to be recorded, got %v", err)
+	}
+
+	// the records are removed along with the manifest by garbage collection
+	tagged := uploadRandomSchema2Image(t, repository)
+	if err := repository.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkAndSweep(ctx, d, registry, GCOpts{RemoveUntagged: true}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if _, ok := allManifests(t, manifests)[dgst]; ok {
+		t.Fatal("expected the untagged manifest to be removed")
+	}
+	recordPath, err := pathFor(foreignLayerPathSpec{name: repository.Named().Name(), digest: layer.Digest, manifest: dgst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Stat(ctx, recordPath); err == nil {
+		t.Fatal("expected the foreign layer record to be removed")
+	}
+}
+
+func TestForeignLayersDisallowedURL(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry := createRegistry(t, d)
+	repo := makeRepository(t, registry, "foo/bar")
+	manifests := makeManifestService(t, repo)
+
+	config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MediaType = v1.MediaTypeImageConfig
+	layer := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageLayerNonDistributable,
+		Digest:    digest.FromString("foreign layer"),
+		Size:      1234,
+		URLs:      []string{"https://example.com/layer"},
+	}
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// manifests recovered after the URL validation changed are not
+	// recorded with URLs it denies
+	layerPath, err := pathFor(foreignLayerPathSpec{name: repo.Named().Name(), digest: layer.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(ctx, layerPath); err != nil {
+		t.Fatal(err)
+	}
+	denying := createRegistry(t, d, ManifestURLsDenyRegexp(regexp.MustCompile("^https://example\\.com/")))
+	denied := makeRepository(t, denying, "foo/bar")
+	denied.(*repository).recordForeignLayers(ctx, dgst, m)
+	if _, err := denying.(distribution.ForeignBlobIndex).ForeignBlob(ctx, denied.Named(), layer.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected the layer with a denied URL not to be recorded, got %v", err)
+	}
+}
@@ -2,7 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
@@ -18,8 +23,84 @@ func emit(format string, a ...interface{}) {
 type GCOpts struct {
 	DryRun         bool
 	RemoveUntagged bool
+
+	// ProgressInterval is how often progress is reported and, unless
+	// DryRun is set, a checkpoint saved to storage. Zero disables both.
+	ProgressInterval time.Duration
+
+	// UntaggedOlderThan, if RemoveUntagged is not set, restricts the
+	// removal of manifests not referenced by any tag to those pushed at
+	// least this long ago. Zero keeps all untagged manifests.
+	UntaggedOlderThan time.Duration
+
+	// Resume continues the run recorded by the last checkpoint, skipping
+	// the repositories it scanned. The registry must not accept pushes
+	// between the runs.
+	Resume bool
+
+	// MarkConcurrency is the number of repositories marked concurrently.
+	// Values below two mark one repository at a time.
+	MarkConcurrency int
+
+	// SweepConcurrency is the number of batches of blobs deleted
+	// concurrently. Values below two delete one batch at a time.
+	SweepConcurrency int
+
+	// MaxDeletesPerSecond caps the rate at which blobs are deleted. Zero
+	// means no limit.
+	MaxDeletesPerSecond float64
+
+	// NameValidator checks the names of the repositories found in storage.
+	// If nil, the default constraints of reference.WithName apply.
+	NameValidator *reference.NameValidator
+
+	// IntentGrace is how old the intents of interrupted mutations must be
+	// to be recovered before marking. Zero means DefaultIntentGrace.
+	IntentGrace time.Duration
+
+	// Retention lists the namespaces whose untagged manifests are removed
+	// once old enough, whatever RemoveUntagged and UntaggedOlderThan say.
+	// A repository follows the rule of the longest namespace it belongs to.
+	Retention []RetentionRule
+}
+
+// RetentionRule removes the manifests of the repositories of a namespace
+// which are not referenced by any tag once they were pushed UntaggedOlderThan
+// ago. The empty namespace holds every repository.
+type RetentionRule struct {
+	Namespace         string
+	UntaggedOlderThan time.Duration
+}
+
+// untaggedOlderThan returns the age from which the untagged manifests of the
+// repository are removed, zero if they are kept.
+func (opts GCOpts) untaggedOlderThan(repoName string) time.Duration {
+	olderThan := opts.UntaggedOlderThan
+	var rule *RetentionRule
+	for i, r := range opts.Retention {
+		if r.Namespace != "" && repoName != r.Namespace && !strings.HasPrefix(repoName, r.Namespace+"/") {
+			continue
+		}
+		if rule == nil || len(r.Namespace) > len(rule.Namespace) {
+			rule = &opts.Retention[i]
+		}
+	}
+	if rule != nil && rule.UntaggedOlderThan > 0 && (olderThan <= 0 || rule.UntaggedOlderThan < olderThan) {
+		olderThan = rule.UntaggedOlderThan
+	}
+	return olderThan
+}
+
+// gcReferrer is an untagged manifest referring to a subject, marked if its
+// subject is.
+type gcReferrer struct {
+	subject    digest.Digest
+	references []distribution.Descriptor
 }
 
+// gcSweepBatch is the number of blobs deleted between progress reports.
+const gcSweepBatch = 1000
+
 // ManifestDel contains manifest structure which will be deleted
 type ManifestDel struct {
 	Name   string
@@ -34,14 +115,83 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
 	}
 
+	// mutations left halfway are completed or rolled back first, so that
+	// the manifests they pushed are marked
+	intentGrace := opts.IntentGrace
+	if intentGrace <= 0 {
+		intentGrace = DefaultIntentGrace
+	}
+	recovered, err := RecoverIntents(ctx, registry, time.Now().Add(-intentGrace), opts.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to recover intents: %v", err)
+	}
+	if recovered > 0 && opts.DryRun {
+		emit("%d interrupted mutations to recover", recovered)
+	} else if recovered > 0 {
+		emit("%d interrupted mutations recovered", recovered)
+	}
+
+	// with a complete reference index, the blobs referenced by the manifests
+	// kept are found in the index rather than by reading every manifest
+	var indexed bool
+	if referenceIndexEnabled(registry) {
+		indexed, err = referenceIndexIsComplete(ctx, storageDriver)
+		if err != nil {
+			return fmt.Errorf("failed to check the reference index: %v", err)
+		}
+	}
+	if indexed {
+		emit("marking from the reference index")
+	}
+
+	progress := newGCProgress(ctx, storageDriver, opts.ProgressInterval)
+
 	// mark
 	markSet := make(map[digest.Digest]struct{})
 	manifestArr := make([]ManifestDel, 0)
-	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+	scanned := make(map[string]struct{})
+	if opts.Resume {
+		checkpoint, err := progress.loadCheckpoint()
+		if err != nil {
+			return fmt.Errorf("failed to load checkpoint: %v", err)
+		}
+		if checkpoint != nil {
+			emit("resuming from checkpoint saved at %s: %d repositories scanned, %d blobs marked",
+				checkpoint.Saved.Format(time.RFC3339), len(checkpoint.Repositories), len(checkpoint.Marked))
+			for _, name := range checkpoint.Repositories {
+				scanned[name] = struct{}{}
+			}
+			for _, dgst := range checkpoint.Marked {
+				markSet[dgst] = struct{}{}
+			}
+			manifestArr = append(manifestArr, checkpoint.Manifests...)
+		}
+	}
+	// mu protects markSet, manifestArr, scanned and progress while
+	// repositories are marked concurrently
+	var mu sync.Mutex
+	checkpoint := func() {
+		progress.marked = len(markSet)
+		progress.report()
+		if opts.DryRun {
+			return
+		}
+		if err := progress.saveCheckpoint(scanned, markSet, manifestArr); err != nil {
+			emit("failed to save checkpoint: %v", err)
+		}
+	}
+
+	err = forEachRepository(ctx, repositoryEnumerator, opts.MarkConcurrency, func(repoName string) error {
+		mu.Lock()
+		_, ok := scanned[repoName]
+		mu.Unlock()
+		if ok {
+			return nil
+		}
 		emit(repoName)
 
 		var err error
-		named, err := reference.WithName(repoName)
+		named, err := opts.NameValidator.WithName(repoName)
 		if err != nil {
 			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
 		}
@@ -60,14 +210,73 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
 		}
 
+		// manifests referring to a subject, such as signatures, are kept
+		// untagged as long as their subject is, which is only known once
+		// every manifest of the repository has been seen
+		kept := make(map[digest.Digest]struct{})
+		referrers := make(map[digest.Digest]gcReferrer)
+		mark := func(dgst digest.Digest, descriptors []distribution.Descriptor) {
+			emit("%s: marking manifest %s ", repoName, dgst)
+			mu.Lock()
+			markSet[dgst] = struct{}{}
+			for _, descriptor := range descriptors {
+				markSet[descriptor.Digest] = struct{}{}
+			}
+			mu.Unlock()
+			for _, descriptor := range descriptors {
+				emit("%s: marking blob %s", repoName, descriptor.Digest)
+			}
+			kept[dgst] = struct{}{}
+		}
+
+		untaggedOlderThan := opts.untaggedOlderThan(repoName)
+
+		var subjects map[digest.Digest]digest.Digest
+		if indexed {
+			subjects, err = referrerSubjects(ctx, storageDriver, repoName)
+			if err != nil {
+				return fmt.Errorf("failed to list referrers: %v", err)
+			}
+		}
+
 		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
-			if opts.RemoveUntagged {
-				// fetch all tags where this manifest is the latest one
+			subject, isReferrer := subjects[dgst]
+			var references []distribution.Descriptor
+			if !indexed {
+				manifest, err := manifestService.Get(ctx, dgst)
+				if err != nil {
+					return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+				}
+				references = manifest.References()
+				if s := manifestSubject(manifest); s != nil {
+					subject, isReferrer = s.Digest, true
+				}
+			}
+
+			if isReferrer {
 				tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
 				if err != nil {
 					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
 				}
 				if len(tags) == 0 {
+					referrers[dgst] = gcReferrer{subject: subject, references: references}
+					return nil
+				}
+			} else if opts.RemoveUntagged || untaggedOlderThan > 0 {
+				// fetch all tags where this manifest is the latest one
+				tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+				if err != nil {
+					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
+				}
+				eligible := len(tags) == 0
+				if eligible && !opts.RemoveUntagged {
+					pushed, err := manifestPushedAt(ctx, storageDriver, repoName, dgst)
+					if err != nil {
+						return fmt.Errorf("failed to determine age of manifest %v: %v", dgst, err)
+					}
+					eligible = time.Since(pushed) >= untaggedOlderThan
+				}
+				if eligible {
 					emit("manifest eligible for deletion: %s", dgst)
 					// fetch all tags from repository
 					// all of these tags could contain manifest in history
@@ -76,27 +285,46 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 					if err != nil {
 						return fmt.Errorf("failed to retrieve tags %v", err)
 					}
+					mu.Lock()
 					manifestArr = append(manifestArr, ManifestDel{Name: repoName, Digest: dgst, Tags: allTags})
+					mu.Unlock()
 					return nil
 				}
 			}
-			// Mark the manifest's blob
-			emit("%s: marking manifest %s ", repoName, dgst)
-			markSet[dgst] = struct{}{}
-
-			manifest, err := manifestService.Get(ctx, dgst)
-			if err != nil {
-				return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
-			}
-
-			descriptors := manifest.References()
-			for _, descriptor := range descriptors {
-				markSet[descriptor.Digest] = struct{}{}
-				emit("%s: marking blob %s", repoName, descriptor.Digest)
-			}
 
+			mark(dgst, references)
 			return nil
 		})
+		if err == nil {
+			// referrers of kept subjects are kept, until no more are
+			for resolved := true; resolved; {
+				resolved = false
+				for dgst, referrer := range referrers {
+					if _, ok := kept[referrer.subject]; ok {
+						mark(dgst, referrer.references)
+						delete(referrers, dgst)
+						resolved = true
+					}
+				}
+			}
+			// the others refer to manifests which are gone or removed
+			var allTags []string
+			if len(referrers) > 0 {
+				allTags, err = repository.Tags(ctx).All(ctx)
+				if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+					err = nil
+				}
+				if err != nil {
+					return fmt.Errorf("failed to retrieve tags %v", err)
+				}
+			}
+			for dgst := range referrers {
+				emit("manifest eligible for deletion: %s", dgst)
+				mu.Lock()
+				manifestArr = append(manifestArr, ManifestDel{Name: repoName, Digest: dgst, Tags: allTags})
+				mu.Unlock()
+			}
+		}
 
 		// In certain situations such as unfinished uploads, deleting all
 		// tags in S3 or removing the _manifests folder manually, this
@@ -104,24 +332,52 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		//
 		// In these cases we can continue marking other manifests safely.
 		if _, ok := err.(driver.PathNotFoundError); ok {
-			return nil
+			err = nil
+		}
+		if err != nil {
+			return err
 		}
 
-		return err
+		mu.Lock()
+		defer mu.Unlock()
+		scanned[repoName] = struct{}{}
+		progress.repositories = len(scanned)
+		if progress.due() {
+			checkpoint()
+		}
+		return nil
 	})
 
 	if err != nil {
 		return fmt.Errorf("failed to mark: %v", err)
 	}
+	if indexed {
+		if err := markFromReferenceIndex(ctx, storageDriver, markSet); err != nil {
+			return fmt.Errorf("failed to mark from the reference index: %v", err)
+		}
+	}
+
+	if opts.ProgressInterval > 0 {
+		checkpoint()
+	}
 
 	// sweep
+	manifestCount := len(manifestArr)
 	vacuum := NewVacuum(ctx, storageDriver)
+	eventLog, _ := registry.(distribution.RepositoryEventLog)
 	if !opts.DryRun {
 		for _, obj := range manifestArr {
 			err = vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
 			if err != nil {
 				return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
 			}
+			if eventLog != nil {
+				recordGCEvent(ctx, eventLog, opts.NameValidator, obj)
+			}
+		}
+		if opts.ProgressInterval > 0 {
+			manifestArr = manifestArr[:0]
+			checkpoint()
 		}
 	}
 	blobService := registry.Blobs()
@@ -136,17 +392,400 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 	if err != nil {
 		return fmt.Errorf("error enumerating blobs: %v", err)
 	}
-	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), len(manifestArr))
+	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), manifestCount)
+	deleteArr := make([]digest.Digest, 0, len(deleteSet))
 	for dgst := range deleteSet {
 		emit("blob eligible for deletion: %s", dgst)
-		if opts.DryRun {
-			continue
+		deleteArr = append(deleteArr, dgst)
+	}
+	if !opts.DryRun {
+		batchSize := gcSweepBatch
+		if opts.MaxDeletesPerSecond > 0 && int(opts.MaxDeletesPerSecond/10) < batchSize {
+			// keep bursts to about a tenth of a second's worth of deletes
+			batchSize = int(opts.MaxDeletesPerSecond / 10)
+			if batchSize < 1 {
+				batchSize = 1
+			}
+		}
+		var batches [][]digest.Digest
+		for len(deleteArr) > 0 {
+			batch := deleteArr
+			if len(batch) > batchSize {
+				batch = batch[:batchSize]
+			}
+			deleteArr = deleteArr[len(batch):]
+			batches = append(batches, batch)
 		}
-		err = vacuum.RemoveBlob(string(dgst))
+
+		limiter := newDeleteLimiter(opts.MaxDeletesPerSecond)
+		statter := registry.BlobStatter()
+		err := forEachBatch(batches, opts.SweepConcurrency, func(batch []digest.Digest) error {
+			if err := limiter.wait(ctx, len(batch)); err != nil {
+				return err
+			}
+
+			var size int64
+			for _, dgst := range batch {
+				if desc, err := statter.Stat(ctx, dgst); err == nil {
+					size += desc.Size
+				}
+			}
+			if err := vacuum.RemoveBlobs(batch); err != nil {
+				return fmt.Errorf("failed to delete blobs: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			progress.swept += len(batch)
+			progress.sweptBytes += size
+			if progress.due() {
+				progress.report()
+			}
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+			return err
+		}
+	}
+
+	if err := abortOrphanedUploads(ctx, storageDriver, opts.DryRun); err != nil {
+		return fmt.Errorf("failed to abort multipart uploads: %v", err)
+	}
+
+	if opts.ProgressInterval > 0 {
+		progress.report()
+	}
+	if !opts.DryRun {
+		if err := progress.removeCheckpoint(); err != nil {
+			return fmt.Errorf("failed to remove checkpoint: %v", err)
+		}
+	}
+	return nil
+}
+
+// referenceIndexEnabled reports whether the registry maintains the reference
+// index.
+func referenceIndexEnabled(ns distribution.Namespace) bool {
+	reg, ok := ns.(*registry)
+	return ok && reg.referenceIndex
+}
+
+// referrerSubjects returns the subjects of the manifests of the repository
+// referring to one, from the links of its referrers.
+func referrerSubjects(ctx context.Context, storageDriver driver.StorageDriver, repoName string) (map[digest.Digest]digest.Digest, error) {
+	root, err := pathFor(manifestReferrersPathSpec{name: repoName})
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := make(map[digest.Digest]digest.Digest)
+	err = storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+		// <subject algorithm>/<hex>/<referrer algorithm>/<hex>/link
+		parts := strings.Split(strings.TrimPrefix(fileInfo.Path(), root+"/"), "/")
+		if len(parts) != 5 {
+			return nil
+		}
+		subject := digest.NewDigestFromHex(parts[0], parts[1])
+		referrer := digest.NewDigestFromHex(parts[2], parts[3])
+		if subject.Validate() == nil && referrer.Validate() == nil {
+			subjects[referrer] = subject
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		err = nil
+	}
+	return subjects, err
+}
+
+// markFromReferenceIndex marks the blobs referenced by the manifests marked,
+// and by the manifests they reference in turn, as recorded in the reference
+// index.
+func markFromReferenceIndex(ctx context.Context, storageDriver driver.StorageDriver, markSet map[digest.Digest]struct{}) error {
+	root, err := pathFor(referencesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	// the blobs referenced by each manifest
+	references := make(map[digest.Digest][]digest.Digest)
+	err = storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+		// <algorithm>/<first two hex bytes>/<hex>/<name>/_manifests/<algorithm>/<hex>/link
+		parts := strings.SplitN(strings.TrimPrefix(fileInfo.Path(), root+"/"), "/", 4)
+		if len(parts) != 4 {
+			return nil
+		}
+		blob := digest.NewDigestFromHex(parts[0], parts[2])
+		_, manifest, ok := parseReferenceLink(parts[3])
+		if ok && blob.Validate() == nil {
+			references[manifest] = append(references[manifest], blob)
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var queue []digest.Digest
+	for manifest := range references {
+		if _, ok := markSet[manifest]; ok {
+			queue = append(queue, manifest)
+		}
+	}
+	for len(queue) > 0 {
+		manifest := queue[0]
+		queue = queue[1:]
+		for _, blob := range references[manifest] {
+			if _, ok := markSet[blob]; ok {
+				continue
+			}
+			emit("marking blob %s", blob)
+			markSet[blob] = struct{}{}
+			if _, ok := references[blob]; ok {
+				queue = append(queue, blob)
+			}
+		}
+		delete(references, manifest)
+	}
+	return nil
+}
+
+// recordGCEvent records the removal of a manifest in the timeline of its
+// repository. Failing to record it does not fail the collection.
+func recordGCEvent(ctx context.Context, eventLog distribution.RepositoryEventLog, nameValidator *reference.NameValidator, obj ManifestDel) {
+	named, err := nameValidator.WithName(obj.Name)
+	if err == nil {
+		err = eventLog.RecordRepositoryEvent(ctx, named, distribution.RepositoryEvent{
+			Action: distribution.RepositoryEventGC,
+			Digest: obj.Digest,
+		})
+	}
+	if err != nil {
+		emit("failed to record the removal of manifest %s of %s: %v", obj.Digest, obj.Name, err)
+	}
+}
+
+// manifestPushedAt returns when a manifest was last pushed to a repository,
+// going by the modification time of its revision link.
+func manifestPushedAt(ctx context.Context, storageDriver driver.StorageDriver, repoName string, dgst digest.Digest) (time.Time, error) {
+	linkPath, err := pathFor(manifestRevisionLinkPathSpec{name: repoName, revision: dgst})
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err := storageDriver.Stat(ctx, linkPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// abortOrphanedUploads aborts the multipart uploads kept by the storage
+// backend for blob uploads whose upload directory is gone, having been
+// purged or cancelled while the backend held on to the parts uploaded.
+// Drivers which do not implement driver.MultipartAborter are skipped.
+func abortOrphanedUploads(ctx context.Context, storageDriver driver.StorageDriver, dryRun bool) error {
+	aborter, ok := storageDriver.(driver.MultipartAborter)
+	if !ok {
+		return nil
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+	uploads, err := aborter.ListMultipartUploads(ctx, root)
+	if err != nil {
+		if _, ok := err.(driver.ErrUnsupportedMethod); ok {
+			return nil
+		}
+		return err
+	}
+
+	var aborted int
+	for _, upload := range uploads {
+		dir, ok := uploadDirFromPath(upload.Path)
+		if !ok {
+			continue
+		}
+		if _, err := storageDriver.Stat(ctx, dir); err == nil {
+			// upload in progress
+			continue
+		} else if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+
+		emit("multipart upload eligible for abort: %s (%s)", upload.Path, upload.ID)
+		if dryRun {
+			continue
+		}
+		if err := aborter.AbortMultipartUpload(ctx, upload); err != nil {
+			return fmt.Errorf("failed to abort multipart upload %s of %s: %v", upload.ID, upload.Path, err)
 		}
+		aborted++
+	}
+	if !dryRun {
+		emit("%d orphaned multipart uploads aborted", aborted)
+	}
+	return nil
+}
+
+// uploadDirFromPath returns the upload directory, <name>/_uploads/<id>, of a
+// path written by a blob upload. Directories in the sharded layout include
+// their shards.
+func uploadDirFromPath(p string) (string, bool) {
+	const uploads = "/_uploads/"
+	i := strings.Index(p, uploads)
+	if i < 0 {
+		return "", false
+	}
+	parts := strings.Split(p[i+len(uploads):], "/")
+	n := 1
+	if len(parts) > 3 && strings.HasPrefix(parts[2], parts[0]+parts[1]) && len(parts[0]+parts[1]) == 4 {
+		n = 3
+	}
+	if len(parts) <= n || parts[n-1] == "" {
+		return "", false
+	}
+	return p[:i+len(uploads)] + path.Join(parts[:n]...), true
+}
+
+// errGCStopped is returned to an enumeration to stop it after a failure.
+var errGCStopped = errors.New("garbage collection stopped")
+
+// forEachRepository calls f for each repository, from up to concurrency
+// goroutines, and returns the first error.
+func forEachRepository(ctx context.Context, enumerator distribution.RepositoryEnumerator, concurrency int, f func(string) error) error {
+	if concurrency < 2 {
+		return enumerator.Enumerate(ctx, f)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	names := make(chan string)
+	failed := make(chan struct{})
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				if err := f(name); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
 	}
 
+	err := enumerator.Enumerate(ctx, func(name string) error {
+		select {
+		case names <- name:
+			return nil
+		case <-failed:
+			return errGCStopped
+		}
+	})
+	close(names)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
 	return err
 }
+
+// forEachBatch calls f for each batch, from up to concurrency goroutines,
+// and returns the first error.
+func forEachBatch(batches [][]digest.Digest, concurrency int, f func([]digest.Digest) error) error {
+	if concurrency < 2 {
+		concurrency = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	work := make(chan []digest.Digest)
+	failed := make(chan struct{})
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range work {
+				if err := f(batch); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+loop:
+	for _, batch := range batches {
+		select {
+		case work <- batch:
+		case <-failed:
+			break loop
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	return firstErr
+}
+
+// deleteLimiter paces deletes to a maximum rate. A nil deleteLimiter does not
+// limit.
+type deleteLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newDeleteLimiter(perSecond float64) *deleteLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &deleteLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until n deletes may be issued.
+func (l *deleteLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(n) * l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,9 +1,11 @@
 package storage
 
 import (
+	gocontext "context"
 	"io"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
@@ -500,3 +502,272 @@ func TestOrphanBlobDeleted(t *testing.T) {
 		}
 	}
 }
+
+// multipartDriver reports a fixed set of incomplete multipart uploads and
+// records those aborted.
+type multipartDriver struct {
+	driver.StorageDriver
+	uploads []driver.MultipartUpload
+	aborted []string
+}
+
+func (d *multipartDriver) ListMultipartUploads(ctx gocontext.Context, prefix string) ([]driver.MultipartUpload, error) {
+	return d.uploads, nil
+}
+
+func (d *multipartDriver) AbortMultipartUpload(ctx gocontext.Context, upload driver.MultipartUpload) error {
+	d.aborted = append(d.aborted, upload.ID)
+	return nil
+}
+
+func TestOrphanedMultipartUploadsAborted(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "foo/multipart")
+	uploadRandomSchema2Image(t, repo)
+
+	// An upload in progress
+	bw, err := repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create upload: %v", err)
+	}
+	defer bw.Cancel(ctx)
+
+	live, err := pathFor(uploadDataPathSpec{name: "foo/multipart", id: bw.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphaned, err := pathFor(uploadDataPathSpec{name: "foo/multipart", id: "0c2b1d3e-6a3f-4b8e-9d0a-5e8b7f6c4a21"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &multipartDriver{
+		StorageDriver: inmemoryDriver,
+		uploads: []driver.MultipartUpload{
+			{Path: live, ID: "live"},
+			{Path: orphaned, ID: "orphaned"},
+			{Path: "/docker/registry/v2/blobs/sha256/ab/abcd/data", ID: "unrelated"},
+		},
+	}
+
+	if err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(d.aborted) != 0 {
+		t.Fatalf("Dry run aborted uploads: %v", d.aborted)
+	}
+
+	if err := MarkAndSweep(ctx, d, registry, GCOpts{}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(d.aborted) != 1 || d.aborted[0] != "orphaned" {
+		t.Fatalf("Expected only the orphaned upload to be aborted, got %v", d.aborted)
+	}
+}
+
+func TestGCResume(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	imageA := uploadRandomSchema2Image(t, makeRepository(t, registry, "resume/a"))
+	imageB := uploadRandomSchema2Image(t, makeRepository(t, registry, "resume/b"))
+
+	// A checkpoint claiming resume/a was scanned without marking anything
+	progress := newGCProgress(ctx, inmemoryDriver, 0)
+	err := progress.saveCheckpoint(map[string]struct{}{"resume/a": {}}, map[digest.Digest]struct{}{}, nil)
+	if err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	// Without Resume the checkpoint is ignored
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	blobs := allBlobs(t, registry)
+	if _, ok := blobs[imageA.manifestDigest]; !ok {
+		t.Fatalf("Checkpoint used without resume")
+	}
+
+	// With Resume, resume/a is skipped and its content is not marked
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{Resume: true, ProgressInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	blobs = allBlobs(t, registry)
+	if _, ok := blobs[imageA.manifestDigest]; ok {
+		t.Errorf("Expected content of skipped repository to be swept")
+	}
+	if _, ok := blobs[imageB.manifestDigest]; !ok {
+		t.Errorf("Content of scanned repository was swept")
+	}
+	for dgst := range imageB.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Errorf("Layer of scanned repository was swept: %s", dgst)
+		}
+	}
+
+	// A completed run removes its checkpoint
+	if _, err := inmemoryDriver.Stat(ctx, gcCheckpointPath); err == nil {
+		t.Errorf("Checkpoint left after completed run")
+	}
+}
+
+func TestGCConcurrency(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	var images []image
+	for _, name := range []string{"concurrent/a", "concurrent/b", "concurrent/c", "concurrent/d"} {
+		images = append(images, uploadRandomSchema2Image(t, makeRepository(t, registry, name)))
+	}
+
+	orphans, err := testutil.CreateRandomLayers(5)
+	if err != nil {
+		t.Fatalf("Failed to create random layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(makeRepository(t, registry, "concurrent/a"), orphans); err != nil {
+		t.Fatalf("Failed to upload blobs: %v", err)
+	}
+
+	start := time.Now()
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		MarkConcurrency:     3,
+		SweepConcurrency:    2,
+		MaxDeletesPerSecond: 20,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	// the fifth delete may not start before 200ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Deletes not rate limited, sweep took %s", elapsed)
+	}
+
+	blobs := allBlobs(t, registry)
+	for _, im := range images {
+		if _, ok := blobs[im.manifestDigest]; !ok {
+			t.Errorf("Manifest swept: %s", im.manifestDigest)
+		}
+		for dgst := range im.layers {
+			if _, ok := blobs[dgst]; !ok {
+				t.Errorf("Layer swept: %s", dgst)
+			}
+		}
+	}
+	for dgst := range orphans {
+		if _, ok := blobs[dgst]; ok {
+			t.Errorf("Orphan layer present: %s", dgst)
+		}
+	}
+}
+
+func TestDeleteLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := newDeleteLimiter(100)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.wait(ctx, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first 10 deletes are immediate, the next 20 take 200ms
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected deletes to be paced, took %s", elapsed)
+	}
+
+	if err := (*deleteLimiter)(nil).wait(ctx, 1000); err != nil {
+		t.Errorf("Unexpected error from unlimited limiter: %v", err)
+	}
+}
+
+func TestDeleteUntaggedOlderThan(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "deleteold")
+	manifestService := makeManifestService(t, repo)
+
+	old := uploadRandomSchema2Image(t, repo)
+	time.Sleep(50 * time.Millisecond)
+	// manifests pushed before mid are older than time.Since(mid)
+	mid := time.Now()
+	time.Sleep(50 * time.Millisecond)
+	recent := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+
+	// dry run lists without removing
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:            true,
+		UntaggedOlderThan: time.Since(mid),
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if manifests := allManifests(t, manifestService); len(manifests) != 3 {
+		t.Fatalf("Dry run removed manifests: %v", manifests)
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		UntaggedOlderThan: time.Since(mid),
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests := allManifests(t, manifestService)
+	if _, ok := manifests[old.manifestDigest]; ok {
+		t.Errorf("Old untagged manifest was not removed")
+	}
+	if _, ok := manifests[recent.manifestDigest]; !ok {
+		t.Errorf("Recent untagged manifest was removed")
+	}
+	if _, ok := manifests[tagged.manifestDigest]; !ok {
+		t.Errorf("Tagged manifest was removed")
+	}
+}
+
+func TestGCRetention(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver)
+
+	untagged := make(map[string]image)
+	for _, name := range []string{"acme/app", "other"} {
+		repo := makeRepository(t, registry, name)
+		untagged[name] = uploadRandomSchema2Image(t, repo)
+		tagged := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+			t.Fatalf("Failed to tag manifest: %v", err)
+		}
+	}
+
+	// the retention of a namespace applies without asking the collection
+	// to remove untagged manifests
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		Retention: []RetentionRule{
+			{Namespace: "acme", UntaggedOlderThan: time.Nanosecond},
+			{Namespace: "acme/other", UntaggedOlderThan: time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if _, ok := allManifests(t, makeManifestService(t, makeRepository(t, registry, "acme/app")))[untagged["acme/app"].manifestDigest]; ok {
+		t.Error("Untagged manifest of the namespace was not removed")
+	}
+	if _, ok := allManifests(t, makeManifestService(t, makeRepository(t, registry, "other")))[untagged["other"].manifestDigest]; !ok {
+		t.Error("Untagged manifest outside of the namespace was removed")
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// gcCheckpointPath is where the garbage collector records its progress, so
+// that an interrupted run can be resumed.
+var gcCheckpointPath = path.Join(storagePathRoot, storagePathVersion, "gc-checkpoint.json")
+
+// gcCheckpoint is the state of a garbage collection run saved to storage.
+// A resumed run skips the repositories already scanned, starting from the
+// blobs marked and manifests found eligible for deletion so far.
+type gcCheckpoint struct {
+	Repositories []string        `json:"repositories"`
+	Marked       []digest.Digest `json:"marked"`
+	Manifests    []ManifestDel   `json:"manifests"`
+	Saved        time.Time       `json:"saved"`
+}
+
+// gcProgress counts the work done by a garbage collection run and reports
+// it, along with a checkpoint, periodically.
+type gcProgress struct {
+	ctx      context.Context
+	driver   driver.StorageDriver
+	interval time.Duration
+	last     time.Time
+
+	repositories int
+	marked       int
+	swept        int
+	sweptBytes   int64
+}
+
+func newGCProgress(ctx context.Context, storageDriver driver.StorageDriver, interval time.Duration) *gcProgress {
+	return &gcProgress{
+		ctx:      ctx,
+		driver:   storageDriver,
+		interval: interval,
+		last:     time.Now(),
+	}
+}
+
+// due reports whether progress should be reported and checkpointed.
+func (p *gcProgress) due() bool {
+	return p.interval > 0 && time.Since(p.last) >= p.interval
+}
+
+func (p *gcProgress) report() {
+	p.last = time.Now()
+	emit("progress: %d repositories scanned, %d blobs marked, %d blobs (%d bytes) swept",
+		p.repositories, p.marked, p.swept, p.sweptBytes)
+}
+
+func (p *gcProgress) saveCheckpoint(scanned map[string]struct{}, markSet map[digest.Digest]struct{}, manifests []ManifestDel) error {
+	checkpoint := gcCheckpoint{
+		Repositories: make([]string, 0, len(scanned)),
+		Marked:       make([]digest.Digest, 0, len(markSet)),
+		Manifests:    manifests,
+		Saved:        time.Now(),
+	}
+	for name := range scanned {
+		checkpoint.Repositories = append(checkpoint.Repositories, name)
+	}
+	for dgst := range markSet {
+		checkpoint.Marked = append(checkpoint.Marked, dgst)
+	}
+
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return p.driver.PutContent(p.ctx, gcCheckpointPath, content)
+}
+
+// loadCheckpoint returns the checkpoint saved by an interrupted run, or nil
+// if there is none.
+func (p *gcProgress) loadCheckpoint() (*gcCheckpoint, error) {
+	content, err := p.driver.GetContent(p.ctx, gcCheckpointPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var checkpoint gcCheckpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (p *gcProgress) removeCheckpoint() error {
+	err := p.driver.Delete(p.ctx, gcCheckpointPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
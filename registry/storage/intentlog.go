@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+	"github.com/opencontainers/go-digest"
+)
+
+// The operations recorded in the intent log.
+const (
+	intentPut    = "put"
+	intentDelete = "delete"
+	intentTag    = "tag"
+	intentUntag  = "untag"
+)
+
+// DefaultIntentGrace is how old intents must be to be recovered, so that
+// the mutations in progress on other instances are left alone.
+const DefaultIntentGrace = 10 * time.Minute
+
+// intent records a mutation of several paths, such as the revision link, the
+// tag links and the indexes written when a manifest is pushed, before it
+// starts. It is removed once the mutation returned: intents left behind by a
+// crash are recovered by RecoverIntents.
+type intent struct {
+	ID         string        `json:"id"`
+	Operation  string        `json:"operation"`
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+	Tag        string        `json:"tag,omitempty"`
+	// Previous is the digest the tag pointed to before it was tagged.
+	Previous digest.Digest `json:"previous,omitempty"`
+	Started  time.Time     `json:"started"`
+}
+
+// EnableIntentLog is a functional option for NewRegistry. It causes the
+// intent of pushing, tagging, untagging and deleting a manifest to be
+// recorded in storage before the paths involved are written.
+func EnableIntentLog(registry *registry) error {
+	registry.intentLog = true
+	return nil
+}
+
+// beginIntent records the intent to apply operation to the repository. The
+// returned function removes it, and must be called once the operation
+// returned, whether it succeeded or not: clients see the failures and retry,
+// while the mutations interrupted by a crash are left to RecoverIntents.
+func (repo *repository) beginIntent(ctx context.Context, operation string, dgst digest.Digest, tag string, previous digest.Digest) (func(), error) {
+	if !repo.intentLog {
+		return func() {}, nil
+	}
+
+	in := intent{
+		ID:         uuid.Generate().String(),
+		Operation:  operation,
+		Repository: repo.name.Name(),
+		Digest:     dgst,
+		Tag:        tag,
+		Previous:   previous,
+		Started:    time.Now().UTC(),
+	}
+	intentPath, err := pathFor(intentPathSpec{id: in.ID})
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.driver.PutContent(ctx, intentPath, content); err != nil {
+		return nil, fmt.Errorf("failed to record the intent to %s %s: %v", operation, repo.name.Name(), err)
+	}
+
+	return func() {
+		if err := repo.driver.Delete(ctx, intentPath); err != nil {
+			dcontext.GetLogger(ctx).Warnf("error removing intent %s: %v", in.ID, err)
+		}
+	}, nil
+}
+
+// RecoverIntents completes or rolls back the mutations recorded in the
+// intent log of the registry which started before olderThan and were
+// interrupted. A mutation is only completed if the paths it writes are still
+// as it left them: pushes and tags are completed if the manifest exists,
+// untags and deletions if the tag or the manifest was not written since.
+// Otherwise, a later mutation took over and the paths are left to it. Intents
+// are only reported if dryRun is set. It returns the number of intents
+// recovered.
+func RecoverIntents(ctx context.Context, ns distribution.Namespace, olderThan time.Time, dryRun bool) (int, error) {
+	reg, ok := ns.(*registry)
+	if !ok {
+		return 0, nil
+	}
+
+	root, err := pathFor(intentsPathSpec{})
+	if err != nil {
+		return 0, err
+	}
+	paths, err := reg.driver.List(ctx, root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	recovered := 0
+	for _, p := range paths {
+		content, err := reg.driver.GetContent(ctx, p)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// the mutation succeeded in the meantime
+				continue
+			}
+			return recovered, err
+		}
+		var in intent
+		if err := json.Unmarshal(content, &in); err != nil {
+			dcontext.GetLogger(ctx).Warnf("skipping unreadable intent %s: %v", p, err)
+			continue
+		}
+		if !in.Started.Before(olderThan) {
+			continue
+		}
+
+		dcontext.GetLogger(ctx).Infof("recovering intent %s to %s %s@%s %s, started at %s",
+			in.ID, in.Operation, in.Repository, in.Digest, in.Tag, in.Started.Format(time.RFC3339))
+		if dryRun {
+			recovered++
+			continue
+		}
+		if err := reg.recoverIntent(ctx, in); err != nil {
+			return recovered, fmt.Errorf("failed to recover intent %s: %v", in.ID, err)
+		}
+		if err := reg.driver.Delete(ctx, p); err != nil {
+			return recovered, err
+		}
+		recovered++
+	}
+	return recovered, nil
+}
+
+// readLinkSince reads the digest of the link at path, and tells whether the
+// link was written after t. Missing links have an empty digest.
+func (reg *registry) readLinkSince(ctx context.Context, path string, t time.Time) (digest.Digest, bool, error) {
+	fi, err := reg.driver.Stat(ctx, path)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	linked, err := reg.blobStore.readlink(ctx, path)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return linked, fi.ModTime().After(t), nil
+}
+
+// recoverIntent brings the paths involved in the operation of the intent to
+// a consistent state. Operations are idempotent, so that completing one
+// which succeeded but whose intent was left behind changes nothing.
+func (reg *registry) recoverIntent(ctx context.Context, in intent) error {
+	named, err := reg.nameValidator.WithName(in.Repository)
+	if err != nil {
+		return err
+	}
+	repo, err := reg.Repository(ctx, named)
+	if err != nil {
+		return err
+	}
+
+	revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: in.Repository, revision: in.Digest})
+	if err != nil {
+		return err
+	}
+	revision, revisionChanged, err := reg.readLinkSince(ctx, revisionPath, in.Started)
+	if err != nil {
+		return err
+	}
+	exists := revision != ""
+
+	var current digest.Digest
+	var tagChanged bool
+	if in.Tag != "" {
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: in.Repository, tag: in.Tag})
+		if err != nil {
+			return err
+		}
+		if current, tagChanged, err = reg.readLinkSince(ctx, currentPath, in.Started); err != nil {
+			return err
+		}
+	}
+
+	switch in.Operation {
+	case intentPut:
+		if !exists {
+			// the manifest was not linked, its blob is left to garbage
+			// collection
+			return nil
+		}
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			return err
+		}
+		manifest, err := manifests.Get(ctx, in.Digest)
+		if err != nil {
+			return err
+		}
+		if err := repo.(*repository).linkReferrer(ctx, in.Digest, manifest); err != nil {
+			return err
+		}
+		repo.(*repository).indexReferences(ctx, in.Digest, manifest)
+		repo.(*repository).recordForeignLayers(ctx, in.Digest, manifest)
+		return nil
+	case intentTag:
+		// the tag is completed if it was written, or still points to the
+		// manifest it pointed to before
+		if exists && (current == in.Digest || (current == in.Previous && !tagChanged)) {
+			return repo.Tags(ctx).Tag(ctx, in.Tag, distribution.Descriptor{Digest: in.Digest})
+		}
+		if current == in.Digest {
+			return nil
+		}
+		// the manifest was deleted or the tag moved since, leaving at most
+		// the entry of the manifest in the index of the tag
+		entryPath, err := pathFor(manifestTagIndexEntryPathSpec{name: in.Repository, tag: in.Tag, revision: in.Digest})
+		if err != nil {
+			return err
+		}
+		if exists {
+			if entry, err := reg.driver.Stat(ctx, entryPath); err != nil || !entry.ModTime().After(in.Started) {
+				// the entry predates the intent
+				return nil
+			}
+		}
+		if err := reg.driver.Delete(ctx, entryPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+		return nil
+	case intentDelete:
+		if !exists || revisionChanged {
+			// deleted, or pushed again since
+			return nil
+		}
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			return err
+		}
+		return manifests.Delete(ctx, in.Digest)
+	case intentUntag:
+		if current != "" && (current != in.Digest || tagChanged) {
+			// tagged again since
+			return nil
+		}
+		return repo.Tags(ctx).Untag(ctx, in.Tag)
+	default:
+		return fmt.Errorf("unknown operation %q", in.Operation)
+	}
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestIntentLog(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver, EnableIntentLog)
+	repo := makeRepository(t, registry, "foo/app")
+	tags := repo.Tags(ctx)
+
+	// intents are removed once the mutations succeeded
+	image := uploadRandomSchema2Image(t, repo)
+	if err := tags.Tag(ctx, "v1", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	intentsPath, _ := pathFor(intentsPathSpec{})
+	if intents, err := inmemoryDriver.List(ctx, intentsPath); err == nil && len(intents) != 0 {
+		t.Fatalf("unexpected intents left: %v", intents)
+	} else if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		t.Fatal(err)
+	}
+
+	// interrupted mutations are simulated by recording intents which are
+	// not removed
+	begin := func(operation string, dgst digest.Digest, tag string, previous digest.Digest) {
+		if _, err := repo.(*repository).beginIntent(ctx, operation, dgst, tag, previous); err != nil {
+			t.Fatalf("unexpected error recording intent: %v", err)
+		}
+	}
+	begin(intentTag, image.manifestDigest, "v2", "")
+	begin(intentUntag, image.manifestDigest, "v1", "")
+	begin(intentPut, digest.FromString("never linked"), "", "")
+
+	// recent intents are left alone
+	if recovered, err := RecoverIntents(ctx, registry, time.Now().Add(-time.Hour), false); err != nil || recovered != 0 {
+		t.Fatalf("expected no intent recovered, got %d: %v", recovered, err)
+	}
+	if recovered, err := RecoverIntents(ctx, registry, time.Now().Add(time.Minute), true); err != nil || recovered != 3 {
+		t.Fatalf("expected 3 intents to recover, got %d: %v", recovered, err)
+	}
+	if desc, err := tags.Get(ctx, "v2"); err == nil {
+		t.Fatalf("unexpected tag recovered in a dry run: %v", desc)
+	}
+
+	if recovered, err := RecoverIntents(ctx, registry, time.Now().Add(time.Minute), false); err != nil || recovered != 3 {
+		t.Fatalf("expected 3 intents recovered, got %d: %v", recovered, err)
+	}
+	if desc, err := tags.Get(ctx, "v2"); err != nil || desc.Digest != image.manifestDigest {
+		t.Fatalf("expected the interrupted tag to be completed, got %v: %v", desc, err)
+	}
+	if _, err := tags.Get(ctx, "v1"); err == nil {
+		t.Fatal("expected the interrupted untag to be completed")
+	}
+	if intents, err := inmemoryDriver.List(ctx, intentsPath); err != nil || len(intents) != 0 {
+		t.Fatalf("unexpected intents left: %v, %v", intents, err)
+	}
+
+	// a tag of a manifest deleted since is rolled back
+	manifests, _ := repo.Manifests(ctx)
+	if err := manifests.Delete(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	entryPath, _ := pathFor(manifestTagIndexEntryLinkPathSpec{name: "foo/app", tag: "v3", revision: image.manifestDigest})
+	if err := inmemoryDriver.PutContent(ctx, entryPath, []byte(image.manifestDigest)); err != nil {
+		t.Fatal(err)
+	}
+	begin(intentTag, image.manifestDigest, "v3", "")
+	if recovered, err := RecoverIntents(ctx, registry, time.Now().Add(time.Minute), false); err != nil || recovered != 1 {
+		t.Fatalf("expected 1 intent recovered, got %d: %v", recovered, err)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, entryPath); err == nil {
+		t.Fatal("expected the entry of the tag index to be removed")
+	}
+}
+
+func TestIntentLogLaterMutations(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver, EnableIntentLog, EnableDelete)
+	repo := makeRepository(t, registry, "foo/app")
+	tags := repo.Tags(ctx)
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := uploadRandomSchema2Image(t, repo)
+	second := uploadRandomSchema2Image(t, repo)
+	for _, tag := range []string{"moved", "retagged"} {
+		if err := tags.Tag(ctx, tag, distribution.Descriptor{Digest: first.manifestDigest}); err != nil {
+			t.Fatalf("unexpected error tagging: %v", err)
+		}
+	}
+	begin := func(operation string, dgst digest.Digest, tag string, previous digest.Digest) {
+		if _, err := repo.(*repository).beginIntent(ctx, operation, dgst, tag, previous); err != nil {
+			t.Fatalf("unexpected error recording intent: %v", err)
+		}
+	}
+
+	// mutations interrupted, then overtaken by later ones which succeeded
+	begin(intentTag, second.manifestDigest, "moved", first.manifestDigest)
+	begin(intentUntag, first.manifestDigest, "retagged", "")
+	begin(intentDelete, second.manifestDigest, "", "")
+	time.Sleep(10 * time.Millisecond)
+	if err := tags.Tag(ctx, "moved", distribution.Descriptor{Digest: first.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Tag(ctx, "retagged", distribution.Descriptor{Digest: first.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifests.Put(ctx, second.manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if recovered, err := RecoverIntents(ctx, registry, time.Now().Add(time.Minute), false); err != nil || recovered != 3 {
+		t.Fatalf("expected 3 intents recovered, got %d: %v", recovered, err)
+	}
+	for _, tag := range []string{"moved", "retagged"} {
+		if desc, err := tags.Get(ctx, tag); err != nil || desc.Digest != first.manifestDigest {
+			t.Errorf("expected %s to keep the digest of the later tag, got %v: %v", tag, desc, err)
+		}
+	}
+	if exists, err := manifests.Exists(ctx, second.manifestDigest); err != nil || !exists {
+		t.Errorf("expected the manifest pushed again to be kept: %v", err)
+	}
+}
+
+// failingTagDriver fails to write the current links of tags.
+type failingTagDriver struct {
+	driver.StorageDriver
+}
+
+func (d failingTagDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	if strings.HasSuffix(path, "/current/link") {
+		return errors.New("write failed")
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+func TestIntentLogFailedMutation(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, failingTagDriver{inmemoryDriver}, EnableIntentLog)
+	repo := makeRepository(t, registry, "foo/app")
+	image := uploadRandomSchema2Image(t, repo)
+
+	// the intents of failed mutations are removed, rather than completed
+	// behind the back of the client which saw them fail
+	if err := repo.Tags(ctx).Tag(ctx, "v1", distribution.Descriptor{Digest: image.manifestDigest}); err == nil {
+		t.Fatal("expected the tag to fail")
+	}
+	intentsPath, _ := pathFor(intentsPathSpec{})
+	if intents, err := inmemoryDriver.List(ctx, intentsPath); err == nil && len(intents) != 0 {
+		t.Fatalf("unexpected intents left: %v", intents)
+	}
+}
@@ -22,6 +22,41 @@ func getContent(ctx context.Context, driver driver.StorageDriver, p string) ([]b
 	return readAllLimited(r, maxBlobGetSize)
 }
 
+// CopyPath copies the object stored at sourcePath to destPath. The copy is
+// made server side if the driver is a driver.Copier, and otherwise streamed
+// through the registry.
+func CopyPath(ctx context.Context, storageDriver driver.StorageDriver, sourcePath string, destPath string) error {
+	if copier, ok := storageDriver.(driver.Copier); ok {
+		err := copier.Copy(ctx, sourcePath, destPath)
+		if _, ok := err.(driver.ErrUnsupportedMethod); !ok {
+			return err
+		}
+	}
+
+	r, err := storageDriver.Reader(ctx, sourcePath, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := storageDriver.Writer(ctx, destPath, false)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Cancel()
+		w.Close()
+		return err
+	}
+	if err := w.Commit(); err != nil {
+		w.Cancel()
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
 func readAllLimited(r io.Reader, limit int64) ([]byte, error) {
 	r = limitReader(r, limit)
 	return ioutil.ReadAll(r)
@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// LayoutFlat is the original layout of storage, in which the links and
+// uploads of a repository are kept in one directory each. Storage without a
+// layout marker uses it.
+const LayoutFlat = 1
+
+// LayoutSharded fans out the layer links and uploads of each repository over
+// two levels of directories, so that very active repositories do not gather
+// thousands of entries under a single prefix.
+const LayoutSharded = 2
+
+// layoutPath is where the layout revision of storage is recorded.
+var layoutPath = path.Join(storagePathRoot, storagePathVersion, "layout.json")
+
+// layoutCheckpointPath is where a layout upgrade records its progress, so
+// that an interrupted run can be resumed.
+var layoutCheckpointPath = path.Join(storagePathRoot, storagePathVersion, "layout-checkpoint.json")
+
+// layoutMigration moves a repository from one layout revision to the next.
+type layoutMigration struct {
+	// description tells what the next revision changes.
+	description string
+
+	// migrateRepository moves the named repository to the next revision,
+	// only reporting what it would do if dryRun is set. It must be safe to
+	// run again on a repository that was partially or fully migrated.
+	migrateRepository func(ctx context.Context, storageDriver driver.StorageDriver, name string, dryRun bool) error
+}
+
+// layoutMigrations lists the migrations between successive layout
+// revisions, the first one upgrading from LayoutFlat.
+var layoutMigrations = []layoutMigration{
+	{
+		description:       "shard the layer links of repositories",
+		migrateRepository: shardLayerLinks,
+	},
+}
+
+// LatestLayout returns the most recent layout revision supported by this
+// registry.
+func LatestLayout() int {
+	return LayoutFlat + len(layoutMigrations)
+}
+
+// Layout describes the layout revision of storage.
+type Layout struct {
+	// Version is the revision all repositories have been migrated to.
+	Version int `json:"version"`
+
+	// Target is the revision an unfinished migration is moving the
+	// repositories to, or zero if there is none.
+	Target int `json:"target,omitempty"`
+
+	// Updated is when the layout was last changed.
+	Updated time.Time `json:"updated"`
+}
+
+// includes reports whether storage uses, or is being migrated to, the given
+// layout revision or a more recent one.
+func (layout Layout) includes(version int) bool {
+	return layout.Version >= version || layout.Target >= version
+}
+
+// ErrLayoutUnsupported is returned when storage uses, or is being migrated
+// to, a layout revision more recent than this registry supports.
+type ErrLayoutUnsupported struct {
+	Layout Layout
+}
+
+func (err ErrLayoutUnsupported) Error() string {
+	version := err.Layout.Version
+	if err.Layout.Target > version {
+		version = err.Layout.Target
+	}
+	return fmt.Sprintf("storage layout %d is not supported, the latest supported layout is %d", version, LatestLayout())
+}
+
+// ReadLayout returns the layout of storage, checking that this registry
+// supports it.
+func ReadLayout(ctx context.Context, storageDriver driver.StorageDriver) (Layout, error) {
+	content, err := storageDriver.GetContent(ctx, layoutPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return Layout{Version: LayoutFlat}, nil
+		}
+		return Layout{}, err
+	}
+
+	var layout Layout
+	if err := json.Unmarshal(content, &layout); err != nil {
+		return Layout{}, fmt.Errorf("invalid storage layout: %v", err)
+	}
+	if layout.Version < LayoutFlat {
+		return Layout{}, fmt.Errorf("invalid storage layout %d", layout.Version)
+	}
+	if layout.Version > LatestLayout() || layout.Target > LatestLayout() {
+		return layout, ErrLayoutUnsupported{Layout: layout}
+	}
+	return layout, nil
+}
+
+func writeLayout(ctx context.Context, storageDriver driver.StorageDriver, layout Layout) error {
+	layout.Updated = time.Now()
+	content, err := json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+	return storageDriver.PutContent(ctx, layoutPath, content)
+}
+
+// UpgradeLayoutOpts contains options for UpgradeLayout.
+type UpgradeLayoutOpts struct {
+	// Target is the layout revision to upgrade to. Zero upgrades to the
+	// latest one.
+	Target int
+
+	// DryRun reports the changes of each repository without making them.
+	DryRun bool
+
+	// Resume continues a migration that was interrupted, skipping the
+	// repositories recorded by its last checkpoint.
+	Resume bool
+
+	// ProgressInterval is how often progress is reported and, unless
+	// DryRun is set, a checkpoint saved to storage. Zero disables both.
+	ProgressInterval time.Duration
+}
+
+// layoutCheckpoint is the state of a layout migration saved to storage.
+type layoutCheckpoint struct {
+	Target       int       `json:"target"`
+	Repositories []string  `json:"repositories"`
+	Saved        time.Time `json:"saved"`
+}
+
+// UpgradeLayout migrates the repositories of storage, one layout revision at
+// a time, up to the target revision. The layout marker records the revision
+// being migrated to while a migration runs, so that an interrupted migration
+// is detected and can be resumed.
+func UpgradeLayout(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts UpgradeLayoutOpts) error {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	layout, err := ReadLayout(ctx, storageDriver)
+	if err != nil {
+		return err
+	}
+
+	target := opts.Target
+	if target == 0 {
+		target = LatestLayout()
+	}
+	switch {
+	case target < LayoutFlat || target > LatestLayout():
+		return fmt.Errorf("unknown storage layout %d, the latest supported layout is %d", target, LatestLayout())
+	case target < layout.Version:
+		return fmt.Errorf("storage uses layout %d, downgrading to layout %d is not supported", layout.Version, target)
+	case layout.Target != 0 && !opts.Resume:
+		return fmt.Errorf("a migration to layout %d was interrupted, run again with resume to complete it", layout.Target)
+	case layout.Target != 0 && layout.Target > target:
+		return fmt.Errorf("a migration to layout %d was interrupted, it cannot be resumed with target %d", layout.Target, target)
+	case layout.Version == target:
+		emit("storage already uses layout %d", target)
+		return nil
+	}
+
+	for version := layout.Version; version < target; version++ {
+		migration := layoutMigrations[version-LayoutFlat]
+		emit("migrating storage from layout %d to layout %d: %s", version, version+1, migration.description)
+
+		migrated := make(map[string]struct{})
+		if opts.Resume && layout.Target == version+1 {
+			checkpoint, err := loadLayoutCheckpoint(ctx, storageDriver)
+			if err != nil {
+				return fmt.Errorf("failed to load checkpoint: %v", err)
+			}
+			if checkpoint != nil && checkpoint.Target == version+1 {
+				emit("resuming from checkpoint saved at %s: %d repositories migrated",
+					checkpoint.Saved.Format(time.RFC3339), len(checkpoint.Repositories))
+				for _, name := range checkpoint.Repositories {
+					migrated[name] = struct{}{}
+				}
+			}
+		}
+
+		if !opts.DryRun {
+			if err := writeLayout(ctx, storageDriver, Layout{Version: version, Target: version + 1}); err != nil {
+				return fmt.Errorf("failed to record layout migration: %v", err)
+			}
+		}
+
+		last := time.Now()
+		checkpoint := func() {
+			last = time.Now()
+			emit("progress: %d repositories migrated", len(migrated))
+			if opts.DryRun {
+				return
+			}
+			if err := saveLayoutCheckpoint(ctx, storageDriver, version+1, migrated); err != nil {
+				emit("failed to save checkpoint: %v", err)
+			}
+		}
+
+		err := repositoryEnumerator.Enumerate(ctx, func(name string) error {
+			if _, ok := migrated[name]; ok {
+				return nil
+			}
+			if err := migration.migrateRepository(ctx, storageDriver, name, opts.DryRun); err != nil {
+				return fmt.Errorf("failed to migrate repository %s: %v", name, err)
+			}
+			migrated[name] = struct{}{}
+
+			if opts.ProgressInterval > 0 && time.Since(last) >= opts.ProgressInterval {
+				checkpoint()
+			}
+			return nil
+		})
+		if err != nil {
+			if opts.ProgressInterval > 0 {
+				checkpoint()
+			}
+			return err
+		}
+
+		if opts.DryRun {
+			emit("dry run: %d repositories would be migrated to layout %d", len(migrated), version+1)
+			continue
+		}
+
+		if err := writeLayout(ctx, storageDriver, Layout{Version: version + 1}); err != nil {
+			return fmt.Errorf("failed to record layout %d: %v", version+1, err)
+		}
+		if err := removeLayoutCheckpoint(ctx, storageDriver); err != nil {
+			return fmt.Errorf("failed to remove checkpoint: %v", err)
+		}
+		emit("storage uses layout %d: %d repositories migrated", version+1, len(migrated))
+	}
+
+	return nil
+}
+
+func saveLayoutCheckpoint(ctx context.Context, storageDriver driver.StorageDriver, target int, migrated map[string]struct{}) error {
+	checkpoint := layoutCheckpoint{
+		Target:       target,
+		Repositories: make([]string, 0, len(migrated)),
+		Saved:        time.Now(),
+	}
+	for name := range migrated {
+		checkpoint.Repositories = append(checkpoint.Repositories, name)
+	}
+
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return storageDriver.PutContent(ctx, layoutCheckpointPath, content)
+}
+
+// loadLayoutCheckpoint returns the checkpoint saved by an interrupted
+// migration, or nil if there is none.
+func loadLayoutCheckpoint(ctx context.Context, storageDriver driver.StorageDriver) (*layoutCheckpoint, error) {
+	content, err := storageDriver.GetContent(ctx, layoutCheckpointPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var checkpoint layoutCheckpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func removeLayoutCheckpoint(ctx context.Context, storageDriver driver.StorageDriver) error {
+	err := storageDriver.Delete(ctx, layoutCheckpointPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// shardLayerLinks moves the layer links of a repository from the flat layout
+// to the sharded one. Uploads are left in place, to be resumed or purged from
+// the flat layout.
+func shardLayerLinks(ctx context.Context, storageDriver driver.StorageDriver, name string, dryRun bool) error {
+	repositoriesRoot, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+	root := path.Join(repositoriesRoot, name, "_layers")
+
+	// flat links are <algorithm>/<hex digest>/link, their sharded
+	// counterparts <algorithm>/<shards>/<hex digest>/link
+	var links []string
+	err = storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		parts := strings.Split(strings.TrimPrefix(fileInfo.Path(), root+"/"), "/")
+		if fileInfo.IsDir() || len(parts) < 3 || parts[len(parts)-1] != "link" {
+			return nil
+		}
+		hex := parts[len(parts)-2]
+		shards := shardComponents(hex)
+		if len(shards) == 0 {
+			return nil
+		}
+		if len(parts) >= 5 && parts[len(parts)-4] == shards[0] && parts[len(parts)-3] == shards[1] {
+			// already sharded
+			return nil
+		}
+		links = append(links, fileInfo.Path())
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	if dryRun {
+		if len(links) > 0 {
+			emit("%s: %d layer links to shard", name, len(links))
+		}
+		return nil
+	}
+
+	for _, link := range links {
+		content, err := storageDriver.GetContent(ctx, link)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return err
+		}
+
+		dir := path.Dir(link)
+		hex := path.Base(dir)
+		components := append([]string{path.Dir(dir)}, shardComponents(hex)...)
+		sharded := path.Join(append(components, hex, "link")...)
+		if err := storageDriver.PutContent(ctx, sharded, content); err != nil {
+			return err
+		}
+		if err := storageDriver.Delete(ctx, dir); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestReadLayout(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	layout, err := ReadLayout(ctx, d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if layout.Version != LayoutFlat {
+		t.Fatalf("expected storage without marker to use layout %d, got %d", LayoutFlat, layout.Version)
+	}
+
+	if err := writeLayout(ctx, d, Layout{Version: LatestLayout() + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLayout(ctx, d); err == nil {
+		t.Fatal("expected an error reading an unsupported layout")
+	}
+	if _, err := NewRegistry(ctx, d); err == nil {
+		t.Fatal("expected the registry to refuse an unsupported layout")
+	} else if _, ok := err.(ErrLayoutUnsupported); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUpgradeLayout(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	if err := writeLayout(ctx, d, Layout{Version: LatestLayout()}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		uploadRandomLayer(t, ctx, d, name)
+	}
+	registry := createRegistry(t, d)
+
+	// Add a migration to a test layout, failing on a repository once.
+	migrated := make(map[string]int)
+	failOn := "b"
+	defer func(migrations []layoutMigration) { layoutMigrations = migrations }(layoutMigrations)
+	layoutMigrations = append(layoutMigrations, layoutMigration{
+		description: "test",
+		migrateRepository: func(ctx context.Context, storageDriver driver.StorageDriver, name string, dryRun bool) error {
+			if name == failOn {
+				failOn = ""
+				return errors.New("interrupted")
+			}
+			if !dryRun {
+				migrated[name]++
+			}
+			return nil
+		},
+	})
+	target := LatestLayout()
+
+	if err := UpgradeLayout(ctx, d, registry, UpgradeLayoutOpts{DryRun: true}); err == nil {
+		t.Fatal("expected the dry run to be interrupted")
+	}
+	if layout, err := ReadLayout(ctx, d); err != nil || layout.Version != target-1 || layout.Target != 0 {
+		t.Fatalf("expected a dry run to leave the layout unchanged, got %+v, %v", layout, err)
+	}
+	if len(migrated) != 0 {
+		t.Fatalf("expected a dry run to migrate nothing, got %v", migrated)
+	}
+
+	failOn = "b"
+	if err := UpgradeLayout(ctx, d, registry, UpgradeLayoutOpts{ProgressInterval: 1}); err == nil {
+		t.Fatal("expected the upgrade to be interrupted")
+	}
+	if layout, err := ReadLayout(ctx, d); err != nil || layout.Version != target-1 || layout.Target != target {
+		t.Fatalf("expected an unfinished migration to be recorded, got %+v, %v", layout, err)
+	}
+	if err := UpgradeLayout(ctx, d, registry, UpgradeLayoutOpts{}); err == nil {
+		t.Fatal("expected an error upgrading without resuming the interrupted migration")
+	}
+
+	if err := UpgradeLayout(ctx, d, registry, UpgradeLayoutOpts{Resume: true}); err != nil {
+		t.Fatalf("unexpected error resuming the upgrade: %v", err)
+	}
+	if layout, err := ReadLayout(ctx, d); err != nil || layout.Version != target || layout.Target != 0 {
+		t.Fatalf("expected storage to use layout %d, got %+v, %v", target, layout, err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if migrated[name] != 1 {
+			t.Errorf("expected repository %s to be migrated once, got %d", name, migrated[name])
+		}
+	}
+	if checkpoint, err := loadLayoutCheckpoint(ctx, d); err != nil || checkpoint != nil {
+		t.Fatalf("expected the checkpoint to be removed, got %+v, %v", checkpoint, err)
+	}
+
+	if err := UpgradeLayout(ctx, d, registry, UpgradeLayoutOpts{}); err != nil {
+		t.Fatalf("unexpected error upgrading storage already at the latest layout: %v", err)
+	}
+	if err := UpgradeLayout(ctx, d, registry, UpgradeLayoutOpts{Target: target - 1}); err == nil {
+		t.Fatal("expected an error downgrading")
+	}
+}
+
+func TestShardedLayout(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("foo/bar")
+
+	flatLayer := uploadRandomLayer(t, ctx, d, name.Name())
+	flat := createRegistry(t, d)
+	repo, err := flat.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, err := repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	if _, err := upload.Write([]byte("flat")); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpgradeLayout(ctx, d, flat, UpgradeLayoutOpts{Target: LayoutSharded}); err != nil {
+		t.Fatalf("unexpected error upgrading layout: %v", err)
+	}
+
+	linkExists := func(dgst digest.Digest, sharded bool) bool {
+		p, err := pathFor(layerLinkPathSpec{name: name.Name(), digest: dgst, sharded: sharded})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = d.Stat(ctx, p)
+		return err == nil
+	}
+	if linkExists(flatLayer, false) || !linkExists(flatLayer, true) {
+		t.Fatal("expected the layer link to be sharded")
+	}
+
+	sharded := createRegistry(t, d)
+	repo, err = sharded.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repo.Blobs(ctx)
+	if _, err := blobs.Stat(ctx, flatLayer); err != nil {
+		t.Fatalf("unexpected error reading migrated layer: %v", err)
+	}
+
+	// layers pushed afterwards are linked in the sharded layout, while
+	// uploads started before the migration carry on in the flat one.
+	shardedLayer := uploadRandomLayer(t, ctx, d, name.Name())
+	if linkExists(shardedLayer, false) || !linkExists(shardedLayer, true) {
+		t.Fatal("expected the layer to be linked in the sharded layout")
+	}
+
+	resumed, err := blobs.Resume(ctx, upload.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming flat upload: %v", err)
+	}
+	if _, err := resumed.Write([]byte(" upload")); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("flat upload")
+	desc, err := resumed.Commit(ctx, distribution.Descriptor{Digest: digest.FromBytes(content), Size: int64(len(content))})
+	if err != nil {
+		t.Fatalf("unexpected error committing flat upload: %v", err)
+	}
+	if p, err := blobs.Get(ctx, desc.Digest); err != nil || !bytes.Equal(p, content) {
+		t.Fatalf("unexpected content of committed upload: %q, %v", p, err)
+	}
+
+	upload, err = blobs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	defer upload.Cancel(ctx)
+	startedAt, err := pathFor(uploadStartedAtPathSpec{name: name.Name(), id: upload.ID(), sharded: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Stat(ctx, startedAt); err != nil {
+		t.Fatalf("expected the upload to be created in the sharded layout: %v", err)
+	}
+
+	usage, err := sharded.(distribution.NamespaceEnumerator).NamespaceUsage(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Blobs != 3 {
+		t.Fatalf("unexpected number of blobs in namespace usage: %d != 3", usage.Blobs)
+	}
+}
@@ -32,6 +32,9 @@ type linkedBlobStore struct {
 	deleteEnabled          bool
 	resumableDigestEnabled bool
 
+	// shardedUploads creates uploads in the sharded layout.
+	shardedUploads bool
+
 	// linkPathFns specifies one or more path functions allowing one to
 	// control the repository blob link set to which the blob store
 	// dispatches. This is required because manifest and layer blobs have not
@@ -149,8 +152,9 @@ func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.
 	startedAt := time.Now().UTC()
 
 	path, err := pathFor(uploadDataPathSpec{
-		name: lbs.repository.Named().Name(),
-		id:   uuid,
+		name:    lbs.repository.Named().Name(),
+		id:      uuid,
+		sharded: lbs.shardedUploads,
 	})
 
 	if err != nil {
@@ -158,8 +162,9 @@ func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.
 	}
 
 	startedAtPath, err := pathFor(uploadStartedAtPathSpec{
-		name: lbs.repository.Named().Name(),
-		id:   uuid,
+		name:    lbs.repository.Named().Name(),
+		id:      uuid,
+		sharded: lbs.shardedUploads,
 	})
 
 	if err != nil {
@@ -171,30 +176,43 @@ func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.
 		return nil, err
 	}
 
-	return lbs.newBlobUpload(ctx, uuid, path, startedAt, false)
+	return lbs.newBlobUpload(ctx, uuid, path, startedAt, false, lbs.shardedUploads)
 }
 
 func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution.BlobWriter, error) {
 	dcontext.GetLogger(ctx).Debug("(*linkedBlobStore).Resume")
 
-	startedAtPath, err := pathFor(uploadStartedAtPathSpec{
-		name: lbs.repository.Named().Name(),
-		id:   id,
-	})
+	// Look the upload up in the layout uploads are created with, then in
+	// the other one, as it may have been started before the layout of
+	// storage was upgraded or by an instance using another layout.
+	var (
+		startedAtBytes []byte
+		sharded        bool
+		found          bool
+	)
+	for _, sharded = range []bool{lbs.shardedUploads, !lbs.shardedUploads} {
+		startedAtPath, err := pathFor(uploadStartedAtPathSpec{
+			name:    lbs.repository.Named().Name(),
+			id:      id,
+			sharded: sharded,
+		})
 
-	if err != nil {
-		return nil, err
-	}
+		if err != nil {
+			return nil, err
+		}
 
-	startedAtBytes, err := lbs.blobStore.driver.GetContent(ctx, startedAtPath)
-	if err != nil {
-		switch err := err.(type) {
-		case driver.PathNotFoundError:
-			return nil, distribution.ErrBlobUploadUnknown
-		default:
+		startedAtBytes, err = lbs.blobStore.driver.GetContent(ctx, startedAtPath)
+		if err == nil {
+			found = true
+			break
+		}
+		if _, ok := err.(driver.PathNotFoundError); !ok {
 			return nil, err
 		}
 	}
+	if !found {
+		return nil, distribution.ErrBlobUploadUnknown
+	}
 
 	startedAt, err := time.Parse(time.RFC3339, string(startedAtBytes))
 	if err != nil {
@@ -202,15 +220,16 @@ func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution
 	}
 
 	path, err := pathFor(uploadDataPathSpec{
-		name: lbs.repository.Named().Name(),
-		id:   id,
+		name:    lbs.repository.Named().Name(),
+		id:      id,
+		sharded: sharded,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return lbs.newBlobUpload(ctx, id, path, startedAt, true)
+	return lbs.newBlobUpload(ctx, id, path, startedAt, true, sharded)
 }
 
 func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
@@ -305,7 +324,7 @@ func (lbs *linkedBlobStore) mount(ctx context.Context, sourceRepo reference.Name
 }
 
 // newBlobUpload allocates a new upload controller with the given state.
-func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string, startedAt time.Time, append bool) (distribution.BlobWriter, error) {
+func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string, startedAt time.Time, append, sharded bool) (distribution.BlobWriter, error) {
 	fw, err := lbs.driver.Writer(ctx, path, append)
 	if err != nil {
 		return nil, err
@@ -321,6 +340,7 @@ func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string
 		driver:                 lbs.driver,
 		path:                   path,
 		resumableDigestEnabled: lbs.resumableDigestEnabled,
+		sharded:                sharded,
 	}
 
 	return bw, nil
@@ -459,6 +479,12 @@ func blobLinkPath(name string, dgst digest.Digest) (string, error) {
 	return pathFor(layerLinkPathSpec{name: name, digest: dgst})
 }
 
+// shardedBlobLinkPath provides the path to the blob link in the sharded
+// layout.
+func shardedBlobLinkPath(name string, dgst digest.Digest) (string, error) {
+	return pathFor(layerLinkPathSpec{name: name, digest: dgst, sharded: true})
+}
+
 // manifestRevisionLinkPath provides the path to the manifest revision link.
 func manifestRevisionLinkPath(name string, dgst digest.Digest) (string, error) {
 	return pathFor(manifestRevisionLinkPathSpec{name: name, revision: dgst})
@@ -15,6 +15,9 @@ type manifestListHandler struct {
 	repository distribution.Repository
 	blobStore  distribution.BlobStore
 	ctx        context.Context
+
+	// referenceConcurrency bounds the lookups of referenced manifests.
+	referenceConcurrency int
 }
 
 var _ ManifestHandler = &manifestListHandler{}
@@ -77,14 +80,22 @@ func (ms *manifestListHandler) verifyManifest(ctx context.Context, mnfst manifes
 			return err
 		}
 
-		for _, manifestDescriptor := range mnfst.References() {
+		references := mnfst.References()
+		resolved := resolveReferences(references, ms.referenceConcurrency, func(manifestDescriptor distribution.Descriptor) error {
 			exists, err := manifestService.Exists(ctx, manifestDescriptor.Digest)
+			if err == nil && !exists {
+				err = distribution.ErrBlobUnknown
+			}
+			return err
+		})
+
+		for i, err := range resolved {
 			if err != nil && err != distribution.ErrBlobUnknown {
 				errs = append(errs, err)
 			}
-			if err != nil || !exists {
+			if err != nil {
 				// On error here, we always append unknown blob errors.
-				errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: manifestDescriptor.Digest})
+				errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: references[i].Digest})
 			}
 		}
 	}
@@ -129,24 +129,66 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
+	var handler ManifestHandler
 	switch manifest.(type) {
 	case *schema1.SignedManifest:
-		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema1Handler
 	case *schema2.DeserializedManifest:
-		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema2Handler
 	case *ocischema.DeserializedManifest:
-		return ms.ocischemaHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.ocischemaHandler
 	case *manifestlist.DeserializedManifestList:
-		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.manifestListHandler
+	default:
+		return "", fmt.Errorf("unrecognized manifest type %T", manifest)
 	}
 
-	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return "", err
+	}
+	done, err := ms.repository.beginIntent(ctx, intentPut, digest.FromBytes(payload), "", "")
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	dgst, err := handler.Put(ctx, manifest, ms.skipDependencyVerification)
+	if err != nil {
+		return "", err
+	}
+	if err := ms.repository.linkReferrer(ctx, dgst, manifest); err != nil {
+		return "", err
+	}
+	ms.repository.indexReferences(ctx, dgst, manifest)
+	ms.repository.recordForeignLayers(ctx, dgst, manifest)
+	ms.repository.recordEvent(ctx, distribution.RepositoryEventPush, dgst, "", "")
+	return dgst, nil
 }
 
 // Delete removes the revision of the specified manifest.
 func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Delete")
-	return ms.blobStore.Delete(ctx, dgst)
+
+	// the manifest is read beforehand to find its entries in the reference
+	// index, its subject and its foreign layers
+	manifest, _ := ms.Get(ctx, dgst)
+
+	done, err := ms.repository.beginIntent(ctx, intentDelete, dgst, "", "")
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err := ms.blobStore.Delete(ctx, dgst); err != nil {
+		return err
+	}
+	if manifest != nil {
+		ms.repository.unindexReferences(ctx, dgst, manifest)
+		ms.repository.unlinkReferrer(ctx, dgst, manifest)
+		ms.repository.removeForeignLayers(ctx, dgst, manifest)
+	}
+	ms.repository.recordEvent(ctx, distribution.RepositoryEventDelete, dgst, "", "")
+	return nil
 }
 
 func (ms *manifestStore) Enumerate(ctx context.Context, ingester func(digest.Digest) error) error {
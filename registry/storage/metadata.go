@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+var _ distribution.RepositoryMetadataStore = &registry{}
+
+// RepositoryMetadata reads the metadata document of the named repository.
+func (reg *registry) RepositoryMetadata(ctx context.Context, name reference.Named) (distribution.RepositoryMetadata, error) {
+	var metadata distribution.RepositoryMetadata
+
+	metadataPath, err := pathFor(repositoryMetadataPathSpec{name: name.Name()})
+	if err != nil {
+		return metadata, err
+	}
+
+	content, err := reg.blobStore.driver.GetContent(ctx, metadataPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return metadata, nil
+		}
+		return metadata, err
+	}
+
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return metadata, err
+	}
+
+	return metadata, nil
+}
+
+// PutRepositoryMetadata writes the metadata document of the named repository.
+func (reg *registry) PutRepositoryMetadata(ctx context.Context, name reference.Named, metadata distribution.RepositoryMetadata) error {
+	metadataPath, err := pathFor(repositoryMetadataPathSpec{name: name.Name()})
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return reg.blobStore.driver.PutContent(ctx, metadataPath, content)
+}
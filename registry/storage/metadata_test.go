@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+)
+
+func TestRepositoryMetadata(t *testing.T) {
+	env := setupFS(t)
+	store := env.registry.(distribution.RepositoryMetadataStore)
+
+	name, _ := reference.WithName("foo/a")
+	metadata, err := store.RepositoryMetadata(env.ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(metadata, distribution.RepositoryMetadata{}) {
+		t.Fatalf("expected empty metadata, got %+v", metadata)
+	}
+
+	expected := distribution.RepositoryMetadata{
+		Description: "The a service",
+		Owner:       "team-a",
+		Labels:      map[string]string{"tier": "backend"},
+	}
+	if err := store.PutRepositoryMetadata(env.ctx, name, expected); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	metadata, err = store.RepositoryMetadata(env.ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, metadata)
+	}
+
+	// metadata does not show up as a repository
+	repos := make([]string, 50)
+	n, _ := env.registry.Repositories(env.ctx, repos, "")
+	if n != len(env.expected) {
+		t.Fatalf("unexpected repositories: %v", repos[:n])
+	}
+}
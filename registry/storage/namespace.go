@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.NamespaceEnumerator = &registry{}
+
+// NamespaceRepositories returns a list, or partial list, of the repositories
+// whose name starts with namespace followed by a slash. A repository named
+// exactly namespace is not part of it.
+func (reg *registry) NamespaceRepositories(ctx context.Context, namespace string, repos []string, last string) (n int, err error) {
+	var finishedWalk bool
+	var foundRepos []string
+
+	if len(repos) == 0 {
+		return 0, errors.New("no space in slice")
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return 0, err
+	}
+
+	err = reg.blobStore.driver.Walk(ctx, path.Join(root, namespace), func(fileInfo driver.FileInfo) error {
+		err := handleRepository(fileInfo, root, last, func(repoPath string) error {
+			if repoPath != namespace {
+				foundRepos = append(foundRepos, repoPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(foundRepos) == len(repos) {
+			finishedWalk = true
+			return driver.ErrSkipDir
+		}
+
+		return nil
+	})
+
+	n = copy(repos, foundRepos)
+
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return n, io.EOF
+		}
+		return n, err
+	} else if !finishedWalk {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// NamespaceUsage walks the layer and manifest revision links of every
+// repository in namespace and sums the size of the distinct blobs they
+// reference. Links to blobs missing from the blob store are ignored. An
+// unknown namespace has no usage.
+func (reg *registry) NamespaceUsage(ctx context.Context, namespace string) (distribution.NamespaceUsage, error) {
+	var usage distribution.NamespaceUsage
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return usage, err
+	}
+
+	digests := make(map[digest.Digest]struct{})
+	err = reg.blobStore.driver.Walk(ctx, path.Join(root, namespace), func(fileInfo driver.FileInfo) error {
+		rel := fileInfo.Path()[len(root)+1:]
+		dir, file := path.Split(rel)
+		dir = strings.TrimSuffix(dir, "/")
+
+		if fileInfo.IsDir() {
+			switch {
+			case !strings.HasPrefix(file, "_"):
+				if file == "tags" && path.Base(dir) == "_manifests" {
+					return driver.ErrSkipDir
+				}
+				return nil
+			case dir == namespace:
+				// the namespace itself is a repository, which it does
+				// not contain.
+				return driver.ErrSkipDir
+			case file == "_layers":
+				usage.Repositories++
+				return nil
+			case file == "_manifests":
+				return nil
+			}
+			return driver.ErrSkipDir
+		}
+
+		if file != "link" {
+			return nil
+		}
+
+		for _, marker := range []string{"/_layers/", "/_manifests/revisions/"} {
+			i := strings.Index(rel, marker)
+			if i < 0 {
+				continue
+			}
+			parts := strings.Split(rel[i+len(marker):], "/")
+			if marker == "/_layers/" && len(parts) == 5 {
+				// link in the sharded layout
+				parts = append(parts[:1], parts[3:]...)
+			}
+			if len(parts) != 3 {
+				return nil
+			}
+			dgst, err := digest.Parse(parts[0] + ":" + parts[1])
+			if err == nil {
+				digests[dgst] = struct{}{}
+			}
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return usage, nil
+		}
+		return usage, err
+	}
+
+	for dgst := range digests {
+		desc, err := reg.statter.Stat(ctx, dgst)
+		if err == distribution.ErrBlobUnknown {
+			continue
+		} else if err != nil {
+			return usage, err
+		}
+		usage.Blobs++
+		usage.Size += desc.Size
+	}
+
+	return usage, nil
+}
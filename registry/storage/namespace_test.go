@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/docker/distribution"
+)
+
+func TestNamespaceRepositories(t *testing.T) {
+	env := setupFS(t)
+	enumerator := env.registry.(distribution.NamespaceEnumerator)
+
+	for _, tc := range []struct {
+		namespace string
+		last      string
+		size      int
+		expected  []string
+		err       error
+	}{
+		{namespace: "foo", size: 10, expected: []string{"foo/a", "foo/b", "foo/d/in"}, err: io.EOF},
+		{namespace: "foo", size: 2, expected: []string{"foo/a", "foo/b"}},
+		{namespace: "foo", last: "foo/b", size: 2, expected: []string{"foo/d/in"}, err: io.EOF},
+		{namespace: "foo/d", size: 10, expected: []string{"foo/d/in"}, err: io.EOF},
+		{namespace: "foo-bar", size: 10, expected: []string{"foo-bar/a", "foo-bar/b"}, err: io.EOF},
+		{namespace: "test", size: 10, err: io.EOF},
+		{namespace: "unknown", size: 10, err: io.EOF},
+	} {
+		repos := make([]string, tc.size)
+		n, err := enumerator.NamespaceRepositories(env.ctx, tc.namespace, repos, tc.last)
+		if err != tc.err {
+			t.Errorf("%s after %q: unexpected error: %v", tc.namespace, tc.last, err)
+		}
+		if n != len(tc.expected) || !testEq(repos[:n], tc.expected, n) {
+			t.Errorf("%s after %q: expected %v, got %v", tc.namespace, tc.last, tc.expected, repos[:n])
+		}
+	}
+}
+
+func TestNamespaceUsage(t *testing.T) {
+	env := setupFS(t)
+	enumerator := env.registry.(distribution.NamespaceEnumerator)
+
+	bar, err := enumerator.NamespaceUsage(env.ctx, "bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// every repository holds one layer and one manifest
+	if bar.Repositories != 3 || bar.Blobs != 6 || bar.Size <= 0 {
+		t.Errorf("unexpected usage of bar: %+v", bar)
+	}
+
+	fooBar, err := enumerator.NamespaceUsage(env.ctx, "foo-bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fooBar.Repositories != 2 || fooBar.Blobs != 4 {
+		t.Errorf("unexpected usage of foo-bar: %+v", fooBar)
+	}
+
+	for _, namespace := range []string{"test", "unknown"} {
+		usage, err := enumerator.NamespaceUsage(env.ctx, namespace)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if usage != (distribution.NamespaceUsage{}) {
+			t.Errorf("expected no usage of %s, got %+v", namespace, usage)
+		}
+	}
+}
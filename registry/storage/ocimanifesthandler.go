@@ -3,7 +3,6 @@ package storage
 import (
 	"context"
 	"fmt"
-	"net/url"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -18,6 +17,13 @@ type ocischemaManifestHandler struct {
 	blobStore    distribution.BlobStore
 	ctx          context.Context
 	manifestURLs manifestURLs
+
+	// referenceConcurrency bounds the lookups of referenced blobs.
+	referenceConcurrency int
+
+	// validateConfig enables checking the config blob against its media
+	// type.
+	validateConfig bool
 }
 
 var _ ManifestHandler = &ocischemaManifestHandler{}
@@ -80,17 +86,14 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 
 	blobsService := ms.repository.Blobs(ctx)
 
-	for _, descriptor := range mnfst.References() {
+	references := mnfst.References()
+	resolved := resolveReferences(references, ms.referenceConcurrency, func(descriptor distribution.Descriptor) error {
 		var err error
 
 		switch descriptor.MediaType {
 		case v1.MediaTypeImageLayer, v1.MediaTypeImageLayerGzip, v1.MediaTypeImageLayerNonDistributable, v1.MediaTypeImageLayerNonDistributableGzip:
-			allow := ms.manifestURLs.allow
-			deny := ms.manifestURLs.deny
 			for _, u := range descriptor.URLs {
-				var pu *url.URL
-				pu, err = url.Parse(u)
-				if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Fragment != "" || (allow != nil && !allow.MatchString(u)) || (deny != nil && deny.MatchString(u)) {
+				if !ms.manifestURLs.valid(u) {
 					err = errInvalidURL
 					break
 				}
@@ -115,13 +118,17 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 			}
 		}
 
+		return err
+	})
+
+	for i, err := range resolved {
 		if err != nil {
 			if err != distribution.ErrBlobUnknown {
 				errs = append(errs, err)
 			}
 
 			// On error here, we always append unknown blob errors.
-			errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: descriptor.Digest})
+			errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: references[i].Digest})
 		}
 	}
 
@@ -129,5 +136,14 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 		return errs
 	}
 
+	if ms.validateConfig {
+		if err := verifyConfig(ctx, blobsService, mnfst.Config); err != nil {
+			if _, ok := err.(distribution.ErrManifestConfigInvalid); ok {
+				return distribution.ErrManifestVerification{err}
+			}
+			return err
+		}
+	}
+
 	return nil
 }
@@ -36,6 +36,13 @@ const (
 //								-> <algorithm>/<hex digest>/link
 // 					-> _layers/
 // 						<layer links to blob store>
+// 					-> _metadata/data
+// 					-> _events/
+// 						<first event id of each segment>
+// 					-> _tagindex/
+// 						data
+// 						generation
+// 					-> _foreign/<algorithm>/<hex digest>/<algorithm>/<hex manifest digest>/data
 // 					-> _uploads/<id>
 // 						data
 // 						startedat
@@ -58,6 +65,12 @@ const (
 // Abandoned uploads can be garbage collected by reading the startedat file
 // and removing uploads that have been active for longer than a certain time.
 //
+// Storage migrated to the sharded layout fans out the layer links and uploads
+// of a repository, which may number in the thousands, over two levels of
+// directories named after the first bytes of their digest or id. Paths of the
+// flat layout are still read, as links and uploads written before the
+// migration may remain there.
+//
 // The third component of the repository directory is the manifests store,
 // which is made up of a revision store and tag store. Manifests are stored in
 // the blob store and linked into the revision store.
@@ -84,9 +97,25 @@ const (
 // 	manifestTagIndexEntryPathSpec:         <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/
 // 	manifestTagIndexEntryLinkPathSpec:     <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/link
 //
+//	Referrers:
+//
+// 	manifestReferrersPathSpec:     <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/
+// 	manifestReferrerLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/<algorithm>/<hex digest>/link
+//
 // 	Blobs:
 //
 // 	layerLinkPathSpec:            <root>/v2/repositories/<name>/_layers/<algorithm>/<hex digest>/link
+// 	layerLinkPathSpec (sharded):  <root>/v2/repositories/<name>/_layers/<algorithm>/<first two hex bytes of digest>/<next two>/<hex digest>/link
+//
+//	Metadata:
+//
+// 	repositoryMetadataPathSpec:   <root>/v2/repositories/<name>/_metadata/data
+// 	repositoryEventsPathSpec:     <root>/v2/repositories/<name>/_events/
+// 	repositoryEventSegmentPathSpec: <root>/v2/repositories/<name>/_events/<first event id>
+// 	repositoryTagIndexPathSpec:   <root>/v2/repositories/<name>/_tagindex/data
+// 	repositoryTagIndexGenerationPathSpec: <root>/v2/repositories/<name>/_tagindex/generation
+// 	foreignLayersPathSpec:        <root>/v2/repositories/<name>/_foreign/
+// 	foreignLayerPathSpec:         <root>/v2/repositories/<name>/_foreign/<algorithm>/<hex digest>/<algorithm>/<hex manifest digest>/data
 //
 //	Uploads:
 //
@@ -94,6 +123,8 @@ const (
 // 	uploadStartedAtPathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/startedat
 // 	uploadHashStatePathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/hashstates/<algorithm>/<offset>
 //
+// Sharded uploads are kept in <root>/v2/repositories/<name>/_uploads/<first two characters of id>/<next two>/<id>/.
+//
 //	Blob Store:
 //
 //	blobsPathSpec:                  <root>/v2/blobs/
@@ -101,6 +132,19 @@ const (
 // 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 // 	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
+//	Reference Index:
+//
+// 	blobReferencesPathSpec:        <root>/v2/references/<algorithm>/<first two hex bytes of digest>/<hex digest>/
+// 	blobReferenceLinkPathSpec:     <root>/v2/references/<algorithm>/<first two hex bytes of digest>/<hex digest>/<name>/_manifests/<algorithm>/<hex digest>/link
+// 	referencesRootPathSpec:        <root>/v2/references/
+// 	referenceIndexCompletePathSpec: <root>/v2/referenceindex/complete
+// 	referenceIndexRebuildPathSpec: <root>/v2/referenceindex/rebuild
+//
+//	Intent Log:
+//
+// 	intentsPathSpec:               <root>/v2/intents/
+// 	intentPathSpec:                <root>/v2/intents/<id>
+//
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
 func pathFor(spec pathSpec) (string, error) {
@@ -120,6 +164,15 @@ func pathFor(spec pathSpec) (string, error) {
 	rootPrefix := []string{storagePathRoot, storagePathVersion}
 	repoPrefix := append(rootPrefix, "repositories")
 
+	uploadPrefix := func(name, id string, sharded bool) []string {
+		components := append([]string{}, repoPrefix...)
+		components = append(components, name, "_uploads")
+		if sharded {
+			components = append(components, shardComponents(id)...)
+		}
+		return append(components, id)
+	}
+
 	switch v := spec.(type) {
 
 	case manifestRevisionsPathSpec:
@@ -176,6 +229,31 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "link"), nil
+	case manifestReferrersPathSpec:
+		if v.subject == "" {
+			return path.Join(append(repoPrefix, v.name, "_manifests", "referrers")...), nil
+		}
+		components, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(repoPrefix, v.name, "_manifests", "referrers"), components...)...), nil
+	case manifestReferrerLinkPathSpec:
+		root, err := pathFor(manifestReferrersPathSpec{
+			name:    v.name,
+			subject: v.subject,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append([]string{root}, components...), "link")...), nil
 	case manifestTagIndexEntryPathSpec:
 		root, err := pathFor(manifestTagIndexPathSpec{
 			name: v.name,
@@ -197,6 +275,11 @@ func pathFor(spec pathSpec) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if v.sharded {
+			hex := components[len(components)-1]
+			components = append(components[:len(components)-1], shardComponents(hex)...)
+			components = append(components, hex)
+		}
 
 		// TODO(stevvooe): Right now, all blobs are linked under "_layers". If
 		// we have future migrations, we may want to rename this to "_blobs".
@@ -226,17 +309,78 @@ func pathFor(spec pathSpec) (string, error) {
 		components = append(components, "data")
 		blobPathPrefix := append(rootPrefix, "blobs")
 		return path.Join(append(blobPathPrefix, components...)...), nil
+	case blobReferencesPathSpec:
+		components, err := digestPathComponents(v.digest, true)
+		if err != nil {
+			return "", err
+		}
+
+		referencesPathPrefix := append(rootPrefix, "references")
+		return path.Join(append(referencesPathPrefix, components...)...), nil
+	case referencesRootPathSpec:
+		return path.Join(append(rootPrefix, "references")...), nil
+	case referenceIndexCompletePathSpec:
+		return path.Join(append(rootPrefix, "referenceindex", "complete")...), nil
+	case referenceIndexRebuildPathSpec:
+		return path.Join(append(rootPrefix, "referenceindex", "rebuild")...), nil
+	case blobReferenceLinkPathSpec:
+		components, err := digestPathComponents(v.digest, true)
+		if err != nil {
+			return "", err
+		}
+		manifestComponents, err := digestPathComponents(v.manifest, false)
+		if err != nil {
+			return "", err
+		}
+
+		components = append(append(append(rootPrefix, "references"), components...), v.name, "_manifests")
+		return path.Join(append(append(components, manifestComponents...), "link")...), nil
+
+	case intentsPathSpec:
+		return path.Join(append(rootPrefix, "intents")...), nil
+	case intentPathSpec:
+		return path.Join(append(rootPrefix, "intents", v.id)...), nil
+	case repositoryMetadataPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_metadata", "data")...), nil
+	case repositoryEventsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_events")...), nil
+	case repositoryEventSegmentPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_events", fmt.Sprintf("%020d", v.first))...), nil
+	case repositoryTagIndexPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_tagindex", "data")...), nil
+	case repositoryTagIndexGenerationPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_tagindex", "generation")...), nil
+	case foreignLayersPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_foreign")...), nil
+	case foreignLayerPathSpec:
+		root, err := pathFor(foreignLayersPathSpec{name: v.name})
+		if err != nil {
+			return "", err
+		}
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+		if v.manifest == "" {
+			// the records of the layer, by manifest
+			return path.Join(append([]string{root}, components...)...), nil
+		}
+		manifestComponents, err := digestPathComponents(v.manifest, false)
+		if err != nil {
+			return "", err
+		}
 
+		return path.Join(append(append(append([]string{root}, components...), manifestComponents...), "data")...), nil
 	case uploadDataPathSpec:
-		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "data")...), nil
+		return path.Join(append(uploadPrefix(v.name, v.id, v.sharded), "data")...), nil
 	case uploadStartedAtPathSpec:
-		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "startedat")...), nil
+		return path.Join(append(uploadPrefix(v.name, v.id, v.sharded), "startedat")...), nil
 	case uploadHashStatePathSpec:
 		offset := fmt.Sprintf("%d", v.offset)
 		if v.list {
 			offset = "" // Limit to the prefix for listing offsets.
 		}
-		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
+		return path.Join(append(uploadPrefix(v.name, v.id, v.sharded), "hashstates", string(v.alg), offset)...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
 	default:
@@ -335,6 +479,26 @@ type manifestTagIndexEntryLinkPathSpec struct {
 
 func (manifestTagIndexEntryLinkPathSpec) pathSpec() {}
 
+// manifestReferrersPathSpec describes the directory of the links to the
+// manifests referring to the subject manifest, or to any manifest of the
+// repository if subject is empty.
+type manifestReferrersPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (manifestReferrersPathSpec) pathSpec() {}
+
+// manifestReferrerLinkPathSpec describes the link to the revision of a
+// manifest referring to the subject manifest.
+type manifestReferrerLinkPathSpec struct {
+	name     string
+	subject  digest.Digest
+	revision digest.Digest
+}
+
+func (manifestReferrerLinkPathSpec) pathSpec() {}
+
 // blobLinkPathSpec specifies a path for a blob link, which is a file with a
 // blob id. The blob link will contain a content addressable blob id reference
 // into the blob store. The format of the contents is as follows:
@@ -346,10 +510,12 @@ func (manifestTagIndexEntryLinkPathSpec) pathSpec() {}
 // 	sha256:96443a84ce518ac22acb2e985eda402b58ac19ce6f91980bde63726a79d80b36
 //
 // This  indicates that there is a blob with the id/digest, calculated via
-// sha256 that can be fetched from the blob store.
+// sha256 that can be fetched from the blob store. If sharded is set, the link
+// is located in the sharded layout.
 type layerLinkPathSpec struct {
-	name   string
-	digest digest.Digest
+	name    string
+	digest  digest.Digest
+	sharded bool
 }
 
 func (layerLinkPathSpec) pathSpec() {}
@@ -383,15 +549,130 @@ type blobDataPathSpec struct {
 
 func (blobDataPathSpec) pathSpec() {}
 
+// blobReferencesPathSpec defines the directory holding the entries of the
+// reference index for a blob.
+type blobReferencesPathSpec struct {
+	digest digest.Digest
+}
+
+func (blobReferencesPathSpec) pathSpec() {}
+
+// blobReferenceLinkPathSpec defines the path of the entry of the reference
+// index recording that the manifest of the named repository references the
+// blob. The repository name comes before a "_manifests" component, which no
+// repository name may contain.
+type blobReferenceLinkPathSpec struct {
+	digest   digest.Digest
+	name     string
+	manifest digest.Digest
+}
+
+func (blobReferenceLinkPathSpec) pathSpec() {}
+
+// referencesRootPathSpec defines the root directory of the reference index.
+type referencesRootPathSpec struct{}
+
+func (referencesRootPathSpec) pathSpec() {}
+
+// referenceIndexCompletePathSpec defines the path of the file marking the
+// reference index as complete, holding the id of the rebuild which
+// completed it.
+type referenceIndexCompletePathSpec struct{}
+
+func (referenceIndexCompletePathSpec) pathSpec() {}
+
+// referenceIndexRebuildPathSpec defines the path of the file holding the id
+// of the rebuild of the reference index in progress.
+type referenceIndexRebuildPathSpec struct{}
+
+func (referenceIndexRebuildPathSpec) pathSpec() {}
+
 // uploadDataPathSpec defines the path parameters of the data file for
 // uploads.
 type uploadDataPathSpec struct {
-	name string
-	id   string
+	name    string
+	id      string
+	sharded bool
 }
 
 func (uploadDataPathSpec) pathSpec() {}
 
+// foreignLayersPathSpec defines the directory of the layers stored outside
+// of the registry, referenced by the manifests of a repository.
+type foreignLayersPathSpec struct {
+	name string
+}
+
+func (foreignLayersPathSpec) pathSpec() {}
+
+// foreignLayerPathSpec defines the path of the json descriptor of a layer
+// stored outside of the registry, recorded for each manifest of a
+// repository referencing it. Without a manifest, it defines the directory of
+// the records of the layer.
+type foreignLayerPathSpec struct {
+	name     string
+	digest   digest.Digest
+	manifest digest.Digest
+}
+
+func (foreignLayerPathSpec) pathSpec() {}
+
+// intentsPathSpec defines the path of the directory holding the intents of
+// the mutations in progress.
+type intentsPathSpec struct{}
+
+func (intentsPathSpec) pathSpec() {}
+
+// intentPathSpec defines the path of the json document recording the intent
+// of a mutation of several paths.
+type intentPathSpec struct {
+	id string
+}
+
+func (intentPathSpec) pathSpec() {}
+
+// repositoryMetadataPathSpec defines the path of the json document holding the
+// metadata of a repository.
+type repositoryMetadataPathSpec struct {
+	name string
+}
+
+func (repositoryMetadataPathSpec) pathSpec() {}
+
+// repositoryEventsPathSpec defines the path of the directory holding the
+// segments of the timeline of the events of a repository.
+type repositoryEventsPathSpec struct {
+	name string
+}
+
+func (repositoryEventsPathSpec) pathSpec() {}
+
+// repositoryEventSegmentPathSpec defines the path of the json document holding
+// a segment of the timeline of a repository, named by its first event id so
+// that segments sort in the order of the timeline.
+type repositoryEventSegmentPathSpec struct {
+	name  string
+	first int64
+}
+
+func (repositoryEventSegmentPathSpec) pathSpec() {}
+
+// repositoryTagIndexPathSpec defines the path of the json document mapping
+// the tags of a repository to their current manifest.
+type repositoryTagIndexPathSpec struct {
+	name string
+}
+
+func (repositoryTagIndexPathSpec) pathSpec() {}
+
+// repositoryTagIndexGenerationPathSpec defines the path of the generation of
+// the tags of a repository, which changes whenever they are written.
+type repositoryTagIndexGenerationPathSpec struct {
+	name string
+}
+
+func (repositoryTagIndexGenerationPathSpec) pathSpec() {}
+
 // uploadDataPathSpec defines the path parameters for the file that stores the
 // start time of an uploads. If it is missing, the upload is considered
 // unknown. Admittedly, the presence of this file is an ugly hack to make sure
@@ -400,8 +681,9 @@ func (uploadDataPathSpec) pathSpec() {}
 // should remove this file immediately and rely on the startetAt field from
 // the client to enforce time out policies.
 type uploadStartedAtPathSpec struct {
-	name string
-	id   string
+	name    string
+	id      string
+	sharded bool
 }
 
 func (uploadStartedAtPathSpec) pathSpec() {}
@@ -409,13 +691,15 @@ func (uploadStartedAtPathSpec) pathSpec() {}
 // uploadHashStatePathSpec defines the path parameters for the file that stores
 // the hash function state of an upload at a specific byte offset. If `list` is
 // set, then the path mapper will generate a list prefix for all hash state
-// offsets for the upload identified by the name, id, and alg.
+// offsets for the upload identified by the name, id, and alg. As for the other
+// upload path specs, sharded locates the upload in the sharded layout.
 type uploadHashStatePathSpec struct {
-	name   string
-	id     string
-	alg    digest.Algorithm
-	offset int64
-	list   bool
+	name    string
+	id      string
+	alg     digest.Algorithm
+	offset  int64
+	list    bool
+	sharded bool
 }
 
 func (uploadHashStatePathSpec) pathSpec() {}
@@ -456,6 +740,16 @@ func digestPathComponents(dgst digest.Digest, multilevel bool) ([]string, error)
 	return append(prefix, suffix...), nil
 }
 
+// shardComponents returns the directories under which the sharded layout
+// places the entry named by id, a hex digest or an upload id. Ids too short
+// to be sharded are not.
+func shardComponents(id string) []string {
+	if len(id) < 4 {
+		return nil
+	}
+	return []string{id[:2], id[2:4]}
+}
+
 // Reconstructs a digest from a path
 func digestFromPath(digestPath string) (digest.Digest, error) {
 
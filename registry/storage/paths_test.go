@@ -69,6 +69,39 @@ func TestPathMapper(t *testing.T) {
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/index/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
 
+		{
+			spec: repositoryMetadataPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_metadata/data",
+		},
+		{
+			spec: repositoryEventsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_events",
+		},
+		{
+			spec: repositoryEventSegmentPathSpec{
+				name:  "foo/bar",
+				first: 42,
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_events/00000000000000000042",
+		},
+		{
+			spec: blobReferencesPathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/references/sha256/ab/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+		},
+		{
+			spec: blobReferenceLinkPathSpec{
+				digest:   "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				name:     "foo/bar",
+				manifest: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+			expected: "/docker/registry/v2/references/sha256/ab/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/foo/bar/_manifests/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef/link",
+		},
 		{
 			spec: uploadDataPathSpec{
 				name: "foo/bar",
@@ -83,6 +116,24 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/asdf-asdf-asdf-adsf/startedat",
 		},
+		{
+			spec: uploadHashStatePathSpec{
+				name:    "foo/bar",
+				id:      "asdf-asdf-asdf-adsf",
+				alg:     digest.SHA256,
+				offset:  42,
+				sharded: true,
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/as/df/asdf-asdf-asdf-adsf/hashstates/sha256/42",
+		},
+		{
+			spec: layerLinkPathSpec{
+				name:    "foo/bar",
+				digest:  "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				sharded: true,
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_layers/sha256/ab/cd/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
+		},
 	} {
 		p, err := pathFor(testcase.spec)
 		if err != nil {
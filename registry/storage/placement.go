@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// PlacementRule assigns the blobs of repositories to a storage class based on
+// the repository names. Rules are applied by TierBlobs, so that placing blobs,
+// which copies them onto themselves, is kept off the push path.
+type PlacementRule struct {
+	// Repository matches the names of repositories the rule applies to.
+	Repository *regexp.Regexp
+
+	// StorageClass is the storage class blobs matching the rule are placed
+	// in.
+	StorageClass string
+}
+
+// placedClasses returns the storage classes the placement rules select for
+// the blobs linked by the repositories of registry. A blob linked by
+// repositories matching several rules is placed by the first of them.
+func placedClasses(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, rules []PlacementRule) (map[digest.Digest]string, error) {
+	enumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+	repositoriesRoot, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	placed := make(map[digest.Digest]int)
+	err = enumerator.Enumerate(ctx, func(name string) error {
+		rule := -1
+		for i := range rules {
+			if rules[i].Repository.MatchString(name) {
+				rule = i
+				break
+			}
+		}
+		if rule < 0 {
+			return nil
+		}
+
+		// layer links are <algorithm>/<hex digest>/link, or
+		// <algorithm>/<shards>/<hex digest>/link once sharded
+		root := path.Join(repositoriesRoot, name, "_layers")
+		err := storageDriver.Walk(ctx, root, func(fileInfo storagedriver.FileInfo) error {
+			parts := strings.Split(strings.TrimPrefix(fileInfo.Path(), root+"/"), "/")
+			if fileInfo.IsDir() || len(parts) < 3 || parts[len(parts)-1] != "link" {
+				return nil
+			}
+			dgst, err := digest.Parse(parts[0] + ":" + parts[len(parts)-2])
+			if err != nil {
+				return nil
+			}
+			if placedBy, ok := placed[dgst]; !ok || rule < placedBy {
+				placed[dgst] = rule
+			}
+			return nil
+		})
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	classes := make(map[digest.Digest]string, len(placed))
+	for dgst, rule := range placed {
+		classes[dgst] = rules[rule].StorageClass
+	}
+	return classes, nil
+}
+
+// BlobAccessStats provides the access history of blobs, from which TierBlobs
+// predicts whether a blob is likely to be pulled again.
+type BlobAccessStats interface {
+	// BlobAccess returns the time the blob was last pulled and the number
+	// of pulls recorded for it. A zero time is returned for blobs without
+	// recorded pulls.
+	BlobAccess(ctx context.Context, dgst digest.Digest) (lastPulled time.Time, pulls int64, err error)
+}
+
+// TieringOpts configures TierBlobs.
+type TieringOpts struct {
+	// HotClass is the storage class of frequently pulled blobs.
+	HotClass string
+
+	// ColdClass is the storage class of rarely pulled blobs.
+	ColdClass string
+
+	// DemoteAfter is the period without pulls after which a blob is moved
+	// to the cold class.
+	DemoteAfter time.Duration
+
+	// PromotePulls is the number of pulls after which a cold blob which has
+	// been pulled within DemoteAfter is moved back to the hot class. Cold
+	// blobs are never promoted if it is zero.
+	PromotePulls int64
+
+	// Stats provides the pull history of blobs. If nil, the modification
+	// time of a blob is taken as its last access and blobs are only ever
+	// demoted.
+	Stats BlobAccessStats
+
+	// Rules place the blobs linked by the repositories they match in their
+	// storage class, instead of moving them between the hot and cold
+	// classes.
+	Rules []PlacementRule
+
+	// DryRun reports the blobs which would be moved without moving them.
+	DryRun bool
+}
+
+// TieringResult summarizes the blobs moved by TierBlobs.
+type TieringResult struct {
+	Placed   []digest.Digest
+	Promoted []digest.Digest
+	Demoted  []digest.Digest
+}
+
+// TierBlobs walks all blobs of the registry and moves the blobs of
+// repositories matching the placement rules to the storage class of their
+// rule, and the other blobs between the hot and cold storage classes based on
+// their access history. Blobs are only moved between the hot and cold classes
+// if both are set.
+func TierBlobs(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, opts TieringOpts) (TieringResult, error) {
+	var result TieringResult
+
+	classer, ok := storageDriver.(storagedriver.StorageClasser)
+	if !ok {
+		return result, storagedriver.ErrUnsupportedMethod{DriverName: storageDriver.Name()}
+	}
+
+	var placed map[digest.Digest]string
+	if len(opts.Rules) > 0 {
+		var err error
+		if placed, err = placedClasses(ctx, storageDriver, registry, opts.Rules); err != nil {
+			return result, err
+		}
+	}
+	tiering := opts.HotClass != "" && opts.ColdClass != ""
+
+	now := time.Now()
+	err := registry.Blobs().Enumerate(ctx, func(dgst digest.Digest) error {
+		placedClass, isPlaced := placed[dgst]
+		if !isPlaced && !tiering {
+			return nil
+		}
+
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			return err
+		}
+
+		class, err := classer.GetStorageClass(ctx, blobPath)
+		if err != nil {
+			return err
+		}
+
+		var target string
+		if isPlaced {
+			// moving a blob copies it onto itself, which is not free
+			if class == placedClass {
+				return nil
+			}
+			target = placedClass
+			result.Placed = append(result.Placed, dgst)
+		} else {
+			lastAccess, pulls, err := blobAccess(ctx, storageDriver, opts.Stats, dgst, blobPath)
+			if err != nil {
+				return err
+			}
+
+			idle := now.Sub(lastAccess) > opts.DemoteAfter
+			switch {
+			case class != opts.ColdClass && idle:
+				target = opts.ColdClass
+				result.Demoted = append(result.Demoted, dgst)
+			case class == opts.ColdClass && !idle && opts.PromotePulls > 0 && pulls >= opts.PromotePulls:
+				target = opts.HotClass
+				result.Promoted = append(result.Promoted, dgst)
+			default:
+				return nil
+			}
+		}
+
+		dcontext.GetLogger(ctx).Infof("moving blob %s from storage class %q to %q", dgst, class, target)
+		if opts.DryRun {
+			return nil
+		}
+		return classer.SetStorageClass(ctx, blobPath, target)
+	})
+
+	return result, err
+}
+
+// blobAccess returns the last access time and pull count of a blob, falling
+// back to its modification time if no pulls have been recorded.
+func blobAccess(ctx context.Context, storageDriver storagedriver.StorageDriver, stats BlobAccessStats, dgst digest.Digest, blobPath string) (time.Time, int64, error) {
+	var (
+		lastAccess time.Time
+		pulls      int64
+	)
+
+	if stats != nil {
+		var err error
+		lastAccess, pulls, err = stats.BlobAccess(ctx, dgst)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+	}
+
+	if lastAccess.IsZero() {
+		fi, err := storageDriver.Stat(ctx, blobPath)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		lastAccess = fi.ModTime()
+	}
+
+	return lastAccess, pulls, nil
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/testdriver"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+// classingDriver records storage classes of objects on top of another
+// driver. Objects default to the "STANDARD" class.
+type classingDriver struct {
+	storagedriver.StorageDriver
+
+	mu      sync.Mutex
+	classes map[string]string
+	moves   int
+}
+
+func newClassingDriver() *classingDriver {
+	return &classingDriver{
+		StorageDriver: testdriver.New(),
+		classes:       make(map[string]string),
+	}
+}
+
+func (d *classingDriver) GetStorageClass(ctx context.Context, path string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if class, ok := d.classes[path]; ok {
+		return class, nil
+	}
+	return "STANDARD", nil
+}
+
+func (d *classingDriver) SetStorageClass(ctx context.Context, path string, class string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.classes[path] = class
+	d.moves++
+	return nil
+}
+
+type fakeAccessStats map[digest.Digest]int64
+
+func (s fakeAccessStats) BlobAccess(ctx context.Context, dgst digest.Digest) (time.Time, int64, error) {
+	pulls, ok := s[dgst]
+	if !ok {
+		return time.Time{}, 0, nil
+	}
+	return time.Now(), pulls, nil
+}
+
+func uploadRandomLayer(t *testing.T, ctx context.Context, driver storagedriver.StorageDriver, name string, options ...RegistryOption) digest.Digest {
+	registry, err := NewRegistry(ctx, driver, options...)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	named, _ := reference.WithName(name)
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("error creating layer: %v", err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatalf("error uploading layer: %v", err)
+	}
+	for dgst := range layers {
+		return dgst
+	}
+	return ""
+}
+
+func TestBlobPlacementRules(t *testing.T) {
+	ctx := context.Background()
+	driver := newClassingDriver()
+
+	placed := uploadRandomLayer(t, ctx, driver, "ci/build")
+	unplaced := uploadRandomLayer(t, ctx, driver, "base/alpine")
+	if driver.moves != 0 {
+		t.Fatalf("blobs were moved %d times while pushed", driver.moves)
+	}
+
+	registry, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	opts := TieringOpts{
+		Rules: []PlacementRule{
+			{Repository: regexp.MustCompile(`^ci/`), StorageClass: "STANDARD_IA"},
+		},
+		DryRun: true,
+	}
+
+	result, err := TierBlobs(ctx, driver, registry, opts)
+	if err != nil {
+		t.Fatalf("unexpected error tiering blobs: %v", err)
+	}
+	if len(result.Placed) != 1 || result.Placed[0] != placed || driver.moves != 0 {
+		t.Fatalf("unexpected dry run result: %#v, %d moves", result, driver.moves)
+	}
+
+	opts.DryRun = false
+	if _, err := TierBlobs(ctx, driver, registry, opts); err != nil {
+		t.Fatalf("unexpected error tiering blobs: %v", err)
+	}
+	for dgst, expected := range map[digest.Digest]string{placed: "STANDARD_IA", unplaced: "STANDARD"} {
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		class, _ := driver.GetStorageClass(ctx, blobPath)
+		if class != expected {
+			t.Errorf("unexpected storage class for %s: %q != %q", dgst, class, expected)
+		}
+	}
+
+	// blobs already in the storage class of their rule are not moved again
+	result, err = TierBlobs(ctx, driver, registry, opts)
+	if err != nil {
+		t.Fatalf("unexpected error tiering blobs: %v", err)
+	}
+	if len(result.Placed) != 0 || driver.moves != 1 {
+		t.Errorf("placed blobs were moved again: %#v, %d moves", result, driver.moves)
+	}
+}
+
+func TestBlobPlacementRulesPrecedence(t *testing.T) {
+	ctx := context.Background()
+	driver := newClassingDriver()
+
+	shared := uploadRandomLayer(t, ctx, driver, "ci/build")
+	registry, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	named, _ := reference.WithName("base/alpine")
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	source, _ := reference.WithName("ci/build")
+	canonical, _ := reference.WithDigest(source, shared)
+	if _, err := repository.Blobs(ctx).Create(ctx, WithMountFrom(canonical)); err != nil {
+		if _, ok := err.(distribution.ErrBlobMounted); !ok {
+			t.Fatalf("unexpected error mounting blob: %v", err)
+		}
+	}
+
+	// the blob linked by both repositories is placed by the first rule, and
+	// placed blobs are not tiered
+	result, err := TierBlobs(ctx, driver, registry, TieringOpts{
+		HotClass:    "STANDARD",
+		ColdClass:   "GLACIER",
+		DemoteAfter: -time.Hour,
+		Rules: []PlacementRule{
+			{Repository: regexp.MustCompile(`^base/`), StorageClass: "STANDARD"},
+			{Repository: regexp.MustCompile(`^ci/`), StorageClass: "STANDARD_IA"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error tiering blobs: %v", err)
+	}
+	if len(result.Placed) != 0 || len(result.Demoted) != 0 || driver.moves != 0 {
+		t.Fatalf("unexpected tiering result: %#v, %d moves", result, driver.moves)
+	}
+}
+
+func TestTierBlobs(t *testing.T) {
+	ctx := context.Background()
+	driver := newClassingDriver()
+
+	idle := uploadRandomLayer(t, ctx, driver, "foo/idle")
+	popular := uploadRandomLayer(t, ctx, driver, "foo/popular")
+	popularPath, _ := pathFor(blobDataPathSpec{digest: popular})
+	driver.SetStorageClass(ctx, popularPath, "GLACIER")
+
+	registry, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	opts := TieringOpts{
+		HotClass:     "STANDARD",
+		ColdClass:    "GLACIER",
+		DemoteAfter:  time.Hour,
+		PromotePulls: 2,
+		Stats:        fakeAccessStats{popular: 5},
+		DryRun:       true,
+	}
+
+	// Freshly written blobs are not idle yet.
+	result, err := TierBlobs(ctx, driver, registry, opts)
+	if err != nil {
+		t.Fatalf("unexpected error tiering blobs: %v", err)
+	}
+	if len(result.Demoted) != 0 || len(result.Promoted) != 1 || result.Promoted[0] != popular {
+		t.Fatalf("unexpected tiering result: %#v", result)
+	}
+	if class, _ := driver.GetStorageClass(ctx, popularPath); class != "GLACIER" {
+		t.Fatalf("dry run changed storage class to %q", class)
+	}
+
+	opts.DryRun = false
+	opts.DemoteAfter = -time.Hour
+	result, err = TierBlobs(ctx, driver, registry, opts)
+	if err != nil {
+		t.Fatalf("unexpected error tiering blobs: %v", err)
+	}
+	if len(result.Demoted) != 1 || result.Demoted[0] != idle || len(result.Promoted) != 0 {
+		t.Fatalf("unexpected tiering result: %#v", result)
+	}
+	idlePath, _ := pathFor(blobDataPathSpec{digest: idle})
+	if class, _ := driver.GetStorageClass(ctx, idlePath); class != "GLACIER" {
+		t.Fatalf("unexpected storage class for idle blob: %q", class)
+	}
+}
@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.BlobReferenceIndex = &registry{}
+
+// EnableReferenceIndex is a functional option for NewRegistry. It causes an
+// index of the manifests referencing each blob to be maintained as manifests
+// are pushed and deleted.
+func EnableReferenceIndex(registry *registry) error {
+	registry.referenceIndex = true
+	return nil
+}
+
+// BlobReferences lists the manifests referencing the blob from the reference
+// index. Entries of manifests which no longer exist, such as those removed by
+// garbage collection, are dropped from the index as they are found. The
+// index may miss manifests, and ErrReferenceIndexIncomplete is returned,
+// until RebuildReferenceIndex completes it.
+func (reg *registry) BlobReferences(ctx context.Context, dgst digest.Digest) ([]distribution.BlobReference, error) {
+	if !reg.referenceIndex {
+		return nil, distribution.ErrUnsupported
+	}
+	complete, err := referenceIndexIsComplete(ctx, reg.driver)
+	if err != nil {
+		return nil, err
+	}
+	if !complete {
+		return nil, distribution.ErrReferenceIndexIncomplete
+	}
+
+	referencesPath, err := pathFor(blobReferencesPathSpec{digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	err = reg.driver.Walk(ctx, referencesPath, func(fileInfo driver.FileInfo) error {
+		if !fileInfo.IsDir() && path.Base(fileInfo.Path()) == "link" {
+			links = append(links, fileInfo.Path())
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return []distribution.BlobReference{}, nil
+		}
+		return nil, err
+	}
+
+	references := []distribution.BlobReference{}
+	for _, link := range links {
+		name, manifest, ok := parseReferenceLink(strings.TrimPrefix(link, referencesPath+"/"))
+		if !ok {
+			continue
+		}
+		ref, found, err := reg.blobReference(ctx, name, manifest)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if err := reg.driver.Delete(ctx, path.Dir(link)); err != nil {
+				dcontext.GetLogger(ctx).Warnf("error removing stale reference of %s@%s to %s: %v", name, manifest, dgst, err)
+			}
+			continue
+		}
+		references = append(references, ref)
+	}
+
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Repository != references[j].Repository {
+			return references[i].Repository < references[j].Repository
+		}
+		return references[i].Manifest < references[j].Manifest
+	})
+	return references, nil
+}
+
+// blobReference describes the manifest of the named repository, reporting
+// whether it still exists.
+func (reg *registry) blobReference(ctx context.Context, name string, manifest digest.Digest) (distribution.BlobReference, bool, error) {
+	revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: name, revision: manifest})
+	if err != nil {
+		return distribution.BlobReference{}, false, err
+	}
+	if _, err := reg.driver.Stat(ctx, revisionPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return distribution.BlobReference{}, false, nil
+		}
+		return distribution.BlobReference{}, false, err
+	}
+
+	named, err := reg.nameValidator.WithName(name)
+	if err != nil {
+		return distribution.BlobReference{}, false, err
+	}
+	repository, err := reg.Repository(ctx, named)
+	if err != nil {
+		return distribution.BlobReference{}, false, err
+	}
+	tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: manifest})
+	if err != nil {
+		return distribution.BlobReference{}, false, err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return distribution.BlobReference{
+		Repository: name,
+		Manifest:   manifest,
+		Tags:       tags,
+	}, true, nil
+}
+
+// parseReferenceLink extracts the repository name and the manifest digest
+// from the path of an entry of the reference index, relative to the
+// directory of the blob.
+func parseReferenceLink(link string) (string, digest.Digest, bool) {
+	i := strings.LastIndex(link, "/_manifests/")
+	if i < 0 {
+		return "", "", false
+	}
+	components := strings.Split(strings.TrimSuffix(link[i+len("/_manifests/"):], "/link"), "/")
+	if len(components) != 2 {
+		return "", "", false
+	}
+	manifest := digest.NewDigestFromHex(components[0], components[1])
+	if err := manifest.Validate(); err != nil {
+		return "", "", false
+	}
+	return link[:i], manifest, true
+}
+
+// indexReferences records the blobs referenced by the manifest in the
+// reference index. Failing to do so does not fail the push, but marks the
+// index as incomplete until it is rebuilt, as it no longer covers all the
+// manifests.
+func (repo *repository) indexReferences(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) {
+	if !repo.referenceIndex {
+		return
+	}
+
+	if err := repo.writeReferences(ctx, dgst, manifest); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error indexing references of %s@%s, the reference index must be rebuilt: %v", repo.name.Name(), dgst, err)
+		if err := InvalidateReferenceIndex(ctx, repo.driver); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error marking the reference index incomplete: %v", err)
+		}
+	}
+}
+
+// writeReferences stores the entries of the manifest in the reference index.
+func (repo *repository) writeReferences(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) error {
+	for _, descriptor := range manifest.References() {
+		linkPath, err := pathFor(blobReferenceLinkPathSpec{digest: descriptor.Digest, name: repo.name.Name(), manifest: dgst})
+		if err != nil {
+			return err
+		}
+		if err := repo.driver.PutContent(ctx, linkPath, []byte(dgst)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexReferences removes the entries of the manifest from the reference
+// index.
+func (repo *repository) unindexReferences(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) {
+	if !repo.referenceIndex {
+		return
+	}
+
+	for _, descriptor := range manifest.References() {
+		linkPath, err := pathFor(blobReferenceLinkPathSpec{digest: descriptor.Digest, name: repo.name.Name(), manifest: dgst})
+		if err == nil {
+			err = repo.driver.Delete(ctx, path.Dir(linkPath))
+		}
+		if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+			dcontext.GetLogger(ctx).Warnf("error removing reference of %s@%s to %s: %v", repo.name.Name(), dgst, descriptor.Digest, err)
+		}
+	}
+}
+
+// referenceIndexIsComplete returns whether the reference index covers all
+// the manifests. It is checked on every query, as any instance may
+// invalidate the index.
+func referenceIndexIsComplete(ctx context.Context, storageDriver driver.StorageDriver) (bool, error) {
+	completePath, err := pathFor(referenceIndexCompletePathSpec{})
+	if err != nil {
+		return false, err
+	}
+	if _, err := storageDriver.Stat(ctx, completePath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// InvalidateReferenceIndex marks the reference index as incomplete, and
+// fails the rebuild in progress, if any. Registries not maintaining the
+// index call it as they start, as the manifests they accept are not
+// indexed.
+func InvalidateReferenceIndex(ctx context.Context, storageDriver driver.StorageDriver) error {
+	for _, spec := range []pathSpec{referenceIndexCompletePathSpec{}, referenceIndexRebuildPathSpec{}} {
+		p, err := pathFor(spec)
+		if err != nil {
+			return err
+		}
+		if err := storageDriver.Delete(ctx, p); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RebuildReferenceIndexOpts contains options for RebuildReferenceIndex.
+type RebuildReferenceIndexOpts struct {
+	// NameValidator checks the names of the repositories found in storage.
+	// If nil, the default constraints of reference.WithName apply.
+	NameValidator *reference.NameValidator
+}
+
+// RebuildReferenceIndex indexes the references of every manifest of the
+// registry, which must maintain the index, and marks the index complete.
+// Manifests pushed meanwhile are indexed as they are pushed. The rebuild
+// fails if indexing a pushed manifest fails meanwhile, or if a registry not
+// maintaining the index starts, and must then be run again.
+func RebuildReferenceIndex(ctx context.Context, storageDriver driver.StorageDriver, ns distribution.Namespace, opts RebuildReferenceIndexOpts) error {
+	reg, ok := ns.(*registry)
+	if !ok || !reg.referenceIndex {
+		return fmt.Errorf("the registry does not maintain the reference index")
+	}
+
+	if err := InvalidateReferenceIndex(ctx, storageDriver); err != nil {
+		return err
+	}
+	rebuildPath, err := pathFor(referenceIndexRebuildPathSpec{})
+	if err != nil {
+		return err
+	}
+	id := uuid.Generate().String()
+	if err := storageDriver.PutContent(ctx, rebuildPath, []byte(id)); err != nil {
+		return err
+	}
+
+	var manifestCount int
+	err = reg.Enumerate(ctx, func(repoName string) error {
+		named, err := opts.NameValidator.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repo, err := reg.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+		manifestService, err := repo.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+
+		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			manifest, err := manifestService.Get(ctx, dgst)
+			if err != nil {
+				if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+					// deleted meanwhile
+					return nil
+				}
+				return fmt.Errorf("failed to retrieve manifest %s@%s: %v", repoName, dgst, err)
+			}
+			if err := repo.(*repository).writeReferences(ctx, dgst, manifest); err != nil {
+				return fmt.Errorf("failed to index manifest %s@%s: %v", repoName, dgst, err)
+			}
+			manifestCount++
+			return nil
+		})
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			// a repository without manifests
+			return nil
+		}
+		return err
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		// no repositories yet
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	content, err := storageDriver.GetContent(ctx, rebuildPath)
+	if _, ok := err.(driver.PathNotFoundError); ok || (err == nil && string(content) != id) {
+		return fmt.Errorf("the reference index was invalidated during the rebuild, run it again")
+	}
+	if err != nil {
+		return err
+	}
+	completePath, err := pathFor(referenceIndexCompletePathSpec{})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.PutContent(ctx, completePath, []byte(id)); err != nil {
+		return err
+	}
+	if err := storageDriver.Delete(ctx, rebuildPath); err != nil {
+		return err
+	}
+	emit("%d manifests indexed, the reference index is complete", manifestCount)
+	return nil
+}
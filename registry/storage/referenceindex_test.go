@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestBlobReferences(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver, EnableReferenceIndex)
+	index := registry.(distribution.BlobReferenceIndex)
+	if err := RebuildReferenceIndex(ctx, inmemoryDriver, registry, RebuildReferenceIndexOpts{}); err != nil {
+		t.Fatalf("unexpected error rebuilding the reference index: %v", err)
+	}
+
+	repo := makeRepository(t, registry, "foo/app")
+	manifests, _ := repo.Manifests(ctx)
+	image1 := uploadRandomSchema2Image(t, repo)
+	image2 := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "v1", distribution.Descriptor{Digest: image1.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	manifestList, err := testutil.MakeManifestList(registry.BlobStatter(), []digest.Digest{image1.manifestDigest, image2.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to make manifest list: %v", err)
+	}
+	listDigest, err := manifests.Put(ctx, manifestList)
+	if err != nil {
+		t.Fatalf("failed to put manifest list: %v", err)
+	}
+
+	other := makeRepository(t, registry, "bar")
+	image3 := uploadRandomSchema2Image(t, other)
+
+	var layer digest.Digest
+	for dgst := range image1.layers {
+		layer = dgst
+	}
+	checkBlobReferences(t, index, layer, []distribution.BlobReference{
+		{Repository: "foo/app", Manifest: image1.manifestDigest, Tags: []string{"v1"}},
+	})
+	checkBlobReferences(t, index, image2.manifestDigest, []distribution.BlobReference{
+		{Repository: "foo/app", Manifest: listDigest, Tags: []string{}},
+	})
+	checkBlobReferences(t, index, digest.FromString("unknown"), []distribution.BlobReference{})
+
+	// Deleting a manifest removes its entries, and entries of manifests
+	// removed behind the back of the index are dropped when listed.
+	if err := manifests.Delete(ctx, image1.manifestDigest); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+	checkBlobReferences(t, index, layer, []distribution.BlobReference{})
+
+	for dgst := range image3.layers {
+		layer = dgst
+	}
+	if err := NewVacuum(ctx, inmemoryDriver).RemoveManifest("bar", image3.manifestDigest, nil); err != nil {
+		t.Fatalf("failed to remove manifest: %v", err)
+	}
+	checkBlobReferences(t, index, layer, []distribution.BlobReference{})
+	linkPath, _ := pathFor(blobReferenceLinkPathSpec{digest: layer, name: "bar", manifest: image3.manifestDigest})
+	if _, err := inmemoryDriver.Stat(ctx, linkPath); err == nil {
+		t.Fatal("expected the stale entry to be removed")
+	}
+}
+
+func checkBlobReferences(t *testing.T, index distribution.BlobReferenceIndex, dgst digest.Digest, expected []distribution.BlobReference) {
+	t.Helper()
+	references, err := index.BlobReferences(context.Background(), dgst)
+	if err != nil {
+		t.Fatalf("unexpected error listing references of %s: %v", dgst, err)
+	}
+	if len(references) != len(expected) {
+		t.Fatalf("expected %d references of %s, got %+v", len(expected), dgst, references)
+	}
+	for i, reference := range references {
+		if reference.Repository != expected[i].Repository || reference.Manifest != expected[i].Manifest || len(reference.Tags) != len(expected[i].Tags) {
+			t.Fatalf("expected %+v, got %+v", expected[i], reference)
+		}
+		for j := range reference.Tags {
+			if reference.Tags[j] != expected[i].Tags[j] {
+				t.Fatalf("expected %+v, got %+v", expected[i], reference)
+			}
+		}
+	}
+}
+
+func TestRebuildReferenceIndex(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	// manifests pushed through a registry not maintaining the index are
+	// missing from it until it is rebuilt
+	unindexed := uploadRandomSchema2Image(t, makeRepository(t, createRegistry(t, inmemoryDriver), "foo/app"))
+	var layer digest.Digest
+	for dgst := range unindexed.layers {
+		layer = dgst
+	}
+
+	registry := createRegistry(t, inmemoryDriver, EnableReferenceIndex)
+	index := registry.(distribution.BlobReferenceIndex)
+	if _, err := index.BlobReferences(ctx, layer); err != distribution.ErrReferenceIndexIncomplete {
+		t.Fatalf("expected ErrReferenceIndexIncomplete before the rebuild, got %v", err)
+	}
+
+	if err := RebuildReferenceIndex(ctx, inmemoryDriver, registry, RebuildReferenceIndexOpts{}); err != nil {
+		t.Fatalf("unexpected error rebuilding the reference index: %v", err)
+	}
+	checkBlobReferences(t, index, layer, []distribution.BlobReference{
+		{Repository: "foo/app", Manifest: unindexed.manifestDigest, Tags: []string{}},
+	})
+
+	// a registry starting without the index invalidates it
+	if err := InvalidateReferenceIndex(ctx, inmemoryDriver); err != nil {
+		t.Fatalf("unexpected error invalidating the reference index: %v", err)
+	}
+	if _, err := index.BlobReferences(ctx, layer); err != distribution.ErrReferenceIndexIncomplete {
+		t.Fatalf("expected ErrReferenceIndexIncomplete after invalidation, got %v", err)
+	}
+
+	if err := RebuildReferenceIndex(ctx, inmemoryDriver, createRegistry(t, inmemoryDriver), RebuildReferenceIndexOpts{}); err == nil {
+		t.Fatal("expected an error rebuilding through a registry not maintaining the index")
+	}
+}
+
+func TestBlobReferencesNameValidator(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	validator, err := reference.NewNameValidator(0, 0, "[A-Za-z0-9]+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := createRegistry(t, inmemoryDriver, EnableReferenceIndex, RepositoryNameValidator(validator))
+	if err := RebuildReferenceIndex(ctx, inmemoryDriver, registry, RebuildReferenceIndexOpts{NameValidator: validator}); err != nil {
+		t.Fatalf("unexpected error rebuilding the reference index: %v", err)
+	}
+
+	named, _ := validator.WithName("Team/App")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := uploadRandomSchema2Image(t, repo)
+	var layer digest.Digest
+	for dgst := range image.layers {
+		layer = dgst
+	}
+	checkBlobReferences(t, registry.(distribution.BlobReferenceIndex), layer, []distribution.BlobReference{
+		{Repository: "Team/App", Manifest: image.manifestDigest, Tags: []string{}},
+	})
+}
+
+func TestBlobReferencesDisabled(t *testing.T) {
+	registry := createRegistry(t, inmemory.New())
+	_, err := registry.(distribution.BlobReferenceIndex).BlobReferences(context.Background(), digest.FromString("unknown"))
+	if err != distribution.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/docker/distribution"
+)
+
+// defaultReferenceConcurrency is the number of manifest references looked up
+// at once unless configured otherwise.
+const defaultReferenceConcurrency = 8
+
+// resolveReferences calls resolve for each of the descriptors, running up to
+// concurrency calls at once, and returns the errors in the order of the
+// descriptors. Looking the references up together rather than one after the
+// other keeps the latency of verifying a manifest close to that of a single
+// lookup on backends where each request is slow.
+func resolveReferences(descriptors []distribution.Descriptor, concurrency int, resolve func(distribution.Descriptor) error) []error {
+	errs := make([]error, len(descriptors))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency == 1 || len(descriptors) < 2 {
+		for i, descriptor := range descriptors {
+			errs[i] = resolve(descriptor)
+		}
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, descriptor := range descriptors {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, descriptor distribution.Descriptor) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = resolve(descriptor)
+		}(i, descriptor)
+	}
+	wg.Wait()
+
+	return errs
+}
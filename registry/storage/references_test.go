@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestResolveReferences(t *testing.T) {
+	var descriptors []distribution.Descriptor
+	for i := 0; i < 20; i++ {
+		descriptors = append(descriptors, distribution.Descriptor{Digest: digest.FromBytes([]byte{byte(i)})})
+	}
+	missing := descriptors[7].Digest
+	errMissing := errors.New("missing")
+
+	for _, concurrency := range []int{0, 1, 4} {
+		var mu sync.Mutex
+		running, peak := 0, 0
+		errs := resolveReferences(descriptors, concurrency, func(descriptor distribution.Descriptor) error {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			if descriptor.Digest == missing {
+				return errMissing
+			}
+			return nil
+		})
+
+		if len(errs) != len(descriptors) {
+			t.Fatalf("concurrency %d: expected %d results, got %d", concurrency, len(descriptors), len(errs))
+		}
+		for i, err := range errs {
+			if i == 7 && err != errMissing {
+				t.Errorf("concurrency %d: expected error for reference 7, got %v", concurrency, err)
+			} else if i != 7 && err != nil {
+				t.Errorf("concurrency %d: unexpected error for reference %d: %v", concurrency, i, err)
+			}
+		}
+
+		limit := concurrency
+		if limit < 1 {
+			limit = 1
+		}
+		if peak > limit {
+			t.Errorf("concurrency %d: %d lookups ran at once", concurrency, peak)
+		}
+		if concurrency > 1 && peak < 2 {
+			t.Errorf("concurrency %d: lookups did not run concurrently", concurrency)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.ManifestReferrers = &manifestStore{}
+
+// manifestSubject returns the subject of the manifest, or nil if it has
+// none. Only OCI image manifests have a subject.
+func manifestSubject(manifest distribution.Manifest) *distribution.Descriptor {
+	if m, ok := manifest.(*ocischema.DeserializedManifest); ok {
+		return m.Subject
+	}
+	return nil
+}
+
+// linkReferrer links the manifest to its subject, if it has one, so that it
+// is listed among the referrers of the subject. The subject need not exist.
+func (repo *repository) linkReferrer(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) error {
+	subject := manifestSubject(manifest)
+	if subject == nil {
+		return nil
+	}
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{name: repo.name.Name(), subject: subject.Digest, revision: dgst})
+	if err != nil {
+		return err
+	}
+	return repo.driver.PutContent(ctx, linkPath, []byte(dgst))
+}
+
+// unlinkReferrer removes the link of the manifest to its subject.
+func (repo *repository) unlinkReferrer(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) {
+	subject := manifestSubject(manifest)
+	if subject == nil {
+		return
+	}
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{name: repo.name.Name(), subject: subject.Digest, revision: dgst})
+	if err == nil {
+		err = repo.driver.Delete(ctx, path.Dir(linkPath))
+	}
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		dcontext.GetLogger(ctx).Warnf("error removing referrer %s@%s of %s: %v", repo.name.Name(), dgst, subject.Digest, err)
+	}
+}
+
+// Referrers lists the manifests referring to subject. The links of
+// referrers which no longer exist, such as those removed by garbage
+// collection, are dropped as they are found.
+func (ms *manifestStore) Referrers(ctx context.Context, subject digest.Digest) ([]distribution.Referrer, error) {
+	referrersPath, err := pathFor(manifestReferrersPathSpec{name: ms.repository.Named().Name(), subject: subject})
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	err = ms.repository.driver.Walk(ctx, referrersPath, func(fileInfo driver.FileInfo) error {
+		if !fileInfo.IsDir() && path.Base(fileInfo.Path()) == "link" {
+			links = append(links, fileInfo.Path())
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return []distribution.Referrer{}, nil
+		}
+		return nil, err
+	}
+
+	referrers := []distribution.Referrer{}
+	for _, link := range links {
+		content, err := ms.repository.driver.GetContent(ctx, link)
+		if err != nil {
+			return nil, err
+		}
+		dgst, err := digest.Parse(string(content))
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := ms.Get(ctx, dgst)
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			if err := ms.repository.driver.Delete(ctx, path.Dir(link)); err != nil {
+				dcontext.GetLogger(ctx).Warnf("error removing stale referrer %s@%s of %s: %v", ms.repository.Named().Name(), dgst, subject, err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, describeReferrer(dgst, manifest))
+	}
+
+	sort.Slice(referrers, func(i, j int) bool {
+		return referrers[i].Digest < referrers[j].Digest
+	})
+	return referrers, nil
+}
+
+// describeReferrer describes the manifest dgst referring to a subject.
+func describeReferrer(dgst digest.Digest, manifest distribution.Manifest) distribution.Referrer {
+	mediaType, payload, _ := manifest.Payload()
+	referrer := distribution.Referrer{
+		Descriptor: distribution.Descriptor{
+			MediaType: mediaType,
+			Size:      int64(len(payload)),
+			Digest:    dgst,
+		},
+	}
+	if m, ok := manifest.(*ocischema.DeserializedManifest); ok {
+		referrer.Annotations = m.Annotations
+		referrer.ArtifactType = m.ArtifactType
+		if referrer.ArtifactType == "" {
+			referrer.ArtifactType = m.Config.MediaType
+		}
+	}
+	return referrer
+}
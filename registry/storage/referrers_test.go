@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// putReferrer pushes an artifact whose subject is the manifest dgst, and
+// returns its digest and the digest of its layer.
+func putReferrer(t *testing.T, repository distribution.Repository, subject digest.Digest, content string) (digest.Digest, digest.Digest) {
+	t.Helper()
+	ctx := context.Background()
+	blobs := repository.Blobs(ctx)
+	config, err := blobs.Put(ctx, "application/vnd.example.config+json", []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MediaType = "application/vnd.example.config+json"
+	layer, err := blobs.Put(ctx, "application/octet-stream", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer.MediaType = "application/octet-stream"
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: "application/vnd.example",
+		Config:       config,
+		Layers:       []distribution.Descriptor{layer},
+		Annotations:  map[string]string{"content": content},
+		Subject:      &distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: subject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := makeManifestService(t, repository).Put(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dgst, layer.Digest
+}
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+	repository := makeRepository(t, createRegistry(t, inmemory.New()), "foo/bar")
+	manifests := makeManifestService(t, repository).(distribution.ManifestReferrers)
+	image := uploadRandomSchema2Image(t, repository)
+
+	if referrers, err := manifests.Referrers(ctx, image.manifestDigest); err != nil || len(referrers) != 0 {
+		t.Fatalf("unexpected referrers %v: %v", referrers, err)
+	}
+	referrer, _ := putReferrer(t, repository, image.manifestDigest, "signature")
+	referrers, err := manifests.Referrers(ctx, image.manifestDigest)
+	if err != nil || len(referrers) != 1 {
+		t.Fatalf("unexpected referrers %v: %v", referrers, err)
+	}
+	if r := referrers[0]; r.Digest != referrer || r.MediaType != v1.MediaTypeImageManifest || r.ArtifactType != "application/vnd.example" || r.Annotations["content"] != "signature" {
+		t.Fatalf("unexpected referrer %+v", r)
+	}
+
+	if err := makeManifestService(t, repository).Delete(ctx, referrer); err != nil {
+		t.Fatal(err)
+	}
+	if referrers, err := manifests.Referrers(ctx, image.manifestDigest); err != nil || len(referrers) != 0 {
+		t.Fatalf("unexpected referrers after deletion %v: %v", referrers, err)
+	}
+}
+
+func TestGCReferrers(t *testing.T) {
+	testGCReferrers(t, false)
+}
+
+// TestGCReferrersIndexed collects the same garbage marking from the
+// reference index, without reading the manifests.
+func TestGCReferrersIndexed(t *testing.T) {
+	testGCReferrers(t, true)
+}
+
+func testGCReferrers(t *testing.T, indexed bool) {
+	ctx := context.Background()
+	d := inmemory.New()
+	var registry distribution.Namespace
+	if indexed {
+		registry = createRegistry(t, d, EnableReferenceIndex)
+		if err := RebuildReferenceIndex(ctx, d, registry, RebuildReferenceIndexOpts{}); err != nil {
+			t.Fatalf("unexpected error rebuilding the reference index: %v", err)
+		}
+	} else {
+		registry = createRegistry(t, d)
+	}
+	repository := makeRepository(t, registry, "foo/bar")
+	manifests := makeManifestService(t, repository)
+
+	tagged := uploadRandomSchema2Image(t, repository)
+	if err := repository.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	deleted := uploadRandomSchema2Image(t, repository)
+	kept, keptLayer := putReferrer(t, repository, tagged.manifestDigest, "kept")
+	// referrers of referrers are kept with their subject too
+	nested, _ := putReferrer(t, repository, kept, "nested")
+	orphan, orphanLayer := putReferrer(t, repository, deleted.manifestDigest, "orphan")
+	if err := manifests.Delete(ctx, deleted.manifestDigest); err != nil {
+		t.Fatal(err)
+	}
+
+	// untagged referrers live as long as their subject, whether or not
+	// untagged manifests are removed
+	for _, removeUntagged := range []bool{false, true} {
+		if err := MarkAndSweep(ctx, d, registry, GCOpts{RemoveUntagged: removeUntagged}); err != nil {
+			t.Fatalf("unexpected error collecting garbage: %v", err)
+		}
+		remaining := allManifests(t, manifests)
+		for _, dgst := range []digest.Digest{tagged.manifestDigest, kept, nested} {
+			if _, ok := remaining[dgst]; !ok {
+				t.Errorf("expected manifest %s to be kept", dgst)
+			}
+		}
+		if _, ok := remaining[orphan]; ok {
+			t.Error("expected the referrer of a deleted manifest to be removed")
+		}
+		blobs := allBlobs(t, registry)
+		for layer := range tagged.layers {
+			if _, ok := blobs[layer]; !ok {
+				t.Error("expected the layers of a tagged image to be marked")
+			}
+		}
+		for layer := range deleted.layers {
+			if _, ok := blobs[layer]; ok {
+				t.Error("expected the layers of a deleted image to be swept")
+			}
+		}
+		if _, ok := blobs[keptLayer]; !ok {
+			t.Error("expected the layer of a kept referrer to be marked")
+		}
+		if _, ok := blobs[orphanLayer]; ok {
+			t.Error("expected the layer of a removed referrer to be swept")
+		}
+	}
+
+	if err := repository.Tags(ctx).Untag(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkAndSweep(ctx, d, registry, GCOpts{RemoveUntagged: true}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if remaining := allManifests(t, manifests); len(remaining) != 0 {
+		t.Fatalf("expected the referrers to be removed with their subject, got %v", remaining)
+	}
+}
@@ -2,13 +2,17 @@ package storage
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 	"regexp"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/cache"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
 )
 
 // registry is the top-level implementation of Registry for use in the storage
@@ -25,6 +29,14 @@ type registry struct {
 	blobDescriptorServiceFactory distribution.BlobDescriptorServiceFactory
 	manifestURLs                 manifestURLs
 	driver                       storagedriver.StorageDriver
+	referenceConcurrency         int
+	configValidationEnabled      bool
+	shardedLayout                bool
+	events                       *eventLog
+	referenceIndex               bool
+	tagIndex                     *tagIndex
+	intentLog                    bool
+	nameValidator                *reference.NameValidator
 }
 
 // manifestURLs holds regular expressions for controlling manifest URL whitelisting
@@ -33,6 +45,16 @@ type manifestURLs struct {
 	deny  *regexp.Regexp
 }
 
+// valid returns true if u is an http or https URL without fragment, allowed
+// and not denied by the regular expressions.
+func (m manifestURLs) valid(u string) bool {
+	pu, err := url.Parse(u)
+	if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Fragment != "" {
+		return false
+	}
+	return (m.allow == nil || m.allow.MatchString(u)) && (m.deny == nil || !m.deny.MatchString(u))
+}
+
 // RegistryOption is the type used for functional options for NewRegistry.
 type RegistryOption func(*registry) error
 
@@ -80,6 +102,37 @@ func ManifestURLsDenyRegexp(r *regexp.Regexp) RegistryOption {
 	}
 }
 
+// ManifestReferenceConcurrency returns a functional option for NewRegistry.
+// It sets how many of the blobs and manifests referenced by a pushed manifest
+// are looked up at once while verifying it. Values below 1 keep the default.
+func ManifestReferenceConcurrency(n int) RegistryOption {
+	return func(registry *registry) error {
+		if n > 0 {
+			registry.referenceConcurrency = n
+		}
+		return nil
+	}
+}
+
+// RepositoryNameValidator returns a functional option for NewRegistry. It
+// sets the constraints checked by the names of the repositories the
+// registry opens on its own, such as while recovering intents or listing
+// references. If nil, the default constraints of reference.WithName apply.
+func RepositoryNameValidator(v *reference.NameValidator) RegistryOption {
+	return func(registry *registry) error {
+		registry.nameValidator = v
+		return nil
+	}
+}
+
+// EnableConfigValidation is a functional option for NewRegistry. It causes
+// the config blobs of pushed manifests to be checked against their declared
+// media type.
+func EnableConfigValidation(registry *registry) error {
+	registry.configValidationEnabled = true
+	return nil
+}
+
 // Schema1SigningKey returns a functional option for NewRegistry. It sets the
 // key for signing  all schema1 manifests.
 func Schema1SigningKey(key libtrust.PrivateKey) RegistryOption {
@@ -121,8 +174,18 @@ func BlobDescriptorCacheProvider(blobDescriptorCacheProvider cache.BlobDescripto
 // NewRegistry creates a new registry instance from the provided driver. The
 // resulting registry may be shared by multiple goroutines but is cheap to
 // allocate. If the Redirect option is specified, the backend blob server will
-// attempt to use (StorageDriver).URLFor to serve all blobs.
+// attempt to use (StorageDriver).URLFor to serve all blobs. Storage migrated
+// to a layout more recent than supported is refused.
 func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, options ...RegistryOption) (distribution.Namespace, error) {
+	layout, err := ReadLayout(ctx, driver)
+	if err != nil {
+		if _, ok := err.(ErrLayoutUnsupported); ok {
+			return nil, err
+		}
+		dcontext.GetLogger(ctx).Warnf("unable to read storage layout, assuming layout %d: %v", LayoutFlat, err)
+		layout = Layout{Version: LayoutFlat}
+	}
+
 	// create global statter
 	statter := &blobStatter{
 		driver: driver,
@@ -143,6 +206,8 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 		statter:                statter,
 		resumableDigestEnabled: true,
 		driver:                 driver,
+		referenceConcurrency:   defaultReferenceConcurrency,
+		shardedLayout:          layout.includes(LayoutSharded),
 	}
 
 	for _, option := range options {
@@ -189,6 +254,24 @@ func (reg *registry) BlobStatter() distribution.BlobStatter {
 	return reg.statter
 }
 
+var _ distribution.GlobalBlobServer = &registry{}
+
+// ServeGlobalBlob serves a blob of the registry, whether or not it is linked
+// into any repository.
+func (reg *registry) ServeGlobalBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
+	return reg.blobServer.ServeBlob(ctx, w, r, dgst)
+}
+
+// layerLinkPathFns returns the paths at which the layer links of repositories
+// are looked up. Once storage is migrated to the sharded layout, links are
+// written there and still read from the flat layout.
+func (reg *registry) layerLinkPathFns() []linkPathFunc {
+	if reg.shardedLayout {
+		return []linkPathFunc{shardedBlobLinkPath, blobLinkPath}
+	}
+	return []linkPathFunc{blobLinkPath}
+}
+
 // repository provides name-scoped access to various services.
 type repository struct {
 	*registry
@@ -215,12 +298,11 @@ func (repo *repository) Tags(ctx context.Context) distribution.TagService {
 // may be context sensitive in the future. The instance should be used similar
 // to a request local.
 func (repo *repository) Manifests(ctx context.Context, options ...distribution.ManifestServiceOption) (distribution.ManifestService, error) {
-	manifestLinkPathFns := []linkPathFunc{
+	manifestLinkPathFns := append([]linkPathFunc{
 		// NOTE(stevvooe): Need to search through multiple locations since
 		// 2.1.0 unintentionally linked into  _layers.
 		manifestRevisionLinkPath,
-		blobLinkPath,
-	}
+	}, repo.registry.layerLinkPathFns()...)
 
 	manifestDirectoryPathSpec := manifestRevisionsPathSpec{name: repo.name.Name()}
 
@@ -272,21 +354,26 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 		blobStore:      blobStore,
 		schema1Handler: v1Handler,
 		schema2Handler: &schema2ManifestHandler{
-			ctx:          ctx,
-			repository:   repo,
-			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			ctx:                  ctx,
+			repository:           repo,
+			blobStore:            blobStore,
+			manifestURLs:         repo.registry.manifestURLs,
+			referenceConcurrency: repo.registry.referenceConcurrency,
+			validateConfig:       repo.registry.configValidationEnabled,
 		},
 		manifestListHandler: &manifestListHandler{
-			ctx:        ctx,
-			repository: repo,
-			blobStore:  blobStore,
+			ctx:                  ctx,
+			repository:           repo,
+			blobStore:            blobStore,
+			referenceConcurrency: repo.registry.referenceConcurrency,
 		},
 		ocischemaHandler: &ocischemaManifestHandler{
-			ctx:          ctx,
-			repository:   repo,
-			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			ctx:                  ctx,
+			repository:           repo,
+			blobStore:            blobStore,
+			manifestURLs:         repo.registry.manifestURLs,
+			referenceConcurrency: repo.registry.referenceConcurrency,
+			validateConfig:       repo.registry.configValidationEnabled,
 		},
 	}
 
@@ -308,7 +395,7 @@ func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 	var statter distribution.BlobDescriptorService = &linkedBlobStatter{
 		blobStore:   repo.blobStore,
 		repository:  repo,
-		linkPathFns: []linkPathFunc{blobLinkPath},
+		linkPathFns: repo.registry.layerLinkPathFns(),
 	}
 
 	if repo.descriptorCache != nil {
@@ -329,8 +416,9 @@ func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 
 		// TODO(stevvooe): linkPath limits this blob store to only layers.
 		// This instance cannot be used for manifest checks.
-		linkPathFns:            []linkPathFunc{blobLinkPath},
+		linkPathFns:            repo.registry.layerLinkPathFns(),
 		deleteEnabled:          repo.registry.deleteEnabled,
 		resumableDigestEnabled: repo.resumableDigestEnabled,
+		shardedUploads:         repo.registry.shardedLayout,
 	}
 }
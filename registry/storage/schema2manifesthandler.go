@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/url"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -24,6 +23,13 @@ type schema2ManifestHandler struct {
 	blobStore    distribution.BlobStore
 	ctx          context.Context
 	manifestURLs manifestURLs
+
+	// referenceConcurrency bounds the lookups of referenced blobs.
+	referenceConcurrency int
+
+	// validateConfig enables checking the config blob against its media
+	// type.
+	validateConfig bool
 }
 
 var _ ManifestHandler = &schema2ManifestHandler{}
@@ -86,7 +92,8 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 
 	blobsService := ms.repository.Blobs(ctx)
 
-	for _, descriptor := range mnfst.References() {
+	references := mnfst.References()
+	resolved := resolveReferences(references, ms.referenceConcurrency, func(descriptor distribution.Descriptor) error {
 		var err error
 
 		switch descriptor.MediaType {
@@ -96,12 +103,8 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 			if len(descriptor.URLs) == 0 {
 				err = errMissingURL
 			}
-			allow := ms.manifestURLs.allow
-			deny := ms.manifestURLs.deny
 			for _, u := range descriptor.URLs {
-				var pu *url.URL
-				pu, err = url.Parse(u)
-				if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Fragment != "" || (allow != nil && !allow.MatchString(u)) || (deny != nil && deny.MatchString(u)) {
+				if !ms.manifestURLs.valid(u) {
 					err = errInvalidURL
 					break
 				}
@@ -121,13 +124,17 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 			}
 		}
 
+		return err
+	})
+
+	for i, err := range resolved {
 		if err != nil {
 			if err != distribution.ErrBlobUnknown {
 				errs = append(errs, err)
 			}
 
 			// On error here, we always append unknown blob errors.
-			errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: descriptor.Digest})
+			errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: references[i].Digest})
 		}
 	}
 
@@ -135,5 +142,14 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 		return errs
 	}
 
+	if ms.validateConfig {
+		if err := verifyConfig(ctx, blobsService, mnfst.Config); err != nil {
+			if _, ok := err.(distribution.ErrManifestConfigInvalid); ok {
+				return distribution.ErrManifestVerification{err}
+			}
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/go-metrics"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultSmallBlobThreshold = 64 << 10
+	defaultSmallBlobCacheSize = 64 << 20
+)
+
+var (
+	// smallBlobCount is the number of small blobs found in or missing from
+	// the cache, and stored through the fast path.
+	smallBlobCount = prometheus.StorageNamespace.NewLabeledCounter("small_blobs", "The number of small blob requests served through the fast path", "type")
+
+	// smallBlobCacheBytes is the size of the small blobs cached.
+	smallBlobCacheBytes = prometheus.StorageNamespace.NewGauge("small_blob_cache", "The size of the small blobs cached in memory", metrics.Bytes)
+)
+
+// SmallBlobs returns a functional option for NewRegistry. It stores blobs of
+// at most threshold bytes, such as manifests and configs, with a single
+// request to the storage driver, and keeps the content of up to size bytes of
+// them in memory. Blobs are immutable, so a cached blob is served without
+// reading it again. Values below 1 keep the defaults.
+func SmallBlobs(threshold, size int64) RegistryOption {
+	return func(registry *registry) error {
+		cache := newSmallBlobCache(threshold, size)
+		registry.blobStore.smallBlobs = cache
+		registry.blobServer.smallBlobs = cache
+		return nil
+	}
+}
+
+type smallBlobEntry struct {
+	digest  digest.Digest
+	content []byte
+}
+
+// smallBlobCache keeps the content of the most recently used small blobs. A
+// nil smallBlobCache caches nothing.
+type smallBlobCache struct {
+	threshold int64
+	size      int64
+
+	mu      sync.Mutex
+	used    int64
+	order   *list.List // most recently used first
+	entries map[digest.Digest]*list.Element
+}
+
+func newSmallBlobCache(threshold, size int64) *smallBlobCache {
+	if threshold <= 0 {
+		threshold = defaultSmallBlobThreshold
+	}
+	if size <= 0 {
+		size = defaultSmallBlobCacheSize
+	}
+	return &smallBlobCache{
+		threshold: threshold,
+		size:      size,
+		order:     list.New(),
+		entries:   make(map[digest.Digest]*list.Element),
+	}
+}
+
+// small reports whether a blob of the given size takes the fast path.
+func (c *smallBlobCache) small(size int64) bool {
+	return c != nil && size <= c.threshold
+}
+
+// get returns the content of a cached blob, or nil if it is not cached.
+func (c *smallBlobCache) get(dgst digest.Digest) []byte {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[dgst]
+	if !ok {
+		smallBlobCount.WithValues("Miss").Inc(1)
+		return nil
+	}
+	smallBlobCount.WithValues("Hit").Inc(1)
+	c.order.MoveToFront(element)
+	return element.Value.(*smallBlobEntry).content
+}
+
+// add caches a copy of the content of a blob if it is small, evicting the
+// least recently used blobs to make room for it.
+func (c *smallBlobCache) add(dgst digest.Digest, content []byte) {
+	if !c.small(int64(len(content))) || int64(len(content)) > c.size {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[dgst]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.used+int64(len(content)) > c.size {
+		c.remove(c.order.Back())
+	}
+
+	content = append([]byte(nil), content...)
+	c.entries[dgst] = c.order.PushFront(&smallBlobEntry{digest: dgst, content: content})
+	c.used += int64(len(content))
+	smallBlobCacheBytes.Inc(float64(len(content)))
+}
+
+// remove drops a cached blob. c.mu must be held.
+func (c *smallBlobCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*smallBlobEntry)
+	delete(c.entries, entry.digest)
+	c.used -= int64(len(entry.content))
+	smallBlobCacheBytes.Dec(float64(len(entry.content)))
+}
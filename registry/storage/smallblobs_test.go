@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+// countingDriver records the paths stated and read, and redirects to a fake
+// storage URL.
+type countingDriver struct {
+	driver.StorageDriver
+
+	mu    sync.Mutex
+	stats map[string]int
+	reads map[string]int
+}
+
+func newCountingDriver() *countingDriver {
+	return &countingDriver{
+		StorageDriver: inmemory.New(),
+		stats:         make(map[string]int),
+		reads:         make(map[string]int),
+	}
+}
+
+func (d *countingDriver) Stat(ctx context.Context, path string) (driver.FileInfo, error) {
+	d.mu.Lock()
+	d.stats[path]++
+	d.mu.Unlock()
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+func (d *countingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	d.mu.Lock()
+	d.reads[path]++
+	d.mu.Unlock()
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func (d *countingDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	d.mu.Lock()
+	d.reads[path]++
+	d.mu.Unlock()
+	return d.StorageDriver.Reader(ctx, path, offset)
+}
+
+func (d *countingDriver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return "https://storage.example.com" + path, nil
+}
+
+func TestSmallBlobCache(t *testing.T) {
+	cache := newSmallBlobCache(4, 8)
+	a, b, c := digest.FromString("a"), digest.FromString("b"), digest.FromString("c")
+
+	cache.add(a, []byte("aaaa"))
+	cache.add(b, []byte("bbbb"))
+	if content := cache.get(a); string(content) != "aaaa" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	// the least recently used blob makes room for the next one
+	cache.add(c, []byte("cccc"))
+	if content := cache.get(b); content != nil {
+		t.Fatalf("expected blob to be evicted, got %q", content)
+	}
+	if content := cache.get(a); string(content) != "aaaa" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	large := digest.FromString("large")
+	cache.add(large, []byte("large"))
+	if content := cache.get(large); content != nil {
+		t.Fatalf("expected blob over the threshold not to be cached, got %q", content)
+	}
+	if cache.used != 8 {
+		t.Fatalf("unexpected cache size: %d != 8", cache.used)
+	}
+
+	var disabled *smallBlobCache
+	disabled.add(a, []byte("aaaa"))
+	if disabled.small(0) || disabled.get(a) != nil {
+		t.Fatal("expected a nil cache to cache nothing")
+	}
+}
+
+func TestSmallBlobs(t *testing.T) {
+	ctx := context.Background()
+	d := newCountingDriver()
+	registry, err := NewRegistry(ctx, d, EnableRedirect, SmallBlobs(16, 0))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	name, _ := reference.WithName("foo/small")
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repo.Blobs(ctx)
+
+	dataPath := func(dgst digest.Digest) string {
+		p, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	small := []byte("small content")
+	desc, err := blobs.Put(ctx, "application/json", small)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	if n := d.stats[dataPath(desc.Digest)]; n != 0 {
+		t.Fatalf("expected a small blob to be written without checking for it, got %d stats", n)
+	}
+
+	p, err := blobs.Get(ctx, desc.Digest)
+	if err != nil || !bytes.Equal(p, small) {
+		t.Fatalf("unexpected blob content: %q, %v", p, err)
+	}
+	w := httptest.NewRecorder()
+	if err := blobs.ServeBlob(ctx, w, httptest.NewRequest("GET", "/", nil), desc.Digest); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), small) {
+		t.Fatalf("expected the small blob to be served directly, got %d %q", w.Code, w.Body.Bytes())
+	}
+	if n := d.reads[dataPath(desc.Digest)]; n != 0 {
+		t.Fatalf("expected the small blob to be served from the cache, got %d reads", n)
+	}
+
+	large := []byte("content over the threshold")
+	desc, err = blobs.Put(ctx, "application/json", large)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	if n := d.stats[dataPath(desc.Digest)]; n != 1 {
+		t.Fatalf("expected a large blob to be checked before being written, got %d stats", n)
+	}
+	w = httptest.NewRecorder()
+	if err := blobs.ServeBlob(ctx, w, httptest.NewRequest("GET", "/", nil), desc.Digest); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("expected a large blob to be redirected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+	"github.com/opencontainers/go-digest"
+)
+
+// tagIndexCacheSize bounds the number of repositories whose tag index is
+// kept in memory. The cache is cleared when it is full.
+const tagIndexCacheSize = 4096
+
+// tagIndex keeps, for each repository, a document mapping its tags to their
+// current manifest, so that resolving a tag or finding the tags of a
+// manifest reads a single object rather than the link of every tag. The
+// links remain the reference: the document is built from them, and records
+// the generation of the tags it was built at. Writing a tag stores a new
+// generation, invalidating the document, which is built again on its next
+// read. As the generation is read before the links, a document built while
+// tags are written is invalidated by the generation they store next, without
+// relying on conditional writes, which storage drivers do not offer.
+type tagIndex struct {
+	// ttl is how long documents read from storage are trusted before being
+	// read again. Documents are always read again if it is zero.
+	ttl time.Duration
+
+	// mu serializes the rebuilds of documents by this instance.
+	mu sync.Mutex
+
+	cacheMu sync.Mutex
+	cache   map[string]cachedTagIndex
+}
+
+type cachedTagIndex struct {
+	tags map[string]digest.Digest
+	read time.Time
+}
+
+// tagIndexDocument is the content of the tag index of a repository.
+type tagIndexDocument struct {
+	// Generation is the generation of the tags the document was built at.
+	Generation string                   `json:"generation"`
+	Tags       map[string]digest.Digest `json:"tags"`
+}
+
+// TagIndex returns a functional option for NewRegistry. It causes an index
+// of the tags of each repository to be maintained as tags are written, and
+// tags to be resolved from it. Indexes read from storage are kept in memory
+// for ttl.
+func TagIndex(ttl time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		registry.tagIndex = &tagIndex{
+			ttl:   ttl,
+			cache: make(map[string]cachedTagIndex),
+		}
+		return nil
+	}
+}
+
+// indexedTags returns the tags of the repository from its index, reading it
+// from storage unless cached is set and it was read less than ttl ago. The
+// returned map must not be modified.
+func (ts *tagStore) indexedTags(ctx context.Context, cached bool) (map[string]digest.Digest, error) {
+	index := ts.repository.tagIndex
+	name := ts.repository.Named().Name()
+
+	if cached {
+		if tags, ok := index.cached(name); ok {
+			return tags, nil
+		}
+	}
+
+	generation, err := ts.readGeneration(ctx)
+	if err != nil {
+		return nil, err
+	}
+	document, err := ts.readIndex(ctx)
+	switch err.(type) {
+	case nil:
+		if document.Generation == generation {
+			index.store(name, document.Tags)
+			return document.Tags, nil
+		}
+	case driver.PathNotFoundError:
+	default:
+		return nil, err
+	}
+	return ts.rebuildIndex(ctx)
+}
+
+// invalidateIndex invalidates the index of the repository after its tags
+// were written. The generation is stored whether or not this registry
+// maintains the index, as other instances may.
+func (ts *tagStore) invalidateIndex(ctx context.Context) {
+	name := ts.repository.Named().Name()
+	if ts.repository.tagIndex != nil {
+		ts.repository.tagIndex.forget(name)
+	}
+	if err := invalidateTagIndex(ctx, ts.blobStore.driver, name); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error invalidating the tag index of %s: %v", name, err)
+	}
+}
+
+// invalidateTagIndex stores a new generation of the tags of the named
+// repository, invalidating its tag index. The index is removed if the
+// generation cannot be stored, and an error only returned if it may be
+// stale.
+func invalidateTagIndex(ctx context.Context, storageDriver driver.StorageDriver, name string) error {
+	generationPath, err := pathFor(repositoryTagIndexGenerationPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+	err = storageDriver.PutContent(ctx, generationPath, []byte(uuid.Generate().String()))
+	if err == nil {
+		return nil
+	}
+
+	indexPath, perr := pathFor(repositoryTagIndexPathSpec{name: name})
+	if perr != nil {
+		return perr
+	}
+	if derr := storageDriver.Delete(ctx, indexPath); derr != nil {
+		if _, ok := derr.(driver.PathNotFoundError); !ok {
+			return fmt.Errorf("failed to store the generation of the tags (%v) and to remove the index, which may be stale: %v", err, derr)
+		}
+	}
+	return nil
+}
+
+// rebuildIndex builds the index of the repository from the links of its
+// tags, and stores it.
+func (ts *tagStore) rebuildIndex(ctx context.Context) (map[string]digest.Digest, error) {
+	index := ts.repository.tagIndex
+	name := ts.repository.Named().Name()
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	// the generation is read before the links, so that the tags written
+	// while they are read invalidate the document built
+	generation, err := ts.readGeneration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// another request may have rebuilt it in the meantime
+	document, err := ts.readIndex(ctx)
+	switch err.(type) {
+	case nil:
+		if document.Generation == generation {
+			index.store(name, document.Tags)
+			return document.Tags, nil
+		}
+	case driver.PathNotFoundError:
+	default:
+		return nil, err
+	}
+
+	tags := map[string]digest.Digest{}
+	all, err := ts.All(ctx)
+	switch err.(type) {
+	case nil:
+	case distribution.ErrRepositoryUnknown:
+		// nothing to index until the first tag
+	default:
+		return nil, err
+	}
+	for _, tag := range all {
+		revision, err := ts.readTagLink(ctx, tag)
+		switch err.(type) {
+		case nil:
+			tags[tag] = revision
+		case driver.PathNotFoundError:
+		default:
+			return nil, err
+		}
+	}
+
+	if err := ts.writeIndex(ctx, tagIndexDocument{Generation: generation, Tags: tags}); err != nil {
+		return nil, err
+	}
+	index.store(name, tags)
+	return tags, nil
+}
+
+// readGeneration reads the generation of the tags of the repository, which
+// is empty until they are first written.
+func (ts *tagStore) readGeneration(ctx context.Context) (string, error) {
+	generationPath, err := pathFor(repositoryTagIndexGenerationPathSpec{name: ts.repository.Named().Name()})
+	if err != nil {
+		return "", err
+	}
+	content, err := ts.blobStore.driver.GetContent(ctx, generationPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return "", nil
+	}
+	return string(content), err
+}
+
+func (ts *tagStore) readIndex(ctx context.Context) (tagIndexDocument, error) {
+	var document tagIndexDocument
+	indexPath, err := pathFor(repositoryTagIndexPathSpec{name: ts.repository.Named().Name()})
+	if err != nil {
+		return document, err
+	}
+	content, err := ts.blobStore.driver.GetContent(ctx, indexPath)
+	if err != nil {
+		return document, err
+	}
+
+	if err := json.Unmarshal(content, &document); err != nil {
+		return document, err
+	}
+	if document.Tags == nil {
+		document.Tags = map[string]digest.Digest{}
+	}
+	return document, nil
+}
+
+func (ts *tagStore) writeIndex(ctx context.Context, document tagIndexDocument) error {
+	indexPath, err := pathFor(repositoryTagIndexPathSpec{name: ts.repository.Named().Name()})
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return ts.blobStore.driver.PutContent(ctx, indexPath, content)
+}
+
+// cached returns the tags of the named repository if they were read less
+// than ttl ago.
+func (index *tagIndex) cached(name string) (map[string]digest.Digest, bool) {
+	index.cacheMu.Lock()
+	defer index.cacheMu.Unlock()
+
+	cached, ok := index.cache[name]
+	if !ok || time.Since(cached.read) >= index.ttl {
+		return nil, false
+	}
+	return cached.tags, true
+}
+
+func (index *tagIndex) forget(name string) {
+	index.cacheMu.Lock()
+	defer index.cacheMu.Unlock()
+
+	delete(index.cache, name)
+}
+
+// store caches the tags of the named repository, clearing the cache if it
+// is full.
+func (index *tagIndex) store(name string, tags map[string]digest.Digest) {
+	index.cacheMu.Lock()
+	defer index.cacheMu.Unlock()
+
+	if len(index.cache) >= tagIndexCacheSize {
+		index.cache = make(map[string]cachedTagIndex)
+	}
+	index.cache[name] = cachedTagIndex{tags: tags, read: time.Now()}
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestTagIndex(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("a/b")
+	tagService := func(options ...RegistryOption) distribution.TagService {
+		reg, err := NewRegistry(ctx, d, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo, err := reg.Repository(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo.Tags(ctx)
+	}
+	first := digest.FromString("first")
+	second := digest.FromString("second")
+
+	// tags written before the index is enabled are indexed on the first
+	// read
+	plain := tagService()
+	if err := plain.Tag(ctx, "old", distribution.Descriptor{Digest: first}); err != nil {
+		t.Fatal(err)
+	}
+	indexed := tagService(TagIndex(0))
+	if desc, err := indexed.Get(ctx, "old"); err != nil || desc.Digest != first {
+		t.Fatalf("unexpected descriptor %v: %v", desc, err)
+	}
+	indexPath, _ := pathFor(repositoryTagIndexPathSpec{name: "a/b"})
+	if _, err := d.Stat(ctx, indexPath); err != nil {
+		t.Fatalf("index not stored: %v", err)
+	}
+
+	for tag, dgst := range map[string]digest.Digest{"latest": first, "next": second} {
+		if err := indexed.Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tags, err := indexed.Lookup(ctx, distribution.Descriptor{Digest: first})
+	if err != nil || !reflect.DeepEqual(tags, []string{"latest", "old"}) {
+		t.Fatalf("unexpected tags %v: %v", tags, err)
+	}
+
+	// tags are resolved from the index rather than from their link
+	currentPath, _ := pathFor(manifestTagCurrentPathSpec{name: "a/b", tag: "next"})
+	if err := d.Delete(ctx, currentPath); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := indexed.Get(ctx, "next"); err != nil || desc.Digest != second {
+		t.Fatalf("unexpected descriptor %v: %v", desc, err)
+	}
+
+	// tags missing from the index are resolved from their link
+	if err := plain.Tag(ctx, "unindexed", distribution.Descriptor{Digest: second}); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := indexed.Get(ctx, "unindexed"); err != nil || desc.Digest != second {
+		t.Fatalf("unexpected descriptor %v: %v", desc, err)
+	}
+
+	if err := indexed.Untag(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexed.Get(ctx, "latest"); err != (distribution.ErrTagUnknown{Tag: "latest"}) {
+		t.Fatalf("expected an unknown tag, got %v", err)
+	}
+}
+
+func TestTagIndexTTL(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("a/b")
+	tagService := func() distribution.TagService {
+		reg, err := NewRegistry(ctx, d, TagIndex(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo, err := reg.Repository(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo.Tags(ctx)
+	}
+	first := digest.FromString("first")
+	second := digest.FromString("second")
+
+	writer, reader := tagService(), tagService()
+	if err := writer.Tag(ctx, "latest", distribution.Descriptor{Digest: first}); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := reader.Get(ctx, "latest"); err != nil || desc.Digest != first {
+		t.Fatalf("unexpected descriptor %v: %v", desc, err)
+	}
+
+	// the reader keeps the index it read, while the writer sees its writes
+	if err := writer.Tag(ctx, "latest", distribution.Descriptor{Digest: second}); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := reader.Get(ctx, "latest"); err != nil || desc.Digest != first {
+		t.Fatalf("expected the cached descriptor, got %v: %v", desc, err)
+	}
+	if desc, err := writer.Get(ctx, "latest"); err != nil || desc.Digest != second {
+		t.Fatalf("unexpected descriptor %v: %v", desc, err)
+	}
+}
+
+func TestTagIndexGeneration(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("a/b")
+	reg, err := NewRegistry(ctx, d, TagIndex(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := reg.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+	first := digest.FromString("first")
+	second := digest.FromString("second")
+
+	if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: first}); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := tags.Get(ctx, "latest"); err != nil || desc.Digest != first {
+		t.Fatalf("unexpected descriptor %v: %v", desc, err)
+	}
+
+	// an index built before the last write of a tag, as by a concurrent
+	// rebuild, is not trusted but built again from the links
+	ts := tags.(*tagStore)
+	if err := ts.writeIndex(ctx, tagIndexDocument{Generation: "stale", Tags: map[string]digest.Digest{"latest": second}}); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := tags.Get(ctx, "latest"); err != nil || desc.Digest != first {
+		t.Fatalf("expected the stale index to be rebuilt, got %v: %v", desc, err)
+	}
+	document, err := ts.readIndex(ctx)
+	if err != nil || document.Generation == "stale" || document.Tags["latest"] != first {
+		t.Fatalf("unexpected index %+v: %v", document, err)
+	}
+}
+
+func TestTagIndexUnindexedWrites(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("a/b")
+	tagService := func(options ...RegistryOption) distribution.TagService {
+		reg, err := NewRegistry(ctx, d, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo, err := reg.Repository(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo.Tags(ctx)
+	}
+	first := digest.FromString("first")
+	second := digest.FromString("second")
+
+	indexed := tagService(TagIndex(0))
+	for _, tag := range []string{"latest", "old"} {
+		if err := indexed.Tag(ctx, tag, distribution.Descriptor{Digest: first}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if desc, err := indexed.Get(ctx, "latest"); err != nil || desc.Digest != first {
+		t.Fatalf("unexpected descriptor %v: %v", desc, err)
+	}
+
+	// tags moved and deleted through a registry without the index are seen
+	// by the registries with it
+	plain := tagService()
+	if err := plain.Tag(ctx, "latest", distribution.Descriptor{Digest: second}); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := indexed.Get(ctx, "latest"); err != nil || desc.Digest != second {
+		t.Fatalf("expected the moved tag, got %v: %v", desc, err)
+	}
+	if err := plain.Untag(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indexed.Get(ctx, "old"); err != (distribution.ErrTagUnknown{Tag: "old"}) {
+		t.Fatalf("expected the deleted tag to be unknown, got %v", err)
+	}
+}
+
+// failingDeleteDriver removes paths but reports their deletion as failed.
+type failingDeleteDriver struct {
+	driver.StorageDriver
+}
+
+func (d failingDeleteDriver) Delete(ctx context.Context, path string) error {
+	if err := d.StorageDriver.Delete(ctx, path); err != nil {
+		return err
+	}
+	if strings.Contains(path, "/_manifests/tags/") {
+		return errors.New("delete failed")
+	}
+	return nil
+}
+
+func TestTagIndexFailedUntag(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("a/b")
+	reg, err := NewRegistry(ctx, failingDeleteDriver{d}, TagIndex(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := reg.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+	first := digest.FromString("first")
+
+	if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: first}); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := tags.Lookup(ctx, distribution.Descriptor{Digest: first}); err != nil || !reflect.DeepEqual(found, []string{"latest"}) {
+		t.Fatalf("unexpected tags %v: %v", found, err)
+	}
+
+	// the link may be gone even though its deletion failed: the index is
+	// invalidated rather than trusted
+	if err := tags.Untag(ctx, "latest"); err == nil {
+		t.Fatal("expected the untag to fail")
+	}
+	if found, err := tags.Lookup(ctx, distribution.Descriptor{Digest: first}); err != nil || len(found) != 0 {
+		t.Fatalf("unexpected tags %v: %v", found, err)
+	}
+}
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"container/heap"
 	"context"
+	"io"
 	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/opencontainers/go-digest"
 )
@@ -50,6 +56,129 @@ func (ts *tagStore) All(ctx context.Context) ([]string, error) {
 	return tags, nil
 }
 
+// Page fills tags with the tags following last in the given order. The tags
+// are walked rather than listed, keeping only the entries that may make it
+// into the page, so the memory used does not grow with the number of tags.
+func (ts *tagStore) Page(ctx context.Context, tags []string, last string, order distribution.TagOrder) (int, error) {
+	root, err := pathFor(manifestTagsPathSpec{
+		name: ts.repository.Named().Name(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	page := &tagPage{
+		order: order,
+		limit: len(tags) + 1, // one more to learn whether tags follow
+		last:  tagPageEntry{name: last},
+	}
+
+	if order == distribution.TagOrderCreated && last != "" {
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{
+			name: ts.repository.Named().Name(),
+			tag:  last,
+		})
+		if err != nil {
+			return 0, err
+		}
+		fi, err := ts.blobStore.driver.Stat(ctx, currentPath)
+		if err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				return 0, distribution.ErrTagUnknown{Tag: last}
+			}
+			return 0, err
+		}
+		page.last.created = fi.ModTime()
+	}
+
+	err = ts.blobStore.driver.Walk(ctx, root, func(fileInfo storagedriver.FileInfo) error {
+		parts := strings.Split(strings.TrimPrefix(fileInfo.Path(), root+"/"), "/")
+
+		switch {
+		case len(parts) == 1 && fileInfo.IsDir():
+			if order == distribution.TagOrderCreated {
+				// The creation time is that of the current link
+				return nil
+			}
+			page.add(tagPageEntry{name: parts[0]})
+			return storagedriver.ErrSkipDir
+		case len(parts) == 2 && fileInfo.IsDir() && parts[1] != "current":
+			return storagedriver.ErrSkipDir
+		case len(parts) == 3 && !fileInfo.IsDir() && parts[1] == "current" && parts[2] == "link":
+			page.add(tagPageEntry{name: parts[0], created: fileInfo.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		switch err := err.(type) {
+		case storagedriver.PathNotFoundError:
+			return 0, distribution.ErrRepositoryUnknown{Name: ts.repository.Named().Name()}
+		default:
+			return 0, err
+		}
+	}
+
+	sort.Slice(page.entries, func(i, j int) bool {
+		return page.before(page.entries[i], page.entries[j])
+	})
+	n := 0
+	for ; n < len(tags) && n < len(page.entries); n++ {
+		tags[n] = page.entries[n].name
+	}
+	if len(page.entries) <= len(tags) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+type tagPageEntry struct {
+	name    string
+	created time.Time
+}
+
+// tagPage collects the first entries following last. It is a heap with the
+// greatest entry on top, so that it can be dropped once there are more than
+// limit entries.
+type tagPage struct {
+	order   distribution.TagOrder
+	limit   int
+	last    tagPageEntry
+	entries []tagPageEntry
+}
+
+func (p *tagPage) add(entry tagPageEntry) {
+	if p.last.name != "" && !p.before(p.last, entry) {
+		return
+	}
+	heap.Push(p, entry)
+	if len(p.entries) > p.limit {
+		heap.Pop(p)
+	}
+}
+
+// before reports whether a is listed before b.
+func (p *tagPage) before(a, b tagPageEntry) bool {
+	if p.order == distribution.TagOrderCreated && !a.created.Equal(b.created) {
+		return a.created.Before(b.created)
+	}
+	return a.name < b.name
+}
+
+func (p *tagPage) Len() int { return len(p.entries) }
+
+// Less orders the heap with the entry listed last on top.
+func (p *tagPage) Less(i, j int) bool { return p.before(p.entries[j], p.entries[i]) }
+
+func (p *tagPage) Swap(i, j int) { p.entries[i], p.entries[j] = p.entries[j], p.entries[i] }
+
+func (p *tagPage) Push(x interface{}) { p.entries = append(p.entries, x.(tagPageEntry)) }
+
+func (p *tagPage) Pop() interface{} {
+	entry := p.entries[len(p.entries)-1]
+	p.entries = p.entries[:len(p.entries)-1]
+	return entry
+}
+
 // Tag tags the digest with the given tag, updating the the store to point at
 // the current tag. The digest must point to a manifest.
 func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
@@ -62,6 +191,17 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 		return err
 	}
 
+	var previous digest.Digest
+	if ts.repository.events != nil || ts.repository.intentLog {
+		previous, _ = ts.blobStore.readlink(ctx, currentPath)
+	}
+
+	done, err := ts.repository.beginIntent(ctx, intentTag, desc.Digest, tag, previous)
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	lbs := ts.linkedBlobStore(ctx, tag)
 
 	// Link into the index
@@ -70,21 +210,31 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 	}
 
 	// Overwrite the current link
-	return ts.blobStore.link(ctx, currentPath, desc.Digest)
+	err = ts.blobStore.link(ctx, currentPath, desc.Digest)
+	// even a failed write may have replaced the link
+	ts.invalidateIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if previous != desc.Digest {
+		ts.repository.recordEvent(ctx, distribution.RepositoryEventTag, desc.Digest, tag, previous)
+	}
+	return nil
 }
 
 // resolve the current revision for name and tag.
 func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
-	currentPath, err := pathFor(manifestTagCurrentPathSpec{
-		name: ts.repository.Named().Name(),
-		tag:  tag,
-	})
-
-	if err != nil {
-		return distribution.Descriptor{}, err
+	if ts.repository.tagIndex != nil {
+		tags, err := ts.indexedTags(ctx, true)
+		if err != nil {
+			dcontext.GetLogger(ctx).Warnf("error reading the tag index of %s: %v", ts.repository.Named().Name(), err)
+		} else if revision, ok := tags[tag]; ok {
+			return distribution.Descriptor{Digest: revision}, nil
+		}
+		// the tag may have been written by an instance without the index
 	}
 
-	revision, err := ts.blobStore.readlink(ctx, currentPath)
+	revision, err := ts.readTagLink(ctx, tag)
 	if err != nil {
 		switch err.(type) {
 		case storagedriver.PathNotFoundError:
@@ -97,6 +247,18 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 	return distribution.Descriptor{Digest: revision}, nil
 }
 
+// readTagLink reads the current revision of tag from its link.
+func (ts *tagStore) readTagLink(ctx context.Context, tag string) (digest.Digest, error) {
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  tag,
+	})
+	if err != nil {
+		return "", err
+	}
+	return ts.blobStore.readlink(ctx, currentPath)
+}
+
 // Untag removes the tag association
 func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 	tagPath, err := pathFor(manifestTagPathSpec{
@@ -107,7 +269,23 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 		return err
 	}
 
-	if err := ts.blobStore.driver.Delete(ctx, tagPath); err != nil {
+	var previous digest.Digest
+	if ts.repository.events != nil || ts.repository.intentLog {
+		previous, _ = ts.readTagLink(ctx, tag)
+	}
+
+	done, err := ts.repository.beginIntent(ctx, intentUntag, previous, tag, "")
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	err = ts.blobStore.driver.Delete(ctx, tagPath)
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		// even a failed deletion may have removed the link
+		ts.invalidateIndex(ctx)
+	}
+	if err != nil {
 		switch err.(type) {
 		case storagedriver.PathNotFoundError:
 			return nil // Untag is idempotent, we don't care if it didn't exist
@@ -116,6 +294,7 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 		}
 	}
 
+	ts.repository.recordEvent(ctx, distribution.RepositoryEventUntag, "", tag, previous)
 	return nil
 }
 
@@ -142,6 +321,23 @@ func (ts *tagStore) linkedBlobStore(ctx context.Context, tag string) *linkedBlob
 // Lookup recovers a list of tags which refer to this digest.  When a manifest is deleted by
 // digest, tag entries which point to it need to be recovered to avoid dangling tags.
 func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([]string, error) {
+	if ts.repository.tagIndex != nil {
+		// the index is read again, for tags left pointing to a deleted
+		// manifest would dangle
+		indexed, err := ts.indexedTags(ctx, false)
+		if err == nil {
+			var tags []string
+			for tag, revision := range indexed {
+				if revision == desc.Digest {
+					tags = append(tags, tag)
+				}
+			}
+			sort.Strings(tags)
+			return tags, nil
+		}
+		dcontext.GetLogger(ctx).Warnf("error reading the tag index of %s: %v", ts.repository.Named().Name(), err)
+	}
+
 	allTags, err := ts.All(ctx)
 	switch err.(type) {
 	case distribution.ErrRepositoryUnknown:
@@ -155,13 +351,7 @@ func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([
 
 	var tags []string
 	for _, tag := range allTags {
-		tagLinkPathSpec := manifestTagCurrentPathSpec{
-			name: ts.repository.Named().Name(),
-			tag:  tag,
-		}
-
-		tagLinkPath, _ := pathFor(tagLinkPathSpec)
-		tagDigest, err := ts.blobStore.readlink(ctx, tagLinkPath)
+		tagDigest, err := ts.readTagLink(ctx, tag)
 		if err != nil {
 			switch err.(type) {
 			case storagedriver.PathNotFoundError:
@@ -2,7 +2,10 @@ package storage
 
 import (
 	"context"
+	"io"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
@@ -152,6 +155,73 @@ func TestTagStoreAll(t *testing.T) {
 
 }
 
+func TestTagStorePage(t *testing.T) {
+	env := testTagStore(t)
+	ctx := env.ctx
+	pager, ok := env.ts.(distribution.TagPager)
+	if !ok {
+		t.Fatalf("tag store does not implement TagPager")
+	}
+
+	if _, err := pager.Page(ctx, make([]string, 2), "", distribution.TagOrderLexical); err == nil {
+		t.Fatalf("expected error paging tags of unknown repository")
+	} else if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error paging tags of unknown repository: %v", err)
+	}
+
+	// Tag out of lexical order, so that creation order differs
+	d := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	created := []string{"v3", "v1", "v1-rc", "latest", "v2"}
+	for _, tag := range created {
+		if err := env.ts.Tag(ctx, tag, d); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	for _, tc := range []struct {
+		order    distribution.TagOrder
+		expected []string
+	}{
+		{distribution.TagOrderLexical, []string{"latest", "v1", "v1-rc", "v2", "v3"}},
+		{distribution.TagOrderCreated, created},
+	} {
+		var listed []string
+		last := ""
+		for {
+			page := make([]string, 2)
+			n, err := pager.Page(ctx, page, last, tc.order)
+			if err != nil && err != io.EOF {
+				t.Fatalf("order %d: unexpected error paging tags: %v", tc.order, err)
+			}
+			listed = append(listed, page[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if n != len(page) {
+				t.Fatalf("order %d: expected a full page before the last, got %v", tc.order, page[:n])
+			}
+			last = page[n-1]
+		}
+		if !reflect.DeepEqual(listed, tc.expected) {
+			t.Errorf("order %d: expected %v, got %v", tc.order, tc.expected, listed)
+		}
+	}
+
+	// A page holding exactly the remaining tags ends the listing
+	page := make([]string, 3)
+	n, err := pager.Page(ctx, page, "v1", distribution.TagOrderLexical)
+	if err != io.EOF || n != 3 {
+		t.Fatalf("expected 3 tags and io.EOF, got %v and %v", page[:n], err)
+	}
+
+	if _, err := pager.Page(ctx, page, "missing", distribution.TagOrderCreated); err == nil {
+		t.Fatalf("expected error paging after unknown tag")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error paging after unknown tag: %v", err)
+	}
+}
+
 func TestTagLookup(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"path"
+	"strings"
 
 	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/storage/driver"
@@ -50,9 +51,38 @@ func (v Vacuum) RemoveBlob(dgst string) error {
 	return nil
 }
 
+// RemoveBlobs removes several blobs from the filesystem. If the driver
+// supports it, the blobs are deleted in bulk rather than one at a time.
+func (v Vacuum) RemoveBlobs(dgsts []digest.Digest) error {
+	if deleter, ok := v.driver.(driver.BatchDeleter); ok && len(dgsts) > 0 {
+		paths := make([]string, 0, len(dgsts))
+		for _, dgst := range dgsts {
+			blobPath, err := pathFor(blobPathSpec{digest: dgst})
+			if err != nil {
+				return err
+			}
+			paths = append(paths, blobPath)
+		}
+
+		dcontext.GetLogger(v.ctx).Infof("Deleting %d blobs", len(paths))
+		err := deleter.DeleteBatch(v.ctx, paths)
+		if _, ok := err.(driver.ErrUnsupportedMethod); !ok {
+			return err
+		}
+	}
+
+	for _, dgst := range dgsts {
+		if err := v.RemoveBlob(string(dgst)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // RemoveManifest removes a manifest from the filesystem
 func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) error {
 	// remove a tag manifest reference, in case of not found continue to next one
+	untagged := false
 	for _, tag := range tags {
 
 		tagsPath, err := pathFor(manifestTagIndexEntryPathSpec{name: name, revision: dgst, tag: tag})
@@ -74,6 +104,30 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 		if err != nil {
 			return err
 		}
+		untagged = true
+	}
+	if untagged {
+		// the tag references are removed without going through the tag
+		// store, which invalidates the tag index of the repository
+		if err := invalidateTagIndex(v.ctx, v.driver, name); err != nil {
+			return err
+		}
+	}
+
+	// the links of the referrers of the manifest, which are removed along
+	// with it
+	referrersPath, err := pathFor(manifestReferrersPathSpec{name: name, subject: dgst})
+	if err != nil {
+		return err
+	}
+	if err := v.driver.Delete(v.ctx, referrersPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	if err := v.removeForeignLayers(name, dgst); err != nil {
+		return err
 	}
 
 	manifestPath, err := pathFor(manifestRevisionPathSpec{name: name, revision: dgst})
@@ -81,7 +135,57 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 		return err
 	}
 	dcontext.GetLogger(v.ctx).Infof("deleting manifest: %s", manifestPath)
-	return v.driver.Delete(v.ctx, manifestPath)
+	err = v.driver.Delete(v.ctx, manifestPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		// already deleted by an interrupted sweep
+		return nil
+	}
+	return err
+}
+
+// removeForeignLayers removes the records of the foreign layers of the
+// manifest, kept at <layer>/<manifest>/data under the foreign layers of the
+// repository.
+func (v Vacuum) removeForeignLayers(name string, dgst digest.Digest) error {
+	foreignPath, err := pathFor(foreignLayersPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+	components, err := digestPathComponents(dgst, false)
+	if err != nil {
+		return err
+	}
+
+	var records []string
+	err = v.driver.Walk(v.ctx, foreignPath, func(fileInfo driver.FileInfo) error {
+		if !fileInfo.IsDir() {
+			return nil
+		}
+		parts := strings.Split(strings.TrimPrefix(fileInfo.Path(), foreignPath+"/"), "/")
+		if len(parts) == 4 {
+			if parts[2] == components[0] && parts[3] == components[1] {
+				records = append(records, fileInfo.Path())
+			}
+			return driver.ErrSkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	for _, record := range records {
+		dcontext.GetLogger(v.ctx).Infof("deleting foreign layer record: %s", record)
+		if err := v.driver.Delete(v.ctx, record); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // RemoveRepository removes a repository directory from the
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestRemoveManifestResumed(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	dgst := digest.FromString("manifest")
+
+	revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: "foo", revision: dgst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutContent(ctx, revisionPath, []byte(dgst)); err != nil {
+		t.Fatal(err)
+	}
+
+	vacuum := NewVacuum(ctx, d)
+	if err := vacuum.RemoveManifest("foo", dgst, nil); err != nil {
+		t.Fatalf("unexpected error removing manifest: %v", err)
+	}
+	if _, err := d.Stat(ctx, revisionPath); err == nil {
+		t.Fatal("expected the manifest to be removed")
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a sweep resumed after an interruption removes the manifest again
+	if err := vacuum.RemoveManifest("foo", dgst, nil); err != nil {
+		t.Fatalf("unexpected error removing a removed manifest: %v", err)
+	}
+}
+
+func TestRemoveBlobsBatch(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	dgsts := []digest.Digest{digest.FromString("a"), digest.FromString("b")}
+	for _, dgst := range dgsts {
+		dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.PutContent(ctx, dataPath, []byte(dgst)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := NewVacuum(ctx, d).RemoveBlobs(dgsts); err != nil {
+		t.Fatalf("unexpected error removing blobs: %v", err)
+	}
+
+	// the whole blob directory is removed, as RemoveBlob does
+	for _, dgst := range dgsts {
+		blobPath, err := pathFor(blobPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Stat(ctx, blobPath); err == nil {
+			t.Errorf("expected %s to be removed", blobPath)
+		} else if _, ok := err.(driver.PathNotFoundError); !ok {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"container/heap"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// WarmupOpts configures WarmBlobDescriptorCache.
+type WarmupOpts struct {
+	// Manifests is the number of most recently tagged manifests whose
+	// descriptors are loaded.
+	Manifests int
+	// NameValidator checks the names of the repositories found in storage.
+	// If nil, the default constraints of reference.WithName apply.
+	NameValidator *reference.NameValidator
+}
+
+// WarmupResult summarizes the descriptors loaded by WarmBlobDescriptorCache.
+type WarmupResult struct {
+	Manifests int
+	Blobs     int
+}
+
+// WarmBlobDescriptorCache loads the descriptors of the most recently tagged
+// manifests of the registry, and of the blobs they reference, into its blob
+// descriptor cache. Tags are ordered by the modification time of their
+// current link. The registry must have been created with a
+// BlobDescriptorCacheProvider for this to have any effect.
+//
+// Manifests which cannot be read are skipped, since the cache is only an
+// optimization.
+func WarmBlobDescriptorCache(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, opts WarmupOpts) (WarmupResult, error) {
+	var result WarmupResult
+	if opts.Manifests <= 0 {
+		return result, nil
+	}
+
+	enumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return result, distribution.ErrUnsupported
+	}
+
+	recent := &recentTags{limit: opts.Manifests}
+	err := enumerator.Enumerate(ctx, func(repoName string) error {
+		return collectRecentTags(ctx, storageDriver, repoName, recent)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	log := dcontext.GetLogger(ctx)
+	seen := make(map[string]bool)
+	for recent.Len() > 0 {
+		tag := heap.Pop(recent).(recentTag)
+		key := tag.repo + "@" + tag.digest.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		blobs, err := warmManifest(ctx, registry, opts.NameValidator, tag.repo, tag.digest)
+		if err != nil {
+			log.Warnf("skipping warm up of %s:%s: %v", tag.repo, tag.name, err)
+			continue
+		}
+		result.Manifests++
+		result.Blobs += blobs
+	}
+
+	return result, nil
+}
+
+// warmManifest stats a manifest and the blobs it references through the
+// registry, which caches their descriptors. It returns the number of blobs
+// referenced.
+func warmManifest(ctx context.Context, registry distribution.Namespace, nameValidator *reference.NameValidator, repoName string, dgst digest.Digest) (int, error) {
+	named, err := nameValidator.WithName(repoName)
+	if err != nil {
+		return 0, err
+	}
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		return 0, err
+	}
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return 0, err
+	}
+	manifest, err := manifests.Get(ctx, dgst)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := manifests.Exists(ctx, dgst); err != nil {
+		return 0, err
+	}
+
+	blobs := repo.Blobs(ctx)
+	references := manifest.References()
+	for _, desc := range references {
+		_, err := blobs.Stat(ctx, desc.Digest)
+		if err == distribution.ErrBlobUnknown {
+			// the manifests of an index are linked as manifests
+			_, err = manifests.Exists(ctx, desc.Digest)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(references), nil
+}
+
+// collectRecentTags adds the tags of a repository to recent.
+func collectRecentTags(ctx context.Context, storageDriver storagedriver.StorageDriver, repoName string, recent *recentTags) error {
+	root, err := pathFor(manifestTagsPathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+
+	err = storageDriver.Walk(ctx, root, func(fileInfo storagedriver.FileInfo) error {
+		parts := strings.Split(strings.TrimPrefix(fileInfo.Path(), root+"/"), "/")
+
+		switch {
+		case len(parts) == 2 && fileInfo.IsDir() && parts[1] != "current":
+			return storagedriver.ErrSkipDir
+		case len(parts) == 3 && !fileInfo.IsDir() && parts[1] == "current" && parts[2] == "link":
+			if !recent.wants(fileInfo.ModTime()) {
+				return nil
+			}
+			content, err := storageDriver.GetContent(ctx, fileInfo.Path())
+			if err != nil {
+				return err
+			}
+			dgst, err := digest.Parse(string(content))
+			if err != nil {
+				dcontext.GetLogger(ctx).Warnf("skipping invalid tag link %s: %v", fileInfo.Path(), err)
+				return nil
+			}
+			recent.add(recentTag{repo: repoName, name: parts[0], digest: dgst, modTime: fileInfo.ModTime()})
+		}
+		return nil
+	})
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		// repository without tags
+		return nil
+	}
+	return err
+}
+
+type recentTag struct {
+	repo    string
+	name    string
+	digest  digest.Digest
+	modTime time.Time
+}
+
+// recentTags keeps the limit most recent tags added. It is a heap with the
+// oldest tag on top, so that it can be dropped once there are more than limit
+// tags.
+type recentTags struct {
+	limit int
+	tags  []recentTag
+}
+
+// wants reports whether a tag modified at modTime would be kept.
+func (r *recentTags) wants(modTime time.Time) bool {
+	return len(r.tags) < r.limit || modTime.After(r.tags[0].modTime)
+}
+
+func (r *recentTags) add(tag recentTag) {
+	heap.Push(r, tag)
+	if len(r.tags) > r.limit {
+		heap.Pop(r)
+	}
+}
+
+func (r *recentTags) Len() int { return len(r.tags) }
+
+func (r *recentTags) Less(i, j int) bool { return r.tags[i].modTime.Before(r.tags[j].modTime) }
+
+func (r *recentTags) Swap(i, j int) { r.tags[i], r.tags[j] = r.tags[j], r.tags[i] }
+
+func (r *recentTags) Push(x interface{}) { r.tags = append(r.tags, x.(recentTag)) }
+
+func (r *recentTags) Pop() interface{} {
+	tag := r.tags[len(r.tags)-1]
+	r.tags = r.tags[:len(r.tags)-1]
+	return tag
+}
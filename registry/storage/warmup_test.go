@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestWarmBlobDescriptorCache(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver)
+
+	// Push an image to each repository, tagging them one after the other
+	var images []image
+	for _, name := range []string{"warm/old", "warm/middle", "warm/new"} {
+		repo := makeRepository(t, registry, name)
+		im := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+		images = append(images, im)
+		time.Sleep(10 * time.Millisecond)
+	}
+	makeRepository(t, registry, "warm/untagged")
+
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider()
+	cachedRegistry := createRegistry(t, inmemoryDriver, BlobDescriptorCacheProvider(cacheProvider))
+
+	result, err := WarmBlobDescriptorCache(ctx, inmemoryDriver, cachedRegistry, WarmupOpts{Manifests: 2})
+	if err != nil {
+		t.Fatalf("unexpected error warming cache: %v", err)
+	}
+	if result.Manifests != 2 || result.Blobs != 6 {
+		t.Fatalf("unexpected warm up result: %+v", result)
+	}
+
+	for i, im := range images {
+		cached := i > 0
+		digests := append(getKeys(im.layers), im.manifestDigest)
+		for _, dgst := range digests {
+			if _, err := cacheProvider.Stat(ctx, dgst); (err == nil) != cached {
+				t.Errorf("image %d: expected descriptor of %s cached %v, got %v", i, dgst, cached, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncTags        string
+	syncConcurrency int
+	syncDryRun      bool
+	syncUsername    string
+	syncPassword    string
+)
+
+func init() {
+	RootCmd.AddCommand(SyncCmd)
+	SyncCmd.Flags().StringVarP(&syncTags, "tags", "t", "", "only copy tags matching this regular expression")
+	SyncCmd.Flags().IntVarP(&syncConcurrency, "concurrency", "c", 4, "number of tags copied concurrently")
+	SyncCmd.Flags().BoolVarP(&syncDryRun, "dry-run", "d", false, "report what would be copied without copying it")
+	SyncCmd.Flags().StringVarP(&syncUsername, "username", "u", "", "username for the source registry")
+	SyncCmd.Flags().StringVarP(&syncPassword, "password", "p", "", "password for the source registry")
+}
+
+// SyncCmd is the cobra command that corresponds to the sync subcommand
+var SyncCmd = &cobra.Command{
+	Use:   "sync <config> <source> <repository>...",
+	Short: "`sync` copies repositories from another registry into this one",
+	Long: "`sync` copies the tags of repositories from the registry at the source URL into\n" +
+		"the storage of the registry configured by <config>. Blobs already stored are\n" +
+		"skipped, and blobs stored in another repository are mounted.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 3 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args[:1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		k, err := libtrust.GenerateECP256PrivateKey()
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		nameValidator, err := repositoryNameValidator(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name constraints: %v", err)
+			os.Exit(1)
+		}
+
+		options := referenceIndexOptions(config, []storage.RegistryOption{storage.Schema1SigningKey(k), storage.RepositoryNameValidator(nameValidator)})
+		registry, err := storage.NewRegistry(ctx, driver, options...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+		tenants, err := tenantRegistries(ctx, config, options...)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !syncDryRun {
+			if err := invalidateReferenceIndexes(ctx, config, driver, tenants); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to invalidate the reference index: %v", err)
+				os.Exit(1)
+			}
+		}
+
+		s, err := newSyncer(args[1], tenantNamespace{Namespace: registry, tenants: tenants}, syncOptions{
+			tags:          syncTags,
+			concurrency:   syncConcurrency,
+			dryRun:        syncDryRun,
+			username:      syncUsername,
+			password:      syncPassword,
+			nameValidator: nameValidator,
+			out:           os.Stdout,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to sync: %v\n", err)
+			os.Exit(1)
+		}
+
+		failed := false
+		for _, name := range args[2:] {
+			if err := s.syncRepository(ctx, name); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to sync %s: %v\n", name, err)
+				failed = true
+			}
+		}
+		fmt.Fprintf(os.Stdout, "%d tags synced, %d blobs copied (%d bytes), %d mounted, %d skipped\n",
+			s.stats.tags, s.stats.copied, s.stats.copiedBytes, s.stats.mounted, s.stats.skipped)
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// syncOptions configures a syncer.
+type syncOptions struct {
+	tags          string // regular expression matching the tags to copy
+	concurrency   int
+	dryRun        bool
+	username      string
+	password      string
+	nameValidator *reference.NameValidator // nil for the default constraints
+	out           io.Writer                // progress output
+}
+
+// syncStats counts what a syncer did.
+type syncStats struct {
+	tags        int
+	copied      int
+	copiedBytes int64
+	mounted     int
+	skipped     int
+}
+
+// syncer copies repositories from a remote registry into a local one.
+type syncer struct {
+	source        string
+	challenges    challenge.Manager
+	creds         auth.CredentialStore
+	dest          distribution.Namespace
+	tags          *regexp.Regexp
+	concurrency   int
+	dryRun        bool
+	nameValidator *reference.NameValidator
+	out           io.Writer
+
+	mu    sync.Mutex
+	stats syncStats
+	locks map[digest.Digest]*sync.Mutex
+}
+
+func newSyncer(source string, dest distribution.Namespace, opts syncOptions) (*syncer, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid source URL %q", source)
+	}
+	source = strings.TrimSuffix(source, "/")
+
+	var tags *regexp.Regexp
+	if opts.tags != "" {
+		tags, err = regexp.Compile(opts.tags)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag filter: %v", err)
+		}
+	}
+
+	if opts.concurrency <= 0 {
+		opts.concurrency = 1
+	}
+
+	cm := challenge.NewSimpleManager()
+	resp, err := http.Get(source + "/v2/")
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if err := cm.AddResponse(resp); err != nil {
+		return nil, err
+	}
+
+	return &syncer{
+		source:        source,
+		challenges:    cm,
+		creds:         &syncCredentials{username: opts.username, password: opts.password},
+		dest:          dest,
+		tags:          tags,
+		concurrency:   opts.concurrency,
+		dryRun:        opts.dryRun,
+		nameValidator: opts.nameValidator,
+		out:           opts.out,
+		locks:         make(map[digest.Digest]*sync.Mutex),
+	}, nil
+}
+
+// syncRepository copies the tags of the named repository, and the manifests
+// and blobs they reference.
+func (s *syncer) syncRepository(ctx context.Context, name string) error {
+	named, err := s.nameValidator.WithName(name)
+	if err != nil {
+		return err
+	}
+
+	// Bearer tokens are scoped to the repository
+	tr := transport.NewTransport(http.DefaultTransport,
+		auth.NewAuthorizer(s.challenges,
+			auth.NewTokenHandler(http.DefaultTransport, s.creds, named.Name(), "pull"),
+			auth.NewBasicHandler(s.creds)))
+	src, err := client.NewRepository(named, s.source, tr)
+	if err != nil {
+		return err
+	}
+	dst, err := s.dest.Repository(ctx, named)
+	if err != nil {
+		return err
+	}
+
+	tags, err := src.Tags(ctx).All(ctx)
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, s.concurrency)
+	errs := make(chan error, len(tags))
+	var wg sync.WaitGroup
+	for _, tag := range tags {
+		if s.tags != nil && !s.tags.MatchString(tag) {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(tag string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := s.syncTag(ctx, src, dst, tag); err != nil {
+				errs <- fmt.Errorf("%s:%s: %v", name, tag, err)
+			}
+		}(tag)
+	}
+	wg.Wait()
+	close(errs)
+
+	var failed []string
+	for err := range errs {
+		failed = append(failed, err.Error())
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d tags failed: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (s *syncer) syncTag(ctx context.Context, src, dst distribution.Repository, tag string) error {
+	desc, err := src.Tags(ctx).Get(ctx, tag)
+	if err != nil {
+		return err
+	}
+
+	if err := s.syncManifest(ctx, src, dst, desc.Digest); err != nil {
+		return err
+	}
+
+	s.printf("tag %s:%s -> %s\n", dst.Named().Name(), tag, desc.Digest)
+	if !s.dryRun {
+		if err := dst.Tags(ctx).Tag(ctx, tag, desc); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.tags++
+	s.mu.Unlock()
+	return nil
+}
+
+// syncManifest copies a manifest after the manifests or blobs it references.
+func (s *syncer) syncManifest(ctx context.Context, src, dst distribution.Repository, dgst digest.Digest) error {
+	dstManifests, err := dst.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	if exists, err := dstManifests.Exists(ctx, dgst); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	srcManifests, err := src.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	manifest, err := srcManifests.Get(ctx, dgst)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range manifest.References() {
+		if _, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+			err = s.syncManifest(ctx, src, dst, ref.Digest)
+		} else {
+			err = s.syncBlob(ctx, src, dst, ref)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.dryRun {
+		return nil
+	}
+	_, err = dstManifests.Put(ctx, manifest)
+	return err
+}
+
+// syncBlob copies a blob unless the repository has it already, mounting it
+// if the storage of the repository holds it for another repository.
+func (s *syncer) syncBlob(ctx context.Context, src, dst distribution.Repository, desc distribution.Descriptor) error {
+	unlock := s.lock(desc.Digest)
+	defer unlock()
+
+	blobs := dst.Blobs(ctx)
+	if _, err := blobs.Stat(ctx, desc.Digest); err == nil {
+		s.mu.Lock()
+		s.stats.skipped++
+		s.mu.Unlock()
+		return nil
+	} else if err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	stat, err := s.blobStatter(dst.Named()).Stat(ctx, desc.Digest)
+	if err == nil {
+		s.printf("mount %s\n", desc.Digest)
+		if !s.dryRun {
+			// the blob is linked from the global blob store, which
+			// holds it whichever repository it was pushed to
+			canonical, err := reference.WithDigest(dst.Named(), desc.Digest)
+			if err != nil {
+				return err
+			}
+			bw, err := blobs.Create(ctx, storage.WithMountFrom(canonical), syncMountStat{desc: stat})
+			if err == nil {
+				bw.Cancel(ctx)
+				return fmt.Errorf("unable to mount %s", desc.Digest)
+			}
+			if _, ok := err.(distribution.ErrBlobMounted); !ok {
+				return err
+			}
+		}
+		s.mu.Lock()
+		s.stats.mounted++
+		s.mu.Unlock()
+		return nil
+	} else if err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	s.printf("copy %s (%d bytes)\n", desc.Digest, desc.Size)
+	if !s.dryRun {
+		if err := s.copyBlob(ctx, src.Blobs(ctx), blobs, desc); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.copied++
+	s.stats.copiedBytes += desc.Size
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *syncer) copyBlob(ctx context.Context, src distribution.BlobService, dst distribution.BlobIngester, desc distribution.Descriptor) error {
+	rc, err := src.Open(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	bw, err := dst.Create(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(bw, rc); err != nil {
+		bw.Cancel(ctx)
+		return err
+	}
+	_, err = bw.Commit(ctx, desc)
+	return err
+}
+
+// blobStatter returns the statter of the global blob store of the storage
+// holding the named repository. Blobs are never mounted across the storages
+// of tenants.
+func (s *syncer) blobStatter(name reference.Named) distribution.BlobStatter {
+	if ns, ok := s.dest.(tenantNamespace); ok {
+		return ns.registry(name).BlobStatter()
+	}
+	return s.dest.BlobStatter()
+}
+
+// syncMountStat provides the descriptor of a blob mounted by syncBlob, so
+// that it is not looked up in the repository it is mounted from.
+type syncMountStat struct {
+	desc distribution.Descriptor
+}
+
+func (o syncMountStat) Apply(v interface{}) error {
+	opts, ok := v.(*distribution.CreateOptions)
+	if !ok {
+		return fmt.Errorf("unexpected options type: %T", v)
+	}
+	if opts.Mount.ShouldMount {
+		opts.Mount.Stat = &o.desc
+	}
+	return nil
+}
+
+// lock serializes the work on a blob, so that blobs shared by several tags
+// are copied once.
+func (s *syncer) lock(dgst digest.Digest) func() {
+	s.mu.Lock()
+	l, ok := s.locks[dgst]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[dgst] = l
+	}
+	s.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+func (s *syncer) printf(format string, args ...interface{}) {
+	if s.out == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, format, args...)
+}
+
+// syncCredentials provides the credentials given on the command line for
+// the source registry.
+type syncCredentials struct {
+	username string
+	password string
+}
+
+func (c *syncCredentials) Basic(*url.URL) (string, string) {
+	return c.username, c.password
+}
+
+func (c *syncCredentials) RefreshToken(*url.URL, string) string {
+	return ""
+}
+
+func (c *syncCredentials) SetRefreshToken(*url.URL, string, string) {
+}
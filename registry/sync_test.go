@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/handlers"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// pushImage pushes an image with the given layers to the named repository of
+// the registry at baseURL, tagging it with tag.
+func pushImage(t *testing.T, baseURL, name, tag string, layers ...[]byte) {
+	ctx := context.Background()
+	named, err := reference.WithName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := client.NewRepository(named, baseURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := schema2.NewManifestBuilder(repo.Blobs(ctx), schema2.MediaTypeImageConfig, []byte(`{"tag":"`+tag+`"}`))
+	for _, layer := range layers {
+		desc, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeLayer, layer)
+		if err != nil {
+			t.Fatalf("unexpected error pushing layer: %v", err)
+		}
+		if err := builder.AppendReference(desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifests.Put(ctx, manifest, distribution.WithTag(tag)); err != nil {
+		t.Fatalf("unexpected error pushing manifest: %v", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	source := httptest.NewServer(handlers.NewApp(ctx, config))
+	defer source.Close()
+
+	shared := []byte("shared layer")
+	pushImage(t, source.URL, "foo/a", "v1", shared, []byte("a v1"))
+	pushImage(t, source.URL, "foo/a", "v2", shared, []byte("a v2"))
+	pushImage(t, source.URL, "foo/a", "dev", []byte("a dev"))
+	pushImage(t, source.URL, "foo/b", "latest", shared)
+	pushImage(t, source.URL, "foo/c", "latest", shared)
+
+	dest, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	// A dry run copies nothing
+	s, err := newSyncer(source.URL, dest, syncOptions{tags: "^v", dryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.syncRepository(ctx, "foo/a"); err != nil {
+		t.Fatalf("unexpected error syncing: %v", err)
+	}
+	if s.stats.tags != 2 {
+		t.Errorf("expected 2 tags in dry run, got %d", s.stats.tags)
+	}
+	if tags := destTags(t, dest, "foo/a"); len(tags) != 0 {
+		t.Errorf("dry run created tags: %v", tags)
+	}
+
+	var out bytes.Buffer
+	s, err = newSyncer(source.URL, dest, syncOptions{tags: "^(v|latest)", concurrency: 2, out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo/a", "foo/b"} {
+		if err := s.syncRepository(ctx, name); err != nil {
+			t.Fatalf("unexpected error syncing %s: %v", name, err)
+		}
+	}
+
+	if tags := destTags(t, dest, "foo/a"); len(tags) != 2 {
+		t.Errorf("expected tags v1 and v2, got %v", tags)
+	}
+	if tags := destTags(t, dest, "foo/b"); len(tags) != 1 {
+		t.Errorf("expected tag latest, got %v", tags)
+	}
+
+	// foo/a: two configs, the shared layer and two layers; foo/b: its config
+	if s.stats.copied != 6 {
+		t.Errorf("expected 6 blobs copied, got %d\n%s", s.stats.copied, out.String())
+	}
+	// foo/b: the shared layer
+	if s.stats.mounted != 1 {
+		t.Errorf("expected 1 blob mounted, got %d\n%s", s.stats.mounted, out.String())
+	}
+
+	// Syncing again skips existing manifests
+	s, err = newSyncer(source.URL, dest, syncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.syncRepository(ctx, "foo/a"); err != nil {
+		t.Fatalf("unexpected error syncing: %v", err)
+	}
+	if s.stats.copied != 2 || s.stats.skipped != 0 {
+		t.Errorf("expected only the dev image to be copied, got %+v", s.stats)
+	}
+
+	// Blobs stored for other repositories by earlier syncs are mounted
+	s, err = newSyncer(source.URL, dest, syncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.syncRepository(ctx, "foo/c"); err != nil {
+		t.Fatalf("unexpected error syncing: %v", err)
+	}
+	if s.stats.copied != 0 || s.stats.mounted != 2 {
+		t.Errorf("expected the config and layer of foo/c to be mounted, got %+v", s.stats)
+	}
+	if tags := destTags(t, dest, "foo/c"); len(tags) != 1 {
+		t.Errorf("expected tag latest, got %v", tags)
+	}
+}
+
+func destTags(t *testing.T, registry distribution.Namespace, name string) []string {
+	ctx := context.Background()
+	named, err := reference.WithName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := repo.Tags(ctx).All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			return nil
+		}
+		t.Fatal(err)
+	}
+	return tags
+}
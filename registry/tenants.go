@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+)
+
+// tenantRegistry is the registry of a tenant with its own storage.
+type tenantRegistry struct {
+	name     string
+	driver   storagedriver.StorageDriver
+	registry distribution.Namespace
+}
+
+// tenantRegistries opens the storage of each tenant of the configuration
+// with its own, with the registry options of the command. Nested tenants
+// come first.
+func tenantRegistries(ctx context.Context, config *configuration.Configuration, options ...storage.RegistryOption) ([]tenantRegistry, error) {
+	var tenants []tenantRegistry
+	for _, tc := range config.Tenants {
+		storageType := tc.Storage.Type()
+		if storageType == "" {
+			continue
+		}
+		driver, err := factory.Create(storageType, tc.Storage.Parameters())
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: failed to construct %s driver: %v", tc.Name, storageType, err)
+		}
+		registry, err := storage.NewRegistry(ctx, driver, options...)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: failed to construct registry: %v", tc.Name, err)
+		}
+		tenants = append(tenants, tenantRegistry{name: tc.Name, driver: driver, registry: registry})
+	}
+	sort.SliceStable(tenants, func(i, j int) bool {
+		return len(tenants[i].name) > len(tenants[j].name)
+	})
+	return tenants, nil
+}
+
+// tenantNamespace opens the repositories of the tenants with their own
+// storage from their registries, and the other repositories from the
+// embedded registry.
+type tenantNamespace struct {
+	distribution.Namespace
+	tenants []tenantRegistry
+}
+
+func (ns tenantNamespace) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
+	return ns.registry(name).Repository(ctx, name)
+}
+
+// registry returns the registry storing the named repository.
+func (ns tenantNamespace) registry(name reference.Named) distribution.Namespace {
+	for _, t := range ns.tenants {
+		if name.Name() == t.name || strings.HasPrefix(name.Name(), t.name+"/") {
+			return t.registry
+		}
+	}
+	return ns.Namespace
+}
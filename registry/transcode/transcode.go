@@ -0,0 +1,411 @@
+// Package transcode publishes variants of the images pulled by clients
+// asking for their layers in another compression, gzip layers as zstd and
+// zstd layers as gzip. A variant is an OCI image manifest of its own digest,
+// listing the transcoded layers and referring to the image it derives from as
+// its subject, so that the image and its layers are always served as stored,
+// and the variant is removed by garbage collection along with its subject.
+// Variants are built in the background: clients are served the image as
+// stored until its variant is published.
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// MediaTypeLayerZstd is the media type of OCI layers compressed with zstd.
+const MediaTypeLayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+
+// AnnotationCompression annotates variants with the compression of their
+// layers.
+const AnnotationCompression = "org.docker.distribution.layer.compression"
+
+const (
+	defaultConcurrency = 2
+
+	// queueSize is the number of variants waiting to be built, beyond which
+	// requests for more are dropped.
+	queueSize = 64
+)
+
+// Format is a layer compression format.
+type Format string
+
+const (
+	// Gzip is the compression of the layers of most images.
+	Gzip Format = "gzip"
+
+	// Zstd decompresses faster than gzip, and is understood by recent
+	// container runtimes.
+	Zstd Format = "zstd"
+)
+
+var magics = map[Format][]byte{
+	Gzip: {0x1f, 0x8b},
+	Zstd: {0x28, 0xb5, 0x2f, 0xfd},
+}
+
+// MediaType returns the media type of layers compressed in format.
+func (f Format) MediaType() string {
+	if f == Zstd {
+		return MediaTypeLayerZstd
+	}
+	return v1.MediaTypeImageLayerGzip
+}
+
+// layerFormat returns the compression of the layers of the media type, or
+// "" for other blobs, non-distributable layers included.
+func layerFormat(mediaType string) Format {
+	switch mediaType {
+	case v1.MediaTypeImageLayerGzip, schema2.MediaTypeLayer:
+		return Gzip
+	case MediaTypeLayerZstd:
+		return Zstd
+	}
+	return ""
+}
+
+// Config configures a Transcoder.
+type Config struct {
+	// MaxSize is the size of the largest layer transcoded, unbounded if
+	// zero.
+	MaxSize int64
+
+	// Concurrency is the number of images transcoded at the same time.
+	Concurrency int
+}
+
+// Transcoder builds the variants of images in the background.
+type Transcoder struct {
+	maxSize int64
+	queue   chan job
+	done    sync.WaitGroup
+
+	mu     sync.Mutex
+	queued map[string]struct{}
+	closed bool
+}
+
+// job is the build of the variant of an image.
+type job struct {
+	repository distribution.Repository
+	manifest   digest.Digest
+	format     Format
+}
+
+func (j job) key() string {
+	return j.repository.Named().Name() + "@" + j.manifest.String() + "/" + string(j.format)
+}
+
+// New returns a Transcoder, building variants with config.Concurrency
+// workers until it is closed.
+func New(config Config) *Transcoder {
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultConcurrency
+	}
+	t := &Transcoder{
+		maxSize: config.MaxSize,
+		queue:   make(chan job, queueSize),
+		queued:  make(map[string]struct{}),
+	}
+	for i := 0; i < config.Concurrency; i++ {
+		t.done.Add(1)
+		go t.work()
+	}
+	return t
+}
+
+// Requested returns the format requested by the Accept headers of r, or ""
+// if the client does not ask for a specific layer compression. The first
+// layer media type listed wins.
+func Requested(r *http.Request) Format {
+	for _, acceptHeader := range r.Header["Accept"] {
+		for _, mediaType := range strings.Split(acceptHeader, ",") {
+			mediaType, _, err := mime.ParseMediaType(mediaType)
+			if err != nil {
+				continue
+			}
+			switch mediaType {
+			case MediaTypeLayerZstd:
+				return Zstd
+			case v1.MediaTypeImageLayerGzip, schema2.MediaTypeLayer:
+				return Gzip
+			}
+		}
+	}
+	return ""
+}
+
+// Variant returns the variant of the image manifest dgst of repository whose
+// layers are compressed in format, if it was published.
+func Variant(ctx context.Context, repository distribution.Repository, dgst digest.Digest, format Format) (distribution.Descriptor, bool, error) {
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, false, err
+	}
+	lister, ok := manifests.(distribution.ManifestReferrers)
+	if !ok {
+		return distribution.Descriptor{}, false, nil
+	}
+	referrers, err := lister.Referrers(ctx, dgst)
+	if err != nil {
+		return distribution.Descriptor{}, false, err
+	}
+	for _, referrer := range referrers {
+		if referrer.Annotations[AnnotationCompression] == string(format) {
+			return referrer.Descriptor, true, nil
+		}
+	}
+	return distribution.Descriptor{}, false, nil
+}
+
+// Schedule queues the build of the variant of the image manifest dgst of
+// repository in format, unless it is already queued. It is dropped if too
+// many are.
+func (t *Transcoder) Schedule(repository distribution.Repository, dgst digest.Digest, format Format) {
+	j := job{repository: repository, manifest: dgst, format: format}
+	key := j.key()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.queued[key]; ok || t.closed {
+		return
+	}
+	select {
+	case t.queue <- j:
+		t.queued[key] = struct{}{}
+	default:
+	}
+}
+
+// Close stops the workers once the variants they are building are published.
+// The queued ones are dropped.
+func (t *Transcoder) Close() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	t.done.Wait()
+}
+
+func (t *Transcoder) work() {
+	defer t.done.Done()
+	for j := range t.queue {
+		t.mu.Lock()
+		closed := t.closed
+		t.mu.Unlock()
+		if !closed {
+			ctx := context.Background()
+			if err := t.publish(ctx, j); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error publishing the %s variant of %s: %v", j.format, j.key(), err)
+			}
+		}
+
+		t.mu.Lock()
+		delete(t.queued, j.key())
+		t.mu.Unlock()
+	}
+}
+
+// publish builds and pushes the variant of the image of j, unless it was
+// before or the image has no layer to transcode.
+func (t *Transcoder) publish(ctx context.Context, j job) error {
+	if _, ok, err := Variant(ctx, j.repository, j.manifest, j.format); ok || err != nil {
+		return err
+	}
+
+	manifests, err := j.repository.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	manifest, err := manifests.Get(ctx, j.manifest)
+	if err != nil {
+		return err
+	}
+	var config distribution.Descriptor
+	var layers []distribution.Descriptor
+	switch m := manifest.(type) {
+	case *schema2.DeserializedManifest:
+		config, layers = m.Config, m.Layers
+	case *ocischema.DeserializedManifest:
+		if m.Subject != nil {
+			// variants and other artifacts referring to a manifest
+			return nil
+		}
+		config, layers = m.Config, m.Layers
+	default:
+		return nil
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return err
+	}
+
+	blobs := j.repository.Blobs(ctx)
+	variant := ocischema.Manifest{
+		Versioned:   ocischema.SchemaVersion,
+		Config:      config,
+		Annotations: map[string]string{AnnotationCompression: string(j.format)},
+		Subject: &distribution.Descriptor{
+			MediaType: mediaType,
+			Size:      int64(len(payload)),
+			Digest:    j.manifest,
+		},
+	}
+	transcoded := false
+	for _, layer := range layers {
+		source := layerFormat(layer.MediaType)
+		if source == "" || source == j.format || len(layer.URLs) > 0 || (t.maxSize > 0 && layer.Size > t.maxSize) {
+			variant.Layers = append(variant.Layers, layer)
+			continue
+		}
+		converted, ok, err := t.transcodeBlob(ctx, blobs, layer, j.format)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			converted = layer
+		}
+		variant.Layers = append(variant.Layers, converted)
+		transcoded = transcoded || ok
+	}
+	if !transcoded {
+		return nil
+	}
+
+	deserialized, err := ocischema.FromStruct(variant)
+	if err != nil {
+		return err
+	}
+	_, err = manifests.Put(ctx, deserialized)
+	return err
+}
+
+// transcodeBlob stores the layer desc transcoded in format into blobs. ok is
+// false if its content is not compressed as its media type says.
+func (t *Transcoder) transcodeBlob(ctx context.Context, blobs distribution.BlobStore, desc distribution.Descriptor, format Format) (variant distribution.Descriptor, ok bool, err error) {
+	rc, err := blobs.Open(ctx, desc.Digest)
+	if err != nil {
+		return distribution.Descriptor{}, false, err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReader(rc)
+	source, err := sniff(br)
+	if err != nil {
+		return distribution.Descriptor{}, false, err
+	}
+	if source != layerFormat(desc.MediaType) {
+		return distribution.Descriptor{}, false, nil
+	}
+
+	bw, err := blobs.Create(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, false, err
+	}
+	digester := digest.Canonical.Digester()
+	size, err := transcode(io.MultiWriter(bw, digester.Hash()), br, source, format)
+	if err != nil {
+		bw.Cancel(ctx)
+		return distribution.Descriptor{}, false, fmt.Errorf("transcode: %s of %s to %s: %v", source, desc.Digest, format, err)
+	}
+	variant, err = bw.Commit(ctx, distribution.Descriptor{
+		MediaType: format.MediaType(),
+		Digest:    digester.Digest(),
+		Size:      size,
+	})
+	if err != nil {
+		bw.Cancel(ctx)
+		return distribution.Descriptor{}, false, err
+	}
+	variant.MediaType = format.MediaType()
+	variant.Annotations = desc.Annotations
+	return variant, true, nil
+}
+
+// sniff returns the compression format of the content of br, or "" if it is
+// not compressed in a known format.
+func sniff(br *bufio.Reader) (Format, error) {
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	for format, magic := range magics {
+		if bytes.HasPrefix(head, magic) {
+			return format, nil
+		}
+	}
+	return "", nil
+}
+
+// transcode decompresses r from source and writes it to w compressed in
+// target, returning the number of bytes written.
+func transcode(w io.Writer, r io.Reader, source, target Format) (int64, error) {
+	var decompressed io.Reader
+	switch source {
+	case Gzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		decompressed = zr
+	case Zstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		decompressed = zr
+	}
+
+	cw := &countingWriter{w: w}
+	var compressor io.WriteCloser
+	switch target {
+	case Gzip:
+		compressor = gzip.NewWriter(cw)
+	case Zstd:
+		zw, err := zstd.NewWriter(cw)
+		if err != nil {
+			return 0, err
+		}
+		compressor = zw
+	}
+	if _, err := io.Copy(compressor, decompressed); err != nil {
+		compressor.Close()
+		return 0, err
+	}
+	if err := compressor.Close(); err != nil {
+		return 0, err
+	}
+	return cw.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,179 @@
+package transcode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRequested(t *testing.T) {
+	for accept, expected := range map[string]Format{
+		"":                          "",
+		"*/*":                       "",
+		MediaTypeLayerZstd:          Zstd,
+		MediaTypeLayerZstd + ";q=1": Zstd,
+		"application/vnd.docker.image.rootfs.diff.tar.gzip":                  Gzip,
+		"application/vnd.oci.image.layer.v1.tar+gzip, " + MediaTypeLayerZstd: Gzip,
+		"application/json, " + MediaTypeLayerZstd:                            Zstd,
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		if format := Requested(r); format != expected {
+			t.Errorf("unexpected format for %q: %q, expected %q", accept, format, expected)
+		}
+	}
+}
+
+// putImage pushes a schema2 image with the given layer to the repository.
+func putImage(t *testing.T, repository distribution.Repository, layer []byte) (distribution.Descriptor, distribution.Descriptor) {
+	t.Helper()
+	ctx := context.Background()
+	blobs := repository.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MediaType = schema2.MediaTypeImageConfig
+	layerDesc, err := blobs.Put(ctx, schema2.MediaTypeLayer, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerDesc.MediaType = schema2.MediaTypeLayer
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layerDesc},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return distribution.Descriptor{Digest: dgst}, layerDesc
+}
+
+func TestTranscode(t *testing.T) {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, _ := reference.WithName("foo/bar")
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("layer content "), 1000)
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write(content)
+	gw.Close()
+	image, layer := putImage(t, repository, compressed.Bytes())
+
+	transcoder := New(Config{MaxSize: 1 << 20})
+	defer transcoder.Close()
+	if _, ok, err := Variant(ctx, repository, image.Digest, Zstd); ok || err != nil {
+		t.Fatalf("unexpected variant before transcoding: %v", err)
+	}
+
+	// the variant is built in the background
+	transcoder.Schedule(repository, image.Digest, Zstd)
+	var variant distribution.Descriptor
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var ok bool
+		if variant, ok, err = Variant(ctx, repository, image.Digest, Zstd); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected the variant to be published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m, err := manifests.Get(ctx, variant.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, ok := m.(*ocischema.DeserializedManifest)
+	if !ok || published.Subject == nil || published.Subject.Digest != image.Digest || len(published.Layers) != 1 {
+		t.Fatalf("unexpected variant %+v", m)
+	}
+	transcoded := published.Layers[0]
+	if transcoded.MediaType != MediaTypeLayerZstd || transcoded.Digest == layer.Digest {
+		t.Fatalf("unexpected transcoded layer %+v", transcoded)
+	}
+	stored, err := repository.Blobs(ctx).Get(ctx, transcoded.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zstd.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	decompressed, err := ioutil.ReadAll(zr)
+	if err != nil || !bytes.Equal(decompressed, content) {
+		t.Fatalf("unexpected transcoded content: %v", err)
+	}
+
+	// a published variant is not built again, and variants are not
+	// transcoded themselves
+	if err := transcoder.publish(ctx, job{repository: repository, manifest: image.Digest, format: Zstd}); err != nil {
+		t.Fatal(err)
+	}
+	if err := transcoder.publish(ctx, job{repository: repository, manifest: variant.Digest, format: Gzip}); err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := manifests.(distribution.ManifestReferrers).Referrers(ctx, image.Digest)
+	if err != nil || len(referrers) != 1 {
+		t.Fatalf("unexpected referrers %v: %v", referrers, err)
+	}
+	if referrers, err := manifests.(distribution.ManifestReferrers).Referrers(ctx, variant.Digest); err != nil || len(referrers) != 0 {
+		t.Fatalf("unexpected referrers of the variant %v: %v", referrers, err)
+	}
+
+	// images already in the format, or with layers too large, have no
+	// variant
+	if err := transcoder.publish(ctx, job{repository: repository, manifest: image.Digest, format: Gzip}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := Variant(ctx, repository, image.Digest, Gzip); ok || err != nil {
+		t.Errorf("unexpected gzip variant: %v", err)
+	}
+	other, _ := putImage(t, repository, append(compressed.Bytes(), 0))
+	small := New(Config{MaxSize: layer.Size - 1})
+	defer small.Close()
+	if err := small.publish(ctx, job{repository: repository, manifest: other.Digest, format: Zstd}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := Variant(ctx, repository, other.Digest, Zstd); ok || err != nil {
+		t.Errorf("unexpected variant of an image with layers too large: %v", err)
+	}
+}
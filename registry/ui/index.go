@@ -0,0 +1,198 @@
+package ui
+
+// indexHTML is the bundled interface. It browses the catalog, the tags and
+// metadata of repositories and inspects manifests, calling the API relatively
+// to its own location so that it works under any prefix.
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Registry</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+a { color: #0366d6; text-decoration: none; }
+a:hover { text-decoration: underline; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; }
+td.size { text-align: right; white-space: nowrap; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+code { font-size: .9em; }
+.error { color: #b00; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1><a href="#/">Registry</a></h1>
+<div id="view"></div>
+<script>
+(function() {
+  "use strict";
+
+  var api = new URL("../v2/", window.location.href).href;
+  var manifestTypes = [
+    "application/vnd.oci.image.index.v1+json",
+    "application/vnd.docker.distribution.manifest.list.v2+json",
+    "application/vnd.oci.image.manifest.v1+json",
+    "application/vnd.docker.distribution.manifest.v2+json",
+    "application/vnd.docker.distribution.manifest.v1+prettyjws"
+  ].join(", ");
+  var view = document.getElementById("view");
+
+  function escape(s) {
+    return String(s).replace(/[&<>"']/g, function(c) {
+      return {"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;"}[c];
+    });
+  }
+
+  function size(n) {
+    var units = ["B", "KiB", "MiB", "GiB", "TiB"];
+    var i = 0;
+    while (n >= 1024 && i < units.length - 1) {
+      n /= 1024;
+      i++;
+    }
+    return (i === 0 ? n : n.toFixed(1)) + " " + units[i];
+  }
+
+  function request(path, accept) {
+    var headers = {};
+    if (accept) {
+      headers["Accept"] = accept;
+    }
+    return fetch(new URL(path, api).href, {headers: headers, credentials: "same-origin"}).then(function(resp) {
+      if (!resp.ok) {
+        return resp.text().then(function(body) {
+          var message = resp.status + " " + resp.statusText;
+          try {
+            message = JSON.parse(body).errors.map(function(e) { return e.message; }).join(", ") || message;
+          } catch (e) {}
+          throw new Error(message);
+        });
+      }
+      return resp;
+    });
+  }
+
+  function next(resp) {
+    var link = resp.headers.get("Link");
+    var match = link && link.match(/<([^>]*)>/);
+    return match ? new URL(match[1], api).href : "";
+  }
+
+  function fail(err) {
+    view.innerHTML += '<p class="error">' + escape(err.message) + "</p>";
+  }
+
+  function catalog(url) {
+    if (!url) {
+      view.innerHTML = "<h2>Repositories</h2><ul id=\"repositories\"></ul>";
+      url = "_catalog?n=100";
+    }
+    request(url).then(function(resp) {
+      var more = next(resp);
+      return resp.json().then(function(body) {
+        var list = document.getElementById("repositories");
+        (body.repositories || []).forEach(function(name) {
+          list.insertAdjacentHTML("beforeend", '<li><a href="#/r/' + escape(name) + '">' + escape(name) + "</a></li>");
+        });
+        if (more) {
+          list.insertAdjacentHTML("afterend", '<p><a href="" id="more">More</a></p>');
+          document.getElementById("more").onclick = function(e) {
+            e.preventDefault();
+            this.parentNode.remove();
+            catalog(more);
+          };
+        }
+      });
+    }).catch(fail);
+  }
+
+  function repository(name) {
+    view.innerHTML = "<h2>" + escape(name) + '</h2><div id="metadata"></div><h3>Tags</h3><table id="tags"><tr><th>Tag</th></tr></table>';
+    request(name + "/_metadata").then(function(resp) {
+      return resp.json();
+    }).then(function(metadata) {
+      var html = "";
+      if (metadata.description) {
+        html += "<p>" + escape(metadata.description) + "</p>";
+      }
+      if (metadata.owner) {
+        html += '<p class="muted">Owner: ' + escape(metadata.owner) + "</p>";
+      }
+      Object.keys(metadata.labels || {}).forEach(function(key) {
+        html += '<code class="muted">' + escape(key) + "=" + escape(metadata.labels[key]) + "</code> ";
+      });
+      document.getElementById("metadata").innerHTML = html;
+    }).catch(function() {
+      // metadata is optional
+    });
+    request(name + "/tags/list").then(function(resp) {
+      return resp.json();
+    }).then(function(body) {
+      var table = document.getElementById("tags");
+      (body.tags || []).forEach(function(tag) {
+        table.insertAdjacentHTML("beforeend", '<tr><td><a href="#/r/' + escape(name) + "/m/" + escape(tag) + '">' + escape(tag) + "</a></td></tr>");
+      });
+    }).catch(fail);
+  }
+
+  function manifest(name, reference) {
+    view.innerHTML = '<h2><a href="#/r/' + escape(name) + '">' + escape(name) + "</a>:" + escape(reference) + '</h2><div id="manifest"></div>';
+    request(name + "/manifests/" + reference, manifestTypes).then(function(resp) {
+      var digest = resp.headers.get("Docker-Content-Digest") || "";
+      var mediaType = (resp.headers.get("Content-Type") || "").split(";")[0];
+      return resp.text().then(function(payload) {
+        var m = JSON.parse(payload);
+        var html = "<table>" +
+          "<tr><th>Digest</th><td><code>" + escape(digest) + "</code></td></tr>" +
+          "<tr><th>Media type</th><td><code>" + escape(mediaType) + "</code></td></tr>" +
+          '<tr><th>Pull size</th><td id="pullsize" class="muted">unknown</td></tr></table>';
+        if (m.manifests) {
+          html += "<h3>Platforms</h3><table><tr><th>Platform</th><th>Digest</th><th>Size</th></tr>";
+          m.manifests.forEach(function(d) {
+            var p = d.platform || {};
+            html += "<tr><td>" + escape([p.os, p.architecture, p.variant].filter(Boolean).join("/")) + '</td><td><a href="#/r/' + escape(name) + "/m/" + escape(d.digest) + '"><code>' + escape(d.digest) + '</code></a></td><td class="size">' + size(d.size) + "</td></tr>";
+          });
+          html += "</table>";
+        }
+        var layers = m.layers || (m.fsLayers || []).map(function(l) { return {digest: l.blobSum}; });
+        if (layers.length) {
+          html += "<h3>Layers</h3><table><tr><th>Digest</th><th>Size</th></tr>";
+          layers.forEach(function(l) {
+            html += "<tr><td><code>" + escape(l.digest) + '</code></td><td class="size">' + (l.size ? size(l.size) : "") + "</td></tr>";
+          });
+          html += "</table>";
+        }
+        html += "<h3>Manifest</h3><pre>" + escape(JSON.stringify(m, null, 2)) + "</pre>";
+        document.getElementById("manifest").innerHTML = html;
+
+        request(name + "/_size/" + (digest || reference)).then(function(resp) {
+          return resp.json();
+        }).then(function(body) {
+          document.getElementById("pullsize").textContent = size(body.size);
+        }).catch(function() {
+          // the size is optional
+        });
+      });
+    }).catch(fail);
+  }
+
+  function route() {
+    var hash = decodeURIComponent(window.location.hash.replace(/^#\/?/, ""));
+    var match;
+    if ((match = hash.match(/^r\/(.+)\/m\/([^\/]+)$/))) {
+      manifest(match[1], match[2]);
+    } else if ((match = hash.match(/^r\/(.+)$/))) {
+      repository(match[1]);
+    } else {
+      catalog();
+    }
+  }
+
+  window.addEventListener("hashchange", route);
+  route();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,75 @@
+// Package ui serves a static web user interface for the registry, either the
+// bundled one or one provided by the operator. The interface runs entirely in
+// the browser and is driven by the v2 API of the registry it is served from.
+package ui
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+)
+
+// Path is the path, relative to the prefix of the registry, under which the
+// interface is served.
+const Path = "/ui/"
+
+// startTime is the modification time reported for the bundled interface.
+var startTime = time.Now()
+
+// Handler returns a handler serving the interface configured by config under
+// Path, relative to prefix, and passing other requests to next.
+func Handler(config configuration.UI, prefix string, next http.Handler) (http.Handler, error) {
+	if !config.Enabled {
+		return next, nil
+	}
+
+	root := strings.TrimSuffix(prefix, "/") + Path
+
+	var files http.Handler
+	if config.Directory != "" {
+		fi, err := os.Stat(config.Directory)
+		if err != nil {
+			return nil, fmt.Errorf("ui directory: %v", err)
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("ui directory: %s is not a directory", config.Directory)
+		}
+		files = http.StripPrefix(root, http.FileServer(http.Dir(config.Directory)))
+	} else {
+		files = http.HandlerFunc(serveBundled(root))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == strings.TrimSuffix(root, "/"):
+			http.Redirect(w, r, root, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, root):
+			if r.Method != "GET" && r.Method != "HEAD" {
+				w.Header().Set("Allow", "GET, HEAD")
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			files.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	}), nil
+}
+
+// serveBundled serves the bundled interface, a single page whose views are
+// selected by the fragment of the url.
+func serveBundled(root string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != root && r.URL.Path != root+"index.html" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		http.ServeContent(w, r, "index.html", startTime, strings.NewReader(indexHTML))
+	}
+}
@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+)
+
+var next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusTeapot)
+})
+
+func serve(t *testing.T, h http.Handler, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestBundled(t *testing.T) {
+	h, err := Handler(configuration.UI{Enabled: true}, "/prefix/", next)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, path := range []string{"/prefix/ui/", "/prefix/ui/index.html"} {
+		w := serve(t, h, "GET", path)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `new URL("../v2/"`) {
+			t.Fatalf("%s: unexpected response %d: %q", path, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Fatalf("%s: unexpected content type %q", path, ct)
+		}
+	}
+
+	if w := serve(t, h, "GET", "/prefix/ui"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/prefix/ui/" {
+		t.Fatalf("unexpected response %d to the ui without trailing slash, location %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := serve(t, h, "GET", "/prefix/ui/missing.js"); w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected response %d to a missing file", w.Code)
+	}
+	if w := serve(t, h, "POST", "/prefix/ui/"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected response %d to a post", w.Code)
+	}
+	if w := serve(t, h, "GET", "/prefix/v2/"); w.Code != http.StatusTeapot {
+		t.Fatalf("api request not passed on: %d", w.Code)
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("custom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := Handler(configuration.UI{Enabled: true, Directory: dir}, "", next)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w := serve(t, h, "GET", "/ui/"); w.Code != http.StatusOK || w.Body.String() != "custom" {
+		t.Fatalf("unexpected index %d: %q", w.Code, w.Body.String())
+	}
+	if w := serve(t, h, "GET", "/ui/app.js"); w.Code != http.StatusOK || w.Body.String() != "app" {
+		t.Fatalf("unexpected file %d: %q", w.Code, w.Body.String())
+	}
+
+	if _, err := Handler(configuration.UI{Enabled: true, Directory: filepath.Join(dir, "missing")}, "", next); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	h, err := Handler(configuration.UI{}, "", next)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w := serve(t, h, "GET", "/ui/"); w.Code != http.StatusTeapot {
+		t.Fatalf("ui served while disabled: %d", w.Code)
+	}
+}
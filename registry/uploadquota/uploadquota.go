@@ -0,0 +1,238 @@
+// Package uploadquota limits the bytes each authenticated subject, a user or
+// the subject of a token, can upload per day, so that a runaway client cannot
+// fill a shared registry. Days are UTC days.
+package uploadquota
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/garyburd/redigo/redis"
+)
+
+const dayFormat = "2006-01-02"
+
+// Counter counts the bytes uploaded by subjects per day.
+type Counter interface {
+	// Add adds n bytes to the uploads of subject on day, and returns the
+	// bytes uploaded by subject on day.
+	Add(ctx context.Context, day, subject string, n int64) (int64, error)
+
+	// Get returns the bytes uploaded by subject on day.
+	Get(ctx context.Context, day, subject string) (int64, error)
+}
+
+// NewCounter returns a counter of the given backend, "storage" or "redis".
+// pool may be nil if the backend is not redis.
+func NewCounter(backend string, driver driver.StorageDriver, pool *redis.Pool) (Counter, error) {
+	switch backend {
+	case "", "storage":
+		return NewStorageCounter(driver, "/uploadquota"), nil
+	case "redis":
+		if pool == nil {
+			return nil, fmt.Errorf("redis configuration required to keep upload counters in redis")
+		}
+		return NewRedisCounter(pool, "registry:uploadquota:"), nil
+	default:
+		return nil, fmt.Errorf("unknown upload quota backend: %q", backend)
+	}
+}
+
+// storageCounter keeps a file per subject and day, holding the bytes the
+// subject uploaded that day.
+type storageCounter struct {
+	driver driver.StorageDriver
+	root   string
+
+	mu sync.Mutex
+	// pruned is the last day the counters of the previous days were
+	// deleted.
+	pruned string
+}
+
+// NewStorageCounter returns a counter keeping its files under root. Since
+// storage drivers offer no atomic increment, concurrent uploads of a subject
+// on several instances may be undercounted: the quota is best effort.
+func NewStorageCounter(driver driver.StorageDriver, root string) Counter {
+	return &storageCounter{
+		driver: driver,
+		root:   root,
+	}
+}
+
+func (sc *storageCounter) Add(ctx context.Context, day, subject string, n int64) (int64, error) {
+	sc.prune(ctx, day)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	used, err := sc.Get(ctx, day, subject)
+	if err != nil {
+		return 0, err
+	}
+	used += n
+	if err := sc.driver.PutContent(ctx, sc.path(day, subject), []byte(strconv.FormatInt(used, 10))); err != nil {
+		return 0, err
+	}
+	return used, nil
+}
+
+func (sc *storageCounter) Get(ctx context.Context, day, subject string) (int64, error) {
+	content, err := sc.driver.GetContent(ctx, sc.path(day, subject))
+	switch err.(type) {
+	case nil:
+	case driver.PathNotFoundError:
+		return 0, nil
+	default:
+		return 0, err
+	}
+	return strconv.ParseInt(string(content), 10, 64)
+}
+
+// prune deletes the counters of the days before day, once a day.
+func (sc *storageCounter) prune(ctx context.Context, day string) {
+	sc.mu.Lock()
+	if sc.pruned == day {
+		sc.mu.Unlock()
+		return
+	}
+	sc.pruned = day
+	sc.mu.Unlock()
+
+	days, err := sc.driver.List(ctx, sc.root)
+	if err != nil {
+		return
+	}
+	for _, p := range days {
+		if path.Base(p) < day {
+			sc.driver.Delete(ctx, p)
+		}
+	}
+}
+
+// path returns the path of the counter of subject on day. Subjects are
+// encoded, since they may hold characters not allowed in paths.
+func (sc *storageCounter) path(day, subject string) string {
+	return path.Join(sc.root, day, base64.RawURLEncoding.EncodeToString([]byte(subject)))
+}
+
+// redisCounter keeps a key per subject and day, expiring after the day.
+type redisCounter struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisCounter returns a counter keeping its keys under prefix.
+func NewRedisCounter(pool *redis.Pool, prefix string) Counter {
+	return &redisCounter{
+		pool:   pool,
+		prefix: prefix,
+	}
+}
+
+func (rc *redisCounter) Add(ctx context.Context, day, subject string, n int64) (int64, error) {
+	conn := rc.pool.Get()
+	defer conn.Close()
+
+	key := rc.key(day, subject)
+	conn.Send("MULTI")
+	conn.Send("INCRBY", key, n)
+	conn.Send("EXPIRE", key, int64(48*time.Hour/time.Second))
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+	return redis.Int64(values[0], nil)
+}
+
+func (rc *redisCounter) Get(ctx context.Context, day, subject string) (int64, error) {
+	conn := rc.pool.Get()
+	defer conn.Close()
+
+	used, err := redis.Int64(conn.Do("GET", rc.key(day, subject)))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return used, err
+}
+
+func (rc *redisCounter) key(day, subject string) string {
+	return rc.prefix + day + ":" + subject
+}
+
+// Config configures a Quota.
+type Config struct {
+	// Daily is the number of bytes a subject can upload per day. There is
+	// no limit if it is zero.
+	Daily int64
+
+	// Subjects overrides Daily for some subjects. Zero lifts the limit.
+	Subjects map[string]int64
+}
+
+// Quota enforces the daily upload quotas of subjects.
+type Quota struct {
+	counter Counter
+	config  Config
+
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+}
+
+// New returns a Quota counting uploads with counter.
+func New(counter Counter, config Config) *Quota {
+	return &Quota{
+		counter: counter,
+		config:  config,
+		now:     time.Now,
+	}
+}
+
+// Limit returns the number of bytes subject can upload per day, or zero if
+// there is no limit.
+func (q *Quota) Limit(subject string) int64 {
+	if limit, ok := q.config.Subjects[subject]; ok {
+		return limit
+	}
+	return q.config.Daily
+}
+
+// Allow returns whether subject can upload n more bytes today, with the bytes
+// it uploaded today and its limit.
+func (q *Quota) Allow(ctx context.Context, subject string, n int64) (allowed bool, used, limit int64, err error) {
+	limit = q.Limit(subject)
+	if limit <= 0 {
+		return true, 0, 0, nil
+	}
+	used, err = q.counter.Get(ctx, q.day(), subject)
+	if err != nil {
+		return false, 0, limit, err
+	}
+	return used < limit && used+n <= limit, used, limit, nil
+}
+
+// Record adds n bytes to the uploads of subject today. Uploads of subjects
+// without limit are not counted.
+func (q *Quota) Record(ctx context.Context, subject string, n int64) error {
+	if n <= 0 || q.Limit(subject) <= 0 {
+		return nil
+	}
+	_, err := q.counter.Add(ctx, q.day(), subject, n)
+	return err
+}
+
+// Reset returns the time quotas are reset, the start of the next day.
+func (q *Quota) Reset() time.Time {
+	now := q.now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func (q *Quota) day() string {
+	return q.now().UTC().Format(dayFormat)
+}
@@ -0,0 +1,72 @@
+package uploadquota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	counter, err := NewCounter("storage", d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCounter("redis", d, nil); err == nil {
+		t.Fatal("expected an error without redis pool")
+	}
+
+	now := time.Date(2020, 3, 1, 23, 0, 0, 0, time.UTC)
+	quota := New(counter, Config{Daily: 100, Subjects: map[string]int64{"ci": 10, "admin": 0}})
+	quota.now = func() time.Time { return now }
+
+	check := func(subject string, n int64, expected bool) {
+		t.Helper()
+		allowed, _, _, err := quota.Allow(ctx, subject, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != expected {
+			t.Fatalf("unexpected answer for %d bytes of %q: %v", n, subject, allowed)
+		}
+	}
+	record := func(subject string, n int64) {
+		t.Helper()
+		if err := quota.Record(ctx, subject, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check("alice", 100, true)
+	record("alice", 60)
+	check("alice", 40, true)
+	check("alice", 41, false)
+	record("alice", 50)
+	check("alice", 0, false)
+
+	check("ci", 11, false)
+	record("ci", 10)
+	check("ci", 0, false)
+
+	record("admin", 1000)
+	check("admin", 1000, true)
+	if used, err := counter.Get(ctx, quota.day(), "admin"); err != nil || used != 0 {
+		t.Fatalf("uploads of subjects without limit should not be counted: %d, %v", used, err)
+	}
+
+	if reset := quota.Reset(); !reset.Equal(time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected reset time %v", reset)
+	}
+
+	// quotas are reset the next day, and the counters of the previous days
+	// deleted
+	now = now.Add(2 * time.Hour)
+	check("alice", 100, true)
+	record("alice", 1)
+	if used, err := counter.Get(ctx, "2020-03-01", "alice"); err != nil || used != 0 {
+		t.Fatalf("expected the counters of the previous day to be deleted: %d, %v", used, err)
+	}
+}
@@ -25,3 +25,26 @@ type TagService interface {
 	// Lookup returns the set of tags referencing the given digest.
 	Lookup(ctx context.Context, digest Descriptor) ([]string, error)
 }
+
+// TagOrder is the order in which a TagPager lists tags.
+type TagOrder int
+
+const (
+	// TagOrderLexical lists tags in lexical order of their names.
+	TagOrderLexical TagOrder = iota
+
+	// TagOrderCreated lists tags in the order they were created or last
+	// moved to another manifest, oldest first. Tags created at the same
+	// time are listed in lexical order.
+	TagOrderCreated
+)
+
+// TagPager is implemented by tag services that can list the tags of a
+// repository a page at a time, without holding all of them in memory.
+type TagPager interface {
+	// Page fills tags with the tags following last in the given order and
+	// returns the number of tags filled. An empty last starts from the
+	// first tag. io.EOF is returned once no tags follow those filled.
+	// ErrUnsupported is returned if the service cannot page tags.
+	Page(ctx context.Context, tags []string, last string, order TagOrder) (int, error)
+}